@@ -0,0 +1,227 @@
+// Package analytics tracks anonymized usage events, such as messages sent
+// and reactions added, and sends them to a sink the operator runs, so
+// product analytics need no third-party SDK in the clients. Events never
+// carry content, usernames or addresses: users are identified by a keyed
+// hash of their username, and those who opted out are left out entirely.
+package analytics
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"time"
+
+	"backend/metrics"
+)
+
+// Event types.
+const (
+	MessageSent   = "message_sent"
+	RoomJoined    = "room_joined"
+	ReactionAdded = "reaction_added"
+)
+
+// Sinks events can be sent to.
+const (
+	SinkFile = "file"
+	SinkHTTP = "http"
+)
+
+// Tracker settings. Events wait in a queue of queueSize and are sent in
+// batches of up to batchSize, at least every flushInterval; when the queue
+// is full new events are dropped rather than slowing down the request that
+// caused them.
+const (
+	queueSize     = 4096
+	batchSize     = 100
+	flushInterval = 10 * time.Second
+	sendTimeout   = 10 * time.Second
+	drainTimeout  = 5 * time.Second
+)
+
+// Event is a usage event as sent, encoded as JSON.
+type Event struct {
+	// ID identifies the event, so sinks can drop duplicates.
+	ID   string `json:"id"`
+	Type string `json:"type"`
+	// Time is when the event happened, to the minute.
+	Time time.Time `json:"time"`
+	// User is a pseudonymous ID of the user, the same in every event of
+	// theirs as long as the key does not change.
+	User       string            `json:"user"`
+	Properties map[string]string `json:"properties,omitempty"`
+}
+
+// Sink receives batches of events.
+type Sink interface {
+	Send(ctx context.Context, events []Event) error
+	// Close flushes buffered events and releases the sink.
+	Close() error
+}
+
+// Config selects the sink events are sent to.
+type Config struct {
+	// Sink is file, http or empty to track nothing.
+	Sink string
+	// URL is the file events are appended to as JSON lines, - for standard
+	// output, or the HTTP endpoint batches are posted to.
+	URL string
+}
+
+// New opens the sink cfg selects. It returns a nil Sink if no sink is
+// configured.
+func New(cfg Config) (Sink, error) {
+	switch cfg.Sink {
+	case "":
+		return nil, nil
+	case SinkFile:
+		return NewFile(cfg.URL)
+	case SinkHTTP:
+		return NewHTTP(cfg.URL), nil
+	}
+	return nil, fmt.Errorf("unknown analytics sink %q, expected %s or %s", cfg.Sink, SinkFile, SinkHTTP)
+}
+
+// tracked is an event queued with the username it is about, which is
+// replaced by its pseudonym once the user is known not to have opted out.
+type tracked struct {
+	event    Event
+	username string
+}
+
+// Tracker queues events and sends them in the background, so a slow or
+// unreachable sink never delays the request that caused an event.
+type Tracker struct {
+	sink  Sink
+	key   []byte
+	queue chan tracked
+	// optedOut reports whether a user opted out of analytics.
+	optedOut func(ctx context.Context, username string) (bool, error)
+}
+
+// NewTracker creates a Tracker sending to sink, identifying users by their
+// username hashed with key, and leaving out the events of users optedOut
+// reports. With a nil sink events are discarded.
+func NewTracker(sink Sink, key []byte, optedOut func(ctx context.Context, username string) (bool, error)) *Tracker {
+	return &Tracker{sink: sink, key: key, queue: make(chan tracked, queueSize), optedOut: optedOut}
+}
+
+// Track queues an event of eventType by username with properties, which
+// must not identify anyone.
+func (t *Tracker) Track(eventType, username string, properties map[string]string) {
+	if t.sink == nil {
+		return
+	}
+
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		log.Printf("Error generating %s analytics event ID: %v", eventType, err)
+		return
+	}
+
+	e := Event{ID: hex.EncodeToString(id), Type: eventType, Time: time.Now().UTC().Truncate(time.Minute), Properties: properties}
+	select {
+	case t.queue <- tracked{event: e, username: username}:
+	default:
+		metrics.AnalyticsEvents.WithLabelValues("dropped").Inc()
+	}
+}
+
+// Run sends queued events until ctx is done, then sends what is still
+// queued for up to drainTimeout and closes the sink.
+func (t *Tracker) Run(ctx context.Context) {
+	if t.sink == nil {
+		return
+	}
+
+	ticker := time.NewTicker(flushInterval)
+	defer ticker.Stop()
+
+	var batch []tracked
+	for {
+		select {
+		case e := <-t.queue:
+			batch = append(batch, e)
+			if len(batch) >= batchSize {
+				t.send(context.Background(), batch)
+				batch = nil
+			}
+		case <-ticker.C:
+			t.send(context.Background(), batch)
+			batch = nil
+		case <-ctx.Done():
+			t.drain(batch)
+			return
+		}
+	}
+}
+
+// drain sends batch and the queued events, and closes the sink.
+func (t *Tracker) drain(batch []tracked) {
+	ctx, cancel := context.WithTimeout(context.Background(), drainTimeout)
+	defer cancel()
+
+	for len(t.queue) > 0 {
+		batch = append(batch, <-t.queue)
+	}
+	for len(batch) > 0 && ctx.Err() == nil {
+		n := min(len(batch), batchSize)
+		t.send(ctx, batch[:n])
+		batch = batch[n:]
+	}
+	if err := t.sink.Close(); err != nil {
+		log.Printf("Error closing analytics sink: %v", err)
+	}
+}
+
+// send sends one batch without the events of users who opted out, logging
+// failures. Events of users whose choice cannot be read are left out too.
+func (t *Tracker) send(ctx context.Context, batch []tracked) {
+	if len(batch) == 0 {
+		return
+	}
+	ctx, cancel := context.WithTimeout(ctx, sendTimeout)
+	defer cancel()
+
+	optedOut := make(map[string]bool)
+	events := make([]Event, 0, len(batch))
+	for _, e := range batch {
+		out, ok := optedOut[e.username]
+		if !ok {
+			var err error
+			if out, err = t.optedOut(ctx, e.username); err != nil {
+				log.Printf("Error checking analytics opt-out of %s: %v", e.username, err)
+				out = true
+			}
+			optedOut[e.username] = out
+		}
+		if out {
+			metrics.AnalyticsEvents.WithLabelValues("opted_out").Inc()
+			continue
+		}
+		e.event.User = t.pseudonym(e.username)
+		events = append(events, e.event)
+	}
+	if len(events) == 0 {
+		return
+	}
+
+	if err := t.sink.Send(ctx, events); err != nil {
+		log.Printf("Error sending %d analytics events: %v", len(events), err)
+		metrics.AnalyticsEvents.WithLabelValues("failed").Add(float64(len(events)))
+		return
+	}
+	metrics.AnalyticsEvents.WithLabelValues("sent").Add(float64(len(events)))
+}
+
+// pseudonym returns the ID events of username carry: an HMAC of the
+// username, which cannot be reversed or recomputed without the key.
+func (t *Tracker) pseudonym(username string) string {
+	mac := hmac.New(sha256.New, t.key)
+	mac.Write([]byte(username))
+	return hex.EncodeToString(mac.Sum(nil)[:16])
+}
@@ -0,0 +1,107 @@
+package analytics
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+)
+
+// File appends events to a file as JSON lines, one event per line, for a
+// log shipper or batch job to pick up.
+type File struct {
+	mu sync.Mutex
+	f  *os.File
+	w  *bufio.Writer
+}
+
+// NewFile opens path for appending, creating it if missing. A path of -
+// writes to standard output.
+func NewFile(path string) (*File, error) {
+	if path == "-" {
+		return &File{w: bufio.NewWriter(os.Stdout)}, nil
+	}
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o600)
+	if err != nil {
+		return nil, err
+	}
+	return &File{f: f, w: bufio.NewWriter(f)}, nil
+}
+
+func (f *File) Send(ctx context.Context, events []Event) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	enc := json.NewEncoder(f.w)
+	for _, e := range events {
+		if err := enc.Encode(e); err != nil {
+			return err
+		}
+	}
+	return f.w.Flush()
+}
+
+func (f *File) Close() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if err := f.w.Flush(); err != nil {
+		return err
+	}
+	if f.f == nil {
+		return nil
+	}
+	return f.f.Close()
+}
+
+// httpTimeout bounds each batch posted by HTTP.
+const httpTimeout = 10 * time.Second
+
+// HTTP posts each batch of events as {"events": [...]} to an endpoint, such
+// as a self-hosted collector.
+type HTTP struct {
+	url    string
+	client *http.Client
+}
+
+// NewHTTP creates an HTTP sink posting to url.
+func NewHTTP(url string) *HTTP {
+	return &HTTP{url: url, client: &http.Client{Timeout: httpTimeout}}
+}
+
+func (h *HTTP) Send(ctx context.Context, events []Event) error {
+	body, err := json.Marshal(struct {
+		Events []Event `json:"events"`
+	}{events})
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, h.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := h.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, resp.Body)
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("analytics endpoint answered %s", resp.Status)
+	}
+	return nil
+}
+
+func (h *HTTP) Close() error {
+	h.client.CloseIdleConnections()
+	return nil
+}
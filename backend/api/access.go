@@ -0,0 +1,54 @@
+package api
+
+import (
+	"errors"
+
+	"backend/apperr"
+	"backend/auth"
+	"backend/service"
+	"backend/store"
+
+	"github.com/gin-gonic/gin"
+)
+
+// authorizeMessage returns the sender and receiver of a message the
+// authenticated user takes part in. Otherwise it responds with an error and
+// returns false.
+func (s *Server) authorizeMessage(c *gin.Context, messageID string) (string, string, bool) {
+	sender, receiver, err := service.AuthorizeMessage(c.Request.Context(), s.store, messageID, auth.CurrentUser(c))
+	switch {
+	case errors.Is(err, store.ErrNotFound):
+		c.Error(apperr.New(apperr.MessageNotFound, "Message not found"))
+		return "", "", false
+	case errors.Is(err, service.ErrNotParticipant):
+		c.Error(apperr.New(apperr.NotParticipant, "You are not a participant of this conversation"))
+		return "", "", false
+	case err != nil:
+		c.Error(apperr.New(apperr.Internal, "Failed to fetch message"))
+		return "", "", false
+	}
+	return sender, receiver, true
+}
+
+// conversationPeer returns the other participant of the conversation named by
+// the receiver query parameter and an optional sender, which defaults to the
+// authenticated user. Either may be the user. Otherwise it responds with an
+// error and returns false.
+func conversationPeer(c *gin.Context) (string, bool) {
+	viewer := auth.CurrentUser(c)
+	receiver := c.Query("receiver")
+	sender := c.DefaultQuery("sender", viewer)
+	if receiver == "" {
+		c.Error(apperr.New(apperr.InvalidRequest, "Missing receiver"))
+		return "", false
+	}
+	if err := service.AuthorizeConversation(viewer, sender, receiver); err != nil {
+		c.Error(apperr.New(apperr.NotParticipant, "You are not a participant of this conversation"))
+		return "", false
+	}
+
+	if receiver == viewer {
+		return sender, true
+	}
+	return receiver, true
+}
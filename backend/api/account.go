@@ -0,0 +1,210 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+
+	"backend/apperr"
+	"backend/auth"
+	"backend/store"
+	"backend/usernames"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-redis/redis/v8"
+)
+
+// renamedUsernameTTL is how long a username stays reserved after its owner
+// changes it. Access tokens carry the username, so nobody else may take it
+// until the last token issued to it has expired.
+const renamedUsernameTTL = auth.TokenTTL
+
+// renamedUsernameKey returns the Redis key reserving a username that was
+// changed, holding the name it was changed to.
+func renamedUsernameKey(username string) string {
+	return fmt.Sprintf("renamed_username:%s", usernames.Normalize(username))
+}
+
+// checkUsernameReleased returns a USERNAME_TAKEN error if username is still
+// reserved after a rename, unless owner is the user it was renamed to.
+func (s *Server) checkUsernameReleased(ctx context.Context, username, owner string) *apperr.Error {
+	renamedTo, err := s.rdb.Get(ctx, renamedUsernameKey(username)).Result()
+	if err == redis.Nil {
+		return nil
+	}
+	if err != nil {
+		return apperr.New(apperr.Internal, "Failed to check username")
+	}
+	if owner != "" && renamedTo == owner {
+		return nil
+	}
+	return apperr.New(apperr.UsernameTaken, "Username already taken")
+}
+
+// checkPassword verifies a user's current password.
+func (s *Server) checkPassword(ctx context.Context, username, password string) (bool, error) {
+	storedPassword, err := s.store.PasswordHash(ctx, username)
+	if err != nil {
+		return false, err
+	}
+	ok, _ := s.passwords.Check(storedPassword, password)
+	return ok, nil
+}
+
+// issueTokens starts a new session for username on the client of c and
+// returns an access and refresh token.
+func (s *Server) issueTokens(c *gin.Context, username string) (gin.H, error) {
+	tokens, err := s.sessions.Issue(c.Request.Context(), username, sessionClient(c))
+	if err != nil {
+		return nil, err
+	}
+	return s.tokenResponse(c, tokens)
+}
+
+// changePasswordHandler changes the authenticated user's password after
+// verifying the old one. All other sessions are revoked and a fresh token
+// pair is returned.
+func (s *Server) changePasswordHandler(c *gin.Context) {
+	ctx := c.Request.Context()
+	username := auth.CurrentUser(c)
+
+	var req struct {
+		OldPassword string `json:"old_password"`
+		NewPassword string `json:"new_password"`
+	}
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.Error(apperr.New(apperr.InvalidRequest, "Invalid request payload"))
+		return
+	}
+
+	ok, err := s.checkPassword(ctx, username, req.OldPassword)
+	if err != nil && !errors.Is(err, store.ErrNotFound) {
+		c.Error(apperr.New(apperr.Internal, "Failed to verify password"))
+		return
+	}
+	if !ok {
+		c.Error(apperr.New(apperr.InvalidCredentials, "Old password is incorrect"))
+		return
+	}
+
+	if err := auth.ValidatePassword(req.NewPassword); err != nil {
+		c.Error(apperr.New(apperr.InvalidPassword, err.Error()))
+		return
+	}
+
+	hashedPassword, err := s.passwords.Hash(req.NewPassword)
+	if err != nil {
+		c.Error(apperr.New(apperr.Internal, "Failed to hash password"))
+		return
+	}
+
+	if err := s.store.SetPasswordHash(ctx, username, hashedPassword); err != nil {
+		c.Error(apperr.New(apperr.Internal, "Failed to update password"))
+		return
+	}
+
+	if err := s.store.RevokeUserSessions(ctx, username); err != nil {
+		log.Printf("Error revoking sessions of %s: %v", username, err)
+	}
+	s.audit(ctx, store.AuditEntry{Action: auditPasswordChanged, Target: username})
+
+	tokens, err := s.issueTokens(c, username)
+	if err != nil {
+		c.Error(apperr.New(apperr.Internal, "Failed to create session"))
+		return
+	}
+
+	tokens["message"] = s.tr(c, "Password changed successfully")
+	c.JSON(http.StatusOK, tokens)
+}
+
+// changeUsernameHandler renames the authenticated user, carrying their
+// messages, votes and other history over. Tokens carry the username, so
+// every session is revoked and a new token pair for the new name is
+// returned.
+func (s *Server) changeUsernameHandler(c *gin.Context) {
+	ctx := c.Request.Context()
+	username := auth.CurrentUser(c)
+
+	var req struct {
+		Username string `json:"username"`
+		Password string `json:"password"`
+	}
+
+	if err := c.ShouldBindJSON(&req); err != nil || req.Username == "" {
+		c.Error(apperr.New(apperr.InvalidRequest, "Invalid request payload"))
+		return
+	}
+
+	ok, err := s.checkPassword(ctx, username, req.Password)
+	if err != nil && !errors.Is(err, store.ErrNotFound) {
+		c.Error(apperr.New(apperr.Internal, "Failed to verify password"))
+		return
+	}
+	if !ok {
+		c.Error(apperr.New(apperr.InvalidCredentials, "Password is incorrect"))
+		return
+	}
+
+	if req.Username == username {
+		c.Error(apperr.New(apperr.InvalidRequest, "New username must be different"))
+		return
+	}
+	if e := s.checkUsername(req.Username); e != nil {
+		c.Error(e)
+		return
+	}
+
+	if e := s.checkUsernameReleased(ctx, req.Username, username); e != nil {
+		c.Error(e)
+		return
+	}
+
+	err = s.store.RenameUser(ctx, username, req.Username)
+	if errors.Is(err, store.ErrUsernameTaken) {
+		c.Error(apperr.New(apperr.UsernameTaken, "Username already taken"))
+		return
+	}
+	if err != nil {
+		c.Error(apperr.New(apperr.Internal, "Failed to rename user"))
+		return
+	}
+
+	// Tokens issued to the old name stay valid until they expire, so the
+	// name cannot be taken by anyone else before then, its reset links stop
+	// working and its connections are closed.
+	if err := s.rdb.Set(ctx, renamedUsernameKey(username), req.Username, renamedUsernameTTL).Err(); err != nil {
+		log.Printf("Error reserving username %s: %v", username, err)
+	}
+	if err := s.revokePasswordResets(ctx, username); err != nil {
+		log.Printf("Error revoking reset tokens of %s: %v", username, err)
+	}
+	if err := s.publishAdmin(ctx, adminMessage{Renamed: username}); err != nil {
+		log.Printf("Error publishing rename of %s: %v", username, err)
+	}
+
+	s.audit(ctx, store.AuditEntry{Action: auditUsernameChanged, Target: req.Username, Details: map[string]string{"old_username": username}})
+
+	// Cached conversations still carry the old username. Each conversation
+	// records the change so contacts know who they are talking to.
+	if contacts, err := s.store.Contacts(ctx, req.Username); err == nil {
+		for _, contact := range contacts {
+			s.cache.Invalidate(ctx, username, contact)
+			s.cache.Invalidate(ctx, contact, username)
+			s.postSystemMessage(ctx, req.Username, contact, store.SystemEvent{Event: store.SystemUsernameChanged, OldUsername: username})
+		}
+	}
+
+	tokens, err := s.issueTokens(c, req.Username)
+	if err != nil {
+		c.Error(apperr.New(apperr.Internal, "Failed to create session"))
+		return
+	}
+
+	tokens["message"] = s.tr(c, "Username changed successfully")
+	tokens["username"] = req.Username
+	c.JSON(http.StatusOK, tokens)
+}
@@ -0,0 +1,201 @@
+package api
+
+import (
+	"archive/zip"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"time"
+
+	"backend/apperr"
+	"backend/auth"
+	"backend/blob"
+	"backend/service"
+	"backend/store"
+
+	"github.com/gin-gonic/gin"
+)
+
+// deleteAccountHandler deletes the authenticated user's account after
+// verifying their password. Logins stop and sessions end at once; their data
+// is erased in the background, see service.AccountEraser.
+func (s *Server) deleteAccountHandler(c *gin.Context) {
+	ctx := c.Request.Context()
+	username := auth.CurrentUser(c)
+
+	var req struct {
+		Password string `json:"password"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.Error(apperr.New(apperr.InvalidRequest, "Invalid request payload"))
+		return
+	}
+
+	ok, err := s.checkPassword(ctx, username, req.Password)
+	if err != nil && !errors.Is(err, store.ErrNotFound) {
+		c.Error(apperr.New(apperr.Internal, "Failed to verify password"))
+		return
+	}
+	if !ok {
+		c.Error(apperr.New(apperr.InvalidCredentials, "Password is incorrect"))
+		return
+	}
+
+	if err := s.store.RequestDeletion(ctx, username); err != nil {
+		c.Error(apperr.New(apperr.Internal, "Failed to delete account"))
+		return
+	}
+
+	s.audit(ctx, store.AuditEntry{Action: auditAccountDeleted, Target: username})
+
+	if err := s.publishAdmin(ctx, adminMessage{Deleted: username}); err != nil {
+		log.Printf("Error publishing deletion of %s: %v", username, err)
+	}
+
+	c.JSON(http.StatusAccepted, gin.H{"message": s.tr(c, "Account deletion scheduled")})
+}
+
+// exportAccountHandler streams a zip archive of the authenticated user's
+// personal data: their profile and settings, every message they sent or
+// received and the files they uploaded.
+func (s *Server) exportAccountHandler(c *gin.Context) {
+	ctx := c.Request.Context()
+	username := auth.CurrentUser(c)
+
+	data, err := s.store.PersonalData(ctx, username)
+	if err != nil {
+		c.Error(apperr.New(apperr.Internal, "Failed to export account"))
+		return
+	}
+
+	c.Header("Content-Type", "application/zip")
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%q", "account-"+username+".zip"))
+	c.Status(http.StatusOK)
+
+	// Once streaming started the status is sent, so a failure can only cut
+	// the archive short.
+	if err := writeAccountArchive(ctx, c.Writer, s.store, s.blobs, data); err != nil {
+		log.Printf("Error exporting account %s: %v", username, err)
+	}
+}
+
+// writeAccountArchive writes the zip archive of a user's data to w.
+func writeAccountArchive(ctx context.Context, w io.Writer, st store.Store, blobs blob.Store, data store.PersonalData) error {
+	zw := zip.NewWriter(w)
+	modified := time.Now()
+
+	f, err := zw.CreateHeader(&zip.FileHeader{Name: "profile.json", Method: zip.Deflate, Modified: modified})
+	if err != nil {
+		return err
+	}
+	enc := json.NewEncoder(f)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(data); err != nil {
+		return err
+	}
+
+	f, err = zw.CreateHeader(&zip.FileHeader{Name: "messages.json", Method: zip.Deflate, Modified: modified})
+	if err != nil {
+		return err
+	}
+	if err := writeMessagesOf(ctx, f, st, data.Username); err != nil {
+		return err
+	}
+
+	for _, a := range data.Attachments {
+		if err := addFile(ctx, zw, blobs, fmt.Sprintf("attachments/%s-%s", a.ID, a.Filename), a.Key, modified); err != nil {
+			return err
+		}
+	}
+
+	return zw.Close()
+}
+
+// writeMessagesOf writes every message of a user to w as a JSON array.
+func writeMessagesOf(ctx context.Context, w io.Writer, st store.Store, username string) error {
+	enc := json.NewEncoder(w)
+	if _, err := io.WriteString(w, "["); err != nil {
+		return err
+	}
+
+	first := true
+	err := st.EachMessageOf(ctx, username, func(msg store.Message) error {
+		if !first {
+			if _, err := io.WriteString(w, ","); err != nil {
+				return err
+			}
+		}
+		first = false
+		return enc.Encode(msg)
+	})
+	if err != nil {
+		return err
+	}
+
+	_, err = io.WriteString(w, "]\n")
+	return err
+}
+
+// addFile copies the file stored under key into the archive as name. Files
+// that no longer exist are skipped.
+func addFile(ctx context.Context, zw *zip.Writer, blobs blob.Store, name, key string, modified time.Time) error {
+	file, err := blobs.Get(ctx, key)
+	if errors.Is(err, blob.ErrNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	f, err := zw.CreateHeader(&zip.FileHeader{Name: name, Method: zip.Store, Modified: modified})
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(f, file)
+	return err
+}
+
+// afterErased drops cached copies of an erased user's conversations.
+func (s *Server) afterErased(ctx context.Context, username string, contacts []string) {
+	for _, contact := range contacts {
+		s.cache.Invalidate(ctx, username, contact)
+		s.cache.Invalidate(ctx, contact, username)
+	}
+}
+
+// RunAccountEraser erases deleted accounts until ctx is done.
+func (s *Server) RunAccountEraser(ctx context.Context) {
+	s.eraser.Run(ctx)
+}
+
+// AccountUsage is what the authenticated user sent and stores, and the
+// quotas it counts against. A quota of 0 means no limit.
+type AccountUsage struct {
+	store.Usage
+	// MessageQuota is how many messages may be sent per WindowSeconds.
+	MessageQuota      int   `json:"message_quota"`
+	WindowSeconds     int   `json:"window_seconds"`
+	StorageQuotaBytes int64 `json:"storage_quota_bytes"`
+}
+
+// usageHandler returns the authenticated user's usage and quotas.
+func (s *Server) usageHandler(c *gin.Context) {
+	usage, err := s.messages.Usage(c.Request.Context(), auth.CurrentUser(c))
+	if err != nil {
+		c.Error(apperr.New(apperr.Internal, "Failed to fetch usage"))
+		return
+	}
+
+	quotas := s.messages.Quotas()
+	c.JSON(http.StatusOK, AccountUsage{
+		Usage:             usage,
+		MessageQuota:      quotas.MessagesPerDay,
+		WindowSeconds:     int(service.QuotaWindow / time.Second),
+		StorageQuotaBytes: quotas.StorageBytes,
+	})
+}
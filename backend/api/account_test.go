@@ -0,0 +1,79 @@
+package api_test
+
+import (
+	"net/http"
+	"net/url"
+	"regexp"
+	"testing"
+)
+
+func TestChangeUsernameRejectsVariants(t *testing.T) {
+	ts := newTestServer(t)
+	alice := ts.signup("alice")
+	ts.signup("bob")
+
+	for _, name := range []string{"Bob", "BOB", "ｂｏｂ"} {
+		t.Run(name, func(t *testing.T) {
+			res := ts.request("PUT", "/account/username", alice, map[string]string{"username": name, "password": "password1"})
+			expectError(t, res, http.StatusConflict, "USERNAME_TAKEN")
+		})
+	}
+
+	// Users may change the case of their own name.
+	res := ts.request("PUT", "/account/username", alice, map[string]string{"username": "Alice", "password": "password1"})
+	if res.Code != http.StatusOK || res.Body["username"] != "Alice" {
+		t.Fatalf("got %d %v", res.Code, res.Body)
+	}
+}
+
+func TestChangeUsernameReservesOldName(t *testing.T) {
+	ts := newTestServer(t)
+	oldToken := ts.signup("alice")
+
+	res := ts.request("PUT", "/account/username", oldToken, map[string]string{"username": "alicia", "password": "password1"})
+	if res.Code != http.StatusOK {
+		t.Fatalf("rename: %d %v", res.Code, res.Body)
+	}
+	newToken := res.Body["token"].(string)
+
+	// The token issued to the old name must not pass for a newcomer.
+	expectError(t, ts.request("GET", "/users", oldToken, nil), http.StatusUnauthorized, "UNAUTHENTICATED")
+	for _, name := range []string{"alice", "ALICE"} {
+		res = ts.request("POST", "/signup", "", map[string]string{"username": name, "password": "password1"})
+		expectError(t, res, http.StatusConflict, "USERNAME_TAKEN")
+	}
+
+	// The user it was renamed to may take it back.
+	res = ts.request("PUT", "/account/username", newToken, map[string]string{"username": "alice", "password": "password1"})
+	if res.Code != http.StatusOK {
+		t.Fatalf("rename back: %d %v", res.Code, res.Body)
+	}
+}
+
+func TestChangeUsernameRevokesPasswordResets(t *testing.T) {
+	ts := newTestServer(t)
+	res := ts.request("POST", "/signup", "", map[string]string{"username": "alice", "password": "password1", "email": "alice@example.com"})
+	if res.Code != http.StatusOK {
+		t.Fatalf("signup: %d %v", res.Code, res.Body)
+	}
+	res = ts.request("POST", "/login", "", map[string]string{"username": "alice", "password": "password1"})
+	token := res.Body["token"].(string)
+
+	ts.request("POST", "/password/forgot", "", map[string]string{"email": "alice@example.com"})
+	m := regexp.MustCompile(`token=(\S+)`).FindStringSubmatch(ts.outbox.last())
+	if m == nil {
+		t.Fatalf("no reset link in %q", ts.outbox.last())
+	}
+	resetToken, err := url.QueryUnescape(m[1])
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	res = ts.request("PUT", "/account/username", token, map[string]string{"username": "alicia", "password": "password1"})
+	if res.Code != http.StatusOK {
+		t.Fatalf("rename: %d %v", res.Code, res.Body)
+	}
+
+	res = ts.request("POST", "/password/reset", "", map[string]string{"token": resetToken, "password": "password2"})
+	expectError(t, res, http.StatusBadRequest, "INVALID_RESET_TOKEN")
+}
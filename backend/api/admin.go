@@ -0,0 +1,249 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"backend/apperr"
+	"backend/auth"
+	"backend/store"
+	"backend/ws"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/websocket"
+)
+
+// adminChannel is the pub/sub channel carrying announcements, bans and
+// account deletions, so every instance can act on the clients connected to it.
+const adminChannel = "chat:admin"
+
+// contextRoleKey is the Gin context key holding the authenticated user's role.
+const contextRoleKey = "role"
+
+// AnnouncementEvent is a system announcement sent to every connected client.
+type AnnouncementEvent struct {
+	Type      string    `json:"type"`
+	Content   string    `json:"content"`
+	Sender    string    `json:"sender"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// adminMessage is the Pub/Sub payload of an admin action.
+type adminMessage struct {
+	Announcement *AnnouncementEvent `json:"announcement,omitempty"`
+	Banned       string             `json:"banned,omitempty"`
+	Deleted      string             `json:"deleted,omitempty"`
+	Renamed      string             `json:"renamed,omitempty"`
+	TokenRotated string             `json:"token_rotated,omitempty"`
+}
+
+// requireActive rejects requests from banned users, whose access tokens stay
+// valid until they expire, and stores the user's role for requireAdmin.
+func (s *Server) requireActive() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		role, err := s.checkActive(c.Request.Context(), auth.CurrentUser(c))
+		if err != nil {
+			apperr.Abort(c, err)
+			return
+		}
+
+		c.Set(contextRoleKey, role)
+		c.Next()
+	}
+}
+
+// checkActive returns the role of an authenticated user, or an error if
+// they were banned or deleted since their token was issued.
+func (s *Server) checkActive(ctx context.Context, username string) (string, error) {
+	role, banned, err := s.store.Role(ctx, username)
+	if errors.Is(err, store.ErrNotFound) {
+		return "", apperr.New(apperr.Unauthenticated, "Invalid or expired token")
+	}
+	if err != nil {
+		return "", apperr.New(apperr.Internal, "Failed to fetch user")
+	}
+	if banned {
+		return "", apperr.New(apperr.Banned, "Account is banned")
+	}
+	return role, nil
+}
+
+// requireAdmin rejects requests from users who are not admins. It must run
+// after requireActive.
+func (s *Server) requireAdmin() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if c.GetString(contextRoleKey) != store.RoleAdmin {
+			apperr.Abort(c, apperr.New(apperr.AdminRequired, "Admin access required"))
+			return
+		}
+		c.Next()
+	}
+}
+
+// publishAdmin sends an admin action to every backend instance.
+func (s *Server) publishAdmin(ctx context.Context, am adminMessage) error {
+	payload, err := json.Marshal(am)
+	if err != nil {
+		return err
+	}
+	return s.bus.Publish(ctx, adminChannel, payload)
+}
+
+// deliverAdmin applies a published admin action to locally connected clients.
+func (s *Server) deliverAdmin(payload string) {
+	var am adminMessage
+	if err := json.Unmarshal([]byte(payload), &am); err != nil {
+		log.Printf("Error decoding admin event: %v", err)
+		return
+	}
+
+	if am.Announcement != nil {
+		s.hub.SendToAll(ws.Event{Type: ws.TypeAnnouncement, Payload: am.Announcement})
+	}
+	if am.Banned != "" {
+		s.hub.Disconnect(am.Banned, websocket.ClosePolicyViolation, "Account is banned")
+	}
+	if am.Deleted != "" {
+		s.hub.Disconnect(am.Deleted, websocket.CloseNormalClosure, "Account deleted")
+	}
+	if am.Renamed != "" {
+		s.hub.Disconnect(am.Renamed, websocket.CloseNormalClosure, "Username changed")
+	}
+	if am.TokenRotated != "" {
+		s.hub.Disconnect(am.TokenRotated, websocket.ClosePolicyViolation, "Bot token rotated")
+	}
+}
+
+// adminUsersHandler lists every user with their role and ban state.
+func (s *Server) adminUsersHandler(c *gin.Context) {
+	users, err := s.store.Users(c.Request.Context())
+	if err != nil {
+		c.Error(apperr.New(apperr.Internal, "Failed to fetch users"))
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"users": users})
+}
+
+// banUserHandler bans a user, revoking their sessions and disconnecting
+// their WebSocket clients on every instance.
+func (s *Server) banUserHandler(c *gin.Context) {
+	ctx := c.Request.Context()
+	target := c.Param("username")
+
+	if target == auth.CurrentUser(c) {
+		c.Error(apperr.New(apperr.InvalidRequest, "You cannot ban yourself"))
+		return
+	}
+
+	err := s.store.SetBanned(ctx, target, true)
+	if errors.Is(err, store.ErrNotFound) {
+		c.Error(apperr.New(apperr.UserNotFound, "User not found"))
+		return
+	}
+	if err != nil {
+		c.Error(apperr.New(apperr.Internal, "Failed to ban user"))
+		return
+	}
+
+	s.disconnectBanned(ctx, target)
+	s.audit(ctx, store.AuditEntry{Action: auditUserBanned, Target: target})
+
+	c.JSON(http.StatusOK, gin.H{"message": s.tr(c, "User banned successfully")})
+}
+
+// disconnectBanned closes the WebSocket clients of a newly banned user on
+// every instance.
+func (s *Server) disconnectBanned(ctx context.Context, username string) {
+	if err := s.publishAdmin(ctx, adminMessage{Banned: username}); err != nil {
+		log.Printf("Publish error, disconnecting %s locally: %v", username, err)
+		s.hub.Disconnect(username, websocket.ClosePolicyViolation, "Account is banned")
+	}
+}
+
+// unbanUserHandler lifts a ban.
+func (s *Server) unbanUserHandler(c *gin.Context) {
+	ctx := c.Request.Context()
+	target := c.Param("username")
+
+	err := s.store.SetBanned(ctx, target, false)
+	if errors.Is(err, store.ErrNotFound) {
+		c.Error(apperr.New(apperr.UserNotFound, "User not found"))
+		return
+	}
+	if err != nil {
+		c.Error(apperr.New(apperr.Internal, "Failed to unban user"))
+		return
+	}
+	s.audit(ctx, store.AuditEntry{Action: auditUserUnbanned, Target: target})
+
+	c.JSON(http.StatusOK, gin.H{"message": s.tr(c, "User unbanned successfully")})
+}
+
+// adminDeleteMessageHandler deletes any message for everyone.
+func (s *Server) adminDeleteMessageHandler(c *gin.Context) {
+	ctx := c.Request.Context()
+	messageID := c.Param("id")
+
+	_, _, err := s.store.Participants(ctx, messageID)
+	if errors.Is(err, store.ErrNotFound) {
+		c.Error(apperr.New(apperr.MessageNotFound, "Message not found"))
+		return
+	}
+	if err != nil {
+		c.Error(apperr.New(apperr.Internal, "Failed to fetch message"))
+		return
+	}
+
+	if err := s.store.DeleteForEveryone(ctx, messageID); err != nil {
+		c.Error(apperr.New(apperr.Internal, "Failed to delete message"))
+		return
+	}
+	s.broadcastMessageByID(ctx, messageID)
+	s.audit(ctx, store.AuditEntry{Action: auditAdminMessageDeleted, Target: messageID})
+
+	c.JSON(http.StatusOK, gin.H{"message": s.tr(c, "Message deleted successfully")})
+}
+
+// statsHandler reports aggregate counts, plus the WebSocket connections
+// held by this instance.
+func (s *Server) statsHandler(c *gin.Context) {
+	stats, err := s.store.Stats(c.Request.Context())
+	if err != nil {
+		c.Error(apperr.New(apperr.Internal, "Failed to fetch stats"))
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"stats": stats, "instance_connections": s.hub.Count()})
+}
+
+// announcementHandler broadcasts a system announcement to every connected client.
+func (s *Server) announcementHandler(c *gin.Context) {
+	var req struct {
+		Content string `json:"content"`
+	}
+
+	if err := c.ShouldBindJSON(&req); err != nil || strings.TrimSpace(req.Content) == "" {
+		c.Error(apperr.New(apperr.InvalidRequest, "Invalid request payload"))
+		return
+	}
+
+	event := &AnnouncementEvent{
+		Type:      ws.TypeAnnouncement,
+		Content:   req.Content,
+		Sender:    auth.CurrentUser(c),
+		CreatedAt: time.Now().UTC(),
+	}
+	if err := s.publishAdmin(c.Request.Context(), adminMessage{Announcement: event}); err != nil {
+		log.Printf("Publish error, announcing locally: %v", err)
+		s.hub.SendToAll(ws.Event{Type: ws.TypeAnnouncement, Payload: event})
+	}
+	s.audit(c.Request.Context(), store.AuditEntry{Action: auditAnnouncement, Details: map[string]string{"content": req.Content}})
+
+	c.JSON(http.StatusOK, gin.H{"announcement": event})
+}
@@ -0,0 +1,80 @@
+package api
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+
+	"backend/analytics"
+	"backend/apperr"
+	"backend/auth"
+	"backend/store"
+
+	"github.com/gin-gonic/gin"
+)
+
+// trackMessageSent records a message_sent analytics event for a message a
+// user sent. Only its shape is recorded, never its content or receiver.
+func (s *Server) trackMessageSent(msg store.Message) {
+	if msg.Kind != store.KindUser {
+		return
+	}
+	s.analytics.Track(analytics.MessageSent, msg.Sender, map[string]string{
+		"format":     msg.Format,
+		"reply":      strconv.FormatBool(msg.ReplyToID != nil),
+		"attachment": strconv.FormatBool(len(msg.Attachments) > 0),
+	})
+}
+
+// trackReactionAdded records a reaction_added analytics event for a vote of
+// voteType a user cast.
+func (s *Server) trackReactionAdded(voter, voteType string) {
+	s.analytics.Track(analytics.ReactionAdded, voter, map[string]string{"reaction": voteType})
+}
+
+// trackRoomJoined records a room_joined analytics event for a user who
+// subscribed to a channel.
+func (s *Server) trackRoomJoined(username, channelID string) {
+	s.analytics.Track(analytics.RoomJoined, username, map[string]string{"room": "channel", "room_id": channelID})
+}
+
+// analyticsSettingHandler returns whether the authenticated user takes part
+// in usage analytics.
+func (s *Server) analyticsSettingHandler(c *gin.Context) {
+	optOut, err := s.store.AnalyticsOptOut(c.Request.Context(), auth.CurrentUser(c))
+	if err != nil {
+		log.Printf("Error fetching analytics setting of %s: %v", auth.CurrentUser(c), err)
+		c.Error(apperr.New(apperr.Internal, "Failed to fetch analytics setting"))
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"enabled": !optOut})
+}
+
+// setAnalyticsSettingHandler opts the authenticated user in or out of usage
+// analytics. Events already sent are not recalled, but none are sent once
+// they opt out, including those still queued.
+func (s *Server) setAnalyticsSettingHandler(c *gin.Context) {
+	var req struct {
+		Enabled *bool `json:"enabled"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil || req.Enabled == nil {
+		c.Error(apperr.New(apperr.InvalidRequest, "Invalid request payload"))
+		return
+	}
+
+	username := auth.CurrentUser(c)
+	err := s.store.SetAnalyticsOptOut(c.Request.Context(), username, !*req.Enabled)
+	if errors.Is(err, store.ErrNotFound) {
+		c.Error(apperr.New(apperr.UserNotFound, "User not found"))
+		return
+	}
+	if err != nil {
+		log.Printf("Error saving analytics setting of %s: %v", username, err)
+		c.Error(apperr.New(apperr.Internal, "Failed to save analytics setting"))
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"enabled": *req.Enabled})
+}
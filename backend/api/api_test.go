@@ -0,0 +1,163 @@
+package api_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"sync"
+	"testing"
+
+	"backend/api"
+	"backend/auth"
+	"backend/push"
+	"backend/store"
+	"backend/store/memory"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/gin-gonic/gin"
+	"github.com/go-redis/redis/v8"
+)
+
+func TestMain(m *testing.M) {
+	gin.SetMode(gin.TestMode)
+	os.Exit(m.Run())
+}
+
+// testServer serves the API from the memory store and a Redis running in
+// the test, so handler tests need neither Postgres nor Redis.
+type testServer struct {
+	t       *testing.T
+	handler http.Handler
+	outbox  *outbox
+}
+
+// outbox records the emails the server sends.
+type outbox struct {
+	mu     sync.Mutex
+	bodies []string
+}
+
+func (o *outbox) Send(to, subject, body string) error {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.bodies = append(o.bodies, body)
+	return nil
+}
+
+// last returns the body of the last email sent.
+func (o *outbox) last() string {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if len(o.bodies) == 0 {
+		return ""
+	}
+	return o.bodies[len(o.bodies)-1]
+}
+
+// newTestServer returns a server on a fresh store and Redis. Options adjust
+// its configuration.
+func newTestServer(t *testing.T, options ...func(*api.Config)) *testServer {
+	t.Helper()
+	rdb := redis.NewClient(&redis.Options{Addr: miniredis.RunT(t).Addr()})
+	t.Cleanup(func() { rdb.Close() })
+
+	// Cheap hashing keeps signups and logins fast.
+	passwords, err := auth.NewHasher(store.PasswordArgon2id, auth.Argon2Params{Memory: 64, Iterations: 1, Parallelism: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	st := memory.New()
+	notifier, err := push.New(push.Config{}, st, rdb)
+	if err != nil {
+		t.Fatal(err)
+	}
+	mail := &outbox{}
+	cfg := api.Config{
+		Store:     st,
+		Redis:     rdb,
+		Tokens:    auth.NewTokens("test-secret"),
+		Notifier:  notifier,
+		Passwords: passwords,
+		Email:     mail,
+	}
+	for _, option := range options {
+		option(&cfg)
+	}
+	srv, err := api.New(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &testServer{t: t, handler: srv.Handler(), outbox: mail}
+}
+
+// response is a recorded response with its JSON body decoded.
+type response struct {
+	Code   int
+	Header http.Header
+	Body   map[string]interface{}
+}
+
+// request sends a request to /api/v1 with a JSON body, if not nil, and the
+// token as bearer token, if set. Extra headers are given as name, value
+// pairs.
+func (ts *testServer) request(method, path, token string, body interface{}, headers ...string) response {
+	ts.t.Helper()
+	return ts.requestFrom("", method, path, token, body, headers...)
+}
+
+// requestFrom is request sent from the peer at addr, a host and port, or
+// from httptest's default address if addr is empty.
+func (ts *testServer) requestFrom(addr, method, path, token string, body interface{}, headers ...string) response {
+	ts.t.Helper()
+	var buf bytes.Buffer
+	if body != nil {
+		if err := json.NewEncoder(&buf).Encode(body); err != nil {
+			ts.t.Fatal(err)
+		}
+	}
+	req := httptest.NewRequest(method, "/api/v1"+path, &buf)
+	req.Header.Set("Content-Type", "application/json")
+	if addr != "" {
+		req.RemoteAddr = addr
+	}
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	for i := 0; i+1 < len(headers); i += 2 {
+		req.Header.Set(headers[i], headers[i+1])
+	}
+
+	w := httptest.NewRecorder()
+	ts.handler.ServeHTTP(w, req)
+	res := response{Code: w.Code, Header: w.Header()}
+	if w.Body.Len() > 0 {
+		if err := json.Unmarshal(w.Body.Bytes(), &res.Body); err != nil {
+			ts.t.Fatalf("%s %s: decoding %q: %v", method, path, w.Body.String(), err)
+		}
+	}
+	return res
+}
+
+// signup signs a user up with password "password1" and returns their
+// access token.
+func (ts *testServer) signup(username string) string {
+	ts.t.Helper()
+	if res := ts.request("POST", "/signup", "", map[string]string{"username": username, "password": "password1"}); res.Code != http.StatusOK {
+		ts.t.Fatalf("signup %s: %d %v", username, res.Code, res.Body)
+	}
+	res := ts.request("POST", "/login", "", map[string]string{"username": username, "password": "password1"})
+	if res.Code != http.StatusOK {
+		ts.t.Fatalf("login %s: %d %v", username, res.Code, res.Body)
+	}
+	return res.Body["token"].(string)
+}
+
+// expectError fails the test unless res is an error with status and code.
+func expectError(t *testing.T, res response, status int, code string) {
+	t.Helper()
+	if res.Code != status || res.Body["code"] != code {
+		t.Fatalf("got %d %v, want %d %s", res.Code, res.Body, status, code)
+	}
+}
@@ -0,0 +1,458 @@
+package api
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"mime"
+	"net/http"
+	"os"
+	"path/filepath"
+	"time"
+
+	"backend/apperr"
+	"backend/auth"
+	"backend/blob"
+	"backend/markup"
+	"backend/media"
+	"backend/metrics"
+	"backend/store"
+
+	"github.com/gin-gonic/gin"
+)
+
+// DefaultMaxUploadBytes is the upload size limit used when none is configured.
+const DefaultMaxUploadBytes = 10 << 20
+
+// DefaultPresignExpiry is how long presigned upload and download URLs last
+// when not configured.
+const DefaultPresignExpiry = 15 * time.Minute
+
+// allowedAttachmentTypes lists the content types accepted for upload, keyed
+// by the sniffed type and mapped to the extension of their blob key.
+var allowedAttachmentTypes = map[string]string{
+	"image/jpeg":                ".jpg",
+	"image/png":                 ".png",
+	"image/gif":                 ".gif",
+	"image/webp":                ".webp",
+	"application/pdf":           ".pdf",
+	"text/plain; charset=utf-8": ".txt",
+}
+
+// attachmentType returns the allowed content type matching contentType,
+// ignoring parameters, so a client may declare text/plain for a text file.
+func attachmentType(contentType string) (string, bool) {
+	declared, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return "", false
+	}
+	for allowed := range allowedAttachmentTypes {
+		if t, _, _ := mime.ParseMediaType(allowed); t == declared {
+			return allowed, true
+		}
+	}
+	return "", false
+}
+
+// detectContentType detects the content type of a file from its first bytes
+// instead of trusting the client supplied header.
+func detectContentType(r io.Reader) (string, error) {
+	head := make([]byte, 512)
+	n, err := io.ReadFull(r, head)
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		return "", err
+	}
+	return http.DetectContentType(head[:n]), nil
+}
+
+// sniffContentType detects the content type of an uploaded file and rewinds
+// it.
+func sniffContentType(file io.ReadSeeker) (string, error) {
+	contentType, err := detectContentType(file)
+	if err != nil {
+		return "", err
+	}
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		return "", err
+	}
+	return contentType, nil
+}
+
+// newBlobKey returns a random blob key with the extension ext.
+func newBlobKey(ext string) (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b) + ext, nil
+}
+
+// uploadAttachmentHandler sends a message carrying an uploaded file. The
+// multipart form takes the file plus the receiver and an optional caption.
+func (s *Server) uploadAttachmentHandler(c *gin.Context) {
+	ctx := c.Request.Context()
+	sender := auth.CurrentUser(c)
+	receiver := c.PostForm("receiver")
+	caption := c.PostForm("content")
+
+	if receiver == "" {
+		c.Error(apperr.New(apperr.InvalidRequest, "Missing receiver"))
+		return
+	}
+
+	if s.rejectIfBlocked(c, sender, receiver) {
+		return
+	}
+
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, s.maxUploadBytes+1<<20)
+	header, err := c.FormFile("file")
+	if err != nil {
+		c.Error(apperr.New(apperr.InvalidRequest, "Missing or invalid file"))
+		return
+	}
+	if header.Size > s.maxUploadBytes {
+		c.Error(apperr.Newf(apperr.TooLarge, "File exceeds the %d byte limit", s.maxUploadBytes))
+		return
+	}
+	if err := s.messages.CheckQuota(ctx, sender, header.Size); err != nil {
+		c.Error(sendFailure(err))
+		return
+	}
+
+	file, err := header.Open()
+	if err != nil {
+		c.Error(apperr.New(apperr.InvalidRequest, "Failed to read file"))
+		return
+	}
+	defer file.Close()
+
+	contentType, err := sniffContentType(file)
+	if err != nil {
+		c.Error(apperr.New(apperr.InvalidRequest, "Failed to read file"))
+		return
+	}
+	ext, ok := allowedAttachmentTypes[contentType]
+	if !ok {
+		c.Error(apperr.Newf(apperr.UnsupportedMediaType, "File type %s is not allowed", contentType))
+		return
+	}
+
+	key, err := newBlobKey(ext)
+	if err != nil {
+		c.Error(apperr.New(apperr.Internal, "Failed to store file"))
+		return
+	}
+	if err := s.blobs.Put(ctx, key, file, header.Size, contentType); err != nil {
+		log.Printf("Error storing attachment: %v", err)
+		c.Error(apperr.New(apperr.Internal, "Failed to store file"))
+		return
+	}
+
+	s.sendAttachment(c, store.Message{Sender: sender, Receiver: receiver, Content: caption}, store.Attachment{
+		Filename:    filepath.Base(header.Filename),
+		ContentType: contentType,
+		Size:        header.Size,
+	}, key)
+}
+
+// sendAttachment sends msg carrying an attachment whose file is stored under
+// key, deleting the file if sending fails. A caption defaults to the file
+// name, and is validated like the content of other messages.
+func (s *Server) sendAttachment(c *gin.Context, msg store.Message, attachment store.Attachment, key string) {
+	ctx := c.Request.Context()
+	msg.Content = markup.Sanitize(msg.Content)
+	if msg.Content == "" {
+		msg.Content = attachment.Filename
+	}
+	if err := s.messages.ValidateContent(msg.Content); err != nil {
+		s.deleteBlob(key)
+		c.Error(sendFailure(err))
+		return
+	}
+	if media.Supported(attachment.ContentType) {
+		attachment.MediaStatus = store.MediaPending
+	}
+
+	if err := s.store.CreateAttachmentMessage(ctx, &msg, attachment, key); err != nil {
+		s.deleteBlob(key)
+		c.Error(apperr.New(apperr.Internal, "Failed to send message"))
+		return
+	}
+	if attachment.MediaStatus == store.MediaPending {
+		s.media.Wake()
+	}
+
+	metrics.MessagesSent.WithLabelValues("attachment").Inc()
+	s.publishSent(ctx, msg)
+
+	c.JSON(http.StatusCreated, gin.H{"message": msg})
+}
+
+// deleteBlob deletes a file no message refers to.
+func (s *Server) deleteBlob(key string) {
+	if err := s.blobs.Delete(context.Background(), key); err != nil {
+		log.Printf("Error deleting unsent file %s: %v", key, err)
+	}
+}
+
+// createUploadHandler starts a direct upload: the client uploads the file to
+// the returned URL with a PUT request, then sends it with
+// sendUploadHandler. It is only available when files are kept in an object
+// store.
+func (s *Server) createUploadHandler(c *gin.Context) {
+	ctx := c.Request.Context()
+	presigner, ok := s.blobs.(blob.Presigner)
+	if !ok {
+		c.Error(apperr.New(apperr.NotFound, "Direct uploads are not available"))
+		return
+	}
+
+	var req struct {
+		Filename    string `json:"filename"`
+		ContentType string `json:"content_type"`
+		Size        int64  `json:"size"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.Error(apperr.New(apperr.InvalidRequest, "Invalid request payload"))
+		return
+	}
+	filename := filepath.Base(req.Filename)
+	if req.Filename == "" || filename == "." || filename == "/" {
+		c.Error(apperr.New(apperr.InvalidRequest, "Missing filename"))
+		return
+	}
+	if req.Size <= 0 {
+		c.Error(apperr.New(apperr.InvalidRequest, "Invalid size"))
+		return
+	}
+	if req.Size > s.maxUploadBytes {
+		c.Error(apperr.Newf(apperr.TooLarge, "File exceeds the %d byte limit", s.maxUploadBytes))
+		return
+	}
+	contentType, ok := attachmentType(req.ContentType)
+	if !ok {
+		c.Error(apperr.Newf(apperr.UnsupportedMediaType, "File type %s is not allowed", req.ContentType))
+		return
+	}
+	sender := auth.CurrentUser(c)
+	if err := s.messages.CheckQuota(ctx, sender, req.Size); err != nil {
+		c.Error(sendFailure(err))
+		return
+	}
+
+	key, err := newBlobKey(allowedAttachmentTypes[contentType])
+	if err != nil {
+		c.Error(apperr.New(apperr.Internal, "Failed to create upload"))
+		return
+	}
+	upload := store.Upload{
+		ID:          key,
+		Uploader:    sender,
+		Filename:    filename,
+		ContentType: contentType,
+		Size:        req.Size,
+		ExpiresAt:   time.Now().Add(s.presignExpiry).UTC(),
+	}
+	uploadURL, err := presigner.PresignPut(key, contentType, s.presignExpiry)
+	if err != nil {
+		log.Printf("Error presigning upload: %v", err)
+		c.Error(apperr.New(apperr.Internal, "Failed to create upload"))
+		return
+	}
+	if err := s.store.CreateUpload(ctx, upload); err != nil {
+		c.Error(apperr.New(apperr.Internal, "Failed to create upload"))
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"upload":     upload,
+		"upload_url": uploadURL,
+		"method":     http.MethodPut,
+		"headers":    map[string]string{"Content-Type": contentType},
+	})
+}
+
+// sendUploadHandler sends a message carrying a file the client uploaded
+// directly. The file is checked like one uploaded through the API: its size
+// must match the one declared and its content its type.
+func (s *Server) sendUploadHandler(c *gin.Context) {
+	ctx := c.Request.Context()
+	sender := auth.CurrentUser(c)
+
+	var req struct {
+		Receiver string `json:"receiver"`
+		Content  string `json:"content"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.Error(apperr.New(apperr.InvalidRequest, "Invalid request payload"))
+		return
+	}
+	if req.Receiver == "" {
+		c.Error(apperr.New(apperr.InvalidRequest, "Missing receiver"))
+		return
+	}
+	if s.rejectIfBlocked(c, sender, req.Receiver) {
+		return
+	}
+
+	upload, err := s.store.TakeUpload(ctx, c.Param("id"), sender)
+	if errors.Is(err, store.ErrNotFound) {
+		c.Error(apperr.New(apperr.NotFound, "Upload not found or expired"))
+		return
+	}
+	if err != nil {
+		c.Error(apperr.New(apperr.Internal, "Failed to fetch upload"))
+		return
+	}
+
+	size, err := s.blobs.Size(ctx, upload.ID)
+	if err != nil {
+		// Put the upload back so the client can send it once uploaded.
+		if restoreErr := s.store.CreateUpload(ctx, upload); restoreErr != nil {
+			log.Printf("Error restoring upload %s: %v", upload.ID, restoreErr)
+		}
+		if errors.Is(err, blob.ErrNotFound) {
+			c.Error(apperr.New(apperr.InvalidRequest, "File has not been uploaded"))
+			return
+		}
+		log.Printf("Error checking upload %s: %v", upload.ID, err)
+		c.Error(apperr.New(apperr.Internal, "Failed to fetch upload"))
+		return
+	}
+	if err := s.checkUpload(ctx, upload, size); err != nil {
+		s.deleteBlob(upload.ID)
+		c.Error(err)
+		return
+	}
+
+	s.sendAttachment(c, store.Message{Sender: sender, Receiver: req.Receiver, Content: req.Content}, store.Attachment{
+		Filename:    upload.Filename,
+		ContentType: upload.ContentType,
+		Size:        size,
+	}, upload.ID)
+}
+
+// checkUpload returns the error to respond with if a directly uploaded file
+// of size bytes is not what was declared or may not be sent.
+func (s *Server) checkUpload(ctx context.Context, upload store.Upload, size int64) error {
+	if size != upload.Size {
+		return apperr.Newf(apperr.InvalidRequest, "Uploaded %d bytes instead of %d", size, upload.Size)
+	}
+
+	file, err := s.blobs.Get(ctx, upload.ID)
+	if err != nil {
+		log.Printf("Error reading upload %s: %v", upload.ID, err)
+		return apperr.New(apperr.Internal, "Failed to read file")
+	}
+	contentType, err := detectContentType(file)
+	file.Close()
+	if err != nil {
+		log.Printf("Error reading upload %s: %v", upload.ID, err)
+		return apperr.New(apperr.Internal, "Failed to read file")
+	}
+	if contentType != upload.ContentType {
+		return apperr.Newf(apperr.UnsupportedMediaType, "File type %s does not match %s", contentType, upload.ContentType)
+	}
+
+	if err := s.messages.CheckQuota(ctx, upload.Uploader, size); err != nil {
+		return sendFailure(err)
+	}
+	return nil
+}
+
+// downloadAttachmentHandler serves an attachment to the participants of the
+// conversation it was sent in.
+func (s *Server) downloadAttachmentHandler(c *gin.Context) {
+	a, key, err := s.store.AttachmentFile(c.Request.Context(), c.Param("id"), auth.CurrentUser(c))
+	if errors.Is(err, store.ErrNotFound) {
+		c.Error(apperr.New(apperr.NotFound, "Attachment not found"))
+		return
+	}
+	if err != nil {
+		log.Printf("Error fetching attachment: %v", err)
+		c.Error(apperr.New(apperr.Internal, "Failed to fetch attachment"))
+		return
+	}
+
+	s.serveBlob(c, key, a.ContentType, a.Filename)
+}
+
+// downloadThumbnailHandler serves the thumbnail of an image attachment to the
+// participants of the conversation it was sent in, once it was rendered.
+func (s *Server) downloadThumbnailHandler(c *gin.Context) {
+	v, err := s.store.AttachmentVariant(c.Request.Context(), c.Param("id"), store.VariantThumbnail, auth.CurrentUser(c))
+	if errors.Is(err, store.ErrNotFound) {
+		c.Error(apperr.New(apperr.NotFound, "Thumbnail not found"))
+		return
+	}
+	if err != nil {
+		log.Printf("Error fetching thumbnail: %v", err)
+		c.Error(apperr.New(apperr.Internal, "Failed to fetch thumbnail"))
+		return
+	}
+
+	s.serveBlob(c, v.Key, v.ContentType, "")
+}
+
+// serveBlob serves the file stored under key, shown inline as filename
+// unless it is empty. Files in an object store are downloaded from it
+// directly: the response redirects to a presigned URL, or with
+// ?redirect=false returns it as JSON.
+func (s *Server) serveBlob(c *gin.Context, key, contentType, filename string) {
+	if presigner, ok := s.blobs.(blob.Presigner); ok {
+		url, err := presigner.PresignGet(key, contentType, filename, s.presignExpiry)
+		if err != nil {
+			log.Printf("Error presigning download: %v", err)
+			c.Error(apperr.New(apperr.Internal, "Failed to fetch file"))
+			return
+		}
+		if c.Query("redirect") == "false" {
+			c.JSON(http.StatusOK, gin.H{"url": url, "expires_at": time.Now().Add(s.presignExpiry).UTC()})
+			return
+		}
+		c.Redirect(http.StatusFound, url)
+		return
+	}
+
+	file, err := s.blobs.Get(c.Request.Context(), key)
+	if errors.Is(err, blob.ErrNotFound) {
+		c.Error(apperr.New(apperr.NotFound, "File not found"))
+		return
+	}
+	if err != nil {
+		log.Printf("Error opening file %s: %v", key, err)
+		c.Error(apperr.New(apperr.Internal, "Failed to fetch file"))
+		return
+	}
+	defer file.Close()
+
+	c.Header("Content-Type", contentType)
+	if filename != "" {
+		c.Header("Content-Disposition", fmt.Sprintf("inline; filename=%q", filename))
+	}
+	c.Header("X-Content-Type-Options", "nosniff")
+
+	// Local files support range requests; others are streamed.
+	if f, ok := file.(*os.File); ok {
+		var modified time.Time
+		if info, err := f.Stat(); err == nil {
+			modified = info.ModTime()
+		}
+		http.ServeContent(c.Writer, c.Request, filename, modified, f)
+		return
+	}
+	c.Status(http.StatusOK)
+	if _, err := io.Copy(c.Writer, file); err != nil {
+		log.Printf("Error serving file %s: %v", key, err)
+	}
+}
+
+// RunMedia renders thumbnails of uploaded images until ctx is done, sending
+// each message again once its image was processed.
+func (s *Server) RunMedia(ctx context.Context) {
+	s.media.Run(ctx)
+}
@@ -0,0 +1,176 @@
+package api
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"backend/apperr"
+	"backend/store"
+
+	"github.com/gin-gonic/gin"
+	"google.golang.org/grpc/metadata"
+)
+
+// Audited actions. Actions taken through the admin and provisioning APIs
+// are prefixed with admin. and provisioning..
+const (
+	auditLogin           = "login"
+	auditLoginFailed     = "login.failed"
+	auditPasswordChanged = "password.changed"
+	auditPasswordReset   = "password.reset"
+	auditEmailVerified   = "email.verified"
+	auditSessionRevoked  = "session.revoked"
+	auditUsernameChanged = "username.changed"
+	auditAccountDeleted  = "account.deleted"
+	auditMessageDeleted  = "message.deleted"
+	auditAccessBlocked   = "access.blocked"
+
+	auditChannelUpdated       = "channel.updated"
+	auditChannelRoleChanged   = "channel.role_changed"
+	auditChannelMemberRemoved = "channel.member_removed"
+	auditChannelPostDeleted   = "channel.post_deleted"
+	auditChannelInviteCreated = "channel.invite_created"
+	auditChannelInviteRevoked = "channel.invite_revoked"
+
+	auditUserBanned           = "admin.user.banned"
+	auditUserUnbanned         = "admin.user.unbanned"
+	auditAccountUnlocked      = "admin.lockout.account_cleared"
+	auditIPUnlocked           = "admin.lockout.ip_cleared"
+	auditAdminMessageDeleted  = "admin.message.deleted"
+	auditAnnouncement         = "admin.announcement.sent"
+	auditAPIKeyCreated        = "admin.api_key.created"
+	auditAPIKeyRevoked        = "admin.api_key.revoked"
+	auditWebhookCreated       = "admin.webhook.created"
+	auditWebhookDeleted       = "admin.webhook.deleted"
+	auditBotCreated           = "admin.bot.created"
+	auditBotTokenRotated      = "admin.bot.token_rotated"
+	auditBotDeleted           = "admin.bot.deleted"
+	auditHookCreated          = "admin.hook.created"
+	auditHookDeleted          = "admin.hook.deleted"
+	auditChannelCreated       = "admin.channel.created"
+	auditChannelDeleted       = "admin.channel.deleted"
+	auditChannelSenderAdded   = "admin.channel.sender_added"
+	auditChannelSenderRemoved = "admin.channel.sender_removed"
+	auditUserShadowMuted      = "admin.user.shadow_muted"
+	auditUserShadowUnmuted    = "admin.user.shadow_unmuted"
+
+	auditUserProvisioned   = "provisioning.user.created"
+	auditUserUpdated       = "provisioning.user.updated"
+	auditUserDeprovisioned = "provisioning.user.deleted"
+)
+
+// defaultAuditLimit and maxAuditLimit bound how many entries the audit log
+// endpoint returns at once.
+const (
+	defaultAuditLimit = 100
+	maxAuditLimit     = 1000
+)
+
+// auditOriginKey is the context key of the auditOrigin of an HTTP request.
+type auditOriginKey struct{}
+
+// auditOrigin is who sent an HTTP request and from where. Actor is filled
+// in once the request is authenticated.
+type auditOrigin struct {
+	Actor     string
+	IP        string
+	UserAgent string
+}
+
+// auditMiddleware records the client address and user agent of every
+// request in its context for audit entries.
+func auditMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		o := &auditOrigin{IP: c.ClientIP(), UserAgent: c.Request.UserAgent()}
+		c.Request = c.Request.WithContext(context.WithValue(c.Request.Context(), auditOriginKey{}, o))
+		c.Next()
+	}
+}
+
+// setAuditActor records who a request was authenticated as.
+func setAuditActor(ctx context.Context, actor string) {
+	if o, ok := ctx.Value(auditOriginKey{}).(*auditOrigin); ok {
+		o.Actor = actor
+	}
+}
+
+// audit appends e to the audit log. The actor, unless e names one, and the
+// client's address and user agent are taken from ctx, which belongs to an
+// HTTP request or a gRPC call. Failures are logged; they never fail the
+// audited action.
+func (s *Server) audit(ctx context.Context, e store.AuditEntry) {
+	if o, ok := ctx.Value(auditOriginKey{}).(*auditOrigin); ok {
+		e.IP, e.UserAgent = o.IP, o.UserAgent
+		if e.Actor == "" {
+			e.Actor = o.Actor
+		}
+	} else {
+		e.IP = peerIP(ctx)
+		if md, ok := metadata.FromIncomingContext(ctx); ok {
+			if ua := md.Get("user-agent"); len(ua) > 0 {
+				e.UserAgent = ua[0]
+			}
+		}
+		if e.Actor == "" {
+			e.Actor = contextUser(ctx)
+		}
+	}
+
+	// Record the entry even if the request was canceled meanwhile.
+	if err := s.store.RecordAudit(context.WithoutCancel(ctx), &e); err != nil {
+		log.Printf("Error recording %s audit entry of %s: %v", e.Action, e.Actor, err)
+	}
+}
+
+// auditLogHandler returns audit log entries, newest first, filtered by
+// ?actor=, ?action=, ?target= and the RFC3339 times ?since= and ?until=.
+// ?before=<id> pages back from an entry.
+func (s *Server) auditLogHandler(c *gin.Context) {
+	f := store.AuditFilter{
+		Actor:  c.Query("actor"),
+		Action: c.Query("action"),
+		Target: c.Query("target"),
+		Limit:  defaultAuditLimit,
+	}
+
+	for _, t := range []struct {
+		param string
+		dest  *time.Time
+	}{{"since", &f.Since}, {"until", &f.Until}} {
+		if v := c.Query(t.param); v != "" {
+			parsed, err := time.Parse(time.RFC3339, v)
+			if err != nil {
+				c.Error(apperr.Newf(apperr.InvalidRequest, "Invalid %s, expected an RFC3339 timestamp", t.param))
+				return
+			}
+			*t.dest = parsed
+		}
+	}
+	if v := c.Query("before"); v != "" {
+		id, err := strconv.ParseInt(v, 10, 64)
+		if err != nil || id <= 0 {
+			c.Error(apperr.New(apperr.InvalidRequest, "Invalid before"))
+			return
+		}
+		f.BeforeID = id
+	}
+	if v := c.Query("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 || n > maxAuditLimit {
+			c.Error(apperr.New(apperr.InvalidRequest, "Invalid limit, expected 1 to 1000"))
+			return
+		}
+		f.Limit = n
+	}
+
+	entries, err := s.store.AuditLog(c.Request.Context(), f)
+	if err != nil {
+		c.Error(apperr.New(apperr.Internal, "Failed to fetch audit log"))
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"entries": entries})
+}
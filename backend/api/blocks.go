@@ -0,0 +1,70 @@
+package api
+
+import (
+	"net/http"
+
+	"backend/apperr"
+	"backend/auth"
+
+	"github.com/gin-gonic/gin"
+)
+
+// blockUserHandler blocks the user in the path for the authenticated user.
+func (s *Server) blockUserHandler(c *gin.Context) {
+	ctx := c.Request.Context()
+	username := auth.CurrentUser(c)
+	target := c.Param("username")
+
+	if target == username {
+		c.Error(apperr.New(apperr.InvalidRequest, "You cannot block yourself"))
+		return
+	}
+
+	exists, err := s.store.UserExists(ctx, target)
+	if err != nil {
+		c.Error(apperr.New(apperr.Internal, "Failed to fetch user"))
+		return
+	}
+	if !exists {
+		c.Error(apperr.New(apperr.UserNotFound, "User not found"))
+		return
+	}
+
+	if err := s.store.Block(ctx, username, target); err != nil {
+		c.Error(apperr.New(apperr.Internal, "Failed to block user"))
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": s.tr(c, "User blocked successfully")})
+}
+
+// unblockUserHandler removes a block placed by the authenticated user.
+func (s *Server) unblockUserHandler(c *gin.Context) {
+	removed, err := s.store.Unblock(c.Request.Context(), auth.CurrentUser(c), c.Param("username"))
+	if err != nil {
+		c.Error(apperr.New(apperr.Internal, "Failed to unblock user"))
+		return
+	}
+	if !removed {
+		c.Error(apperr.New(apperr.NotFound, "User is not blocked"))
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": s.tr(c, "User unblocked successfully")})
+}
+
+// rejectIfBlocked responds with 403 and returns true if sender and receiver
+// have blocked each other. Messages are not delivered in either direction
+// once a block is in place.
+func (s *Server) rejectIfBlocked(c *gin.Context, sender, receiver string) bool {
+	blocked, err := s.store.IsBlocked(c.Request.Context(), sender, receiver)
+	if err != nil {
+		c.Error(apperr.New(apperr.Internal, "Failed to check block status"))
+		return true
+	}
+	if blocked {
+		c.Error(apperr.New(apperr.Blocked, "You cannot message this user"))
+		return true
+	}
+	return false
+}
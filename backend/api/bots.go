@@ -0,0 +1,272 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+
+	"backend/apperr"
+	"backend/auth"
+	"backend/service"
+	"backend/store"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/websocket"
+)
+
+// botTokenPrefix starts every bot token, so they are never mistaken for
+// access tokens.
+const botTokenPrefix = "bot_"
+
+// maxCommandDescription is the longest description a slash command may have.
+const maxCommandDescription = 200
+
+// BotCreated is the response to creating a bot or rotating its token, the
+// only time the token is shown.
+type BotCreated struct {
+	Bot   store.Bot `json:"bot"`
+	Token string    `json:"token"`
+}
+
+// parseToken returns the claims of an access token or, given a bot token,
+// claims naming its bot. Bot tokens do not expire; they are valid until
+// rotated.
+func (s *Server) parseToken(ctx context.Context, token string) (*auth.Claims, *apperr.Error) {
+	if !strings.HasPrefix(token, botTokenPrefix) {
+		claims, err := s.tokens.Parse(token)
+		if err != nil {
+			return nil, apperr.New(apperr.Unauthenticated, "Invalid or expired token")
+		}
+		return claims, nil
+	}
+
+	bot, err := s.store.BotByToken(ctx, auth.HashToken(token))
+	if errors.Is(err, store.ErrNotFound) {
+		return nil, apperr.New(apperr.Unauthenticated, "Invalid or rotated bot token")
+	}
+	if err != nil {
+		return nil, apperr.New(apperr.Internal, "Failed to check bot token")
+	}
+	return &auth.Claims{Username: bot}, nil
+}
+
+// requireToken rejects requests without a valid access or bot token and
+// stores the authenticated username in the Gin context. Requests
+// authenticateUserKey authenticated already pass through.
+func (s *Server) requireToken() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if _, ok := c.Get(contextKeyScopeKey); ok {
+			c.Next()
+			return
+		}
+
+		token := auth.TokenFromRequest(c)
+		if token == "" {
+			apperr.Abort(c, apperr.New(apperr.Unauthenticated, "Missing authentication token"))
+			return
+		}
+
+		claims, e := s.parseToken(c.Request.Context(), token)
+		if e != nil {
+			apperr.Abort(c, e)
+			return
+		}
+
+		auth.SetCurrentUser(c, claims.Username)
+		setAuditActor(c.Request.Context(), claims.Username)
+		c.Next()
+	}
+}
+
+// requireBot rejects requests from users who are not bots. It must run
+// after requireActive.
+func (s *Server) requireBot() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if c.GetString(contextRoleKey) != store.RoleBot {
+			apperr.Abort(c, apperr.New(apperr.BotRequired, "Bot access required"))
+			return
+		}
+		c.Next()
+	}
+}
+
+// newBotToken generates a bot token and the hash stored for it.
+func newBotToken() (string, string, error) {
+	secret, err := auth.NewOpaqueToken()
+	if err != nil {
+		return "", "", err
+	}
+	token := botTokenPrefix + secret
+	return token, auth.HashToken(token), nil
+}
+
+// createBotHandler creates a bot account and its token.
+func (s *Server) createBotHandler(c *gin.Context) {
+	var req struct {
+		Username string `json:"username"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil || req.Username == "" {
+		c.Error(apperr.New(apperr.InvalidRequest, "Invalid request payload"))
+		return
+	}
+	if e := s.checkUsername(req.Username); e != nil {
+		c.Error(e)
+		return
+	}
+
+	// Bots cannot log in with a password, so theirs is never shown.
+	password, err := auth.NewOpaqueToken()
+	if err != nil {
+		c.Error(apperr.New(apperr.Internal, "Failed to generate password"))
+		return
+	}
+	hashedPassword, err := s.passwords.Hash(password)
+	if err != nil {
+		c.Error(apperr.New(apperr.Internal, "Failed to hash password"))
+		return
+	}
+	token, tokenHash, err := newBotToken()
+	if err != nil {
+		c.Error(apperr.New(apperr.Internal, "Failed to generate bot token"))
+		return
+	}
+
+	bot := store.Bot{Username: req.Username, CreatedBy: auth.CurrentUser(c)}
+	err = s.store.CreateBot(c.Request.Context(), &bot, hashedPassword, tokenHash)
+	if errors.Is(err, store.ErrUsernameTaken) {
+		c.Error(apperr.New(apperr.UsernameTaken, "Username already taken"))
+		return
+	}
+	if err != nil {
+		c.Error(apperr.New(apperr.Internal, "Failed to create bot"))
+		return
+	}
+	s.audit(c.Request.Context(), store.AuditEntry{Action: auditBotCreated, Target: bot.Username})
+
+	c.JSON(http.StatusCreated, BotCreated{Bot: bot, Token: token})
+}
+
+// botsHandler lists the bots.
+func (s *Server) botsHandler(c *gin.Context) {
+	bots, err := s.store.Bots(c.Request.Context())
+	if err != nil {
+		c.Error(apperr.New(apperr.Internal, "Failed to fetch bots"))
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"bots": bots})
+}
+
+// rotateBotTokenHandler replaces a bot's token, disconnecting the bot's
+// WebSocket clients on every instance.
+func (s *Server) rotateBotTokenHandler(c *gin.Context) {
+	ctx := c.Request.Context()
+	username := c.Param("username")
+
+	token, tokenHash, err := newBotToken()
+	if err != nil {
+		c.Error(apperr.New(apperr.Internal, "Failed to generate bot token"))
+		return
+	}
+	err = s.store.SetBotToken(ctx, username, tokenHash)
+	if errors.Is(err, store.ErrNotFound) {
+		c.Error(apperr.New(apperr.NotFound, "Bot not found"))
+		return
+	}
+	if err != nil {
+		c.Error(apperr.New(apperr.Internal, "Failed to rotate bot token"))
+		return
+	}
+
+	if err := s.publishAdmin(ctx, adminMessage{TokenRotated: username}); err != nil {
+		log.Printf("Publish error, disconnecting %s locally: %v", username, err)
+		s.hub.Disconnect(username, websocket.ClosePolicyViolation, "Bot token rotated")
+	}
+	s.audit(ctx, store.AuditEntry{Action: auditBotTokenRotated, Target: username})
+
+	c.JSON(http.StatusOK, BotCreated{Bot: store.Bot{Username: username}, Token: token})
+}
+
+// deleteBotHandler deletes a bot account the way the provisioning API
+// deletes users. Its token, commands and webhooks go when it is erased.
+func (s *Server) deleteBotHandler(c *gin.Context) {
+	ctx := c.Request.Context()
+	username := c.Param("username")
+
+	role, _, err := s.store.Role(ctx, username)
+	if errors.Is(err, store.ErrNotFound) || (err == nil && role != store.RoleBot) {
+		c.Error(apperr.New(apperr.NotFound, "Bot not found"))
+		return
+	}
+	if err != nil {
+		c.Error(apperr.New(apperr.Internal, "Failed to fetch bot"))
+		return
+	}
+
+	if e := s.deprovisionUser(ctx, username); e != nil {
+		c.Error(e)
+		return
+	}
+	s.audit(ctx, store.AuditEntry{Action: auditBotDeleted, Target: username})
+
+	c.JSON(http.StatusOK, gin.H{"message": s.tr(c, "Bot deleted successfully")})
+}
+
+// commandsHandler lists the slash commands users can invoke.
+func (s *Server) commandsHandler(c *gin.Context) {
+	commands, err := s.store.Commands(c.Request.Context())
+	if err != nil {
+		c.Error(apperr.New(apperr.Internal, "Failed to fetch commands"))
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"commands": commands})
+}
+
+// registerCommandHandler registers a slash command for the calling bot, or
+// updates the description of one it registered.
+func (s *Server) registerCommandHandler(c *gin.Context) {
+	name := c.Param("name")
+	if !service.CommandName.MatchString(name) {
+		c.Error(apperr.New(apperr.InvalidRequest, "Invalid command name, expected 1 to 32 lowercase letters, digits, - or _"))
+		return
+	}
+
+	var req struct {
+		Description string `json:"description"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil || len(req.Description) > maxCommandDescription {
+		c.Error(apperr.New(apperr.InvalidRequest, "Invalid description, expected at most 200 characters"))
+		return
+	}
+
+	cmd := store.Command{Name: name, Bot: auth.CurrentUser(c), Description: req.Description}
+	err := s.store.RegisterCommand(c.Request.Context(), &cmd)
+	if errors.Is(err, store.ErrCommandTaken) {
+		c.Error(apperr.New(apperr.CommandTaken, "Command already registered by another bot"))
+		return
+	}
+	if err != nil {
+		c.Error(apperr.New(apperr.Internal, "Failed to register command"))
+		return
+	}
+
+	c.JSON(http.StatusOK, cmd)
+}
+
+// deleteCommandHandler deletes a slash command the calling bot registered.
+func (s *Server) deleteCommandHandler(c *gin.Context) {
+	err := s.store.DeleteCommand(c.Request.Context(), auth.CurrentUser(c), c.Param("name"))
+	if errors.Is(err, store.ErrNotFound) {
+		c.Error(apperr.New(apperr.NotFound, "Command not found"))
+		return
+	}
+	if err != nil {
+		c.Error(apperr.New(apperr.Internal, "Failed to delete command"))
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": s.tr(c, "Command deleted successfully")})
+}
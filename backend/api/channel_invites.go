@@ -0,0 +1,136 @@
+package api
+
+import (
+	"net/http"
+	"time"
+
+	"backend/apperr"
+	"backend/auth"
+	"backend/store"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	// maxInviteLifetime is the longest an invite can be valid for.
+	maxInviteLifetime = 30 * 24 * time.Hour
+	maxInviteUses     = 10000
+)
+
+// ChannelInviteCreated is the response to creating a channel invite, the
+// only time its token is shown.
+type ChannelInviteCreated struct {
+	Invite store.ChannelInvite `json:"invite"`
+	Token  string              `json:"token"`
+	// URL is the link to share, which opens the invite in the frontend.
+	URL string `json:"url"`
+}
+
+// createChannelInviteHandler creates an invite to a channel that expires
+// after expires_in_seconds and lets max_uses users join, each unlimited
+// when 0 or left out.
+func (s *Server) createChannelInviteHandler(c *gin.Context) {
+	ctx := c.Request.Context()
+	id, ok := channelID(c)
+	if !ok {
+		return
+	}
+
+	var req struct {
+		ExpiresInSeconds int `json:"expires_in_seconds"`
+		MaxUses          int `json:"max_uses"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.Error(apperr.New(apperr.InvalidRequest, "Invalid request payload"))
+		return
+	}
+	expiresIn := time.Duration(req.ExpiresInSeconds) * time.Second
+	if req.ExpiresInSeconds < 0 || expiresIn > maxInviteLifetime {
+		c.Error(apperr.New(apperr.InvalidRequest, "Invalid expires_in_seconds, expected 0 to 2592000"))
+		return
+	}
+	if req.MaxUses < 0 || req.MaxUses > maxInviteUses {
+		c.Error(apperr.New(apperr.InvalidRequest, "Invalid max_uses, expected 0 to 10000"))
+		return
+	}
+
+	token, err := auth.NewOpaqueToken()
+	if err != nil {
+		c.Error(apperr.New(apperr.Internal, "Failed to generate invite token"))
+		return
+	}
+
+	invite := store.ChannelInvite{ChannelID: id, MaxUses: req.MaxUses}
+	if expiresIn > 0 {
+		expiresAt := time.Now().UTC().Add(expiresIn)
+		invite.ExpiresAt = &expiresAt
+	}
+	if err := s.channels.CreateInvite(ctx, auth.CurrentUser(c), &invite, auth.HashToken(token)); err != nil {
+		c.Error(channelFailure(err, "Channel not found", "Failed to create invite"))
+		return
+	}
+	s.audit(ctx, store.AuditEntry{Action: auditChannelInviteCreated, Target: invite.ID, Details: map[string]string{"channel": id}})
+
+	c.JSON(http.StatusCreated, ChannelInviteCreated{Invite: invite, Token: token, URL: s.appURL + "/invite/" + token})
+}
+
+// channelInvitesHandler lists the invites of a channel.
+func (s *Server) channelInvitesHandler(c *gin.Context) {
+	id, ok := channelID(c)
+	if !ok {
+		return
+	}
+
+	invites, err := s.channels.Invites(c.Request.Context(), id, auth.CurrentUser(c))
+	if err != nil {
+		c.Error(channelFailure(err, "Channel not found", "Failed to fetch invites"))
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"invites": invites})
+}
+
+// revokeChannelInviteHandler deletes an invite so nobody else can join with
+// it.
+func (s *Server) revokeChannelInviteHandler(c *gin.Context) {
+	ctx := c.Request.Context()
+	id, ok := channelID(c)
+	if !ok {
+		return
+	}
+	inviteID := c.Param("invite")
+
+	if err := s.channels.RevokeInvite(ctx, id, auth.CurrentUser(c), inviteID); err != nil {
+		c.Error(channelFailure(err, "Invite not found", "Failed to revoke invite"))
+		return
+	}
+	s.audit(ctx, store.AuditEntry{Action: auditChannelInviteRevoked, Target: inviteID, Details: map[string]string{"channel": id}})
+
+	c.JSON(http.StatusOK, gin.H{"message": s.tr(c, "Invite revoked successfully")})
+}
+
+// acceptInviteHandler makes the authenticated user a member of the channel
+// of the invite in the path, announces them with a system post and returns
+// the channel. Members accepting an invite get the channel and use none of
+// it.
+func (s *Server) acceptInviteHandler(c *gin.Context) {
+	ctx := c.Request.Context()
+	username := auth.CurrentUser(c)
+
+	invite, joined, err := s.channels.AcceptInvite(ctx, auth.HashToken(c.Param("token")), username)
+	if err != nil {
+		c.Error(channelFailure(err, "Invite not found", "Failed to accept invite"))
+		return
+	}
+	if joined {
+		s.trackRoomJoined(username, invite.ChannelID)
+		s.postChannelSystemPost(ctx, invite.ChannelID, username, store.SystemEvent{Event: store.SystemMemberJoined})
+	}
+
+	ch, err := s.store.Channel(ctx, invite.ChannelID, username)
+	if err != nil {
+		c.Error(apperr.New(apperr.Internal, "Failed to fetch channel"))
+		return
+	}
+	c.JSON(http.StatusOK, ch)
+}
@@ -0,0 +1,150 @@
+package api
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"unicode/utf8"
+
+	"backend/apperr"
+	"backend/auth"
+	"backend/service"
+	"backend/store"
+
+	"github.com/gin-gonic/gin"
+)
+
+// channelFailure maps an error of the channel service to the error reported
+// to the client: notFound if the channel or what the request names does not
+// exist, failed if the error is unexpected.
+func channelFailure(err error, notFound, failed string) *apperr.Error {
+	switch {
+	case errors.Is(err, store.ErrNotFound):
+		return apperr.New(apperr.NotFound, notFound)
+	case errors.Is(err, service.ErrChannelRoleRequired):
+		return apperr.New(apperr.ChannelRoleRequired, "Your role in this channel does not allow this")
+	case errors.Is(err, service.ErrNotChannelMember):
+		return apperr.New(apperr.NotFound, "User is not a member of this channel")
+	case errors.Is(err, service.ErrInvalidChannelRole):
+		return apperr.New(apperr.InvalidRequest, "Role must be owner, admin or member")
+	case errors.Is(err, service.ErrLastChannelOwner):
+		return apperr.New(apperr.LastChannelOwner, "The channel needs another owner first")
+	case errors.Is(err, store.ErrChannelTaken):
+		return apperr.New(apperr.ChannelTaken, "Channel name already taken")
+	case errors.Is(err, service.ErrInviteExpired):
+		return apperr.New(apperr.InviteExpired, "This invite expired")
+	}
+	log.Printf("Channel error: %v", err)
+	return apperr.New(apperr.Internal, failed)
+}
+
+// validateChannelSettings checks the settings update sets.
+func validateChannelSettings(update store.ChannelUpdate) *apperr.Error {
+	if update.Name != nil && (*update.Name == "" || utf8.RuneCountInString(*update.Name) > maxChannelNameLength) {
+		return apperr.New(apperr.InvalidRequest, "Invalid name, expected 1 to 64 characters")
+	}
+	if update.Description != nil && utf8.RuneCountInString(*update.Description) > maxChannelDescriptionLength {
+		return apperr.New(apperr.InvalidRequest, "Description is longer than 500 characters")
+	}
+	if update.Topic != nil && utf8.RuneCountInString(*update.Topic) > maxChannelTopicLength {
+		return apperr.New(apperr.InvalidRequest, "Topic is longer than 250 characters")
+	}
+	if update.Visibility != nil && !validChannelVisibility(*update.Visibility) {
+		return apperr.New(apperr.InvalidRequest, "Visibility must be public or private")
+	}
+	return nil
+}
+
+// updateChannelHandler changes the name, description, topic or visibility
+// of a channel.
+func (s *Server) updateChannelHandler(c *gin.Context) {
+	ctx := c.Request.Context()
+	id, ok := channelID(c)
+	if !ok {
+		return
+	}
+
+	var update store.ChannelUpdate
+	if err := c.ShouldBindJSON(&update); err != nil {
+		c.Error(apperr.New(apperr.InvalidRequest, "Invalid request payload"))
+		return
+	}
+	if err := validateChannelSettings(update); err != nil {
+		c.Error(err)
+		return
+	}
+
+	if err := s.channels.Update(ctx, id, auth.CurrentUser(c), update); err != nil {
+		c.Error(channelFailure(err, "Channel not found", "Failed to update channel"))
+		return
+	}
+	s.audit(ctx, store.AuditEntry{Action: auditChannelUpdated, Target: id})
+
+	ch, err := s.store.Channel(ctx, id, auth.CurrentUser(c))
+	if err != nil {
+		c.Error(apperr.New(apperr.Internal, "Failed to fetch channel"))
+		return
+	}
+	c.JSON(http.StatusOK, ch)
+}
+
+// channelMembersHandler lists the members of a channel and their roles.
+func (s *Server) channelMembersHandler(c *gin.Context) {
+	id, ok := channelID(c)
+	if !ok {
+		return
+	}
+
+	members, err := s.channels.Members(c.Request.Context(), id, auth.CurrentUser(c))
+	if err != nil {
+		c.Error(channelFailure(err, "Channel not found", "Failed to fetch members"))
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"members": members})
+}
+
+// setChannelRoleHandler gives the member in the path another role.
+func (s *Server) setChannelRoleHandler(c *gin.Context) {
+	ctx := c.Request.Context()
+	id, ok := channelID(c)
+	if !ok {
+		return
+	}
+	target := c.Param("username")
+
+	var req struct {
+		Role string `json:"role"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.Error(apperr.New(apperr.InvalidRequest, "Invalid request payload"))
+		return
+	}
+
+	if err := s.channels.SetRole(ctx, id, auth.CurrentUser(c), target, req.Role); err != nil {
+		c.Error(channelFailure(err, "Channel not found", "Failed to change role"))
+		return
+	}
+	s.audit(ctx, store.AuditEntry{Action: auditChannelRoleChanged, Target: id, Details: map[string]string{"member": target, "role": req.Role}})
+
+	c.JSON(http.StatusOK, gin.H{"message": s.tr(c, "Role changed successfully")})
+}
+
+// removeChannelMemberHandler unsubscribes the member in the path from a
+// channel.
+func (s *Server) removeChannelMemberHandler(c *gin.Context) {
+	ctx := c.Request.Context()
+	id, ok := channelID(c)
+	if !ok {
+		return
+	}
+	target := c.Param("username")
+
+	if err := s.channels.RemoveMember(ctx, id, auth.CurrentUser(c), target); err != nil {
+		c.Error(channelFailure(err, "Channel not found", "Failed to remove member"))
+		return
+	}
+	s.audit(ctx, store.AuditEntry{Action: auditChannelMemberRemoved, Target: id, Details: map[string]string{"member": target}})
+
+	c.JSON(http.StatusOK, gin.H{"message": s.tr(c, "Member removed successfully")})
+}
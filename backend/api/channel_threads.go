@@ -0,0 +1,167 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"backend/apperr"
+	"backend/auth"
+	"backend/metrics"
+	"backend/service"
+	"backend/store"
+
+	"github.com/gin-gonic/gin"
+)
+
+// threadFailure maps an error from the threads of a channel to an API
+// error.
+func threadFailure(err error, failed string) *apperr.Error {
+	switch {
+	case errors.Is(err, service.ErrNotChannelMember):
+		return apperr.New(apperr.ChannelRoleRequired, "Only members of the channel can follow its threads")
+	case errors.Is(err, service.ErrInvalidParent):
+		return apperr.New(apperr.InvalidReplyTo, "Replies must reply to a post of the channel")
+	}
+	return channelFailure(err, "Post not found", failed)
+}
+
+// channelThreadsHandler lists the threads of a channel, latest reply first,
+// with how many replies the authenticated user has not read in the ones
+// they follow. ?limit= caps how many.
+func (s *Server) channelThreadsHandler(c *gin.Context) {
+	id, ok := channelID(c)
+	if !ok {
+		return
+	}
+	limit := defaultChannelPostLimit
+	if v := c.Query("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 || n > maxChannelPostLimit {
+			c.Error(apperr.New(apperr.InvalidRequest, "Invalid limit, expected 1 to 200"))
+			return
+		}
+		limit = n
+	}
+
+	threads, err := s.channels.Threads(c.Request.Context(), id, auth.CurrentUser(c), limit)
+	if err != nil {
+		c.Error(channelFailure(err, "Channel not found", "Failed to fetch threads"))
+		return
+	}
+	parents := make([]store.ChannelPost, len(threads))
+	for i, t := range threads {
+		parents[i] = t.Parent
+	}
+	s.localizeSystemPosts(c, parents)
+	for i := range threads {
+		threads[i].Parent = parents[i]
+	}
+
+	c.JSON(http.StatusOK, gin.H{"threads": threads})
+}
+
+// channelRepliesHandler lists the latest replies in the thread of a post,
+// oldest first, or with ?before=<id> those before a reply. ?limit= caps how
+// many.
+func (s *Server) channelRepliesHandler(c *gin.Context) {
+	id, ok := channelID(c)
+	if !ok {
+		return
+	}
+	before, limit, ok := channelPostPage(c)
+	if !ok {
+		return
+	}
+
+	replies, err := s.channels.Replies(c.Request.Context(), id, auth.CurrentUser(c), c.Param("post"), before, limit)
+	if err != nil {
+		c.Error(threadFailure(err, "Failed to fetch replies"))
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"posts": replies})
+}
+
+// replyToChannelPostHandler replies in the thread of a post as a member of
+// its channel and delivers the reply to the thread's subscribers, which the
+// replier becomes one of.
+func (s *Server) replyToChannelPostHandler(c *gin.Context) {
+	id, ok := channelID(c)
+	if !ok {
+		return
+	}
+
+	var req struct {
+		Content string `json:"content"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.Error(apperr.New(apperr.InvalidRequest, "Invalid request payload"))
+		return
+	}
+
+	parentID := c.Param("post")
+	reply := store.ChannelPost{ChannelID: id, ParentID: &parentID, Sender: auth.CurrentUser(c), Content: req.Content}
+	if err := s.messages.PostToChannel(c.Request.Context(), &reply); err != nil {
+		switch {
+		case errors.Is(err, service.ErrNotChannelMember):
+			c.Error(apperr.New(apperr.ChannelRoleRequired, "Only members of the channel can reply"))
+		case errors.Is(err, service.ErrInvalidParent):
+			c.Error(threadFailure(err, ""))
+		default:
+			c.Error(sendFailure(err))
+		}
+		return
+	}
+	s.publishChannelPost(reply)
+
+	metrics.MessagesSent.WithLabelValues("channel").Inc()
+	c.JSON(http.StatusCreated, reply)
+}
+
+// markThreadReadHandler marks the replies in the thread of a post read.
+func (s *Server) markThreadReadHandler(c *gin.Context) {
+	id, ok := channelID(c)
+	if !ok {
+		return
+	}
+
+	if err := s.channels.MarkThreadRead(c.Request.Context(), id, auth.CurrentUser(c), c.Param("post")); err != nil {
+		c.Error(threadFailure(err, "Failed to mark thread read"))
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": s.tr(c, "Thread marked as read")})
+}
+
+// subscribeThreadHandler subscribes the authenticated user to the thread of
+// a post, so they receive its replies in real time.
+func (s *Server) subscribeThreadHandler(c *gin.Context) {
+	s.setThreadSubscription(c, true)
+}
+
+// unsubscribeThreadHandler unsubscribes the authenticated user from the
+// thread of a post until they reply in it again.
+func (s *Server) unsubscribeThreadHandler(c *gin.Context) {
+	s.setThreadSubscription(c, false)
+}
+
+// setThreadSubscription subscribes to or unsubscribes from the thread of
+// the post in the path.
+func (s *Server) setThreadSubscription(c *gin.Context, subscribed bool) {
+	id, ok := channelID(c)
+	if !ok {
+		return
+	}
+
+	if err := s.channels.SubscribeThread(c.Request.Context(), id, auth.CurrentUser(c), c.Param("post"), subscribed); err != nil {
+		c.Error(threadFailure(err, "Failed to update thread subscription"))
+		return
+	}
+
+	message := "Subscribed to thread"
+	if !subscribed {
+		message = "Unsubscribed from thread"
+	}
+	c.JSON(http.StatusOK, gin.H{"message": s.tr(c, message)})
+}
@@ -0,0 +1,487 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+
+	"backend/apperr"
+	"backend/auth"
+	"backend/metrics"
+	"backend/service"
+	"backend/store"
+	"backend/ws"
+
+	"github.com/gin-gonic/gin"
+)
+
+// channelPostChannel is the pub/sub channel carrying broadcast channel
+// posts. Each post is published once; every instance looks up which of its
+// connected users subscribe to the channel and delivers it to them.
+const channelPostChannel = "chat:channel_posts"
+
+// Channel limits.
+const (
+	maxChannelNameLength        = 64
+	maxChannelDescriptionLength = 500
+	maxChannelTopicLength       = 250
+	defaultChannelPostLimit     = 50
+	maxChannelPostLimit         = 200
+)
+
+// channelID returns the channel ID in the request path, or reports that the
+// channel was not found if it is not one.
+func channelID(c *gin.Context) (string, bool) {
+	id := c.Param("id")
+	if _, err := strconv.Atoi(id); err != nil {
+		c.Error(apperr.New(apperr.NotFound, "Channel not found"))
+		return "", false
+	}
+	return id, true
+}
+
+// validChannelVisibility reports whether v is public or private.
+func validChannelVisibility(v string) bool {
+	return v == store.ChannelPublic || v == store.ChannelPrivate
+}
+
+// channelsHandler lists the public channels and the private ones the
+// authenticated user belongs to, marking those they subscribe to.
+// ?search= only lists channels whose name, topic or description contain it.
+func (s *Server) channelsHandler(c *gin.Context) {
+	channels, err := s.store.Channels(c.Request.Context(), auth.CurrentUser(c), strings.TrimSpace(c.Query("search")))
+	if err != nil {
+		c.Error(apperr.New(apperr.Internal, "Failed to fetch channels"))
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"channels": channels})
+}
+
+// channelHandler returns a channel the authenticated user can see.
+func (s *Server) channelHandler(c *gin.Context) {
+	id, ok := channelID(c)
+	if !ok {
+		return
+	}
+
+	ch, err := s.channels.View(c.Request.Context(), id, auth.CurrentUser(c))
+	if errors.Is(err, store.ErrNotFound) {
+		c.Error(apperr.New(apperr.NotFound, "Channel not found"))
+		return
+	}
+	if err != nil {
+		c.Error(apperr.New(apperr.Internal, "Failed to fetch channel"))
+		return
+	}
+
+	c.JSON(http.StatusOK, ch)
+}
+
+// subscribeChannelHandler subscribes the authenticated user to a public
+// channel, joining it as a member.
+func (s *Server) subscribeChannelHandler(c *gin.Context) {
+	id, ok := channelID(c)
+	if !ok {
+		return
+	}
+
+	err := s.channels.Join(c.Request.Context(), id, auth.CurrentUser(c))
+	if errors.Is(err, store.ErrNotFound) {
+		c.Error(apperr.New(apperr.NotFound, "Channel not found"))
+		return
+	}
+	if err != nil {
+		c.Error(apperr.New(apperr.Internal, "Failed to subscribe to channel"))
+		return
+	}
+	s.trackRoomJoined(auth.CurrentUser(c), id)
+
+	c.JSON(http.StatusOK, gin.H{"message": s.tr(c, "Subscribed successfully")})
+}
+
+// unsubscribeChannelHandler unsubscribes the authenticated user from a
+// channel. The last owner of a channel cannot leave it.
+func (s *Server) unsubscribeChannelHandler(c *gin.Context) {
+	id, ok := channelID(c)
+	if !ok {
+		return
+	}
+
+	err := s.channels.Leave(c.Request.Context(), id, auth.CurrentUser(c))
+	if errors.Is(err, service.ErrNotChannelMember) {
+		c.Error(apperr.New(apperr.NotFound, "Not subscribed to channel"))
+		return
+	}
+	if err != nil {
+		c.Error(channelFailure(err, "Channel not found", "Failed to unsubscribe from channel"))
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": s.tr(c, "Unsubscribed successfully")})
+}
+
+// channelPostsHandler returns the latest posts of a channel, oldest first,
+// or with ?before=<id> those before a post. ?limit= caps how many.
+func (s *Server) channelPostsHandler(c *gin.Context) {
+	ctx := c.Request.Context()
+	id, ok := channelID(c)
+	if !ok {
+		return
+	}
+
+	before, limit, ok := channelPostPage(c)
+	if !ok {
+		return
+	}
+
+	if _, err := s.channels.View(ctx, id, auth.CurrentUser(c)); errors.Is(err, store.ErrNotFound) {
+		c.Error(apperr.New(apperr.NotFound, "Channel not found"))
+		return
+	} else if err != nil {
+		c.Error(apperr.New(apperr.Internal, "Failed to fetch channel"))
+		return
+	}
+
+	posts, err := s.store.ChannelPosts(ctx, id, auth.CurrentUser(c), before, limit)
+	if err != nil {
+		c.Error(apperr.New(apperr.Internal, "Failed to fetch posts"))
+		return
+	}
+	s.localizeSystemPosts(c, posts)
+
+	c.JSON(http.StatusOK, gin.H{"posts": posts})
+}
+
+// channelPostPage parses the ?before= and ?limit= of a page of posts,
+// reporting an error when either is invalid.
+func channelPostPage(c *gin.Context) (before string, limit int, ok bool) {
+	before = c.Query("before")
+	if before != "" {
+		if n, err := strconv.ParseInt(before, 10, 64); err != nil || n <= 0 {
+			c.Error(apperr.New(apperr.InvalidRequest, "Invalid before"))
+			return "", 0, false
+		}
+	}
+	limit = defaultChannelPostLimit
+	if v := c.Query("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 || n > maxChannelPostLimit {
+			c.Error(apperr.New(apperr.InvalidRequest, "Invalid limit, expected 1 to 200"))
+			return "", 0, false
+		}
+		limit = n
+	}
+	return before, limit, true
+}
+
+// postToChannelHandler posts to a channel as one of its senders and fans the
+// post out to its subscribers.
+func (s *Server) postToChannelHandler(c *gin.Context) {
+	id, ok := channelID(c)
+	if !ok {
+		return
+	}
+
+	var req struct {
+		Content string `json:"content"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.Error(apperr.New(apperr.InvalidRequest, "Invalid request payload"))
+		return
+	}
+
+	post := store.ChannelPost{ChannelID: id, Sender: auth.CurrentUser(c), Content: req.Content}
+	if err := s.messages.PostToChannel(c.Request.Context(), &post); err != nil {
+		if errors.Is(err, service.ErrNotChannelSender) {
+			c.Error(apperr.New(apperr.NotChannelSender, "Only the channel's senders can post to it"))
+			return
+		}
+		c.Error(sendFailure(err))
+		return
+	}
+	s.publishChannelPost(post)
+
+	metrics.MessagesSent.WithLabelValues("channel").Inc()
+	c.JSON(http.StatusCreated, post)
+}
+
+// deleteChannelPostHandler deletes a post of a channel. Senders may delete
+// their own posts, channel admins and owners anyone's.
+func (s *Server) deleteChannelPostHandler(c *gin.Context) {
+	ctx := c.Request.Context()
+	id, ok := channelID(c)
+	if !ok {
+		return
+	}
+	postID := c.Param("post")
+
+	if err := s.channels.DeletePost(ctx, id, auth.CurrentUser(c), postID); err != nil {
+		c.Error(channelFailure(err, "Post not found", "Failed to delete post"))
+		return
+	}
+	s.audit(ctx, store.AuditEntry{Action: auditChannelPostDeleted, Target: postID, Details: map[string]string{"channel": id}})
+
+	c.JSON(http.StatusOK, gin.H{"message": s.tr(c, "Post deleted successfully")})
+}
+
+// pinnedChannelPostsHandler lists the pinned posts of a channel, oldest
+// first.
+func (s *Server) pinnedChannelPostsHandler(c *gin.Context) {
+	ctx := c.Request.Context()
+	id, ok := channelID(c)
+	if !ok {
+		return
+	}
+
+	if _, err := s.channels.View(ctx, id, auth.CurrentUser(c)); errors.Is(err, store.ErrNotFound) {
+		c.Error(apperr.New(apperr.NotFound, "Channel not found"))
+		return
+	} else if err != nil {
+		c.Error(apperr.New(apperr.Internal, "Failed to fetch channel"))
+		return
+	}
+
+	posts, err := s.store.PinnedChannelPosts(ctx, id, auth.CurrentUser(c))
+	if err != nil {
+		c.Error(apperr.New(apperr.Internal, "Failed to fetch posts"))
+		return
+	}
+	s.localizeSystemPosts(c, posts)
+
+	c.JSON(http.StatusOK, gin.H{"posts": posts})
+}
+
+// pinChannelPostHandler pins a post of a channel. Pinning a pinned post is
+// a no-op.
+func (s *Server) pinChannelPostHandler(c *gin.Context) {
+	s.setChannelPostPinned(c, true)
+}
+
+// unpinChannelPostHandler unpins a post of a channel.
+func (s *Server) unpinChannelPostHandler(c *gin.Context) {
+	s.setChannelPostPinned(c, false)
+}
+
+// setChannelPostPinned pins or unpins the post in the path.
+func (s *Server) setChannelPostPinned(c *gin.Context, pinned bool) {
+	id, ok := channelID(c)
+	if !ok {
+		return
+	}
+
+	if err := s.channels.Pin(c.Request.Context(), id, auth.CurrentUser(c), c.Param("post"), pinned); err != nil {
+		c.Error(channelFailure(err, "Post not found", "Failed to pin post"))
+		return
+	}
+
+	message := "Post pinned"
+	if !pinned {
+		message = "Post unpinned"
+	}
+	c.JSON(http.StatusOK, gin.H{"message": s.tr(c, message)})
+}
+
+// channelPostPayload is a channel post as published to other instances,
+// which need to know whether it is shadowed to deliver it.
+type channelPostPayload struct {
+	store.ChannelPost
+	Shadowed bool `json:"shadowed,omitempty"`
+}
+
+// publishChannelPost sends a post to every instance. If the bus is unavailable
+// the post is still delivered to local subscribers.
+func (s *Server) publishChannelPost(post store.ChannelPost) {
+	payload, err := json.Marshal(channelPostPayload{ChannelPost: post, Shadowed: post.Shadowed})
+	if err != nil {
+		log.Printf("Error encoding channel post: %v", err)
+		return
+	}
+
+	if err := s.bus.Publish(context.Background(), channelPostChannel, payload); err != nil {
+		log.Printf("Publish error for channel post, delivering locally: %v", err)
+		s.deliverPost(post)
+	}
+}
+
+// deliverChannelPost decodes a published post and delivers it.
+func (s *Server) deliverChannelPost(payload string) {
+	var p channelPostPayload
+	if err := json.Unmarshal([]byte(payload), &p); err != nil {
+		log.Printf("Error decoding channel post: %v", err)
+		return
+	}
+	p.ChannelPost.Shadowed = p.Shadowed
+	s.deliverPost(p.ChannelPost)
+}
+
+// deliverPost sends a post to the locally connected subscribers of its
+// channel, or only to its sender if it is shadowed. Replies go to the
+// subscribers of their thread instead.
+func (s *Server) deliverPost(post store.ChannelPost) {
+	connected := s.hub.Users()
+	if post.Shadowed {
+		connected = slices.DeleteFunc(connected, func(username string) bool { return username != post.Sender })
+	}
+	if len(connected) == 0 {
+		return
+	}
+
+	var subscribers []string
+	var err error
+	if post.ParentID != nil {
+		subscribers, err = s.store.ThreadSubscribersAmong(context.Background(), post.ChannelID, *post.ParentID, connected)
+	} else {
+		subscribers, err = s.store.ChannelSubscribersAmong(context.Background(), post.ChannelID, connected)
+	}
+	if err != nil {
+		log.Printf("Error fetching subscribers of channel %s: %v", post.ChannelID, err)
+		return
+	}
+
+	event := ws.Event{Type: ws.TypeChannelPost, Payload: post}
+	for _, username := range subscribers {
+		s.hub.SendToUser(username, event)
+	}
+}
+
+// createChannelHandler creates a broadcast channel with its designated
+// senders.
+func (s *Server) createChannelHandler(c *gin.Context) {
+	ctx := c.Request.Context()
+
+	var req struct {
+		Name        string   `json:"name"`
+		Description string   `json:"description"`
+		Topic       string   `json:"topic"`
+		Visibility  string   `json:"visibility"`
+		Senders     []string `json:"senders"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.Error(apperr.New(apperr.InvalidRequest, "Invalid request payload"))
+		return
+	}
+	if req.Visibility == "" {
+		req.Visibility = store.ChannelPublic
+	}
+	if err := validateChannelSettings(store.ChannelUpdate{Name: &req.Name, Description: &req.Description, Topic: &req.Topic, Visibility: &req.Visibility}); err != nil {
+		c.Error(err)
+		return
+	}
+	for _, sender := range req.Senders {
+		if exists, err := s.store.UserExists(ctx, sender); err != nil {
+			c.Error(apperr.New(apperr.Internal, "Failed to fetch user"))
+			return
+		} else if !exists {
+			c.Error(apperr.Newf(apperr.UserNotFound, "Unknown sender %s", sender))
+			return
+		}
+	}
+
+	ch := store.Channel{Name: req.Name, Description: req.Description, Topic: req.Topic, Visibility: req.Visibility,
+		Senders: req.Senders, CreatedBy: auth.CurrentUser(c)}
+	if ch.Senders == nil {
+		ch.Senders = []string{}
+	}
+	err := s.store.CreateChannel(ctx, &ch)
+	if errors.Is(err, store.ErrChannelTaken) {
+		c.Error(apperr.New(apperr.ChannelTaken, "Channel name already taken"))
+		return
+	}
+	if err != nil {
+		c.Error(apperr.New(apperr.Internal, "Failed to create channel"))
+		return
+	}
+	s.audit(ctx, store.AuditEntry{Action: auditChannelCreated, Target: ch.ID, Details: map[string]string{"name": ch.Name}})
+
+	// Fetch it again for the deduplicated, sorted senders.
+	created, err := s.store.Channel(ctx, ch.ID, ch.CreatedBy)
+	if err != nil {
+		c.Error(apperr.New(apperr.Internal, "Failed to fetch channel"))
+		return
+	}
+
+	c.JSON(http.StatusCreated, created)
+}
+
+// deleteChannelHandler deletes a channel with its subscriptions and posts.
+func (s *Server) deleteChannelHandler(c *gin.Context) {
+	id, ok := channelID(c)
+	if !ok {
+		return
+	}
+
+	err := s.store.DeleteChannel(c.Request.Context(), id)
+	if errors.Is(err, store.ErrNotFound) {
+		c.Error(apperr.New(apperr.NotFound, "Channel not found"))
+		return
+	}
+	if err != nil {
+		c.Error(apperr.New(apperr.Internal, "Failed to delete channel"))
+		return
+	}
+	s.audit(c.Request.Context(), store.AuditEntry{Action: auditChannelDeleted, Target: id})
+
+	c.JSON(http.StatusOK, gin.H{"message": s.tr(c, "Channel deleted successfully")})
+}
+
+// addChannelSenderHandler lets the user in the path post to a channel.
+func (s *Server) addChannelSenderHandler(c *gin.Context) {
+	ctx := c.Request.Context()
+	id, ok := channelID(c)
+	if !ok {
+		return
+	}
+	username := c.Param("username")
+
+	exists, err := s.store.UserExists(ctx, username)
+	if err != nil {
+		c.Error(apperr.New(apperr.Internal, "Failed to fetch user"))
+		return
+	}
+	if !exists {
+		c.Error(apperr.New(apperr.UserNotFound, "User not found"))
+		return
+	}
+
+	err = s.store.AddChannelSender(ctx, id, username)
+	if errors.Is(err, store.ErrNotFound) {
+		c.Error(apperr.New(apperr.NotFound, "Channel not found"))
+		return
+	}
+	if err != nil {
+		c.Error(apperr.New(apperr.Internal, "Failed to add sender"))
+		return
+	}
+	s.audit(ctx, store.AuditEntry{Action: auditChannelSenderAdded, Target: id, Details: map[string]string{"sender": username}})
+
+	c.JSON(http.StatusOK, gin.H{"message": s.tr(c, "Sender added successfully")})
+}
+
+// removeChannelSenderHandler stops the user in the path from posting to a
+// channel.
+func (s *Server) removeChannelSenderHandler(c *gin.Context) {
+	id, ok := channelID(c)
+	if !ok {
+		return
+	}
+	username := c.Param("username")
+
+	removed, err := s.store.RemoveChannelSender(c.Request.Context(), id, username)
+	if err != nil {
+		c.Error(apperr.New(apperr.Internal, "Failed to remove sender"))
+		return
+	}
+	if !removed {
+		c.Error(apperr.New(apperr.NotFound, "User is not a sender of this channel"))
+		return
+	}
+	s.audit(c.Request.Context(), store.AuditEntry{Action: auditChannelSenderRemoved, Target: id, Details: map[string]string{"sender": username}})
+
+	c.JSON(http.StatusOK, gin.H{"message": s.tr(c, "Sender removed successfully")})
+}
@@ -0,0 +1,131 @@
+package api
+
+import (
+	"compress/gzip"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/gin-gonic/gin"
+)
+
+// gzipWriters reuses gzip writers, which are costly to allocate.
+var gzipWriters = sync.Pool{New: func() interface{} { return gzip.NewWriter(nil) }}
+
+// gzipMiddleware compresses JSON responses of at least s.gzipMinBytes for
+// clients accepting gzip. Smaller responses gain little, and other content,
+// such as event streams and attachments, is left alone.
+func (s *Server) gzipMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if s.gzipMinBytes <= 0 || c.Request.Method == http.MethodHead || !acceptsGzip(c.GetHeader("Accept-Encoding")) {
+			c.Next()
+			return
+		}
+
+		w := &gzipWriter{ResponseWriter: c.Writer, minBytes: s.gzipMinBytes}
+		c.Writer = w
+		defer func() {
+			w.close()
+			c.Writer = w.ResponseWriter
+		}()
+		c.Next()
+	}
+}
+
+// acceptsGzip reports whether an Accept-Encoding header allows gzip.
+func acceptsGzip(header string) bool {
+	for _, part := range strings.Split(header, ",") {
+		coding, params, _ := strings.Cut(part, ";")
+		coding = strings.TrimSpace(coding)
+		if coding != "gzip" && coding != "*" {
+			continue
+		}
+		if q, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			weight, err := strconv.ParseFloat(q, 64)
+			return err == nil && weight > 0
+		}
+		return true
+	}
+	return false
+}
+
+// gzipWriter holds a JSON response back until it reaches minBytes, then
+// compresses it. Responses that end smaller are written as they are.
+type gzipWriter struct {
+	gin.ResponseWriter
+	minBytes int
+
+	// decided is set on the first write, once the headers tell whether the
+	// response may be compressed; passthrough, when it may not.
+	decided     bool
+	passthrough bool
+	buf         []byte
+	gz          *gzip.Writer
+}
+
+func (w *gzipWriter) Write(p []byte) (int, error) {
+	if !w.decided {
+		w.decided = true
+		h := w.Header()
+		w.passthrough = h.Get("Content-Encoding") != "" || !strings.HasPrefix(h.Get("Content-Type"), "application/json")
+	}
+	if w.passthrough {
+		return w.ResponseWriter.Write(p)
+	}
+	if w.gz != nil {
+		return w.gz.Write(p)
+	}
+
+	w.buf = append(w.buf, p...)
+	if len(w.buf) >= w.minBytes {
+		if err := w.startGzip(); err != nil {
+			return 0, err
+		}
+	}
+	return len(p), nil
+}
+
+func (w *gzipWriter) WriteString(s string) (int, error) {
+	return w.Write([]byte(s))
+}
+
+// Flush sends what was written so far, compressed if it is already.
+func (w *gzipWriter) Flush() {
+	if w.gz != nil {
+		w.gz.Flush()
+	} else if len(w.buf) > 0 {
+		w.ResponseWriter.Write(w.buf)
+		w.buf, w.passthrough = nil, true
+	}
+	w.ResponseWriter.Flush()
+}
+
+// startGzip switches the response to gzip, compressing what was held back.
+func (w *gzipWriter) startGzip() error {
+	h := w.Header()
+	h.Set("Content-Encoding", "gzip")
+	h.Add("Vary", "Accept-Encoding")
+	h.Del("Content-Length")
+
+	w.gz = gzipWriters.Get().(*gzip.Writer)
+	w.gz.Reset(w.ResponseWriter)
+	buf := w.buf
+	w.buf = nil
+	_, err := w.gz.Write(buf)
+	return err
+}
+
+// close ends the response, writing a response held back uncompressed.
+func (w *gzipWriter) close() {
+	if w.gz != nil {
+		w.gz.Close()
+		gzipWriters.Put(w.gz)
+		w.gz = nil
+		return
+	}
+	if len(w.buf) > 0 {
+		w.ResponseWriter.Write(w.buf)
+		w.buf = nil
+	}
+}
@@ -0,0 +1,129 @@
+package api
+
+import (
+	"crypto/subtle"
+	"net/http"
+
+	"backend/apperr"
+	"backend/auth"
+	"backend/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+// In cookie auth mode, browsers keep the access and refresh tokens in
+// HttpOnly cookies that scripts cannot read. Since browsers send cookies
+// along with requests other sites trigger, requests authenticated by cookie
+// that change state must also carry the CSRF token in a header: a double
+// submit, on top of SameSite=Lax cookies.
+const (
+	accessTokenCookie  = "access_token"
+	refreshTokenCookie = "refresh_token"
+	csrfCookie         = "csrf_token"
+	csrfHeader         = "X-CSRF-Token"
+)
+
+// tokenResponse returns the response body carrying tokens. In cookie auth
+// mode it also sets the session cookies, and the body carries the new CSRF
+// token for frontends on another origin, which cannot read its cookie.
+func (s *Server) tokenResponse(c *gin.Context, tokens service.TokenPair) (gin.H, error) {
+	body := gin.H{"token": tokens.Token, "refresh_token": tokens.RefreshToken}
+	if !s.cookieAuth {
+		return body, nil
+	}
+
+	csrfToken, err := auth.NewOpaqueToken()
+	if err != nil {
+		return nil, err
+	}
+	setCookie(c, accessTokenCookie, tokens.Token, int(auth.TokenTTL.Seconds()), true)
+	setCookie(c, refreshTokenCookie, tokens.RefreshToken, int(auth.RefreshTokenTTL.Seconds()), true)
+	setCookie(c, csrfCookie, csrfToken, int(auth.RefreshTokenTTL.Seconds()), false)
+	body["csrf_token"] = csrfToken
+	return body, nil
+}
+
+// clearSessionCookies removes the session cookies on logout.
+func (s *Server) clearSessionCookies(c *gin.Context) {
+	if !s.cookieAuth {
+		return
+	}
+	for _, name := range []string{accessTokenCookie, refreshTokenCookie, csrfCookie} {
+		setCookie(c, name, "", -1, name != csrfCookie)
+	}
+}
+
+// setCookie sets a cookie for the whole site, sent over HTTPS only and not
+// on cross-site subrequests. Browsers treat localhost as secure, so Secure
+// does not get in the way of development.
+func setCookie(c *gin.Context, name, value string, maxAge int, httpOnly bool) {
+	http.SetCookie(c.Writer, &http.Cookie{
+		Name:     name,
+		Value:    value,
+		Path:     "/",
+		MaxAge:   maxAge,
+		Secure:   true,
+		HttpOnly: httpOnly,
+		SameSite: http.SameSiteLaxMode,
+	})
+}
+
+// cookieAuthMiddleware authenticates requests without an Authorization
+// header by the access token cookie, in cookie auth mode. Requests that may
+// change state must pass the CSRF check first. Clients sending a token or
+// API key in the header are not subject to it, since other sites cannot make
+// browsers send headers.
+func (s *Server) cookieAuthMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !s.cookieAuth || c.GetHeader("Authorization") != "" {
+			c.Next()
+			return
+		}
+		token, err := c.Cookie(accessTokenCookie)
+		if err != nil || token == "" {
+			c.Next()
+			return
+		}
+
+		if e := checkCSRF(c); e != nil {
+			apperr.Abort(c, e)
+			return
+		}
+		c.Request.Header.Set("Authorization", "Bearer "+token)
+		c.Next()
+	}
+}
+
+// checkCSRF returns a CSRF_FAILED error unless a request authenticated by
+// cookie is safe, or carries the CSRF token of its cookie in csrfHeader.
+func checkCSRF(c *gin.Context) *apperr.Error {
+	switch c.Request.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+		return nil
+	}
+
+	cookie, err := c.Cookie(csrfCookie)
+	header := c.GetHeader(csrfHeader)
+	if err != nil || cookie == "" || subtle.ConstantTimeCompare([]byte(cookie), []byte(header)) != 1 {
+		return apperr.New(apperr.CSRFFailed, "Missing or invalid CSRF token")
+	}
+	return nil
+}
+
+// refreshTokenFromRequest returns the refresh token in the request body or,
+// in cookie auth mode, in its cookie, which must pass the CSRF check.
+func (s *Server) refreshTokenFromRequest(c *gin.Context) (string, *apperr.Error) {
+	var req struct {
+		RefreshToken string `json:"refresh_token"`
+	}
+	if err := c.ShouldBindJSON(&req); err == nil && req.RefreshToken != "" {
+		return req.RefreshToken, nil
+	}
+
+	if s.cookieAuth {
+		if token, err := c.Cookie(refreshTokenCookie); err == nil && token != "" {
+			return token, checkCSRF(c)
+		}
+	}
+	return "", apperr.New(apperr.InvalidRequest, "Invalid request payload")
+}
@@ -0,0 +1,111 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/gin-contrib/cors"
+	"github.com/gin-gonic/gin"
+)
+
+// CORSConfig configures which browser origins may call the API.
+type CORSConfig struct {
+	// Origins are allowed origins such as "https://chat.example.com", or
+	// "https://*.example.com" for every subdomain. "*" allows any origin, but
+	// then no credentials.
+	Origins []string
+	Methods []string
+	Headers []string
+	// MaxAge is how long browsers may cache a preflight response.
+	MaxAge time.Duration
+}
+
+// ValidateOrigin reports whether pattern is a valid entry of
+// CORSConfig.Origins.
+func ValidateOrigin(pattern string) error {
+	if pattern == "*" {
+		return nil
+	}
+	u, err := url.Parse(strings.Replace(pattern, "://*.", "://wildcard.", 1))
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" ||
+		u.Path != "" || u.RawQuery != "" || u.Fragment != "" || u.User != nil || strings.Contains(u.Host, "*") {
+		return fmt.Errorf("invalid origin %q, expected a scheme and host such as https://chat.example.com or https://*.example.com", pattern)
+	}
+	return nil
+}
+
+// originPolicy decides which origins may call the API, for CORS and
+// WebSocket upgrades alike.
+type originPolicy struct {
+	any   bool
+	exact map[string]bool
+	// wildcards are the scheme and host suffix of each wildcard pattern,
+	// e.g. "https://" and ".example.com".
+	wildcards [][2]string
+}
+
+// newOriginPolicy builds the policy of origin patterns that passed
+// ValidateOrigin.
+func newOriginPolicy(patterns []string) originPolicy {
+	p := originPolicy{exact: make(map[string]bool)}
+	for _, pattern := range patterns {
+		pattern = strings.ToLower(strings.TrimSuffix(pattern, "/"))
+		switch {
+		case pattern == "*":
+			p.any = true
+		case strings.Contains(pattern, "://*."):
+			scheme, suffix, _ := strings.Cut(pattern, "*")
+			p.wildcards = append(p.wildcards, [2]string{scheme, suffix})
+		default:
+			p.exact[pattern] = true
+		}
+	}
+	return p
+}
+
+// allowed reports whether a browser at origin may call the API.
+func (p originPolicy) allowed(origin string) bool {
+	origin = strings.ToLower(origin)
+	if p.any || p.exact[origin] {
+		return true
+	}
+	for _, w := range p.wildcards {
+		host, ok := strings.CutPrefix(origin, w[0])
+		if ok && len(host) > len(w[1]) && strings.HasSuffix(host, w[1]) && !strings.ContainsAny(host, "/?#@") {
+			return true
+		}
+	}
+	return false
+}
+
+// checkOrigin is the CheckOrigin of the WebSocket upgraders. Requests without
+// an Origin header come from clients other than browsers, which CORS does
+// not apply to either.
+func (p originPolicy) checkOrigin(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	return origin == "" || p.allowed(origin)
+}
+
+// corsMiddleware answers preflight requests and sets the CORS headers of
+// requests from allowed origins.
+func (s *Server) corsMiddleware() gin.HandlerFunc {
+	cfg := cors.Config{
+		AllowMethods: s.cors.Methods,
+		AllowHeaders: s.cors.Headers,
+		// Let browsers read the headers of deprecated paths and rate limits.
+		ExposeHeaders: []string{"Deprecation", "Link", "Retry-After"},
+		MaxAge:        s.cors.MaxAge,
+	}
+	if s.origins.any {
+		// Credentials may not be combined with a wildcard origin; the API
+		// authenticates with bearer tokens, which need none.
+		cfg.AllowAllOrigins = true
+	} else {
+		cfg.AllowOriginFunc = s.origins.allowed
+		cfg.AllowCredentials = true
+	}
+	return cors.New(cfg)
+}
@@ -0,0 +1,109 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestOriginPolicy(t *testing.T) {
+	p := newOriginPolicy([]string{"https://chat.example.com/", "https://*.example.com", "http://*.Dev.Test"})
+
+	tests := []struct {
+		origin string
+		want   bool
+	}{
+		{"https://chat.example.com", true},
+		{"HTTPS://Chat.Example.com", true},
+		{"https://app.example.com", true},
+		{"https://a.b.example.com", true},
+		{"http://app.dev.test", true},
+
+		// Look-alikes that merely end in the allowed suffix.
+		{"https://evil-example.com", false},
+		{"https://evilexample.com", false},
+		{"https://.example.com", false},
+		{"https://example.com", false},
+		{"https://example.com.evil.com", false},
+		{"https://evil.com/.example.com", false},
+		{"https://evil.com?.example.com", false},
+		{"https://evil.com#.example.com", false},
+		{"https://user@evil.com@x.example.com", false},
+
+		// The scheme must match too.
+		{"http://app.example.com", false},
+		{"https://app.dev.test", false},
+		{"null", false},
+		{"", false},
+	}
+	for _, tt := range tests {
+		if got := p.allowed(tt.origin); got != tt.want {
+			t.Errorf("allowed(%q) = %v, want %v", tt.origin, got, tt.want)
+		}
+	}
+
+	if !newOriginPolicy([]string{"*"}).allowed("https://anything.test") {
+		t.Error(`"*" does not allow every origin`)
+	}
+}
+
+func TestOriginPolicyCheckOrigin(t *testing.T) {
+	p := newOriginPolicy([]string{"https://chat.example.com"})
+
+	for origin, want := range map[string]bool{
+		// Clients other than browsers send no Origin.
+		"":                         true,
+		"https://chat.example.com": true,
+		"https://evil.com":         false,
+	} {
+		r := httptest.NewRequest("GET", "/ws", nil)
+		if origin != "" {
+			r.Header.Set("Origin", origin)
+		}
+		if got := p.checkOrigin(r); got != want {
+			t.Errorf("checkOrigin(%q) = %v, want %v", origin, got, want)
+		}
+	}
+}
+
+func TestCORSCredentials(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	serve := func(origins []string, origin string) http.Header {
+		s := &Server{cors: CORSConfig{Origins: origins, Methods: []string{"GET"}}, origins: newOriginPolicy(origins)}
+		r := gin.New()
+		r.Use(s.corsMiddleware())
+		r.GET("/", func(c *gin.Context) { c.Status(http.StatusOK) })
+
+		req := httptest.NewRequest("GET", "/", nil)
+		if origin != "" {
+			req.Header.Set("Origin", origin)
+		}
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w.Header()
+	}
+
+	// Allowed origins are echoed and may send credentials.
+	h := serve([]string{"https://*.example.com"}, "https://app.example.com")
+	if h.Get("Access-Control-Allow-Origin") != "https://app.example.com" || h.Get("Access-Control-Allow-Credentials") != "true" {
+		t.Errorf("allowed origin: headers %v", h)
+	}
+
+	h = serve([]string{"https://*.example.com"}, "https://evil-example.com")
+	if h.Get("Access-Control-Allow-Origin") != "" || h.Get("Access-Control-Allow-Credentials") != "" {
+		t.Errorf("look-alike origin: headers %v", h)
+	}
+
+	h = serve([]string{"https://*.example.com"}, "")
+	if h.Get("Access-Control-Allow-Origin") != "" {
+		t.Errorf("missing origin: headers %v", h)
+	}
+
+	// A wildcard origin never comes with credentials.
+	h = serve([]string{"*"}, "https://evil.com")
+	if h.Get("Access-Control-Allow-Origin") != "*" || h.Get("Access-Control-Allow-Credentials") != "" {
+		t.Errorf("any origin: headers %v", h)
+	}
+}
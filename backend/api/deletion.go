@@ -0,0 +1,65 @@
+package api
+
+import (
+	"net/http"
+
+	"backend/apperr"
+	"backend/auth"
+	"backend/store"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Deletion scopes accepted by DELETE /messages/:id.
+const (
+	deleteForMe       = "me"
+	deleteForEveryone = "everyone"
+)
+
+// deleteMessageHandler deletes a message either for the authenticated user
+// only (?scope=me, the default) or, for its sender, for everyone
+// (?scope=everyone).
+func (s *Server) deleteMessageHandler(c *gin.Context) {
+	ctx := c.Request.Context()
+	username := auth.CurrentUser(c)
+	messageID := c.Param("id")
+	scope := c.DefaultQuery("scope", deleteForMe)
+
+	sender, receiver, ok := s.authorizeMessage(c, messageID)
+	if !ok {
+		return
+	}
+
+	switch scope {
+	case deleteForMe:
+		if err := s.store.DeleteForUser(ctx, messageID, username); err != nil {
+			c.Error(apperr.New(apperr.Internal, "Failed to delete message"))
+			return
+		}
+
+		other := receiver
+		if username == receiver {
+			other = sender
+		}
+		s.cache.Invalidate(ctx, username, other)
+	case deleteForEveryone:
+		if username != sender {
+			c.Error(apperr.New(apperr.NotSender, "Only the sender can delete a message for everyone"))
+			return
+		}
+
+		if err := s.store.DeleteForEveryone(ctx, messageID); err != nil {
+			c.Error(apperr.New(apperr.Internal, "Failed to delete message"))
+			return
+		}
+
+		// Open clients replace the message by ID and render it as deleted.
+		s.broadcastMessageByID(ctx, messageID)
+	default:
+		c.Error(apperr.New(apperr.InvalidRequest, "Invalid scope, must be 'me' or 'everyone'"))
+		return
+	}
+	s.audit(ctx, store.AuditEntry{Action: auditMessageDeleted, Target: messageID, Details: map[string]string{"scope": scope}})
+
+	c.JSON(http.StatusOK, gin.H{"message": s.tr(c, "Message deleted successfully")})
+}
@@ -0,0 +1,252 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"log"
+	"net/http"
+	"time"
+
+	"backend/apperr"
+	"backend/auth"
+	"backend/push"
+	"backend/store"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Limits of notification settings.
+const (
+	maxMuteDuration   = 365 * 24 * time.Hour
+	maxTimeZoneLength = 64
+)
+
+// notifyIfOffline asks the notifier to push msg to the receiver's devices
+// when they have no open WebSocket connection and are not in Do Not Disturb.
+func (s *Server) notifyIfOffline(msg store.Message) {
+	ctx := context.Background()
+
+	online, err := s.rdb.Exists(ctx, presenceKey(msg.Receiver)).Result()
+	if err != nil {
+		log.Printf("Error checking presence of %s: %v", msg.Receiver, err)
+		return
+	}
+	if online > 0 {
+		return
+	}
+
+	status, err := s.store.UserStatus(ctx, msg.Receiver)
+	if err != nil {
+		log.Printf("Error fetching status of %s: %v", msg.Receiver, err)
+		return
+	}
+	if status.Availability == store.AvailabilityDND {
+		return
+	}
+
+	s.notifier.Notify(ctx, msg)
+}
+
+// registerDeviceHandler registers a device token for the authenticated user.
+// A token registered by another user is moved to this one.
+func (s *Server) registerDeviceHandler(c *gin.Context) {
+	var d store.Device
+	if err := c.BindJSON(&d); err != nil {
+		c.Error(apperr.New(apperr.InvalidRequest, "Invalid request payload"))
+		return
+	}
+	if !push.ValidPlatform(d.Platform) {
+		c.Error(apperr.New(apperr.InvalidRequest, "Platform must be fcm, apns or webpush"))
+		return
+	}
+	if d.Token == "" {
+		c.Error(apperr.New(apperr.InvalidRequest, "Missing token"))
+		return
+	}
+
+	if err := s.store.RegisterDevice(c.Request.Context(), auth.CurrentUser(c), &d); err != nil {
+		c.Error(apperr.New(apperr.Internal, "Failed to register device"))
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{"device": d})
+}
+
+// unregisterDeviceHandler removes one of the authenticated user's devices.
+func (s *Server) unregisterDeviceHandler(c *gin.Context) {
+	removed, err := s.store.UnregisterDevice(c.Request.Context(), c.Param("id"), auth.CurrentUser(c))
+	if err != nil {
+		c.Error(apperr.New(apperr.Internal, "Failed to unregister device"))
+		return
+	}
+	if !removed {
+		c.Error(apperr.New(apperr.NotFound, "Device not found"))
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": s.tr(c, "Device unregistered successfully")})
+}
+
+// getPreferencesHandler returns the authenticated user's notification preferences.
+func (s *Server) getPreferencesHandler(c *gin.Context) {
+	prefs, err := s.store.NotificationPreferences(c.Request.Context(), auth.CurrentUser(c))
+	if err != nil {
+		c.Error(apperr.New(apperr.Internal, "Failed to fetch preferences"))
+		return
+	}
+	c.JSON(http.StatusOK, prefs)
+}
+
+// updatePreferencesHandler changes the given notification preferences of the
+// authenticated user, leaving omitted ones as they were. A null quiet_hours
+// turns quiet hours off.
+func (s *Server) updatePreferencesHandler(c *gin.Context) {
+	ctx := c.Request.Context()
+	username := auth.CurrentUser(c)
+
+	var req struct {
+		PushEnabled *bool           `json:"push_enabled"`
+		ShowPreview *bool           `json:"show_preview"`
+		QuietHours  json.RawMessage `json:"quiet_hours"`
+	}
+	if err := c.BindJSON(&req); err != nil {
+		c.Error(apperr.New(apperr.InvalidRequest, "Invalid request payload"))
+		return
+	}
+
+	var quietHours *store.QuietHours
+	if len(req.QuietHours) > 0 {
+		if err := json.Unmarshal(req.QuietHours, &quietHours); err != nil {
+			c.Error(apperr.New(apperr.InvalidRequest, "Invalid quiet_hours"))
+			return
+		}
+		if e := validQuietHours(quietHours); e != nil {
+			c.Error(e)
+			return
+		}
+	}
+
+	prefs, err := s.store.NotificationPreferences(ctx, username)
+	if err != nil {
+		c.Error(apperr.New(apperr.Internal, "Failed to fetch preferences"))
+		return
+	}
+	if req.PushEnabled != nil {
+		prefs.PushEnabled = *req.PushEnabled
+	}
+	if req.ShowPreview != nil {
+		prefs.ShowPreview = *req.ShowPreview
+	}
+	if len(req.QuietHours) > 0 {
+		prefs.QuietHours = quietHours
+	}
+
+	if err := s.store.SetNotificationPreferences(ctx, username, prefs); err != nil {
+		c.Error(apperr.New(apperr.Internal, "Failed to update preferences"))
+		return
+	}
+
+	c.JSON(http.StatusOK, prefs)
+}
+
+// validQuietHours checks the times and time zone of quiet hours, defaulting
+// the time zone to UTC. Nil quiet hours are valid.
+func validQuietHours(q *store.QuietHours) *apperr.Error {
+	if q == nil {
+		return nil
+	}
+
+	_, startErr := time.Parse(store.QuietHoursLayout, q.Start)
+	_, endErr := time.Parse(store.QuietHoursLayout, q.End)
+	if startErr != nil || endErr != nil {
+		return apperr.New(apperr.InvalidRequest, "Quiet hours start and end must be times like 22:00")
+	}
+	if q.Start == q.End {
+		return apperr.New(apperr.InvalidRequest, "Quiet hours must not start and end at the same time")
+	}
+
+	if q.TimeZone == "" {
+		q.TimeZone = "UTC"
+	}
+	if _, err := time.LoadLocation(q.TimeZone); err != nil || len(q.TimeZone) > maxTimeZoneLength {
+		return apperr.Newf(apperr.InvalidRequest, "Unknown time zone %s", q.TimeZone)
+	}
+	return nil
+}
+
+// mutesHandler lists the conversations the authenticated user muted.
+func (s *Server) mutesHandler(c *gin.Context) {
+	mutes, err := s.store.Mutes(c.Request.Context(), auth.CurrentUser(c))
+	if err != nil {
+		c.Error(apperr.New(apperr.Internal, "Failed to fetch mutes"))
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"mutes": mutes})
+}
+
+// muteHandler mutes the authenticated user's conversation with the user in
+// the path, for duration_seconds or, if 0 or omitted, until unmuted. Muted
+// conversations send no push notifications; WebSocket events still arrive.
+func (s *Server) muteHandler(c *gin.Context) {
+	ctx := c.Request.Context()
+	username := auth.CurrentUser(c)
+	peer := c.Param("username")
+
+	var req struct {
+		DurationSeconds int `json:"duration_seconds"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil && err != io.EOF {
+		c.Error(apperr.New(apperr.InvalidRequest, "Invalid request payload"))
+		return
+	}
+	d := time.Duration(req.DurationSeconds) * time.Second
+	if d < 0 || d > maxMuteDuration {
+		c.Error(apperr.New(apperr.InvalidRequest, "duration_seconds must be between 0 and 31536000"))
+		return
+	}
+
+	exists, err := s.store.UserExists(ctx, peer)
+	if err != nil {
+		c.Error(apperr.New(apperr.Internal, "Failed to fetch user"))
+		return
+	}
+	if !exists || peer == username {
+		c.Error(apperr.New(apperr.UserNotFound, "User not found"))
+		return
+	}
+
+	mute, err := s.store.MuteConversation(ctx, username, peer, d)
+	if err != nil {
+		c.Error(apperr.New(apperr.Internal, "Failed to mute conversation"))
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"mute": mute})
+}
+
+// unmuteHandler lifts the authenticated user's mute of their conversation
+// with the user in the path.
+func (s *Server) unmuteHandler(c *gin.Context) {
+	removed, err := s.store.UnmuteConversation(c.Request.Context(), auth.CurrentUser(c), c.Param("username"))
+	if err != nil {
+		c.Error(apperr.New(apperr.Internal, "Failed to unmute conversation"))
+		return
+	}
+	if !removed {
+		c.Error(apperr.New(apperr.NotFound, "Conversation is not muted"))
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": s.tr(c, "Conversation unmuted successfully")})
+}
+
+// vapidKeyHandler returns the public key browsers need to subscribe to Web Push.
+func (s *Server) vapidKeyHandler(c *gin.Context) {
+	if s.vapidPublicKey == "" {
+		c.Error(apperr.New(apperr.NotFound, "Web Push is not configured"))
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"public_key": s.vapidPublicKey})
+}
@@ -0,0 +1,111 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"backend/apperr"
+	"backend/auth"
+	"backend/store"
+	"backend/ws"
+
+	"github.com/gin-gonic/gin"
+)
+
+// maxMessageTTL is the longest disappearing messages may last.
+const maxMessageTTL = 4 * 7 * 24 * time.Hour
+
+// DeletedEvent tells a participant that messages of their conversation were
+// deleted, so clients remove them.
+type DeletedEvent struct {
+	MessageIDs []string `json:"message_ids"`
+}
+
+// getDisappearingHandler returns how long messages between the authenticated
+// user and the user in the path last, 0 if they do not disappear.
+func (s *Server) getDisappearingHandler(c *gin.Context) {
+	ttl, err := s.store.MessageTTL(c.Request.Context(), auth.CurrentUser(c), c.Param("username"))
+	if err != nil {
+		c.Error(apperr.New(apperr.Internal, "Failed to fetch disappearing messages setting"))
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"ttl_seconds": int(ttl / time.Second)})
+}
+
+// updateDisappearingHandler turns disappearing messages on, or off with a
+// ttl_seconds of 0, for the conversation with the user in the path. Either
+// participant may change it, and it applies to messages sent from then on.
+// A change is recorded in the conversation with a system message.
+func (s *Server) updateDisappearingHandler(c *gin.Context) {
+	ctx := c.Request.Context()
+	username := auth.CurrentUser(c)
+	peer := c.Param("username")
+
+	var req struct {
+		TTLSeconds int `json:"ttl_seconds"`
+	}
+	if err := c.BindJSON(&req); err != nil {
+		c.Error(apperr.New(apperr.InvalidRequest, "Invalid request payload"))
+		return
+	}
+	ttl := time.Duration(req.TTLSeconds) * time.Second
+	if ttl < 0 || ttl > maxMessageTTL {
+		c.Error(apperr.New(apperr.InvalidRequest, "ttl_seconds must be between 0 and 2419200"))
+		return
+	}
+
+	exists, err := s.store.UserExists(ctx, peer)
+	if err != nil {
+		c.Error(apperr.New(apperr.Internal, "Failed to fetch user"))
+		return
+	}
+	if !exists || peer == username {
+		c.Error(apperr.New(apperr.UserNotFound, "User not found"))
+		return
+	}
+
+	previous, err := s.store.MessageTTL(ctx, username, peer)
+	if err != nil {
+		c.Error(apperr.New(apperr.Internal, "Failed to fetch disappearing messages setting"))
+		return
+	}
+	if err := s.store.SetMessageTTL(ctx, username, peer, ttl); err != nil {
+		c.Error(apperr.New(apperr.Internal, "Failed to update disappearing messages setting"))
+		return
+	}
+	if ttl != previous {
+		s.postSystemMessage(ctx, username, peer, store.SystemEvent{Event: store.SystemDisappearingChanged, TTLSeconds: &req.TTLSeconds})
+	}
+
+	c.JSON(http.StatusOK, gin.H{"ttl_seconds": req.TTLSeconds})
+}
+
+// afterExpired drops deleted messages from the cache and tells both
+// participants of each conversation to remove them.
+func (s *Server) afterExpired(ctx context.Context, expired []store.ExpiredMessage) {
+	type conversation struct{ sender, receiver string }
+	byConversation := map[conversation][]string{}
+	for _, m := range expired {
+		k := conversation{m.Sender, m.Receiver}
+		byConversation[k] = append(byConversation[k], m.ID)
+	}
+
+	for k, ids := range byConversation {
+		s.cache.Invalidate(ctx, k.sender, k.receiver)
+		s.cache.Invalidate(ctx, k.receiver, k.sender)
+		s.publishEvent(ws.Event{Type: ws.TypeDeleted, Payload: DeletedEvent{MessageIDs: ids}}, k.sender, k.receiver)
+	}
+}
+
+// RunReaper deletes disappearing messages as they expire until ctx is done.
+func (s *Server) RunReaper(ctx context.Context) {
+	s.reaper.Run(ctx)
+}
+
+// RunRetention creates message partitions ahead of time and removes the
+// messages older than the retention period until ctx is done.
+func (s *Server) RunRetention(ctx context.Context) {
+	s.retention.Run(ctx)
+}
@@ -0,0 +1,118 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"backend/apperr"
+	"backend/auth"
+	"backend/ws"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-redis/redis/v8"
+)
+
+const (
+	// draftTTL is how long an untouched draft is kept.
+	draftTTL = 30 * 24 * time.Hour
+	// maxDraftBytes caps the size of a draft.
+	maxDraftBytes = 16 << 10
+)
+
+// Draft is an unsent message a user is composing in a conversation.
+type Draft struct {
+	Receiver  string    `json:"receiver"`
+	Content   string    `json:"content"`
+	ReplyToID *string   `json:"reply_to_id,omitempty"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// draftKey returns the Redis key of username's draft to peer.
+func draftKey(username, peer string) string {
+	return fmt.Sprintf("draft:%s:%s", username, peer)
+}
+
+// getDraftHandler returns the authenticated user's draft for the
+// conversation with the user in the path, or 404 if there is none.
+func (s *Server) getDraftHandler(c *gin.Context) {
+	payload, err := s.rdb.Get(c.Request.Context(), draftKey(auth.CurrentUser(c), c.Param("username"))).Result()
+	if err == redis.Nil {
+		c.Error(apperr.New(apperr.NotFound, "Draft not found"))
+		return
+	}
+	if err != nil {
+		c.Error(apperr.New(apperr.Internal, "Failed to fetch draft"))
+		return
+	}
+
+	var draft Draft
+	if err := json.Unmarshal([]byte(payload), &draft); err != nil {
+		c.Error(apperr.New(apperr.Internal, "Failed to fetch draft"))
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"draft": draft})
+}
+
+// saveDraftHandler saves the authenticated user's draft for the conversation
+// with the user in the path, replacing the previous one. Their other
+// connected devices receive it as a draft event. An empty draft is deleted.
+func (s *Server) saveDraftHandler(c *gin.Context) {
+	ctx := c.Request.Context()
+	username := auth.CurrentUser(c)
+	peer := c.Param("username")
+
+	var req struct {
+		Content   string  `json:"content"`
+		ReplyToID *string `json:"reply_to_id"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.Error(apperr.New(apperr.InvalidRequest, "Invalid request payload"))
+		return
+	}
+	if len(req.Content) > maxDraftBytes {
+		c.Error(apperr.Newf(apperr.TooLarge, "Draft exceeds the %d byte limit", maxDraftBytes))
+		return
+	}
+	if req.ReplyToID != nil && *req.ReplyToID == "" {
+		req.ReplyToID = nil
+	}
+
+	draft := Draft{Receiver: peer, Content: req.Content, ReplyToID: req.ReplyToID, UpdatedAt: time.Now().UTC()}
+	if draft.Content == "" && draft.ReplyToID == nil {
+		if err := s.rdb.Del(ctx, draftKey(username, peer)).Err(); err != nil {
+			c.Error(apperr.New(apperr.Internal, "Failed to delete draft"))
+			return
+		}
+	} else {
+		payload, err := json.Marshal(draft)
+		if err != nil {
+			c.Error(apperr.New(apperr.Internal, "Failed to save draft"))
+			return
+		}
+		if err := s.rdb.Set(ctx, draftKey(username, peer), payload, draftTTL).Err(); err != nil {
+			c.Error(apperr.New(apperr.Internal, "Failed to save draft"))
+			return
+		}
+	}
+
+	s.publishEvent(ws.Event{Type: ws.TypeDraft, Payload: draft}, username)
+	c.JSON(http.StatusOK, gin.H{"draft": draft})
+}
+
+// deleteDraftHandler discards the authenticated user's draft for the
+// conversation with the user in the path.
+func (s *Server) deleteDraftHandler(c *gin.Context) {
+	username := auth.CurrentUser(c)
+	peer := c.Param("username")
+
+	if err := s.rdb.Del(c.Request.Context(), draftKey(username, peer)).Err(); err != nil {
+		c.Error(apperr.New(apperr.Internal, "Failed to delete draft"))
+		return
+	}
+
+	s.publishEvent(ws.Event{Type: ws.TypeDraft, Payload: Draft{Receiver: peer, UpdatedAt: time.Now().UTC()}}, username)
+	c.JSON(http.StatusOK, gin.H{"message": s.tr(c, "Draft deleted")})
+}
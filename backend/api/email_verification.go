@@ -0,0 +1,142 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"time"
+
+	"backend/apperr"
+	"backend/auth"
+	"backend/store"
+
+	"github.com/gin-gonic/gin"
+)
+
+// emailVerificationTTL is how long an email verification link can be used.
+const emailVerificationTTL = 24 * time.Hour
+
+// emailVerificationCooldown is how long after a verification email another
+// one can be sent to the same address, so resending cannot flood a mailbox.
+const emailVerificationCooldown = time.Minute
+
+// emailVerificationKey returns the Redis key of a verification token, whose
+// value is the email it verifies. Only the token hash is stored.
+func emailVerificationKey(token string) string {
+	return fmt.Sprintf("email_verification:%s", auth.HashToken(token))
+}
+
+// emailVerificationSentKey returns the Redis key marking that a verification
+// email was just sent to email.
+func emailVerificationSentKey(email string) string {
+	return fmt.Sprintf("email_verification_sent:%s", auth.HashToken(email))
+}
+
+// sendVerificationEmail emails username a single-use link verifying email,
+// unless one was sent to it within emailVerificationCooldown.
+func (s *Server) sendVerificationEmail(ctx context.Context, username, email string) error {
+	first, err := s.rdb.SetNX(ctx, emailVerificationSentKey(email), 1, emailVerificationCooldown).Result()
+	if err != nil {
+		return err
+	}
+	if !first {
+		return nil
+	}
+
+	token, err := auth.NewOpaqueToken()
+	if err != nil {
+		return err
+	}
+	if err := s.rdb.Set(ctx, emailVerificationKey(token), email, emailVerificationTTL).Err(); err != nil {
+		return err
+	}
+
+	link := fmt.Sprintf("%s/email/verify?token=%s", s.appURL, url.QueryEscape(token))
+	body := fmt.Sprintf("Hi %s,\n\nUse the link below to verify your email address. It expires in %s.\n\n%s\n\nIf you did not sign up, you can ignore this email.",
+		username, emailVerificationTTL, link)
+	return s.email.Send(email, "Verify your email address", body)
+}
+
+// verifyEmailHandler marks an email verified using the token emailed to it.
+// The token is consumed on first use, and fails if the email was changed
+// since it was sent.
+func (s *Server) verifyEmailHandler(c *gin.Context) {
+	ctx := c.Request.Context()
+
+	var req struct {
+		Token string `json:"token"`
+	}
+
+	if err := c.ShouldBindJSON(&req); err != nil || req.Token == "" {
+		c.Error(apperr.New(apperr.InvalidRequest, "Invalid request payload"))
+		return
+	}
+
+	email, err := s.rdb.GetDel(ctx, emailVerificationKey(req.Token)).Result()
+	if err != nil {
+		c.Error(apperr.New(apperr.InvalidVerifyToken, "Invalid or expired verification token"))
+		return
+	}
+
+	username, err := s.store.VerifyEmail(ctx, email)
+	if errors.Is(err, store.ErrNotFound) {
+		c.Error(apperr.New(apperr.InvalidVerifyToken, "Invalid or expired verification token"))
+		return
+	}
+	if err != nil {
+		c.Error(apperr.New(apperr.Internal, "Failed to verify email"))
+		return
+	}
+	s.audit(ctx, store.AuditEntry{Action: auditEmailVerified, Actor: username, Target: username})
+
+	c.JSON(http.StatusOK, gin.H{"message": s.tr(c, "Email verified successfully")})
+}
+
+// resendVerificationHandler emails a new verification link to the account
+// with the given email, if it is not verified yet. The response is the same
+// whether or not the account exists, so it cannot be used to discover
+// registered emails.
+func (s *Server) resendVerificationHandler(c *gin.Context) {
+	ctx := c.Request.Context()
+
+	var req struct {
+		Email string `json:"email"`
+	}
+
+	if err := c.ShouldBindJSON(&req); err != nil || req.Email == "" {
+		c.Error(apperr.New(apperr.InvalidRequest, "Invalid request payload"))
+		return
+	}
+
+	response := gin.H{"message": s.tr(c, "If an unverified account with that email exists, a verification link has been sent")}
+
+	username, err := s.store.UsernameByEmail(ctx, req.Email)
+	if err != nil {
+		c.JSON(http.StatusOK, response)
+		return
+	}
+	if _, verified, err := s.store.EmailStatus(ctx, username); err != nil || verified {
+		c.JSON(http.StatusOK, response)
+		return
+	}
+
+	if err := s.sendVerificationEmail(ctx, username, req.Email); err != nil {
+		log.Printf("Error sending verification email to %s: %v", username, err)
+	}
+
+	c.JSON(http.StatusOK, response)
+}
+
+// trustEmail marks an email set through the provisioning API verified,
+// since the identity provider vouches for it.
+func (s *Server) trustEmail(ctx context.Context, email string) {
+	if email == "" {
+		return
+	}
+	if _, err := s.store.VerifyEmail(ctx, email); err != nil {
+		log.Printf("Error verifying provisioned email: %v", err)
+	}
+}
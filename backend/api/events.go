@@ -0,0 +1,181 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"time"
+
+	"backend/apperr"
+	"backend/store"
+	"backend/ws"
+)
+
+// eventChannel is the pub/sub channel carrying typed events for a set
+// of users, such as typing indicators and read receipts.
+const eventChannel = "chat:events"
+
+// ErrorEvent reports a rejected WebSocket frame to the client that sent it.
+type ErrorEvent struct {
+	Type       string      `json:"type"`
+	Code       apperr.Code `json:"code"`
+	Error      string      `json:"error"`
+	RetryAfter int         `json:"retry_after,omitempty"`
+	Reasons    []string    `json:"reasons,omitempty"`
+	// Seq is the seq of the client frame that caused the error, if it set one.
+	Seq uint64 `json:"seq,omitempty"`
+}
+
+// TypingEvent tells a user that their peer started or stopped typing.
+type TypingEvent struct {
+	Sender   string `json:"sender"`
+	Receiver string `json:"receiver"`
+	Typing   bool   `json:"typing"`
+}
+
+// ReadReceiptEvent tells both participants that messages were read.
+type ReadReceiptEvent struct {
+	MessageIDs []string  `json:"message_ids"`
+	Reader     string    `json:"reader"`
+	ReadAt     time.Time `json:"read_at"`
+}
+
+// ReactionEvent carries the new vote totals of a message.
+type ReactionEvent struct {
+	MessageID string `json:"message_id"`
+	Upvotes   int    `json:"upvotes"`
+	Downvotes int    `json:"downvotes"`
+}
+
+// eventMessage is the Pub/Sub payload of a typed event and its recipients.
+type eventMessage struct {
+	Event      ws.Event `json:"event"`
+	Recipients []string `json:"recipients"`
+}
+
+// publishEvent sends an event to the given users on every instance. If the
+// bus is unavailable the event is still delivered to local clients.
+func (s *Server) publishEvent(event ws.Event, recipients ...string) {
+	payload, err := json.Marshal(eventMessage{Event: event, Recipients: recipients})
+	if err != nil {
+		log.Printf("Error encoding %s event: %v", event.Type, err)
+		return
+	}
+
+	if err := s.bus.Publish(context.Background(), eventChannel, payload); err != nil {
+		log.Printf("Publish error for %s event, delivering locally: %v", event.Type, err)
+		for _, recipient := range recipients {
+			s.hub.SendToUser(recipient, event)
+		}
+	}
+}
+
+// deliverEvent sends a published event to its locally connected recipients.
+func (s *Server) deliverEvent(payload string) {
+	var em eventMessage
+	if err := json.Unmarshal([]byte(payload), &em); err != nil {
+		log.Printf("Error decoding event: %v", err)
+		return
+	}
+
+	for _, recipient := range em.Recipients {
+		s.hub.SendToUser(recipient, em.Event)
+	}
+}
+
+// sendError reports an error to a single client in answer to its frame seq.
+func (s *Server) sendError(client *ws.Client, seq uint64, e *apperr.Error) {
+	s.sendErrorEvent(client, seq, ErrorEvent{Code: e.Code, Error: e.Message, Reasons: e.Reasons})
+}
+
+// sendErrorEvent sends an error event to a single client in answer to its
+// frame seq.
+func (s *Server) sendErrorEvent(client *ws.Client, seq uint64, event ErrorEvent) {
+	event.Type = ws.TypeError
+	event.Seq = seq
+	s.hub.SendToClient(client, ws.Event{Type: ws.TypeError, Payload: event})
+}
+
+// handleTyping relays a typing indicator to its receiver.
+func (s *Server) handleTyping(ctx context.Context, client *ws.Client, env ws.Envelope) {
+	var req struct {
+		Receiver string `json:"receiver"`
+		Typing   bool   `json:"typing"`
+	}
+	if err := json.Unmarshal(env.Payload, &req); err != nil || req.Receiver == "" {
+		s.sendError(client, env.Seq, apperr.New(apperr.InvalidRequest, "Invalid typing event"))
+		return
+	}
+	s.relayTyping(ctx, client.UserID, req.Receiver, req.Typing)
+}
+
+// relayTyping tells receiver that sender started or stopped typing, unless
+// either blocked the other or sender is shadow-muted.
+func (s *Server) relayTyping(ctx context.Context, sender, receiver string, typing bool) {
+	if blocked, err := s.store.IsBlocked(ctx, sender, receiver); err != nil || blocked {
+		return
+	}
+	if muted, err := s.store.ShadowMuted(ctx, sender, ""); err != nil || muted {
+		return
+	}
+
+	s.publishEvent(ws.Event{
+		Type:    ws.TypeTyping,
+		Payload: TypingEvent{Sender: sender, Receiver: receiver, Typing: typing},
+	}, receiver)
+}
+
+// handleReadReceipt marks a message and everything before it as read by the
+// client's user.
+func (s *Server) handleReadReceipt(ctx context.Context, client *ws.Client, env ws.Envelope) {
+	var req struct {
+		ID string `json:"id"`
+	}
+	if err := json.Unmarshal(env.Payload, &req); err != nil || req.ID == "" {
+		s.sendError(client, env.Seq, apperr.New(apperr.InvalidRequest, "Invalid read receipt"))
+		return
+	}
+
+	if err := s.markRead(ctx, req.ID, client.UserID); errors.Is(err, store.ErrNotFound) {
+		s.sendError(client, env.Seq, apperr.New(apperr.MessageNotFound, "Message not found"))
+	} else if err != nil {
+		log.Printf("Error marking message %s read: %v", req.ID, err)
+		s.sendError(client, env.Seq, apperr.New(apperr.Internal, "Failed to update message status"))
+	}
+}
+
+// markRead marks a message and every earlier unread message of its
+// conversation as read by reader, then tells both participants.
+func (s *Server) markRead(ctx context.Context, messageID, reader string) error {
+	updated, err := s.store.MarkReadUpTo(ctx, messageID, reader)
+	if err != nil {
+		return err
+	}
+	if len(updated) == 0 {
+		return nil
+	}
+
+	sender, _, err := s.store.Participants(ctx, messageID)
+	if err != nil {
+		log.Printf("Error fetching participants of message %s: %v", messageID, err)
+		for _, id := range updated {
+			s.broadcastMessageByID(ctx, id)
+		}
+		return nil
+	}
+	s.announceRead(ctx, updated, sender, reader)
+	return nil
+}
+
+// announceRead pushes the messages from sender that reader just read to
+// both participants, and sends them a read receipt.
+func (s *Server) announceRead(ctx context.Context, updated []string, sender, reader string) {
+	for _, id := range updated {
+		s.broadcastMessageByID(ctx, id)
+	}
+	s.publishEvent(ws.Event{
+		Type:    ws.TypeReadReceipt,
+		Payload: ReadReceiptEvent{MessageIDs: updated, Reader: reader, ReadAt: time.Now().UTC()},
+	}, sender, reader)
+}
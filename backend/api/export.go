@@ -0,0 +1,126 @@
+package api
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"backend/apperr"
+	"backend/auth"
+	"backend/store"
+
+	"github.com/gin-gonic/gin"
+)
+
+// exportFlushEvery is how many messages are written between flushes, so an
+// export reaches the client in chunks as it is read.
+const exportFlushEvery = 500
+
+// csvHeader names the columns of a CSV export.
+var csvHeader = []string{"id", "sender", "receiver", "content", "status", "upvotes", "downvotes", "deleted", "reply_to_id", "created_at", "updated_at", "kind"}
+
+// exportHandler streams the authenticated user's whole conversation with the
+// user in the path as a JSON array or CSV (?format=json|csv), oldest first.
+// Messages are written as they are read rather than loaded at once.
+func (s *Server) exportHandler(c *gin.Context) {
+	username := auth.CurrentUser(c)
+	peer := c.Param("username")
+	format := c.DefaultQuery("format", "json")
+	if format != "json" && format != "csv" {
+		c.Error(apperr.New(apperr.InvalidRequest, "Format must be json or csv"))
+		return
+	}
+
+	filename := fmt.Sprintf("conversation-%s-%s.%s", username, peer, format)
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename))
+
+	var err error
+	if format == "csv" {
+		err = s.exportCSV(c, username, peer)
+	} else {
+		err = s.exportJSON(c, username, peer)
+	}
+	// Once streaming started the status is sent, so a failure can only
+	// cut the export short.
+	if err != nil {
+		log.Printf("Error exporting conversation of %s with %s: %v", username, peer, err)
+	}
+}
+
+// exportJSON writes the conversation as a JSON array.
+func (s *Server) exportJSON(c *gin.Context, username, peer string) error {
+	c.Header("Content-Type", "application/json")
+	c.Status(http.StatusOK)
+
+	w := c.Writer
+	enc := json.NewEncoder(w)
+	if _, err := w.WriteString("["); err != nil {
+		return err
+	}
+
+	n := 0
+	err := s.store.EachMessage(c.Request.Context(), username, peer, func(msg store.Message) error {
+		if n > 0 {
+			if _, err := w.WriteString(","); err != nil {
+				return err
+			}
+		}
+		if err := enc.Encode(msg); err != nil {
+			return err
+		}
+		n++
+		if n%exportFlushEvery == 0 {
+			w.Flush()
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	_, err = w.WriteString("]\n")
+	return err
+}
+
+// exportCSV writes the conversation as CSV with a header row.
+func (s *Server) exportCSV(c *gin.Context, username, peer string) error {
+	c.Header("Content-Type", "text/csv; charset=utf-8")
+	c.Status(http.StatusOK)
+
+	w := csv.NewWriter(c.Writer)
+	if err := w.Write(csvHeader); err != nil {
+		return err
+	}
+
+	n := 0
+	err := s.store.EachMessage(c.Request.Context(), username, peer, func(msg store.Message) error {
+		replyToID := ""
+		if msg.ReplyToID != nil {
+			replyToID = *msg.ReplyToID
+		}
+		err := w.Write([]string{
+			msg.ID, msg.Sender, msg.Receiver, msg.Content, msg.Status,
+			strconv.Itoa(msg.Upvotes), strconv.Itoa(msg.Downvotes), strconv.FormatBool(msg.Deleted), replyToID,
+			msg.CreatedAt.Format(time.RFC3339), msg.UpdatedAt.Format(time.RFC3339), msg.Kind,
+		})
+		if err != nil {
+			return err
+		}
+		n++
+		if n%exportFlushEvery == 0 {
+			w.Flush()
+			c.Writer.Flush()
+		}
+		return w.Error()
+	})
+	if err != nil {
+		return err
+	}
+
+	w.Flush()
+	return w.Error()
+}
@@ -0,0 +1,584 @@
+package api
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+
+	"backend/apperr"
+	"backend/auth"
+	"backend/store"
+	"backend/ws"
+
+	"github.com/gin-gonic/gin"
+	"github.com/graph-gophers/graphql-go"
+)
+
+// graphQLSchema is the schema served at /graphql. Conversations are paged
+// backwards from the latest message, following the Relay connection spec.
+const graphQLSchema = `
+schema {
+	query: Query
+	subscription: Subscription
+}
+
+scalar Time
+
+type Query {
+	me: User!
+	# Every other user the caller may message.
+	users: [User!]!
+	user(username: String!): User
+	# The conversations the caller took part in.
+	conversations: [Conversation!]!
+	conversation(peer: String!): Conversation!
+}
+
+type Subscription {
+	# Messages sent to or by the caller, only those exchanged with peer if set.
+	messageAdded(peer: String): Message!
+}
+
+type User {
+	username: String!
+	online: Boolean!
+	# When the user last disconnected, null while online.
+	lastSeen: Time
+	status: UserStatus!
+}
+
+type UserStatus {
+	# available, busy or dnd.
+	availability: String!
+	text: String!
+	emoji: String!
+	# When the status reverts to available, null if it lasts until changed.
+	expiresAt: Time
+}
+
+type Conversation {
+	peer: User!
+	# The last messages before the cursor before, oldest first.
+	messages(last: Int = 50, before: String): MessageConnection!
+}
+
+type MessageConnection {
+	edges: [MessageEdge!]!
+	pageInfo: PageInfo!
+}
+
+type MessageEdge {
+	cursor: String!
+	node: Message!
+}
+
+type PageInfo {
+	hasPreviousPage: Boolean!
+	hasNextPage: Boolean!
+	startCursor: String
+	endCursor: String
+}
+
+type Message {
+	id: ID!
+	sender: String!
+	receiver: String!
+	content: String!
+	# plain or markdown. html is content rendered with only safe tags, set
+	# for markdown messages.
+	format: String!
+	html: String
+	upvotes: Int!
+	downvotes: Int!
+	status: String!
+	deleted: Boolean!
+	# user, or system for notices the server adds, described by system.
+	kind: String!
+	system: SystemEvent
+	createdAt: Time!
+	updatedAt: Time!
+	expiresAt: Time
+	attachments: [Attachment!]!
+	mentions: [String!]!
+	replyTo: ReplyPreview
+}
+
+type SystemEvent {
+	# username_changed, message_pinned or disappearing_changed.
+	event: String!
+	messageId: ID
+	oldUsername: String
+	ttlSeconds: Int
+}
+
+type Attachment {
+	id: ID!
+	filename: String!
+	contentType: String!
+	size: Int!
+	url: String!
+	mediaStatus: String
+	width: Int
+	height: Int
+	thumbnailUrl: String
+}
+
+type ReplyPreview {
+	id: ID!
+	sender: String!
+	content: String!
+	deleted: Boolean!
+}
+`
+
+// maxPageSize caps the last argument of a message connection.
+const maxPageSize = 100
+
+// graphQLRequest is the body of a GraphQL operation.
+type graphQLRequest struct {
+	Query         string                 `json:"query"`
+	OperationName string                 `json:"operationName"`
+	Variables     map[string]interface{} `json:"variables"`
+}
+
+// newGraphQLSchema parses graphQLSchema with resolvers backed by s.
+func newGraphQLSchema(s *Server) *graphql.Schema {
+	return graphql.MustParseSchema(graphQLSchema, &graphQLRoot{s: s}, graphql.MaxDepth(10))
+}
+
+// graphQLHandler executes queries posted as JSON. Subscriptions are served
+// over a WebSocket by graphQLWSHandler.
+func (s *Server) graphQLHandler(c *gin.Context) {
+	var req graphQLRequest
+	if err := c.ShouldBindJSON(&req); err != nil || req.Query == "" {
+		c.Error(apperr.New(apperr.InvalidRequest, "Invalid request body"))
+		return
+	}
+
+	ctx := withUser(c.Request.Context(), auth.CurrentUser(c))
+	c.JSON(http.StatusOK, s.graphql.Exec(ctx, req.Query, req.OperationName, req.Variables))
+}
+
+// graphQLError reports an API error with its code in the extensions of a
+// GraphQL error.
+type graphQLError struct {
+	err *apperr.Error
+}
+
+func (e graphQLError) Error() string {
+	return e.err.Message
+}
+
+func (e graphQLError) Extensions() map[string]interface{} {
+	ext := map[string]interface{}{"code": e.err.Code}
+	if len(e.err.Reasons) > 0 {
+		ext["reasons"] = e.err.Reasons
+	}
+	return ext
+}
+
+// graphQLRoot resolves the fields of Query and Subscription.
+type graphQLRoot struct {
+	s *Server
+}
+
+func (r *graphQLRoot) Me(ctx context.Context) *userResolver {
+	return &userResolver{s: r.s, username: contextUser(ctx)}
+}
+
+func (r *graphQLRoot) Users(ctx context.Context) ([]*userResolver, error) {
+	users, err := r.s.store.ListUsers(ctx, contextUser(ctx))
+	if err != nil {
+		log.Printf("Error fetching users: %v", err)
+		return nil, graphQLError{apperr.New(apperr.Internal, "Failed to fetch users")}
+	}
+	return r.s.userResolvers(users), nil
+}
+
+func (r *graphQLRoot) User(ctx context.Context, args struct{ Username string }) (*userResolver, error) {
+	exists, err := r.s.store.UserExists(ctx, args.Username)
+	if err != nil {
+		log.Printf("Error checking user %s: %v", args.Username, err)
+		return nil, graphQLError{apperr.New(apperr.Internal, "Failed to fetch user")}
+	}
+	if !exists {
+		return nil, nil
+	}
+	return &userResolver{s: r.s, username: args.Username}, nil
+}
+
+func (r *graphQLRoot) Conversations(ctx context.Context) ([]*conversationResolver, error) {
+	viewer := contextUser(ctx)
+	contacts, err := r.s.store.Contacts(ctx, viewer)
+	if err != nil {
+		log.Printf("Error fetching contacts of %s: %v", viewer, err)
+		return nil, graphQLError{apperr.New(apperr.Internal, "Failed to fetch conversations")}
+	}
+
+	conversations := make([]*conversationResolver, len(contacts))
+	for i, peer := range contacts {
+		conversations[i] = &conversationResolver{s: r.s, viewer: viewer, peer: peer}
+	}
+	return conversations, nil
+}
+
+func (r *graphQLRoot) Conversation(ctx context.Context, args struct{ Peer string }) *conversationResolver {
+	return &conversationResolver{s: r.s, viewer: contextUser(ctx), peer: args.Peer}
+}
+
+// MessageAdded streams the new messages the hub delivers to the caller for
+// as long as the subscription lasts. Unlike the WebSocket and gRPC streams,
+// it does not mark them delivered.
+func (r *graphQLRoot) MessageAdded(ctx context.Context, args struct{ Peer *string }) (<-chan *messageResolver, error) {
+	username := contextUser(ctx)
+	client := ws.NewStreamClient(username)
+	r.s.registerClient(client)
+
+	out := make(chan *messageResolver)
+	go r.s.hub.Track(func() {
+		defer close(out)
+		defer r.s.unregisterClient(client)
+
+		for {
+			select {
+			case event, ok := <-client.Events():
+				if !ok {
+					return
+				}
+				msg, ok := event.Payload.(store.Message)
+				if !ok || !isNewMessage(msg) {
+					continue
+				}
+				if args.Peer != nil && msg.Sender != *args.Peer && msg.Receiver != *args.Peer {
+					continue
+				}
+				select {
+				case out <- &messageResolver{msg: msg}:
+				case <-ctx.Done():
+					return
+				}
+			case <-ctx.Done():
+				return
+			}
+		}
+	})
+	return out, nil
+}
+
+// isNewMessage reports whether a delivered message was just sent, rather than
+// an update of its status, votes or deletion.
+func isNewMessage(msg store.Message) bool {
+	return msg.Status == store.StatusSent && msg.UpdatedAt.Equal(msg.CreatedAt)
+}
+
+// userResolvers resolves a list of usernames.
+func (s *Server) userResolvers(usernames []string) []*userResolver {
+	users := make([]*userResolver, len(usernames))
+	for i, username := range usernames {
+		users[i] = &userResolver{s: s, username: username}
+	}
+	return users
+}
+
+// userResolver resolves a User.
+type userResolver struct {
+	s        *Server
+	username string
+}
+
+func (u *userResolver) Username() string {
+	return u.username
+}
+
+func (u *userResolver) Online(ctx context.Context) (bool, error) {
+	online, err := u.s.rdb.Exists(ctx, presenceKey(u.username)).Result()
+	if err != nil {
+		return false, graphQLError{apperr.New(apperr.Internal, "Failed to fetch presence")}
+	}
+	return online > 0, nil
+}
+
+func (u *userResolver) LastSeen(ctx context.Context) (*graphql.Time, error) {
+	online, err := u.Online(ctx)
+	if err != nil || online {
+		return nil, err
+	}
+
+	lastSeen, err := u.s.store.LastSeen(ctx, u.username)
+	if errors.Is(err, store.ErrNotFound) || lastSeen == nil {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, graphQLError{apperr.New(apperr.Internal, "Failed to fetch presence")}
+	}
+	return &graphql.Time{Time: *lastSeen}, nil
+}
+
+func (u *userResolver) Status(ctx context.Context) (*userStatusResolver, error) {
+	status, err := u.s.store.UserStatus(ctx, u.username)
+	if err != nil {
+		return nil, graphQLError{apperr.New(apperr.Internal, "Failed to fetch status")}
+	}
+	return &userStatusResolver{status}, nil
+}
+
+// userStatusResolver resolves a UserStatus.
+type userStatusResolver struct {
+	status store.UserStatus
+}
+
+func (r *userStatusResolver) Availability() string { return r.status.Availability }
+func (r *userStatusResolver) Text() string         { return r.status.Text }
+func (r *userStatusResolver) Emoji() string        { return r.status.Emoji }
+
+func (r *userStatusResolver) ExpiresAt() *graphql.Time {
+	if r.status.ExpiresAt == nil {
+		return nil
+	}
+	return &graphql.Time{Time: *r.status.ExpiresAt}
+}
+
+// conversationResolver resolves a Conversation of viewer with peer.
+type conversationResolver struct {
+	s      *Server
+	viewer string
+	peer   string
+}
+
+func (c *conversationResolver) Peer() *userResolver {
+	return &userResolver{s: c.s, username: c.peer}
+}
+
+func (c *conversationResolver) Messages(ctx context.Context, args struct {
+	Last   int32
+	Before *string
+}) (*messageConnection, error) {
+	if args.Last <= 0 || args.Last > maxPageSize {
+		return nil, graphQLError{apperr.New(apperr.InvalidRequest, "Invalid last, expected 1 to 100")}
+	}
+	var before string
+	if args.Before != nil {
+		var ok bool
+		if before, ok = decodeCursor(*args.Before); !ok {
+			return nil, graphQLError{apperr.New(apperr.InvalidRequest, "Invalid cursor")}
+		}
+	}
+
+	// Fetch one extra message to tell whether there are older ones.
+	messages, err := c.s.store.MessagesBefore(ctx, c.viewer, c.peer, before, int(args.Last)+1)
+	if err != nil {
+		log.Printf("Error fetching conversation of %s with %s: %v", c.viewer, c.peer, err)
+		return nil, graphQLError{apperr.New(apperr.Internal, "Failed to fetch messages")}
+	}
+
+	conn := &messageConnection{pageInfo: pageInfoResolver{hasNextPage: before != ""}}
+	if len(messages) > int(args.Last) {
+		messages = messages[1:]
+		conn.pageInfo.hasPreviousPage = true
+	}
+	for _, msg := range messages {
+		conn.edges = append(conn.edges, &messageEdge{msg: msg})
+	}
+	if len(messages) > 0 {
+		start := encodeCursor(messages[0].ID)
+		end := encodeCursor(messages[len(messages)-1].ID)
+		conn.pageInfo.startCursor, conn.pageInfo.endCursor = &start, &end
+	}
+	return conn, nil
+}
+
+// encodeCursor returns the opaque cursor of a message.
+func encodeCursor(id string) string {
+	return base64.RawURLEncoding.EncodeToString([]byte("message:" + id))
+}
+
+// decodeCursor returns the message ID of a cursor made by encodeCursor.
+func decodeCursor(cursor string) (string, bool) {
+	raw, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil || len(raw) <= len("message:") || string(raw[:len("message:")]) != "message:" {
+		return "", false
+	}
+	id := string(raw[len("message:"):])
+	if _, err := strconv.Atoi(id); err != nil {
+		return "", false
+	}
+	return id, true
+}
+
+// messageConnection resolves a MessageConnection.
+type messageConnection struct {
+	edges    []*messageEdge
+	pageInfo pageInfoResolver
+}
+
+func (c *messageConnection) Edges() []*messageEdge {
+	return c.edges
+}
+
+func (c *messageConnection) PageInfo() *pageInfoResolver {
+	return &c.pageInfo
+}
+
+// messageEdge resolves a MessageEdge.
+type messageEdge struct {
+	msg store.Message
+}
+
+func (e *messageEdge) Cursor() string {
+	return encodeCursor(e.msg.ID)
+}
+
+func (e *messageEdge) Node() *messageResolver {
+	return &messageResolver{msg: e.msg}
+}
+
+// pageInfoResolver resolves a PageInfo.
+type pageInfoResolver struct {
+	hasPreviousPage bool
+	hasNextPage     bool
+	startCursor     *string
+	endCursor       *string
+}
+
+func (p *pageInfoResolver) HasPreviousPage() bool { return p.hasPreviousPage }
+func (p *pageInfoResolver) HasNextPage() bool     { return p.hasNextPage }
+func (p *pageInfoResolver) StartCursor() *string  { return p.startCursor }
+func (p *pageInfoResolver) EndCursor() *string    { return p.endCursor }
+
+// messageResolver resolves a Message.
+type messageResolver struct {
+	msg store.Message
+}
+
+func (m *messageResolver) ID() graphql.ID          { return graphql.ID(m.msg.ID) }
+func (m *messageResolver) Sender() string          { return m.msg.Sender }
+func (m *messageResolver) Receiver() string        { return m.msg.Receiver }
+func (m *messageResolver) Content() string         { return m.msg.Content }
+func (m *messageResolver) Format() string          { return m.msg.Format }
+func (m *messageResolver) Upvotes() int32          { return int32(m.msg.Upvotes) }
+func (m *messageResolver) Downvotes() int32        { return int32(m.msg.Downvotes) }
+func (m *messageResolver) Status() string          { return m.msg.Status }
+func (m *messageResolver) Deleted() bool           { return m.msg.Deleted }
+func (m *messageResolver) Kind() string            { return m.msg.Kind }
+func (m *messageResolver) CreatedAt() graphql.Time { return graphql.Time{Time: m.msg.CreatedAt} }
+func (m *messageResolver) UpdatedAt() graphql.Time { return graphql.Time{Time: m.msg.UpdatedAt} }
+func (m *messageResolver) Mentions() []string      { return m.msg.Mentions }
+func (m *messageResolver) ReplyTo() *replyResolver { return newReplyResolver(m.msg.ReplyTo) }
+func (m *messageResolver) HTML() *string {
+	if m.msg.HTML == "" {
+		return nil
+	}
+	return &m.msg.HTML
+}
+func (m *messageResolver) ExpiresAt() *graphql.Time {
+	if m.msg.ExpiresAt == nil {
+		return nil
+	}
+	return &graphql.Time{Time: *m.msg.ExpiresAt}
+}
+
+func (m *messageResolver) System() *systemEventResolver {
+	if m.msg.System == nil {
+		return nil
+	}
+	return &systemEventResolver{*m.msg.System}
+}
+
+func (m *messageResolver) Attachments() []*attachmentResolver {
+	attachments := make([]*attachmentResolver, len(m.msg.Attachments))
+	for i, a := range m.msg.Attachments {
+		attachments[i] = &attachmentResolver{a: a}
+	}
+	return attachments
+}
+
+// attachmentResolver resolves an Attachment.
+type attachmentResolver struct {
+	a store.Attachment
+}
+
+func (a *attachmentResolver) ID() graphql.ID      { return graphql.ID(a.a.ID) }
+func (a *attachmentResolver) Filename() string    { return a.a.Filename }
+func (a *attachmentResolver) ContentType() string { return a.a.ContentType }
+func (a *attachmentResolver) Size() int32         { return int32(a.a.Size) }
+func (a *attachmentResolver) URL() string         { return a.a.URL }
+
+func (a *attachmentResolver) MediaStatus() *string {
+	if a.a.MediaStatus == "" {
+		return nil
+	}
+	return &a.a.MediaStatus
+}
+
+func (a *attachmentResolver) Width() *int32 {
+	if a.a.Width == 0 {
+		return nil
+	}
+	w := int32(a.a.Width)
+	return &w
+}
+
+func (a *attachmentResolver) Height() *int32 {
+	if a.a.Height == 0 {
+		return nil
+	}
+	h := int32(a.a.Height)
+	return &h
+}
+
+func (a *attachmentResolver) ThumbnailURL() *string {
+	if a.a.ThumbnailURL == "" {
+		return nil
+	}
+	return &a.a.ThumbnailURL
+}
+
+// systemEventResolver resolves a SystemEvent.
+type systemEventResolver struct {
+	e store.SystemEvent
+}
+
+func (r *systemEventResolver) Event() string { return r.e.Event }
+
+func (r *systemEventResolver) MessageID() *graphql.ID {
+	if r.e.MessageID == "" {
+		return nil
+	}
+	id := graphql.ID(r.e.MessageID)
+	return &id
+}
+
+func (r *systemEventResolver) OldUsername() *string {
+	if r.e.OldUsername == "" {
+		return nil
+	}
+	return &r.e.OldUsername
+}
+
+func (r *systemEventResolver) TTLSeconds() *int32 {
+	if r.e.TTLSeconds == nil {
+		return nil
+	}
+	ttl := int32(*r.e.TTLSeconds)
+	return &ttl
+}
+
+// replyResolver resolves a ReplyPreview.
+type replyResolver struct {
+	r *store.ReplyPreview
+}
+
+func newReplyResolver(r *store.ReplyPreview) *replyResolver {
+	if r == nil {
+		return nil
+	}
+	return &replyResolver{r: r}
+}
+
+func (r *replyResolver) ID() graphql.ID  { return graphql.ID(r.r.ID) }
+func (r *replyResolver) Sender() string  { return r.r.Sender }
+func (r *replyResolver) Content() string { return r.r.Content }
+func (r *replyResolver) Deleted() bool   { return r.r.Deleted }
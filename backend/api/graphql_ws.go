@@ -0,0 +1,234 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"backend/auth"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/websocket"
+	"github.com/graph-gophers/graphql-go"
+)
+
+// graphQLWSProtocol is the subprotocol of GraphQL over WebSocket, as
+// implemented by the graphql-ws client library.
+const graphQLWSProtocol = "graphql-transport-ws"
+
+// graphQLInitTimeout is how long a client has to send connection_init.
+const graphQLInitTimeout = 10 * time.Second
+
+// Close codes defined by the graphql-transport-ws protocol.
+const (
+	closeBadMessage        = 4400
+	closeUnauthorized      = 4401
+	closeForbidden         = 4403
+	closeInitTimeout       = 4408
+	closeSubscriberExists  = 4409
+	closeTooManyInitialise = 4429
+)
+
+// newGraphQLUpgrader returns the upgrader of GraphQL WebSockets from allowed
+// origins.
+func newGraphQLUpgrader(origins originPolicy, compression bool) websocket.Upgrader {
+	return websocket.Upgrader{
+		CheckOrigin:       origins.checkOrigin,
+		EnableCompression: compression,
+		ReadBufferSize:    1024,
+		WriteBufferSize:   1024,
+		Subprotocols:      []string{graphQLWSProtocol},
+	}
+}
+
+// graphQLWSMessage is a frame of the graphql-transport-ws protocol.
+type graphQLWSMessage struct {
+	ID      string          `json:"id,omitempty"`
+	Type    string          `json:"type"`
+	Payload json.RawMessage `json:"payload,omitempty"`
+}
+
+// graphQLConn is a GraphQL WebSocket connection and its running operations.
+type graphQLConn struct {
+	s    *Server
+	conn *websocket.Conn
+	ctx  context.Context
+
+	// writeMu serialises writes, which come from every running operation.
+	writeMu sync.Mutex
+
+	mu         sync.Mutex
+	operations map[string]context.CancelFunc
+}
+
+// graphQLWSHandler serves GraphQL operations, subscriptions in particular,
+// over a WebSocket using the graphql-transport-ws protocol.
+func (s *Server) graphQLWSHandler(c *gin.Context) {
+	conn, err := s.graphQLUpgrader.Upgrade(c.Writer, c.Request, nil)
+	if err != nil {
+		http.NotFound(c.Writer, c.Request)
+		return
+	}
+
+	ctx, cancel := context.WithCancel(withUser(context.Background(), auth.CurrentUser(c)))
+	defer cancel()
+
+	gc := &graphQLConn{s: s, conn: conn, ctx: ctx, operations: make(map[string]context.CancelFunc)}
+	gc.serve()
+}
+
+// serve reads frames until the connection closes, cancelling every running
+// operation when it does.
+func (gc *graphQLConn) serve() {
+	defer gc.conn.Close()
+
+	acknowledged := false
+	gc.conn.SetReadDeadline(time.Now().Add(graphQLInitTimeout))
+	for {
+		var msg graphQLWSMessage
+		if err := gc.conn.ReadJSON(&msg); err != nil {
+			if !acknowledged && isTimeout(err) {
+				gc.close(closeInitTimeout, "Connection initialisation timeout")
+			}
+			return
+		}
+
+		switch msg.Type {
+		case "connection_init":
+			if acknowledged {
+				gc.close(closeTooManyInitialise, "Too many initialisation requests")
+				return
+			}
+			// The access token was checked when the connection upgraded.
+			acknowledged = true
+			gc.conn.SetReadDeadline(time.Time{})
+			gc.write(graphQLWSMessage{Type: "connection_ack"})
+		case "ping":
+			gc.write(graphQLWSMessage{Type: "pong"})
+		case "pong":
+		case "subscribe":
+			if !acknowledged {
+				gc.close(closeUnauthorized, "Unauthorized")
+				return
+			}
+			// The user may have been banned since the connection opened.
+			if _, err := gc.s.checkActive(gc.ctx, contextUser(gc.ctx)); err != nil {
+				gc.close(closeForbidden, "Forbidden")
+				return
+			}
+			var req graphQLRequest
+			if msg.ID == "" || json.Unmarshal(msg.Payload, &req) != nil {
+				gc.close(closeBadMessage, "Invalid subscribe message")
+				return
+			}
+			if !gc.start(msg.ID, req) {
+				gc.close(closeSubscriberExists, fmt.Sprintf("Subscriber for %s already exists", msg.ID))
+				return
+			}
+		case "complete":
+			gc.stop(msg.ID)
+		default:
+			gc.close(closeBadMessage, fmt.Sprintf("Invalid message type %q", msg.Type))
+			return
+		}
+	}
+}
+
+// start runs an operation, sending its results as next frames followed by
+// complete. It reports false if an operation with the same id is running.
+func (gc *graphQLConn) start(id string, req graphQLRequest) bool {
+	gc.mu.Lock()
+	defer gc.mu.Unlock()
+
+	if _, ok := gc.operations[id]; ok {
+		return false
+	}
+	ctx, cancel := context.WithCancel(gc.ctx)
+	gc.operations[id] = cancel
+
+	responses, err := gc.s.graphql.Subscribe(ctx, req.Query, req.OperationName, req.Variables)
+	if err != nil {
+		delete(gc.operations, id)
+		cancel()
+		payload, _ := json.Marshal([]map[string]string{{"message": err.Error()}})
+		gc.write(graphQLWSMessage{ID: id, Type: "error", Payload: payload})
+		return true
+	}
+
+	go func() {
+		first := true
+		for r := range responses {
+			resp, ok := r.(*graphql.Response)
+			if !ok || ctx.Err() != nil {
+				// Drain what the subscription sends while it winds down.
+				continue
+			}
+
+			// An operation that failed validation ends with an error frame
+			// in place of its results.
+			if first && resp.Data == nil && len(resp.Errors) > 0 {
+				gc.stop(id)
+				payload, _ := json.Marshal(resp.Errors)
+				gc.write(graphQLWSMessage{ID: id, Type: "error", Payload: payload})
+				continue
+			}
+			first = false
+
+			payload, err := json.Marshal(resp)
+			if err != nil {
+				continue
+			}
+			gc.write(graphQLWSMessage{ID: id, Type: "next", Payload: payload})
+		}
+
+		// Operations the client completed get no complete of their own.
+		if gc.stop(id) {
+			gc.write(graphQLWSMessage{ID: id, Type: "complete"})
+		}
+	}()
+	return true
+}
+
+// stop cancels a running operation, reporting whether it was running.
+func (gc *graphQLConn) stop(id string) bool {
+	gc.mu.Lock()
+	defer gc.mu.Unlock()
+
+	cancel, ok := gc.operations[id]
+	if ok {
+		cancel()
+		delete(gc.operations, id)
+	}
+	return ok
+}
+
+// write sends a frame, ignoring errors; a broken connection ends serve.
+func (gc *graphQLConn) write(msg graphQLWSMessage) {
+	gc.writeMu.Lock()
+	defer gc.writeMu.Unlock()
+
+	gc.conn.SetWriteDeadline(time.Now().Add(10 * time.Second))
+	gc.conn.WriteJSON(msg)
+}
+
+// close closes the connection with a protocol close code.
+func (gc *graphQLConn) close(code int, reason string) {
+	gc.writeMu.Lock()
+	defer gc.writeMu.Unlock()
+
+	msg := websocket.FormatCloseMessage(code, reason)
+	gc.conn.WriteControl(websocket.CloseMessage, msg, time.Now().Add(time.Second))
+}
+
+// isTimeout reports whether err is a read deadline expiring.
+func isTimeout(err error) bool {
+	var ne interface{ Timeout() bool }
+	if errors.As(err, &ne) {
+		return ne.Timeout()
+	}
+	return false
+}
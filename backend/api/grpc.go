@@ -0,0 +1,425 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	"backend/apperr"
+	"backend/chatpb"
+	"backend/metrics"
+	"backend/store"
+	"backend/ws"
+
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// authServicePrefix prefixes the gRPC methods that need no access token.
+const authServicePrefix = "/chat.v1.AuthService/"
+
+// grpcCodes maps the HTTP status of an error code to its gRPC code.
+var grpcCodes = map[int]codes.Code{
+	http.StatusBadRequest:            codes.InvalidArgument,
+	http.StatusUnauthorized:          codes.Unauthenticated,
+	http.StatusForbidden:             codes.PermissionDenied,
+	http.StatusNotFound:              codes.NotFound,
+	http.StatusConflict:              codes.FailedPrecondition,
+	http.StatusRequestEntityTooLarge: codes.InvalidArgument,
+	http.StatusUnsupportedMediaType:  codes.InvalidArgument,
+	http.StatusUnprocessableEntity:   codes.InvalidArgument,
+	http.StatusTooManyRequests:       codes.ResourceExhausted,
+}
+
+// GRPCServer returns a gRPC server of the chat API. It shares this server's
+// services and hub, so gRPC clients chat with REST and WebSocket ones.
+func (s *Server) GRPCServer() *grpc.Server {
+	srv := grpc.NewServer(
+		grpc.ChainUnaryInterceptor(s.unaryIPFilter, s.unaryAuth),
+		grpc.ChainStreamInterceptor(s.streamIPFilter, s.streamAuth),
+	)
+	chatpb.RegisterAuthServiceServer(srv, &authRPC{s: s})
+	chatpb.RegisterMessageServiceServer(srv, &messageRPC{s: s})
+	chatpb.RegisterChatServiceServer(srv, &chatRPC{s: s})
+	return srv
+}
+
+// rpcError converts an API error to a gRPC status carrying its code as the
+// reason of an ErrorInfo detail.
+func rpcError(err error) error {
+	var e *apperr.Error
+	if !errors.As(err, &e) {
+		log.Printf("gRPC error: %v", err)
+		e = apperr.New(apperr.Internal, "Internal server error")
+	}
+
+	code, ok := grpcCodes[e.Code.Status()]
+	if !ok {
+		code = codes.Internal
+	}
+	st := status.New(code, e.Message)
+	if detailed, err := st.WithDetails(&errdetails.ErrorInfo{Reason: string(e.Code), Domain: "chat"}); err == nil {
+		st = detailed
+	}
+	return st.Err()
+}
+
+// authenticate checks the access or bot token in the metadata of a call and
+// returns a context carrying its username.
+func (s *Server) authenticate(ctx context.Context) (context.Context, error) {
+	md, _ := metadata.FromIncomingContext(ctx)
+	values := md.Get("authorization")
+	if len(values) == 0 || !strings.HasPrefix(values[0], "Bearer ") {
+		return nil, rpcError(apperr.New(apperr.Unauthenticated, "Missing authentication token"))
+	}
+
+	claims, e := s.parseToken(ctx, strings.TrimPrefix(values[0], "Bearer "))
+	if e != nil {
+		return nil, rpcError(e)
+	}
+	if _, err := s.checkActive(ctx, claims.Username); err != nil {
+		return nil, rpcError(err)
+	}
+
+	return withUser(ctx, claims.Username), nil
+}
+
+// unaryAuth authenticates unary calls outside AuthService.
+func (s *Server) unaryAuth(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	if strings.HasPrefix(info.FullMethod, authServicePrefix) {
+		return handler(ctx, req)
+	}
+	ctx, err := s.authenticate(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return handler(ctx, req)
+}
+
+// authenticatedStream is a server stream whose context carries the
+// authenticated username.
+type authenticatedStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (a authenticatedStream) Context() context.Context {
+	return a.ctx
+}
+
+// streamAuth authenticates streaming calls.
+func (s *Server) streamAuth(srv interface{}, stream grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	ctx, err := s.authenticate(stream.Context())
+	if err != nil {
+		return err
+	}
+	return handler(srv, authenticatedStream{ServerStream: stream, ctx: ctx})
+}
+
+// peerIP returns the IP address of the client of a gRPC call.
+func peerIP(ctx context.Context) string {
+	p, ok := peer.FromContext(ctx)
+	if !ok {
+		return ""
+	}
+	host, _, err := net.SplitHostPort(p.Addr.String())
+	if err != nil {
+		return p.Addr.String()
+	}
+	return host
+}
+
+// rpcSessionClient returns the client of a gRPC call, for the sessions it
+// starts or refreshes.
+func rpcSessionClient(ctx context.Context) store.SessionClient {
+	var userAgent string
+	md, _ := metadata.FromIncomingContext(ctx)
+	if values := md.Get("user-agent"); len(values) > 0 {
+		userAgent = values[0]
+	}
+	return newSessionClient(userAgent, peerIP(ctx))
+}
+
+// authRPC implements chatpb.AuthServiceServer.
+type authRPC struct {
+	chatpb.UnimplementedAuthServiceServer
+	s *Server
+}
+
+func (a *authRPC) Login(ctx context.Context, req *chatpb.LoginRequest) (*chatpb.TokenPair, error) {
+	if req.Username == "" || req.Password == "" {
+		return nil, rpcError(apperr.New(apperr.InvalidRequest, "Invalid username or password"))
+	}
+	ok, _, err := a.s.limiter.Allow(ctx, loginLimit, peerIP(ctx))
+	if err != nil {
+		log.Printf("Rate limiter error for %s: %v", loginLimit.Name, err)
+	}
+	if !ok {
+		return nil, rpcError(apperr.New(apperr.RateLimited, "Too many requests, please try again later"))
+	}
+	tokens, err := a.s.login(ctx, req.Username, req.Password, rpcSessionClient(ctx))
+	if err != nil {
+		return nil, rpcError(sessionFailure(err))
+	}
+	return &chatpb.TokenPair{Token: tokens.Token, RefreshToken: tokens.RefreshToken}, nil
+}
+
+func (a *authRPC) RefreshToken(ctx context.Context, req *chatpb.RefreshTokenRequest) (*chatpb.TokenPair, error) {
+	if req.RefreshToken == "" {
+		return nil, rpcError(apperr.New(apperr.InvalidRequest, "Missing refresh token"))
+	}
+	tokens, err := a.s.sessions.Refresh(ctx, req.RefreshToken, rpcSessionClient(ctx))
+	if err != nil {
+		return nil, rpcError(sessionFailure(err))
+	}
+	return &chatpb.TokenPair{Token: tokens.Token, RefreshToken: tokens.RefreshToken}, nil
+}
+
+func (a *authRPC) Logout(ctx context.Context, req *chatpb.LogoutRequest) (*chatpb.LogoutResponse, error) {
+	if req.RefreshToken == "" {
+		return nil, rpcError(apperr.New(apperr.InvalidRequest, "Missing refresh token"))
+	}
+	if err := a.s.sessions.Logout(ctx, req.RefreshToken); err != nil {
+		return nil, rpcError(apperr.New(apperr.Internal, "Failed to log out"))
+	}
+	return &chatpb.LogoutResponse{}, nil
+}
+
+// messageRPC implements chatpb.MessageServiceServer.
+type messageRPC struct {
+	chatpb.UnimplementedMessageServiceServer
+	s *Server
+}
+
+func (m *messageRPC) SendMessage(ctx context.Context, req *chatpb.SendMessageRequest) (*chatpb.Message, error) {
+	username := contextUser(ctx)
+	ok, _, err := m.s.limiter.Allow(ctx, messageLimit, username)
+	if err != nil {
+		log.Printf("Rate limiter error for %s: %v", messageLimit.Name, err)
+	}
+	if !ok {
+		return nil, rpcError(apperr.New(apperr.RateLimited, "Too many messages, please slow down"))
+	}
+
+	msg := messageFromRequest(req)
+	msg.Sender = username
+	if err := m.s.messages.Send(ctx, &msg); err != nil {
+		return nil, rpcError(sendFailure(err))
+	}
+
+	metrics.MessagesSent.WithLabelValues("grpc").Inc()
+	return messageToProto(msg), nil
+}
+
+func (m *messageRPC) ListMessages(ctx context.Context, req *chatpb.ListMessagesRequest) (*chatpb.ListMessagesResponse, error) {
+	username := contextUser(ctx)
+	if req.Peer == "" {
+		return nil, rpcError(apperr.New(apperr.InvalidRequest, "Missing peer"))
+	}
+	if req.Limit < 0 {
+		return nil, rpcError(apperr.New(apperr.InvalidRequest, "Invalid limit"))
+	}
+
+	var messages []store.Message
+	var err error
+	if req.Limit > 0 {
+		messages, err = m.s.recentMessages(ctx, username, req.Peer, int(req.Limit))
+	} else {
+		messages, err = m.s.store.Conversation(ctx, username, req.Peer, time.Time{})
+	}
+	if err != nil {
+		log.Printf("Error fetching conversation of %s with %s: %v", username, req.Peer, err)
+		return nil, rpcError(apperr.New(apperr.Internal, "Failed to fetch messages"))
+	}
+
+	return &chatpb.ListMessagesResponse{Messages: messagesToProto(messages)}, nil
+}
+
+// chatRPC implements chatpb.ChatServiceServer.
+type chatRPC struct {
+	chatpb.UnimplementedChatServiceServer
+	s *Server
+}
+
+// Chat registers the stream with the hub like a WebSocket connection, so
+// draining the server ends it too.
+func (r *chatRPC) Chat(stream chatpb.ChatService_ChatServer) error {
+	client := ws.NewStreamClient(contextUser(stream.Context()))
+	r.s.registerClient(client)
+
+	var err error
+	r.s.hub.Track(func() { err = r.serve(stream, client) })
+	return err
+}
+
+// serve relays events to a chat stream until either side ends it. Events
+// written to the stream count as delivered, since gRPC delivers them reliably
+// while the stream lasts.
+func (r *chatRPC) serve(stream chatpb.ChatService_ChatServer, client *ws.Client) error {
+	s := r.s
+	ctx := stream.Context()
+	username := client.UserID
+
+	s.setOnline(username)
+	done := make(chan struct{})
+	go s.runPresenceHeartbeat(username, done)
+	defer func() {
+		close(done)
+		// Only go offline once the user's last connection has closed. The
+		// client may already be gone if it was disconnected by the hub.
+		s.unregisterClient(client)
+		if !s.hub.Connected(username) {
+			s.setOffline(username)
+		}
+	}()
+
+	go s.flushPending(ctx, client)
+
+	received := make(chan error, 1)
+	go func() { received <- r.receive(ctx, client, stream) }()
+
+	for {
+		select {
+		case event, ok := <-client.Events():
+			if !ok {
+				return status.Error(codes.Unavailable, "Connection closed")
+			}
+			if err := stream.Send(chatEvent(event)); err != nil {
+				return err
+			}
+			s.markEventDelivered(ctx, username, event)
+		case err := <-received:
+			return err
+		}
+	}
+}
+
+// receive handles the requests of a chat stream until the client closes it.
+func (r *chatRPC) receive(ctx context.Context, client *ws.Client, stream chatpb.ChatService_ChatServer) error {
+	for {
+		req, err := stream.Recv()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		switch body := req.Request.(type) {
+		case *chatpb.ChatRequest_Send:
+			r.s.sendInbound(ctx, client, req.Seq, messageFromRequest(body.Send), "grpc")
+		case *chatpb.ChatRequest_Typing:
+			if body.Typing.Receiver == "" {
+				r.s.sendError(client, req.Seq, apperr.New(apperr.InvalidRequest, "Invalid typing event"))
+				continue
+			}
+			r.s.relayTyping(ctx, client.UserID, body.Typing.Receiver, body.Typing.Typing)
+		case *chatpb.ChatRequest_Read:
+			err := r.s.markRead(ctx, body.Read.MessageId, client.UserID)
+			if errors.Is(err, store.ErrNotFound) {
+				r.s.sendError(client, req.Seq, apperr.New(apperr.MessageNotFound, "Message not found"))
+			} else if err != nil {
+				log.Printf("Error marking message %s read: %v", body.Read.MessageId, err)
+				r.s.sendError(client, req.Seq, apperr.New(apperr.Internal, "Failed to update message status"))
+			}
+		default:
+			r.s.sendError(client, req.Seq, apperr.New(apperr.InvalidRequest, "Missing request"))
+		}
+	}
+}
+
+// chatEvent converts a hub event to its gRPC form.
+func chatEvent(event ws.Event) *chatpb.ChatEvent {
+	out := &chatpb.ChatEvent{Type: event.Type}
+	switch payload := event.Payload.(type) {
+	case store.Message:
+		out.Payload = &chatpb.ChatEvent_Message{Message: messageToProto(payload)}
+	case PendingEvent:
+		out.Payload = &chatpb.ChatEvent_Pending{Pending: &chatpb.MessageBatch{Messages: messagesToProto(payload.Messages)}}
+	case ErrorEvent:
+		out.Payload = &chatpb.ChatEvent_Error{Error: &chatpb.Error{
+			Code:       string(payload.Code),
+			Error:      payload.Error,
+			Reasons:    payload.Reasons,
+			Seq:        payload.Seq,
+			RetryAfter: int32(payload.RetryAfter),
+		}}
+	default:
+		encoded, err := json.Marshal(payload)
+		if err != nil {
+			log.Printf("Error encoding %s event: %v", event.Type, err)
+		}
+		out.Payload = &chatpb.ChatEvent_Json{Json: string(encoded)}
+	}
+	return out
+}
+
+// messageFromRequest returns the message a SendMessageRequest asks to send.
+func messageFromRequest(req *chatpb.SendMessageRequest) store.Message {
+	msg := store.Message{Receiver: req.Receiver, Content: req.Content}
+	if req.ReplyToId != "" {
+		msg.ReplyToID = &req.ReplyToId
+	}
+	return msg
+}
+
+// messageToProto converts a message to its gRPC form.
+func messageToProto(msg store.Message) *chatpb.Message {
+	out := &chatpb.Message{
+		Id:        msg.ID,
+		Sender:    msg.Sender,
+		Receiver:  msg.Receiver,
+		Content:   msg.Content,
+		Upvotes:   int32(msg.Upvotes),
+		Downvotes: int32(msg.Downvotes),
+		Status:    msg.Status,
+		Deleted:   msg.Deleted,
+		CreatedAt: timestamppb.New(msg.CreatedAt),
+		UpdatedAt: timestamppb.New(msg.UpdatedAt),
+		Mentions:  msg.Mentions,
+	}
+	if msg.ExpiresAt != nil {
+		out.ExpiresAt = timestamppb.New(*msg.ExpiresAt)
+	}
+	for _, a := range msg.Attachments {
+		out.Attachments = append(out.Attachments, &chatpb.Attachment{
+			Id:          a.ID,
+			Filename:    a.Filename,
+			ContentType: a.ContentType,
+			Size:        a.Size,
+			Url:         a.URL,
+		})
+	}
+	if msg.ReplyToID != nil {
+		out.ReplyToId = *msg.ReplyToID
+	}
+	if msg.ReplyTo != nil {
+		out.ReplyTo = &chatpb.ReplyPreview{
+			Id:      msg.ReplyTo.ID,
+			Sender:  msg.ReplyTo.Sender,
+			Content: msg.ReplyTo.Content,
+			Deleted: msg.ReplyTo.Deleted,
+		}
+	}
+	return out
+}
+
+// messagesToProto converts messages to their gRPC form.
+func messagesToProto(messages []store.Message) []*chatpb.Message {
+	out := make([]*chatpb.Message, len(messages))
+	for i, msg := range messages {
+		out[i] = messageToProto(msg)
+	}
+	return out
+}
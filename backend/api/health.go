@@ -0,0 +1,59 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// readinessTimeout bounds each dependency check made by /readyz.
+const readinessTimeout = 2 * time.Second
+
+// healthzHandler reports that the process is alive.
+func (s *Server) healthzHandler(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"status": "ok"})
+}
+
+// readyzHandler reports whether the instance can serve traffic: Postgres
+// and Redis must answer a ping and the migrations must have been applied.
+func (s *Server) readyzHandler(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c.Request.Context(), readinessTimeout)
+	defer cancel()
+
+	checks := gin.H{}
+	ready := true
+
+	if err := s.store.Ping(ctx); err != nil {
+		checks["postgres"] = err.Error()
+		ready = false
+	} else {
+		checks["postgres"] = "ok"
+	}
+
+	if err := s.rdb.Ping(ctx).Err(); err != nil {
+		checks["redis"] = err.Error()
+		ready = false
+	} else {
+		checks["redis"] = "ok"
+	}
+
+	if s.migrationsApplied.Load() {
+		checks["migrations"] = "ok"
+	} else {
+		checks["migrations"] = "pending"
+		ready = false
+	}
+
+	if s.shuttingDown.Load() {
+		checks["server"] = "shutting down"
+		ready = false
+	}
+
+	status := http.StatusOK
+	if !ready {
+		status = http.StatusServiceUnavailable
+	}
+	c.JSON(status, gin.H{"ready": ready, "checks": checks})
+}
@@ -0,0 +1,239 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"backend/apperr"
+	"backend/auth"
+	"backend/metrics"
+	"backend/store"
+
+	"github.com/gin-gonic/gin"
+)
+
+// slackLink matches Slack's <url|label>, <url> and <!here> markup.
+var slackLink = regexp.MustCompile(`<([^<>|]+)(?:\|([^<>]*))?>`)
+
+// slackEntities undoes the escaping Slack asks senders to apply.
+var slackEntities = strings.NewReplacer("&lt;", "<", "&gt;", ">", "&amp;", "&")
+
+// SlackMessage is the part of a Slack incoming webhook payload that incoming
+// hooks understand. Other fields, such as blocks, are ignored.
+type SlackMessage struct {
+	Text        string            `json:"text"`
+	Attachments []SlackAttachment `json:"attachments,omitempty"`
+}
+
+// SlackAttachment is a Slack message attachment.
+type SlackAttachment struct {
+	Fallback  string       `json:"fallback,omitempty"`
+	Pretext   string       `json:"pretext,omitempty"`
+	Title     string       `json:"title,omitempty"`
+	TitleLink string       `json:"title_link,omitempty"`
+	Text      string       `json:"text,omitempty"`
+	Fields    []SlackField `json:"fields,omitempty"`
+	Footer    string       `json:"footer,omitempty"`
+}
+
+// SlackField is a field of a Slack attachment.
+type SlackField struct {
+	Title string `json:"title"`
+	Value string `json:"value"`
+}
+
+// IncomingHookCreated is the response to creating an incoming hook, the only
+// time its token is shown.
+type IncomingHookCreated struct {
+	Hook  store.IncomingHook `json:"hook"`
+	Token string             `json:"token"`
+	// Path is where the hook accepts payloads.
+	Path string `json:"path"`
+}
+
+// slackContent renders a Slack payload as the plain text of a message: its
+// text, then every attachment as a paragraph.
+func slackContent(m SlackMessage) string {
+	var paragraphs []string
+	if m.Text != "" {
+		paragraphs = append(paragraphs, m.Text)
+	}
+
+	for _, a := range m.Attachments {
+		var lines []string
+		if a.Pretext != "" {
+			lines = append(lines, a.Pretext)
+		}
+		if a.Title != "" && a.TitleLink != "" {
+			lines = append(lines, a.Title+" ("+a.TitleLink+")")
+		} else if a.Title != "" {
+			lines = append(lines, a.Title)
+		}
+		if a.Text != "" {
+			lines = append(lines, a.Text)
+		}
+		for _, f := range a.Fields {
+			lines = append(lines, f.Title+": "+f.Value)
+		}
+		// The fallback stands in for attachments with nothing else to show.
+		if len(lines) == 0 && a.Fallback != "" {
+			lines = append(lines, a.Fallback)
+		}
+		if a.Footer != "" {
+			lines = append(lines, a.Footer)
+		}
+		if len(lines) > 0 {
+			paragraphs = append(paragraphs, strings.Join(lines, "\n"))
+		}
+	}
+
+	text := slackLink.ReplaceAllStringFunc(strings.Join(paragraphs, "\n\n"), func(link string) string {
+		m := slackLink.FindStringSubmatch(link)
+		target, label := m[1], m[2]
+		if mention, ok := strings.CutPrefix(target, "!"); ok {
+			return "@" + mention
+		}
+		if label == "" || label == target {
+			return target
+		}
+		return label + " (" + target + ")"
+	})
+	return strings.TrimSpace(slackEntities.Replace(text))
+}
+
+// byHookToken keys a rate limit by the incoming hook a request calls.
+func byHookToken(c *gin.Context) string {
+	return auth.HashToken(c.Param("token"))
+}
+
+// incomingHookHandler accepts a Slack incoming webhook payload, as JSON or
+// as the payload field of a form, and sends it as a message from the hook's
+// bot to its receiver. Like Slack it answers "ok".
+func (s *Server) incomingHookHandler(c *gin.Context) {
+	ctx := c.Request.Context()
+
+	hook, err := s.store.UseIncomingHook(ctx, auth.HashToken(c.Param("token")))
+	if errors.Is(err, store.ErrNotFound) {
+		c.Error(apperr.New(apperr.NotFound, "Hook not found"))
+		return
+	}
+	if err != nil {
+		c.Error(apperr.New(apperr.Internal, "Failed to fetch hook"))
+		return
+	}
+
+	var payload SlackMessage
+	if c.ContentType() == "application/x-www-form-urlencoded" {
+		err = json.Unmarshal([]byte(c.PostForm("payload")), &payload)
+	} else {
+		err = c.ShouldBindJSON(&payload)
+	}
+	if err != nil {
+		c.Error(apperr.New(apperr.InvalidRequest, "Invalid payload"))
+		return
+	}
+	content := slackContent(payload)
+	if content == "" {
+		c.Error(apperr.New(apperr.InvalidRequest, "Missing text"))
+		return
+	}
+
+	if _, err := s.checkActive(ctx, hook.Bot); err != nil {
+		c.Error(err)
+		return
+	}
+
+	msg := store.Message{Sender: hook.Bot, Receiver: hook.Receiver, Content: content}
+	if err := s.messages.Send(ctx, &msg); err != nil {
+		c.Error(sendFailure(err))
+		return
+	}
+
+	metrics.MessagesSent.WithLabelValues("hook").Inc()
+	c.String(http.StatusOK, "ok")
+}
+
+// createIncomingHookHandler creates an incoming hook posting as a bot to one
+// user.
+func (s *Server) createIncomingHookHandler(c *gin.Context) {
+	ctx := c.Request.Context()
+
+	var req struct {
+		Name     string `json:"name"`
+		Bot      string `json:"bot"`
+		Receiver string `json:"receiver"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil || req.Name == "" || len(req.Name) > 100 {
+		c.Error(apperr.New(apperr.InvalidRequest, "Invalid name, expected 1 to 100 characters"))
+		return
+	}
+
+	role, _, err := s.store.Role(ctx, req.Bot)
+	if errors.Is(err, store.ErrNotFound) || (err == nil && role != store.RoleBot) {
+		c.Error(apperr.Newf(apperr.InvalidRequest, "Unknown bot %s", req.Bot))
+		return
+	}
+	if err != nil {
+		c.Error(apperr.New(apperr.Internal, "Failed to fetch bot"))
+		return
+	}
+	if _, _, err := s.store.Role(ctx, req.Receiver); errors.Is(err, store.ErrNotFound) {
+		c.Error(apperr.New(apperr.UserNotFound, "Receiver not found"))
+		return
+	} else if err != nil {
+		c.Error(apperr.New(apperr.Internal, "Failed to fetch receiver"))
+		return
+	}
+
+	token, err := auth.NewOpaqueToken()
+	if err != nil {
+		c.Error(apperr.New(apperr.Internal, "Failed to generate hook token"))
+		return
+	}
+
+	hook := store.IncomingHook{Name: req.Name, Bot: req.Bot, Receiver: req.Receiver, CreatedBy: auth.CurrentUser(c)}
+	if err := s.store.CreateIncomingHook(ctx, &hook, auth.HashToken(token)); err != nil {
+		c.Error(apperr.New(apperr.Internal, "Failed to create hook"))
+		return
+	}
+	s.audit(ctx, store.AuditEntry{Action: auditHookCreated, Target: hook.ID, Details: map[string]string{"bot": hook.Bot, "receiver": hook.Receiver}})
+
+	c.JSON(http.StatusCreated, IncomingHookCreated{Hook: hook, Token: token, Path: apiV1 + "/hooks/" + token})
+}
+
+// incomingHooksHandler lists the incoming hooks.
+func (s *Server) incomingHooksHandler(c *gin.Context) {
+	hooks, err := s.store.IncomingHooks(c.Request.Context())
+	if err != nil {
+		c.Error(apperr.New(apperr.Internal, "Failed to fetch hooks"))
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"hooks": hooks})
+}
+
+// deleteIncomingHookHandler deletes an incoming hook.
+func (s *Server) deleteIncomingHookHandler(c *gin.Context) {
+	id := c.Param("id")
+	if _, err := strconv.Atoi(id); err != nil {
+		c.Error(apperr.New(apperr.NotFound, "Hook not found"))
+		return
+	}
+
+	err := s.store.DeleteIncomingHook(c.Request.Context(), id)
+	if errors.Is(err, store.ErrNotFound) {
+		c.Error(apperr.New(apperr.NotFound, "Hook not found"))
+		return
+	}
+	if err != nil {
+		c.Error(apperr.New(apperr.Internal, "Failed to delete hook"))
+		return
+	}
+	s.audit(c.Request.Context(), store.AuditEntry{Action: auditHookDeleted, Target: id})
+
+	c.JSON(http.StatusOK, gin.H{"message": s.tr(c, "Hook deleted successfully")})
+}
@@ -0,0 +1,110 @@
+package api
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"backend/apperr"
+	"backend/metrics"
+	"backend/store"
+
+	"github.com/gin-gonic/gin"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+)
+
+// blockedAuditInterval is how often a blocked address is recorded in the
+// audit log at most, so a client retrying in a loop cannot flood it.
+const blockedAuditInterval = time.Minute
+
+// ipFilterMiddleware refuses requests from the addresses and countries the
+// IP filter blocks, before they authenticate. The country header is only
+// read from requests a trusted proxy passed on.
+func (s *Server) ipFilterMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !s.ipFilter.Enabled() {
+			c.Next()
+			return
+		}
+
+		var country string
+		if header := s.ipFilter.CountryHeader(); header != "" && s.ipFilter.TrustsProxy(c.RemoteIP()) {
+			country = c.GetHeader(header)
+		}
+		if err := s.checkAccess(c.Request.Context(), c.ClientIP(), country, c.Request.Method+" "+c.Request.URL.Path); err != nil {
+			apperr.Abort(c, err)
+			return
+		}
+		c.Next()
+	}
+}
+
+// unaryIPFilter refuses unary gRPC calls from blocked clients.
+func (s *Server) unaryIPFilter(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	if err := s.checkRPCAccess(ctx, info.FullMethod); err != nil {
+		return nil, err
+	}
+	return handler(ctx, req)
+}
+
+// streamIPFilter refuses streaming gRPC calls from blocked clients.
+func (s *Server) streamIPFilter(srv interface{}, stream grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	if err := s.checkRPCAccess(stream.Context(), info.FullMethod); err != nil {
+		return err
+	}
+	return handler(srv, stream)
+}
+
+// checkRPCAccess checks the client of a gRPC call, whose country is read
+// from the metadata of the same name as the country header if the call came
+// through a trusted proxy.
+func (s *Server) checkRPCAccess(ctx context.Context, method string) error {
+	if !s.ipFilter.Enabled() {
+		return nil
+	}
+
+	var country string
+	ip := peerIP(ctx)
+	if header := s.ipFilter.CountryHeader(); header != "" && s.ipFilter.TrustsProxy(ip) {
+		md, _ := metadata.FromIncomingContext(ctx)
+		if values := md.Get(header); len(values) > 0 {
+			country = values[0]
+		}
+	}
+	if err := s.checkAccess(ctx, ip, country, method); err != nil {
+		return rpcError(err)
+	}
+	return nil
+}
+
+// checkAccess returns an ACCESS_DENIED error if the IP filter blocks a
+// client at ip in country, after counting and auditing the attempt on
+// target, the route or method called.
+func (s *Server) checkAccess(ctx context.Context, ip, country, target string) error {
+	reason := s.ipFilter.Check(ip, country)
+	if reason == "" {
+		return nil
+	}
+
+	metrics.AccessBlocked.WithLabelValues(reason).Inc()
+	if s.shouldAuditBlocked(ctx, ip) {
+		details := map[string]string{"reason": reason, "target": target}
+		if country != "" {
+			details["country"] = country
+		}
+		s.audit(ctx, store.AuditEntry{Action: auditAccessBlocked, Target: ip, Details: details})
+	}
+	return apperr.New(apperr.AccessDenied, "Access is not allowed from your network or location")
+}
+
+// shouldAuditBlocked reports whether a blocked attempt from ip is the first
+// within blockedAuditInterval. If Redis cannot tell, it is audited.
+func (s *Server) shouldAuditBlocked(ctx context.Context, ip string) bool {
+	first, err := s.rdb.SetNX(ctx, "access_blocked:"+ip, 1, blockedAuditInterval).Result()
+	if err != nil {
+		log.Printf("Error throttling audit of blocked address %s: %v", ip, err)
+		return true
+	}
+	return first
+}
@@ -0,0 +1,60 @@
+package api_test
+
+import (
+	"net/http"
+	"testing"
+
+	"backend/api"
+	"backend/ipfilter"
+)
+
+// withIPFilter configures the server to filter clients with cfg, behind the
+// proxy at 10.0.0.1.
+func withIPFilter(t *testing.T, cfg ipfilter.Config) func(*api.Config) {
+	t.Helper()
+	f, err := ipfilter.New(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return func(c *api.Config) {
+		c.IPFilter = f
+		c.TrustedProxies = []string{"10.0.0.1"}
+	}
+}
+
+func TestIPFilterIgnoresSpoofedCountry(t *testing.T) {
+	ts := newTestServer(t, withIPFilter(t, ipfilter.Config{
+		CountryHeader:  "CF-IPCountry",
+		TrustedProxies: []string{"10.0.0.1"},
+		AllowCountries: []string{"DE"},
+	}))
+
+	// A client that is not the proxy cannot claim a country.
+	res := ts.requestFrom("198.51.100.7:1234", "GET", "/users", "", nil, "CF-IPCountry", "DE")
+	expectError(t, res, http.StatusForbidden, "ACCESS_DENIED")
+
+	// Through the proxy the header is believed.
+	res = ts.requestFrom("10.0.0.1:1234", "GET", "/users", "", nil, "X-Forwarded-For", "198.51.100.7", "CF-IPCountry", "DE")
+	expectError(t, res, http.StatusUnauthorized, "UNAUTHENTICATED")
+	res = ts.requestFrom("10.0.0.1:1234", "GET", "/users", "", nil, "X-Forwarded-For", "198.51.100.7", "CF-IPCountry", "FR")
+	expectError(t, res, http.StatusForbidden, "ACCESS_DENIED")
+}
+
+func TestIPFilterDenyWinsOverAllow(t *testing.T) {
+	ts := newTestServer(t, withIPFilter(t, ipfilter.Config{
+		Allow: []string{"198.51.100.0/24"},
+		Deny:  []string{"198.51.100.66"},
+	}))
+
+	res := ts.requestFrom("198.51.100.66:1234", "GET", "/users", "", nil)
+	expectError(t, res, http.StatusForbidden, "ACCESS_DENIED")
+	// The client address is taken from X-Forwarded-For only when the proxy
+	// sent it.
+	res = ts.requestFrom("10.0.0.1:1234", "GET", "/users", "", nil, "X-Forwarded-For", "198.51.100.66")
+	expectError(t, res, http.StatusForbidden, "ACCESS_DENIED")
+	res = ts.requestFrom("198.51.100.66:1234", "GET", "/users", "", nil, "X-Forwarded-For", "198.51.100.7")
+	expectError(t, res, http.StatusForbidden, "ACCESS_DENIED")
+
+	res = ts.requestFrom("198.51.100.7:1234", "GET", "/users", "", nil)
+	expectError(t, res, http.StatusUnauthorized, "UNAUTHENTICATED")
+}
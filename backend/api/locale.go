@@ -0,0 +1,119 @@
+package api
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+
+	"backend/apperr"
+	"backend/auth"
+	"backend/i18n"
+	"backend/store"
+
+	"github.com/gin-gonic/gin"
+	"golang.org/x/text/language"
+)
+
+// contextLocaleKey is the Gin context key holding the language a request is
+// answered in, once resolved.
+const contextLocaleKey = "locale"
+
+// locale returns the language to answer c in: the locale the authenticated
+// user chose, if any, or else the best match for Accept-Language. It is
+// resolved once per request, when something is first translated, and named
+// in the Content-Language of the response.
+func (s *Server) locale(c *gin.Context) language.Tag {
+	if v, ok := c.Get(contextLocaleKey); ok {
+		return v.(language.Tag)
+	}
+
+	tag, chosen := s.chosenLocale(c)
+	if !chosen {
+		tag = i18n.Match(c.GetHeader("Accept-Language"))
+		c.Writer.Header().Add("Vary", "Accept-Language")
+	}
+	c.Set(contextLocaleKey, tag)
+	c.Header("Content-Language", tag.String())
+	return tag
+}
+
+// chosenLocale returns the locale the authenticated user of c chose, and
+// whether they chose a supported one.
+func (s *Server) chosenLocale(c *gin.Context) (language.Tag, bool) {
+	username := auth.CurrentUser(c)
+	if username == "" {
+		return language.Und, false
+	}
+	locale, err := s.store.Locale(c.Request.Context(), username)
+	if err != nil {
+		if !errors.Is(err, store.ErrNotFound) {
+			log.Printf("Error fetching locale of %s: %v", username, err)
+		}
+		return language.Und, false
+	}
+	if locale == "" {
+		return language.Und, false
+	}
+	tag, err := i18n.Parse(locale)
+	return tag, err == nil
+}
+
+// tr translates an English string, or format filled in with args, into the
+// language c is answered in.
+func (s *Server) tr(c *gin.Context, format string, args ...interface{}) string {
+	if len(args) == 0 {
+		return i18n.Translate(s.locale(c), format)
+	}
+	return i18n.Sprintf(s.locale(c), format, args...)
+}
+
+// localeHandler returns the locale the authenticated user chose, empty if
+// they are answered in the language their client asks for.
+func (s *Server) localeHandler(c *gin.Context) {
+	username := auth.CurrentUser(c)
+	locale, err := s.store.Locale(c.Request.Context(), username)
+	if err != nil {
+		log.Printf("Error fetching locale of %s: %v", username, err)
+		c.Error(apperr.New(apperr.Internal, "Failed to fetch locale"))
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"locale": locale, "supported": i18n.Names()})
+}
+
+// setLocaleHandler sets the locale the authenticated user is answered in,
+// whatever their client asks for, or clears it with an empty locale.
+func (s *Server) setLocaleHandler(c *gin.Context) {
+	var req struct {
+		Locale *string `json:"locale"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil || req.Locale == nil {
+		c.Error(apperr.New(apperr.InvalidRequest, "Invalid request payload"))
+		return
+	}
+
+	locale := *req.Locale
+	if locale != "" {
+		tag, err := i18n.Parse(locale)
+		if err != nil {
+			c.Error(apperr.Newf(apperr.InvalidRequest, "Unsupported locale %q, expected one of %s", locale, strings.Join(i18n.Names(), ", ")))
+			return
+		}
+		locale = tag.String()
+	}
+
+	username := auth.CurrentUser(c)
+	err := s.store.SetLocale(c.Request.Context(), username, locale)
+	if errors.Is(err, store.ErrNotFound) {
+		c.Error(apperr.New(apperr.UserNotFound, "User not found"))
+		return
+	}
+	if err != nil {
+		log.Printf("Error saving locale of %s: %v", username, err)
+		c.Error(apperr.New(apperr.Internal, "Failed to save locale"))
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"locale": locale, "supported": i18n.Names()})
+}
@@ -0,0 +1,130 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+	"time"
+
+	"backend/apperr"
+	"backend/ratelimit"
+	"backend/service"
+	"backend/store"
+
+	"github.com/gin-gonic/gin"
+)
+
+// lockedOutError is returned by login while the account or address is locked
+// out after too many failed logins.
+type lockedOutError struct {
+	retryAfter time.Duration
+}
+
+func (e *lockedOutError) Error() string {
+	return fmt.Sprintf("login locked out for %s", e.retryAfter)
+}
+
+// retrySeconds rounds a wait up to whole seconds, as Retry-After expects.
+func retrySeconds(d time.Duration) int {
+	return int(math.Ceil(d.Seconds()))
+}
+
+// login logs username in on client unless the account or the client's
+// address is locked out, and records the outcome. If Redis is unavailable
+// logins are let through.
+func (s *Server) login(ctx context.Context, username, password string, client store.SessionClient) (service.TokenPair, error) {
+	ip := client.IP
+	var wait time.Duration
+	for _, l := range []struct {
+		backoff ratelimit.Backoff
+		subject string
+	}{{accountLockout, username}, {ipLockout, ip}} {
+		remaining, err := s.lockout.Locked(ctx, l.backoff, l.subject)
+		if err != nil {
+			log.Printf("Lockout error for %s: %v", l.backoff.Name, err)
+		}
+		wait = max(wait, remaining)
+	}
+	if wait > 0 {
+		s.audit(ctx, store.AuditEntry{Action: auditLoginFailed, Actor: username, Details: map[string]string{"reason": "locked_out"}})
+		return service.TokenPair{}, &lockedOutError{retryAfter: wait}
+	}
+
+	tokens, err := s.sessions.Login(ctx, username, password, client)
+	if errors.Is(err, service.ErrInvalidCredentials) {
+		s.recordFailedLogin(ctx, username, ip)
+		s.audit(ctx, store.AuditEntry{Action: auditLoginFailed, Actor: username, Details: map[string]string{"reason": "invalid_credentials"}})
+		return tokens, err
+	}
+	if err == nil {
+		if err := s.lockout.Reset(ctx, accountLockout, username); err != nil {
+			log.Printf("Error resetting login failures of %s: %v", username, err)
+		}
+		s.audit(ctx, store.AuditEntry{Action: auditLogin, Actor: username})
+	}
+	return tokens, err
+}
+
+// recordFailedLogin counts a failed login against the account and the
+// address it came from.
+func (s *Server) recordFailedLogin(ctx context.Context, username, ip string) {
+	if _, err := s.lockout.Fail(ctx, accountLockout, username); err != nil {
+		log.Printf("Error recording failed login of %s: %v", username, err)
+	}
+	if _, err := s.lockout.Fail(ctx, ipLockout, ip); err != nil {
+		log.Printf("Error recording failed login from %s: %v", ip, err)
+	}
+}
+
+// LockoutStatus is an account's recent failed logins.
+type LockoutStatus struct {
+	Username string `json:"username"`
+	Failures int    `json:"failures"`
+	// LockedUntil is when the account can log in again, nil if it is not
+	// locked out.
+	LockedUntil *time.Time `json:"locked_until,omitempty"`
+}
+
+// accountLockoutHandler reports an account's failed logins and lockout.
+func (s *Server) accountLockoutHandler(c *gin.Context) {
+	username := c.Param("username")
+	failures, remaining, err := s.lockout.Status(c.Request.Context(), accountLockout, username)
+	if err != nil {
+		c.Error(apperr.New(apperr.Internal, "Failed to fetch lockout"))
+		return
+	}
+
+	status := LockoutStatus{Username: username, Failures: failures}
+	if remaining > 0 {
+		until := time.Now().Add(remaining).UTC().Truncate(time.Second)
+		status.LockedUntil = &until
+	}
+	c.JSON(http.StatusOK, status)
+}
+
+// unlockAccountHandler forgets an account's failed logins, lifting its
+// lockout.
+func (s *Server) unlockAccountHandler(c *gin.Context) {
+	if err := s.lockout.Reset(c.Request.Context(), accountLockout, c.Param("username")); err != nil {
+		c.Error(apperr.New(apperr.Internal, "Failed to unlock account"))
+		return
+	}
+	s.audit(c.Request.Context(), store.AuditEntry{Action: auditAccountUnlocked, Target: c.Param("username")})
+
+	c.JSON(http.StatusOK, gin.H{"message": s.tr(c, "Account unlocked successfully")})
+}
+
+// unlockIPHandler forgets the failed logins from an address, lifting its
+// lockout.
+func (s *Server) unlockIPHandler(c *gin.Context) {
+	if err := s.lockout.Reset(c.Request.Context(), ipLockout, c.Param("ip")); err != nil {
+		c.Error(apperr.New(apperr.Internal, "Failed to unlock address"))
+		return
+	}
+	s.audit(c.Request.Context(), store.AuditEntry{Action: auditIPUnlocked, Target: c.Param("ip")})
+
+	c.JSON(http.StatusOK, gin.H{"message": s.tr(c, "Address unlocked successfully")})
+}
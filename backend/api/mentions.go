@@ -0,0 +1,72 @@
+package api
+
+import (
+	"net/http"
+	"slices"
+	"strconv"
+
+	"backend/apperr"
+	"backend/auth"
+	"backend/store"
+	"backend/ws"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Pagination limits for mentions.
+const (
+	defaultMentionsLimit = 20
+	maxMentionsLimit     = 100
+)
+
+// MentionEvent tells a user that a message mentioned them.
+type MentionEvent struct {
+	MessageID string `json:"message_id"`
+	Sender    string `json:"sender"`
+	Content   string `json:"content"`
+}
+
+// mentionsHandler lists messages mentioning the authenticated user, newest first.
+func (s *Server) mentionsHandler(c *gin.Context) {
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", strconv.Itoa(defaultMentionsLimit)))
+	if err != nil || limit <= 0 || limit > maxMentionsLimit {
+		c.Error(apperr.New(apperr.InvalidRequest, "Invalid limit"))
+		return
+	}
+	offset, err := strconv.Atoi(c.DefaultQuery("offset", "0"))
+	if err != nil || offset < 0 {
+		c.Error(apperr.New(apperr.InvalidRequest, "Invalid offset"))
+		return
+	}
+
+	// Fetch one extra row to know whether another page exists.
+	mentions, err := s.store.Mentions(c.Request.Context(), auth.CurrentUser(c), limit+1, offset)
+	if err != nil {
+		c.Error(apperr.New(apperr.Internal, "Failed to fetch mentions"))
+		return
+	}
+
+	hasMore := len(mentions) > limit
+	if hasMore {
+		mentions = mentions[:limit]
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"mentions": mentions,
+		"limit":    limit,
+		"offset":   offset,
+		"has_more": hasMore,
+	})
+}
+
+// publishMention tells the receiver of msg that it mentions them, if it does.
+func (s *Server) publishMention(msg store.Message) {
+	if !slices.Contains(msg.Mentions, msg.Receiver) {
+		return
+	}
+
+	s.publishEvent(ws.Event{
+		Type:    ws.TypeMention,
+		Payload: MentionEvent{MessageID: msg.ID, Sender: msg.Sender, Content: store.Truncate(msg.Content, store.ReplyPreviewLength)},
+	}, msg.Receiver)
+}
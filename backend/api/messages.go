@@ -0,0 +1,472 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"backend/apperr"
+	"backend/auth"
+	"backend/metrics"
+	"backend/service"
+	"backend/store"
+	"backend/ws"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/websocket"
+)
+
+// newUpgrader returns the upgrader of chat WebSockets from allowed origins.
+func newUpgrader(origins originPolicy, compression bool) websocket.Upgrader {
+	return websocket.Upgrader{
+		CheckOrigin:       origins.checkOrigin,
+		EnableCompression: compression,
+		ReadBufferSize:    1024,
+		WriteBufferSize:   1024,
+		Subprotocols:      []string{ws.ProtocolV2Name},
+	}
+}
+
+// wsHandler handles WebSocket connections. Clients select protocol version 2
+// with the chat.v2 subprotocol or ?v=2, and authenticate with a token in the
+// Authorization header, the token query parameter, or an auth frame sent
+// first. Sockets failing authentication are closed with a policy violation.
+func (s *Server) wsHandler(c *gin.Context) {
+	conn, err := s.upgrader.Upgrade(c.Writer, c.Request, nil)
+	if err != nil {
+		http.NotFound(c.Writer, c.Request)
+		return
+	}
+
+	client := ws.NewClient("", conn, ws.NegotiatedVersion(c.Request, conn))
+	frame := authFrame{Token: auth.TokenFromRequest(c), ResumeToken: c.Query("resume_token")}
+	frame.LastSeq, _ = strconv.ParseUint(c.Query("last_seq"), 10, 64)
+	claims, e := s.authenticateSocket(c.Request.Context(), client, &frame)
+	if e != nil {
+		closeSocket(conn, websocket.ClosePolicyViolation, e.Message)
+		return
+	}
+	client.UserID = claims.Username
+
+	// Events for the client queue up from registration on, so none is lost
+	// between the frames replayed on resumption and live delivery.
+	s.registerClient(client)
+	if client.Version >= ws.ProtocolV2 && !s.startSession(client, frame.ResumeToken, frame.LastSeq) {
+		conn.Close()
+		s.unregisterClient(client)
+		return
+	}
+	client.StartReadDeadline()
+	go s.hub.Track(client.WritePump)
+	s.hub.Track(func() { s.serveClient(client, tokenExpiry(claims)) })
+}
+
+// serveClient reads frames from a connected client until it disconnects, or
+// its token expires without the client sending a fresh one.
+func (s *Server) serveClient(client *ws.Client, expiresAt time.Time) {
+	// Requests of the client are cancelled once it disconnects.
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	userID := client.UserID
+
+	expiry := time.AfterFunc(time.Until(expiresAt), func() {
+		closeSocket(client.Conn, websocket.ClosePolicyViolation, "Token expired")
+	})
+	defer expiry.Stop()
+
+	s.setOnline(userID)
+	done := make(chan struct{})
+	go s.runPresenceHeartbeat(userID, done)
+	defer func() {
+		close(done)
+		// Only go offline once the user's last tab has disconnected.
+		if s.unregisterClient(client) {
+			s.setOffline(userID)
+		}
+	}()
+
+	// Deliver whatever arrived while the user was offline; the client
+	// acknowledges each message with a "delivered" frame, or version 2
+	// clients the whole batch with an "ack".
+	s.flushPending(ctx, client)
+
+	for {
+		env, err := client.ReadEnvelope()
+		if errors.Is(err, ws.ErrMalformedFrame) {
+			s.sendError(client, 0, apperr.New(apperr.InvalidRequest, err.Error()))
+			continue
+		}
+		if err != nil {
+			log.Printf("WebSocket read error: %v", err)
+			break
+		}
+
+		// Every frame counts against the limit, not only messages, so a
+		// client cannot flood receivers with typing or receipt events.
+		ok, retryAfter, err := s.limiter.Allow(ctx, frameLimit, userID)
+		if err != nil {
+			log.Printf("Rate limiter error for %s: %v", frameLimit.Name, err)
+		}
+		if !ok {
+			s.sendErrorEvent(client, env.Seq, ErrorEvent{
+				Code:       apperr.RateLimited,
+				Error:      "Too many requests, please try again later",
+				RetryAfter: int(math.Ceil(retryAfter.Seconds())),
+			})
+			continue
+		}
+
+		switch env.Type {
+		case ws.TypeMessage:
+			s.handleInboundMessage(ctx, client, env)
+		case ws.TypeDelivered:
+			var ack struct {
+				ID string `json:"id"`
+			}
+			if err := json.Unmarshal(env.Payload, &ack); err != nil {
+				s.sendError(client, env.Seq, apperr.New(apperr.InvalidRequest, "Invalid delivered event"))
+				continue
+			}
+			if err := s.markDelivered(ctx, ack.ID, userID); err != nil {
+				log.Printf("Error marking message %s delivered: %v", ack.ID, err)
+			}
+		case ws.TypeAck:
+			s.handleAck(ctx, client, env)
+		case ws.TypeTyping:
+			s.handleTyping(ctx, client, env)
+		case ws.TypeReadReceipt:
+			s.handleReadReceipt(ctx, client, env)
+		case ws.TypeAuth:
+			s.handleReauth(ctx, client, env, expiry)
+		default:
+			s.sendError(client, env.Seq, apperr.Newf(apperr.InvalidRequest, "Unsupported event type %q", env.Type))
+		}
+	}
+}
+
+// sendFailure maps an error from MessageService.Send to the error reported
+// to the sender.
+func sendFailure(err error) *apperr.Error {
+	var rejected *service.RejectedError
+	var tooLong *service.ContentTooLongError
+	switch {
+	case errors.As(err, &rejected):
+		e := apperr.New(apperr.ContentRejected, "Message was rejected by the content filter")
+		e.Reasons = rejected.Reasons
+		return e
+	case errors.Is(err, service.ErrBlocked):
+		return apperr.New(apperr.Blocked, "You cannot message this user")
+	case errors.Is(err, service.ErrMissingReceiver):
+		return apperr.New(apperr.InvalidRequest, "Missing receiver")
+	case errors.Is(err, service.ErrUnknownReceiver):
+		return apperr.New(apperr.UserNotFound, "User not found")
+	case errors.Is(err, service.ErrEmptyContent):
+		return apperr.New(apperr.InvalidRequest, "Missing content")
+	case errors.As(err, &tooLong):
+		return apperr.Newf(apperr.TooLarge, "Content is longer than %d characters", tooLong.Max)
+	case errors.Is(err, service.ErrInvalidFormat):
+		return apperr.New(apperr.InvalidRequest, "format must be plain or markdown")
+	case errors.Is(err, service.ErrSendAtInPast):
+		return apperr.New(apperr.SendAtInPast, "send_at must be in the future")
+	case errors.Is(err, store.ErrInvalidReplyTo):
+		return apperr.New(apperr.InvalidReplyTo, err.Error())
+	case errors.Is(err, service.ErrMessageQuota):
+		return apperr.New(apperr.MessageQuota, "Daily message quota exceeded")
+	case errors.Is(err, service.ErrStorageQuota):
+		return apperr.New(apperr.StorageQuota, "Storage quota exceeded")
+	}
+	log.Printf("Error sending message: %v", err)
+	return apperr.New(apperr.Internal, "Failed to send message")
+}
+
+// inboundMessage is a message as clients send it over the WebSocket. The
+// server sets every other field.
+type inboundMessage struct {
+	Receiver  string  `json:"receiver"`
+	Content   string  `json:"content"`
+	Format    string  `json:"format"`
+	ReplyToID *string `json:"reply_to_id"`
+}
+
+// handleInboundMessage sends a message received over the WebSocket.
+func (s *Server) handleInboundMessage(ctx context.Context, client *ws.Client, env ws.Envelope) {
+	var in inboundMessage
+	if err := json.Unmarshal(env.Payload, &in); err != nil {
+		e := apperr.New(apperr.InvalidRequest, "Invalid message")
+		var typeErr *json.UnmarshalTypeError
+		if errors.As(err, &typeErr) {
+			e = apperr.Newf(apperr.InvalidRequest, "Invalid message: %s must be a %s", typeErr.Field, typeErr.Type)
+		}
+		s.sendError(client, env.Seq, e)
+		return
+	}
+	msg := store.Message{Receiver: in.Receiver, Content: in.Content, Format: in.Format, ReplyToID: in.ReplyToID}
+	s.sendInbound(ctx, client, env.Seq, msg, "websocket")
+}
+
+// sendInbound sends a message a streaming client sent over transport,
+// answering its frame seq with an error event if it fails.
+func (s *Server) sendInbound(ctx context.Context, client *ws.Client, seq uint64, msg store.Message, transport string) {
+	ok, retryAfter, err := s.limiter.Allow(ctx, messageLimit, client.UserID)
+	if err != nil {
+		log.Printf("Rate limiter error for %s: %v", messageLimit.Name, err)
+	}
+	if !ok {
+		s.sendErrorEvent(client, seq, ErrorEvent{
+			Code:       apperr.RateLimited,
+			Error:      "Too many messages, please slow down",
+			RetryAfter: int(math.Ceil(retryAfter.Seconds())),
+		})
+		return
+	}
+
+	msg.Sender = client.UserID
+	if err := s.messages.Send(ctx, &msg); err != nil {
+		s.sendError(client, seq, sendFailure(err))
+		return
+	}
+
+	metrics.MessagesSent.WithLabelValues(transport).Inc()
+}
+
+// sendMessageHandler handles sending messages. A message with a send_at
+// time is scheduled instead of sent.
+func (s *Server) sendMessageHandler(c *gin.Context) {
+	var req struct {
+		store.Message
+		SendAt *time.Time `json:"send_at"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.Error(apperr.New(apperr.InvalidRequest, err.Error()))
+		return
+	}
+	msg := req.Message
+	msg.Sender = auth.CurrentUser(c)
+
+	if req.SendAt != nil {
+		s.scheduleMessage(c, msg, *req.SendAt)
+		return
+	}
+
+	if err := s.messages.Send(c.Request.Context(), &msg); err != nil {
+		c.Error(sendFailure(err))
+		return
+	}
+
+	metrics.MessagesSent.WithLabelValues("rest").Inc()
+	c.JSON(http.StatusCreated, gin.H{"message": msg})
+}
+
+// sendBatchHandler handles a bot sending up to service.MaxBatchSize messages
+// at once. They are stored together, so either all are sent or, if one is
+// invalid, none is and the error names its index.
+func (s *Server) sendBatchHandler(c *gin.Context) {
+	var req struct {
+		Messages []store.Message `json:"messages"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.Error(apperr.New(apperr.InvalidRequest, err.Error()))
+		return
+	}
+	msgs := make([]*store.Message, len(req.Messages))
+	for i := range req.Messages {
+		msgs[i] = &req.Messages[i]
+	}
+
+	err := s.messages.SendBatch(c.Request.Context(), auth.CurrentUser(c), msgs)
+	var batchErr *service.BatchError
+	switch {
+	case errors.Is(err, service.ErrEmptyBatch):
+		c.Error(apperr.New(apperr.InvalidRequest, "Missing messages"))
+		return
+	case errors.Is(err, service.ErrBatchTooLarge):
+		c.Error(apperr.Newf(apperr.TooLarge, "A batch may have at most %d messages", service.MaxBatchSize))
+		return
+	case errors.As(err, &batchErr):
+		e := sendFailure(batchErr.Err)
+		e.Message = fmt.Sprintf("messages[%d]: %s", batchErr.Index, e.Message)
+		c.Error(e)
+		return
+	case err != nil:
+		c.Error(sendFailure(err))
+		return
+	}
+
+	metrics.MessagesSent.WithLabelValues("batch").Add(float64(len(msgs)))
+	c.JSON(http.StatusCreated, gin.H{"messages": req.Messages})
+}
+
+// Pagination limits for catching up on a conversation with ?after_seq=.
+const (
+	defaultCatchUpLimit = 100
+	maxCatchUpLimit     = 500
+)
+
+// getMessagesHandler handles fetching all messages of a conversation of the
+// authenticated user. With ?since=<RFC3339> only messages created or updated
+// after that time are returned; with ?limit=<n> only the latest n, served
+// from the message cache when possible; with ?after_seq=<n> the messages
+// after seq n, for clients catching up on a gap.
+func (s *Server) getMessagesHandler(c *gin.Context) {
+	ctx := c.Request.Context()
+	viewer := auth.CurrentUser(c)
+	other, ok := conversationPeer(c)
+	if !ok {
+		return
+	}
+	if _, ok := c.GetQuery("after_seq"); ok {
+		s.catchUpHandler(c, viewer, other)
+		return
+	}
+
+	var since time.Time
+	if v := c.Query("since"); v != "" {
+		var err error
+		if since, err = time.Parse(time.RFC3339, v); err != nil {
+			c.Error(apperr.New(apperr.InvalidRequest, "Invalid since, expected an RFC3339 timestamp"))
+			return
+		}
+	}
+
+	if v := c.Query("limit"); v != "" {
+		limit, err := strconv.Atoi(v)
+		if err != nil || limit <= 0 {
+			c.Error(apperr.New(apperr.InvalidRequest, "Invalid limit"))
+			return
+		}
+		if since.IsZero() {
+			messages, err := s.recentMessages(ctx, viewer, other, limit)
+			if err != nil {
+				log.Printf("Error fetching conversation of %s with %s: %v", viewer, other, err)
+				c.Error(apperr.New(apperr.Internal, "Failed to fetch messages"))
+				return
+			}
+			s.localizeSystemMessages(c, messages)
+			c.JSON(http.StatusOK, gin.H{"messages": messages})
+			return
+		}
+	}
+
+	messages, err := s.store.Conversation(ctx, viewer, other, since)
+	if err != nil {
+		log.Printf("Error fetching conversation of %s with %s: %v", viewer, other, err)
+		c.Error(apperr.New(apperr.Internal, "Failed to fetch messages"))
+		return
+	}
+	s.localizeSystemMessages(c, messages)
+
+	c.JSON(http.StatusOK, gin.H{"messages": messages})
+}
+
+// catchUpHandler returns up to ?limit= messages between viewer and other
+// with a seq above ?after_seq=, in seq order, and whether more follow.
+func (s *Server) catchUpHandler(c *gin.Context, viewer, other string) {
+	afterSeq, err := strconv.ParseInt(c.Query("after_seq"), 10, 64)
+	if err != nil || afterSeq < 0 {
+		c.Error(apperr.New(apperr.InvalidRequest, "Invalid after_seq"))
+		return
+	}
+	if c.Query("since") != "" {
+		c.Error(apperr.New(apperr.InvalidRequest, "after_seq cannot be combined with since"))
+		return
+	}
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", strconv.Itoa(defaultCatchUpLimit)))
+	if err != nil || limit <= 0 || limit > maxCatchUpLimit {
+		c.Error(apperr.New(apperr.InvalidRequest, "Invalid limit"))
+		return
+	}
+
+	// Fetch one extra message to know whether another page exists.
+	messages, err := s.store.MessagesAfterSeq(c.Request.Context(), viewer, other, afterSeq, limit+1)
+	if err != nil {
+		log.Printf("Error fetching conversation of %s with %s after seq %d: %v", viewer, other, afterSeq, err)
+		c.Error(apperr.New(apperr.Internal, "Failed to fetch messages"))
+		return
+	}
+	hasMore := len(messages) > limit
+	if hasMore {
+		messages = messages[:limit]
+	}
+	s.localizeSystemMessages(c, messages)
+
+	c.JSON(http.StatusOK, gin.H{"messages": messages, "has_more": hasMore})
+}
+
+// Pagination limits for reading archived messages.
+const (
+	defaultArchiveLimit = 50
+	maxArchiveLimit     = 200
+)
+
+// archivedMessagesHandler returns up to ?limit= archived messages between
+// the caller and ?receiver=, oldest first, and whether older ones remain.
+// Pages continue with ?before=, the ID of the oldest message returned.
+// Archived months are read one table at a time, so this is slower than
+// reading live messages and is rate limited.
+func (s *Server) archivedMessagesHandler(c *gin.Context) {
+	viewer := auth.CurrentUser(c)
+	other, ok := conversationPeer(c)
+	if !ok {
+		return
+	}
+	before := c.Query("before")
+	if before != "" {
+		if _, err := strconv.Atoi(before); err != nil {
+			c.Error(apperr.New(apperr.InvalidRequest, "Invalid before"))
+			return
+		}
+	}
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", strconv.Itoa(defaultArchiveLimit)))
+	if err != nil || limit <= 0 || limit > maxArchiveLimit {
+		c.Error(apperr.New(apperr.InvalidRequest, "Invalid limit"))
+		return
+	}
+
+	// Fetch one extra message to know whether another page exists.
+	messages, err := s.store.ArchivedMessages(c.Request.Context(), viewer, other, before, limit+1)
+	if errors.Is(err, store.ErrNotFound) {
+		c.Error(apperr.New(apperr.NotFound, "Archived message not found"))
+		return
+	}
+	if err != nil {
+		log.Printf("Error fetching archived messages of %s with %s: %v", viewer, other, err)
+		c.Error(apperr.New(apperr.Internal, "Failed to fetch archived messages"))
+		return
+	}
+	hasMore := len(messages) > limit
+	if hasMore {
+		messages = messages[1:]
+	}
+	s.localizeSystemMessages(c, messages)
+
+	c.JSON(http.StatusOK, gin.H{"messages": messages, "has_more": hasMore})
+}
+
+// recentMessages returns the latest limit messages between viewer and other.
+// On a cache miss the cache is filled if limit fits in it.
+func (s *Server) recentMessages(ctx context.Context, viewer, other string, limit int) ([]store.Message, error) {
+	if messages, ok := s.cache.Recent(ctx, viewer, other, limit); ok {
+		return messages, nil
+	}
+
+	fetch := limit
+	if limit < s.cache.Size() {
+		fetch = s.cache.Size()
+	}
+	messages, err := s.store.RecentMessages(ctx, viewer, other, fetch)
+	if err != nil {
+		return nil, err
+	}
+	s.cache.Fill(ctx, viewer, other, messages)
+
+	if len(messages) > limit {
+		messages = messages[len(messages)-limit:]
+	}
+	return messages, nil
+}
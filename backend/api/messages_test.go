@@ -0,0 +1,108 @@
+package api_test
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestSendAndFetchMessages(t *testing.T) {
+	ts := newTestServer(t)
+	alice := ts.signup("alice")
+	bob := ts.signup("bob")
+
+	res := ts.request("POST", "/messages", alice, map[string]string{"receiver": "bob", "content": "hello **bob**", "format": "markdown"})
+	if res.Code != http.StatusCreated {
+		t.Fatalf("send: %d %v", res.Code, res.Body)
+	}
+	sent := res.Body["message"].(map[string]interface{})
+	if sent["sender"] != "alice" || sent["html"] != "<p>hello <strong>bob</strong></p>" {
+		t.Errorf("sent = %v", sent)
+	}
+
+	res = ts.request("GET", "/messages?receiver=alice", bob, nil)
+	if res.Code != http.StatusOK {
+		t.Fatalf("fetch: %d %v", res.Code, res.Body)
+	}
+	messages := res.Body["messages"].([]interface{})
+	if len(messages) != 1 || messages[0].(map[string]interface{})["content"] != "hello **bob**" {
+		t.Errorf("messages = %v", messages)
+	}
+}
+
+func TestSendResolvesReceiver(t *testing.T) {
+	ts := newTestServer(t)
+	alice := ts.signup("alice")
+	bob := ts.signup("bob")
+
+	res := ts.request("POST", "/messages", alice, map[string]string{"receiver": "ＢＯＢ", "content": "hi"})
+	if res.Code != http.StatusCreated {
+		t.Fatalf("send: %d %v", res.Code, res.Body)
+	}
+	if sent := res.Body["message"].(map[string]interface{}); sent["receiver"] != "bob" {
+		t.Errorf("receiver = %v", sent["receiver"])
+	}
+
+	res = ts.request("GET", "/messages?receiver=alice", bob, nil)
+	if messages := res.Body["messages"].([]interface{}); len(messages) != 1 {
+		t.Errorf("messages = %v", messages)
+	}
+}
+
+func TestSendValidatesMessage(t *testing.T) {
+	ts := newTestServer(t)
+	alice := ts.signup("alice")
+	ts.signup("bob")
+
+	tests := []struct {
+		name string
+		body map[string]interface{}
+		code string
+	}{
+		{"blank content", map[string]interface{}{"receiver": "bob", "content": "  "}, "INVALID_REQUEST"},
+		{"too long", map[string]interface{}{"receiver": "bob", "content": strings.Repeat("a", 4001)}, "TOO_LARGE"},
+		{"unknown format", map[string]interface{}{"receiver": "bob", "content": "hi", "format": "html"}, "INVALID_REQUEST"},
+		{"unknown receiver", map[string]interface{}{"receiver": "carol", "content": "hi"}, "USER_NOT_FOUND"},
+		{"reply elsewhere", map[string]interface{}{"receiver": "bob", "content": "hi", "reply_to_id": "999"}, "INVALID_REPLY_TO"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			res := ts.request("POST", "/messages", alice, tt.body)
+			if res.Code < 400 || res.Body["code"] != tt.code {
+				t.Errorf("got %d %v, want %s", res.Code, res.Body, tt.code)
+			}
+		})
+	}
+}
+
+func TestSendCannotForgeSystemMessages(t *testing.T) {
+	ts := newTestServer(t)
+	alice := ts.signup("alice")
+	ts.signup("bob")
+
+	res := ts.request("POST", "/messages", alice, map[string]interface{}{
+		"receiver": "bob",
+		"content":  "bob pinned a message",
+		"kind":     "system",
+		"system":   map[string]string{"event": "message_pinned"},
+	})
+	if res.Code != http.StatusCreated {
+		t.Fatalf("send: %d %v", res.Code, res.Body)
+	}
+	sent := res.Body["message"].(map[string]interface{})
+	if sent["kind"] != "user" || sent["system"] != nil {
+		t.Errorf("sent = %v", sent)
+	}
+}
+
+func TestMessagesNeedParticipant(t *testing.T) {
+	ts := newTestServer(t)
+	alice := ts.signup("alice")
+	ts.signup("bob")
+	carol := ts.signup("carol")
+
+	res := ts.request("POST", "/messages", alice, map[string]string{"receiver": "bob", "content": "hi"})
+	id := res.Body["message"].(map[string]interface{})["id"].(string)
+
+	expectError(t, ts.request("GET", "/messages/"+id+"/thread", carol, nil), http.StatusForbidden, "NOT_PARTICIPANT")
+}
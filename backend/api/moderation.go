@@ -0,0 +1,98 @@
+package api
+
+import (
+	"net/http"
+	"strconv"
+
+	"backend/apperr"
+	"backend/auth"
+	"backend/moderation"
+
+	"github.com/gin-gonic/gin"
+)
+
+// defaultFlagsLimit is how many flags GET /admin/flags returns by default.
+const defaultFlagsLimit = 100
+
+// getFilterHandler returns the strictness the authenticated user chose for
+// their conversation with the user in the path, and the strictness in effect.
+func (s *Server) getFilterHandler(c *gin.Context) {
+	ctx := c.Request.Context()
+	username := auth.CurrentUser(c)
+	peer := c.Param("username")
+
+	chosen, err := s.store.Strictness(ctx, username, peer)
+	if err != nil {
+		c.Error(apperr.New(apperr.Internal, "Failed to fetch filter settings"))
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"strictness": chosen,
+		"effective":  s.messages.Strictness(ctx, username, peer).String(),
+	})
+}
+
+// updateFilterHandler sets the authenticated user's content filter
+// strictness for their conversation with the user in the path. The stricter
+// of the two participants' settings applies.
+func (s *Server) updateFilterHandler(c *gin.Context) {
+	ctx := c.Request.Context()
+	username := auth.CurrentUser(c)
+	peer := c.Param("username")
+
+	var req struct {
+		Strictness string `json:"strictness"`
+	}
+	if err := c.BindJSON(&req); err != nil {
+		c.Error(apperr.New(apperr.InvalidRequest, "Invalid request payload"))
+		return
+	}
+	strictness, err := moderation.ParseStrictness(req.Strictness)
+	if err != nil {
+		c.Error(apperr.New(apperr.InvalidRequest, "Strictness must be off, low, medium or high"))
+		return
+	}
+
+	exists, err := s.store.UserExists(ctx, peer)
+	if err != nil {
+		c.Error(apperr.New(apperr.Internal, "Failed to fetch user"))
+		return
+	}
+	if !exists {
+		c.Error(apperr.New(apperr.UserNotFound, "User not found"))
+		return
+	}
+
+	if err := s.store.SetStrictness(ctx, username, peer, strictness.String()); err != nil {
+		c.Error(apperr.New(apperr.Internal, "Failed to update filter settings"))
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"strictness": strictness.String(),
+		"effective":  s.messages.Strictness(ctx, username, peer).String(),
+	})
+}
+
+// flagsHandler lists messages the content filter flagged for review, newest
+// first. ?limit= caps how many are returned.
+func (s *Server) flagsHandler(c *gin.Context) {
+	limit := defaultFlagsLimit
+	if v := c.Query("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 {
+			c.Error(apperr.New(apperr.InvalidRequest, "Invalid limit"))
+			return
+		}
+		limit = n
+	}
+
+	flags, err := s.store.Flags(c.Request.Context(), limit)
+	if err != nil {
+		c.Error(apperr.New(apperr.Internal, "Failed to fetch flags"))
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"flags": flags})
+}
@@ -0,0 +1,274 @@
+package api
+
+import (
+	"log"
+	"net/http"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"backend/apperr"
+
+	"github.com/gin-gonic/gin"
+)
+
+// apiVersion is the version of the HTTP API reported in the OpenAPI spec.
+// It changes whenever a route, request or response changes.
+const apiVersion = "1.0.0"
+
+// pathParam matches a Gin path parameter such as :id.
+var pathParam = regexp.MustCompile(`:([A-Za-z_]+)`)
+
+// operation documents a route for the OpenAPI spec. Request and response
+// bodies are given as zero values whose types the schemas are derived from,
+// so the spec follows the structs the handlers actually encode.
+type operation struct {
+	Summary string
+	Tags    []string
+	// Public routes need no access token.
+	Public bool
+	Query  []queryParam
+	// Request is the JSON body, or nil if there is none.
+	Request interface{}
+	// Responses are the successful responses by status.
+	Responses map[int]response
+}
+
+// queryParam documents a query string parameter.
+type queryParam struct {
+	Name        string
+	Description string
+	Type        string
+}
+
+// response documents a response. Body is nil for non-JSON responses.
+type response struct {
+	Description string
+	ContentType string
+	Body        interface{}
+}
+
+// messageResponse is the body of responses that only confirm an action.
+type messageResponse struct {
+	Message string `json:"message"`
+}
+
+// openAPISpec builds the OpenAPI 3 document of routes, relative to the API
+// served under prefix. Every registered route is listed; those missing from
+// routeDocs are logged so they get documented.
+func openAPISpec(routes gin.RoutesInfo, prefix string) map[string]interface{} {
+	schemas := map[string]interface{}{}
+	paths := map[string]map[string]interface{}{}
+
+	schemas["Error"] = structSchema(reflect.TypeOf(apperr.Response{}), schemas)
+
+	for _, route := range routes {
+		ginPath, versioned := strings.CutPrefix(route.Path, prefix)
+		op, ok := routeDocs[route.Method+" "+ginPath]
+		if !ok {
+			log.Printf("OpenAPI: route %s %s is not documented", route.Method, route.Path)
+			op = operation{Summary: "Undocumented"}
+		}
+
+		path := pathParam.ReplaceAllString(ginPath, "{$1}")
+		if paths[path] == nil {
+			paths[path] = map[string]interface{}{}
+			if !versioned {
+				// Operational routes are served outside the API prefix.
+				paths[path]["servers"] = []map[string]string{{"url": "/"}}
+			}
+		}
+		paths[path][strings.ToLower(route.Method)] = op.spec(ginPath, schemas)
+	}
+
+	return map[string]interface{}{
+		"openapi": "3.0.3",
+		"info": map[string]interface{}{
+			"title":   "Real-Time Chat API",
+			"version": apiVersion,
+		},
+		"servers": []map[string]string{{"url": prefix}},
+		"paths":   paths,
+		"components": map[string]interface{}{
+			"schemas": schemas,
+			"securitySchemes": map[string]interface{}{
+				"bearerAuth": map[string]interface{}{"type": "http", "scheme": "bearer", "bearerFormat": "JWT"},
+			},
+		},
+	}
+}
+
+// spec returns the OpenAPI operation object of op, served at ginPath.
+func (op operation) spec(ginPath string, schemas map[string]interface{}) map[string]interface{} {
+	spec := map[string]interface{}{"summary": op.Summary}
+	if len(op.Tags) > 0 {
+		spec["tags"] = op.Tags
+	}
+	if !op.Public {
+		spec["security"] = []map[string][]string{{"bearerAuth": {}}}
+	}
+
+	params := []map[string]interface{}{}
+	for _, match := range pathParam.FindAllStringSubmatch(ginPath, -1) {
+		params = append(params, map[string]interface{}{
+			"name": match[1], "in": "path", "required": true,
+			"schema": map[string]string{"type": "string"},
+		})
+	}
+	for _, q := range op.Query {
+		typ := q.Type
+		if typ == "" {
+			typ = "string"
+		}
+		params = append(params, map[string]interface{}{
+			"name": q.Name, "in": "query", "description": q.Description,
+			"schema": map[string]string{"type": typ},
+		})
+	}
+	if len(params) > 0 {
+		spec["parameters"] = params
+	}
+
+	if op.Request != nil {
+		spec["requestBody"] = map[string]interface{}{
+			"required": true,
+			"content": map[string]interface{}{
+				"application/json": map[string]interface{}{"schema": schemaOf(reflect.TypeOf(op.Request), schemas)},
+			},
+		}
+	}
+
+	responses := map[string]interface{}{
+		"default": map[string]interface{}{
+			"description": "Error",
+			"content": map[string]interface{}{
+				"application/json": map[string]interface{}{"schema": map[string]string{"$ref": "#/components/schemas/Error"}},
+			},
+		},
+	}
+	for status, r := range op.Responses {
+		resp := map[string]interface{}{"description": r.Description}
+		contentType := r.ContentType
+		if contentType == "" {
+			contentType = "application/json"
+		}
+		if r.Body != nil {
+			resp["content"] = map[string]interface{}{
+				contentType: map[string]interface{}{"schema": schemaOf(reflect.TypeOf(r.Body), schemas)},
+			}
+		} else if r.ContentType != "" {
+			resp["content"] = map[string]interface{}{
+				contentType: map[string]interface{}{"schema": map[string]string{"type": "string", "format": "binary"}},
+			}
+		}
+		responses[strconv.Itoa(status)] = resp
+	}
+	spec["responses"] = responses
+	return spec
+}
+
+var timeType = reflect.TypeOf(time.Time{})
+
+// schemaOf returns the JSON schema of t as encoding/json encodes it. Named
+// structs are added to schemas and referenced.
+func schemaOf(t reflect.Type, schemas map[string]interface{}) map[string]interface{} {
+	switch {
+	case t == timeType:
+		return map[string]interface{}{"type": "string", "format": "date-time"}
+	case t.Kind() == reflect.Ptr:
+		s := schemaOf(t.Elem(), schemas)
+		if _, ref := s["$ref"]; ref {
+			return map[string]interface{}{"allOf": []interface{}{s}, "nullable": true}
+		}
+		s["nullable"] = true
+		return s
+	}
+
+	switch t.Kind() {
+	case reflect.String:
+		return map[string]interface{}{"type": "string"}
+	case reflect.Bool:
+		return map[string]interface{}{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return map[string]interface{}{"type": "integer"}
+	case reflect.Float32, reflect.Float64:
+		return map[string]interface{}{"type": "number"}
+	case reflect.Slice, reflect.Array:
+		return map[string]interface{}{"type": "array", "items": schemaOf(t.Elem(), schemas)}
+	case reflect.Map:
+		return map[string]interface{}{"type": "object", "additionalProperties": schemaOf(t.Elem(), schemas)}
+	case reflect.Struct:
+		if t.Name() == "" {
+			return structSchema(t, schemas)
+		}
+		if _, ok := schemas[t.Name()]; !ok {
+			// Reserve the name first so recursive types terminate.
+			schemas[t.Name()] = nil
+			schemas[t.Name()] = structSchema(t, schemas)
+		}
+		return map[string]interface{}{"$ref": "#/components/schemas/" + t.Name()}
+	}
+	return map[string]interface{}{}
+}
+
+// structSchema returns the object schema of a struct type, flattening
+// embedded structs like encoding/json does.
+func structSchema(t reflect.Type, schemas map[string]interface{}) map[string]interface{} {
+	properties := map[string]interface{}{}
+	var required []string
+
+	var addFields func(t reflect.Type)
+	addFields = func(t reflect.Type) {
+		for i := 0; i < t.NumField(); i++ {
+			f := t.Field(i)
+			tag := f.Tag.Get("json")
+			if tag == "-" || (!f.IsExported() && !f.Anonymous) {
+				continue
+			}
+			name, opts, _ := strings.Cut(tag, ",")
+			if f.Anonymous && name == "" && f.Type.Kind() == reflect.Struct {
+				addFields(f.Type)
+				continue
+			}
+			if name == "" {
+				name = f.Name
+			}
+			properties[name] = schemaOf(f.Type, schemas)
+			if !strings.Contains(opts, "omitempty") && f.Type.Kind() != reflect.Ptr {
+				required = append(required, name)
+			}
+		}
+	}
+	addFields(t)
+
+	s := map[string]interface{}{"type": "object", "properties": properties}
+	if len(required) > 0 {
+		sort.Strings(required)
+		s["required"] = required
+	}
+	return s
+}
+
+// swaggerUI is a page rendering the spec with Swagger UI.
+const swaggerUI = `<!DOCTYPE html>
+<html>
+<head>
+<title>Real-Time Chat API</title>
+<link rel="stylesheet" href="https://unpkg.com/swagger-ui-dist@5/swagger-ui.css">
+</head>
+<body>
+<div id="swagger-ui"></div>
+<script src="https://unpkg.com/swagger-ui-dist@5/swagger-ui-bundle.js"></script>
+<script>SwaggerUIBundle({url: "openapi.json", dom_id: "#swagger-ui"});</script>
+</body>
+</html>
+`
+
+// docsHandler serves Swagger UI.
+func docsHandler(c *gin.Context) {
+	c.Data(http.StatusOK, "text/html; charset=utf-8", []byte(swaggerUI))
+}
@@ -0,0 +1,660 @@
+package api
+
+import (
+	"net/http"
+	"time"
+
+	"backend/service"
+	"backend/store"
+)
+
+// Request and response bodies documented in routeDocs that handlers build
+// inline.
+type (
+	credentialsRequest struct {
+		Username string `json:"username"`
+		Password string `json:"password"`
+	}
+	signupRequest struct {
+		Username string `json:"username"`
+		Password string `json:"password"`
+		Email    string `json:"email,omitempty"`
+	}
+	tokenResponse struct {
+		Token        string `json:"token"`
+		RefreshToken string `json:"refresh_token"`
+		CSRFToken    string `json:"csrf_token,omitempty"`
+	}
+	sessionResponse struct {
+		Message      string `json:"message"`
+		Token        string `json:"token"`
+		RefreshToken string `json:"refresh_token"`
+		CSRFToken    string `json:"csrf_token,omitempty"`
+	}
+	refreshRequest struct {
+		RefreshToken string `json:"refresh_token"`
+	}
+	sendMessageRequest struct {
+		Receiver  string     `json:"receiver"`
+		Content   string     `json:"content"`
+		Format    string     `json:"format,omitempty"`
+		ReplyToID *string    `json:"reply_to_id,omitempty"`
+		SendAt    *time.Time `json:"send_at,omitempty"`
+	}
+	batchedMessage struct {
+		Receiver  string  `json:"receiver"`
+		Content   string  `json:"content"`
+		Format    string  `json:"format,omitempty"`
+		ReplyToID *string `json:"reply_to_id,omitempty"`
+	}
+	sendBatchRequest struct {
+		Messages []batchedMessage `json:"messages"`
+	}
+	messageBody struct {
+		Message store.Message `json:"message"`
+	}
+	analyticsSetting struct {
+		Enabled bool `json:"enabled"`
+	}
+	localeSetting struct {
+		Locale    string   `json:"locale"`
+		Supported []string `json:"supported"`
+	}
+	messagesBody struct {
+		Messages []store.Message `json:"messages"`
+	}
+	pageInfo struct {
+		Limit   int  `json:"limit"`
+		Offset  int  `json:"offset"`
+		HasMore bool `json:"has_more"`
+	}
+	filterBody struct {
+		Strictness string `json:"strictness"`
+		Effective  string `json:"effective"`
+	}
+	ttlBody struct {
+		TTLSeconds int `json:"ttl_seconds"`
+	}
+	draftRequest struct {
+		Content   string  `json:"content"`
+		ReplyToID *string `json:"reply_to_id,omitempty"`
+	}
+	apiKeyRequest struct {
+		Name string `json:"name"`
+	}
+	webhookRequest struct {
+		URL    string   `json:"url"`
+		Secret string   `json:"secret,omitempty"`
+		Events []string `json:"events"`
+		Bot    string   `json:"bot,omitempty"`
+	}
+	botRequest struct {
+		Username string `json:"username"`
+	}
+	botsBody struct {
+		Bots []store.Bot `json:"bots"`
+	}
+	commandRequest struct {
+		Description string `json:"description"`
+	}
+	commandsBody struct {
+		Commands []store.Command `json:"commands"`
+	}
+	incomingHookRequest struct {
+		Name     string `json:"name"`
+		Bot      string `json:"bot"`
+		Receiver string `json:"receiver"`
+	}
+	incomingHooksBody struct {
+		Hooks []store.IncomingHook `json:"hooks"`
+	}
+	webhooksBody struct {
+		Webhooks []store.Webhook `json:"webhooks"`
+	}
+	deliveriesBody struct {
+		Deliveries []store.WebhookDelivery `json:"deliveries"`
+	}
+	apiKeysBody struct {
+		APIKeys []store.APIKey `json:"api_keys"`
+	}
+	userAPIKeyRequest struct {
+		Name  string `json:"name"`
+		Scope string `json:"scope"`
+	}
+	userAPIKeysBody struct {
+		APIKeys []store.UserAPIKey `json:"api_keys"`
+	}
+	sessionsBody struct {
+		Sessions []store.Session `json:"sessions"`
+	}
+	graphQLResponse struct {
+		Data   map[string]interface{} `json:"data,omitempty"`
+		Errors []struct {
+			Message    string                 `json:"message"`
+			Path       []interface{}          `json:"path,omitempty"`
+			Extensions map[string]interface{} `json:"extensions,omitempty"`
+		} `json:"errors,omitempty"`
+	}
+)
+
+// routeDocs documents every route for the OpenAPI spec, keyed by method and
+// Gin path. New routes must be added here.
+var routeDocs = map[string]operation{
+	"GET /metrics": {Summary: "Prometheus metrics", Tags: []string{"operations"}, Public: true,
+		Responses: map[int]response{http.StatusOK: {Description: "Metrics in the Prometheus text format", ContentType: "text/plain"}}},
+	"GET /healthz": {Summary: "Liveness probe", Tags: []string{"operations"}, Public: true,
+		Responses: map[int]response{http.StatusOK: {Description: "The process is up", Body: struct {
+			Status string `json:"status"`
+		}{}}}},
+	"GET /readyz": {Summary: "Readiness probe, checking Postgres, Redis and migrations", Tags: []string{"operations"}, Public: true,
+		Responses: map[int]response{http.StatusOK: {Description: "Ready to serve"}}},
+	"GET /openapi.json": {Summary: "This OpenAPI document", Tags: []string{"operations"}, Public: true,
+		Responses: map[int]response{http.StatusOK: {Description: "OpenAPI 3 document"}}},
+	"GET /docs": {Summary: "Swagger UI for this API", Tags: []string{"operations"}, Public: true,
+		Responses: map[int]response{http.StatusOK: {Description: "HTML page", ContentType: "text/html"}}},
+
+	"POST /signup": {Summary: "Create an account", Tags: []string{"auth"}, Public: true, Request: signupRequest{},
+		Responses: map[int]response{http.StatusOK: {Description: "Signed up", Body: messageResponse{}}}},
+	"POST /login": {Summary: "Log in and receive a token pair", Tags: []string{"auth"}, Public: true, Request: credentialsRequest{},
+		Responses: map[int]response{http.StatusOK: {Description: "Logged in", Body: sessionResponse{}}}},
+	"POST /token/refresh": {Summary: "Exchange a refresh token for a new token pair", Tags: []string{"auth"}, Public: true, Request: refreshRequest{},
+		Responses: map[int]response{http.StatusOK: {Description: "New token pair", Body: tokenResponse{}}}},
+	"POST /logout": {Summary: "Revoke a refresh token", Tags: []string{"auth"}, Public: true, Request: refreshRequest{},
+		Responses: map[int]response{http.StatusOK: {Description: "Logged out", Body: messageResponse{}}}},
+	"POST /password/forgot": {Summary: "Email a password reset link", Tags: []string{"auth"}, Public: true, Request: struct {
+		Email string `json:"email"`
+	}{}, Responses: map[int]response{http.StatusOK: {Description: "Sent if the account exists", Body: messageResponse{}}}},
+	"POST /password/reset": {Summary: "Set a new password with a reset token", Tags: []string{"auth"}, Public: true, Request: struct {
+		Token    string `json:"token"`
+		Password string `json:"password"`
+	}{}, Responses: map[int]response{http.StatusOK: {Description: "Password reset", Body: messageResponse{}}}},
+	"POST /email/verify": {Summary: "Verify an email address with the token emailed to it", Tags: []string{"auth"}, Public: true, Request: struct {
+		Token string `json:"token"`
+	}{}, Responses: map[int]response{http.StatusOK: {Description: "Email verified", Body: messageResponse{}}}},
+	"POST /email/verify/resend": {Summary: "Email a new verification link", Tags: []string{"auth"}, Public: true, Request: struct {
+		Email string `json:"email"`
+	}{}, Responses: map[int]response{http.StatusOK: {Description: "Sent if the account exists and is unverified", Body: messageResponse{}}}},
+
+	"GET /commands": {Summary: "List the slash commands bots registered", Tags: []string{"bots"},
+		Responses: map[int]response{http.StatusOK: {Description: "The commands", Body: commandsBody{}}}},
+	"PUT /bot/commands/:name": {Summary: "Register a slash command for the calling bot, or update its description", Tags: []string{"bots"}, Request: commandRequest{},
+		Responses: map[int]response{http.StatusOK: {Description: "Registered", Body: store.Command{}}}},
+	"DELETE /bot/commands/:name": {Summary: "Delete a slash command the calling bot registered", Tags: []string{"bots"},
+		Responses: map[int]response{http.StatusOK: {Description: "Deleted", Body: messageResponse{}}}},
+	"GET /users": {Summary: "List users the caller can message", Tags: []string{"users"},
+		Responses: map[int]response{http.StatusOK: {Description: "Usernames", Body: struct {
+			Users []string `json:"users"`
+		}{}}}},
+	"GET /users/:username/presence": {Summary: "Whether a user is online, or when they were last seen", Tags: []string{"users"},
+		Responses: map[int]response{http.StatusOK: {Description: "Presence", Body: PresenceEvent{}}}},
+	"GET /status": {Summary: "The caller's availability and custom status", Tags: []string{"users"},
+		Responses: map[int]response{http.StatusOK: {Description: "Status", Body: store.UserStatus{}}}},
+	"PUT /status": {Summary: "Set the caller's status, for a while or until changed; dnd silences push notifications", Tags: []string{"users"},
+		Request: struct {
+			Availability    string `json:"availability"`
+			Text            string `json:"text,omitempty"`
+			Emoji           string `json:"emoji,omitempty"`
+			DurationSeconds int    `json:"duration_seconds,omitempty"`
+		}{},
+		Responses: map[int]response{http.StatusOK: {Description: "Status", Body: store.UserStatus{}}}},
+	"DELETE /status": {Summary: "Reset the caller's status to available", Tags: []string{"users"},
+		Responses: map[int]response{http.StatusOK: {Description: "Status", Body: store.UserStatus{}}}},
+	"POST /users/:username/block": {Summary: "Block a user", Tags: []string{"users"},
+		Responses: map[int]response{http.StatusOK: {Description: "Blocked", Body: messageResponse{}}}},
+	"DELETE /users/:username/block": {Summary: "Unblock a user", Tags: []string{"users"},
+		Responses: map[int]response{http.StatusOK: {Description: "Unblocked", Body: messageResponse{}}}},
+
+	"POST /messages": {Summary: "Send a message, or schedule it with send_at", Tags: []string{"messages"}, Request: sendMessageRequest{},
+		Responses: map[int]response{
+			http.StatusCreated: {Description: "Sent", Body: messageBody{}},
+			http.StatusAccepted: {Description: "Scheduled", Body: struct {
+				ScheduledMessage store.ScheduledMessage `json:"scheduled_message"`
+			}{}},
+		}},
+	"POST /messages/batch": {Summary: "Send up to 100 messages at once as a bot, all or none", Tags: []string{"bots"}, Request: sendBatchRequest{},
+		Responses: map[int]response{http.StatusCreated: {Description: "Sent, in the order given", Body: messagesBody{}}}},
+	"GET /messages": {Summary: "A conversation of the caller, oldest first", Tags: []string{"messages"},
+		Query: []queryParam{
+			{Name: "receiver", Description: "The other participant, or the caller if sender is the other participant"},
+			{Name: "sender", Description: "Defaults to the caller; one of sender and receiver must be the caller"},
+			{Name: "since", Description: "Only messages created or updated after this RFC3339 time"},
+			{Name: "limit", Description: "Only the latest n messages, or with after_seq at most n (default 100, at most 500)", Type: "integer"},
+			{Name: "after_seq", Description: "Only messages with a higher seq, in seq order, with has_more set if more follow", Type: "integer"},
+		},
+		Responses: map[int]response{http.StatusOK: {Description: "Messages", Body: messagesBody{}}}},
+	"GET /messages/search": {Summary: "Full-text search of the caller's messages", Tags: []string{"messages"},
+		Query: []queryParam{
+			{Name: "q", Description: "Search query"},
+			{Name: "limit", Type: "integer"},
+			{Name: "offset", Type: "integer"},
+		},
+		Responses: map[int]response{http.StatusOK: {Description: "Results", Body: struct {
+			Results []store.SearchResult `json:"results"`
+			pageInfo
+		}{}}}},
+	"GET /messages/top": {Summary: "Highest scoring messages of a conversation", Tags: []string{"messages"},
+		Query: []queryParam{
+			{Name: "room", Description: "The other participant"},
+			{Name: "since", Description: "Only messages sent after this RFC3339 time"},
+			{Name: "limit", Type: "integer"},
+		},
+		Responses: map[int]response{http.StatusOK: {Description: "Messages, highest score first", Body: messagesBody{}}}},
+	"GET /messages/archive": {Summary: "Archived messages of a conversation, oldest first", Tags: []string{"messages"},
+		Query: []queryParam{
+			{Name: "receiver", Description: "The other participant, or the caller if sender is the other participant"},
+			{Name: "sender", Description: "Defaults to the caller; one of sender and receiver must be the caller"},
+			{Name: "before", Description: "Only messages sent before this archived message, for the next page", Type: "integer"},
+			{Name: "limit", Description: "At most n of the latest messages (default 50, at most 200), with has_more set if older ones remain", Type: "integer"},
+		},
+		Responses: map[int]response{http.StatusOK: {Description: "Archived messages", Body: struct {
+			messagesBody
+			HasMore bool `json:"has_more"`
+		}{}}}},
+	"GET /mentions": {Summary: "Messages mentioning the caller, newest first", Tags: []string{"messages"},
+		Query: []queryParam{{Name: "limit", Type: "integer"}, {Name: "offset", Type: "integer"}},
+		Responses: map[int]response{http.StatusOK: {Description: "Mentions", Body: struct {
+			Mentions []store.Mention `json:"mentions"`
+			pageInfo
+		}{}}}},
+	"GET /messages/scheduled": {Summary: "The caller's pending scheduled messages", Tags: []string{"messages"},
+		Responses: map[int]response{http.StatusOK: {Description: "Scheduled messages, soonest first", Body: struct {
+			ScheduledMessages []store.ScheduledMessage `json:"scheduled_messages"`
+		}{}}}},
+	"DELETE /messages/scheduled/:id": {Summary: "Cancel a scheduled message", Tags: []string{"messages"},
+		Responses: map[int]response{http.StatusOK: {Description: "Cancelled", Body: messageResponse{}}}},
+	"POST /messages/:id/vote": {Summary: "Set the caller's vote; send an Idempotency-Key header to make retries safe", Tags: []string{"votes"},
+		Request: struct {
+			Direction string `json:"direction"`
+		}{},
+		Responses: map[int]response{http.StatusOK: {Description: "New totals", Body: service.Tally{}}}},
+	"POST /messages/:id/upvote": {Summary: "Toggle the caller's upvote", Tags: []string{"votes"},
+		Responses: map[int]response{http.StatusOK: {Description: "New totals", Body: struct {
+			Message   string `json:"message"`
+			Upvotes   int    `json:"upvotes"`
+			Downvotes int    `json:"downvotes"`
+		}{}}}},
+	"POST /messages/:id/downvote": {Summary: "Toggle the caller's downvote", Tags: []string{"votes"},
+		Responses: map[int]response{http.StatusOK: {Description: "New totals", Body: struct {
+			Message   string `json:"message"`
+			Upvotes   int    `json:"upvotes"`
+			Downvotes int    `json:"downvotes"`
+		}{}}}},
+	"POST /messages/:id/read": {Summary: "Mark a message and earlier ones read", Tags: []string{"messages"},
+		Responses: map[int]response{http.StatusOK: {Description: "Marked read", Body: messageResponse{}}}},
+	"POST /read-state/sync": {Summary: "Apply the caller's read positions in many conversations at once", Tags: []string{"messages"}, Request: []ReadPosition{},
+		Responses: map[int]response{http.StatusOK: {Description: "The outcome of each position, in the order given", Body: struct {
+			Results []ReadPositionResult `json:"results"`
+		}{}}}},
+	"DELETE /messages/:id": {Summary: "Delete a message for the caller or, for its sender, everyone", Tags: []string{"messages"},
+		Query:     []queryParam{{Name: "scope", Description: "me (default) or everyone"}},
+		Responses: map[int]response{http.StatusOK: {Description: "Deleted", Body: messageResponse{}}}},
+	"GET /messages/:id/thread": {Summary: "The reply thread containing a message", Tags: []string{"messages"},
+		Responses: map[int]response{http.StatusOK: {Description: "Thread, oldest first", Body: struct {
+			RootID   string          `json:"root_id"`
+			Messages []store.Message `json:"messages"`
+		}{}}}},
+	"POST /messages/attachments": {Summary: "Send a file as multipart form data with file, receiver and an optional content caption", Tags: []string{"messages"},
+		Responses: map[int]response{http.StatusCreated: {Description: "Sent", Body: messageBody{}}}},
+	"GET /attachments/:id": {Summary: "Download an attachment; with S3 storage, redirects to a presigned URL", Tags: []string{"messages"},
+		Query: []queryParam{{Name: "redirect", Description: "false returns the presigned URL as JSON instead of redirecting"}},
+		Responses: map[int]response{
+			http.StatusOK:    {Description: "The file", ContentType: "application/octet-stream"},
+			http.StatusFound: {Description: "Redirect to a presigned URL"},
+		}},
+	"GET /attachments/:id/thumbnail": {Summary: "Download the thumbnail of an image attachment, once rendered; with S3 storage, redirects to a presigned URL", Tags: []string{"messages"},
+		Query: []queryParam{{Name: "redirect", Description: "false returns the presigned URL as JSON instead of redirecting"}},
+		Responses: map[int]response{
+			http.StatusOK:    {Description: "The thumbnail, JPEG or PNG", ContentType: "application/octet-stream"},
+			http.StatusFound: {Description: "Redirect to a presigned URL"},
+		}},
+	"POST /attachments/uploads": {Summary: "Start a direct upload to S3 storage; PUT the file to upload_url, then send it", Tags: []string{"messages"},
+		Request: struct {
+			Filename    string `json:"filename"`
+			ContentType string `json:"content_type"`
+			Size        int64  `json:"size"`
+		}{},
+		Responses: map[int]response{http.StatusCreated: {Description: "Upload started", Body: struct {
+			Upload    store.Upload      `json:"upload"`
+			UploadURL string            `json:"upload_url"`
+			Method    string            `json:"method"`
+			Headers   map[string]string `json:"headers"`
+		}{}}}},
+	"POST /attachments/uploads/:id/send": {Summary: "Send a directly uploaded file as a message", Tags: []string{"messages"},
+		Request: struct {
+			Receiver string `json:"receiver"`
+			Content  string `json:"content,omitempty"`
+		}{},
+		Responses: map[int]response{http.StatusCreated: {Description: "Sent", Body: messageBody{}}}},
+	"GET /ws": {Summary: "Open a WebSocket; see the README for the protocol and its auth frame", Tags: []string{"messages"}, Public: true,
+		Query: []queryParam{
+			{Name: "v", Description: "2 selects protocol version 2", Type: "integer"},
+			{Name: "token", Description: "Access or bot token, unless sent in the Authorization header or an auth frame"},
+		},
+		Responses: map[int]response{http.StatusSwitchingProtocols: {Description: "Upgraded"}}},
+	"POST /hooks/:token": {Summary: "Post a Slack-style incoming webhook payload as a message; the token authenticates the call", Tags: []string{"bots"}, Public: true, Request: SlackMessage{},
+		Responses: map[int]response{http.StatusOK: {Description: "Sent", ContentType: "text/plain"}}},
+	"GET /events": {Summary: "Stream the WebSocket events as Server-Sent Events; see the README", Tags: []string{"messages"},
+		Query: []queryParam{
+			{Name: "token", Description: "Access token, for EventSource clients that cannot set headers"},
+			{Name: "last_event_id", Description: "Resume after this message ID, like the Last-Event-ID header"},
+		},
+		Responses: map[int]response{http.StatusOK: {Description: "The event stream", ContentType: "text/event-stream"}}},
+	"POST /graphql": {Summary: "Run a GraphQL query; see the README for the schema", Tags: []string{"messages"}, Request: graphQLRequest{},
+		Responses: map[int]response{http.StatusOK: {Description: "The result, with any errors", Body: graphQLResponse{}}}},
+	"GET /graphql": {Summary: "Open a WebSocket for GraphQL subscriptions using the graphql-transport-ws protocol", Tags: []string{"messages"},
+		Responses: map[int]response{http.StatusSwitchingProtocols: {Description: "Upgraded"}}},
+
+	"PUT /account/password": {Summary: "Change the caller's password", Tags: []string{"account"}, Request: struct {
+		OldPassword string `json:"old_password"`
+		NewPassword string `json:"new_password"`
+	}{}, Responses: map[int]response{http.StatusOK: {Description: "Changed; other sessions are revoked", Body: sessionResponse{}}}},
+	"PUT /account/username": {Summary: "Rename the caller", Tags: []string{"account"}, Request: credentialsRequest{},
+		Responses: map[int]response{http.StatusOK: {Description: "Renamed; sessions of the old name are revoked", Body: struct {
+			sessionResponse
+			Username string `json:"username"`
+		}{}}}},
+	"DELETE /account": {Summary: "Delete the caller's account", Tags: []string{"account"}, Request: struct {
+		Password string `json:"password"`
+	}{}, Responses: map[int]response{http.StatusAccepted: {Description: "Deletion scheduled", Body: messageResponse{}}}},
+	"GET /account/export": {Summary: "Zip archive of the caller's personal data", Tags: []string{"account"},
+		Responses: map[int]response{http.StatusOK: {Description: "Archive", ContentType: "application/zip"}}},
+	"GET /account/usage": {Summary: "Messages the caller sent and files they store, against their quotas", Tags: []string{"account"},
+		Responses: map[int]response{http.StatusOK: {Description: "Usage", Body: AccountUsage{}}}},
+	"POST /account/api-keys": {Summary: "Create an API key acting as the caller, read or send only; the key is only shown once", Tags: []string{"account"}, Request: userAPIKeyRequest{},
+		Responses: map[int]response{http.StatusCreated: {Description: "Created", Body: UserAPIKeyCreated{}}}},
+	"GET /account/api-keys": {Summary: "List the caller's API keys that were not revoked", Tags: []string{"account"},
+		Responses: map[int]response{http.StatusOK: {Description: "API keys", Body: userAPIKeysBody{}}}},
+	"DELETE /account/api-keys/:id": {Summary: "Revoke one of the caller's API keys", Tags: []string{"account"},
+		Responses: map[int]response{http.StatusOK: {Description: "Revoked", Body: messageResponse{}}}},
+	"GET /account/sessions": {Summary: "List the devices the caller is logged in on, most recently active first", Tags: []string{"account"},
+		Responses: map[int]response{http.StatusOK: {Description: "Sessions", Body: sessionsBody{}}}},
+	"DELETE /account/sessions/:id": {Summary: "Log the caller out of one of their sessions", Tags: []string{"account"},
+		Responses: map[int]response{http.StatusOK: {Description: "Revoked", Body: messageResponse{}}}},
+	"GET /account/analytics": {Summary: "Whether the caller takes part in usage analytics", Tags: []string{"account"},
+		Responses: map[int]response{http.StatusOK: {Description: "Analytics setting", Body: analyticsSetting{}}}},
+	"PUT /account/analytics": {Summary: "Opt the caller in or out of usage analytics", Tags: []string{"account"}, Request: analyticsSetting{},
+		Responses: map[int]response{http.StatusOK: {Description: "Saved", Body: analyticsSetting{}}}},
+	"GET /account/locale": {Summary: "The locale the caller chose to be answered in, and the supported ones", Tags: []string{"account"},
+		Responses: map[int]response{http.StatusOK: {Description: "Locale setting", Body: localeSetting{}}}},
+	"PUT /account/locale": {Summary: "Choose the locale the caller is answered in, or clear it", Tags: []string{"account"}, Request: localeSetting{},
+		Responses: map[int]response{http.StatusOK: {Description: "Saved", Body: localeSetting{}}}},
+
+	"POST /devices": {Summary: "Register a push notification device", Tags: []string{"notifications"}, Request: store.Device{},
+		Responses: map[int]response{http.StatusCreated: {Description: "Registered", Body: struct {
+			Device store.Device `json:"device"`
+		}{}}}},
+	"DELETE /devices/:id": {Summary: "Unregister a device", Tags: []string{"notifications"},
+		Responses: map[int]response{http.StatusOK: {Description: "Unregistered", Body: messageResponse{}}}},
+	"GET /notifications/preferences": {Summary: "The caller's notification preferences", Tags: []string{"notifications"},
+		Responses: map[int]response{http.StatusOK: {Description: "Preferences", Body: store.NotificationPreferences{}}}},
+	"PUT /notifications/preferences": {Summary: "Change notification preferences; omitted fields are kept", Tags: []string{"notifications"},
+		Request: struct {
+			PushEnabled *bool             `json:"push_enabled"`
+			ShowPreview *bool             `json:"show_preview"`
+			QuietHours  *store.QuietHours `json:"quiet_hours"`
+		}{},
+		Responses: map[int]response{http.StatusOK: {Description: "Preferences", Body: store.NotificationPreferences{}}}},
+	"GET /notifications/mutes": {Summary: "Conversations the caller muted", Tags: []string{"notifications"},
+		Responses: map[int]response{http.StatusOK: {Description: "Mutes", Body: struct {
+			Mutes []store.Mute `json:"mutes"`
+		}{}}}},
+	"GET /notifications/vapid-key": {Summary: "The Web Push public key", Tags: []string{"notifications"},
+		Responses: map[int]response{http.StatusOK: {Description: "Key", Body: struct {
+			PublicKey string `json:"public_key"`
+		}{}}}},
+
+	"GET /conversations/:username/filter": {Summary: "Content filter strictness of a conversation", Tags: []string{"conversations"},
+		Responses: map[int]response{http.StatusOK: {Description: "The caller's choice and the strictness in effect", Body: filterBody{}}}},
+	"PUT /conversations/:username/filter": {Summary: "Choose the content filter strictness of a conversation", Tags: []string{"conversations"},
+		Request: struct {
+			Strictness string `json:"strictness"`
+		}{},
+		Responses: map[int]response{http.StatusOK: {Description: "Updated", Body: filterBody{}}}},
+	"GET /conversations/:username/disappearing": {Summary: "Disappearing messages setting of a conversation", Tags: []string{"conversations"},
+		Responses: map[int]response{http.StatusOK: {Description: "0 if messages do not disappear", Body: ttlBody{}}}},
+	"PUT /conversations/:username/disappearing": {Summary: "Turn disappearing messages on or off", Tags: []string{"conversations"}, Request: ttlBody{},
+		Responses: map[int]response{http.StatusOK: {Description: "Updated", Body: ttlBody{}}}},
+	"PUT /conversations/:username/mute": {Summary: "Mute push notifications of a conversation, for a while or until unmuted", Tags: []string{"conversations"},
+		Request: struct {
+			DurationSeconds int `json:"duration_seconds,omitempty"`
+		}{},
+		Responses: map[int]response{http.StatusOK: {Description: "Muted", Body: struct {
+			Mute store.Mute `json:"mute"`
+		}{}}}},
+	"DELETE /conversations/:username/mute": {Summary: "Unmute a conversation", Tags: []string{"conversations"},
+		Responses: map[int]response{http.StatusOK: {Description: "Unmuted", Body: messageResponse{}}}},
+	"GET /conversations/:username/draft": {Summary: "The caller's draft for a conversation", Tags: []string{"conversations"},
+		Responses: map[int]response{http.StatusOK: {Description: "Draft", Body: struct {
+			Draft Draft `json:"draft"`
+		}{}}}},
+	"PUT /conversations/:username/draft": {Summary: "Save the caller's draft for a conversation", Tags: []string{"conversations"}, Request: draftRequest{},
+		Responses: map[int]response{http.StatusOK: {Description: "Saved", Body: struct {
+			Draft Draft `json:"draft"`
+		}{}}}},
+	"DELETE /conversations/:username/draft": {Summary: "Discard the caller's draft for a conversation", Tags: []string{"conversations"},
+		Responses: map[int]response{http.StatusOK: {Description: "Discarded", Body: messageResponse{}}}},
+	"GET /conversations/:username/export": {Summary: "Download a conversation as JSON or CSV", Tags: []string{"conversations"},
+		Query:     []queryParam{{Name: "format", Description: "json (default) or csv"}},
+		Responses: map[int]response{http.StatusOK: {Description: "The conversation, oldest first", Body: []store.Message{}}}},
+	"GET /conversations/:username/pins": {Summary: "Pinned messages of a conversation", Tags: []string{"conversations"},
+		Responses: map[int]response{http.StatusOK: {Description: "Most recently pinned first", Body: struct {
+			PinnedMessages []store.PinnedMessage `json:"pinned_messages"`
+		}{}}}},
+	"POST /conversations/:username/pins/:id": {Summary: "Pin a message", Tags: []string{"conversations"},
+		Responses: map[int]response{http.StatusOK: {Description: "Pinned", Body: struct {
+			Pin store.Pin `json:"pin"`
+		}{}}}},
+	"DELETE /conversations/:username/pins/:id": {Summary: "Unpin a message", Tags: []string{"conversations"},
+		Responses: map[int]response{http.StatusOK: {Description: "Unpinned", Body: messageResponse{}}}},
+
+	"GET /channels": {Summary: "Public channels and the private ones the caller belongs to, marking those they subscribe to", Tags: []string{"channels"},
+		Query: []queryParam{
+			{Name: "search", Description: "Only channels whose name, topic or description contain this, ignoring case", Type: "string"},
+		},
+		Responses: map[int]response{http.StatusOK: {Description: "Channels", Body: struct {
+			Channels []store.Channel `json:"channels"`
+		}{}}}},
+	"GET /channels/:id": {Summary: "A public channel, or a private one the caller belongs to", Tags: []string{"channels"},
+		Responses: map[int]response{http.StatusOK: {Description: "The channel", Body: store.Channel{}}}},
+	"PUT /channels/:id/subscription": {Summary: "Join a public channel as a member", Tags: []string{"channels"},
+		Responses: map[int]response{http.StatusOK: {Description: "Subscribed", Body: messageResponse{}}}},
+	"DELETE /channels/:id/subscription": {Summary: "Leave a channel", Tags: []string{"channels"},
+		Responses: map[int]response{http.StatusOK: {Description: "Unsubscribed", Body: messageResponse{}}}},
+	"GET /channels/:id/posts": {Summary: "Posts of a channel, oldest first", Tags: []string{"channels"},
+		Query: []queryParam{
+			{Name: "before", Description: "Only posts older than the post with this ID", Type: "integer"},
+			{Name: "limit", Description: "Posts to return (default 50, at most 200)", Type: "integer"},
+		},
+		Responses: map[int]response{http.StatusOK: {Description: "Posts", Body: struct {
+			Posts []store.ChannelPost `json:"posts"`
+		}{}}}},
+	"POST /channels/:id/posts": {Summary: "Post to a channel as one of its senders", Tags: []string{"channels"},
+		Request: struct {
+			Content string `json:"content"`
+		}{},
+		Responses: map[int]response{http.StatusCreated: {Description: "Posted", Body: store.ChannelPost{}}}},
+	"DELETE /channels/:id/posts/:post": {Summary: "Delete a post: senders their own, channel admins and owners any", Tags: []string{"channels"},
+		Responses: map[int]response{http.StatusOK: {Description: "Deleted", Body: messageResponse{}}}},
+	"GET /channels/:id/posts/:post/replies": {Summary: "Replies in the thread of a post, oldest first", Tags: []string{"channels"},
+		Query: []queryParam{
+			{Name: "before", Description: "Only replies older than the reply with this ID", Type: "integer"},
+			{Name: "limit", Description: "Replies to return (default 50, at most 200)", Type: "integer"},
+		},
+		Responses: map[int]response{http.StatusOK: {Description: "Replies", Body: struct {
+			Posts []store.ChannelPost `json:"posts"`
+		}{}}}},
+	"POST /channels/:id/posts/:post/replies": {Summary: "Reply in the thread of a post as a member of the channel, subscribing to the thread", Tags: []string{"channels"},
+		Request: struct {
+			Content string `json:"content"`
+		}{},
+		Responses: map[int]response{http.StatusCreated: {Description: "Replied", Body: store.ChannelPost{}}}},
+	"GET /channels/:id/threads": {Summary: "Threads of a channel, latest reply first, with unread replies in those the caller follows", Tags: []string{"channels"},
+		Query: []queryParam{
+			{Name: "limit", Description: "Threads to return (default 50, at most 200)", Type: "integer"},
+		},
+		Responses: map[int]response{http.StatusOK: {Description: "Threads", Body: struct {
+			Threads []store.ChannelThread `json:"threads"`
+		}{}}}},
+	"PUT /channels/:id/threads/:post/read": {Summary: "Mark the replies in a thread read", Tags: []string{"channels"},
+		Responses: map[int]response{http.StatusOK: {Description: "Marked", Body: messageResponse{}}}},
+	"PUT /channels/:id/threads/:post/subscription": {Summary: "Receive the replies in a thread in real time, as a member", Tags: []string{"channels"},
+		Responses: map[int]response{http.StatusOK: {Description: "Subscribed", Body: messageResponse{}}}},
+	"DELETE /channels/:id/threads/:post/subscription": {Summary: "Stop receiving the replies in a thread until replying in it", Tags: []string{"channels"},
+		Responses: map[int]response{http.StatusOK: {Description: "Unsubscribed", Body: messageResponse{}}}},
+	"GET /channels/:id/pins": {Summary: "Pinned posts of a channel, oldest first", Tags: []string{"channels"},
+		Responses: map[int]response{http.StatusOK: {Description: "Posts", Body: struct {
+			Posts []store.ChannelPost `json:"posts"`
+		}{}}}},
+	"PUT /channels/:id/posts/:post/pin": {Summary: "Pin a post, as a channel admin or owner", Tags: []string{"channels"},
+		Responses: map[int]response{http.StatusOK: {Description: "Pinned", Body: messageResponse{}}}},
+	"DELETE /channels/:id/posts/:post/pin": {Summary: "Unpin a post, as a channel admin or owner", Tags: []string{"channels"},
+		Responses: map[int]response{http.StatusOK: {Description: "Unpinned", Body: messageResponse{}}}},
+	"PATCH /channels/:id": {Summary: "Change a channel's name, description, topic or visibility, as a channel admin or owner", Tags: []string{"channels"},
+		Request:   store.ChannelUpdate{},
+		Responses: map[int]response{http.StatusOK: {Description: "Updated", Body: store.Channel{}}}},
+	"GET /channels/:id/members": {Summary: "Members of a channel and their roles, for members", Tags: []string{"channels"},
+		Responses: map[int]response{http.StatusOK: {Description: "Members", Body: struct {
+			Members []store.ChannelMember `json:"members"`
+		}{}}}},
+	"PUT /channels/:id/members/:username/role": {Summary: "Make a member an owner, admin or member, as a channel owner", Tags: []string{"channels"},
+		Request: struct {
+			Role string `json:"role"`
+		}{},
+		Responses: map[int]response{http.StatusOK: {Description: "Changed", Body: messageResponse{}}}},
+	"DELETE /channels/:id/members/:username": {Summary: "Remove a member of lower role from a channel", Tags: []string{"channels"},
+		Responses: map[int]response{http.StatusOK: {Description: "Removed", Body: messageResponse{}}}},
+	"POST /channels/:id/invites": {Summary: "Create an invite link to a channel, as a channel admin or owner", Tags: []string{"channels"},
+		Request: struct {
+			ExpiresInSeconds int `json:"expires_in_seconds,omitempty"`
+			MaxUses          int `json:"max_uses,omitempty"`
+		}{},
+		Responses: map[int]response{http.StatusCreated: {Description: "Created; the token is only shown now", Body: ChannelInviteCreated{}}}},
+	"GET /channels/:id/invites": {Summary: "Invites of a channel, as a channel admin or owner", Tags: []string{"channels"},
+		Responses: map[int]response{http.StatusOK: {Description: "Invites", Body: struct {
+			Invites []store.ChannelInvite `json:"invites"`
+		}{}}}},
+	"DELETE /channels/:id/invites/:invite": {Summary: "Revoke an invite, as a channel admin or owner", Tags: []string{"channels"},
+		Responses: map[int]response{http.StatusOK: {Description: "Revoked", Body: messageResponse{}}}},
+	"POST /invite/:token": {Summary: "Join the channel of an invite", Tags: []string{"channels"},
+		Responses: map[int]response{http.StatusOK: {Description: "The channel joined", Body: store.Channel{}}}},
+
+	"GET /admin/users": {Summary: "Every user", Tags: []string{"admin"},
+		Responses: map[int]response{http.StatusOK: {Description: "Users", Body: struct {
+			Users []store.User `json:"users"`
+		}{}}}},
+	"POST /admin/users/:username/ban": {Summary: "Ban a user", Tags: []string{"admin"},
+		Responses: map[int]response{http.StatusOK: {Description: "Banned", Body: messageResponse{}}}},
+	"DELETE /admin/users/:username/ban": {Summary: "Unban a user", Tags: []string{"admin"},
+		Responses: map[int]response{http.StatusOK: {Description: "Unbanned", Body: messageResponse{}}}},
+	"PUT /admin/users/:username/shadow-mute": {Summary: "Shadow-mute a user: only they see what they send from now on", Tags: []string{"admin"},
+		Responses: map[int]response{http.StatusOK: {Description: "Muted", Body: messageResponse{}}}},
+	"DELETE /admin/users/:username/shadow-mute": {Summary: "Lift a user's global shadow mute", Tags: []string{"admin"},
+		Responses: map[int]response{http.StatusOK: {Description: "Lifted", Body: messageResponse{}}}},
+	"GET /admin/shadow-mutes": {Summary: "Every shadow mute, global and per channel", Tags: []string{"admin"},
+		Responses: map[int]response{http.StatusOK: {Description: "The mutes", Body: struct {
+			ShadowMutes []store.ShadowMute `json:"shadow_mutes"`
+		}{}}}},
+	"GET /admin/users/:username/lockout": {Summary: "Show a user's recent failed logins and lockout", Tags: []string{"admin"},
+		Responses: map[int]response{http.StatusOK: {Description: "The lockout", Body: LockoutStatus{}}}},
+	"DELETE /admin/users/:username/lockout": {Summary: "Unlock a user locked out after failed logins", Tags: []string{"admin"},
+		Responses: map[int]response{http.StatusOK: {Description: "Unlocked", Body: messageResponse{}}}},
+	"DELETE /admin/lockouts/ips/:ip": {Summary: "Unlock an IP address locked out after failed logins", Tags: []string{"admin"},
+		Responses: map[int]response{http.StatusOK: {Description: "Unlocked", Body: messageResponse{}}}},
+	"POST /admin/api-keys": {Summary: "Create an API key for the provisioning API; the key is only shown once", Tags: []string{"admin"}, Request: apiKeyRequest{},
+		Responses: map[int]response{http.StatusCreated: {Description: "Created", Body: APIKeyCreated{}}}},
+	"GET /admin/api-keys": {Summary: "List the API keys that were not revoked", Tags: []string{"admin"},
+		Responses: map[int]response{http.StatusOK: {Description: "The API keys", Body: apiKeysBody{}}}},
+	"DELETE /admin/api-keys/:id": {Summary: "Revoke an API key", Tags: []string{"admin"},
+		Responses: map[int]response{http.StatusOK: {Description: "Revoked", Body: messageResponse{}}}},
+	"POST /admin/bots": {Summary: "Create a bot account; its token is only shown once", Tags: []string{"admin"}, Request: botRequest{},
+		Responses: map[int]response{http.StatusCreated: {Description: "Created", Body: BotCreated{}}}},
+	"GET /admin/bots": {Summary: "List bot accounts", Tags: []string{"admin"},
+		Responses: map[int]response{http.StatusOK: {Description: "The bots", Body: botsBody{}}}},
+	"POST /admin/bots/:username/token": {Summary: "Replace a bot's token and disconnect the bot; the new token is only shown once", Tags: []string{"admin"},
+		Responses: map[int]response{http.StatusOK: {Description: "Rotated", Body: BotCreated{}}}},
+	"DELETE /admin/bots/:username": {Summary: "Delete a bot account", Tags: []string{"admin"},
+		Responses: map[int]response{http.StatusOK: {Description: "Deleted", Body: messageResponse{}}}},
+	"POST /admin/hooks": {Summary: "Create an incoming hook posting as a bot to one user; its token is only shown once", Tags: []string{"admin"}, Request: incomingHookRequest{},
+		Responses: map[int]response{http.StatusCreated: {Description: "Created", Body: IncomingHookCreated{}}}},
+	"GET /admin/hooks": {Summary: "List incoming hooks", Tags: []string{"admin"},
+		Responses: map[int]response{http.StatusOK: {Description: "The hooks", Body: incomingHooksBody{}}}},
+	"DELETE /admin/hooks/:id": {Summary: "Delete an incoming hook", Tags: []string{"admin"},
+		Responses: map[int]response{http.StatusOK: {Description: "Deleted", Body: messageResponse{}}}},
+	"POST /admin/channels": {Summary: "Create a broadcast channel and designate its senders", Tags: []string{"admin"},
+		Request: struct {
+			Name        string   `json:"name"`
+			Description string   `json:"description,omitempty"`
+			Topic       string   `json:"topic,omitempty"`
+			Visibility  string   `json:"visibility,omitempty"`
+			Senders     []string `json:"senders,omitempty"`
+		}{},
+		Responses: map[int]response{http.StatusCreated: {Description: "Created", Body: store.Channel{}}}},
+	"DELETE /admin/channels/:id": {Summary: "Delete a channel with its subscriptions and posts", Tags: []string{"admin"},
+		Responses: map[int]response{http.StatusOK: {Description: "Deleted", Body: messageResponse{}}}},
+	"PUT /admin/channels/:id/senders/:username": {Summary: "Let a user post to a channel", Tags: []string{"admin"},
+		Responses: map[int]response{http.StatusOK: {Description: "Added", Body: messageResponse{}}}},
+	"DELETE /admin/channels/:id/senders/:username": {Summary: "Stop a user posting to a channel", Tags: []string{"admin"},
+		Responses: map[int]response{http.StatusOK: {Description: "Removed", Body: messageResponse{}}}},
+	"PUT /admin/channels/:id/shadow-mutes/:username": {Summary: "Shadow-mute a user in a channel: only they see their posts to it", Tags: []string{"admin"},
+		Responses: map[int]response{http.StatusOK: {Description: "Muted", Body: messageResponse{}}}},
+	"DELETE /admin/channels/:id/shadow-mutes/:username": {Summary: "Lift a user's shadow mute in a channel", Tags: []string{"admin"},
+		Responses: map[int]response{http.StatusOK: {Description: "Lifted", Body: messageResponse{}}}},
+	"POST /admin/webhooks": {Summary: "Register a webhook, optionally for a bot; its secret is only shown once", Tags: []string{"admin"}, Request: webhookRequest{},
+		Responses: map[int]response{http.StatusCreated: {Description: "Created", Body: WebhookCreated{}}}},
+	"GET /admin/webhooks": {Summary: "List webhooks", Tags: []string{"admin"},
+		Responses: map[int]response{http.StatusOK: {Description: "The webhooks", Body: webhooksBody{}}}},
+	"DELETE /admin/webhooks/:id": {Summary: "Delete a webhook and its deliveries", Tags: []string{"admin"},
+		Responses: map[int]response{http.StatusOK: {Description: "Deleted", Body: messageResponse{}}}},
+	"GET /admin/webhooks/:id/deliveries": {Summary: "A webhook's delivery log, newest first", Tags: []string{"admin"},
+		Query:     []queryParam{{Name: "limit", Description: "Deliveries to return (default 100)", Type: "integer"}},
+		Responses: map[int]response{http.StatusOK: {Description: "The deliveries", Body: deliveriesBody{}}}},
+	"GET /provisioning/users": {Summary: "List users with an API key, SCIM style", Tags: []string{"provisioning"},
+		Query: []queryParam{
+			{Name: "filter", Description: `userName eq "<username>" finds one user`},
+			{Name: "startIndex", Description: "Position of the first user, from 1", Type: "integer"},
+			{Name: "count", Description: "Users per page, up to 1000 (default 100)", Type: "integer"},
+		},
+		Responses: map[int]response{http.StatusOK: {Description: "A page of users", Body: SCIMListResponse{}}}},
+	"POST /provisioning/users": {Summary: "Create a user with an API key", Tags: []string{"provisioning"}, Request: provisionRequest{},
+		Responses: map[int]response{http.StatusCreated: {Description: "Created", Body: SCIMUser{}}}},
+	"GET /provisioning/users/:username": {Summary: "Get a user with an API key", Tags: []string{"provisioning"},
+		Responses: map[int]response{http.StatusOK: {Description: "The user", Body: SCIMUser{}}}},
+	"PATCH /provisioning/users/:username": {Summary: "Update a user's email, password or active state with an API key", Tags: []string{"provisioning"}, Request: provisionUpdate{},
+		Responses: map[int]response{http.StatusOK: {Description: "Updated", Body: SCIMUser{}}}},
+	"DELETE /provisioning/users/:username": {Summary: "Delete a user's account with an API key", Tags: []string{"provisioning"},
+		Responses: map[int]response{http.StatusNoContent: {Description: "Deleted"}}},
+	"POST /provisioning/bulk": {Summary: "Apply many provisioning operations with an API key", Tags: []string{"provisioning"}, Request: bulkRequest{},
+		Responses: map[int]response{http.StatusOK: {Description: "The outcome of each operation", Body: bulkResponse{}}}},
+	"DELETE /admin/messages/:id": {Summary: "Delete any message for everyone", Tags: []string{"admin"},
+		Responses: map[int]response{http.StatusOK: {Description: "Deleted", Body: messageResponse{}}}},
+	"GET /admin/stats": {Summary: "Usage statistics", Tags: []string{"admin"},
+		Responses: map[int]response{http.StatusOK: {Description: "Statistics", Body: struct {
+			Stats               store.Stats `json:"stats"`
+			InstanceConnections int         `json:"instance_connections"`
+		}{}}}},
+	"POST /admin/announcements": {Summary: "Send an announcement to every connected client", Tags: []string{"admin"},
+		Request: struct {
+			Content string `json:"content"`
+		}{},
+		Responses: map[int]response{http.StatusOK: {Description: "Sent", Body: struct {
+			Announcement AnnouncementEvent `json:"announcement"`
+		}{}}}},
+	"GET /admin/flags": {Summary: "Messages flagged by the content filter, newest first", Tags: []string{"admin"},
+		Query: []queryParam{{Name: "limit", Type: "integer"}},
+		Responses: map[int]response{http.StatusOK: {Description: "Flags", Body: struct {
+			Flags []store.Flag `json:"flags"`
+		}{}}}},
+	"GET /admin/audit": {Summary: "The audit log of security-relevant actions, newest first", Tags: []string{"admin"},
+		Query: []queryParam{
+			{Name: "actor", Description: "Only entries by this user, or api_key:<name>"},
+			{Name: "action", Description: "Only entries of this action, such as login.failed"},
+			{Name: "target", Description: "Only entries acting on this user, message or ID"},
+			{Name: "since", Description: "Only entries at or after this RFC3339 time"},
+			{Name: "until", Description: "Only entries before this RFC3339 time"},
+			{Name: "before", Description: "Only entries older than the entry with this ID", Type: "integer"},
+			{Name: "limit", Description: "Entries to return, up to 1000 (default 100)", Type: "integer"},
+		},
+		Responses: map[int]response{http.StatusOK: {Description: "The entries", Body: struct {
+			Entries []store.AuditEntry `json:"entries"`
+		}{}}}},
+}
@@ -0,0 +1,146 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"time"
+
+	"backend/apperr"
+	"backend/auth"
+	"backend/store"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-redis/redis/v8"
+)
+
+// passwordResetTTL is how long a password reset token can be used.
+const passwordResetTTL = time.Hour
+
+// passwordResetKey returns the Redis key of a reset token. Only the token
+// hash is stored.
+func passwordResetKey(token string) string {
+	return fmt.Sprintf("password_reset:%s", auth.HashToken(token))
+}
+
+// passwordResetUserKey returns the Redis key of the set of a user's
+// outstanding reset token keys, so they can be revoked when the username
+// they were issued to goes away.
+func passwordResetUserKey(username string) string {
+	return fmt.Sprintf("password_reset_user:%s", username)
+}
+
+// revokePasswordResets invalidates every outstanding reset token of
+// username.
+func (s *Server) revokePasswordResets(ctx context.Context, username string) error {
+	keys, err := s.rdb.SMembers(ctx, passwordResetUserKey(username)).Result()
+	if err != nil {
+		return err
+	}
+	return s.rdb.Del(ctx, append(keys, passwordResetUserKey(username))...).Err()
+}
+
+// forgotPasswordHandler emails a single-use reset link to the account with
+// the given email. The response is the same whether or not the account
+// exists, so it cannot be used to discover registered emails.
+func (s *Server) forgotPasswordHandler(c *gin.Context) {
+	ctx := c.Request.Context()
+
+	var req struct {
+		Email string `json:"email"`
+	}
+
+	if err := c.ShouldBindJSON(&req); err != nil || req.Email == "" {
+		c.Error(apperr.New(apperr.InvalidRequest, "Invalid request payload"))
+		return
+	}
+
+	response := gin.H{"message": s.tr(c, "If an account with that email exists, a reset link has been sent")}
+
+	username, err := s.store.UsernameByEmail(ctx, req.Email)
+	if err != nil {
+		c.JSON(http.StatusOK, response)
+		return
+	}
+
+	token, err := auth.NewOpaqueToken()
+	if err != nil {
+		c.Error(apperr.New(apperr.Internal, "Failed to generate reset token"))
+		return
+	}
+
+	_, err = s.rdb.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.Set(ctx, passwordResetKey(token), username, passwordResetTTL)
+		pipe.SAdd(ctx, passwordResetUserKey(username), passwordResetKey(token))
+		pipe.Expire(ctx, passwordResetUserKey(username), passwordResetTTL)
+		return nil
+	})
+	if err != nil {
+		c.Error(apperr.New(apperr.Internal, "Failed to store reset token"))
+		return
+	}
+
+	link := fmt.Sprintf("%s/password/reset?token=%s", s.appURL, url.QueryEscape(token))
+	body := fmt.Sprintf("Hi %s,\n\nUse the link below to reset your password. It expires in %s.\n\n%s\n\nIf you did not request a reset, you can ignore this email.",
+		username, passwordResetTTL, link)
+	if err := s.email.Send(req.Email, "Reset your password", body); err != nil {
+		log.Printf("Error sending password reset email to %s: %v", username, err)
+	}
+
+	c.JSON(http.StatusOK, response)
+}
+
+// resetPasswordHandler sets a new password using a reset token. The token is
+// consumed on first use and every existing session is revoked.
+func (s *Server) resetPasswordHandler(c *gin.Context) {
+	ctx := c.Request.Context()
+
+	var req struct {
+		Token    string `json:"token"`
+		Password string `json:"password"`
+	}
+
+	if err := c.ShouldBindJSON(&req); err != nil || req.Token == "" {
+		c.Error(apperr.New(apperr.InvalidRequest, "Invalid request payload"))
+		return
+	}
+
+	if err := auth.ValidatePassword(req.Password); err != nil {
+		c.Error(apperr.New(apperr.InvalidPassword, err.Error()))
+		return
+	}
+
+	username, err := s.rdb.GetDel(ctx, passwordResetKey(req.Token)).Result()
+	if err != nil {
+		c.Error(apperr.New(apperr.InvalidResetToken, "Invalid or expired reset token"))
+		return
+	}
+
+	if err := s.rdb.SRem(ctx, passwordResetUserKey(username), passwordResetKey(req.Token)).Err(); err != nil {
+		log.Printf("Error removing reset token of %s: %v", username, err)
+	}
+
+	hashedPassword, err := s.passwords.Hash(req.Password)
+	if err != nil {
+		c.Error(apperr.New(apperr.Internal, "Failed to hash password"))
+		return
+	}
+
+	if err := s.store.SetPasswordHash(ctx, username, hashedPassword); err != nil {
+		c.Error(apperr.New(apperr.Internal, "Failed to update password"))
+		return
+	}
+
+	if err := s.store.RevokeUserSessions(ctx, username); err != nil {
+		log.Printf("Error revoking sessions of %s: %v", username, err)
+	}
+	// Whoever reset the password owns the account, so its lockout goes too.
+	if err := s.lockout.Reset(ctx, accountLockout, username); err != nil {
+		log.Printf("Error resetting login failures of %s: %v", username, err)
+	}
+	s.audit(ctx, store.AuditEntry{Action: auditPasswordReset, Actor: username, Target: username})
+
+	c.JSON(http.StatusOK, gin.H{"message": s.tr(c, "Password reset successfully")})
+}
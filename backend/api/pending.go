@@ -0,0 +1,47 @@
+package api
+
+import (
+	"context"
+	"log"
+	"strconv"
+
+	"backend/store"
+	"backend/ws"
+)
+
+// pendingBatchSize is the number of undelivered messages sent per frame when
+// a client reconnects.
+const pendingBatchSize = 100
+
+// PendingEvent carries messages that were sent while the user was offline.
+// The client acknowledges each one with a "delivered" frame, or the whole
+// event with an "ack"; anything left unacknowledged is sent again on the
+// next connection.
+type PendingEvent struct {
+	Type     string          `json:"type"`
+	Messages []store.Message `json:"messages"`
+}
+
+// flushPending sends a newly connected client every message it missed while
+// offline, in batches.
+func (s *Server) flushPending(ctx context.Context, client *ws.Client) {
+	afterID := 0
+	for {
+		messages, err := s.store.Undelivered(ctx, client.UserID, afterID, pendingBatchSize)
+		if err != nil {
+			log.Printf("Error fetching pending messages for %s: %v", client.UserID, err)
+			return
+		}
+		if len(messages) == 0 {
+			return
+		}
+
+		if !s.hub.SendToClient(client, ws.Event{Type: ws.TypePending, Payload: PendingEvent{Type: ws.TypePending, Messages: messages}}) {
+			return
+		}
+		if len(messages) < pendingBatchSize {
+			return
+		}
+		afterID, _ = strconv.Atoi(messages[len(messages)-1].ID)
+	}
+}
@@ -0,0 +1,93 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"backend/apperr"
+	"backend/auth"
+	"backend/store"
+	"backend/ws"
+
+	"github.com/gin-gonic/gin"
+)
+
+// maxPins is how many messages a conversation may have pinned at once.
+const maxPins = 50
+
+// PinEvent tells both participants that a message was pinned or unpinned.
+type PinEvent struct {
+	MessageID string    `json:"message_id"`
+	Pinned    bool      `json:"pinned"`
+	By        string    `json:"by"`
+	At        time.Time `json:"at"`
+}
+
+// pinnedMessagesHandler lists the messages pinned to the authenticated
+// user's conversation with the user in the path.
+func (s *Server) pinnedMessagesHandler(c *gin.Context) {
+	pinned, err := s.store.PinnedMessages(c.Request.Context(), auth.CurrentUser(c), c.Param("username"))
+	if err != nil {
+		c.Error(apperr.New(apperr.Internal, "Failed to fetch pinned messages"))
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"pinned_messages": pinned})
+}
+
+// pinMessageHandler pins a message to the authenticated user's conversation
+// with the user in the path and records it in the conversation. Pinning a
+// pinned message is a no-op.
+func (s *Server) pinMessageHandler(c *gin.Context) {
+	ctx := c.Request.Context()
+	username := auth.CurrentUser(c)
+	peer := c.Param("username")
+
+	pin, pinned, err := s.store.PinMessage(ctx, c.Param("id"), username, peer, maxPins)
+	if errors.Is(err, store.ErrNotFound) {
+		c.Error(apperr.New(apperr.MessageNotFound, "Message not found"))
+		return
+	}
+	if errors.Is(err, store.ErrPinLimit) {
+		c.Error(apperr.Newf(apperr.PinLimit, "A conversation can have at most %d pinned messages", maxPins))
+		return
+	}
+	if err != nil {
+		c.Error(apperr.New(apperr.Internal, "Failed to pin message"))
+		return
+	}
+
+	s.publishEvent(ws.Event{
+		Type:    ws.TypePin,
+		Payload: PinEvent{MessageID: pin.MessageID, Pinned: true, By: pin.PinnedBy, At: pin.PinnedAt},
+	}, username, peer)
+	if pinned {
+		s.postSystemMessage(ctx, username, peer, store.SystemEvent{Event: store.SystemMessagePinned, MessageID: pin.MessageID})
+	}
+	c.JSON(http.StatusOK, gin.H{"pin": pin})
+}
+
+// unpinMessageHandler unpins a message from the authenticated user's
+// conversation with the user in the path.
+func (s *Server) unpinMessageHandler(c *gin.Context) {
+	username := auth.CurrentUser(c)
+	peer := c.Param("username")
+	messageID := c.Param("id")
+
+	removed, err := s.store.UnpinMessage(c.Request.Context(), messageID, username, peer)
+	if err != nil {
+		c.Error(apperr.New(apperr.Internal, "Failed to unpin message"))
+		return
+	}
+	if !removed {
+		c.Error(apperr.New(apperr.NotFound, "Message is not pinned"))
+		return
+	}
+
+	s.publishEvent(ws.Event{
+		Type:    ws.TypePin,
+		Payload: PinEvent{MessageID: messageID, Pinned: false, By: username, At: time.Now().UTC()},
+	}, username, peer)
+	c.JSON(http.StatusOK, gin.H{"message": s.tr(c, "Message unpinned")})
+}
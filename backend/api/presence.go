@@ -0,0 +1,282 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"backend/apperr"
+	"backend/auth"
+	"backend/events"
+	"backend/store"
+	"backend/ws"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	// presenceChannel is the pub/sub channel carrying presence changes.
+	presenceChannel = "chat:presence"
+	// presenceTTL is how long a user stays online without a heartbeat.
+	presenceTTL = 60 * time.Second
+	// presenceHeartbeat is how often a connected user's presence is refreshed.
+	presenceHeartbeat = 30 * time.Second
+
+	// Limits of user statuses.
+	maxStatusText     = 100
+	maxStatusEmoji    = 32
+	maxStatusDuration = 7 * 24 * time.Hour
+)
+
+// Presence states reported to clients.
+const (
+	presenceOnline  = "online"
+	presenceOffline = "offline"
+)
+
+// PresenceEvent notifies a user's contacts that they came online or went
+// offline, or changed their status.
+type PresenceEvent struct {
+	Type       string            `json:"type"`
+	Username   string            `json:"username"`
+	Status     string            `json:"status"`
+	LastSeen   *time.Time        `json:"last_seen,omitempty"`
+	UserStatus *store.UserStatus `json:"user_status,omitempty"`
+}
+
+// presenceMessage is the Pub/Sub payload of a presence change; it carries
+// the recipients so every instance can deliver it without a DB lookup.
+type presenceMessage struct {
+	Event      PresenceEvent `json:"event"`
+	Recipients []string      `json:"recipients"`
+}
+
+// presenceKey returns the Redis key marking a user as online.
+func presenceKey(username string) string {
+	return fmt.Sprintf("presence:%s", username)
+}
+
+// userStatus returns the user's status, or nil if it cannot be fetched.
+func (s *Server) userStatus(ctx context.Context, username string) *store.UserStatus {
+	status, err := s.store.UserStatus(ctx, username)
+	if err != nil {
+		log.Printf("Error fetching status of %s: %v", username, err)
+		return nil
+	}
+	return &status
+}
+
+// setOnline marks the user as online and announces it to their contacts.
+func (s *Server) setOnline(username string) {
+	if err := s.rdb.Set(context.Background(), presenceKey(username), presenceOnline, presenceTTL).Err(); err != nil {
+		log.Printf("Error setting presence for %s: %v", username, err)
+	}
+	s.publishPresence(PresenceEvent{Type: "presence", Username: username, Status: presenceOnline, UserStatus: s.userStatus(context.Background(), username)})
+	s.events.Emit(events.UserOnline, username, events.Presence{Username: username})
+}
+
+// refreshPresence extends the online TTL of a connected user.
+func (s *Server) refreshPresence(username string) {
+	if err := s.rdb.Expire(context.Background(), presenceKey(username), presenceTTL).Err(); err != nil {
+		log.Printf("Error refreshing presence for %s: %v", username, err)
+	}
+}
+
+// setOffline records the user's last_seen time and announces it to their contacts.
+func (s *Server) setOffline(username string) {
+	if err := s.rdb.Del(context.Background(), presenceKey(username)).Err(); err != nil {
+		log.Printf("Error clearing presence for %s: %v", username, err)
+	}
+
+	lastSeen := time.Now().UTC()
+	if err := s.store.SetLastSeen(context.Background(), username, lastSeen); err != nil {
+		log.Printf("Error recording last_seen for %s: %v", username, err)
+	}
+
+	s.publishPresence(PresenceEvent{Type: "presence", Username: username, Status: presenceOffline, LastSeen: &lastSeen, UserStatus: s.userStatus(context.Background(), username)})
+	s.events.Emit(events.UserOffline, username, events.Presence{Username: username, LastSeen: &lastSeen})
+}
+
+// runPresenceHeartbeat keeps the user's presence alive until done is closed.
+func (s *Server) runPresenceHeartbeat(username string, done <-chan struct{}) {
+	ticker := time.NewTicker(presenceHeartbeat)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			s.refreshPresence(username)
+		case <-done:
+			return
+		}
+	}
+}
+
+// publishPresence sends a presence change to the user's contacts on every instance.
+func (s *Server) publishPresence(event PresenceEvent) {
+	contacts, err := s.store.Contacts(context.Background(), event.Username)
+	if err != nil {
+		log.Printf("Error fetching contacts of %s: %v", event.Username, err)
+		return
+	}
+	if len(contacts) == 0 {
+		return
+	}
+
+	payload, err := json.Marshal(presenceMessage{Event: event, Recipients: contacts})
+	if err != nil {
+		log.Printf("Error encoding presence event: %v", err)
+		return
+	}
+
+	if err := s.bus.Publish(context.Background(), presenceChannel, payload); err != nil {
+		log.Printf("Publish error for presence: %v", err)
+	}
+}
+
+// deliverPresence sends a published presence change to locally connected contacts.
+func (s *Server) deliverPresence(payload string) {
+	var pm presenceMessage
+	if err := json.Unmarshal([]byte(payload), &pm); err != nil {
+		log.Printf("Error decoding presence event: %v", err)
+		return
+	}
+
+	for _, recipient := range pm.Recipients {
+		s.hub.SendToUser(recipient, ws.Event{Type: ws.TypePresence, Payload: pm.Event})
+	}
+}
+
+// presenceHandler reports whether a user is online, or when they were last seen.
+func (s *Server) presenceHandler(c *gin.Context) {
+	username := c.Param("username")
+
+	lastSeen, err := s.store.LastSeen(c.Request.Context(), username)
+	if errors.Is(err, store.ErrNotFound) {
+		c.Error(apperr.New(apperr.UserNotFound, "User not found"))
+		return
+	}
+	if err != nil {
+		c.Error(apperr.New(apperr.Internal, "Failed to fetch presence"))
+		return
+	}
+
+	online, err := s.rdb.Exists(c.Request.Context(), presenceKey(username)).Result()
+	if err != nil {
+		c.Error(apperr.New(apperr.Internal, "Failed to fetch presence"))
+		return
+	}
+
+	status, err := s.store.UserStatus(c.Request.Context(), username)
+	if err != nil {
+		c.Error(apperr.New(apperr.Internal, "Failed to fetch status"))
+		return
+	}
+
+	event := PresenceEvent{Type: "presence", Username: username, Status: presenceOffline, UserStatus: &status}
+	if online > 0 {
+		event.Status = presenceOnline
+	} else {
+		event.LastSeen = lastSeen
+	}
+
+	c.JSON(http.StatusOK, event)
+}
+
+// getStatusHandler returns the authenticated user's status.
+func (s *Server) getStatusHandler(c *gin.Context) {
+	status, err := s.store.UserStatus(c.Request.Context(), auth.CurrentUser(c))
+	if err != nil {
+		c.Error(apperr.New(apperr.Internal, "Failed to fetch status"))
+		return
+	}
+
+	c.JSON(http.StatusOK, status)
+}
+
+// updateStatusHandler sets the authenticated user's status, for
+// duration_seconds or, if 0 or omitted, until changed, and announces it to
+// their contacts.
+func (s *Server) updateStatusHandler(c *gin.Context) {
+	ctx := c.Request.Context()
+	username := auth.CurrentUser(c)
+
+	var req struct {
+		Availability    string `json:"availability"`
+		Text            string `json:"text"`
+		Emoji           string `json:"emoji"`
+		DurationSeconds int    `json:"duration_seconds"`
+	}
+	if err := c.BindJSON(&req); err != nil {
+		c.Error(apperr.New(apperr.InvalidRequest, "Invalid request payload"))
+		return
+	}
+	if req.Availability == "" {
+		req.Availability = store.AvailabilityAvailable
+	}
+	switch req.Availability {
+	case store.AvailabilityAvailable, store.AvailabilityBusy, store.AvailabilityDND:
+	default:
+		c.Error(apperr.New(apperr.InvalidRequest, "Availability must be available, busy or dnd"))
+		return
+	}
+	if utf8.RuneCountInString(req.Text) > maxStatusText {
+		c.Error(apperr.Newf(apperr.InvalidRequest, "Status text must be at most %d characters", maxStatusText))
+		return
+	}
+	if utf8.RuneCountInString(req.Emoji) > maxStatusEmoji {
+		c.Error(apperr.Newf(apperr.InvalidRequest, "Status emoji must be at most %d characters", maxStatusEmoji))
+		return
+	}
+	d := time.Duration(req.DurationSeconds) * time.Second
+	if d < 0 || d > maxStatusDuration {
+		c.Error(apperr.New(apperr.InvalidRequest, "duration_seconds must be between 0 and 604800"))
+		return
+	}
+
+	status := store.UserStatus{Availability: req.Availability, Text: strings.TrimSpace(req.Text), Emoji: strings.TrimSpace(req.Emoji)}
+	if err := s.store.SetUserStatus(ctx, username, &status, d); err != nil {
+		c.Error(apperr.New(apperr.Internal, "Failed to update status"))
+		return
+	}
+	s.publishStatus(ctx, username, status)
+
+	c.JSON(http.StatusOK, status)
+}
+
+// clearStatusHandler reverts the authenticated user's status to available
+// and announces it to their contacts.
+func (s *Server) clearStatusHandler(c *gin.Context) {
+	ctx := c.Request.Context()
+	username := auth.CurrentUser(c)
+
+	if err := s.store.ClearUserStatus(ctx, username); err != nil {
+		c.Error(apperr.New(apperr.Internal, "Failed to clear status"))
+		return
+	}
+	s.publishStatus(ctx, username, store.DefaultUserStatus)
+
+	c.JSON(http.StatusOK, store.DefaultUserStatus)
+}
+
+// publishStatus announces a status change to the user's contacts, along
+// with whether the user is online.
+func (s *Server) publishStatus(ctx context.Context, username string, status store.UserStatus) {
+	event := PresenceEvent{Type: "presence", Username: username, Status: presenceOffline, UserStatus: &status}
+	online, err := s.rdb.Exists(ctx, presenceKey(username)).Result()
+	if err != nil {
+		log.Printf("Error checking presence of %s: %v", username, err)
+	}
+	if online > 0 {
+		event.Status = presenceOnline
+	} else if event.LastSeen, err = s.store.LastSeen(ctx, username); err != nil {
+		log.Printf("Error fetching last_seen of %s: %v", username, err)
+	}
+	s.publishPresence(event)
+}
@@ -0,0 +1,564 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"net/mail"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"backend/apperr"
+	"backend/auth"
+	"backend/service"
+	"backend/store"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/websocket"
+)
+
+// apiKeyPrefix starts every API key, so keys are never mistaken for access
+// tokens.
+const apiKeyPrefix = "ak_"
+
+// maxBulkOperations is the most operations a bulk request may carry.
+const maxBulkOperations = 1000
+
+// SCIM schema URNs of the provisioning API's bodies.
+const (
+	scimUserSchema         = "urn:ietf:params:scim:schemas:core:2.0:User"
+	scimListSchema         = "urn:ietf:params:scim:api:messages:2.0:ListResponse"
+	scimBulkResponseSchema = "urn:ietf:params:scim:api:messages:2.0:BulkResponse"
+)
+
+// userNameFilter matches the one SCIM filter the provisioning API supports.
+var userNameFilter = regexp.MustCompile(`(?i)^userName eq "([^"]*)"$`)
+
+// SCIMUser is a user of the provisioning API, shaped like a SCIM core User.
+// Its ID is the username.
+type SCIMUser struct {
+	Schemas  []string    `json:"schemas"`
+	ID       string      `json:"id"`
+	UserName string      `json:"userName"`
+	Active   bool        `json:"active"`
+	Emails   []SCIMEmail `json:"emails,omitempty"`
+	Meta     SCIMMeta    `json:"meta"`
+}
+
+// SCIMEmail is an email address of a SCIMUser. Users have at most one.
+type SCIMEmail struct {
+	Value   string `json:"value"`
+	Primary bool   `json:"primary,omitempty"`
+}
+
+// SCIMMeta describes the resource a SCIMUser is.
+type SCIMMeta struct {
+	ResourceType string `json:"resourceType"`
+	Location     string `json:"location"`
+}
+
+// SCIMListResponse is a page of users.
+type SCIMListResponse struct {
+	Schemas      []string   `json:"schemas"`
+	TotalResults int        `json:"totalResults"`
+	StartIndex   int        `json:"startIndex"`
+	ItemsPerPage int        `json:"itemsPerPage"`
+	Resources    []SCIMUser `json:"Resources"`
+}
+
+// provisionRequest creates a user. Users created without a password set one
+// through the password reset flow.
+type provisionRequest struct {
+	UserName string      `json:"userName"`
+	Password string      `json:"password,omitempty"`
+	Active   *bool       `json:"active,omitempty"`
+	Emails   []SCIMEmail `json:"emails,omitempty"`
+}
+
+// provisionUpdate changes the attributes of a user it sets; emails replaces
+// the user's email, an empty list removes it.
+type provisionUpdate struct {
+	Password string       `json:"password,omitempty"`
+	Active   *bool        `json:"active,omitempty"`
+	Emails   *[]SCIMEmail `json:"emails,omitempty"`
+}
+
+// bulkRequest carries provisioning operations applied in order.
+type bulkRequest struct {
+	Operations []bulkOperation `json:"Operations"`
+}
+
+// bulkOperation is one operation of a bulk request: POST to /users, or
+// PATCH or DELETE of /users/<username>, with the body of the matching route
+// as data.
+type bulkOperation struct {
+	Method string          `json:"method"`
+	Path   string          `json:"path"`
+	BulkID string          `json:"bulkId,omitempty"`
+	Data   json.RawMessage `json:"data,omitempty"`
+}
+
+// bulkResponse reports the outcome of each operation of a bulk request.
+type bulkResponse struct {
+	Schemas    []string     `json:"schemas"`
+	Operations []bulkResult `json:"Operations"`
+}
+
+// bulkResult is the outcome of a bulk operation. Response is the error of a
+// failed operation.
+type bulkResult struct {
+	Method   string           `json:"method"`
+	BulkID   string           `json:"bulkId,omitempty"`
+	Location string           `json:"location,omitempty"`
+	Status   string           `json:"status"`
+	Response *apperr.Response `json:"response,omitempty"`
+}
+
+// scimUser converts a user to its provisioning API form.
+func scimUser(u store.ProvisionedUser) SCIMUser {
+	user := SCIMUser{
+		Schemas:  []string{scimUserSchema},
+		ID:       u.Username,
+		UserName: u.Username,
+		Active:   !u.Banned,
+		Meta:     SCIMMeta{ResourceType: "User", Location: apiV1 + "/provisioning/users/" + u.Username},
+	}
+	if u.Email != "" {
+		user.Emails = []SCIMEmail{{Value: u.Email, Primary: true}}
+	}
+	return user
+}
+
+// primaryEmail returns the primary email of emails, or else the first, after
+// validating it.
+func primaryEmail(emails []SCIMEmail) (string, *apperr.Error) {
+	if len(emails) == 0 {
+		return "", nil
+	}
+	email := emails[0].Value
+	for _, e := range emails {
+		if e.Primary {
+			email = e.Value
+			break
+		}
+	}
+	if _, err := mail.ParseAddress(email); err != nil {
+		return "", apperr.New(apperr.InvalidEmail, "Invalid email address")
+	}
+	return email, nil
+}
+
+// requireAPIKey rejects requests without a valid API key in the
+// Authorization header. Access tokens of users are not accepted.
+func (s *Server) requireAPIKey() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		key, ok := strings.CutPrefix(c.GetHeader("Authorization"), "Bearer ")
+		if !ok || !strings.HasPrefix(key, apiKeyPrefix) {
+			apperr.Abort(c, apperr.New(apperr.Unauthenticated, "Missing API key"))
+			return
+		}
+
+		apiKey, err := s.store.UseAPIKey(c.Request.Context(), auth.HashToken(key))
+		if errors.Is(err, store.ErrNotFound) {
+			apperr.Abort(c, apperr.New(apperr.Unauthenticated, "Invalid or revoked API key"))
+			return
+		}
+		if err != nil {
+			apperr.Abort(c, apperr.New(apperr.Internal, "Failed to check API key"))
+			return
+		}
+		setAuditActor(c.Request.Context(), "api_key:"+apiKey.Name)
+		c.Next()
+	}
+}
+
+// provisionedUser returns a user in their provisioning API form.
+func (s *Server) provisionedUser(ctx context.Context, username string) (SCIMUser, *apperr.Error) {
+	u, err := s.store.ProvisionedUser(ctx, username)
+	if errors.Is(err, store.ErrNotFound) {
+		return SCIMUser{}, apperr.New(apperr.UserNotFound, "User not found")
+	}
+	if err != nil {
+		return SCIMUser{}, apperr.New(apperr.Internal, "Failed to fetch user")
+	}
+	return scimUser(u), nil
+}
+
+// provisionUser creates a user.
+func (s *Server) provisionUser(ctx context.Context, req provisionRequest) (SCIMUser, *apperr.Error) {
+	if req.UserName == "" {
+		return SCIMUser{}, apperr.New(apperr.InvalidRequest, "Missing userName")
+	}
+	if e := s.checkUsername(req.UserName); e != nil {
+		return SCIMUser{}, e
+	}
+	if e := s.checkUsernameReleased(ctx, req.UserName, ""); e != nil {
+		return SCIMUser{}, e
+	}
+	email, e := primaryEmail(req.Emails)
+	if e != nil {
+		return SCIMUser{}, e
+	}
+
+	password := req.Password
+	if password == "" {
+		var err error
+		if password, err = auth.NewOpaqueToken(); err != nil {
+			return SCIMUser{}, apperr.New(apperr.Internal, "Failed to generate password")
+		}
+	} else if err := auth.ValidatePassword(password); err != nil {
+		return SCIMUser{}, apperr.New(apperr.InvalidPassword, err.Error())
+	}
+	hashedPassword, err := s.passwords.Hash(password)
+	if err != nil {
+		return SCIMUser{}, apperr.New(apperr.Internal, "Failed to hash password")
+	}
+
+	err = s.store.CreateUser(ctx, req.UserName, hashedPassword, email)
+	if errors.Is(err, store.ErrUsernameTaken) {
+		return SCIMUser{}, apperr.New(apperr.UsernameTaken, "Username already taken")
+	}
+	if errors.Is(err, store.ErrEmailTaken) {
+		return SCIMUser{}, apperr.New(apperr.EmailTaken, "Email already registered")
+	}
+	if err != nil {
+		return SCIMUser{}, apperr.New(apperr.Internal, "Failed to insert user")
+	}
+
+	s.trustEmail(ctx, email)
+	s.webhooks.Emit(ctx, service.EventUserSignedUp, service.SignedUp{Username: req.UserName})
+
+	if req.Active != nil && !*req.Active {
+		if err := s.store.SetBanned(ctx, req.UserName, true); err != nil {
+			return SCIMUser{}, apperr.New(apperr.Internal, "Failed to deactivate user")
+		}
+	}
+	return s.provisionedUser(ctx, req.UserName)
+}
+
+// updateProvisionedUser applies the attributes update sets to a user.
+// Deactivating a user bans them, revoking their sessions and closing their
+// connections.
+func (s *Server) updateProvisionedUser(ctx context.Context, username string, update provisionUpdate) (SCIMUser, *apperr.Error) {
+	if _, e := s.provisionedUser(ctx, username); e != nil {
+		return SCIMUser{}, e
+	}
+
+	if update.Emails != nil {
+		email, e := primaryEmail(*update.Emails)
+		if e != nil {
+			return SCIMUser{}, e
+		}
+		err := s.store.SetEmail(ctx, username, email)
+		if errors.Is(err, store.ErrEmailTaken) {
+			return SCIMUser{}, apperr.New(apperr.EmailTaken, "Email already registered")
+		}
+		if err != nil {
+			return SCIMUser{}, apperr.New(apperr.Internal, "Failed to update email")
+		}
+		s.trustEmail(ctx, email)
+	}
+
+	if update.Password != "" {
+		if err := auth.ValidatePassword(update.Password); err != nil {
+			return SCIMUser{}, apperr.New(apperr.InvalidPassword, err.Error())
+		}
+		hashedPassword, err := s.passwords.Hash(update.Password)
+		if err != nil {
+			return SCIMUser{}, apperr.New(apperr.Internal, "Failed to hash password")
+		}
+		if err := s.store.SetPasswordHash(ctx, username, hashedPassword); err != nil {
+			return SCIMUser{}, apperr.New(apperr.Internal, "Failed to update password")
+		}
+		if err := s.store.RevokeUserSessions(ctx, username); err != nil {
+			log.Printf("Error revoking sessions of %s: %v", username, err)
+		}
+	}
+
+	if update.Active != nil {
+		if err := s.store.SetBanned(ctx, username, !*update.Active); err != nil {
+			return SCIMUser{}, apperr.New(apperr.Internal, "Failed to update user")
+		}
+		if !*update.Active {
+			s.disconnectBanned(ctx, username)
+		}
+	}
+	return s.provisionedUser(ctx, username)
+}
+
+// deprovisionUser deletes a user's account like they would themselves: their
+// data is erased in the background.
+func (s *Server) deprovisionUser(ctx context.Context, username string) *apperr.Error {
+	err := s.store.RequestDeletion(ctx, username)
+	if errors.Is(err, store.ErrNotFound) {
+		return apperr.New(apperr.UserNotFound, "User not found")
+	}
+	if err != nil {
+		return apperr.New(apperr.Internal, "Failed to delete user")
+	}
+
+	if err := s.publishAdmin(ctx, adminMessage{Deleted: username}); err != nil {
+		log.Printf("Publish error, disconnecting %s locally: %v", username, err)
+		s.hub.Disconnect(username, websocket.CloseNormalClosure, "Account deleted")
+	}
+	return nil
+}
+
+// listProvisionedUsersHandler lists users a page at a time, with the SCIM
+// startIndex (from 1) and count parameters, or finds one with
+// filter=userName eq "<username>".
+func (s *Server) listProvisionedUsersHandler(c *gin.Context) {
+	ctx := c.Request.Context()
+	list := SCIMListResponse{Schemas: []string{scimListSchema}, StartIndex: 1, Resources: []SCIMUser{}}
+
+	if filter := c.Query("filter"); filter != "" {
+		m := userNameFilter.FindStringSubmatch(filter)
+		if m == nil {
+			c.Error(apperr.New(apperr.InvalidRequest, `Unsupported filter, expected userName eq "<username>"`))
+			return
+		}
+		user, e := s.provisionedUser(ctx, m[1])
+		if e != nil && e.Code != apperr.UserNotFound {
+			c.Error(e)
+			return
+		}
+		if e == nil {
+			list.Resources = append(list.Resources, user)
+		}
+		list.TotalResults = len(list.Resources)
+		list.ItemsPerPage = len(list.Resources)
+		c.JSON(http.StatusOK, list)
+		return
+	}
+
+	start, count := 1, 100
+	if v := c.Query("startIndex"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 {
+			c.Error(apperr.New(apperr.InvalidRequest, "Invalid startIndex"))
+			return
+		}
+		start = n
+	}
+	if v := c.Query("count"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 || n > 1000 {
+			c.Error(apperr.New(apperr.InvalidRequest, "Invalid count, expected 0 to 1000"))
+			return
+		}
+		count = n
+	}
+
+	users, total, err := s.store.ProvisionedUsers(ctx, start-1, count)
+	if err != nil {
+		c.Error(apperr.New(apperr.Internal, "Failed to fetch users"))
+		return
+	}
+	for _, u := range users {
+		list.Resources = append(list.Resources, scimUser(u))
+	}
+	list.TotalResults = total
+	list.StartIndex = start
+	list.ItemsPerPage = len(list.Resources)
+	c.JSON(http.StatusOK, list)
+}
+
+// getProvisionedUserHandler returns a user.
+func (s *Server) getProvisionedUserHandler(c *gin.Context) {
+	user, e := s.provisionedUser(c.Request.Context(), c.Param("username"))
+	if e != nil {
+		c.Error(e)
+		return
+	}
+
+	c.JSON(http.StatusOK, user)
+}
+
+// createProvisionedUserHandler creates a user.
+func (s *Server) createProvisionedUserHandler(c *gin.Context) {
+	var req provisionRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.Error(apperr.New(apperr.InvalidRequest, "Invalid request payload"))
+		return
+	}
+
+	user, e := s.provisionUser(c.Request.Context(), req)
+	if e != nil {
+		c.Error(e)
+		return
+	}
+	s.audit(c.Request.Context(), store.AuditEntry{Action: auditUserProvisioned, Target: user.UserName})
+
+	c.JSON(http.StatusCreated, user)
+}
+
+// updateProvisionedUserHandler updates a user's email, password or active
+// state.
+func (s *Server) updateProvisionedUserHandler(c *gin.Context) {
+	var update provisionUpdate
+	if err := c.ShouldBindJSON(&update); err != nil {
+		c.Error(apperr.New(apperr.InvalidRequest, "Invalid request payload"))
+		return
+	}
+
+	user, e := s.updateProvisionedUser(c.Request.Context(), c.Param("username"), update)
+	if e != nil {
+		c.Error(e)
+		return
+	}
+	s.audit(c.Request.Context(), store.AuditEntry{Action: auditUserUpdated, Target: user.UserName})
+
+	c.JSON(http.StatusOK, user)
+}
+
+// deleteProvisionedUserHandler deletes a user's account.
+func (s *Server) deleteProvisionedUserHandler(c *gin.Context) {
+	if e := s.deprovisionUser(c.Request.Context(), c.Param("username")); e != nil {
+		c.Error(e)
+		return
+	}
+	s.audit(c.Request.Context(), store.AuditEntry{Action: auditUserDeprovisioned, Target: c.Param("username")})
+
+	c.Status(http.StatusNoContent)
+}
+
+// bulkProvisionHandler applies provisioning operations in order. Each
+// succeeds or fails on its own; the response reports every outcome.
+func (s *Server) bulkProvisionHandler(c *gin.Context) {
+	var req bulkRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.Error(apperr.New(apperr.InvalidRequest, "Invalid request payload"))
+		return
+	}
+	if len(req.Operations) > maxBulkOperations {
+		c.Error(apperr.Newf(apperr.TooLarge, "At most %d operations are allowed", maxBulkOperations))
+		return
+	}
+
+	resp := bulkResponse{Schemas: []string{scimBulkResponseSchema}, Operations: []bulkResult{}}
+	for _, op := range req.Operations {
+		resp.Operations = append(resp.Operations, s.applyBulkOperation(c.Request.Context(), op))
+	}
+	c.JSON(http.StatusOK, resp)
+}
+
+// applyBulkOperation applies one operation of a bulk request.
+func (s *Server) applyBulkOperation(ctx context.Context, op bulkOperation) bulkResult {
+	result := bulkResult{Method: op.Method, BulkID: op.BulkID}
+	fail := func(e *apperr.Error) bulkResult {
+		resp := e.Response()
+		result.Status = strconv.Itoa(e.Code.Status())
+		result.Response = &resp
+		return result
+	}
+
+	path := strings.TrimPrefix(op.Path, "/")
+	username, hasUsername := strings.CutPrefix(path, "users/")
+	var user SCIMUser
+	var e *apperr.Error
+	var action string
+	switch {
+	case op.Method == http.MethodPost && path == "users":
+		var req provisionRequest
+		if err := json.Unmarshal(op.Data, &req); err != nil {
+			return fail(apperr.New(apperr.InvalidRequest, "Invalid data"))
+		}
+		user, e = s.provisionUser(ctx, req)
+		action = auditUserProvisioned
+		result.Status = strconv.Itoa(http.StatusCreated)
+	case op.Method == http.MethodPatch && hasUsername && username != "":
+		var update provisionUpdate
+		if err := json.Unmarshal(op.Data, &update); err != nil {
+			return fail(apperr.New(apperr.InvalidRequest, "Invalid data"))
+		}
+		user, e = s.updateProvisionedUser(ctx, username, update)
+		action = auditUserUpdated
+		result.Status = strconv.Itoa(http.StatusOK)
+	case op.Method == http.MethodDelete && hasUsername && username != "":
+		if e := s.deprovisionUser(ctx, username); e != nil {
+			return fail(e)
+		}
+		s.audit(ctx, store.AuditEntry{Action: auditUserDeprovisioned, Target: username})
+		result.Status = strconv.Itoa(http.StatusNoContent)
+		return result
+	default:
+		return fail(apperr.Newf(apperr.InvalidRequest, "Unsupported operation %s %s", op.Method, op.Path))
+	}
+
+	if e != nil {
+		return fail(e)
+	}
+	s.audit(ctx, store.AuditEntry{Action: action, Target: user.UserName})
+	result.Location = user.Meta.Location
+	return result
+}
+
+// APIKeyCreated is the response to creating an API key, the only time the
+// key itself is shown.
+type APIKeyCreated struct {
+	APIKey store.APIKey `json:"api_key"`
+	Key    string       `json:"key"`
+}
+
+// createAPIKeyHandler creates an API key for the provisioning API.
+func (s *Server) createAPIKeyHandler(c *gin.Context) {
+	var req struct {
+		Name string `json:"name"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil || req.Name == "" || len(req.Name) > 100 {
+		c.Error(apperr.New(apperr.InvalidRequest, "Invalid name, expected 1 to 100 characters"))
+		return
+	}
+
+	secret, err := auth.NewOpaqueToken()
+	if err != nil {
+		c.Error(apperr.New(apperr.Internal, "Failed to generate API key"))
+		return
+	}
+	key := apiKeyPrefix + secret
+
+	apiKey := store.APIKey{Name: req.Name, CreatedBy: auth.CurrentUser(c)}
+	if err := s.store.CreateAPIKey(c.Request.Context(), &apiKey, auth.HashToken(key)); err != nil {
+		c.Error(apperr.New(apperr.Internal, "Failed to create API key"))
+		return
+	}
+	s.audit(c.Request.Context(), store.AuditEntry{Action: auditAPIKeyCreated, Target: apiKey.ID, Details: map[string]string{"name": apiKey.Name}})
+
+	c.JSON(http.StatusCreated, APIKeyCreated{APIKey: apiKey, Key: key})
+}
+
+// apiKeysHandler lists the API keys that were not revoked.
+func (s *Server) apiKeysHandler(c *gin.Context) {
+	keys, err := s.store.APIKeys(c.Request.Context())
+	if err != nil {
+		c.Error(apperr.New(apperr.Internal, "Failed to fetch API keys"))
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"api_keys": keys})
+}
+
+// revokeAPIKeyHandler revokes an API key.
+func (s *Server) revokeAPIKeyHandler(c *gin.Context) {
+	id := c.Param("id")
+	if _, err := strconv.Atoi(id); err != nil {
+		c.Error(apperr.New(apperr.NotFound, "API key not found"))
+		return
+	}
+
+	err := s.store.RevokeAPIKey(c.Request.Context(), id)
+	if errors.Is(err, store.ErrNotFound) {
+		c.Error(apperr.New(apperr.NotFound, "API key not found"))
+		return
+	}
+	if err != nil {
+		c.Error(apperr.New(apperr.Internal, "Failed to revoke API key"))
+		return
+	}
+	s.audit(c.Request.Context(), store.AuditEntry{Action: auditAPIKeyRevoked, Target: id})
+
+	c.JSON(http.StatusOK, gin.H{"message": s.tr(c, "API key revoked successfully")})
+}
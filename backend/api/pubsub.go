@@ -0,0 +1,197 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"time"
+
+	"backend/metrics"
+	"backend/pubsub"
+	"backend/store"
+	"backend/tracing"
+	"backend/ws"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	// streamAppendTimeout bounds how long a sender waits for a message to be
+	// appended to the streams of its users.
+	streamAppendTimeout = 2 * time.Second
+	// streamReadBlock is how long a read waits for new entries. Users who
+	// connect meanwhile are read from at the next read, so it also bounds
+	// how late their first messages arrive.
+	streamReadBlock = time.Second
+	// streamReadCount caps the entries read per user at once.
+	streamReadCount = 100
+	// streamRetryWait is how long reading pauses after Redis fails.
+	streamRetryWait = time.Second
+)
+
+// registerClient adds a client to the hub and has this instance read its
+// user's stream. If the instance read it before it last restarted, the
+// entries it had not delivered by then are delivered now.
+func (s *Server) registerClient(client *ws.Client) {
+	ctx := context.Background()
+	first := !s.hub.Connected(client.UserID)
+	existed, err := s.streams.Join(ctx, client.UserID)
+	if err != nil {
+		log.Printf("Error joining stream of %s: %v", client.UserID, err)
+	}
+	s.hub.Register(client)
+	if first && existed {
+		s.readStreams(ctx, []string{client.UserID}, true)
+	}
+}
+
+// unregisterClient removes a client from the hub, and stops this instance
+// reading its user's stream once the user has no other connection here. It
+// reports whether the client was the user's last connection.
+func (s *Server) unregisterClient(client *ws.Client) bool {
+	last := s.hub.Unregister(client)
+	if !s.hub.Connected(client.UserID) {
+		if err := s.streams.Leave(context.Background(), client.UserID); err != nil {
+			log.Printf("Error leaving stream of %s: %v", client.UserID, err)
+		}
+	}
+	return last
+}
+
+// consumeStreams delivers the messages appended to the streams of the users
+// connected to this instance, for as long as the server runs.
+func (s *Server) consumeStreams() {
+	ctx := context.Background()
+	for {
+		users := s.hub.Users()
+		if len(users) == 0 {
+			time.Sleep(streamReadBlock)
+			continue
+		}
+		s.readStreams(ctx, users, false)
+	}
+}
+
+// readStreams reads the streams of the users, new entries or, with pending
+// set, those read before but not acknowledged, delivers them and
+// acknowledges them. A stream whose consumer group is missing, because Redis
+// lost it, is joined again.
+func (s *Server) readStreams(ctx context.Context, users []string, pending bool) {
+	entries, err := s.streams.Read(ctx, users, pending, streamReadCount, streamReadBlock)
+	if errors.Is(err, pubsub.ErrNoGroup) {
+		for _, username := range s.hub.Users() {
+			if _, err := s.streams.Join(ctx, username); err != nil {
+				log.Printf("Error joining stream of %s: %v", username, err)
+			}
+		}
+		return
+	}
+	if err != nil {
+		log.Printf("Error reading message streams: %v", err)
+		time.Sleep(streamRetryWait)
+		return
+	}
+
+	for _, entry := range entries {
+		s.deliverEntry(entry)
+	}
+	if err := s.streams.Ack(ctx, entries); err != nil {
+		log.Printf("Error acknowledging message stream entries: %v", err)
+	}
+}
+
+// broadcastPayload is a message as appended to the streams. Trace carries
+// the trace context of the publisher, so delivery on every instance joins
+// the trace that sent the message.
+type broadcastPayload struct {
+	store.Message
+	Trace map[string]string `json:"trace,omitempty"`
+}
+
+// broadcastMessage appends a message to the streams of its sender and
+// receiver, or only its sender's if it is shadowed, for the instances
+// hosting them to deliver. If Redis fails the
+// message is still delivered to local clients, and other participants see
+// it when they next load the conversation. The broadcast keeps the trace of
+// ctx but not its cancellation, so a sender that goes away does not stop it.
+func (s *Server) broadcastMessage(ctx context.Context, msg store.Message) {
+	ctx, cancel := context.WithTimeout(tracing.Detach(ctx), streamAppendTimeout)
+	defer cancel()
+	ctx, span := tracing.Start(ctx, "broadcast publish",
+		trace.WithSpanKind(trace.SpanKindProducer),
+		trace.WithAttributes(attribute.String("messaging.system", "redis")))
+	defer span.End()
+
+	payload, err := json.Marshal(broadcastPayload{Message: msg, Trace: tracing.Inject(ctx)})
+	if err != nil {
+		tracing.Fail(span, err)
+		log.Printf("Error encoding message for broadcast: %v", err)
+		return
+	}
+	if err := s.streams.Append(ctx, payload, recipients(msg)...); err != nil {
+		tracing.Fail(span, err)
+		log.Printf("Error appending message %s to streams, delivering locally: %v", msg.ID, err)
+		metrics.BroadcastFailures.Inc()
+		s.deliverMessage(msg)
+	}
+}
+
+// deliverEntry delivers a message read from a user's stream to the user's
+// locally connected clients.
+func (s *Server) deliverEntry(entry pubsub.Entry) {
+	// Payloads without a trace decode as well.
+	var payload broadcastPayload
+	if err := json.Unmarshal([]byte(entry.Payload), &payload); err != nil {
+		log.Printf("Error decoding stream entry %s: %v", entry.ID, err)
+		return
+	}
+	ctx := tracing.Extract(context.Background(), payload.Trace)
+	_, span := tracing.Start(ctx, "broadcast deliver",
+		trace.WithSpanKind(trace.SpanKindConsumer),
+		trace.WithAttributes(attribute.String("messaging.system", "redis")))
+	s.hub.SendToUser(entry.Username, ws.Event{Type: ws.TypeMessage, Payload: payload.Message})
+	span.End()
+}
+
+// subscribeMessages delivers presence changes, admin actions, typed events
+// and channel posts published by any instance to the clients connected to this one.
+func (s *Server) subscribeMessages() {
+	sub, err := s.bus.Subscribe(context.Background(), presenceChannel, adminChannel, eventChannel, channelPostChannel)
+	if err != nil {
+		log.Printf("Error subscribing to other instances, delivering local events only: %v", err)
+		return
+	}
+	defer sub.Close()
+
+	for m := range sub.Messages() {
+		switch m.Channel {
+		case presenceChannel:
+			s.deliverPresence(m.Payload)
+		case adminChannel:
+			s.deliverAdmin(m.Payload)
+		case eventChannel:
+			s.deliverEvent(m.Payload)
+		case channelPostChannel:
+			s.deliverChannelPost(m.Payload)
+		}
+	}
+}
+
+// deliverMessage sends a message to the relevant locally connected clients.
+func (s *Server) deliverMessage(msg store.Message) {
+	event := ws.Event{Type: ws.TypeMessage, Payload: msg}
+	for _, username := range recipients(msg) {
+		s.hub.SendToUser(username, event)
+	}
+}
+
+// recipients returns who a message is delivered to: its participants, or
+// only its sender if it is shadowed.
+func recipients(msg store.Message) []string {
+	if msg.Shadowed {
+		return []string{msg.Sender}
+	}
+	return []string{msg.Sender, msg.Receiver}
+}
@@ -0,0 +1,76 @@
+package api
+
+import (
+	"errors"
+	"log"
+	"net/http"
+
+	"backend/apperr"
+	"backend/auth"
+	"backend/store"
+
+	"github.com/gin-gonic/gin"
+)
+
+// maxReadStateSync caps the conversations synced in one request.
+const maxReadStateSync = 500
+
+// ReadPosition is the last message a client has seen of a conversation,
+// named by the other participant.
+type ReadPosition struct {
+	Conversation string `json:"conversation"`
+	LastReadID   string `json:"last_read_id"`
+}
+
+// ReadPositionResult is the outcome of syncing one read position: the IDs of
+// the messages it marked read, or why it could not be applied.
+type ReadPositionResult struct {
+	ReadPosition
+	ReadIDs []string         `json:"read_ids"`
+	Error   *apperr.Response `json:"error,omitempty"`
+}
+
+// syncReadStateHandler applies the read positions of a reconnecting client
+// across its conversations in one request. Each position marks every unread
+// message from the other participant up to it as read, and is applied on
+// its own: one that fails is reported in its result and does not stop the
+// others.
+func (s *Server) syncReadStateHandler(c *gin.Context) {
+	ctx := c.Request.Context()
+	reader := auth.CurrentUser(c)
+
+	var positions []ReadPosition
+	if err := c.ShouldBindJSON(&positions); err != nil {
+		c.Error(apperr.New(apperr.InvalidRequest, err.Error()))
+		return
+	}
+	if len(positions) > maxReadStateSync {
+		c.Error(apperr.Newf(apperr.TooLarge, "At most %d conversations may be synced at once", maxReadStateSync))
+		return
+	}
+
+	lang := s.locale(c)
+	results := make([]ReadPositionResult, len(positions))
+	for i, pos := range positions {
+		results[i] = ReadPositionResult{ReadPosition: pos, ReadIDs: []string{}}
+
+		var e *apperr.Error
+		if pos.Conversation == "" || pos.LastReadID == "" {
+			e = apperr.New(apperr.InvalidRequest, "Missing conversation or last_read_id")
+		} else if updated, err := s.store.MarkConversationReadUpTo(ctx, reader, pos.Conversation, pos.LastReadID); errors.Is(err, store.ErrNotFound) {
+			e = apperr.New(apperr.MessageNotFound, "Message not found in this conversation")
+		} else if err != nil {
+			log.Printf("Error syncing read position of %s in conversation with %s: %v", reader, pos.Conversation, err)
+			e = apperr.New(apperr.Internal, "Failed to update message status")
+		} else if len(updated) > 0 {
+			results[i].ReadIDs = updated
+			s.announceRead(ctx, updated, pos.Conversation, reader)
+		}
+		if e != nil {
+			resp := e.LocalizedResponse(lang)
+			results[i].Error = &resp
+		}
+	}
+
+	c.JSON(http.StatusOK, gin.H{"results": results})
+}
@@ -0,0 +1,34 @@
+package api
+
+import (
+	"errors"
+	"log"
+	"net/http"
+
+	"backend/apperr"
+	"backend/auth"
+	"backend/store"
+
+	"github.com/gin-gonic/gin"
+)
+
+// threadHandler returns the whole reply thread a message belongs to: its
+// root message followed by every reply beneath it, oldest first.
+func (s *Server) threadHandler(c *gin.Context) {
+	if _, _, ok := s.authorizeMessage(c, c.Param("id")); !ok {
+		return
+	}
+
+	rootID, messages, err := s.store.Thread(c.Request.Context(), c.Param("id"), auth.CurrentUser(c))
+	if errors.Is(err, store.ErrNotFound) {
+		c.Error(apperr.New(apperr.MessageNotFound, "Message not found"))
+		return
+	}
+	if err != nil {
+		log.Printf("Error fetching thread of message %s: %v", c.Param("id"), err)
+		c.Error(apperr.New(apperr.Internal, "Failed to fetch thread"))
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"root_id": rootID, "messages": messages})
+}
@@ -0,0 +1,130 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strconv"
+	"time"
+
+	"backend/auth"
+	"backend/ws"
+
+	"github.com/go-redis/redis/v8"
+)
+
+const (
+	// resumeTTL is how long after its last frame a session can be resumed.
+	resumeTTL = 2 * time.Minute
+	// resumeMaxFrames caps the frames kept per session. A client that missed
+	// more refetches instead of resuming.
+	resumeMaxFrames = 1000
+	// resumeRecordTimeout bounds how long recording a frame may hold up the
+	// write path.
+	resumeRecordTimeout = time.Second
+)
+
+// SessionEvent is sent to version 2 clients when they connect. ResumeToken
+// together with the seq of the last frame received resumes the session on a
+// new connection; Resumed reports whether this connection did so, otherwise
+// the client should refetch what it shows.
+type SessionEvent struct {
+	ResumeToken string `json:"resume_token"`
+	Resumed     bool   `json:"resumed"`
+	ExpiresIn   int    `json:"expires_in"`
+}
+
+// resumeKey returns the Redis key of the stream recording the frames written
+// in username's session with the resume token. Only the token's hash is
+// used, and a token only resumes sessions of the user it was issued to.
+func resumeKey(username, token string) string {
+	return fmt.Sprintf("ws:resume:%s:%s", username, auth.HashToken(token))
+}
+
+// resumeJournal records the frames written to a client in a Redis stream
+// that expires resumeTTL after the last one.
+type resumeJournal struct {
+	rdb *redis.Client
+	key string
+}
+
+// Record implements ws.Journal.
+func (j *resumeJournal) Record(seq uint64, frame []byte) {
+	ctx, cancel := context.WithTimeout(context.Background(), resumeRecordTimeout)
+	defer cancel()
+	_, err := j.rdb.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.XAdd(ctx, &redis.XAddArgs{
+			Stream: j.key,
+			MaxLen: resumeMaxFrames,
+			Approx: true,
+			Values: map[string]interface{}{"seq": seq, "frame": frame},
+		})
+		pipe.Expire(ctx, j.key, resumeTTL)
+		return nil
+	})
+	if err != nil {
+		log.Printf("Error recording WebSocket frame: %v", err)
+	}
+}
+
+// startSession resumes the session of a version 2 client with the resume
+// token, replaying the frames it missed after lastSeq, then issues the
+// client a resume token for its new connection. It must run before the
+// client's WritePump starts. It reports false if the client could not be
+// written to.
+func (s *Server) startSession(client *ws.Client, resumeToken string, lastSeq uint64) bool {
+	ctx := context.Background()
+	resumed := false
+	if resumeToken != "" {
+		frames, ok, err := s.missedFrames(ctx, resumeKey(client.UserID, resumeToken), lastSeq)
+		if err != nil {
+			log.Printf("Error loading frames to resume %s's session: %v", client.UserID, err)
+		}
+		if ok {
+			if err := client.Replay(lastSeq, frames); err != nil {
+				return false
+			}
+			resumed = true
+		}
+	}
+
+	token, err := auth.NewOpaqueToken()
+	if err != nil {
+		log.Printf("Error generating resume token: %v", err)
+		return true
+	}
+	client.SetJournal(&resumeJournal{rdb: s.rdb, key: resumeKey(client.UserID, token)})
+	err = client.WriteEvent(ws.Event{Type: ws.TypeSession, Payload: SessionEvent{
+		ResumeToken: token,
+		Resumed:     resumed,
+		ExpiresIn:   int(resumeTTL.Seconds()),
+	}})
+	return err == nil
+}
+
+// missedFrames returns the frames recorded in the session stream key after
+// lastSeq. It reports false if the session expired, or if frames after
+// lastSeq were already trimmed from the stream, as replaying the rest would
+// leave a gap.
+func (s *Server) missedFrames(ctx context.Context, key string, lastSeq uint64) ([]ws.Frame, bool, error) {
+	entries, err := s.rdb.XRange(ctx, key, "-", "+").Result()
+	if err != nil || len(entries) == 0 {
+		return nil, false, err
+	}
+
+	var frames []ws.Frame
+	for i, entry := range entries {
+		seq, err := strconv.ParseUint(fmt.Sprint(entry.Values["seq"]), 10, 64)
+		if err != nil {
+			return nil, false, fmt.Errorf("bad seq in %s: %w", key, err)
+		}
+		if i == 0 && seq > lastSeq+1 {
+			return nil, false, nil
+		}
+		if seq > lastSeq {
+			data, _ := entry.Values["frame"].(string)
+			frames = append(frames, ws.Frame{Seq: seq, Data: []byte(data)})
+		}
+	}
+	return frames, true, nil
+}
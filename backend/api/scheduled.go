@@ -0,0 +1,69 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"backend/apperr"
+	"backend/auth"
+	"backend/metrics"
+	"backend/store"
+
+	"github.com/gin-gonic/gin"
+)
+
+// scheduleMessage stores msg to be sent at sendAt.
+func (s *Server) scheduleMessage(c *gin.Context, msg store.Message, sendAt time.Time) {
+	sm := store.ScheduledMessage{
+		Sender:    msg.Sender,
+		Receiver:  msg.Receiver,
+		Content:   msg.Content,
+		Format:    msg.Format,
+		ReplyToID: msg.ReplyToID,
+		SendAt:    sendAt.UTC(),
+	}
+	if err := s.messages.Schedule(c.Request.Context(), &sm); err != nil {
+		c.Error(sendFailure(err))
+		return
+	}
+
+	c.JSON(http.StatusAccepted, gin.H{"scheduled_message": sm})
+}
+
+// scheduledMessagesHandler lists the authenticated user's pending scheduled messages.
+func (s *Server) scheduledMessagesHandler(c *gin.Context) {
+	scheduled, err := s.store.ScheduledMessages(c.Request.Context(), auth.CurrentUser(c))
+	if err != nil {
+		c.Error(apperr.New(apperr.Internal, "Failed to fetch scheduled messages"))
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"scheduled_messages": scheduled})
+}
+
+// cancelScheduledHandler cancels one of the authenticated user's scheduled
+// messages before it is sent.
+func (s *Server) cancelScheduledHandler(c *gin.Context) {
+	cancelled, err := s.store.CancelScheduled(c.Request.Context(), c.Param("id"), auth.CurrentUser(c))
+	if err != nil {
+		c.Error(apperr.New(apperr.Internal, "Failed to cancel scheduled message"))
+		return
+	}
+	if !cancelled {
+		c.Error(apperr.New(apperr.NotFound, "Scheduled message not found"))
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": s.tr(c, "Scheduled message cancelled")})
+}
+
+// RunScheduler sends scheduled messages as they fall due until ctx is done.
+func (s *Server) RunScheduler(ctx context.Context) {
+	s.scheduler.Run(ctx)
+}
+
+// countScheduledSent records a scheduled message that was sent.
+func countScheduledSent(store.Message) {
+	metrics.MessagesSent.WithLabelValues("scheduled").Inc()
+}
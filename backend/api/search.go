@@ -0,0 +1,60 @@
+package api
+
+import (
+	"log"
+	"net/http"
+	"strconv"
+
+	"backend/apperr"
+	"backend/auth"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Pagination limits for message search.
+const (
+	defaultSearchLimit = 20
+	maxSearchLimit     = 100
+)
+
+// searchMessagesHandler searches the content of messages in conversations
+// the authenticated user participates in.
+func (s *Server) searchMessagesHandler(c *gin.Context) {
+	username := auth.CurrentUser(c)
+	query := c.Query("q")
+	if query == "" {
+		c.Error(apperr.New(apperr.InvalidRequest, "Missing search query"))
+		return
+	}
+
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", strconv.Itoa(defaultSearchLimit)))
+	if err != nil || limit <= 0 || limit > maxSearchLimit {
+		c.Error(apperr.New(apperr.InvalidRequest, "Invalid limit"))
+		return
+	}
+	offset, err := strconv.Atoi(c.DefaultQuery("offset", "0"))
+	if err != nil || offset < 0 {
+		c.Error(apperr.New(apperr.InvalidRequest, "Invalid offset"))
+		return
+	}
+
+	// Fetch one extra row to know whether another page exists.
+	results, err := s.store.Search(c.Request.Context(), username, query, limit+1, offset)
+	if err != nil {
+		log.Printf("Error searching messages of %s: %v", username, err)
+		c.Error(apperr.New(apperr.Internal, "Failed to search messages"))
+		return
+	}
+
+	hasMore := len(results) > limit
+	if hasMore {
+		results = results[:limit]
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"results":  results,
+		"limit":    limit,
+		"offset":   offset,
+		"has_more": hasMore,
+	})
+}
@@ -0,0 +1,548 @@
+// Package api implements the HTTP and WebSocket API of the chat server.
+package api
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"log"
+	"net/http"
+	"sync/atomic"
+	"time"
+
+	"backend/analytics"
+	"backend/apperr"
+	"backend/auth"
+	"backend/blob"
+	"backend/cache"
+	"backend/email"
+	"backend/events"
+	"backend/ipfilter"
+	"backend/metrics"
+	"backend/moderation"
+	"backend/pubsub"
+	"backend/ratelimit"
+	"backend/service"
+	"backend/store"
+	"backend/tracing"
+	"backend/usernames"
+	"backend/ws"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-redis/redis/v8"
+	"github.com/gorilla/websocket"
+	"github.com/graph-gophers/graphql-go"
+)
+
+// Rate limits applied to the public endpoints and to message sending.
+var (
+	signupLimit        = ratelimit.Limit{Name: "signup", Burst: 5, PerSecond: 5.0 / 3600}
+	loginLimit         = ratelimit.Limit{Name: "login", Burst: 10, PerSecond: 10.0 / 60}
+	messageLimit       = ratelimit.Limit{Name: "message", Burst: 20, PerSecond: 5}
+	frameLimit         = ratelimit.Limit{Name: "ws_frame", Burst: 200, PerSecond: 50}
+	passwordResetLimit = ratelimit.Limit{Name: "password_reset", Burst: 5, PerSecond: 5.0 / 3600}
+	verifyEmailLimit   = ratelimit.Limit{Name: "email_verification", Burst: 5, PerSecond: 5.0 / 3600}
+	hookLimit          = ratelimit.Limit{Name: "hook", Burst: 20, PerSecond: 1}
+	batchLimit         = ratelimit.Limit{Name: "message_batch", Burst: 5, PerSecond: 1}
+	archiveLimit       = ratelimit.Limit{Name: "message_archive", Burst: 10, PerSecond: 1}
+)
+
+// Login lockouts. Repeated failed logins lock out the account, and an
+// address failing across many accounts, with a delay that doubles on every
+// further failure.
+var (
+	accountLockout = ratelimit.Backoff{Name: "login_account", Threshold: 5, BaseDelay: 30 * time.Second, MaxDelay: time.Hour, Window: 24 * time.Hour}
+	ipLockout      = ratelimit.Backoff{Name: "login_ip", Threshold: 20, BaseDelay: time.Minute, MaxDelay: time.Hour, Window: time.Hour}
+)
+
+// Notifier notifies users of messages received while they are offline.
+type Notifier interface {
+	Notify(ctx context.Context, msg store.Message)
+}
+
+// Config holds the dependencies and settings of a Server.
+type Config struct {
+	Store store.Store
+	Redis *redis.Client
+	// Bus carries messages and events between instances; nil publishes
+	// through Redis.
+	Bus      pubsub.Bus
+	Tokens   *auth.Tokens
+	Email    email.Sender
+	Notifier Notifier
+
+	CORS CORSConfig
+	// AppURL is the frontend base URL used in emailed links.
+	AppURL string
+	// Blobs stores attachment files, up to MaxUploadBytes each. If it is a
+	// blob.Presigner, clients upload and download files directly through
+	// URLs lasting PresignExpiry.
+	Blobs          blob.Store
+	MaxUploadBytes int64
+	PresignExpiry  time.Duration
+	// MediaWorkers is how many workers render thumbnails of uploaded
+	// images.
+	MediaWorkers int
+	// VAPIDPublicKey is handed to browsers subscribing to Web Push.
+	VAPIDPublicKey string
+	// MessageCacheSize is how many recent messages per conversation are
+	// cached in Redis; zero disables the cache.
+	MessageCacheSize int
+	// MaxMessageLength is the most characters a message's content may have,
+	// service.DefaultMaxContentLength if zero.
+	MaxMessageLength int
+	// ContentFilter screens messages before delivery at DefaultStrictness,
+	// unless a conversation's participants chose otherwise.
+	ContentFilter     *moderation.Pipeline
+	DefaultStrictness moderation.Strictness
+	// Events publishes domain events to a message queue; nil publishes
+	// none.
+	Events events.Publisher
+	// Analytics receives anonymized usage events of users who did not opt
+	// out, identified by their username hashed with AnalyticsKey; nil tracks
+	// nothing.
+	Analytics    analytics.Sink
+	AnalyticsKey []byte
+	// Quotas limit how many messages each user sends and how much they
+	// store.
+	Quotas service.Quotas
+	// MessageRetention is how long messages are kept, zero for ever. Older
+	// months are archived if ArchiveOldMessages is set, or dropped.
+	MessageRetention   time.Duration
+	ArchiveOldMessages bool
+	// InstanceID names this instance among the others, random if empty.
+	InstanceID string
+	// IPFilter blocks clients by address and country before they
+	// authenticate; nil blocks nobody.
+	IPFilter *ipfilter.Filter
+	// TrustedProxies are the addresses, as IPs or CIDR ranges, whose
+	// X-Forwarded-For and X-Real-IP headers name the client. Nil trusts
+	// none, so clients are known by the address they connect from.
+	TrustedProxies []string
+	// RequireVerifiedEmail requires an email at signup and stops users
+	// logging in until they verify theirs.
+	RequireVerifiedEmail bool
+	// Usernames decides which usernames may be signed up or renamed to;
+	// nil applies usernames.Default.
+	Usernames *usernames.Policy
+	// WSCompression negotiates permessage-deflate with WebSocket clients
+	// that support it.
+	WSCompression bool
+	// GzipMinBytes is the size from which JSON responses are gzipped for
+	// clients accepting it; 0 disables compression.
+	GzipMinBytes int
+	// CookieAuth also hands out tokens in HttpOnly cookies and accepts them
+	// from there, checking CSRF tokens on requests authenticated by cookie.
+	CookieAuth bool
+	// Passwords hashes new passwords and checks existing ones; nil applies
+	// auth.DefaultHasher.
+	Passwords *auth.Hasher
+}
+
+// Server serves the chat API. Messages are appended to the streams of their
+// users, other events fanned out to every instance through the pub/sub bus,
+// and both delivered to the WebSocket clients held by hub.
+type Server struct {
+	store     store.Store
+	rdb       *redis.Client
+	bus       pubsub.Bus
+	tokens    *auth.Tokens
+	passwords *auth.Hasher
+	email     email.Sender
+	notifier  Notifier
+	limiter   *ratelimit.Limiter
+	lockout   *ratelimit.Lockout
+	hub       *ws.Hub
+	messages  *service.MessageService
+	sessions  *service.SessionService
+	votes     *service.VoteService
+	channels  *service.ChannelService
+	scheduler *service.Scheduler
+	reaper    *service.Reaper
+	eraser    *service.AccountEraser
+	retention *service.Retention
+	webhooks  *service.Webhooks
+	media     *service.MediaProcessor
+	events    *events.Stream
+	analytics *analytics.Tracker
+	cache     *cache.Messages
+	top       *cache.TopMessages
+	graphql   *graphql.Schema
+
+	// upgrader and graphQLUpgrader accept WebSockets from the origins CORS
+	// allows.
+	upgrader        websocket.Upgrader
+	graphQLUpgrader websocket.Upgrader
+
+	cors           CORSConfig
+	origins        originPolicy
+	ipFilter       *ipfilter.Filter
+	trustedProxies []string
+	usernames      *usernames.Policy
+	// verifyEmail requires an email at signup, verified before logging in.
+	verifyEmail    bool
+	cookieAuth     bool
+	gzipMinBytes   int
+	appURL         string
+	blobs          blob.Store
+	maxUploadBytes int64
+	presignExpiry  time.Duration
+	vapidPublicKey string
+
+	// streams delivers messages to the instances hosting their users.
+	streams *pubsub.Streams
+
+	// migrationsApplied is set once the schema migrations have run.
+	migrationsApplied atomic.Bool
+	// shuttingDown is set when the server starts draining, so orchestrators
+	// stop routing new traffic to it.
+	shuttingDown atomic.Bool
+}
+
+// New creates a Server.
+func New(cfg Config) (*Server, error) {
+	s := &Server{
+		store:          cfg.Store,
+		rdb:            cfg.Redis,
+		bus:            cfg.Bus,
+		tokens:         cfg.Tokens,
+		passwords:      cfg.Passwords,
+		email:          cfg.Email,
+		notifier:       cfg.Notifier,
+		limiter:        ratelimit.New(cfg.Redis),
+		lockout:        ratelimit.NewLockout(cfg.Redis),
+		hub:            ws.NewHub(),
+		events:         events.NewStream(cfg.Events),
+		analytics:      analytics.NewTracker(cfg.Analytics, cfg.AnalyticsKey, cfg.Store.AnalyticsOptOut),
+		cache:          cache.NewMessages(cfg.Redis, cfg.MessageCacheSize),
+		top:            cache.NewTopMessages(cfg.Redis, cfg.Store.VoteScores),
+		cors:           cfg.CORS,
+		origins:        newOriginPolicy(cfg.CORS.Origins),
+		ipFilter:       cfg.IPFilter,
+		trustedProxies: cfg.TrustedProxies,
+		usernames:      cfg.Usernames,
+		verifyEmail:    cfg.RequireVerifiedEmail,
+		cookieAuth:     cfg.CookieAuth,
+		gzipMinBytes:   cfg.GzipMinBytes,
+		appURL:         cfg.AppURL,
+		blobs:          cfg.Blobs,
+		maxUploadBytes: cfg.MaxUploadBytes,
+		presignExpiry:  cfg.PresignExpiry,
+		vapidPublicKey: cfg.VAPIDPublicKey,
+	}
+	if s.bus == nil {
+		s.bus = pubsub.NewRedis(cfg.Redis)
+	}
+	if s.usernames == nil {
+		s.usernames = usernames.Default()
+	}
+	if s.passwords == nil {
+		s.passwords = auth.DefaultHasher()
+	}
+	token := cfg.InstanceID
+	if token == "" {
+		instanceID := make([]byte, 16)
+		if _, err := rand.Read(instanceID); err != nil {
+			return nil, err
+		}
+		token = hex.EncodeToString(instanceID)
+	}
+	s.streams = pubsub.NewStreams(cfg.Redis, token)
+
+	s.webhooks = service.NewWebhooks(cfg.Store, cfg.Redis, token)
+	s.messages = service.NewMessageService(cfg.Store, service.PublisherFunc(s.publishSent), cfg.ContentFilter, cfg.DefaultStrictness, s.webhooks, cfg.Quotas, cfg.MaxMessageLength)
+	s.sessions = service.NewSessionService(cfg.Store, cfg.Tokens, s.passwords, cfg.RequireVerifiedEmail)
+	s.votes = service.NewVoteService(cfg.Store, cfg.Redis, s.afterVote)
+	s.channels = service.NewChannelService(cfg.Store)
+	s.graphql = newGraphQLSchema(s)
+	s.upgrader = newUpgrader(s.origins, cfg.WSCompression)
+	s.graphQLUpgrader = newGraphQLUpgrader(s.origins, cfg.WSCompression)
+
+	s.scheduler = service.NewScheduler(cfg.Store, cfg.Redis, s.messages, token, countScheduledSent)
+	s.reaper = service.NewReaper(cfg.Store, cfg.Blobs, cfg.Redis, token, s.afterExpired)
+	s.eraser = service.NewAccountEraser(cfg.Store, cfg.Blobs, cfg.Redis, token, s.afterErased)
+	s.retention = service.NewRetention(cfg.Store, cfg.Blobs, cfg.Redis, token, cfg.MessageRetention, cfg.ArchiveOldMessages)
+	s.media = service.NewMediaProcessor(cfg.Store, cfg.Blobs, cfg.MediaWorkers, s.broadcastMessageByID)
+	return s, nil
+}
+
+// publishSent caches and broadcasts a newly sent message, notifies its
+// receiver if they are offline or mentioned, and reports it to webhooks,
+// including the receiver's own if they are a bot, and the event stream. A
+// shadowed message is only shown to its sender, as if it had been sent.
+func (s *Server) publishSent(ctx context.Context, msg store.Message) {
+	if msg.Shadowed {
+		s.cache.Invalidate(context.Background(), msg.Sender, msg.Receiver)
+		s.broadcastMessage(ctx, msg)
+		return
+	}
+	s.cache.Append(context.Background(), msg)
+	s.broadcastMessage(ctx, msg)
+	s.publishMention(msg)
+	go s.notifyIfOffline(msg)
+	s.webhooks.EmitTo(context.Background(), service.EventMessageCreated, msg.Receiver, msg)
+	s.events.Emit(events.MessageSent, events.ConversationKey(msg.Sender, msg.Receiver), msg)
+	s.trackMessageSent(msg)
+}
+
+// RunEvents publishes domain events to the message queue until ctx is done,
+// then publishes what is still queued and disconnects.
+func (s *Server) RunEvents(ctx context.Context) {
+	s.events.Run(ctx)
+}
+
+// RunAnalytics sends usage analytics events to the sink until ctx is done,
+// then sends what is still queued and closes it.
+func (s *Server) RunAnalytics(ctx context.Context) {
+	s.analytics.Run(ctx)
+}
+
+// userKey is the context key of the authenticated username of a gRPC call or
+// GraphQL operation.
+type userKey struct{}
+
+// withUser returns a copy of ctx carrying the authenticated username.
+func withUser(ctx context.Context, username string) context.Context {
+	return context.WithValue(ctx, userKey{}, username)
+}
+
+// contextUser returns the username withUser stored in ctx.
+func contextUser(ctx context.Context) string {
+	username, _ := ctx.Value(userKey{}).(string)
+	return username
+}
+
+// byUser keys a rate limit by the authenticated username.
+func byUser(c *gin.Context) string {
+	return auth.CurrentUser(c)
+}
+
+// Handler returns the HTTP handler serving every route. API routes are
+// served under /api/v1 and, deprecated, at their unversioned paths.
+func (s *Server) Handler() http.Handler {
+	r := gin.Default()
+	if err := r.SetTrustedProxies(s.trustedProxies); err != nil {
+		log.Printf("Error setting trusted proxies: %v", err)
+	}
+	r.Use(tracing.Middleware())
+	r.Use(metrics.Middleware())
+	r.Use(apperr.Middleware(s.locale))
+	r.Use(auditMiddleware())
+
+	r.Use(s.corsMiddleware())
+	r.Use(s.gzipMiddleware())
+
+	// Operational routes are not part of the versioned API.
+	r.GET("/metrics", metrics.Handler)
+	r.GET("/healthz", s.healthzHandler)
+	r.GET("/readyz", s.readyzHandler)
+
+	// Defined the routes of API version 1. Blocked clients are turned away
+	// before anything else.
+	v1 := r.Group(apiV1, s.ipFilterMiddleware())
+	v1.POST("/signup", s.limiter.Middleware(signupLimit, ratelimit.ByIP), s.signupHandler)
+	v1.POST("/login", s.limiter.Middleware(loginLimit, ratelimit.ByIP), s.loginHandler)
+	v1.POST("/token/refresh", s.refreshTokenHandler)
+	v1.POST("/logout", s.logoutHandler)
+	v1.POST("/password/forgot", s.limiter.Middleware(passwordResetLimit, ratelimit.ByIP), s.forgotPasswordHandler)
+	v1.POST("/password/reset", s.limiter.Middleware(passwordResetLimit, ratelimit.ByIP), s.resetPasswordHandler)
+	v1.POST("/email/verify", s.limiter.Middleware(verifyEmailLimit, ratelimit.ByIP), s.verifyEmailHandler)
+	v1.POST("/email/verify/resend", s.limiter.Middleware(verifyEmailLimit, ratelimit.ByIP), s.resendVerificationHandler)
+
+	// The spec is built once every route is registered, below.
+	var spec map[string]interface{}
+	v1.GET("/openapi.json", func(c *gin.Context) { c.JSON(http.StatusOK, spec) })
+	v1.GET("/docs", docsHandler)
+	// WebSockets authenticate after the upgrade, so browsers need not put
+	// the token in the URL.
+	v1.GET("/ws", s.wsHandler)
+	v1.POST("/hooks/:token", s.limiter.Middleware(hookLimit, byHookToken), s.incomingHookHandler)
+
+	// The provisioning API authenticates integrations with API keys
+	// instead of user tokens.
+	provisioning := v1.Group("/provisioning", s.requireAPIKey())
+	provisioning.GET("/users", s.listProvisionedUsersHandler)
+	provisioning.POST("/users", s.createProvisionedUserHandler)
+	provisioning.GET("/users/:username", s.getProvisionedUserHandler)
+	provisioning.PATCH("/users/:username", s.updateProvisionedUserHandler)
+	provisioning.DELETE("/users/:username", s.deleteProvisionedUserHandler)
+	provisioning.POST("/bulk", s.bulkProvisionHandler)
+
+	// Routes below require a valid JWT, or a user API key within its scope,
+	// from a user who is not banned. In cookie auth mode the JWT may come in
+	// a cookie, with a CSRF token.
+	protected := v1.Group("/", s.cookieAuthMiddleware(), s.authenticateUserKey(), s.requireToken(), s.requireActive())
+	protected.GET("/users", s.usersHandler)
+	protected.GET("/commands", s.commandsHandler)
+	protected.GET("/users/:username/presence", s.presenceHandler)
+	protected.GET("/status", s.getStatusHandler)
+	protected.PUT("/status", s.updateStatusHandler)
+	protected.DELETE("/status", s.clearStatusHandler)
+	protected.POST("/users/:username/block", s.blockUserHandler)
+	protected.DELETE("/users/:username/block", s.unblockUserHandler)
+	protected.POST("/messages", s.limiter.Middleware(messageLimit, byUser), s.sendMessageHandler)
+	protected.POST("/messages/batch", s.requireBot(), s.limiter.Middleware(batchLimit, byUser), s.sendBatchHandler)
+	protected.GET("/messages", s.getMessagesHandler)
+	protected.GET("/messages/search", s.searchMessagesHandler)
+	protected.GET("/messages/top", s.topMessagesHandler)
+	protected.GET("/messages/archive", s.limiter.Middleware(archiveLimit, byUser), s.archivedMessagesHandler)
+	protected.GET("/mentions", s.mentionsHandler)
+	protected.GET("/messages/scheduled", s.scheduledMessagesHandler)
+	protected.DELETE("/messages/scheduled/:id", s.cancelScheduledHandler)
+	protected.POST("/messages/:id/vote", s.voteHandler)
+	protected.POST("/messages/:id/upvote", s.upvoteMessageHandler)
+	protected.POST("/messages/:id/downvote", s.downvoteMessageHandler)
+	protected.POST("/messages/:id/read", s.readMessageHandler)
+	protected.POST("/read-state/sync", s.syncReadStateHandler)
+	protected.DELETE("/messages/:id", s.deleteMessageHandler)
+	protected.GET("/messages/:id/thread", s.threadHandler)
+	protected.POST("/messages/attachments", s.limiter.Middleware(messageLimit, byUser), s.uploadAttachmentHandler)
+	protected.GET("/attachments/:id", s.downloadAttachmentHandler)
+	protected.GET("/attachments/:id/thumbnail", s.downloadThumbnailHandler)
+	protected.POST("/attachments/uploads", s.createUploadHandler)
+	protected.POST("/attachments/uploads/:id/send", s.sendUploadHandler)
+	protected.GET("/events", s.sseHandler)
+	protected.POST("/graphql", s.graphQLHandler)
+	protected.GET("/graphql", s.graphQLWSHandler)
+	protected.PUT("/account/password", s.changePasswordHandler)
+	protected.PUT("/account/username", s.changeUsernameHandler)
+	protected.DELETE("/account", s.deleteAccountHandler)
+	protected.GET("/account/export", s.exportAccountHandler)
+	protected.GET("/account/usage", s.usageHandler)
+	protected.POST("/account/api-keys", s.createUserAPIKeyHandler)
+	protected.GET("/account/api-keys", s.userAPIKeysHandler)
+	protected.DELETE("/account/api-keys/:id", s.revokeUserAPIKeyHandler)
+	protected.GET("/account/sessions", s.accountSessionsHandler)
+	protected.DELETE("/account/sessions/:id", s.revokeAccountSessionHandler)
+	protected.GET("/account/analytics", s.analyticsSettingHandler)
+	protected.PUT("/account/analytics", s.setAnalyticsSettingHandler)
+	protected.GET("/account/locale", s.localeHandler)
+	protected.PUT("/account/locale", s.setLocaleHandler)
+	protected.POST("/devices", s.registerDeviceHandler)
+	protected.DELETE("/devices/:id", s.unregisterDeviceHandler)
+	protected.GET("/notifications/preferences", s.getPreferencesHandler)
+	protected.PUT("/notifications/preferences", s.updatePreferencesHandler)
+	protected.GET("/notifications/mutes", s.mutesHandler)
+	protected.GET("/notifications/vapid-key", s.vapidKeyHandler)
+	protected.GET("/conversations/:username/filter", s.getFilterHandler)
+	protected.PUT("/conversations/:username/filter", s.updateFilterHandler)
+	protected.GET("/conversations/:username/disappearing", s.getDisappearingHandler)
+	protected.PUT("/conversations/:username/disappearing", s.updateDisappearingHandler)
+	protected.PUT("/conversations/:username/mute", s.muteHandler)
+	protected.DELETE("/conversations/:username/mute", s.unmuteHandler)
+	protected.GET("/conversations/:username/draft", s.getDraftHandler)
+	protected.PUT("/conversations/:username/draft", s.saveDraftHandler)
+	protected.DELETE("/conversations/:username/draft", s.deleteDraftHandler)
+	protected.GET("/conversations/:username/export", s.exportHandler)
+	protected.GET("/conversations/:username/pins", s.pinnedMessagesHandler)
+	protected.POST("/conversations/:username/pins/:id", s.pinMessageHandler)
+	protected.DELETE("/conversations/:username/pins/:id", s.unpinMessageHandler)
+	protected.GET("/channels", s.channelsHandler)
+	protected.GET("/channels/:id", s.channelHandler)
+	protected.PUT("/channels/:id/subscription", s.subscribeChannelHandler)
+	protected.DELETE("/channels/:id/subscription", s.unsubscribeChannelHandler)
+	protected.PATCH("/channels/:id", s.updateChannelHandler)
+	protected.GET("/channels/:id/members", s.channelMembersHandler)
+	protected.PUT("/channels/:id/members/:username/role", s.setChannelRoleHandler)
+	protected.DELETE("/channels/:id/members/:username", s.removeChannelMemberHandler)
+	protected.POST("/channels/:id/invites", s.createChannelInviteHandler)
+	protected.GET("/channels/:id/invites", s.channelInvitesHandler)
+	protected.DELETE("/channels/:id/invites/:invite", s.revokeChannelInviteHandler)
+	protected.POST("/invite/:token", s.acceptInviteHandler)
+	protected.GET("/channels/:id/posts", s.channelPostsHandler)
+	protected.POST("/channels/:id/posts", s.limiter.Middleware(messageLimit, byUser), s.postToChannelHandler)
+	protected.DELETE("/channels/:id/posts/:post", s.deleteChannelPostHandler)
+	protected.GET("/channels/:id/posts/:post/replies", s.channelRepliesHandler)
+	protected.POST("/channels/:id/posts/:post/replies", s.limiter.Middleware(messageLimit, byUser), s.replyToChannelPostHandler)
+	protected.GET("/channels/:id/threads", s.channelThreadsHandler)
+	protected.PUT("/channels/:id/threads/:post/read", s.markThreadReadHandler)
+	protected.PUT("/channels/:id/threads/:post/subscription", s.subscribeThreadHandler)
+	protected.DELETE("/channels/:id/threads/:post/subscription", s.unsubscribeThreadHandler)
+	protected.GET("/channels/:id/pins", s.pinnedChannelPostsHandler)
+	protected.PUT("/channels/:id/posts/:post/pin", s.pinChannelPostHandler)
+	protected.DELETE("/channels/:id/posts/:post/pin", s.unpinChannelPostHandler)
+
+	// Routes below are restricted to bots.
+	bot := protected.Group("/bot", s.requireBot())
+	bot.PUT("/commands/:name", s.registerCommandHandler)
+	bot.DELETE("/commands/:name", s.deleteCommandHandler)
+
+	// Routes below are restricted to admins.
+	admin := protected.Group("/admin", s.requireAdmin())
+	admin.GET("/users", s.adminUsersHandler)
+	admin.POST("/users/:username/ban", s.banUserHandler)
+	admin.DELETE("/users/:username/ban", s.unbanUserHandler)
+	admin.PUT("/users/:username/shadow-mute", s.shadowMuteUserHandler)
+	admin.DELETE("/users/:username/shadow-mute", s.unshadowMuteUserHandler)
+	admin.GET("/shadow-mutes", s.shadowMutesHandler)
+	admin.GET("/users/:username/lockout", s.accountLockoutHandler)
+	admin.DELETE("/users/:username/lockout", s.unlockAccountHandler)
+	admin.DELETE("/lockouts/ips/:ip", s.unlockIPHandler)
+	admin.POST("/api-keys", s.createAPIKeyHandler)
+	admin.GET("/api-keys", s.apiKeysHandler)
+	admin.DELETE("/api-keys/:id", s.revokeAPIKeyHandler)
+	admin.POST("/bots", s.createBotHandler)
+	admin.GET("/bots", s.botsHandler)
+	admin.POST("/bots/:username/token", s.rotateBotTokenHandler)
+	admin.DELETE("/bots/:username", s.deleteBotHandler)
+	admin.POST("/hooks", s.createIncomingHookHandler)
+	admin.GET("/hooks", s.incomingHooksHandler)
+	admin.DELETE("/hooks/:id", s.deleteIncomingHookHandler)
+	admin.POST("/channels", s.createChannelHandler)
+	admin.DELETE("/channels/:id", s.deleteChannelHandler)
+	admin.PUT("/channels/:id/senders/:username", s.addChannelSenderHandler)
+	admin.DELETE("/channels/:id/senders/:username", s.removeChannelSenderHandler)
+	admin.PUT("/channels/:id/shadow-mutes/:username", s.shadowMuteInChannelHandler)
+	admin.DELETE("/channels/:id/shadow-mutes/:username", s.unshadowMuteInChannelHandler)
+	admin.POST("/webhooks", s.createWebhookHandler)
+	admin.GET("/webhooks", s.webhooksHandler)
+	admin.DELETE("/webhooks/:id", s.deleteWebhookHandler)
+	admin.GET("/webhooks/:id/deliveries", s.webhookDeliveriesHandler)
+	admin.DELETE("/messages/:id", s.adminDeleteMessageHandler)
+	admin.GET("/stats", s.statsHandler)
+	admin.POST("/announcements", s.announcementHandler)
+	admin.GET("/flags", s.flagsHandler)
+	admin.GET("/audit", s.auditLogHandler)
+
+	r.NoRoute(func(c *gin.Context) {
+		c.Error(apperr.New(apperr.NotFound, "Route not found"))
+	})
+
+	spec = openAPISpec(r.Routes(), apiV1)
+	return legacyPaths(r)
+}
+
+// Start runs the goroutines that deliver messages and events published by
+// any instance to locally connected clients.
+func (s *Server) Start() {
+	go s.consumeStreams()
+	go s.subscribeMessages()
+}
+
+// ClientQueueDepth returns the number of events queued on the connections
+// of this instance.
+func (s *Server) ClientQueueDepth() int {
+	return s.hub.QueueDepth()
+}
+
+// SetMigrationsApplied marks the schema as up to date for /readyz.
+func (s *Server) SetMigrationsApplied() {
+	s.migrationsApplied.Store(true)
+}
+
+// CloseStreams disconnects every client so that event streams, which are
+// ordinary HTTP responses, end and let the HTTP server shut down. The users
+// who were connected are marked offline.
+func (s *Server) CloseStreams() {
+	s.shuttingDown.Store(true)
+	for _, username := range s.hub.CloseAll() {
+		s.setOffline(username)
+	}
+}
+
+// Drain stops accepting traffic and disconnects every WebSocket client with
+// a close frame.
+func (s *Server) Drain(ctx context.Context) error {
+	s.CloseStreams()
+	return s.hub.Wait(ctx)
+}
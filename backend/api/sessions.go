@@ -0,0 +1,131 @@
+package api
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+
+	"backend/apperr"
+	"backend/auth"
+	"backend/service"
+	"backend/store"
+
+	"github.com/gin-gonic/gin"
+)
+
+// maxDeviceLength is the longest User-Agent recorded as a session's device.
+const maxDeviceLength = 255
+
+// sessionClient returns the client of an HTTP request, for the sessions it
+// starts or refreshes.
+func sessionClient(c *gin.Context) store.SessionClient {
+	return newSessionClient(c.Request.UserAgent(), c.ClientIP())
+}
+
+// newSessionClient returns the client with userAgent at ip, cutting the
+// User-Agent down to maxDeviceLength characters.
+func newSessionClient(userAgent, ip string) store.SessionClient {
+	if runes := []rune(userAgent); len(runes) > maxDeviceLength {
+		userAgent = string(runes[:maxDeviceLength])
+	}
+	return store.SessionClient{Device: userAgent, IP: ip}
+}
+
+// sessionFailure maps an error from SessionService to the error reported to
+// the client.
+func sessionFailure(err error) *apperr.Error {
+	var locked *lockedOutError
+	switch {
+	case errors.As(err, &locked):
+		return apperr.Newf(apperr.LoginLocked, "Too many failed logins, try again in %d seconds", retrySeconds(locked.retryAfter))
+	case errors.Is(err, service.ErrInvalidCredentials):
+		return apperr.New(apperr.InvalidCredentials, "Invalid username or password")
+	case errors.Is(err, service.ErrBanned):
+		return apperr.New(apperr.Banned, "Account is banned")
+	case errors.Is(err, service.ErrEmailNotVerified):
+		return apperr.New(apperr.EmailNotVerified, "Verify your email address before logging in")
+	case errors.Is(err, store.ErrInvalidSession):
+		return apperr.New(apperr.Unauthenticated, "Invalid or expired refresh token")
+	}
+	log.Printf("Error managing session: %v", err)
+	return apperr.New(apperr.Internal, "Failed to create session")
+}
+
+// refreshTokenHandler exchanges a refresh token for a new access token.
+func (s *Server) refreshTokenHandler(c *gin.Context) {
+	refreshToken, e := s.refreshTokenFromRequest(c)
+	if e != nil {
+		c.Error(e)
+		return
+	}
+
+	tokens, err := s.sessions.Refresh(c.Request.Context(), refreshToken, sessionClient(c))
+	if err != nil {
+		c.Error(sessionFailure(err))
+		return
+	}
+
+	body, err := s.tokenResponse(c, tokens)
+	if err != nil {
+		c.Error(sessionFailure(err))
+		return
+	}
+	c.JSON(http.StatusOK, body)
+}
+
+// logoutHandler revokes the session behind the given refresh token.
+func (s *Server) logoutHandler(c *gin.Context) {
+	refreshToken, e := s.refreshTokenFromRequest(c)
+	if e != nil {
+		c.Error(e)
+		return
+	}
+
+	if err := s.sessions.Logout(c.Request.Context(), refreshToken); err != nil {
+		c.Error(apperr.New(apperr.Internal, "Failed to log out"))
+		return
+	}
+	s.clearSessionCookies(c)
+
+	c.JSON(http.StatusOK, gin.H{"message": s.tr(c, "Logged out successfully")})
+}
+
+// accountSessionsHandler lists the devices the authenticated user is logged
+// in on.
+func (s *Server) accountSessionsHandler(c *gin.Context) {
+	sessions, err := s.store.Sessions(c.Request.Context(), auth.CurrentUser(c))
+	if err != nil {
+		c.Error(apperr.New(apperr.Internal, "Failed to fetch sessions"))
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"sessions": sessions})
+}
+
+// revokeAccountSessionHandler logs the authenticated user out of one of
+// their sessions. Its refresh token stops working at once; access tokens
+// already issued to it last until they expire.
+func (s *Server) revokeAccountSessionHandler(c *gin.Context) {
+	ctx := c.Request.Context()
+	username := auth.CurrentUser(c)
+
+	id := c.Param("id")
+	if _, err := strconv.Atoi(id); err != nil {
+		c.Error(apperr.New(apperr.NotFound, "Session not found"))
+		return
+	}
+
+	err := s.store.RevokeUserSession(ctx, username, id)
+	if errors.Is(err, store.ErrNotFound) {
+		c.Error(apperr.New(apperr.NotFound, "Session not found"))
+		return
+	}
+	if err != nil {
+		c.Error(apperr.New(apperr.Internal, "Failed to revoke session"))
+		return
+	}
+	s.audit(ctx, store.AuditEntry{Action: auditSessionRevoked, Target: username, Details: map[string]string{"session_id": id}})
+
+	c.JSON(http.StatusOK, gin.H{"message": s.tr(c, "Session revoked successfully")})
+}
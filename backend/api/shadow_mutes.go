@@ -0,0 +1,116 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+
+	"backend/apperr"
+	"backend/auth"
+	"backend/store"
+
+	"github.com/gin-gonic/gin"
+)
+
+// shadowMutesHandler lists every shadow mute, by username, global mutes
+// first.
+func (s *Server) shadowMutesHandler(c *gin.Context) {
+	mutes, err := s.store.ShadowMutes(c.Request.Context())
+	if err != nil {
+		c.Error(apperr.New(apperr.Internal, "Failed to fetch shadow mutes"))
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"shadow_mutes": mutes})
+}
+
+// shadowMuteUserHandler shadow-mutes the user in the path everywhere: their
+// direct messages and channel posts are accepted and shown to them, but
+// nobody else sees them.
+func (s *Server) shadowMuteUserHandler(c *gin.Context) {
+	s.shadowMute(c, "")
+}
+
+// unshadowMuteUserHandler lifts the global shadow mute of the user in the
+// path. What they sent while muted stays hidden.
+func (s *Server) unshadowMuteUserHandler(c *gin.Context) {
+	s.shadowUnmute(c, "")
+}
+
+// shadowMuteInChannelHandler shadow-mutes the user in the path in one
+// channel.
+func (s *Server) shadowMuteInChannelHandler(c *gin.Context) {
+	if id, ok := channelID(c); ok {
+		s.shadowMute(c, id)
+	}
+}
+
+// unshadowMuteInChannelHandler lifts the shadow mute of the user in the
+// path in one channel.
+func (s *Server) unshadowMuteInChannelHandler(c *gin.Context) {
+	if id, ok := channelID(c); ok {
+		s.shadowUnmute(c, id)
+	}
+}
+
+// shadowMute shadow-mutes the user in the path in a channel, or globally if
+// channelID is empty. Muting a user again keeps a single mute.
+func (s *Server) shadowMute(c *gin.Context, channelID string) {
+	ctx := c.Request.Context()
+	target := c.Param("username")
+
+	if target == auth.CurrentUser(c) {
+		c.Error(apperr.New(apperr.InvalidRequest, "You cannot shadow-mute yourself"))
+		return
+	}
+	exists, err := s.store.UserExists(ctx, target)
+	if err != nil {
+		c.Error(apperr.New(apperr.Internal, "Failed to fetch user"))
+		return
+	}
+	if !exists {
+		c.Error(apperr.New(apperr.UserNotFound, "User not found"))
+		return
+	}
+
+	mute := store.ShadowMute{Username: target, ChannelID: channelID, MutedBy: auth.CurrentUser(c)}
+	err = s.store.ShadowMute(ctx, mute)
+	if errors.Is(err, store.ErrNotFound) {
+		c.Error(apperr.New(apperr.NotFound, "Channel not found"))
+		return
+	}
+	if err != nil {
+		c.Error(apperr.New(apperr.Internal, "Failed to shadow-mute user"))
+		return
+	}
+	s.audit(ctx, store.AuditEntry{Action: auditUserShadowMuted, Target: target, Details: shadowMuteDetails(channelID)})
+
+	c.JSON(http.StatusOK, gin.H{"message": s.tr(c, "User shadow-muted successfully")})
+}
+
+// shadowUnmute lifts the shadow mute of the user in the path in a channel,
+// or their global one if channelID is empty.
+func (s *Server) shadowUnmute(c *gin.Context, channelID string) {
+	ctx := c.Request.Context()
+	target := c.Param("username")
+
+	removed, err := s.store.ShadowUnmute(ctx, target, channelID)
+	if err != nil {
+		c.Error(apperr.New(apperr.Internal, "Failed to lift shadow mute"))
+		return
+	}
+	if !removed {
+		c.Error(apperr.New(apperr.NotFound, "User is not shadow-muted"))
+		return
+	}
+	s.audit(ctx, store.AuditEntry{Action: auditUserShadowUnmuted, Target: target, Details: shadowMuteDetails(channelID)})
+
+	c.JSON(http.StatusOK, gin.H{"message": s.tr(c, "Shadow mute lifted successfully")})
+}
+
+// shadowMuteDetails returns the audit details of a shadow mute in a
+// channel, nil for a global one.
+func shadowMuteDetails(channelID string) map[string]string {
+	if channelID == "" {
+		return nil
+	}
+	return map[string]string{"channel": channelID}
+}
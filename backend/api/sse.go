@@ -0,0 +1,153 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"backend/apperr"
+	"backend/auth"
+	"backend/store"
+	"backend/ws"
+
+	"github.com/gin-gonic/gin"
+)
+
+// sseKeepAlive is how often an idle event stream gets a comment, so proxies
+// do not close it.
+const sseKeepAlive = 30 * time.Second
+
+// sseHandler streams the events a WebSocket would receive as Server-Sent
+// Events, for networks that block WebSockets. New messages carry their ID as
+// the event ID; a client reconnecting with Last-Event-ID first receives every
+// message sent or received since.
+func (s *Server) sseHandler(c *gin.Context) {
+	lastEventID := c.GetHeader("Last-Event-ID")
+	if lastEventID == "" {
+		lastEventID = c.Query("last_event_id")
+	}
+	afterID := -1
+	if lastEventID != "" {
+		var err error
+		if afterID, err = strconv.Atoi(lastEventID); err != nil || afterID < 0 {
+			c.Error(apperr.New(apperr.InvalidRequest, "Invalid Last-Event-ID"))
+			return
+		}
+	}
+
+	header := c.Writer.Header()
+	header.Set("Content-Type", "text/event-stream")
+	header.Set("Cache-Control", "no-cache")
+	header.Set("Connection", "keep-alive")
+	// Stops nginx from buffering the stream.
+	header.Set("X-Accel-Buffering", "no")
+	c.Status(http.StatusOK)
+	c.Writer.Flush()
+
+	client := ws.NewStreamClient(auth.CurrentUser(c))
+	s.registerClient(client)
+	s.hub.Track(func() { s.serveEvents(c.Request.Context(), c.Writer, client, afterID) })
+}
+
+// serveEvents writes a client's events to w until either side closes the
+// stream. Unless afterID is negative, the messages after it are replayed
+// first.
+func (s *Server) serveEvents(ctx context.Context, w gin.ResponseWriter, client *ws.Client, afterID int) {
+	username := client.UserID
+
+	s.setOnline(username)
+	done := make(chan struct{})
+	go s.runPresenceHeartbeat(username, done)
+	defer func() {
+		close(done)
+		// Only go offline once the user's last connection has closed. The
+		// client may already be gone if it was disconnected by the hub.
+		s.unregisterClient(client)
+		if !s.hub.Connected(username) {
+			s.setOffline(username)
+		}
+	}()
+
+	if afterID >= 0 && !s.replayMessages(ctx, w, username, afterID) {
+		return
+	}
+	go s.flushPending(ctx, client)
+
+	keepAlive := time.NewTicker(sseKeepAlive)
+	defer keepAlive.Stop()
+
+	for {
+		select {
+		case event, ok := <-client.Events():
+			if !ok {
+				return
+			}
+			id := ""
+			if msg, ok := event.Payload.(store.Message); ok && isNewMessage(msg) {
+				id = msg.ID
+			}
+			if err := writeSSE(w, id, event); err != nil {
+				return
+			}
+			s.markEventDelivered(ctx, username, event)
+		case <-keepAlive.C:
+			if _, err := io.WriteString(w, ": keep-alive\n\n"); err != nil {
+				return
+			}
+			w.Flush()
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// replayMessages writes every message username sent or received after
+// afterID, reporting false if the stream broke.
+func (s *Server) replayMessages(ctx context.Context, w gin.ResponseWriter, username string, afterID int) bool {
+	for {
+		messages, err := s.store.MessagesAfter(ctx, username, afterID, pendingBatchSize)
+		if err != nil {
+			log.Printf("Error fetching messages of %s after %d: %v", username, afterID, err)
+			return true
+		}
+
+		for _, msg := range messages {
+			event := ws.Event{Type: ws.TypeMessage, Payload: msg}
+			if err := writeSSE(w, msg.ID, event); err != nil {
+				return false
+			}
+			s.markEventDelivered(ctx, username, event)
+		}
+
+		if len(messages) < pendingBatchSize {
+			return true
+		}
+		afterID, _ = strconv.Atoi(messages[len(messages)-1].ID)
+	}
+}
+
+// writeSSE writes an event named after its type with its JSON payload as
+// data, and id as the event ID unless it is empty.
+func writeSSE(w gin.ResponseWriter, id string, event ws.Event) error {
+	data, err := json.Marshal(event.Payload)
+	if err != nil {
+		log.Printf("Error encoding %s event: %v", event.Type, err)
+		return nil
+	}
+
+	if id != "" {
+		if _, err := fmt.Fprintf(w, "id: %s\n", id); err != nil {
+			return err
+		}
+	}
+	if _, err := fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event.Type, data); err != nil {
+		return err
+	}
+	w.Flush()
+	return nil
+}
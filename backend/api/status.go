@@ -0,0 +1,100 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+
+	"backend/apperr"
+	"backend/auth"
+	"backend/store"
+	"backend/ws"
+
+	"github.com/gin-gonic/gin"
+)
+
+// markDelivered records that the receiver's client has received a message.
+func (s *Server) markDelivered(ctx context.Context, messageID, receiver string) error {
+	changed, err := s.store.MarkDelivered(ctx, messageID, receiver)
+	if err != nil {
+		return err
+	}
+
+	if changed {
+		s.broadcastMessageByID(ctx, messageID)
+	}
+	return nil
+}
+
+// markEventDelivered marks the messages to receiver carried by an event
+// delivered. WebSocket clients mark them when they acknowledge the event.
+// Streams such as gRPC and Server-Sent Events deliver reliably while they
+// last, so they mark them as soon as the event is written.
+func (s *Server) markEventDelivered(ctx context.Context, receiver string, event ws.Event) {
+	var messages []store.Message
+	switch payload := event.Payload.(type) {
+	case store.Message:
+		messages = []store.Message{payload}
+	case PendingEvent:
+		messages = payload.Messages
+	}
+	for _, msg := range messages {
+		if msg.ID == "" || msg.Receiver != receiver {
+			continue
+		}
+		if err := s.markDelivered(ctx, msg.ID, receiver); err != nil {
+			log.Printf("Error marking message %s delivered: %v", msg.ID, err)
+		}
+	}
+}
+
+// handleAck takes a version 2 client's acknowledgement of the event written
+// with the given seq, marking the messages it carried delivered.
+func (s *Server) handleAck(ctx context.Context, client *ws.Client, env ws.Envelope) {
+	var ack struct {
+		Seq uint64 `json:"seq"`
+	}
+	if err := json.Unmarshal(env.Payload, &ack); err != nil || ack.Seq == 0 {
+		s.sendError(client, env.Seq, apperr.New(apperr.InvalidRequest, "Invalid ack"))
+		return
+	}
+
+	if event, ok := client.Ack(ack.Seq); ok {
+		s.markEventDelivered(ctx, client.UserID, event)
+	}
+}
+
+// broadcastMessageByID pushes the current state of a message to its
+// participants and the message cache.
+func (s *Server) broadcastMessageByID(ctx context.Context, messageID string) {
+	msg, err := s.store.Message(ctx, messageID)
+	if err != nil {
+		log.Printf("Error fetching message %s for broadcast: %v", messageID, err)
+		return
+	}
+	s.cache.Update(ctx, msg)
+	s.broadcastMessage(ctx, msg)
+}
+
+// readMessageHandler marks a message, and everything before it in the
+// conversation, as read by the authenticated receiver.
+func (s *Server) readMessageHandler(c *gin.Context) {
+	ctx := c.Request.Context()
+	if _, _, ok := s.authorizeMessage(c, c.Param("id")); !ok {
+		return
+	}
+
+	err := s.markRead(ctx, c.Param("id"), auth.CurrentUser(c))
+	if errors.Is(err, store.ErrNotFound) {
+		c.Error(apperr.New(apperr.MessageNotFound, "Message not found"))
+		return
+	}
+	if err != nil {
+		c.Error(apperr.New(apperr.Internal, "Failed to update message status"))
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": s.tr(c, "Message marked as read")})
+}
@@ -0,0 +1,132 @@
+package api
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"backend/i18n"
+	"backend/store"
+
+	"github.com/gin-gonic/gin"
+	"golang.org/x/text/language"
+)
+
+// postSystemMessage adds a system message reporting event, caused by
+// sender, to their conversation with receiver and delivers it to both.
+// System messages are not filtered and trigger no notifications, webhooks
+// or stream events. Failures are logged; they never fail the action that
+// caused the event.
+func (s *Server) postSystemMessage(ctx context.Context, sender, receiver string, event store.SystemEvent) {
+	msg := store.Message{
+		Sender:   sender,
+		Receiver: receiver,
+		Kind:     store.KindSystem,
+		System:   &event,
+		Content:  systemContent(language.English, sender, event),
+	}
+	if err := s.store.CreateMessage(ctx, &msg); err != nil {
+		log.Printf("Error posting %s system message of %s: %v", event.Event, sender, err)
+		return
+	}
+
+	s.cache.Append(ctx, msg)
+	s.broadcastMessage(ctx, msg)
+}
+
+// postChannelSystemPost adds a system post reporting event, caused by
+// sender, to a channel and delivers it to its subscribers. Like system
+// messages it is not filtered, and failures are only logged.
+func (s *Server) postChannelSystemPost(ctx context.Context, channelID, sender string, event store.SystemEvent) {
+	post := store.ChannelPost{
+		ChannelID: channelID,
+		Sender:    sender,
+		Kind:      store.KindSystem,
+		System:    &event,
+		Content:   systemContent(language.English, sender, event),
+	}
+	if err := s.store.CreateChannelPost(ctx, &post); err != nil {
+		log.Printf("Error posting %s system post of %s to channel %s: %v", event.Event, sender, channelID, err)
+		return
+	}
+	s.publishChannelPost(post)
+}
+
+// systemContent describes a system event in words, in lang. System messages
+// are stored in English.
+func systemContent(lang language.Tag, sender string, event store.SystemEvent) string {
+	switch event.Event {
+	case store.SystemUsernameChanged:
+		return i18n.Sprintf(lang, "%s is now known as %s", event.OldUsername, sender)
+	case store.SystemMessagePinned:
+		return i18n.Sprintf(lang, "%s pinned a message", sender)
+	case store.SystemMemberJoined:
+		return i18n.Sprintf(lang, "%s joined with an invite", sender)
+	case store.SystemDisappearingChanged:
+		if event.TTLSeconds == nil || *event.TTLSeconds == 0 {
+			return i18n.Sprintf(lang, "%s turned off disappearing messages", sender)
+		}
+		return i18n.Sprintf(lang, "%s set disappearing messages to %s", sender, formatTTL(lang, time.Duration(*event.TTLSeconds)*time.Second))
+	}
+	return ""
+}
+
+// localizeSystemMessages rewrites the content of the system messages among
+// messages in the language c is answered in.
+func (s *Server) localizeSystemMessages(c *gin.Context, messages []store.Message) {
+	var lang language.Tag
+	for i, m := range messages {
+		if m.Kind != store.KindSystem || m.System == nil || m.Deleted {
+			continue
+		}
+		if lang == language.Und {
+			if lang = s.locale(c); lang == language.English {
+				return
+			}
+		}
+		messages[i].Content = systemContent(lang, m.Sender, *m.System)
+	}
+}
+
+// localizeSystemPosts rewrites the content of the system posts among posts
+// in the language c is answered in.
+func (s *Server) localizeSystemPosts(c *gin.Context, posts []store.ChannelPost) {
+	var lang language.Tag
+	for i, p := range posts {
+		if p.Kind != store.KindSystem || p.System == nil {
+			continue
+		}
+		if lang == language.Und {
+			if lang = s.locale(c); lang == language.English {
+				return
+			}
+		}
+		posts[i].Content = systemContent(lang, p.Sender, *p.System)
+	}
+}
+
+// formatTTL renders a duration in lang in the largest unit that divides it,
+// such as "1 day" or "90 minutes".
+func formatTTL(lang language.Tag, d time.Duration) string {
+	units := []struct {
+		name string
+		size time.Duration
+	}{
+		{"week", 7 * 24 * time.Hour},
+		{"day", 24 * time.Hour},
+		{"hour", time.Hour},
+		{"minute", time.Minute},
+		{"second", time.Second},
+	}
+	for _, u := range units {
+		if d%u.size != 0 {
+			continue
+		}
+		n := int(d / u.size)
+		if n == 1 {
+			return i18n.Translate(lang, "1 "+u.name)
+		}
+		return i18n.Sprintf(lang, "%d "+u.name+"s", n)
+	}
+	return d.String()
+}
@@ -0,0 +1,163 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"backend/apperr"
+	"backend/auth"
+	"backend/store"
+
+	"github.com/gin-gonic/gin"
+)
+
+// userKeyPrefix starts every user API key, so they are never mistaken for
+// access tokens.
+const userKeyPrefix = "uk_"
+
+// maxUserAPIKeys caps the API keys a user may hold at once.
+const maxUserAPIKeys = 20
+
+// contextKeyScopeKey is the Gin context key holding the scope of the user
+// API key a request was authenticated with, if it was.
+const contextKeyScopeKey = "key_scope"
+
+// userKeySendRoutes are the routes a send-only key may call.
+var userKeySendRoutes = map[string]bool{
+	"POST /messages":             true,
+	"POST /messages/attachments": true,
+}
+
+// userKeyAllows reports whether a key with scope may call route, a method
+// and path relative to the API prefix. Keys never reach admin routes or
+// manage keys themselves.
+func userKeyAllows(scope, method, path string) bool {
+	if strings.HasPrefix(path, "/admin") || strings.HasPrefix(path, "/account/api-keys") {
+		return false
+	}
+	switch scope {
+	case store.ScopeRead:
+		return method == http.MethodGet || method == http.MethodHead
+	case store.ScopeSend:
+		return userKeySendRoutes[method+" "+path]
+	}
+	return false
+}
+
+// authenticateUserKey authenticates requests carrying a user API key in the
+// Authorization header as the key's user, within its scope. Other requests
+// are left to requireToken.
+func (s *Server) authenticateUserKey() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		key, ok := strings.CutPrefix(c.GetHeader("Authorization"), "Bearer ")
+		if !ok || !strings.HasPrefix(key, userKeyPrefix) {
+			c.Next()
+			return
+		}
+
+		userKey, err := s.store.UseUserAPIKey(c.Request.Context(), auth.HashToken(key))
+		if errors.Is(err, store.ErrNotFound) {
+			apperr.Abort(c, apperr.New(apperr.Unauthenticated, "Invalid or revoked API key"))
+			return
+		}
+		if err != nil {
+			apperr.Abort(c, apperr.New(apperr.Internal, "Failed to check API key"))
+			return
+		}
+		if !userKeyAllows(userKey.Scope, c.Request.Method, strings.TrimPrefix(c.FullPath(), apiV1)) {
+			apperr.Abort(c, apperr.Newf(apperr.InsufficientScope, "API keys with scope %s cannot call this route", userKey.Scope))
+			return
+		}
+
+		auth.SetCurrentUser(c, userKey.Username)
+		setAuditActor(c.Request.Context(), userKey.Username)
+		c.Set(contextKeyScopeKey, userKey.Scope)
+		c.Next()
+	}
+}
+
+// UserAPIKeyCreated is the response to creating a user API key, the only
+// time the key itself is shown.
+type UserAPIKeyCreated struct {
+	APIKey store.UserAPIKey `json:"api_key"`
+	Key    string           `json:"key"`
+}
+
+// createUserAPIKeyHandler creates an API key acting as the authenticated
+// user, with a read or send scope.
+func (s *Server) createUserAPIKeyHandler(c *gin.Context) {
+	ctx := c.Request.Context()
+	username := auth.CurrentUser(c)
+	var req struct {
+		Name  string `json:"name"`
+		Scope string `json:"scope"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil || req.Name == "" || len(req.Name) > 100 {
+		c.Error(apperr.New(apperr.InvalidRequest, "Invalid name, expected 1 to 100 characters"))
+		return
+	}
+	if req.Scope != store.ScopeRead && req.Scope != store.ScopeSend {
+		c.Error(apperr.New(apperr.InvalidRequest, "Invalid scope, expected read or send"))
+		return
+	}
+
+	keys, err := s.store.UserAPIKeys(ctx, username)
+	if err != nil {
+		c.Error(apperr.New(apperr.Internal, "Failed to create API key"))
+		return
+	}
+	if len(keys) >= maxUserAPIKeys {
+		c.Error(apperr.Newf(apperr.InvalidRequest, "At most %d API keys may exist at once, revoke one first", maxUserAPIKeys))
+		return
+	}
+
+	secret, err := auth.NewOpaqueToken()
+	if err != nil {
+		c.Error(apperr.New(apperr.Internal, "Failed to generate API key"))
+		return
+	}
+	key := userKeyPrefix + secret
+
+	userKey := store.UserAPIKey{Username: username, Name: req.Name, Scope: req.Scope}
+	if err := s.store.CreateUserAPIKey(ctx, &userKey, auth.HashToken(key)); err != nil {
+		c.Error(apperr.New(apperr.Internal, "Failed to create API key"))
+		return
+	}
+
+	c.JSON(http.StatusCreated, UserAPIKeyCreated{APIKey: userKey, Key: key})
+}
+
+// userAPIKeysHandler lists the authenticated user's API keys that were not
+// revoked.
+func (s *Server) userAPIKeysHandler(c *gin.Context) {
+	keys, err := s.store.UserAPIKeys(c.Request.Context(), auth.CurrentUser(c))
+	if err != nil {
+		c.Error(apperr.New(apperr.Internal, "Failed to fetch API keys"))
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"api_keys": keys})
+}
+
+// revokeUserAPIKeyHandler revokes one of the authenticated user's API keys.
+func (s *Server) revokeUserAPIKeyHandler(c *gin.Context) {
+	id := c.Param("id")
+	if _, err := strconv.Atoi(id); err != nil {
+		c.Error(apperr.New(apperr.NotFound, "API key not found"))
+		return
+	}
+
+	err := s.store.RevokeUserAPIKey(c.Request.Context(), auth.CurrentUser(c), id)
+	if errors.Is(err, store.ErrNotFound) {
+		c.Error(apperr.New(apperr.NotFound, "API key not found"))
+		return
+	}
+	if err != nil {
+		c.Error(apperr.New(apperr.Internal, "Failed to revoke API key"))
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": s.tr(c, "API key revoked successfully")})
+}
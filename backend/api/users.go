@@ -0,0 +1,149 @@
+package api
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"net/mail"
+	"strconv"
+
+	"backend/apperr"
+	"backend/auth"
+	"backend/service"
+	"backend/store"
+	"backend/usernames"
+
+	"github.com/gin-gonic/gin"
+)
+
+// signupHandler handles user signup requests.
+func (s *Server) signupHandler(c *gin.Context) {
+	var user struct {
+		Username string `json:"username"`
+		Password string `json:"password"`
+		Email    string `json:"email"`
+	}
+
+	if err := c.ShouldBindJSON(&user); err != nil {
+		c.Error(apperr.New(apperr.InvalidRequest, err.Error()))
+		return
+	}
+
+	if user.Username == "" || user.Password == "" {
+		c.Error(apperr.New(apperr.InvalidRequest, "Invalid username or password"))
+		return
+	}
+
+	if e := s.checkUsername(user.Username); e != nil {
+		c.Error(e)
+		return
+	}
+	if e := s.checkUsernameReleased(c.Request.Context(), user.Username, ""); e != nil {
+		c.Error(e)
+		return
+	}
+
+	if err := auth.ValidatePassword(user.Password); err != nil {
+		c.Error(apperr.New(apperr.InvalidPassword, err.Error()))
+		return
+	}
+
+	// The email is only used for password resets, and optional unless it
+	// must be verified to log in.
+	if user.Email == "" && s.verifyEmail {
+		c.Error(apperr.New(apperr.InvalidEmail, "Email address is required"))
+		return
+	}
+	if user.Email != "" {
+		if _, err := mail.ParseAddress(user.Email); err != nil {
+			c.Error(apperr.New(apperr.InvalidEmail, "Invalid email address"))
+			return
+		}
+	}
+
+	hashedPassword, err := s.passwords.Hash(user.Password)
+	if err != nil {
+		c.Error(apperr.New(apperr.Internal, "Failed to hash password"))
+		return
+	}
+
+	err = s.store.CreateUser(c.Request.Context(), user.Username, hashedPassword, user.Email)
+	if errors.Is(err, store.ErrUsernameTaken) {
+		c.Error(apperr.New(apperr.UsernameTaken, "Username already taken"))
+		return
+	}
+	if errors.Is(err, store.ErrEmailTaken) {
+		c.Error(apperr.New(apperr.EmailTaken, "Email already registered"))
+		return
+	}
+	if err != nil {
+		c.Error(apperr.New(apperr.Internal, "Failed to insert user"))
+		return
+	}
+
+	s.webhooks.Emit(c.Request.Context(), service.EventUserSignedUp, service.SignedUp{Username: user.Username})
+
+	if user.Email != "" {
+		if err := s.sendVerificationEmail(c.Request.Context(), user.Username, user.Email); err != nil {
+			log.Printf("Error sending verification email to %s: %v", user.Username, err)
+		}
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": s.tr(c, "User signed up successfully")})
+}
+
+// checkUsername returns an INVALID_USERNAME error if username breaks the
+// username policy.
+func (s *Server) checkUsername(username string) *apperr.Error {
+	err := s.usernames.Check(username)
+	var length *usernames.LengthError
+	if errors.As(err, &length) {
+		return apperr.Newf(apperr.InvalidUsername, "Username must be between %d and %d characters", length.Min, length.Max)
+	}
+	if err != nil {
+		return apperr.New(apperr.InvalidUsername, err.Error())
+	}
+	return nil
+}
+
+// loginHandler handles user login requests.
+func (s *Server) loginHandler(c *gin.Context) {
+	var user struct {
+		Username string `json:"username"`
+		Password string `json:"password"`
+	}
+
+	if err := c.ShouldBindJSON(&user); err != nil {
+		c.Error(apperr.New(apperr.InvalidRequest, "Invalid request payload"))
+		return
+	}
+
+	tokens, err := s.login(c.Request.Context(), user.Username, user.Password, sessionClient(c))
+	if err != nil {
+		var locked *lockedOutError
+		if errors.As(err, &locked) {
+			c.Header("Retry-After", strconv.Itoa(retrySeconds(locked.retryAfter)))
+		}
+		c.Error(sessionFailure(err))
+		return
+	}
+
+	body, err := s.tokenResponse(c, tokens)
+	if err != nil {
+		c.Error(sessionFailure(err))
+		return
+	}
+	body["message"] = s.tr(c, "Login successful")
+	c.JSON(http.StatusOK, body)
+}
+
+// usersHandler handles fetching all users.
+func (s *Server) usersHandler(c *gin.Context) {
+	users, err := s.store.ListUsers(c.Request.Context(), auth.CurrentUser(c))
+	if err != nil {
+		c.Error(apperr.New(apperr.Internal, "Failed to fetch users"))
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"users": users})
+}
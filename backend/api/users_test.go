@@ -0,0 +1,120 @@
+package api_test
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestSignupAndLogin(t *testing.T) {
+	ts := newTestServer(t)
+	token := ts.signup("alice")
+	if token == "" {
+		t.Fatal("login returned no token")
+	}
+
+	res := ts.request("POST", "/signup", "", map[string]string{"username": "alice", "password": "password1"})
+	expectError(t, res, http.StatusConflict, "USERNAME_TAKEN")
+}
+
+func TestSignupRejectsUsernameVariants(t *testing.T) {
+	ts := newTestServer(t)
+	ts.signup("alice")
+
+	for _, name := range []string{"Alice", "ALICE", "ａｌｉｃｅ"} {
+		t.Run(name, func(t *testing.T) {
+			res := ts.request("POST", "/signup", "", map[string]string{"username": name, "password": "password1"})
+			expectError(t, res, http.StatusConflict, "USERNAME_TAKEN")
+		})
+	}
+}
+
+func TestSignupRejectsInvalidUsername(t *testing.T) {
+	ts := newTestServer(t)
+	res := ts.request("POST", "/signup", "", map[string]string{"username": "al", "password": "password1"})
+	expectError(t, res, http.StatusBadRequest, "INVALID_USERNAME")
+	if res.Body["error"] != "Username must be between 3 and 50 characters" {
+		t.Errorf("error = %v", res.Body["error"])
+	}
+}
+
+func TestLoginWrongPassword(t *testing.T) {
+	ts := newTestServer(t)
+	ts.signup("alice")
+
+	res := ts.request("POST", "/login", "", map[string]string{"username": "alice", "password": "wrong"})
+	expectError(t, res, http.StatusUnauthorized, "INVALID_CREDENTIALS")
+}
+
+func TestLoginLockout(t *testing.T) {
+	ts := newTestServer(t)
+	ts.signup("alice")
+
+	for i := 0; i < 5; i++ {
+		ts.request("POST", "/login", "", map[string]string{"username": "alice", "password": "wrong"})
+	}
+	res := ts.request("POST", "/login", "", map[string]string{"username": "alice", "password": "password1"})
+	expectError(t, res, http.StatusTooManyRequests, "LOGIN_LOCKED")
+	if res.Header.Get("Retry-After") == "" {
+		t.Error("missing Retry-After")
+	}
+}
+
+func TestProtectedRouteNeedsToken(t *testing.T) {
+	ts := newTestServer(t)
+	expectError(t, ts.request("GET", "/users", "", nil), http.StatusUnauthorized, "UNAUTHENTICATED")
+}
+
+func TestErrorsAreLocalized(t *testing.T) {
+	ts := newTestServer(t)
+	ts.signup("alice")
+
+	res := ts.request("POST", "/login", "", map[string]string{"username": "alice", "password": "wrong"}, "Accept-Language", "es-MX,es;q=0.9")
+	if res.Body["error"] != "Nombre de usuario o contraseña incorrectos" {
+		t.Errorf("error = %v", res.Body["error"])
+	}
+	if got := res.Header.Get("Content-Language"); got != "es" {
+		t.Errorf("Content-Language = %q", got)
+	}
+}
+
+func TestChosenLocaleOverridesAcceptLanguage(t *testing.T) {
+	ts := newTestServer(t)
+	token := ts.signup("alice")
+
+	res := ts.request("PUT", "/account/locale", token, map[string]string{"locale": "fr-CA"})
+	if res.Code != http.StatusOK || res.Body["locale"] != "fr" {
+		t.Fatalf("got %d %v", res.Code, res.Body)
+	}
+	res = ts.request("GET", "/messages", token, nil, "Accept-Language", "es")
+	if res.Body["error"] != "Destinataire manquant" {
+		t.Errorf("error = %v", res.Body["error"])
+	}
+
+	res = ts.request("PUT", "/account/locale", token, map[string]string{"locale": "de"})
+	expectError(t, res, http.StatusBadRequest, "INVALID_REQUEST")
+}
+
+func TestSyncReadStateErrorsAreLocalized(t *testing.T) {
+	ts := newTestServer(t)
+	token := ts.signup("alice")
+	ts.signup("bob")
+
+	res := ts.request("POST", "/read-state/sync", token, []map[string]string{
+		{"conversation": "bob"},
+		{"conversation": "bob", "last_read_id": "999"},
+	}, "Accept-Language", "fr")
+	if res.Code != http.StatusOK {
+		t.Fatalf("got %d %v", res.Code, res.Body)
+	}
+	results := res.Body["results"].([]interface{})
+	want := []string{"conversation ou last_read_id manquant", "Message introuvable dans cette conversation"}
+	if len(results) != len(want) {
+		t.Fatalf("results = %v", results)
+	}
+	for i, r := range results {
+		e := r.(map[string]interface{})["error"].(map[string]interface{})
+		if e["error"] != want[i] {
+			t.Errorf("result %d error = %v, want %q", i, e["error"], want[i])
+		}
+	}
+}
@@ -0,0 +1,44 @@
+package api
+
+import (
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// apiV1 is the path prefix of version 1 of the API. Breaking changes ship
+// under a new prefix, leaving existing clients on the version they use.
+const apiV1 = "/api/v1"
+
+// unversionedPaths are served outside the versioned API.
+var unversionedPaths = map[string]bool{
+	"/metrics": true,
+	"/healthz": true,
+	"/readyz":  true,
+}
+
+// legacyPaths serves the unversioned paths the API had before versioning as
+// version 1, so frontends built against them keep working. Their responses
+// carry a Deprecation header and a Link to the versioned path.
+func legacyPaths(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasPrefix(r.URL.Path, "/api/") || unversionedPaths[r.URL.Path] {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		versioned := apiV1 + r.URL.Path
+		w.Header().Set("Deprecation", "true")
+		w.Header().Set("Link", "<"+versioned+`>; rel="successor-version"`)
+
+		r2 := new(http.Request)
+		*r2 = *r
+		r2.URL = new(url.URL)
+		*r2.URL = *r.URL
+		r2.URL.Path = versioned
+		if r.URL.RawPath != "" {
+			r2.URL.RawPath = apiV1 + r.URL.RawPath
+		}
+		next.ServeHTTP(w, r2)
+	})
+}
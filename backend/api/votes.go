@@ -0,0 +1,201 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"backend/apperr"
+	"backend/auth"
+	"backend/events"
+	"backend/service"
+	"backend/store"
+	"backend/ws"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Page sizes of GET /messages/top.
+const (
+	defaultTopLimit = 10
+	maxTopLimit     = 100
+	topPageSize     = 100
+)
+
+// idempotencyKeyHeader carries a client chosen key that makes retrying a
+// vote safe.
+const idempotencyKeyHeader = "Idempotency-Key"
+
+// voteHandler sets the authenticated user's vote on a message to the
+// direction in the body: up, down or none.
+func (s *Server) voteHandler(c *gin.Context) {
+	var req struct {
+		Direction string `json:"direction"`
+	}
+	if err := c.BindJSON(&req); err != nil {
+		c.Error(apperr.New(apperr.InvalidRequest, "Invalid request payload"))
+		return
+	}
+
+	t, err := s.votes.Vote(c.Request.Context(), voteRequest(c), req.Direction)
+	if err != nil {
+		c.Error(voteFailure(err))
+		return
+	}
+
+	c.JSON(http.StatusOK, t)
+}
+
+// upvoteMessageHandler toggles the authenticated user's upvote on a message.
+func (s *Server) upvoteMessageHandler(c *gin.Context) {
+	s.toggleVote(c, store.Upvote)
+}
+
+// downvoteMessageHandler toggles the authenticated user's downvote on a message.
+func (s *Server) downvoteMessageHandler(c *gin.Context) {
+	s.toggleVote(c, store.Downvote)
+}
+
+// toggleVote toggles the authenticated user's vote of voteType on a message
+// and returns the new totals.
+func (s *Server) toggleVote(c *gin.Context, voteType string) {
+	t, err := s.votes.Toggle(c.Request.Context(), voteRequest(c), voteType)
+	if err != nil {
+		c.Error(voteFailure(err))
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": s.tr(c, "Vote toggled successfully"), "upvotes": t.Upvotes, "downvotes": t.Downvotes})
+}
+
+// voteRequest describes the vote requested by c.
+func voteRequest(c *gin.Context) service.VoteRequest {
+	return service.VoteRequest{
+		MessageID:      c.Param("id"),
+		Username:       auth.CurrentUser(c),
+		IdempotencyKey: c.GetHeader(idempotencyKeyHeader),
+	}
+}
+
+// voteFailure maps an error from VoteService to the error reported to the
+// voter.
+func voteFailure(err error) *apperr.Error {
+	switch {
+	case errors.Is(err, store.ErrNotFound):
+		return apperr.New(apperr.MessageNotFound, "Message not found")
+	case errors.Is(err, service.ErrNotParticipant):
+		return apperr.New(apperr.NotParticipant, "You are not a participant of this conversation")
+	case errors.Is(err, service.ErrInvalidDirection):
+		return apperr.New(apperr.InvalidVote, "Direction must be up, down or none")
+	case errors.Is(err, service.ErrRequestInProgress):
+		return apperr.New(apperr.RequestInProgress, "A request with this idempotency key is in progress")
+	case errors.Is(err, service.ErrIdempotencyKeyReused):
+		return apperr.New(apperr.IdempotencyKeyReused, "Idempotency key was used for a different request")
+	}
+	log.Printf("Error applying vote: %v", err)
+	return apperr.New(apperr.Internal, "Failed to apply vote")
+}
+
+// afterVote caches the new totals of a message and broadcasts them to its
+// participants. cast is the vote type the voter newly cast, if any.
+func (s *Server) afterVote(ctx context.Context, voter string, t service.Tally, cast string) {
+	// Cache both totals in one command so readers never see a mix of old
+	// and new counts.
+	if err := s.rdb.HSet(ctx, fmt.Sprintf("message:%s", t.MessageID), "upvotes", t.Upvotes, "downvotes", t.Downvotes).Err(); err != nil {
+		log.Printf("Error caching vote counts of message %s: %v", t.MessageID, err)
+	}
+
+	updatedMessage, err := s.store.Message(ctx, t.MessageID)
+	if err != nil {
+		log.Printf("Error fetching message %s for broadcast: %v", t.MessageID, err)
+		return
+	}
+	s.cache.Update(ctx, updatedMessage)
+	s.top.Record(ctx, updatedMessage.Sender, updatedMessage.Receiver, t.MessageID, t.Upvotes-t.Downvotes)
+	s.broadcastMessage(ctx, updatedMessage)
+	s.publishEvent(ws.Event{
+		Type:    ws.TypeReaction,
+		Payload: ReactionEvent{MessageID: t.MessageID, Upvotes: t.Upvotes, Downvotes: t.Downvotes},
+	}, updatedMessage.Sender, updatedMessage.Receiver)
+	s.events.Emit(events.VoteCast, events.ConversationKey(updatedMessage.Sender, updatedMessage.Receiver),
+		events.Vote{MessageID: t.MessageID, Voter: voter, Upvotes: t.Upvotes, Downvotes: t.Downvotes})
+	if cast != "" {
+		s.trackReactionAdded(voter, cast)
+	}
+}
+
+// topMessagesHandler lists the highest scoring messages, upvotes minus
+// downvotes, of the authenticated user's conversation with ?room=<username>.
+// ?since=<RFC3339> only considers messages sent after that time.
+func (s *Server) topMessagesHandler(c *gin.Context) {
+	ctx := c.Request.Context()
+	viewer := auth.CurrentUser(c)
+
+	room := c.Query("room")
+	if room == "" {
+		c.Error(apperr.New(apperr.InvalidRequest, "Missing room"))
+		return
+	}
+
+	var since time.Time
+	if v := c.Query("since"); v != "" {
+		var err error
+		if since, err = time.Parse(time.RFC3339, v); err != nil {
+			c.Error(apperr.New(apperr.InvalidRequest, "Invalid since, expected an RFC3339 timestamp"))
+			return
+		}
+	}
+
+	limit := defaultTopLimit
+	if v := c.Query("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 || n > maxTopLimit {
+			c.Error(apperr.Newf(apperr.InvalidRequest, "Limit must be between 1 and %d", maxTopLimit))
+			return
+		}
+		limit = n
+	}
+
+	// Walk the ranking until enough messages inside the window are found.
+	top := []store.Message{}
+	for offset := 0; len(top) < limit; offset += topPageSize {
+		ids, err := s.top.Page(ctx, viewer, room, offset, topPageSize)
+		if err != nil {
+			c.Error(apperr.New(apperr.Internal, "Failed to fetch top messages"))
+			return
+		}
+		if len(ids) == 0 {
+			break
+		}
+
+		messages, err := s.store.MessagesByID(ctx, viewer, ids)
+		if err != nil {
+			c.Error(apperr.New(apperr.Internal, "Failed to fetch top messages"))
+			return
+		}
+		byID := make(map[string]store.Message, len(messages))
+		for _, msg := range messages {
+			byID[msg.ID] = msg
+		}
+
+		for _, id := range ids {
+			msg, ok := byID[id]
+			if !ok || msg.Deleted || msg.CreatedAt.Before(since) {
+				continue
+			}
+			top = append(top, msg)
+			if len(top) == limit {
+				break
+			}
+		}
+		if len(ids) < topPageSize {
+			break
+		}
+	}
+
+	c.JSON(http.StatusOK, gin.H{"messages": top})
+}
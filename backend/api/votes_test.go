@@ -0,0 +1,40 @@
+package api_test
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestVotes(t *testing.T) {
+	ts := newTestServer(t)
+	alice := ts.signup("alice")
+	bob := ts.signup("bob")
+
+	res := ts.request("POST", "/messages", alice, map[string]string{"receiver": "bob", "content": "hi"})
+	id := res.Body["message"].(map[string]interface{})["id"].(string)
+
+	tally := func(res response) (float64, float64) {
+		t.Helper()
+		if res.Code != http.StatusOK {
+			t.Fatalf("vote: %d %v", res.Code, res.Body)
+		}
+		return res.Body["upvotes"].(float64), res.Body["downvotes"].(float64)
+	}
+
+	if up, down := tally(ts.request("POST", "/messages/"+id+"/vote", bob, map[string]string{"direction": "up"})); up != 1 || down != 0 {
+		t.Errorf("after up: %v up, %v down", up, down)
+	}
+	if up, down := tally(ts.request("POST", "/messages/"+id+"/vote", bob, map[string]string{"direction": "down"})); up != 0 || down != 1 {
+		t.Errorf("after down: %v up, %v down", up, down)
+	}
+	if up, down := tally(ts.request("POST", "/messages/"+id+"/vote", bob, map[string]string{"direction": "none"})); up != 0 || down != 0 {
+		t.Errorf("after none: %v up, %v down", up, down)
+	}
+
+	res = ts.request("POST", "/messages/"+id+"/vote", bob, map[string]string{"direction": "sideways"})
+	expectError(t, res, http.StatusBadRequest, "INVALID_VOTE")
+
+	carol := ts.signup("carol")
+	res = ts.request("POST", "/messages/"+id+"/vote", carol, map[string]string{"direction": "up"})
+	expectError(t, res, http.StatusForbidden, "NOT_PARTICIPANT")
+}
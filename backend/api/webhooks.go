@@ -0,0 +1,167 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+
+	"backend/apperr"
+	"backend/auth"
+	"backend/service"
+	"backend/store"
+
+	"github.com/gin-gonic/gin"
+)
+
+// defaultDeliveriesLimit is how many deliveries the delivery log returns
+// unless asked for another number.
+const defaultDeliveriesLimit = 100
+
+// minWebhookSecret is the shortest secret a webhook may be given.
+const minWebhookSecret = 16
+
+// WebhookCreated is the response to creating a webhook, the only time its
+// secret is shown.
+type WebhookCreated struct {
+	Webhook store.Webhook `json:"webhook"`
+	Secret  string        `json:"secret"`
+}
+
+// RunWebhooks delivers webhook events, retrying failed deliveries, until ctx
+// is done.
+func (s *Server) RunWebhooks(ctx context.Context) {
+	s.webhooks.Run(ctx)
+}
+
+// createWebhookHandler registers a webhook. Without a secret one is
+// generated. A webhook given a bot only receives the events addressed to
+// that bot.
+func (s *Server) createWebhookHandler(c *gin.Context) {
+	var req struct {
+		URL    string   `json:"url"`
+		Secret string   `json:"secret"`
+		Events []string `json:"events"`
+		Bot    string   `json:"bot"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.Error(apperr.New(apperr.InvalidRequest, "Invalid request payload"))
+		return
+	}
+
+	u, err := url.Parse(req.URL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		c.Error(apperr.New(apperr.InvalidRequest, "Invalid url, expected an http or https URL"))
+		return
+	}
+	if len(req.Events) == 0 {
+		c.Error(apperr.New(apperr.InvalidRequest, "Missing events"))
+		return
+	}
+	for _, event := range req.Events {
+		if !slices.Contains(service.WebhookEvents, event) {
+			c.Error(apperr.Newf(apperr.InvalidRequest, "Unknown event %q, expected one of %s", event, strings.Join(service.WebhookEvents, ", ")))
+			return
+		}
+	}
+
+	secret := req.Secret
+	if secret == "" {
+		if secret, err = auth.NewOpaqueToken(); err != nil {
+			c.Error(apperr.New(apperr.Internal, "Failed to generate secret"))
+			return
+		}
+	} else if len(secret) < minWebhookSecret {
+		c.Error(apperr.Newf(apperr.InvalidRequest, "Secret must be at least %d characters", minWebhookSecret))
+		return
+	}
+
+	if req.Bot != "" {
+		role, _, err := s.store.Role(c.Request.Context(), req.Bot)
+		if errors.Is(err, store.ErrNotFound) || (err == nil && role != store.RoleBot) {
+			c.Error(apperr.Newf(apperr.InvalidRequest, "Unknown bot %s", req.Bot))
+			return
+		}
+		if err != nil {
+			c.Error(apperr.New(apperr.Internal, "Failed to fetch bot"))
+			return
+		}
+	}
+
+	w := store.Webhook{URL: req.URL, Events: req.Events, Bot: req.Bot, Secret: secret, CreatedBy: auth.CurrentUser(c)}
+	if err := s.store.CreateWebhook(c.Request.Context(), &w); err != nil {
+		c.Error(apperr.New(apperr.Internal, "Failed to create webhook"))
+		return
+	}
+	s.audit(c.Request.Context(), store.AuditEntry{Action: auditWebhookCreated, Target: w.ID, Details: map[string]string{"url": w.URL}})
+
+	c.JSON(http.StatusCreated, WebhookCreated{Webhook: w, Secret: secret})
+}
+
+// webhooksHandler lists the registered webhooks.
+func (s *Server) webhooksHandler(c *gin.Context) {
+	webhooks, err := s.store.Webhooks(c.Request.Context())
+	if err != nil {
+		c.Error(apperr.New(apperr.Internal, "Failed to fetch webhooks"))
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"webhooks": webhooks})
+}
+
+// deleteWebhookHandler deletes a webhook along with its pending deliveries
+// and delivery log.
+func (s *Server) deleteWebhookHandler(c *gin.Context) {
+	id := c.Param("id")
+	if _, err := strconv.Atoi(id); err != nil {
+		c.Error(apperr.New(apperr.NotFound, "Webhook not found"))
+		return
+	}
+
+	err := s.store.DeleteWebhook(c.Request.Context(), id)
+	if errors.Is(err, store.ErrNotFound) {
+		c.Error(apperr.New(apperr.NotFound, "Webhook not found"))
+		return
+	}
+	if err != nil {
+		c.Error(apperr.New(apperr.Internal, "Failed to delete webhook"))
+		return
+	}
+	s.audit(c.Request.Context(), store.AuditEntry{Action: auditWebhookDeleted, Target: id})
+
+	c.JSON(http.StatusOK, gin.H{"message": s.tr(c, "Webhook deleted successfully")})
+}
+
+// webhookDeliveriesHandler returns a webhook's delivery log, newest first.
+func (s *Server) webhookDeliveriesHandler(c *gin.Context) {
+	id := c.Param("id")
+	if _, err := strconv.Atoi(id); err != nil {
+		c.Error(apperr.New(apperr.NotFound, "Webhook not found"))
+		return
+	}
+
+	limit := defaultDeliveriesLimit
+	if v := c.Query("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 {
+			c.Error(apperr.New(apperr.InvalidRequest, "Invalid limit"))
+			return
+		}
+		limit = n
+	}
+
+	deliveries, err := s.store.WebhookDeliveries(c.Request.Context(), id, limit)
+	if errors.Is(err, store.ErrNotFound) {
+		c.Error(apperr.New(apperr.NotFound, "Webhook not found"))
+		return
+	}
+	if err != nil {
+		c.Error(apperr.New(apperr.Internal, "Failed to fetch deliveries"))
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"deliveries": deliveries})
+}
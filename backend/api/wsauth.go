@@ -0,0 +1,101 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"backend/apperr"
+	"backend/auth"
+	"backend/ws"
+
+	"github.com/gorilla/websocket"
+)
+
+// wsAuthTimeout is how long a WebSocket opened without a token has to send
+// its auth frame.
+const wsAuthTimeout = 10 * time.Second
+
+// authFrame is what a client authenticates with: the whole frame
+// {"type": "auth", "token": "..."} for version 1 clients, the payload of an
+// auth envelope for version 2 clients. Version 2 clients may also resume an
+// earlier session, see startSession.
+type authFrame struct {
+	Token       string `json:"token"`
+	ResumeToken string `json:"resume_token,omitempty"`
+	LastSeq     uint64 `json:"last_seq,omitempty"`
+}
+
+// authenticateSocket returns the claims of a newly upgraded client's token,
+// taken from the upgrade request or, if it had none, from the client's first
+// frame, which then also overrides the resume fields of the request.
+func (s *Server) authenticateSocket(ctx context.Context, client *ws.Client, frame *authFrame) (*auth.Claims, *apperr.Error) {
+	if frame.Token == "" {
+		client.Conn.SetReadDeadline(time.Now().Add(wsAuthTimeout))
+		env, err := client.ReadEnvelope()
+		if err != nil || env.Type != ws.TypeAuth {
+			return nil, apperr.New(apperr.Unauthenticated, "Missing authentication token")
+		}
+		if err := json.Unmarshal(env.Payload, frame); err != nil || frame.Token == "" {
+			return nil, apperr.New(apperr.Unauthenticated, "Missing authentication token")
+		}
+	}
+	return s.checkSocketToken(ctx, frame.Token)
+}
+
+// checkSocketToken validates the access or bot token of a WebSocket client
+// and checks that its user may still connect.
+func (s *Server) checkSocketToken(ctx context.Context, token string) (*auth.Claims, *apperr.Error) {
+	claims, e := s.parseToken(ctx, token)
+	if e != nil {
+		return nil, e
+	}
+	if _, err := s.checkActive(ctx, claims.Username); err != nil {
+		var e *apperr.Error
+		if !errors.As(err, &e) {
+			e = apperr.New(apperr.Internal, "Internal server error")
+		}
+		return nil, e
+	}
+	return claims, nil
+}
+
+// handleReauth takes a fresh token from a connected client, pushing back
+// when its connection expires. A token that is invalid or belongs to someone
+// else closes the connection.
+func (s *Server) handleReauth(ctx context.Context, client *ws.Client, env ws.Envelope, expiry *time.Timer) {
+	var frame authFrame
+	if err := json.Unmarshal(env.Payload, &frame); err != nil || frame.Token == "" {
+		s.sendError(client, env.Seq, apperr.New(apperr.InvalidRequest, "Invalid auth frame"))
+		return
+	}
+
+	claims, e := s.checkSocketToken(ctx, frame.Token)
+	if e == nil && claims.Username != client.UserID {
+		e = apperr.New(apperr.Unauthenticated, "Token belongs to another user")
+	}
+	if e != nil {
+		closeSocket(client.Conn, websocket.ClosePolicyViolation, e.Message)
+		return
+	}
+	expiry.Reset(time.Until(tokenExpiry(claims)))
+}
+
+// tokenExpiry returns when a token expires. Tokens without an expiry, such
+// as bot tokens, are treated as expiring after auth.TokenTTL, so a rotated
+// bot token is noticed at the latest when the bot next authenticates.
+func tokenExpiry(claims *auth.Claims) time.Time {
+	if claims.ExpiresAt == nil {
+		return time.Now().Add(auth.TokenTTL)
+	}
+	return claims.ExpiresAt.Time
+}
+
+// closeSocket closes a WebSocket with a close code and reason. It is safe to
+// call while other goroutines use the connection.
+func closeSocket(conn *websocket.Conn, code int, reason string) {
+	msg := websocket.FormatCloseMessage(code, reason)
+	conn.WriteControl(websocket.CloseMessage, msg, time.Now().Add(time.Second))
+	conn.Close()
+}
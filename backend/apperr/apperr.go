@@ -0,0 +1,204 @@
+// Package apperr defines the errors the API reports to clients. Each carries
+// a machine-readable code, which also determines its HTTP status, so clients
+// can tell errors apart without parsing messages.
+package apperr
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+
+	"backend/i18n"
+
+	"github.com/gin-gonic/gin"
+	"golang.org/x/text/language"
+)
+
+// Code identifies the kind of an error.
+type Code string
+
+// Error codes. Clients rely on them, so existing codes must not change.
+const (
+	InvalidRequest       Code = "INVALID_REQUEST"
+	InvalidPassword      Code = "INVALID_PASSWORD"
+	InvalidUsername      Code = "INVALID_USERNAME"
+	InvalidEmail         Code = "INVALID_EMAIL"
+	InvalidVote          Code = "INVALID_VOTE"
+	InvalidReplyTo       Code = "INVALID_REPLY_TO"
+	InvalidResetToken    Code = "INVALID_RESET_TOKEN"
+	InvalidVerifyToken   Code = "INVALID_VERIFICATION_TOKEN"
+	SendAtInPast         Code = "SEND_AT_IN_PAST"
+	Unauthenticated      Code = "UNAUTHENTICATED"
+	InvalidCredentials   Code = "INVALID_CREDENTIALS"
+	Banned               Code = "BANNED"
+	EmailNotVerified     Code = "EMAIL_NOT_VERIFIED"
+	AdminRequired        Code = "ADMIN_REQUIRED"
+	InsufficientScope    Code = "INSUFFICIENT_SCOPE"
+	AccessDenied         Code = "ACCESS_DENIED"
+	CSRFFailed           Code = "CSRF_FAILED"
+	BotRequired          Code = "BOT_REQUIRED"
+	Blocked              Code = "BLOCKED"
+	NotParticipant       Code = "NOT_PARTICIPANT"
+	NotSender            Code = "NOT_SENDER"
+	NotChannelSender     Code = "NOT_CHANNEL_SENDER"
+	ChannelRoleRequired  Code = "CHANNEL_ROLE_REQUIRED"
+	NotFound             Code = "NOT_FOUND"
+	UserNotFound         Code = "USER_NOT_FOUND"
+	MessageNotFound      Code = "MESSAGE_NOT_FOUND"
+	UsernameTaken        Code = "USERNAME_TAKEN"
+	EmailTaken           Code = "EMAIL_TAKEN"
+	CommandTaken         Code = "COMMAND_TAKEN"
+	ChannelTaken         Code = "CHANNEL_TAKEN"
+	LastChannelOwner     Code = "LAST_CHANNEL_OWNER"
+	PinLimit             Code = "PIN_LIMIT"
+	InviteExpired        Code = "INVITE_EXPIRED"
+	RequestInProgress    Code = "REQUEST_IN_PROGRESS"
+	IdempotencyKeyReused Code = "IDEMPOTENCY_KEY_REUSED"
+	ContentRejected      Code = "CONTENT_REJECTED"
+	TooLarge             Code = "TOO_LARGE"
+	StorageQuota         Code = "STORAGE_QUOTA_EXCEEDED"
+	UnsupportedMediaType Code = "UNSUPPORTED_MEDIA_TYPE"
+	RateLimited          Code = "RATE_LIMITED"
+	LoginLocked          Code = "LOGIN_LOCKED"
+	MessageQuota         Code = "MESSAGE_QUOTA_EXCEEDED"
+	Internal             Code = "INTERNAL"
+)
+
+// statuses maps each code to the HTTP status it is reported with.
+var statuses = map[Code]int{
+	InvalidRequest:       http.StatusBadRequest,
+	InvalidPassword:      http.StatusBadRequest,
+	InvalidUsername:      http.StatusBadRequest,
+	InvalidEmail:         http.StatusBadRequest,
+	InvalidVote:          http.StatusBadRequest,
+	InvalidReplyTo:       http.StatusBadRequest,
+	InvalidResetToken:    http.StatusBadRequest,
+	InvalidVerifyToken:   http.StatusBadRequest,
+	SendAtInPast:         http.StatusBadRequest,
+	Unauthenticated:      http.StatusUnauthorized,
+	InvalidCredentials:   http.StatusUnauthorized,
+	Banned:               http.StatusForbidden,
+	EmailNotVerified:     http.StatusForbidden,
+	AdminRequired:        http.StatusForbidden,
+	InsufficientScope:    http.StatusForbidden,
+	AccessDenied:         http.StatusForbidden,
+	CSRFFailed:           http.StatusForbidden,
+	BotRequired:          http.StatusForbidden,
+	Blocked:              http.StatusForbidden,
+	NotParticipant:       http.StatusForbidden,
+	NotSender:            http.StatusForbidden,
+	NotChannelSender:     http.StatusForbidden,
+	ChannelRoleRequired:  http.StatusForbidden,
+	NotFound:             http.StatusNotFound,
+	UserNotFound:         http.StatusNotFound,
+	MessageNotFound:      http.StatusNotFound,
+	UsernameTaken:        http.StatusConflict,
+	EmailTaken:           http.StatusConflict,
+	CommandTaken:         http.StatusConflict,
+	ChannelTaken:         http.StatusConflict,
+	LastChannelOwner:     http.StatusConflict,
+	PinLimit:             http.StatusConflict,
+	RequestInProgress:    http.StatusConflict,
+	InviteExpired:        http.StatusGone,
+	IdempotencyKeyReused: http.StatusUnprocessableEntity,
+	ContentRejected:      http.StatusUnprocessableEntity,
+	TooLarge:             http.StatusRequestEntityTooLarge,
+	StorageQuota:         http.StatusRequestEntityTooLarge,
+	UnsupportedMediaType: http.StatusUnsupportedMediaType,
+	RateLimited:          http.StatusTooManyRequests,
+	LoginLocked:          http.StatusTooManyRequests,
+	MessageQuota:         http.StatusTooManyRequests,
+	Internal:             http.StatusInternalServerError,
+}
+
+// Status returns the HTTP status errors with code c are reported with.
+func (c Code) Status() int {
+	if status, ok := statuses[c]; ok {
+		return status
+	}
+	return http.StatusInternalServerError
+}
+
+// Error is an error reported to the client.
+type Error struct {
+	Code Code
+	// Message is the message in English, which the client may be sent in
+	// its language instead.
+	Message string
+	// Reasons details why content was rejected.
+	Reasons []string
+
+	// format and args built Message with Newf, so it can be translated.
+	format string
+	args   []interface{}
+}
+
+// New returns an error with code and a message for the client.
+func New(code Code, message string) *Error {
+	return &Error{Code: code, Message: message}
+}
+
+// Newf returns an error with code and a message for the client formatted
+// from format and args, as fmt.Sprintf does.
+func Newf(code Code, format string, args ...interface{}) *Error {
+	return &Error{Code: code, Message: fmt.Sprintf(format, args...), format: format, args: args}
+}
+
+// Localize returns the message of e in lang.
+func (e *Error) Localize(lang language.Tag) string {
+	if e.args == nil {
+		return i18n.Translate(lang, e.Message)
+	}
+	return i18n.Sprintf(lang, e.format, e.args...)
+}
+
+func (e *Error) Error() string {
+	return string(e.Code) + ": " + e.Message
+}
+
+// Response is the body of every error response.
+type Response struct {
+	Error   string   `json:"error"`
+	Code    Code     `json:"code"`
+	Reasons []string `json:"reasons,omitempty"`
+}
+
+// Response returns the body reporting e.
+func (e *Error) Response() Response {
+	return Response{Error: e.Message, Code: e.Code, Reasons: e.Reasons}
+}
+
+// LocalizedResponse returns the body reporting e, in lang.
+func (e *Error) LocalizedResponse(lang language.Tag) Response {
+	return Response{Error: e.Localize(lang), Code: e.Code, Reasons: e.Reasons}
+}
+
+// Abort stops the handler chain of c and reports err. Middleware uses it;
+// handlers add errors with c.Error and return.
+func Abort(c *gin.Context, err error) {
+	_ = c.Error(err)
+	c.Abort()
+}
+
+// Middleware reports the last error a handler added to the context, unless a
+// response was written already, in the language locale returns for the
+// request. Errors other than *Error are logged and reported as internal
+// errors, so their details never reach clients.
+func Middleware(locale func(c *gin.Context) language.Tag) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Next()
+
+		if len(c.Errors) == 0 || c.Writer.Written() {
+			return
+		}
+
+		err := c.Errors.Last().Err
+		var e *Error
+		if !errors.As(err, &e) {
+			log.Printf("Error handling %s %s: %v", c.Request.Method, c.FullPath(), err)
+			e = New(Internal, "Internal server error")
+		}
+		c.JSON(e.Code.Status(), e.LocalizedResponse(locale(c)))
+	}
+}
@@ -0,0 +1,147 @@
+// Package auth issues and verifies the access tokens, refresh tokens and
+// password hashes used to authenticate users.
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"backend/apperr"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v4"
+)
+
+// TokenTTL is how long an issued access token stays valid. Clients renew it
+// through /token/refresh.
+const TokenTTL = 15 * time.Minute
+
+// RefreshTokenTTL is how long a refresh token (and its session) stays valid.
+const RefreshTokenTTL = 30 * 24 * time.Hour
+
+// contextUserKey is the Gin context key holding the authenticated username.
+const contextUserKey = "username"
+
+// Claims are the JWT claims issued to a logged in user.
+type Claims struct {
+	Username string `json:"username"`
+	jwt.RegisteredClaims
+}
+
+// Tokens issues and verifies access tokens signed with a shared secret.
+type Tokens struct {
+	secret []byte
+}
+
+// NewTokens returns a Tokens signing with secret.
+func NewTokens(secret string) *Tokens {
+	return &Tokens{secret: []byte(secret)}
+}
+
+// Generate issues a signed JWT for the given username.
+func (t *Tokens) Generate(username string) (string, error) {
+	now := time.Now()
+	claims := Claims{
+		Username: username,
+		RegisteredClaims: jwt.RegisteredClaims{
+			Subject:   username,
+			IssuedAt:  jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(now.Add(TokenTTL)),
+		},
+	}
+
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+	return token.SignedString(t.secret)
+}
+
+// Parse validates a signed JWT and returns its claims.
+func (t *Tokens) Parse(tokenString string) (*Claims, error) {
+	claims := &Claims{}
+	token, err := jwt.ParseWithClaims(tokenString, claims, func(tok *jwt.Token) (interface{}, error) {
+		if _, ok := tok.Method.(*jwt.SigningMethodHMAC); !ok {
+			return nil, fmt.Errorf("unexpected signing method: %v", tok.Header["alg"])
+		}
+		return t.secret, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if !token.Valid || claims.Username == "" {
+		return nil, errors.New("invalid token")
+	}
+
+	return claims, nil
+}
+
+// TokenFromRequest extracts the bearer token from the Authorization header.
+// Browsers cannot set headers on WebSocket upgrades, so the token query
+// parameter is accepted as a fallback.
+func TokenFromRequest(c *gin.Context) string {
+	header := c.GetHeader("Authorization")
+	if strings.HasPrefix(header, "Bearer ") {
+		return strings.TrimPrefix(header, "Bearer ")
+	}
+	return c.Query("token")
+}
+
+// Middleware rejects requests without a valid JWT and stores the
+// authenticated username in the Gin context.
+func (t *Tokens) Middleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		tokenString := TokenFromRequest(c)
+		if tokenString == "" {
+			apperr.Abort(c, apperr.New(apperr.Unauthenticated, "Missing authentication token"))
+			return
+		}
+
+		claims, err := t.Parse(tokenString)
+		if err != nil {
+			apperr.Abort(c, apperr.New(apperr.Unauthenticated, "Invalid or expired token"))
+			return
+		}
+
+		c.Set(contextUserKey, claims.Username)
+		c.Next()
+	}
+}
+
+// CurrentUser returns the authenticated username set by Middleware.
+func CurrentUser(c *gin.Context) string {
+	return c.GetString(contextUserKey)
+}
+
+// SetCurrentUser stores the authenticated username in the Gin context, for
+// middleware that authenticates requests without a JWT.
+func SetCurrentUser(c *gin.Context, username string) {
+	c.Set(contextUserKey, username)
+}
+
+// HashToken returns the hex encoded SHA-256 of an opaque token. Only the
+// hash is stored so a leaked table or Redis dump cannot be replayed.
+func HashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// NewOpaqueToken generates a random token such as a refresh token or a
+// password reset token.
+func NewOpaqueToken() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// ValidatePassword checks the password length policy.
+func ValidatePassword(password string) error {
+	if len(password) < 8 || len(password) > 20 {
+		return errors.New("Password must be between 8 to 20 characters.")
+	}
+	return nil
+}
@@ -0,0 +1,131 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+
+	"backend/store"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// Argon2id salt and key lengths in bytes.
+const (
+	argon2SaltLength = 16
+	argon2KeyLength  = 32
+)
+
+// Argon2Params are the cost parameters of Argon2id.
+type Argon2Params struct {
+	// Memory is in KiB.
+	Memory      uint32
+	Iterations  uint32
+	Parallelism uint8
+}
+
+// DefaultArgon2Params are the parameters OWASP recommends: 19 MiB of memory,
+// 2 iterations and 1 degree of parallelism.
+var DefaultArgon2Params = Argon2Params{Memory: 19 * 1024, Iterations: 2, Parallelism: 1}
+
+// Hasher hashes new passwords with one algorithm and checks passwords
+// against hashes of any supported algorithm, so hashes can be upgraded as
+// users log in.
+type Hasher struct {
+	algo   string
+	argon2 Argon2Params
+}
+
+// NewHasher returns a Hasher hashing with algo, store.PasswordArgon2id with
+// params or store.PasswordBcrypt.
+func NewHasher(algo string, params Argon2Params) (*Hasher, error) {
+	switch algo {
+	case store.PasswordBcrypt:
+	case store.PasswordArgon2id:
+		if params.Memory < 8*uint32(params.Parallelism) || params.Iterations < 1 || params.Parallelism < 1 {
+			return nil, fmt.Errorf("invalid Argon2id parameters m=%d t=%d p=%d", params.Memory, params.Iterations, params.Parallelism)
+		}
+	default:
+		return nil, fmt.Errorf("unknown password algorithm %q", algo)
+	}
+	return &Hasher{algo: algo, argon2: params}, nil
+}
+
+// DefaultHasher returns a Hasher hashing with Argon2id and
+// DefaultArgon2Params.
+func DefaultHasher() *Hasher {
+	return &Hasher{algo: store.PasswordArgon2id, argon2: DefaultArgon2Params}
+}
+
+// Hash hashes a password for storage.
+func (h *Hasher) Hash(password string) (store.Password, error) {
+	if h.algo == store.PasswordBcrypt {
+		hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+		return store.Password{Algo: store.PasswordBcrypt, Hash: string(hash)}, err
+	}
+
+	salt := make([]byte, argon2SaltLength)
+	if _, err := rand.Read(salt); err != nil {
+		return store.Password{}, err
+	}
+	p := h.argon2
+	key := argon2.IDKey([]byte(password), salt, p.Iterations, p.Memory, p.Parallelism, argon2KeyLength)
+	hash := fmt.Sprintf("$argon2id$v=%d$m=%d,t=%d,p=%d$%s$%s", argon2.Version, p.Memory, p.Iterations, p.Parallelism,
+		base64.RawStdEncoding.EncodeToString(salt), base64.RawStdEncoding.EncodeToString(key))
+	return store.Password{Algo: store.PasswordArgon2id, Hash: hash}, nil
+}
+
+// Check reports whether password matches stored, and whether stored should
+// be replaced by a new hash because it was made with another algorithm or
+// other parameters than h uses.
+func (h *Hasher) Check(stored store.Password, password string) (ok, rehash bool) {
+	switch stored.Algo {
+	case store.PasswordBcrypt:
+		if bcrypt.CompareHashAndPassword([]byte(stored.Hash), []byte(password)) != nil {
+			return false, false
+		}
+		cost, err := bcrypt.Cost([]byte(stored.Hash))
+		return true, h.algo != store.PasswordBcrypt || err != nil || cost != bcrypt.DefaultCost
+	case store.PasswordArgon2id:
+		params, salt, key, err := decodeArgon2id(stored.Hash)
+		if err != nil {
+			return false, false
+		}
+		got := argon2.IDKey([]byte(password), salt, params.Iterations, params.Memory, params.Parallelism, uint32(len(key)))
+		if subtle.ConstantTimeCompare(got, key) != 1 {
+			return false, false
+		}
+		return true, h.algo != store.PasswordArgon2id || params != h.argon2
+	}
+	return false, false
+}
+
+// decodeArgon2id parses an Argon2id hash in the PHC string format Hash
+// writes.
+func decodeArgon2id(hash string) (Argon2Params, []byte, []byte, error) {
+	parts := strings.Split(hash, "$")
+	if len(parts) != 6 || parts[1] != "argon2id" {
+		return Argon2Params{}, nil, nil, errors.New("malformed Argon2id hash")
+	}
+	var version int
+	if _, err := fmt.Sscanf(parts[2], "v=%d", &version); err != nil || version != argon2.Version {
+		return Argon2Params{}, nil, nil, errors.New("unsupported Argon2 version")
+	}
+	var p Argon2Params
+	if _, err := fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &p.Memory, &p.Iterations, &p.Parallelism); err != nil {
+		return Argon2Params{}, nil, nil, err
+	}
+	salt, err := base64.RawStdEncoding.DecodeString(parts[4])
+	if err != nil {
+		return Argon2Params{}, nil, nil, err
+	}
+	key, err := base64.RawStdEncoding.DecodeString(parts[5])
+	if err != nil || len(key) == 0 {
+		return Argon2Params{}, nil, nil, errors.New("malformed Argon2id key")
+	}
+	return p, salt, key, nil
+}
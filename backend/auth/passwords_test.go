@@ -0,0 +1,96 @@
+package auth
+
+import (
+	"testing"
+
+	"backend/store"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// testParams keep Argon2id cheap enough for tests.
+var testParams = Argon2Params{Memory: 64, Iterations: 1, Parallelism: 1}
+
+func TestHashCheckRoundTrip(t *testing.T) {
+	for _, algo := range []string{store.PasswordArgon2id, store.PasswordBcrypt} {
+		t.Run(algo, func(t *testing.T) {
+			h, err := NewHasher(algo, testParams)
+			if err != nil {
+				t.Fatal(err)
+			}
+			stored, err := h.Hash("correct horse")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if stored.Algo != algo {
+				t.Errorf("Algo = %q, want %q", stored.Algo, algo)
+			}
+
+			if ok, rehash := h.Check(stored, "correct horse"); !ok || rehash {
+				t.Errorf("Check(right password) = %v, %v, want true, false", ok, rehash)
+			}
+			if ok, _ := h.Check(stored, "battery staple"); ok {
+				t.Error("Check(wrong password) = true")
+			}
+		})
+	}
+}
+
+func TestCheckAsksForRehash(t *testing.T) {
+	h, err := NewHasher(store.PasswordArgon2id, testParams)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	old, err := NewHasher(store.PasswordArgon2id, Argon2Params{Memory: 32, Iterations: 1, Parallelism: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	stored, err := old.Hash("secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ok, rehash := h.Check(stored, "secret"); !ok || !rehash {
+		t.Errorf("Check(other parameters) = %v, %v, want true, true", ok, rehash)
+	}
+
+	hash, err := bcrypt.GenerateFromPassword([]byte("secret"), bcrypt.MinCost)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ok, rehash := h.Check(store.Password{Algo: store.PasswordBcrypt, Hash: string(hash)}, "secret"); !ok || !rehash {
+		t.Errorf("Check(bcrypt) = %v, %v, want true, true", ok, rehash)
+	}
+}
+
+func TestCheckRejectsMalformedHashes(t *testing.T) {
+	h, err := NewHasher(store.PasswordArgon2id, testParams)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		hash string
+	}{
+		{"empty", ""},
+		{"too few fields", "$argon2id$v=19$m=64,t=1,p=1$c2FsdHNhbHQ"},
+		{"other variant", "$argon2i$v=19$m=64,t=1,p=1$c2FsdHNhbHQ$a2V5a2V5"},
+		{"other version", "$argon2id$v=16$m=64,t=1,p=1$c2FsdHNhbHQ$a2V5a2V5"},
+		{"bad parameters", "$argon2id$v=19$m=sixty-four$c2FsdHNhbHQ$a2V5a2V5"},
+		{"bad salt", "$argon2id$v=19$m=64,t=1,p=1$!!!$a2V5a2V5"},
+		{"bad key", "$argon2id$v=19$m=64,t=1,p=1$c2FsdHNhbHQ$!!!"},
+		{"empty key", "$argon2id$v=19$m=64,t=1,p=1$c2FsdHNhbHQ$"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if ok, rehash := h.Check(store.Password{Algo: store.PasswordArgon2id, Hash: tt.hash}, "secret"); ok || rehash {
+				t.Errorf("Check = %v, %v, want false, false", ok, rehash)
+			}
+		})
+	}
+
+	if ok, _ := h.Check(store.Password{Algo: "md5", Hash: "5ebe2294ecd0e0f08eab7690d2a6ee69"}, "secret"); ok {
+		t.Error("Check(unknown algorithm) = true")
+	}
+}
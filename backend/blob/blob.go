@@ -0,0 +1,68 @@
+// Package blob stores attachment files, on local disk or in an S3
+// compatible object store such as MinIO. Object stores also hand out
+// presigned URLs, so clients upload and download large files directly
+// instead of through the API server.
+package blob
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+)
+
+// Backends a Store can keep files in.
+const (
+	BackendLocal = "local"
+	BackendS3    = "s3"
+)
+
+// ErrNotFound is returned for keys that have no file.
+var ErrNotFound = errors.New("blob not found")
+
+// Store keeps files under keys chosen by the caller.
+type Store interface {
+	// Put stores size bytes read from r under key, replacing any file
+	// stored there.
+	Put(ctx context.Context, key string, r io.Reader, size int64, contentType string) error
+	// Get opens the file stored under key. The caller closes it.
+	Get(ctx context.Context, key string) (io.ReadCloser, error)
+	// Size returns the size of the file stored under key.
+	Size(ctx context.Context, key string) (int64, error)
+	// Delete removes the file stored under key. Deleting a missing file is
+	// not an error.
+	Delete(ctx context.Context, key string) error
+}
+
+// Presigner is implemented by stores that clients can reach directly. The
+// URLs it returns grant access to one file until they expire.
+type Presigner interface {
+	// PresignGet returns a URL downloading key, served with contentType
+	// and displayed inline as filename unless it is empty.
+	PresignGet(key, contentType, filename string, expires time.Duration) (string, error)
+	// PresignPut returns a URL uploading key with a PUT request, which must
+	// send contentType as its Content-Type.
+	PresignPut(key, contentType string, expires time.Duration) (string, error)
+}
+
+// Config selects where files are stored.
+type Config struct {
+	// Backend is local or s3.
+	Backend string
+	// Dir is the directory of the local backend.
+	Dir string
+	// S3 configures the s3 backend.
+	S3 S3Config
+}
+
+// New creates the store cfg selects.
+func New(cfg Config) (Store, error) {
+	switch cfg.Backend {
+	case BackendLocal:
+		return NewLocal(cfg.Dir)
+	case BackendS3:
+		return NewS3(cfg.S3)
+	}
+	return nil, fmt.Errorf("unknown blob store %q, expected %s or %s", cfg.Backend, BackendLocal, BackendS3)
+}
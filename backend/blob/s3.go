@@ -0,0 +1,294 @@
+package blob
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// S3 request settings. Payloads are not hashed, which S3 and MinIO accept,
+// so uploads stream without being read twice.
+const (
+	s3RequestTimeout = 5 * time.Minute
+	unsignedPayload  = "UNSIGNED-PAYLOAD"
+	signingAlgorithm = "AWS4-HMAC-SHA256"
+	amzDateFormat    = "20060102T150405Z"
+)
+
+// MaxPresignExpiry is the longest a presigned URL may last.
+const MaxPresignExpiry = 7 * 24 * time.Hour
+
+// S3Config configures a bucket of an S3 compatible object store.
+type S3Config struct {
+	// Endpoint is the base URL of the object store, such as
+	// https://s3.eu-west-1.amazonaws.com or http://minio:9000.
+	Endpoint        string
+	Region          string
+	Bucket          string
+	AccessKeyID     string
+	SecretAccessKey string
+	// PathStyle addresses the bucket in the path, endpoint/bucket/key,
+	// instead of the host name, bucket.endpoint/key, as MinIO expects.
+	PathStyle bool
+}
+
+// S3 stores files as objects of an S3 compatible bucket, signing requests
+// with AWS Signature Version 4.
+type S3 struct {
+	client   *http.Client
+	endpoint *url.URL
+	cfg      S3Config
+}
+
+// NewS3 creates a store in the bucket cfg names.
+func NewS3(cfg S3Config) (*S3, error) {
+	u, err := url.Parse(cfg.Endpoint)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, fmt.Errorf("invalid S3 endpoint %q", cfg.Endpoint)
+	}
+	if cfg.Region == "" || cfg.Bucket == "" || cfg.AccessKeyID == "" || cfg.SecretAccessKey == "" {
+		return nil, errors.New("S3 region, bucket and credentials are required")
+	}
+	return &S3{client: &http.Client{Timeout: s3RequestTimeout}, endpoint: u, cfg: cfg}, nil
+}
+
+func (s *S3) Put(ctx context.Context, key string, r io.Reader, size int64, contentType string) error {
+	if size == 0 {
+		r = http.NoBody
+	}
+	resp, err := s.do(ctx, http.MethodPut, key, r, size, contentType)
+	if err != nil {
+		return err
+	}
+	return checkS3Response(resp)
+}
+
+func (s *S3) Get(ctx context.Context, key string) (io.ReadCloser, error) {
+	resp, err := s.do(ctx, http.MethodGet, key, nil, 0, "")
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, checkS3Response(resp)
+	}
+	return resp.Body, nil
+}
+
+func (s *S3) Size(ctx context.Context, key string) (int64, error) {
+	resp, err := s.do(ctx, http.MethodHead, key, nil, 0, "")
+	if err != nil {
+		return 0, err
+	}
+	if err := checkS3Response(resp); err != nil {
+		return 0, err
+	}
+	return resp.ContentLength, nil
+}
+
+func (s *S3) Delete(ctx context.Context, key string) error {
+	resp, err := s.do(ctx, http.MethodDelete, key, nil, 0, "")
+	if err != nil {
+		return err
+	}
+	if err := checkS3Response(resp); err != nil && !errors.Is(err, ErrNotFound) {
+		return err
+	}
+	return nil
+}
+
+func (s *S3) PresignGet(key, contentType, filename string, expires time.Duration) (string, error) {
+	query := url.Values{}
+	query.Set("response-content-type", contentType)
+	if filename != "" {
+		query.Set("response-content-disposition", fmt.Sprintf("inline; filename=%q", filename))
+	}
+	return s.presign(http.MethodGet, key, query, nil, expires)
+}
+
+func (s *S3) PresignPut(key, contentType string, expires time.Duration) (string, error) {
+	return s.presign(http.MethodPut, key, url.Values{}, map[string]string{"content-type": contentType}, expires)
+}
+
+// do sends a signed request for key.
+func (s *S3) do(ctx context.Context, method, key string, body io.Reader, size int64, contentType string) (*http.Response, error) {
+	u := s.objectURL(key)
+	req, err := http.NewRequestWithContext(ctx, method, u.String(), body)
+	if err != nil {
+		return nil, err
+	}
+	if body != nil {
+		req.ContentLength = size
+	}
+
+	amzDate := time.Now().UTC().Format(amzDateFormat)
+	headers := map[string]string{
+		"host":                 u.Host,
+		"x-amz-content-sha256": unsignedPayload,
+		"x-amz-date":           amzDate,
+	}
+	if contentType != "" {
+		headers["content-type"] = contentType
+		req.Header.Set("Content-Type", contentType)
+	}
+	signedHeaders, signature := s.sign(method, u, "", headers, amzDate)
+
+	req.Header.Set("X-Amz-Content-Sha256", unsignedPayload)
+	req.Header.Set("X-Amz-Date", amzDate)
+	req.Header.Set("Authorization", fmt.Sprintf("%s Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		signingAlgorithm, s.cfg.AccessKeyID, s.scope(amzDate), signedHeaders, signature))
+	return s.client.Do(req)
+}
+
+// presign returns a URL for a method request on key, authenticated by its
+// query string until it expires. Requests sending it must send headers as
+// given.
+func (s *S3) presign(method, key string, query url.Values, headers map[string]string, expires time.Duration) (string, error) {
+	if expires <= 0 || expires > MaxPresignExpiry {
+		return "", fmt.Errorf("invalid presigned URL expiry %s", expires)
+	}
+
+	u := s.objectURL(key)
+	amzDate := time.Now().UTC().Format(amzDateFormat)
+	signed := map[string]string{"host": u.Host}
+	for name, value := range headers {
+		signed[name] = value
+	}
+
+	query.Set("X-Amz-Algorithm", signingAlgorithm)
+	query.Set("X-Amz-Credential", s.cfg.AccessKeyID+"/"+s.scope(amzDate))
+	query.Set("X-Amz-Date", amzDate)
+	query.Set("X-Amz-Expires", strconv.Itoa(int(expires/time.Second)))
+	query.Set("X-Amz-SignedHeaders", strings.Join(sortedKeys(signed), ";"))
+	rawQuery := canonicalQuery(query)
+
+	_, signature := s.sign(method, u, rawQuery, signed, amzDate)
+	u.RawQuery = rawQuery + "&X-Amz-Signature=" + signature
+	return u.String(), nil
+}
+
+// objectURL returns the URL of key in the bucket.
+func (s *S3) objectURL(key string) *url.URL {
+	u := *s.endpoint
+	base := strings.TrimSuffix(u.Path, "/")
+	if s.cfg.PathStyle {
+		u.Path = base + "/" + s.cfg.Bucket + "/" + key
+	} else {
+		u.Host = s.cfg.Bucket + "." + u.Host
+		u.Path = base + "/" + key
+	}
+	u.RawPath = uriEncode(u.Path, false)
+	u.RawQuery = ""
+	return &u
+}
+
+// scope returns the credential scope of requests signed at amzDate.
+func (s *S3) scope(amzDate string) string {
+	return amzDate[:8] + "/" + s.cfg.Region + "/s3/aws4_request"
+}
+
+// sign signs a request with its canonical query string and the headers to
+// sign, keyed by lower case name, and returns the signed header names and the
+// signature.
+func (s *S3) sign(method string, u *url.URL, rawQuery string, headers map[string]string, amzDate string) (string, string) {
+	names := sortedKeys(headers)
+	var canonicalHeaders strings.Builder
+	for _, name := range names {
+		canonicalHeaders.WriteString(name + ":" + strings.TrimSpace(headers[name]) + "\n")
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	canonicalRequest := strings.Join([]string{
+		method,
+		u.EscapedPath(),
+		rawQuery,
+		canonicalHeaders.String(),
+		signedHeaders,
+		unsignedPayload,
+	}, "\n")
+	hash := sha256.Sum256([]byte(canonicalRequest))
+	stringToSign := strings.Join([]string{signingAlgorithm, amzDate, s.scope(amzDate), hex.EncodeToString(hash[:])}, "\n")
+
+	key := hmacSHA256([]byte("AWS4"+s.cfg.SecretAccessKey), amzDate[:8])
+	key = hmacSHA256(key, s.cfg.Region)
+	key = hmacSHA256(key, "s3")
+	key = hmacSHA256(key, "aws4_request")
+	return signedHeaders, hex.EncodeToString(hmacSHA256(key, stringToSign))
+}
+
+// checkS3Response maps an object store response to an error, closing its
+// body.
+func checkS3Response(resp *http.Response) error {
+	defer resp.Body.Close()
+	switch {
+	case resp.StatusCode >= 200 && resp.StatusCode < 300:
+		return nil
+	case resp.StatusCode == http.StatusNotFound:
+		return ErrNotFound
+	default:
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("object store returned %s: %s", resp.Status, body)
+	}
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(data))
+	return h.Sum(nil)
+}
+
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// canonicalQuery encodes query sorted by name, as signatures expect.
+func canonicalQuery(query url.Values) string {
+	names := make([]string, 0, len(query))
+	for name := range query {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var pairs []string
+	for _, name := range names {
+		values := append([]string(nil), query[name]...)
+		sort.Strings(values)
+		for _, v := range values {
+			pairs = append(pairs, uriEncode(name, true)+"="+uriEncode(v, true))
+		}
+	}
+	return strings.Join(pairs, "&")
+}
+
+// uriEncode percent-encodes every byte of s but unreserved characters, and
+// slashes unless encodeSlash is set.
+func uriEncode(s string, encodeSlash bool) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case 'A' <= c && c <= 'Z', 'a' <= c && c <= 'z', '0' <= c && c <= '9',
+			c == '-', c == '_', c == '.', c == '~':
+			b.WriteByte(c)
+		case c == '/' && !encodeSlash:
+			b.WriteByte(c)
+		default:
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+	return b.String()
+}
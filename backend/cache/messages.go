@@ -0,0 +1,172 @@
+// Package cache keeps the most recent messages of each conversation in
+// Redis, so opening a chat does not have to hit Postgres.
+package cache
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"time"
+
+	"backend/store"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// ttl is how long an untouched conversation stays cached. It also bounds how
+// long a change the cache was not told about can be served.
+const ttl = time.Hour
+
+// replaceByID replaces the cached copy of a message, found by ID, if the
+// conversation is cached.
+var replaceByID = redis.NewScript(`
+local items = redis.call('LRANGE', KEYS[1], 0, -1)
+for i, item in ipairs(items) do
+	if cjson.decode(item).id == ARGV[1] then
+		redis.call('LSET', KEYS[1], i - 1, ARGV[2])
+		return 1
+	end
+end
+return 0
+`)
+
+// Messages caches up to size recent messages per conversation, as seen by
+// each participant, in a Redis list ordered oldest first. A conversation is
+// cached once someone reads it and kept up to date as messages are sent and
+// changed.
+type Messages struct {
+	rdb  *redis.Client
+	size int
+}
+
+// NewMessages creates a cache of size messages per conversation. A size of
+// zero disables caching.
+func NewMessages(rdb *redis.Client, size int) *Messages {
+	return &Messages{rdb: rdb, size: size}
+}
+
+// Size returns how many recent messages are cached per conversation.
+func (m *Messages) Size() int {
+	return m.size
+}
+
+// key returns the Redis key of the conversation with other as seen by viewer.
+func key(viewer, other string) string {
+	return fmt.Sprintf("conversation:%s:%s", viewer, other)
+}
+
+// Recent returns the latest limit messages of the conversation as seen by
+// viewer, oldest first, and false on a miss.
+func (m *Messages) Recent(ctx context.Context, viewer, other string, limit int) ([]store.Message, bool) {
+	if m.size == 0 || limit > m.size {
+		return nil, false
+	}
+
+	items, err := m.rdb.LRange(ctx, key(viewer, other), int64(-limit), -1).Result()
+	if err != nil {
+		log.Printf("Error reading message cache: %v", err)
+		return nil, false
+	}
+	if len(items) == 0 {
+		return nil, false
+	}
+
+	messages := make([]store.Message, 0, len(items))
+	for _, item := range items {
+		var msg store.Message
+		if err := json.Unmarshal([]byte(item), &msg); err != nil {
+			log.Printf("Error decoding cached message: %v", err)
+			return nil, false
+		}
+		messages = append(messages, msg)
+	}
+	return messages, true
+}
+
+// Fill caches the latest messages of a conversation as seen by viewer,
+// replacing what was cached.
+func (m *Messages) Fill(ctx context.Context, viewer, other string, messages []store.Message) {
+	if m.size == 0 || len(messages) == 0 {
+		return
+	}
+	if len(messages) > m.size {
+		messages = messages[len(messages)-m.size:]
+	}
+
+	items := make([]interface{}, 0, len(messages))
+	for _, msg := range messages {
+		item, err := json.Marshal(msg)
+		if err != nil {
+			log.Printf("Error encoding message for cache: %v", err)
+			return
+		}
+		items = append(items, item)
+	}
+
+	k := key(viewer, other)
+	_, err := m.rdb.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.Del(ctx, k)
+		pipe.RPush(ctx, k, items...)
+		pipe.Expire(ctx, k, ttl)
+		return nil
+	})
+	if err != nil {
+		log.Printf("Error filling message cache: %v", err)
+	}
+}
+
+// Append adds a new message to both participants' cached conversations.
+// Conversations that are not cached stay uncached.
+func (m *Messages) Append(ctx context.Context, msg store.Message) {
+	if m.size == 0 {
+		return
+	}
+
+	item, err := json.Marshal(msg)
+	if err != nil {
+		log.Printf("Error encoding message for cache: %v", err)
+		return
+	}
+
+	_, err = m.rdb.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		for _, k := range []string{key(msg.Sender, msg.Receiver), key(msg.Receiver, msg.Sender)} {
+			pipe.RPushX(ctx, k, item)
+			pipe.LTrim(ctx, k, int64(-m.size), -1)
+			pipe.Expire(ctx, k, ttl)
+		}
+		return nil
+	})
+	if err != nil {
+		log.Printf("Error appending to message cache: %v", err)
+	}
+}
+
+// Update replaces the cached copies of a changed message.
+func (m *Messages) Update(ctx context.Context, msg store.Message) {
+	if m.size == 0 {
+		return
+	}
+
+	item, err := json.Marshal(msg)
+	if err != nil {
+		log.Printf("Error encoding message for cache: %v", err)
+		return
+	}
+
+	for _, k := range []string{key(msg.Sender, msg.Receiver), key(msg.Receiver, msg.Sender)} {
+		if err := replaceByID.Run(ctx, m.rdb, []string{k}, msg.ID, item).Err(); err != nil {
+			log.Printf("Error updating message cache: %v", err)
+		}
+	}
+}
+
+// Invalidate drops the cached conversation with other as seen by viewer.
+func (m *Messages) Invalidate(ctx context.Context, viewer, other string) {
+	if m.size == 0 {
+		return
+	}
+	if err := m.rdb.Del(ctx, key(viewer, other)).Err(); err != nil {
+		log.Printf("Error invalidating message cache: %v", err)
+	}
+}
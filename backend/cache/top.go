@@ -0,0 +1,94 @@
+package cache
+
+import (
+	"context"
+	"fmt"
+	"log"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// recordScoreIfLoaded updates a message's score in a conversation's sorted
+// set only if the set was loaded, so a partial set is never mistaken for a
+// complete one.
+var recordScoreIfLoaded = redis.NewScript(`
+if redis.call('EXISTS', KEYS[1]) == 1 then
+	redis.call('ZADD', KEYS[1], ARGV[1], ARGV[2])
+	redis.call('EXPIRE', KEYS[1], ARGV[3])
+end
+return 0
+`)
+
+// ScoreLoader returns the score of every voted message in the conversation
+// between a and b, keyed by message ID.
+type ScoreLoader func(ctx context.Context, a, b string) (map[string]int, error)
+
+// TopMessages ranks the messages of each conversation by score, upvotes
+// minus downvotes, in a Redis sorted set.
+type TopMessages struct {
+	rdb  *redis.Client
+	load ScoreLoader
+}
+
+// NewTopMessages creates a ranking that loads a conversation's scores with
+// load the first time it is asked for.
+func NewTopMessages(rdb *redis.Client, load ScoreLoader) *TopMessages {
+	return &TopMessages{rdb: rdb, load: load}
+}
+
+// topKey returns the key of the sorted set of a conversation, the same for
+// both participants.
+func topKey(a, b string) string {
+	if b < a {
+		a, b = b, a
+	}
+	return fmt.Sprintf("top:%s:%s", a, b)
+}
+
+// Record updates the score of a message after a vote.
+func (t *TopMessages) Record(ctx context.Context, sender, receiver, messageID string, score int) {
+	err := recordScoreIfLoaded.Run(ctx, t.rdb, []string{topKey(sender, receiver)}, score, messageID, int(ttl.Seconds())).Err()
+	if err != nil {
+		log.Printf("Error recording score of message %s: %v", messageID, err)
+	}
+}
+
+// Page returns up to count message IDs of the conversation between a and b,
+// highest score first, skipping the first offset.
+func (t *TopMessages) Page(ctx context.Context, a, b string, offset, count int) ([]string, error) {
+	key := topKey(a, b)
+
+	exists, err := t.rdb.Exists(ctx, key).Result()
+	if err != nil {
+		return nil, err
+	}
+	if exists == 0 {
+		if err := t.fill(ctx, a, b); err != nil {
+			return nil, err
+		}
+	}
+
+	return t.rdb.ZRevRange(ctx, key, int64(offset), int64(offset+count-1)).Result()
+}
+
+// fill loads the scores of a conversation into its sorted set.
+func (t *TopMessages) fill(ctx context.Context, a, b string) error {
+	scores, err := t.load(ctx, a, b)
+	if err != nil || len(scores) == 0 {
+		return err
+	}
+
+	members := make([]*redis.Z, 0, len(scores))
+	for id, score := range scores {
+		members = append(members, &redis.Z{Score: float64(score), Member: id})
+	}
+
+	key := topKey(a, b)
+	_, err = t.rdb.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.Del(ctx, key)
+		pipe.ZAdd(ctx, key, members...)
+		pipe.Expire(ctx, key, ttl)
+		return nil
+	})
+	return err
+}
@@ -0,0 +1,714 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"net"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"backend/analytics"
+	"backend/api"
+	"backend/auth"
+	"backend/blob"
+	"backend/email"
+	"backend/events"
+	"backend/ipfilter"
+	"backend/moderation"
+	"backend/pubsub"
+	"backend/push"
+	"backend/service"
+	"backend/store"
+	"backend/store/postgres"
+	"backend/tracing"
+	"backend/usernames"
+	"backend/ws"
+)
+
+// Values of the -store-backend flag.
+const (
+	storePostgres = "postgres" // keep data in Postgres
+	storeMemory   = "memory"   // keep data in memory, for demos and tests
+	storeSQLite   = "sqlite"   // keep data in a SQLite file, for a single node
+)
+
+// Values of the -migrate flag.
+const (
+	migrateAuto = "auto" // apply pending migrations, then start the server
+	migrateUp   = "up"   // apply pending migrations and exit
+	migrateDown = "down" // roll back the latest migrations and exit
+	migrateOff  = "off"  // start the server without touching the schema
+)
+
+// Values of the -message-retention-mode flag.
+const (
+	retentionDrop    = "drop"    // drop months older than the retention period
+	retentionArchive = "archive" // keep them as tables outside messages
+)
+
+// minAnalyticsKeyLength is the shortest ANALYTICS_KEY accepted, so that
+// pseudonyms cannot be reversed by guessing the key.
+const minAnalyticsKeyLength = 32
+
+// Config contains the server configuration. Every setting can be given as an
+// environment variable or overridden by the matching command line flag.
+type Config struct {
+	// Where data is kept: postgres, memory or sqlite. The DB settings only
+	// apply to postgres, and SQLitePath only to sqlite.
+	StoreBackend string
+	SQLitePath   string
+
+	DBHost     string
+	DBPort     int
+	DBUser     string
+	DBPassword string
+	DBName     string
+
+	// Connection pool limits and the longest a statement may run; zero
+	// means no limit, except for idle connections.
+	DBMaxOpenConns    int
+	DBMaxIdleConns    int
+	DBConnMaxLifetime time.Duration
+	DBQueryTimeout    time.Duration
+	// Prepared statements kept per connection; zero prepares none.
+	DBStatementCacheSize int
+
+	// Read replicas as host or host:port, reached with the same user,
+	// password and database, and how far behind the primary one may fall
+	// before reads go back to the primary.
+	DBReplicas      []string
+	DBReplicaMaxLag time.Duration
+
+	// Schema migration mode (auto, up, down or off) and how many migrations
+	// "down" rolls back.
+	Migrate      string
+	MigrateSteps int
+
+	RedisAddr  string
+	ListenAddr string
+	GRPCAddr   string
+	JWTSecret  string
+
+	// How instances reach each other: redis or postgres.
+	PubSubBackend string
+	// The name of this instance, unique among instances and stable across
+	// restarts for its undelivered messages to be delivered after one.
+	// Random if empty.
+	InstanceID string
+
+	// Browser origins allowed by CORS and WebSocket upgrades, and the methods,
+	// headers and preflight max age CORS allows.
+	CORSOrigins []string
+	CORSMethods []string
+	CORSHeaders []string
+	CORSMaxAge  time.Duration
+
+	// Proxies trusted to name the client in forwarding headers, empty to
+	// trust any. Addresses that alone may, or may not, reach the API, and
+	// the header a proxy puts the client's country in with the countries
+	// that alone may, or may not.
+	TrustedProxies      []string
+	IPAllowlist         []string
+	IPDenylist          []string
+	GeoIPCountryHeader  string
+	GeoIPAllowCountries []string
+	GeoIPDenyCountries  []string
+
+	// WebSocket heartbeat intervals in seconds; zero keeps the defaults.
+	WSPingInterval int
+	WSPongWait     int
+	// Outbound events each WebSocket client may queue and what happens to a
+	// client whose queue is full.
+	WSSendBuffer       int
+	WSSlowClientPolicy string
+	// Compression: permessage-deflate on WebSockets, and the size from which
+	// JSON responses are gzipped, 0 for never.
+	WSCompression bool
+	GzipMinBytes  int
+
+	// Attachment storage: local or s3, the directory of local storage, the
+	// S3 bucket, how long presigned URLs last and the size limit.
+	BlobStore         string
+	UploadDir         string
+	S3Endpoint        string
+	S3Region          string
+	S3Bucket          string
+	S3AccessKeyID     string
+	S3SecretAccessKey string
+	S3PathStyle       bool
+	PresignExpiry     time.Duration
+	MaxUploadBytes    int64
+
+	// Workers rendering thumbnails of uploaded images; zero leaves images
+	// to other instances.
+	MediaWorkers int
+
+	// Per-user quotas: messages sent per day and total attachment bytes;
+	// zero means unlimited.
+	MessageQuota      int
+	StorageQuotaBytes int64
+
+	// Days messages are kept, zero for ever, and whether older months are
+	// dropped or archived.
+	MessageRetentionDays int
+	MessageRetentionMode string
+
+	// Recent messages cached in Redis per conversation; zero disables caching.
+	MessageCacheSize int
+
+	// Most characters a message's content may have.
+	MaxMessageLength int
+
+	// Frontend base URL used in emailed links.
+	AppURL string
+
+	// SMTP server for outgoing email; emails are logged when SMTPAddr is empty.
+	SMTPAddr     string
+	SMTPUser     string
+	SMTPPassword string
+	SMTPFrom     string
+
+	// Whether signing up requires an email that must be verified before
+	// logging in.
+	RequireEmailVerification bool
+
+	// Whether tokens are also handed out in HttpOnly cookies, for browser
+	// frontends, with CSRF protection.
+	AuthCookies bool
+
+	// Password hashing: the algorithm new hashes use, argon2id or bcrypt,
+	// and the Argon2id memory in KiB, iterations and parallelism.
+	PasswordAlgo      string
+	Argon2MemoryKiB   int
+	Argon2Iterations  int
+	Argon2Parallelism int
+
+	// Push notification credentials; platforms left unconfigured are skipped.
+	FCMCredentialsFile string
+	APNSKeyFile        string
+	APNSKeyID          string
+	APNSTeamID         string
+	APNSTopic          string
+	APNSProduction     bool
+	VAPIDPrivateKey    string
+	VAPIDSubject       string
+
+	// Content filter: an optional wordlist file and moderation API, and the
+	// strictness applied to conversations whose participants chose none.
+	ContentFilterWordlist   string
+	ModerationAPIURL        string
+	ContentFilterStrictness string
+
+	// Username policy: length bounds, the pattern names must match, names
+	// nobody may take and an optional file of words names may not contain.
+	UsernameMinLength int
+	UsernameMaxLength int
+	UsernamePattern   string
+	UsernameReserved  []string
+	UsernameBlocklist string
+
+	// Message queue domain events are published to: kafka, nats or empty
+	// for none, its address and the topic or subject prefix.
+	EventBroker    string
+	EventBrokerURL string
+	EventTopic     string
+
+	// Sink usage analytics are sent to: file, http or empty for none, the
+	// file or endpoint, and the key users' pseudonyms are derived with.
+	AnalyticsSink string
+	AnalyticsURL  string
+	AnalyticsKey  string
+
+	// OTLP/HTTP collector spans are exported to, empty to disable tracing,
+	// the service name traces show and the fraction of traces recorded.
+	OTLPEndpoint     string
+	OTELServiceName  string
+	TraceSampleRatio float64
+
+	// How long shutdown waits for requests and WebSocket clients to drain.
+	DrainTimeout time.Duration
+}
+
+// envOr returns the environment variable key, or def if it is unset.
+func envOr(key, def string) string {
+	if v, ok := os.LookupEnv(key); ok {
+		return v
+	}
+	return def
+}
+
+// envIntOr returns the environment variable key parsed as an int, or def if
+// it is unset or not a number.
+func envIntOr(key string, def int) int {
+	if v, ok := os.LookupEnv(key); ok {
+		if n, err := strconv.Atoi(v); err == nil {
+			return n
+		}
+	}
+	return def
+}
+
+// envFloatOr returns the environment variable key parsed as a float64, or
+// def if it is unset or not a number.
+func envFloatOr(key string, def float64) float64 {
+	if v, ok := os.LookupEnv(key); ok {
+		if f, err := strconv.ParseFloat(v, 64); err == nil {
+			return f
+		}
+	}
+	return def
+}
+
+// envDurationOr returns the environment variable key parsed as a duration
+// such as "15s", or def if it is unset or invalid.
+func envDurationOr(key string, def time.Duration) time.Duration {
+	if v, ok := os.LookupEnv(key); ok {
+		if d, err := time.ParseDuration(v); err == nil {
+			return d
+		}
+	}
+	return def
+}
+
+// splitList splits a comma separated list, dropping empty entries.
+func splitList(s string) []string {
+	var list []string
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			list = append(list, item)
+		}
+	}
+	return list
+}
+
+// loadConfig builds the configuration from environment variables and the
+// given command line arguments, then validates it.
+func loadConfig(args []string) (*Config, error) {
+	cfg := &Config{}
+	var corsOrigins, corsMethods, corsHeaders, dbReplicas string
+	var trustedProxies, ipAllowlist, ipDenylist, allowCountries, denyCountries string
+	var usernameReserved string
+
+	fs := flag.NewFlagSet("backend", flag.ContinueOnError)
+	fs.StringVar(&cfg.StoreBackend, "store-backend", envOr("STORE_BACKEND", storePostgres), "Where data is kept: postgres, memory to run without a database, or sqlite for a single node (STORE_BACKEND)")
+	fs.StringVar(&cfg.SQLitePath, "sqlite-path", envOr("SQLITE_PATH", "chat.db"), "SQLite database file, created if missing (SQLITE_PATH)")
+	fs.StringVar(&cfg.DBHost, "db-host", envOr("DB_HOST", "localhost"), "Postgres host (DB_HOST)")
+	fs.IntVar(&cfg.DBPort, "db-port", envIntOr("DB_PORT", 5432), "Postgres port (DB_PORT)")
+	fs.StringVar(&cfg.DBUser, "db-user", envOr("DB_USER", "postgres"), "Postgres user (DB_USER)")
+	fs.StringVar(&cfg.DBPassword, "db-password", envOr("DB_PASSWORD", ""), "Postgres password (DB_PASSWORD)")
+	fs.StringVar(&cfg.DBName, "db-name", envOr("DB_NAME", "chat"), "Postgres database, created if missing (DB_NAME)")
+	fs.IntVar(&cfg.DBMaxOpenConns, "db-max-open-conns", envIntOr("DB_MAX_OPEN_CONNS", 25), "Most open database connections, 0 for no limit (DB_MAX_OPEN_CONNS)")
+	fs.IntVar(&cfg.DBMaxIdleConns, "db-max-idle-conns", envIntOr("DB_MAX_IDLE_CONNS", 10), "Most idle database connections kept open (DB_MAX_IDLE_CONNS)")
+	fs.DurationVar(&cfg.DBConnMaxLifetime, "db-conn-max-lifetime", envDurationOr("DB_CONN_MAX_LIFETIME", 30*time.Minute), "How long a database connection is reused, 0 for no limit (DB_CONN_MAX_LIFETIME)")
+	fs.DurationVar(&cfg.DBQueryTimeout, "db-query-timeout", envDurationOr("DB_QUERY_TIMEOUT", 10*time.Second), "Longest a database statement may run, 0 for no limit (DB_QUERY_TIMEOUT)")
+	fs.IntVar(&cfg.DBStatementCacheSize, "db-statement-cache-size", envIntOr("DB_STATEMENT_CACHE_SIZE", 256), "Prepared statements kept per database connection, 0 prepares none (DB_STATEMENT_CACHE_SIZE)")
+	fs.StringVar(&dbReplicas, "db-replicas", envOr("DB_REPLICAS", ""), "Comma separated Postgres read replicas as host or host:port (DB_REPLICAS)")
+	fs.DurationVar(&cfg.DBReplicaMaxLag, "db-replica-max-lag", envDurationOr("DB_REPLICA_MAX_LAG", 5*time.Second), "Most a read replica may lag before reads go to the primary (DB_REPLICA_MAX_LAG)")
+	fs.StringVar(&cfg.Migrate, "migrate", envOr("MIGRATE", migrateAuto), "Schema migrations: auto, up, down or off (MIGRATE)")
+	fs.IntVar(&cfg.MigrateSteps, "migrate-steps", envIntOr("MIGRATE_STEPS", 1), "Number of migrations rolled back by -migrate=down (MIGRATE_STEPS)")
+	fs.StringVar(&cfg.RedisAddr, "redis-addr", envOr("REDIS_ADDR", "localhost:6379"), "Redis address (REDIS_ADDR)")
+	fs.StringVar(&cfg.PubSubBackend, "pubsub-backend", envOr("PUBSUB_BACKEND", pubsub.BackendRedis), "How instances share events other than messages: redis or postgres (PUBSUB_BACKEND)")
+	fs.StringVar(&cfg.InstanceID, "instance-id", envOr("INSTANCE_ID", ""), "Unique name of this instance, kept across restarts, random if empty (INSTANCE_ID)")
+	fs.StringVar(&cfg.ListenAddr, "listen", envOr("LISTEN_ADDR", "0.0.0.0:8080"), "HTTP listen address (LISTEN_ADDR)")
+	fs.StringVar(&cfg.GRPCAddr, "grpc-addr", envOr("GRPC_ADDR", "0.0.0.0:9090"), "gRPC listen address, disabled if empty (GRPC_ADDR)")
+	fs.StringVar(&corsOrigins, "cors-origins", envOr("CORS_ORIGINS", "http://localhost:3000,http://127.0.0.1:3000"), "Comma separated allowed origins, such as https://*.example.com, or * for any (CORS_ORIGINS)")
+	fs.StringVar(&corsMethods, "cors-methods", envOr("CORS_METHODS", "GET,POST,PUT,PATCH,DELETE,OPTIONS"), "Comma separated methods allowed by CORS (CORS_METHODS)")
+	fs.StringVar(&corsHeaders, "cors-headers", envOr("CORS_HEADERS", "Origin,Content-Type,Authorization,Idempotency-Key,Last-Event-ID,X-CSRF-Token"), "Comma separated request headers allowed by CORS (CORS_HEADERS)")
+	fs.DurationVar(&cfg.CORSMaxAge, "cors-max-age", envDurationOr("CORS_MAX_AGE", 12*time.Hour), "How long browsers may cache CORS preflight responses (CORS_MAX_AGE)")
+	fs.StringVar(&trustedProxies, "trusted-proxies", envOr("TRUSTED_PROXIES", ""), "Comma separated IPs and CIDR ranges of proxies whose X-Forwarded-For is trusted, empty to trust none (TRUSTED_PROXIES)")
+	fs.StringVar(&ipAllowlist, "ip-allowlist", envOr("IP_ALLOWLIST", ""), "Comma separated IPs and CIDR ranges that alone may reach the API, empty for any (IP_ALLOWLIST)")
+	fs.StringVar(&ipDenylist, "ip-denylist", envOr("IP_DENYLIST", ""), "Comma separated IPs and CIDR ranges that may not reach the API (IP_DENYLIST)")
+	fs.StringVar(&cfg.GeoIPCountryHeader, "geoip-country-header", envOr("GEOIP_COUNTRY_HEADER", ""), "Header a proxy or CDN sets to the client's country code, such as CF-IPCountry (GEOIP_COUNTRY_HEADER)")
+	fs.StringVar(&allowCountries, "geoip-allow-countries", envOr("GEOIP_ALLOW_COUNTRIES", ""), "Comma separated country codes that alone may reach the API, empty for any (GEOIP_ALLOW_COUNTRIES)")
+	fs.StringVar(&denyCountries, "geoip-deny-countries", envOr("GEOIP_DENY_COUNTRIES", ""), "Comma separated country codes that may not reach the API (GEOIP_DENY_COUNTRIES)")
+	fs.StringVar(&cfg.JWTSecret, "jwt-secret", envOr("JWT_SECRET", ""), "Secret used to sign access tokens (JWT_SECRET)")
+	fs.IntVar(&cfg.WSPingInterval, "ws-ping-interval", envIntOr("WS_PING_INTERVAL", 0), "WebSocket ping interval in seconds (WS_PING_INTERVAL)")
+	fs.IntVar(&cfg.WSPongWait, "ws-pong-wait", envIntOr("WS_PONG_WAIT", 0), "WebSocket pong timeout in seconds (WS_PONG_WAIT)")
+	fs.IntVar(&cfg.WSSendBuffer, "ws-send-buffer", envIntOr("WS_SEND_BUFFER", 256), "Outbound events each WebSocket client may queue (WS_SEND_BUFFER)")
+	fs.StringVar(&cfg.WSSlowClientPolicy, "ws-slow-client-policy", envOr("WS_SLOW_CLIENT_POLICY", ws.PolicyDisconnect), "What happens to a client whose send buffer is full: disconnect or drop (WS_SLOW_CLIENT_POLICY)")
+	fs.BoolVar(&cfg.WSCompression, "ws-compression", envOr("WS_COMPRESSION", "true") == "true", "Negotiate permessage-deflate compression with WebSocket clients (WS_COMPRESSION)")
+	fs.IntVar(&cfg.GzipMinBytes, "gzip-min-bytes", envIntOr("GZIP_MIN_BYTES", 1024), "Size in bytes from which JSON responses are gzipped, 0 disables (GZIP_MIN_BYTES)")
+	fs.StringVar(&cfg.BlobStore, "blob-store", envOr("BLOB_STORE", blob.BackendLocal), "Attachment storage: local or s3 (BLOB_STORE)")
+	fs.StringVar(&cfg.UploadDir, "upload-dir", envOr("UPLOAD_DIR", "uploads"), "Attachment storage directory of local storage (UPLOAD_DIR)")
+	fs.StringVar(&cfg.S3Endpoint, "s3-endpoint", envOr("S3_ENDPOINT", "https://s3.amazonaws.com"), "S3 compatible object store URL (S3_ENDPOINT)")
+	fs.StringVar(&cfg.S3Region, "s3-region", envOr("S3_REGION", "us-east-1"), "S3 region (S3_REGION)")
+	fs.StringVar(&cfg.S3Bucket, "s3-bucket", envOr("S3_BUCKET", ""), "S3 bucket of attachments (S3_BUCKET)")
+	fs.StringVar(&cfg.S3AccessKeyID, "s3-access-key-id", envOr("S3_ACCESS_KEY_ID", ""), "S3 access key ID (S3_ACCESS_KEY_ID)")
+	fs.StringVar(&cfg.S3SecretAccessKey, "s3-secret-access-key", envOr("S3_SECRET_ACCESS_KEY", ""), "S3 secret access key (S3_SECRET_ACCESS_KEY)")
+	fs.BoolVar(&cfg.S3PathStyle, "s3-path-style", envOr("S3_PATH_STYLE", "") == "true", "Address the bucket in the URL path, as MinIO expects (S3_PATH_STYLE)")
+	fs.DurationVar(&cfg.PresignExpiry, "presign-expiry", envDurationOr("PRESIGN_EXPIRY", api.DefaultPresignExpiry), "How long presigned S3 upload and download URLs last (PRESIGN_EXPIRY)")
+	fs.Int64Var(&cfg.MaxUploadBytes, "max-upload-bytes", int64(envIntOr("MAX_UPLOAD_BYTES", api.DefaultMaxUploadBytes)), "Maximum attachment size in bytes (MAX_UPLOAD_BYTES)")
+	fs.IntVar(&cfg.MediaWorkers, "media-workers", envIntOr("MEDIA_WORKERS", 2), "Workers rendering image thumbnails, 0 for none on this instance (MEDIA_WORKERS)")
+	fs.IntVar(&cfg.MessageQuota, "message-quota", envIntOr("MESSAGE_QUOTA", 0), "Messages a user may send per 24 hours, 0 for unlimited (MESSAGE_QUOTA)")
+	fs.IntVar(&cfg.MessageRetentionDays, "message-retention-days", envIntOr("MESSAGE_RETENTION_DAYS", 0), "Days messages are kept, 0 for ever (MESSAGE_RETENTION_DAYS)")
+	fs.StringVar(&cfg.MessageRetentionMode, "message-retention-mode", envOr("MESSAGE_RETENTION_MODE", retentionDrop), "What happens to months past the retention period: drop or archive (MESSAGE_RETENTION_MODE)")
+	fs.Int64Var(&cfg.StorageQuotaBytes, "storage-quota-bytes", int64(envIntOr("STORAGE_QUOTA_BYTES", 0)), "Total attachment bytes a user may store, 0 for unlimited (STORAGE_QUOTA_BYTES)")
+	fs.IntVar(&cfg.MessageCacheSize, "message-cache-size", envIntOr("MESSAGE_CACHE_SIZE", 50), "Recent messages cached per conversation, 0 disables (MESSAGE_CACHE_SIZE)")
+	fs.IntVar(&cfg.MaxMessageLength, "max-message-length", envIntOr("MAX_MESSAGE_LENGTH", service.DefaultMaxContentLength), "Most characters a message's content may have (MAX_MESSAGE_LENGTH)")
+	fs.StringVar(&cfg.AppURL, "app-url", envOr("APP_URL", "http://localhost:3000"), "Frontend base URL used in emailed links (APP_URL)")
+	fs.StringVar(&cfg.SMTPAddr, "smtp-addr", envOr("SMTP_ADDR", ""), "SMTP server host:port, emails are logged if empty (SMTP_ADDR)")
+	fs.StringVar(&cfg.SMTPUser, "smtp-user", envOr("SMTP_USER", ""), "SMTP username (SMTP_USER)")
+	fs.StringVar(&cfg.SMTPPassword, "smtp-password", envOr("SMTP_PASSWORD", ""), "SMTP password (SMTP_PASSWORD)")
+	fs.StringVar(&cfg.SMTPFrom, "smtp-from", envOr("SMTP_FROM", "no-reply@localhost"), "Sender address of outgoing email (SMTP_FROM)")
+	fs.BoolVar(&cfg.RequireEmailVerification, "require-email-verification", envOr("REQUIRE_EMAIL_VERIFICATION", "") == "true", "Require an email at signup and its verification before logging in (REQUIRE_EMAIL_VERIFICATION)")
+	fs.BoolVar(&cfg.AuthCookies, "auth-cookies", envOr("AUTH_COOKIES", "") == "true", "Also hand out tokens in HttpOnly cookies, requiring a CSRF token on state-changing requests they authenticate (AUTH_COOKIES)")
+	fs.StringVar(&cfg.PasswordAlgo, "password-algo", envOr("PASSWORD_ALGO", store.PasswordArgon2id), "Algorithm new password hashes use: argon2id or bcrypt (PASSWORD_ALGO)")
+	fs.IntVar(&cfg.Argon2MemoryKiB, "argon2-memory-kib", envIntOr("ARGON2_MEMORY_KIB", int(auth.DefaultArgon2Params.Memory)), "Memory in KiB an Argon2id hash takes (ARGON2_MEMORY_KIB)")
+	fs.IntVar(&cfg.Argon2Iterations, "argon2-iterations", envIntOr("ARGON2_ITERATIONS", int(auth.DefaultArgon2Params.Iterations)), "Passes an Argon2id hash makes over its memory (ARGON2_ITERATIONS)")
+	fs.IntVar(&cfg.Argon2Parallelism, "argon2-parallelism", envIntOr("ARGON2_PARALLELISM", int(auth.DefaultArgon2Params.Parallelism)), "Threads an Argon2id hash uses, up to 255 (ARGON2_PARALLELISM)")
+	fs.StringVar(&cfg.FCMCredentialsFile, "fcm-credentials-file", envOr("FCM_CREDENTIALS_FILE", ""), "Firebase service account JSON file (FCM_CREDENTIALS_FILE)")
+	fs.StringVar(&cfg.APNSKeyFile, "apns-key-file", envOr("APNS_KEY_FILE", ""), "APNs .p8 signing key file (APNS_KEY_FILE)")
+	fs.StringVar(&cfg.APNSKeyID, "apns-key-id", envOr("APNS_KEY_ID", ""), "APNs signing key ID (APNS_KEY_ID)")
+	fs.StringVar(&cfg.APNSTeamID, "apns-team-id", envOr("APNS_TEAM_ID", ""), "Apple developer team ID (APNS_TEAM_ID)")
+	fs.StringVar(&cfg.APNSTopic, "apns-topic", envOr("APNS_TOPIC", ""), "iOS app bundle ID (APNS_TOPIC)")
+	fs.BoolVar(&cfg.APNSProduction, "apns-production", envOr("APNS_PRODUCTION", "") == "true", "Use the production APNs environment (APNS_PRODUCTION)")
+	fs.StringVar(&cfg.VAPIDPrivateKey, "vapid-private-key", envOr("VAPID_PRIVATE_KEY", ""), "Base64url VAPID private key for Web Push (VAPID_PRIVATE_KEY)")
+	fs.StringVar(&cfg.VAPIDSubject, "vapid-subject", envOr("VAPID_SUBJECT", "mailto:admin@localhost"), "VAPID contact URL (VAPID_SUBJECT)")
+	fs.StringVar(&cfg.ContentFilterWordlist, "content-filter-wordlist", envOr("CONTENT_FILTER_WORDLIST", ""), "File of words to filter, one per line (CONTENT_FILTER_WORDLIST)")
+	fs.StringVar(&cfg.ModerationAPIURL, "moderation-api-url", envOr("MODERATION_API_URL", ""), "External moderation API endpoint (MODERATION_API_URL)")
+	fs.StringVar(&cfg.ContentFilterStrictness, "content-filter-strictness", envOr("CONTENT_FILTER_STRICTNESS", "medium"), "Default content filter strictness: off, low, medium or high (CONTENT_FILTER_STRICTNESS)")
+	fs.IntVar(&cfg.UsernameMinLength, "username-min-length", envIntOr("USERNAME_MIN_LENGTH", 3), "Fewest characters a username may have (USERNAME_MIN_LENGTH)")
+	fs.IntVar(&cfg.UsernameMaxLength, "username-max-length", envIntOr("USERNAME_MAX_LENGTH", usernames.MaxLength), "Most characters a username may have, up to 50 (USERNAME_MAX_LENGTH)")
+	fs.StringVar(&cfg.UsernamePattern, "username-pattern", envOr("USERNAME_PATTERN", usernames.DefaultPattern), "Regular expression usernames must match in full (USERNAME_PATTERN)")
+	fs.StringVar(&usernameReserved, "username-reserved", envOr("USERNAME_RESERVED", strings.Join(usernames.DefaultReserved, ",")), "Comma separated usernames nobody may take, compared ignoring case (USERNAME_RESERVED)")
+	fs.StringVar(&cfg.UsernameBlocklist, "username-blocklist", envOr("USERNAME_BLOCKLIST", ""), "File of words usernames may not contain, one per line (USERNAME_BLOCKLIST)")
+	fs.StringVar(&cfg.EventBroker, "event-broker", envOr("EVENT_BROKER", ""), "Message queue for domain events: kafka, nats or empty for none (EVENT_BROKER)")
+	fs.StringVar(&cfg.EventBrokerURL, "event-broker-url", envOr("EVENT_BROKER_URL", ""), "Comma separated Kafka brokers or a NATS URL (EVENT_BROKER_URL)")
+	fs.StringVar(&cfg.EventTopic, "event-topic", envOr("EVENT_TOPIC", "chat.events"), "Kafka topic or NATS subject prefix of domain events (EVENT_TOPIC)")
+	fs.StringVar(&cfg.AnalyticsSink, "analytics-sink", envOr("ANALYTICS_SINK", ""), "Where usage analytics are sent: file, http or empty for none (ANALYTICS_SINK)")
+	fs.StringVar(&cfg.AnalyticsURL, "analytics-url", envOr("ANALYTICS_URL", ""), "File analytics events are appended to, - for standard output, or the endpoint they are posted to (ANALYTICS_URL)")
+	fs.StringVar(&cfg.AnalyticsKey, "analytics-key", envOr("ANALYTICS_KEY", ""), "Secret key users' analytics pseudonyms are derived with (ANALYTICS_KEY)")
+	fs.StringVar(&cfg.OTLPEndpoint, "otlp-endpoint", envOr("OTEL_EXPORTER_OTLP_ENDPOINT", ""), "OTLP/HTTP collector URL traces are exported to, empty to disable tracing (OTEL_EXPORTER_OTLP_ENDPOINT)")
+	fs.StringVar(&cfg.OTELServiceName, "otel-service-name", envOr("OTEL_SERVICE_NAME", "chat-backend"), "Service name shown in traces (OTEL_SERVICE_NAME)")
+	fs.Float64Var(&cfg.TraceSampleRatio, "trace-sample-ratio", envFloatOr("TRACE_SAMPLE_RATIO", 1), "Fraction of traces recorded, from 0 to 1 (TRACE_SAMPLE_RATIO)")
+	fs.DurationVar(&cfg.DrainTimeout, "drain-timeout", envDurationOr("DRAIN_TIMEOUT", 15*time.Second), "Graceful shutdown drain timeout (DRAIN_TIMEOUT)")
+
+	if err := fs.Parse(args); err != nil {
+		return nil, err
+	}
+
+	cfg.DBReplicas = splitList(dbReplicas)
+	cfg.CORSOrigins = splitList(corsOrigins)
+	cfg.CORSMethods = splitList(corsMethods)
+	cfg.CORSHeaders = splitList(corsHeaders)
+	cfg.TrustedProxies = splitList(trustedProxies)
+	cfg.IPAllowlist = splitList(ipAllowlist)
+	cfg.IPDenylist = splitList(ipDenylist)
+	cfg.GeoIPAllowCountries = splitList(allowCountries)
+	cfg.GeoIPDenyCountries = splitList(denyCountries)
+	cfg.UsernameReserved = splitList(usernameReserved)
+
+	if err := cfg.validate(); err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+// validate reports the first invalid setting.
+func (cfg *Config) validate() error {
+	switch {
+	case cfg.JWTSecret == "":
+		return errors.New("JWT_SECRET must be set")
+	case cfg.JWTSecret == "change-me-in-production":
+		return errors.New("JWT_SECRET must be changed from the example value")
+	case cfg.StoreBackend != storePostgres && cfg.StoreBackend != storeMemory && cfg.StoreBackend != storeSQLite:
+		return fmt.Errorf("invalid STORE_BACKEND %q, expected postgres, memory or sqlite", cfg.StoreBackend)
+	case cfg.StoreBackend == storeSQLite && cfg.SQLitePath == "":
+		return errors.New("SQLITE_PATH must not be empty")
+	case cfg.DBHost == "" || cfg.DBUser == "" || cfg.DBName == "":
+		return errors.New("DB_HOST, DB_USER and DB_NAME must not be empty")
+	case cfg.DBPort <= 0 || cfg.DBPort > 65535:
+		return fmt.Errorf("invalid DB_PORT %d", cfg.DBPort)
+	case cfg.DBMaxOpenConns < 0 || cfg.DBMaxIdleConns < 0:
+		return errors.New("DB_MAX_OPEN_CONNS and DB_MAX_IDLE_CONNS must not be negative")
+	case cfg.DBMaxOpenConns > 0 && cfg.DBMaxIdleConns > cfg.DBMaxOpenConns:
+		return errors.New("DB_MAX_IDLE_CONNS must not exceed DB_MAX_OPEN_CONNS")
+	case cfg.DBConnMaxLifetime < 0 || cfg.DBQueryTimeout < 0:
+		return errors.New("DB_CONN_MAX_LIFETIME and DB_QUERY_TIMEOUT must not be negative")
+	case cfg.DBStatementCacheSize < 0:
+		return fmt.Errorf("invalid DB_STATEMENT_CACHE_SIZE %d", cfg.DBStatementCacheSize)
+	case cfg.DBReplicaMaxLag <= 0:
+		return fmt.Errorf("invalid DB_REPLICA_MAX_LAG %s", cfg.DBReplicaMaxLag)
+	case cfg.Migrate != migrateAuto && cfg.Migrate != migrateUp && cfg.Migrate != migrateDown && cfg.Migrate != migrateOff:
+		return fmt.Errorf("invalid MIGRATE %q, expected auto, up, down or off", cfg.Migrate)
+	case cfg.MigrateSteps <= 0:
+		return fmt.Errorf("invalid MIGRATE_STEPS %d", cfg.MigrateSteps)
+	case cfg.RedisAddr == "":
+		return errors.New("REDIS_ADDR must not be empty")
+	case cfg.PubSubBackend != pubsub.BackendRedis && cfg.PubSubBackend != pubsub.BackendPostgres:
+		return fmt.Errorf("invalid PUBSUB_BACKEND %q, expected redis or postgres", cfg.PubSubBackend)
+	case cfg.PubSubBackend == pubsub.BackendPostgres && cfg.StoreBackend != storePostgres:
+		return errors.New("PUBSUB_BACKEND=postgres requires STORE_BACKEND=postgres")
+	case cfg.ListenAddr == "":
+		return errors.New("LISTEN_ADDR must not be empty")
+	case len(cfg.CORSOrigins) == 0:
+		return errors.New("CORS_ORIGINS must list at least one origin")
+	case len(cfg.CORSOrigins) > 1 && slices.Contains(cfg.CORSOrigins, "*"):
+		return errors.New("CORS_ORIGINS must not list other origins alongside *")
+	case len(cfg.CORSMethods) == 0:
+		return errors.New("CORS_METHODS must list at least one method")
+	case cfg.CORSMaxAge < 0:
+		return fmt.Errorf("invalid CORS_MAX_AGE %s", cfg.CORSMaxAge)
+	case cfg.WSPingInterval < 0 || cfg.WSPongWait < 0:
+		return errors.New("WS_PING_INTERVAL and WS_PONG_WAIT must not be negative")
+	case cfg.WSSendBuffer <= 0:
+		return fmt.Errorf("invalid WS_SEND_BUFFER %d", cfg.WSSendBuffer)
+	case cfg.WSSlowClientPolicy != ws.PolicyDisconnect && cfg.WSSlowClientPolicy != ws.PolicyDrop:
+		return fmt.Errorf("invalid WS_SLOW_CLIENT_POLICY %q, expected disconnect or drop", cfg.WSSlowClientPolicy)
+	case cfg.GzipMinBytes < 0:
+		return fmt.Errorf("invalid GZIP_MIN_BYTES %d", cfg.GzipMinBytes)
+	case cfg.BlobStore != blob.BackendLocal && cfg.BlobStore != blob.BackendS3:
+		return fmt.Errorf("invalid BLOB_STORE %q, expected local or s3", cfg.BlobStore)
+	case cfg.BlobStore == blob.BackendS3 && (cfg.S3Bucket == "" || cfg.S3Region == "" || cfg.S3AccessKeyID == "" || cfg.S3SecretAccessKey == ""):
+		return errors.New("S3_BUCKET, S3_REGION, S3_ACCESS_KEY_ID and S3_SECRET_ACCESS_KEY must be set with BLOB_STORE=s3")
+	case cfg.PresignExpiry <= 0 || cfg.PresignExpiry > blob.MaxPresignExpiry:
+		return fmt.Errorf("invalid PRESIGN_EXPIRY %s, expected up to 7 days", cfg.PresignExpiry)
+	case cfg.MaxUploadBytes <= 0:
+		return fmt.Errorf("invalid MAX_UPLOAD_BYTES %d", cfg.MaxUploadBytes)
+	case cfg.MediaWorkers < 0:
+		return fmt.Errorf("invalid MEDIA_WORKERS %d", cfg.MediaWorkers)
+	case cfg.MessageQuota < 0 || cfg.StorageQuotaBytes < 0:
+		return errors.New("MESSAGE_QUOTA and STORAGE_QUOTA_BYTES must not be negative")
+	case cfg.MessageRetentionDays < 0:
+		return fmt.Errorf("invalid MESSAGE_RETENTION_DAYS %d", cfg.MessageRetentionDays)
+	case cfg.MessageRetentionMode != retentionDrop && cfg.MessageRetentionMode != retentionArchive:
+		return fmt.Errorf("invalid MESSAGE_RETENTION_MODE %q, expected drop or archive", cfg.MessageRetentionMode)
+	case cfg.MessageCacheSize < 0:
+		return fmt.Errorf("invalid MESSAGE_CACHE_SIZE %d", cfg.MessageCacheSize)
+	case cfg.MaxMessageLength <= 0:
+		return fmt.Errorf("invalid MAX_MESSAGE_LENGTH %d", cfg.MaxMessageLength)
+	case cfg.APNSKeyFile != "" && (cfg.APNSKeyID == "" || cfg.APNSTeamID == "" || cfg.APNSTopic == ""):
+		return errors.New("APNS_KEY_ID, APNS_TEAM_ID and APNS_TOPIC must be set with APNS_KEY_FILE")
+	case !validStrictness(cfg.ContentFilterStrictness):
+		return fmt.Errorf("invalid CONTENT_FILTER_STRICTNESS %q, expected off, low, medium or high", cfg.ContentFilterStrictness)
+	case cfg.EventBroker != "" && cfg.EventBroker != events.BrokerKafka && cfg.EventBroker != events.BrokerNATS:
+		return fmt.Errorf("invalid EVENT_BROKER %q, expected kafka or nats", cfg.EventBroker)
+	case cfg.EventBroker != "" && (cfg.EventBrokerURL == "" || cfg.EventTopic == ""):
+		return errors.New("EVENT_BROKER_URL and EVENT_TOPIC must be set with EVENT_BROKER")
+	case cfg.AnalyticsSink != "" && cfg.AnalyticsSink != analytics.SinkFile && cfg.AnalyticsSink != analytics.SinkHTTP:
+		return fmt.Errorf("invalid ANALYTICS_SINK %q, expected file or http", cfg.AnalyticsSink)
+	case cfg.AnalyticsSink != "" && cfg.AnalyticsURL == "":
+		return errors.New("ANALYTICS_URL must be set with ANALYTICS_SINK")
+	case cfg.AnalyticsSink != "" && len(cfg.AnalyticsKey) < minAnalyticsKeyLength:
+		return fmt.Errorf("ANALYTICS_KEY of at least %d characters must be set with ANALYTICS_SINK", minAnalyticsKeyLength)
+	case cfg.OTLPEndpoint != "" && cfg.OTELServiceName == "":
+		return errors.New("OTEL_SERVICE_NAME must be set with OTEL_EXPORTER_OTLP_ENDPOINT")
+	case cfg.TraceSampleRatio < 0 || cfg.TraceSampleRatio > 1:
+		return fmt.Errorf("invalid TRACE_SAMPLE_RATIO %g, expected 0 to 1", cfg.TraceSampleRatio)
+	case cfg.DrainTimeout <= 0:
+		return fmt.Errorf("invalid DRAIN_TIMEOUT %s", cfg.DrainTimeout)
+	}
+
+	if _, err := cfg.replicaConnStrings(); err != nil {
+		return err
+	}
+	for _, origin := range cfg.CORSOrigins {
+		if err := api.ValidateOrigin(origin); err != nil {
+			return fmt.Errorf("invalid CORS_ORIGINS: %v", err)
+		}
+	}
+	for _, proxy := range cfg.TrustedProxies {
+		if _, _, err := net.ParseCIDR(proxy); err != nil && net.ParseIP(proxy) == nil {
+			return fmt.Errorf("invalid TRUSTED_PROXIES entry %q, expected an IP or CIDR range", proxy)
+		}
+	}
+	if _, err := cfg.ipFilter(); err != nil {
+		return fmt.Errorf("invalid IP filter: %v", err)
+	}
+	if _, err := usernames.New(cfg.usernameConfig(nil)); err != nil {
+		return fmt.Errorf("invalid username policy: %v", err)
+	}
+	if _, err := cfg.passwordHasher(); err != nil {
+		return fmt.Errorf("invalid password hashing: %v", err)
+	}
+	return nil
+}
+
+// postgresConnString returns the connection string for the server, without
+// selecting a database.
+func (cfg *Config) postgresConnString() string {
+	return fmt.Sprintf("host=%s port=%d user=%s password=%s sslmode=disable",
+		cfg.DBHost, cfg.DBPort, quoteConnValue(cfg.DBUser), quoteConnValue(cfg.DBPassword))
+}
+
+// replicaConnStrings returns the connection string of each read replica,
+// selecting the database.
+func (cfg *Config) replicaConnStrings() ([]string, error) {
+	var connStrs []string
+	for _, addr := range cfg.DBReplicas {
+		host, port := addr, cfg.DBPort
+		if h, p, err := net.SplitHostPort(addr); err == nil {
+			n, err := strconv.Atoi(p)
+			if err != nil || n <= 0 || n > 65535 {
+				return nil, fmt.Errorf("invalid port in DB_REPLICAS entry %q", addr)
+			}
+			host, port = h, n
+		}
+		if host == "" {
+			return nil, fmt.Errorf("invalid DB_REPLICAS entry %q", addr)
+		}
+		connStrs = append(connStrs, fmt.Sprintf("host=%s port=%d user=%s password=%s sslmode=disable dbname=%s",
+			quoteConnValue(host), port, quoteConnValue(cfg.DBUser), quoteConnValue(cfg.DBPassword), quoteConnValue(cfg.DBName)))
+	}
+	return connStrs, nil
+}
+
+// poolConfig returns the database connection pool settings.
+func (cfg *Config) poolConfig() postgres.PoolConfig {
+	return postgres.PoolConfig{
+		MaxOpenConns:       cfg.DBMaxOpenConns,
+		MaxIdleConns:       cfg.DBMaxIdleConns,
+		ConnMaxLifetime:    cfg.DBConnMaxLifetime,
+		QueryTimeout:       cfg.DBQueryTimeout,
+		StatementCacheSize: cfg.DBStatementCacheSize,
+	}
+}
+
+// emailSender returns the SMTP sender if one is configured, or a sender that
+// logs emails otherwise.
+func (cfg *Config) emailSender() email.Sender {
+	if cfg.SMTPAddr == "" {
+		return email.LogSender{}
+	}
+	return email.SMTPSender{
+		Addr:     cfg.SMTPAddr,
+		From:     cfg.SMTPFrom,
+		Username: cfg.SMTPUser,
+		Password: cfg.SMTPPassword,
+	}
+}
+
+// blobConfig returns where attachment files are stored.
+func (cfg *Config) blobConfig() blob.Config {
+	return blob.Config{
+		Backend: cfg.BlobStore,
+		Dir:     cfg.UploadDir,
+		S3: blob.S3Config{
+			Endpoint:        cfg.S3Endpoint,
+			Region:          cfg.S3Region,
+			Bucket:          cfg.S3Bucket,
+			AccessKeyID:     cfg.S3AccessKeyID,
+			SecretAccessKey: cfg.S3SecretAccessKey,
+			PathStyle:       cfg.S3PathStyle,
+		},
+	}
+}
+
+// pushConfig returns the push notification provider credentials.
+func (cfg *Config) pushConfig() push.Config {
+	return push.Config{
+		FCMCredentialsFile: cfg.FCMCredentialsFile,
+		APNSKeyFile:        cfg.APNSKeyFile,
+		APNSKeyID:          cfg.APNSKeyID,
+		APNSTeamID:         cfg.APNSTeamID,
+		APNSTopic:          cfg.APNSTopic,
+		APNSProduction:     cfg.APNSProduction,
+		VAPIDPrivateKey:    cfg.VAPIDPrivateKey,
+		VAPIDSubject:       cfg.VAPIDSubject,
+	}
+}
+
+// eventsConfig returns the message queue domain events are published to.
+func (cfg *Config) eventsConfig() events.Config {
+	return events.Config{Broker: cfg.EventBroker, URL: cfg.EventBrokerURL, Topic: cfg.EventTopic}
+}
+
+// analyticsConfig returns the sink usage analytics are sent to.
+func (cfg *Config) analyticsConfig() analytics.Config {
+	return analytics.Config{Sink: cfg.AnalyticsSink, URL: cfg.AnalyticsURL}
+}
+
+// tracingConfig returns where and how traces are exported.
+func (cfg *Config) tracingConfig() tracing.Config {
+	return tracing.Config{Endpoint: cfg.OTLPEndpoint, ServiceName: cfg.OTELServiceName, SampleRatio: cfg.TraceSampleRatio}
+}
+
+// validStrictness reports whether s names a content filter strictness.
+func validStrictness(s string) bool {
+	_, err := moderation.ParseStrictness(s)
+	return err == nil
+}
+
+// contentFilter builds the content filter pipeline from the configured
+// wordlist and moderation API, and returns the default strictness.
+func (cfg *Config) contentFilter() (*moderation.Pipeline, moderation.Strictness, error) {
+	strictness, err := moderation.ParseStrictness(cfg.ContentFilterStrictness)
+	if err != nil {
+		return nil, moderation.Off, err
+	}
+
+	var filters []moderation.Filter
+	if cfg.ContentFilterWordlist != "" {
+		wordlist, err := moderation.LoadWordlist(cfg.ContentFilterWordlist)
+		if err != nil {
+			return nil, moderation.Off, err
+		}
+		filters = append(filters, wordlist)
+	}
+	if cfg.ModerationAPIURL != "" {
+		filters = append(filters, moderation.NewAPI(cfg.ModerationAPIURL))
+	}
+	return moderation.NewPipeline(filters...), strictness, nil
+}
+
+// ipFilter returns the filter of IP_ALLOWLIST, IP_DENYLIST and the GeoIP
+// settings.
+func (cfg *Config) ipFilter() (*ipfilter.Filter, error) {
+	return ipfilter.New(ipfilter.Config{
+		Allow:          cfg.IPAllowlist,
+		Deny:           cfg.IPDenylist,
+		CountryHeader:  cfg.GeoIPCountryHeader,
+		TrustedProxies: cfg.TrustedProxies,
+		AllowCountries: cfg.GeoIPAllowCountries,
+		DenyCountries:  cfg.GeoIPDenyCountries,
+	})
+}
+
+// usernamePolicy builds the username policy, reading the blocklist file if
+// one is configured.
+func (cfg *Config) usernamePolicy() (*usernames.Policy, error) {
+	var blocklist []string
+	if cfg.UsernameBlocklist != "" {
+		var err error
+		if blocklist, err = moderation.ReadWords(cfg.UsernameBlocklist); err != nil {
+			return nil, err
+		}
+	}
+	return usernames.New(cfg.usernameConfig(blocklist))
+}
+
+// usernameConfig returns the username policy configuration with the given
+// blocked words.
+func (cfg *Config) usernameConfig(blocklist []string) usernames.Config {
+	return usernames.Config{
+		MinLength: cfg.UsernameMinLength,
+		MaxLength: cfg.UsernameMaxLength,
+		Pattern:   cfg.UsernamePattern,
+		Reserved:  cfg.UsernameReserved,
+		Blocklist: blocklist,
+	}
+}
+
+// passwordHasher returns the hasher of PASSWORD_ALGO and the Argon2id
+// parameters.
+func (cfg *Config) passwordHasher() (*auth.Hasher, error) {
+	if cfg.Argon2MemoryKiB < 0 || cfg.Argon2Iterations < 0 || cfg.Argon2Parallelism < 0 || cfg.Argon2Parallelism > 255 {
+		return nil, fmt.Errorf("Argon2id parameters out of range m=%d t=%d p=%d", cfg.Argon2MemoryKiB, cfg.Argon2Iterations, cfg.Argon2Parallelism)
+	}
+	return auth.NewHasher(cfg.PasswordAlgo, auth.Argon2Params{
+		Memory:      uint32(cfg.Argon2MemoryKiB),
+		Iterations:  uint32(cfg.Argon2Iterations),
+		Parallelism: uint8(cfg.Argon2Parallelism),
+	})
+}
+
+// quoteConnValue quotes a value for use in a key=value connection string.
+func quoteConnValue(v string) string {
+	v = strings.ReplaceAll(v, `\`, `\\`)
+	v = strings.ReplaceAll(v, `'`, `\'`)
+	return "'" + v + "'"
+}
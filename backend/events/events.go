@@ -0,0 +1,187 @@
+// Package events publishes domain events, such as sent messages and votes,
+// to a message queue so analytics pipelines and other services can consume
+// them without calling the chat API.
+package events
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"backend/metrics"
+)
+
+// Event types.
+const (
+	MessageSent = "message.sent"
+	VoteCast    = "vote.cast"
+	UserOnline  = "user.online"
+	UserOffline = "user.offline"
+)
+
+// Brokers an event stream can publish to.
+const (
+	BrokerKafka = "kafka"
+	BrokerNATS  = "nats"
+)
+
+// Stream settings. Events wait in a queue of queueSize while they are
+// published; when it is full new events are dropped rather than slowing
+// down the request that caused them.
+const (
+	queueSize      = 1024
+	publishTimeout = 5 * time.Second
+	drainTimeout   = 5 * time.Second
+)
+
+// Event is a domain event as published, encoded as JSON.
+type Event struct {
+	// ID identifies the event, so consumers can drop duplicates.
+	ID        string    `json:"id"`
+	Type      string    `json:"type"`
+	CreatedAt time.Time `json:"created_at"`
+	// Key groups related events, such as those of one conversation, so
+	// brokers that partition keep them in order.
+	Key  string      `json:"key"`
+	Data interface{} `json:"data"`
+}
+
+// Vote is the data of a vote.cast event.
+type Vote struct {
+	MessageID string `json:"message_id"`
+	Voter     string `json:"voter"`
+	Upvotes   int    `json:"upvotes"`
+	Downvotes int    `json:"downvotes"`
+}
+
+// Presence is the data of user.online and user.offline events.
+type Presence struct {
+	Username string     `json:"username"`
+	LastSeen *time.Time `json:"last_seen,omitempty"`
+}
+
+// ConversationKey returns the key of events in the conversation between a
+// and b, the same whichever of them is first.
+func ConversationKey(a, b string) string {
+	if b < a {
+		a, b = b, a
+	}
+	return a + ":" + b
+}
+
+// Publisher publishes events to a message queue.
+type Publisher interface {
+	Publish(ctx context.Context, e Event) error
+	// Close flushes buffered events and disconnects.
+	Close() error
+}
+
+// Config selects the broker events are published to.
+type Config struct {
+	// Broker is kafka, nats or empty to publish nothing.
+	Broker string
+	// URL is a comma separated list of Kafka brokers, or a NATS server URL.
+	URL string
+	// Topic is the Kafka topic, or the NATS subject prefix: events are
+	// published to <topic>.<event type>.
+	Topic string
+}
+
+// New connects to the broker cfg selects. It returns a nil Publisher if no
+// broker is configured.
+func New(cfg Config) (Publisher, error) {
+	switch cfg.Broker {
+	case "":
+		return nil, nil
+	case BrokerKafka:
+		return NewKafka(strings.Split(cfg.URL, ","), cfg.Topic), nil
+	case BrokerNATS:
+		n, err := NewNATS(cfg.URL, cfg.Topic)
+		if err != nil {
+			return nil, err
+		}
+		return n, nil
+	}
+	return nil, fmt.Errorf("unknown event broker %q, expected %s or %s", cfg.Broker, BrokerKafka, BrokerNATS)
+}
+
+// Stream queues events and publishes them in the background, so a slow or
+// unreachable broker never delays the request that caused an event.
+type Stream struct {
+	publisher Publisher
+	queue     chan Event
+}
+
+// NewStream creates a Stream publishing to p. With a nil p events are
+// discarded.
+func NewStream(p Publisher) *Stream {
+	return &Stream{publisher: p, queue: make(chan Event, queueSize)}
+}
+
+// Emit queues an event of eventType. key groups it with related events.
+func (s *Stream) Emit(eventType, key string, data interface{}) {
+	if s.publisher == nil {
+		return
+	}
+
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		log.Printf("Error generating %s event ID: %v", eventType, err)
+		return
+	}
+
+	e := Event{ID: hex.EncodeToString(id), Type: eventType, CreatedAt: time.Now().UTC(), Key: key, Data: data}
+	select {
+	case s.queue <- e:
+	default:
+		metrics.EventsPublished.WithLabelValues("dropped").Inc()
+	}
+}
+
+// Run publishes queued events until ctx is done, then publishes what is
+// still queued for up to drainTimeout and closes the publisher.
+func (s *Stream) Run(ctx context.Context) {
+	if s.publisher == nil {
+		return
+	}
+
+	for {
+		select {
+		case e := <-s.queue:
+			s.publish(context.Background(), e)
+		case <-ctx.Done():
+			s.drain()
+			return
+		}
+	}
+}
+
+// drain publishes the queued events and closes the publisher.
+func (s *Stream) drain() {
+	ctx, cancel := context.WithTimeout(context.Background(), drainTimeout)
+	defer cancel()
+
+	for len(s.queue) > 0 && ctx.Err() == nil {
+		s.publish(ctx, <-s.queue)
+	}
+	if err := s.publisher.Close(); err != nil {
+		log.Printf("Error closing event publisher: %v", err)
+	}
+}
+
+// publish publishes one event, logging failures.
+func (s *Stream) publish(ctx context.Context, e Event) {
+	ctx, cancel := context.WithTimeout(ctx, publishTimeout)
+	defer cancel()
+
+	if err := s.publisher.Publish(ctx, e); err != nil {
+		log.Printf("Error publishing %s event: %v", e.Type, err)
+		metrics.EventsPublished.WithLabelValues("failed").Inc()
+		return
+	}
+	metrics.EventsPublished.WithLabelValues("published").Inc()
+}
@@ -0,0 +1,44 @@
+package events
+
+import (
+	"context"
+	"encoding/json"
+
+	"github.com/segmentio/kafka-go"
+)
+
+// Kafka publishes events to a Kafka topic, keyed by the event's key and
+// carrying its type in a "type" header.
+type Kafka struct {
+	writer *kafka.Writer
+}
+
+// NewKafka creates a Kafka publisher writing to topic through brokers. It
+// connects on the first event.
+func NewKafka(brokers []string, topic string) *Kafka {
+	return &Kafka{writer: &kafka.Writer{
+		Addr:     kafka.TCP(brokers...),
+		Topic:    topic,
+		Balancer: &kafka.Hash{},
+		// Events are published one at a time, so waiting to fill a batch
+		// would only add latency.
+		BatchSize:    1,
+		RequiredAcks: kafka.RequireOne,
+	}}
+}
+
+func (k *Kafka) Publish(ctx context.Context, e Event) error {
+	body, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	return k.writer.WriteMessages(ctx, kafka.Message{
+		Key:     []byte(e.Key),
+		Value:   body,
+		Headers: []kafka.Header{{Key: "type", Value: []byte(e.Type)}},
+	})
+}
+
+func (k *Kafka) Close() error {
+	return k.writer.Close()
+}
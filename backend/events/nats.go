@@ -0,0 +1,36 @@
+package events
+
+import (
+	"context"
+	"encoding/json"
+
+	"github.com/nats-io/nats.go"
+)
+
+// NATS publishes events to NATS, each to the subject <prefix>.<event type>.
+type NATS struct {
+	conn   *nats.Conn
+	prefix string
+}
+
+// NewNATS connects to the NATS server at url. The client reconnects on its
+// own if the connection drops later.
+func NewNATS(url, prefix string) (*NATS, error) {
+	conn, err := nats.Connect(url, nats.Name("chat-backend"), nats.MaxReconnects(-1))
+	if err != nil {
+		return nil, err
+	}
+	return &NATS{conn: conn, prefix: prefix}, nil
+}
+
+func (n *NATS) Publish(ctx context.Context, e Event) error {
+	body, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	return n.conn.Publish(n.prefix+"."+e.Type, body)
+}
+
+func (n *NATS) Close() error {
+	return n.conn.Drain()
+}
@@ -0,0 +1,380 @@
+package i18n
+
+// spanish translates server messages to Spanish.
+var spanish = map[string]string{
+	// Errors and responses.
+	"Message not found": "Mensaje no encontrado",
+	"You are not a participant of this conversation": "No participas en esta conversación",
+	"Failed to fetch message":                        "No se pudo obtener el mensaje",
+	"Missing receiver":                               "Falta el destinatario",
+	"Invalid request payload":                        "Cuerpo de la solicitud no válido",
+	"Failed to verify password":                      "No se pudo verificar la contraseña",
+	"Old password is incorrect":                      "La contraseña anterior es incorrecta",
+	"Failed to hash password":                        "No se pudo procesar la contraseña",
+	"Failed to update password":                      "No se pudo actualizar la contraseña",
+	"Failed to create session":                       "No se pudo crear la sesión",
+	"Password is incorrect":                          "La contraseña es incorrecta",
+	"New username must be different":                 "El nuevo nombre de usuario debe ser distinto",
+	"Username already taken":                         "El nombre de usuario ya está en uso",
+	"Failed to rename user":                          "No se pudo cambiar el nombre del usuario",
+	"Failed to delete account":                       "No se pudo eliminar la cuenta",
+	"Failed to export account":                       "No se pudo exportar la cuenta",
+	"Failed to fetch usage":                          "No se pudo obtener el uso",
+	"Account deletion scheduled":                     "Eliminación de la cuenta programada",
+	"Invalid or expired token":                       "Token no válido o caducado",
+	"Failed to fetch user":                           "No se pudo obtener el usuario",
+	"Account is banned":                              "La cuenta está bloqueada",
+	"Admin access required":                          "Se requiere acceso de administrador",
+	"Failed to fetch users":                          "No se pudieron obtener los usuarios",
+	"You cannot ban yourself":                        "No puedes bloquear tu propia cuenta",
+	"User not found":                                 "Usuario no encontrado",
+	"Failed to ban user":                             "No se pudo bloquear al usuario",
+	"Failed to unban user":                           "No se pudo desbloquear al usuario",
+	"Failed to delete message":                       "No se pudo eliminar el mensaje",
+	"Failed to fetch stats":                          "No se pudieron obtener las estadísticas",
+	"User banned successfully":                       "Usuario bloqueado correctamente",
+	"User unbanned successfully":                     "Usuario desbloqueado correctamente",
+	"Message deleted successfully":                   "Mensaje eliminado correctamente",
+	"Failed to fetch analytics setting":              "No se pudo obtener la preferencia de analítica",
+	"Failed to save analytics setting":               "No se pudo guardar la preferencia de analítica",
+	"Missing or invalid file":                        "Archivo ausente o no válido",
+	"File exceeds the %d byte limit":                 "El archivo supera el límite de %d bytes",
+	"Failed to read file":                            "No se pudo leer el archivo",
+	"File type %s is not allowed":                    "El tipo de archivo %s no está permitido",
+	"Failed to store file":                           "No se pudo guardar el archivo",
+	"Failed to send message":                         "No se pudo enviar el mensaje",
+	"Direct uploads are not available":               "Las subidas directas no están disponibles",
+	"Missing filename":                               "Falta el nombre del archivo",
+	"Invalid size":                                   "Tamaño no válido",
+	"Failed to create upload":                        "No se pudo crear la subida",
+	"Upload not found or expired":                    "Subida no encontrada o caducada",
+	"Failed to fetch upload":                         "No se pudo obtener la subida",
+	"File has not been uploaded":                     "El archivo no se ha subido",
+	"Uploaded %d bytes instead of %d":                "Se subieron %d bytes en lugar de %d",
+	"File type %s does not match %s":                 "El tipo de archivo %s no coincide con %s",
+	"Attachment not found":                           "Adjunto no encontrado",
+	"Failed to fetch attachment":                     "No se pudo obtener el adjunto",
+	"Thumbnail not found":                            "Miniatura no encontrada",
+	"Failed to fetch thumbnail":                      "No se pudo obtener la miniatura",
+	"Failed to fetch file":                           "No se pudo obtener el archivo",
+	"File not found":                                 "Archivo no encontrado",
+	"Invalid %s, expected an RFC3339 timestamp":      "%s no válido, se esperaba una fecha RFC3339",
+	"Invalid before":                                 "before no válido",
+	"Invalid limit, expected 1 to 1000":              "limit no válido, se esperaba de 1 a 1000",
+	"Failed to fetch audit log":                      "No se pudo obtener el registro de auditoría",
+	"You cannot block yourself":                      "No puedes bloquearte a ti mismo",
+	"Failed to block user":                           "No se pudo bloquear al usuario",
+	"Failed to unblock user":                         "No se pudo desbloquear al usuario",
+	"User is not blocked":                            "El usuario no está bloqueado",
+	"Failed to check block status":                   "No se pudo comprobar el bloqueo",
+	"You cannot message this user":                   "No puedes enviar mensajes a este usuario",
+	"User blocked successfully":                      "Usuario bloqueado correctamente",
+	"User unblocked successfully":                    "Usuario desbloqueado correctamente",
+	"Invalid or rotated bot token":                   "Token de bot no válido o renovado",
+	"Failed to check bot token":                      "No se pudo comprobar el token del bot",
+	"Missing authentication token":                   "Falta el token de autenticación",
+	"Bot access required":                            "Se requiere acceso de bot",
+	"Failed to generate password":                    "No se pudo generar la contraseña",
+	"Failed to generate bot token":                   "No se pudo generar el token del bot",
+	"Failed to create bot":                           "No se pudo crear el bot",
+	"Failed to fetch bots":                           "No se pudieron obtener los bots",
+	"Bot not found":                                  "Bot no encontrado",
+	"Failed to rotate bot token":                     "No se pudo renovar el token del bot",
+	"Failed to fetch bot":                            "No se pudo obtener el bot",
+	"Failed to fetch commands":                       "No se pudieron obtener los comandos",
+	"Invalid command name, expected 1 to 32 lowercase letters, digits, - or _": "Nombre de comando no válido, se esperaban de 1 a 32 letras minúsculas, dígitos, - o _",
+	"Invalid description, expected at most 200 characters":                     "Descripción no válida, se esperaban 200 caracteres como máximo",
+	"Command already registered by another bot":                                "Otro bot ya registró este comando",
+	"Failed to register command":                                               "No se pudo registrar el comando",
+	"Command not found":                                                        "Comando no encontrado",
+	"Failed to delete command":                                                 "No se pudo eliminar el comando",
+	"Bot deleted successfully":                                                 "Bot eliminado correctamente",
+	"Command deleted successfully":                                             "Comando eliminado correctamente",
+	"Channel not found":                                                        "Canal no encontrado",
+	"Failed to fetch channels":                                                 "No se pudieron obtener los canales",
+	"Failed to subscribe to channel":                                           "No se pudo suscribir al canal",
+	"Failed to unsubscribe from channel":                                       "No se pudo cancelar la suscripción al canal",
+	"Not subscribed to channel":                                                "No estás suscrito al canal",
+	"Invalid limit, expected 1 to 200":                                         "limit no válido, se esperaba de 1 a 200",
+	"Failed to fetch channel":                                                  "No se pudo obtener el canal",
+	"Failed to fetch posts":                                                    "No se pudieron obtener las publicaciones",
+	"Only the channel's senders can post to it":                                "Solo los emisores del canal pueden publicar en él",
+	"Invalid name, expected 1 to 64 characters":                                "Nombre no válido, se esperaban de 1 a 64 caracteres",
+	"Description is longer than 500 characters":                                "La descripción supera los 500 caracteres",
+	"Topic is longer than 250 characters":                                      "El tema supera los 250 caracteres",
+	"Visibility must be public or private":                                     "La visibilidad debe ser public o private",
+	"Unknown sender %s":                                                        "Emisor desconocido: %s",
+	"Channel name already taken":                                               "El nombre del canal ya está en uso",
+	"Failed to create channel":                                                 "No se pudo crear el canal",
+	"Failed to delete channel":                                                 "No se pudo eliminar el canal",
+	"Failed to add sender":                                                     "No se pudo añadir el emisor",
+	"Failed to remove sender":                                                  "No se pudo quitar el emisor",
+	"User is not a sender of this channel":                                     "El usuario no es emisor de este canal",
+	"Subscribed successfully":                                                  "Suscripción realizada correctamente",
+	"Unsubscribed successfully":                                                "Suscripción cancelada correctamente",
+	"Channel deleted successfully":                                             "Canal eliminado correctamente",
+	"Sender added successfully":                                                "Emisor añadido correctamente",
+	"Sender removed successfully":                                              "Emisor quitado correctamente",
+	"Your role in this channel does not allow this":                            "Tu rol en este canal no lo permite",
+	"User is not a member of this channel":                                     "El usuario no es miembro de este canal",
+	"Role must be owner, admin or member":                                      "El rol debe ser owner, admin o member",
+	"The channel needs another owner first":                                    "El canal necesita antes otro propietario",
+	"Failed to update channel":                                                 "No se pudo actualizar el canal",
+	"Failed to fetch members":                                                  "No se pudieron obtener los miembros",
+	"Failed to change role":                                                    "No se pudo cambiar el rol",
+	"Failed to remove member":                                                  "No se pudo quitar al miembro",
+	"Post not found":                                                           "Publicación no encontrada",
+	"Failed to delete post":                                                    "No se pudo eliminar la publicación",
+	"Failed to pin post":                                                       "No se pudo fijar la publicación",
+	"Role changed successfully":                                                "Rol cambiado correctamente",
+	"Member removed successfully":                                              "Miembro quitado correctamente",
+	"Post deleted successfully":                                                "Publicación eliminada correctamente",
+	"This invite expired":                                                      "Esta invitación ha caducado",
+	"Invite not found":                                                         "Invitación no encontrada",
+	"Invalid expires_in_seconds, expected 0 to 2592000":                        "expires_in_seconds no válido, se esperaba de 0 a 2592000",
+	"Invalid max_uses, expected 0 to 10000":                                    "max_uses no válido, se esperaba de 0 a 10000",
+	"Failed to generate invite token":                                          "No se pudo generar el token de invitación",
+	"Failed to create invite":                                                  "No se pudo crear la invitación",
+	"Failed to fetch invites":                                                  "No se pudieron obtener las invitaciones",
+	"Failed to revoke invite":                                                  "No se pudo revocar la invitación",
+	"Failed to accept invite":                                                  "No se pudo aceptar la invitación",
+	"Invite revoked successfully":                                              "Invitación revocada correctamente",
+	"Post pinned":                                                              "Publicación fijada",
+	"Post unpinned":                                                            "Publicación desfijada",
+	"Only members of the channel can reply":                                    "Solo los miembros del canal pueden responder",
+	"Only members of the channel can follow its threads":                       "Solo los miembros del canal pueden seguir sus hilos",
+	"Replies must reply to a post of the channel":                              "Las respuestas deben responder a una publicación del canal",
+	"Failed to fetch threads":                                                  "No se pudieron obtener los hilos",
+	"Failed to fetch replies":                                                  "No se pudieron obtener las respuestas",
+	"Failed to mark thread read":                                               "No se pudo marcar el hilo como leído",
+	"Failed to update thread subscription":                                     "No se pudo actualizar la suscripción al hilo",
+	"Thread marked as read":                                                    "Hilo marcado como leído",
+	"Subscribed to thread":                                                     "Suscrito al hilo",
+	"Unsubscribed from thread":                                                 "Suscripción al hilo cancelada",
+	"Missing or invalid CSRF token":                                            "Token CSRF ausente o no válido",
+	"Only the sender can delete a message for everyone":                        "Solo el remitente puede eliminar un mensaje para todos",
+	"Invalid scope, must be 'me' or 'everyone'":                                "scope no válido, debe ser 'me' o 'everyone'",
+	"Platform must be fcm, apns or webpush":                                    "La plataforma debe ser fcm, apns o webpush",
+	"Missing token":                                                            "Falta el token",
+	"Failed to register device":                                                "No se pudo registrar el dispositivo",
+	"Failed to unregister device":                                              "No se pudo dar de baja el dispositivo",
+	"Device not found":                                                         "Dispositivo no encontrado",
+	"Failed to fetch preferences":                                              "No se pudieron obtener las preferencias",
+	"Invalid quiet_hours":                                                      "quiet_hours no válido",
+	"Failed to update preferences":                                             "No se pudieron actualizar las preferencias",
+	"Quiet hours start and end must be times like 22:00":                       "El inicio y el fin de las horas de silencio deben ser horas como 22:00",
+	"Quiet hours must not start and end at the same time":                      "Las horas de silencio no pueden empezar y terminar a la misma hora",
+	"Unknown time zone %s":                                                     "Zona horaria desconocida: %s",
+	"Failed to fetch mutes":                                                    "No se pudieron obtener las conversaciones silenciadas",
+	"duration_seconds must be between 0 and 31536000":                          "duration_seconds debe estar entre 0 y 31536000",
+	"Failed to mute conversation":                                              "No se pudo silenciar la conversación",
+	"Failed to unmute conversation":                                            "No se pudo reactivar el sonido de la conversación",
+	"Conversation is not muted":                                                "La conversación no está silenciada",
+	"Web Push is not configured":                                               "Web Push no está configurado",
+	"Device unregistered successfully":                                         "Dispositivo dado de baja correctamente",
+	"Conversation unmuted successfully":                                        "Se reactivó el sonido de la conversación",
+	"Failed to fetch disappearing messages setting":                            "No se pudo obtener la configuración de mensajes temporales",
+	"ttl_seconds must be between 0 and 2419200":                                "ttl_seconds debe estar entre 0 y 2419200",
+	"Failed to update disappearing messages setting":                           "No se pudo actualizar la configuración de mensajes temporales",
+	"Draft not found":                                                          "Borrador no encontrado",
+	"Failed to fetch draft":                                                    "No se pudo obtener el borrador",
+	"Draft exceeds the %d byte limit":                                          "El borrador supera el límite de %d bytes",
+	"Failed to delete draft":                                                   "No se pudo eliminar el borrador",
+	"Failed to save draft":                                                     "No se pudo guardar el borrador",
+	"Draft deleted":                                                            "Borrador eliminado",
+	"Invalid or expired verification token":                                    "Token de verificación no válido o caducado",
+	"Failed to verify email":                                                   "No se pudo verificar el correo electrónico",
+	"Email verified successfully":                                              "Correo electrónico verificado correctamente",
+	"If an unverified account with that email exists, a verification link has been sent": "Si existe una cuenta sin verificar con ese correo, se ha enviado un enlace de verificación",
+	"Invalid typing event":                                             "Evento de escritura no válido",
+	"Invalid read receipt":                                             "Confirmación de lectura no válida",
+	"Failed to update message status":                                  "No se pudo actualizar el estado del mensaje",
+	"Format must be json or csv":                                       "El formato debe ser json o csv",
+	"Invalid request body":                                             "Cuerpo de la solicitud no válido",
+	"Failed to fetch conversations":                                    "No se pudieron obtener las conversaciones",
+	"Failed to fetch presence":                                         "No se pudo obtener la presencia",
+	"Failed to fetch status":                                           "No se pudo obtener el estado",
+	"Invalid last, expected 1 to 100":                                  "last no válido, se esperaba de 1 a 100",
+	"Invalid cursor":                                                   "Cursor no válido",
+	"Failed to fetch messages":                                         "No se pudieron obtener los mensajes",
+	"Internal server error":                                            "Error interno del servidor",
+	"Invalid username or password":                                     "Nombre de usuario o contraseña incorrectos",
+	"Missing refresh token":                                            "Falta el token de renovación",
+	"Failed to log out":                                                "No se pudo cerrar la sesión",
+	"Too many messages, please slow down":                              "Demasiados mensajes, ve más despacio",
+	"Missing peer":                                                     "Falta el interlocutor",
+	"Invalid limit":                                                    "limit no válido",
+	"Missing request":                                                  "Falta la solicitud",
+	"Hook not found":                                                   "Hook no encontrado",
+	"Failed to fetch hook":                                             "No se pudo obtener el hook",
+	"Invalid payload":                                                  "Contenido no válido",
+	"Missing text":                                                     "Falta el texto",
+	"Invalid name, expected 1 to 100 characters":                       "Nombre no válido, se esperaban de 1 a 100 caracteres",
+	"Unknown bot %s":                                                   "Bot desconocido: %s",
+	"Receiver not found":                                               "Destinatario no encontrado",
+	"Failed to fetch receiver":                                         "No se pudo obtener el destinatario",
+	"Failed to generate hook token":                                    "No se pudo generar el token del hook",
+	"Failed to create hook":                                            "No se pudo crear el hook",
+	"Failed to fetch hooks":                                            "No se pudieron obtener los hooks",
+	"Failed to delete hook":                                            "No se pudo eliminar el hook",
+	"Hook deleted successfully":                                        "Hook eliminado correctamente",
+	"Access is not allowed from your network or location":              "No se permite el acceso desde tu red o ubicación",
+	"Failed to fetch locale":                                           "No se pudo obtener el idioma",
+	"Unsupported locale %q, expected one of %s":                        "Idioma %q no disponible, se esperaba uno de %s",
+	"Failed to save locale":                                            "No se pudo guardar el idioma",
+	"Failed to fetch lockout":                                          "No se pudo obtener el bloqueo de inicio de sesión",
+	"Failed to unlock account":                                         "No se pudo desbloquear la cuenta",
+	"Failed to unlock address":                                         "No se pudo desbloquear la dirección",
+	"Account unlocked successfully":                                    "Cuenta desbloqueada correctamente",
+	"Address unlocked successfully":                                    "Dirección desbloqueada correctamente",
+	"Invalid offset":                                                   "offset no válido",
+	"Failed to fetch mentions":                                         "No se pudieron obtener las menciones",
+	"Invalid delivered event":                                          "Evento de entrega no válido",
+	"Unsupported event type %q":                                        "Tipo de evento %q no admitido",
+	"Message was rejected by the content filter":                       "El filtro de contenido rechazó el mensaje",
+	"Missing content":                                                  "Falta el contenido",
+	"Content is longer than %d characters":                             "El contenido supera los %d caracteres",
+	"format must be plain or markdown":                                 "format debe ser plain o markdown",
+	"send_at must be in the future":                                    "send_at debe ser una fecha futura",
+	"Daily message quota exceeded":                                     "Se superó la cuota diaria de mensajes",
+	"Storage quota exceeded":                                           "Se superó la cuota de almacenamiento",
+	"Invalid message":                                                  "Mensaje no válido",
+	"Invalid message: %s must be a %s":                                 "Mensaje no válido: %s debe ser de tipo %s",
+	"Missing messages":                                                 "Faltan los mensajes",
+	"A batch may have at most %d messages":                             "Un lote puede tener %d mensajes como máximo",
+	"Invalid since, expected an RFC3339 timestamp":                     "since no válido, se esperaba una fecha RFC3339",
+	"Invalid after_seq":                                                "after_seq no válido",
+	"after_seq cannot be combined with since":                          "after_seq no se puede combinar con since",
+	"Archived message not found":                                       "Mensaje archivado no encontrado",
+	"Failed to fetch archived messages":                                "No se pudieron obtener los mensajes archivados",
+	"Failed to fetch filter settings":                                  "No se pudo obtener la configuración del filtro",
+	"Strictness must be off, low, medium or high":                      "El nivel debe ser off, low, medium o high",
+	"Failed to update filter settings":                                 "No se pudo actualizar la configuración del filtro",
+	"Failed to fetch flags":                                            "No se pudieron obtener las denuncias",
+	"Failed to generate reset token":                                   "No se pudo generar el token de restablecimiento",
+	"Failed to store reset token":                                      "No se pudo guardar el token de restablecimiento",
+	"Invalid or expired reset token":                                   "Token de restablecimiento no válido o caducado",
+	"If an account with that email exists, a reset link has been sent": "Si existe una cuenta con ese correo, se ha enviado un enlace de restablecimiento",
+	"Password reset successfully":                                      "Contraseña restablecida correctamente",
+	"Failed to fetch pinned messages":                                  "No se pudieron obtener los mensajes fijados",
+	"A conversation can have at most %d pinned messages":               "Una conversación puede tener %d mensajes fijados como máximo",
+	"Failed to pin message":                                            "No se pudo fijar el mensaje",
+	"Failed to unpin message":                                          "No se pudo desfijar el mensaje",
+	"Message is not pinned":                                            "El mensaje no está fijado",
+	"Message unpinned":                                                 "Mensaje desfijado",
+	"Availability must be available, busy or dnd":                      "La disponibilidad debe ser available, busy o dnd",
+	"Status text must be at most %d characters":                        "El texto del estado debe tener %d caracteres como máximo",
+	"Status emoji must be at most %d characters":                       "El emoji del estado debe tener %d caracteres como máximo",
+	"duration_seconds must be between 0 and 604800":                    "duration_seconds debe estar entre 0 y 604800",
+	"Failed to update status":                                          "No se pudo actualizar el estado",
+	"Failed to clear status":                                           "No se pudo borrar el estado",
+	"Invalid email address":                                            "Dirección de correo electrónico no válida",
+	"Missing API key":                                                  "Falta la clave de API",
+	"Invalid or revoked API key":                                       "Clave de API no válida o revocada",
+	"Failed to check API key":                                          "No se pudo comprobar la clave de API",
+	"Failed to check username":                                         "No se pudo comprobar el nombre de usuario",
+	"Missing userName":                                                 "Falta userName",
+	"Email already registered":                                         "El correo electrónico ya está registrado",
+	"Failed to insert user":                                            "No se pudo crear el usuario",
+	"Failed to deactivate user":                                        "No se pudo desactivar el usuario",
+	"Failed to update email":                                           "No se pudo actualizar el correo electrónico",
+	"Failed to update user":                                            "No se pudo actualizar el usuario",
+	"Failed to delete user":                                            "No se pudo eliminar el usuario",
+	"Unsupported filter, expected userName eq \"<username>\"":          "Filtro no admitido, se esperaba userName eq \"<username>\"",
+	"Invalid startIndex":                                               "startIndex no válido",
+	"Invalid count, expected 0 to 1000":                                "count no válido, se esperaba de 0 a 1000",
+	"At most %d operations are allowed":                                "Se permiten %d operaciones como máximo",
+	"Invalid data":                                                     "Datos no válidos",
+	"Unsupported operation %s %s":                                      "Operación no admitida: %s %s",
+	"Failed to generate API key":                                       "No se pudo generar la clave de API",
+	"Failed to create API key":                                         "No se pudo crear la clave de API",
+	"Failed to fetch API keys":                                         "No se pudieron obtener las claves de API",
+	"API key not found":                                                "Clave de API no encontrada",
+	"Failed to revoke API key":                                         "No se pudo revocar la clave de API",
+	"API key revoked successfully":                                     "Clave de API revocada correctamente",
+	"At most %d conversations may be synced at once":                   "Se pueden sincronizar %d conversaciones a la vez como máximo",
+	"Missing conversation or last_read_id":                             "Falta conversation o last_read_id",
+	"Message not found in this conversation":                           "Mensaje no encontrado en esta conversación",
+	"Failed to fetch thread":                                           "No se pudo obtener el hilo",
+	"Failed to fetch scheduled messages":                               "No se pudieron obtener los mensajes programados",
+	"Failed to cancel scheduled message":                               "No se pudo cancelar el mensaje programado",
+	"Scheduled message not found":                                      "Mensaje programado no encontrado",
+	"Scheduled message cancelled":                                      "Mensaje programado cancelado",
+	"Missing search query":                                             "Falta la búsqueda",
+	"Failed to search messages":                                        "No se pudieron buscar los mensajes",
+	"Route not found":                                                  "Ruta no encontrada",
+	"Too many failed logins, try again in %d seconds":                  "Demasiados inicios de sesión fallidos, inténtalo de nuevo en %d segundos",
+	"Verify your email address before logging in":                      "Verifica tu correo electrónico antes de iniciar sesión",
+	"Invalid or expired refresh token":                                 "Token de renovación no válido o caducado",
+	"Failed to fetch sessions":                                         "No se pudieron obtener las sesiones",
+	"Session not found":                                                "Sesión no encontrada",
+	"Failed to revoke session":                                         "No se pudo cerrar la sesión",
+	"Login successful":                                                 "Sesión iniciada correctamente",
+	"Password changed successfully":                                    "Contraseña cambiada correctamente",
+	"Username changed successfully":                                    "Nombre de usuario cambiado correctamente",
+	"Logged out successfully":                                          "Sesión cerrada correctamente",
+	"Session revoked successfully":                                     "Sesión revocada correctamente",
+	"Failed to fetch shadow mutes":                                     "No se pudieron obtener los silencios ocultos",
+	"You cannot shadow-mute yourself":                                  "No puedes silenciarte a ti mismo",
+	"Failed to shadow-mute user":                                       "No se pudo silenciar al usuario",
+	"Failed to lift shadow mute":                                       "No se pudo levantar el silencio",
+	"User is not shadow-muted":                                         "El usuario no está silenciado",
+	"User shadow-muted successfully":                                   "Usuario silenciado correctamente",
+	"Shadow mute lifted successfully":                                  "Silencio levantado correctamente",
+	"Invalid Last-Event-ID":                                            "Last-Event-ID no válido",
+	"Invalid ack":                                                      "ack no válido",
+	"Message marked as read":                                           "Mensaje marcado como leído",
+	"API keys with scope %s cannot call this route":                    "Las claves de API con alcance %s no pueden usar esta ruta",
+	"Invalid scope, expected read or send":                             "scope no válido, se esperaba read o send",
+	"At most %d API keys may exist at once, revoke one first":          "Puede haber %d claves de API como máximo a la vez, revoca una primero",
+	"Email address is required":                                        "El correo electrónico es obligatorio",
+	"Username must be between %d and %d characters":                    "El nombre de usuario debe tener entre %d y %d caracteres",
+	"User signed up successfully":                                      "Usuario registrado correctamente",
+	"Direction must be up, down or none":                               "La dirección debe ser up, down o none",
+	"A request with this idempotency key is in progress":               "Hay una solicitud en curso con esta clave de idempotencia",
+	"Idempotency key was used for a different request":                 "La clave de idempotencia se usó para otra solicitud",
+	"Failed to apply vote":                                             "No se pudo aplicar el voto",
+	"Missing room":                                                     "Falta room",
+	"Limit must be between 1 and %d":                                   "limit debe estar entre 1 y %d",
+	"Failed to fetch top messages":                                     "No se pudieron obtener los mensajes destacados",
+	"Vote toggled successfully":                                        "Voto actualizado correctamente",
+	"Invalid url, expected an http or https URL":                       "url no válida, se esperaba una URL http o https",
+	"Missing events":                                                   "Faltan los eventos",
+	"Unknown event %q, expected one of %s":                             "Evento %q desconocido, se esperaba uno de %s",
+	"Failed to generate secret":                                        "No se pudo generar el secreto",
+	"Secret must be at least %d characters":                            "El secreto debe tener al menos %d caracteres",
+	"Failed to create webhook":                                         "No se pudo crear el webhook",
+	"Failed to fetch webhooks":                                         "No se pudieron obtener los webhooks",
+	"Webhook not found":                                                "Webhook no encontrado",
+	"Failed to delete webhook":                                         "No se pudo eliminar el webhook",
+	"Failed to fetch deliveries":                                       "No se pudieron obtener las entregas",
+	"Webhook deleted successfully":                                     "Webhook eliminado correctamente",
+	"Invalid auth frame":                                               "Trama de autenticación no válida",
+	"Token belongs to another user":                                    "El token pertenece a otro usuario",
+	"Too many requests, please try again later":                        "Demasiadas solicitudes, inténtalo de nuevo más tarde",
+
+	// Errors worded by other packages, passed on as they are.
+	"Username contains characters that are not allowed":            "El nombre de usuario contiene caracteres no permitidos",
+	"Username is reserved":                                         "El nombre de usuario está reservado",
+	"Username contains a word that is not allowed":                 "El nombre de usuario contiene una palabra no permitida",
+	"Password must be between 8 to 20 characters.":                 "La contraseña debe tener entre 8 y 20 caracteres.",
+	"reply_to_id must refer to a message in the same conversation": "reply_to_id debe referirse a un mensaje de la misma conversación",
+	"malformed frame": "trama mal formada",
+
+	// System messages.
+	"%s is now known as %s":               "%s ahora se llama %s",
+	"%s pinned a message":                 "%s fijó un mensaje",
+	"%s joined with an invite":            "%s se unió con una invitación",
+	"%s turned off disappearing messages": "%s desactivó los mensajes temporales",
+	"%s set disappearing messages to %s":  "%s configuró los mensajes temporales en %s",
+	"1 week":                              "1 semana",
+	"%d weeks":                            "%d semanas",
+	"1 day":                               "1 día",
+	"%d days":                             "%d días",
+	"1 hour":                              "1 hora",
+	"%d hours":                            "%d horas",
+	"1 minute":                            "1 minuto",
+	"%d minutes":                          "%d minutos",
+	"1 second":                            "1 segundo",
+	"%d seconds":                          "%d segundos",
+}
@@ -0,0 +1,380 @@
+package i18n
+
+// french translates server messages to French.
+var french = map[string]string{
+	// Errors and responses.
+	"Message not found": "Message introuvable",
+	"You are not a participant of this conversation": "Vous ne participez pas à cette conversation",
+	"Failed to fetch message":                        "Impossible de récupérer le message",
+	"Missing receiver":                               "Destinataire manquant",
+	"Invalid request payload":                        "Contenu de la requête invalide",
+	"Failed to verify password":                      "Impossible de vérifier le mot de passe",
+	"Old password is incorrect":                      "L'ancien mot de passe est incorrect",
+	"Failed to hash password":                        "Impossible de traiter le mot de passe",
+	"Failed to update password":                      "Impossible de mettre à jour le mot de passe",
+	"Failed to create session":                       "Impossible de créer la session",
+	"Password is incorrect":                          "Le mot de passe est incorrect",
+	"New username must be different":                 "Le nouveau nom d'utilisateur doit être différent",
+	"Username already taken":                         "Ce nom d'utilisateur est déjà pris",
+	"Failed to rename user":                          "Impossible de renommer l'utilisateur",
+	"Failed to delete account":                       "Impossible de supprimer le compte",
+	"Failed to export account":                       "Impossible d'exporter le compte",
+	"Failed to fetch usage":                          "Impossible de récupérer l'utilisation",
+	"Account deletion scheduled":                     "Suppression du compte programmée",
+	"Invalid or expired token":                       "Jeton invalide ou expiré",
+	"Failed to fetch user":                           "Impossible de récupérer l'utilisateur",
+	"Account is banned":                              "Le compte est banni",
+	"Admin access required":                          "Accès administrateur requis",
+	"Failed to fetch users":                          "Impossible de récupérer les utilisateurs",
+	"You cannot ban yourself":                        "Vous ne pouvez pas vous bannir vous-même",
+	"User not found":                                 "Utilisateur introuvable",
+	"Failed to ban user":                             "Impossible de bannir l'utilisateur",
+	"Failed to unban user":                           "Impossible de lever le bannissement de l'utilisateur",
+	"Failed to delete message":                       "Impossible de supprimer le message",
+	"Failed to fetch stats":                          "Impossible de récupérer les statistiques",
+	"User banned successfully":                       "Utilisateur banni",
+	"User unbanned successfully":                     "Bannissement de l'utilisateur levé",
+	"Message deleted successfully":                   "Message supprimé",
+	"Failed to fetch analytics setting":              "Impossible de récupérer le réglage des statistiques d'usage",
+	"Failed to save analytics setting":               "Impossible d'enregistrer le réglage des statistiques d'usage",
+	"Missing or invalid file":                        "Fichier manquant ou invalide",
+	"File exceeds the %d byte limit":                 "Le fichier dépasse la limite de %d octets",
+	"Failed to read file":                            "Impossible de lire le fichier",
+	"File type %s is not allowed":                    "Le type de fichier %s n'est pas autorisé",
+	"Failed to store file":                           "Impossible d'enregistrer le fichier",
+	"Failed to send message":                         "Impossible d'envoyer le message",
+	"Direct uploads are not available":               "Les envois directs ne sont pas disponibles",
+	"Missing filename":                               "Nom de fichier manquant",
+	"Invalid size":                                   "Taille invalide",
+	"Failed to create upload":                        "Impossible de créer l'envoi",
+	"Upload not found or expired":                    "Envoi introuvable ou expiré",
+	"Failed to fetch upload":                         "Impossible de récupérer l'envoi",
+	"File has not been uploaded":                     "Le fichier n'a pas été envoyé",
+	"Uploaded %d bytes instead of %d":                "%d octets envoyés au lieu de %d",
+	"File type %s does not match %s":                 "Le type de fichier %s ne correspond pas à %s",
+	"Attachment not found":                           "Pièce jointe introuvable",
+	"Failed to fetch attachment":                     "Impossible de récupérer la pièce jointe",
+	"Thumbnail not found":                            "Miniature introuvable",
+	"Failed to fetch thumbnail":                      "Impossible de récupérer la miniature",
+	"Failed to fetch file":                           "Impossible de récupérer le fichier",
+	"File not found":                                 "Fichier introuvable",
+	"Invalid %s, expected an RFC3339 timestamp":      "%s invalide, horodatage RFC3339 attendu",
+	"Invalid before":                                 "before invalide",
+	"Invalid limit, expected 1 to 1000":              "limit invalide, de 1 à 1000 attendu",
+	"Failed to fetch audit log":                      "Impossible de récupérer le journal d'audit",
+	"You cannot block yourself":                      "Vous ne pouvez pas vous bloquer vous-même",
+	"Failed to block user":                           "Impossible de bloquer l'utilisateur",
+	"Failed to unblock user":                         "Impossible de débloquer l'utilisateur",
+	"User is not blocked":                            "L'utilisateur n'est pas bloqué",
+	"Failed to check block status":                   "Impossible de vérifier le blocage",
+	"You cannot message this user":                   "Vous ne pouvez pas écrire à cet utilisateur",
+	"User blocked successfully":                      "Utilisateur bloqué",
+	"User unblocked successfully":                    "Utilisateur débloqué",
+	"Invalid or rotated bot token":                   "Jeton de bot invalide ou renouvelé",
+	"Failed to check bot token":                      "Impossible de vérifier le jeton du bot",
+	"Missing authentication token":                   "Jeton d'authentification manquant",
+	"Bot access required":                            "Accès bot requis",
+	"Failed to generate password":                    "Impossible de générer le mot de passe",
+	"Failed to generate bot token":                   "Impossible de générer le jeton du bot",
+	"Failed to create bot":                           "Impossible de créer le bot",
+	"Failed to fetch bots":                           "Impossible de récupérer les bots",
+	"Bot not found":                                  "Bot introuvable",
+	"Failed to rotate bot token":                     "Impossible de renouveler le jeton du bot",
+	"Failed to fetch bot":                            "Impossible de récupérer le bot",
+	"Failed to fetch commands":                       "Impossible de récupérer les commandes",
+	"Invalid command name, expected 1 to 32 lowercase letters, digits, - or _": "Nom de commande invalide, de 1 à 32 lettres minuscules, chiffres, - ou _ attendus",
+	"Invalid description, expected at most 200 characters":                     "Description invalide, 200 caractères au plus attendus",
+	"Command already registered by another bot":                                "Commande déjà enregistrée par un autre bot",
+	"Failed to register command":                                               "Impossible d'enregistrer la commande",
+	"Command not found":                                                        "Commande introuvable",
+	"Failed to delete command":                                                 "Impossible de supprimer la commande",
+	"Bot deleted successfully":                                                 "Bot supprimé",
+	"Command deleted successfully":                                             "Commande supprimée",
+	"Channel not found":                                                        "Canal introuvable",
+	"Failed to fetch channels":                                                 "Impossible de récupérer les canaux",
+	"Failed to subscribe to channel":                                           "Impossible de s'abonner au canal",
+	"Failed to unsubscribe from channel":                                       "Impossible de se désabonner du canal",
+	"Not subscribed to channel":                                                "Vous n'êtes pas abonné au canal",
+	"Invalid limit, expected 1 to 200":                                         "limit invalide, de 1 à 200 attendu",
+	"Failed to fetch channel":                                                  "Impossible de récupérer le canal",
+	"Failed to fetch posts":                                                    "Impossible de récupérer les publications",
+	"Only the channel's senders can post to it":                                "Seuls les émetteurs du canal peuvent y publier",
+	"Invalid name, expected 1 to 64 characters":                                "Nom invalide, de 1 à 64 caractères attendus",
+	"Description is longer than 500 characters":                                "La description dépasse 500 caractères",
+	"Topic is longer than 250 characters":                                      "Le sujet dépasse 250 caractères",
+	"Visibility must be public or private":                                     "La visibilité doit être public ou private",
+	"Unknown sender %s":                                                        "Émetteur inconnu : %s",
+	"Channel name already taken":                                               "Ce nom de canal est déjà pris",
+	"Failed to create channel":                                                 "Impossible de créer le canal",
+	"Failed to delete channel":                                                 "Impossible de supprimer le canal",
+	"Failed to add sender":                                                     "Impossible d'ajouter l'émetteur",
+	"Failed to remove sender":                                                  "Impossible de retirer l'émetteur",
+	"User is not a sender of this channel":                                     "L'utilisateur n'est pas émetteur de ce canal",
+	"Subscribed successfully":                                                  "Abonnement effectué",
+	"Unsubscribed successfully":                                                "Désabonnement effectué",
+	"Channel deleted successfully":                                             "Canal supprimé",
+	"Sender added successfully":                                                "Émetteur ajouté",
+	"Sender removed successfully":                                              "Émetteur retiré",
+	"Your role in this channel does not allow this":                            "Votre rôle dans ce canal ne le permet pas",
+	"User is not a member of this channel":                                     "L'utilisateur n'est pas membre de ce canal",
+	"Role must be owner, admin or member":                                      "Le rôle doit être owner, admin ou member",
+	"The channel needs another owner first":                                    "Le canal doit d'abord avoir un autre propriétaire",
+	"Failed to update channel":                                                 "Impossible de modifier le canal",
+	"Failed to fetch members":                                                  "Impossible de récupérer les membres",
+	"Failed to change role":                                                    "Impossible de changer le rôle",
+	"Failed to remove member":                                                  "Impossible de retirer le membre",
+	"Post not found":                                                           "Publication introuvable",
+	"Failed to delete post":                                                    "Impossible de supprimer la publication",
+	"Failed to pin post":                                                       "Impossible d'épingler la publication",
+	"Role changed successfully":                                                "Rôle modifié",
+	"Member removed successfully":                                              "Membre retiré",
+	"Post deleted successfully":                                                "Publication supprimée",
+	"This invite expired":                                                      "Cette invitation a expiré",
+	"Invite not found":                                                         "Invitation introuvable",
+	"Invalid expires_in_seconds, expected 0 to 2592000":                        "expires_in_seconds invalide, attendu de 0 à 2592000",
+	"Invalid max_uses, expected 0 to 10000":                                    "max_uses invalide, attendu de 0 à 10000",
+	"Failed to generate invite token":                                          "Impossible de générer le jeton d'invitation",
+	"Failed to create invite":                                                  "Impossible de créer l'invitation",
+	"Failed to fetch invites":                                                  "Impossible de récupérer les invitations",
+	"Failed to revoke invite":                                                  "Impossible de révoquer l'invitation",
+	"Failed to accept invite":                                                  "Impossible d'accepter l'invitation",
+	"Invite revoked successfully":                                              "Invitation révoquée",
+	"Post pinned":                                                              "Publication épinglée",
+	"Post unpinned":                                                            "Publication désépinglée",
+	"Only members of the channel can reply":                                    "Seuls les membres du canal peuvent répondre",
+	"Only members of the channel can follow its threads":                       "Seuls les membres du canal peuvent suivre ses fils",
+	"Replies must reply to a post of the channel":                              "Les réponses doivent répondre à une publication du canal",
+	"Failed to fetch threads":                                                  "Impossible de récupérer les fils",
+	"Failed to fetch replies":                                                  "Impossible de récupérer les réponses",
+	"Failed to mark thread read":                                               "Impossible de marquer le fil comme lu",
+	"Failed to update thread subscription":                                     "Impossible de mettre à jour l'abonnement au fil",
+	"Thread marked as read":                                                    "Fil marqué comme lu",
+	"Subscribed to thread":                                                     "Abonné au fil",
+	"Unsubscribed from thread":                                                 "Désabonné du fil",
+	"Missing or invalid CSRF token":                                            "Jeton CSRF manquant ou invalide",
+	"Only the sender can delete a message for everyone":                        "Seul l'expéditeur peut supprimer un message pour tout le monde",
+	"Invalid scope, must be 'me' or 'everyone'":                                "scope invalide, 'me' ou 'everyone' attendu",
+	"Platform must be fcm, apns or webpush":                                    "La plateforme doit être fcm, apns ou webpush",
+	"Missing token":                                                            "Jeton manquant",
+	"Failed to register device":                                                "Impossible d'enregistrer l'appareil",
+	"Failed to unregister device":                                              "Impossible de désenregistrer l'appareil",
+	"Device not found":                                                         "Appareil introuvable",
+	"Failed to fetch preferences":                                              "Impossible de récupérer les préférences",
+	"Invalid quiet_hours":                                                      "quiet_hours invalide",
+	"Failed to update preferences":                                             "Impossible de mettre à jour les préférences",
+	"Quiet hours start and end must be times like 22:00":                       "Le début et la fin des heures calmes doivent être des heures comme 22:00",
+	"Quiet hours must not start and end at the same time":                      "Les heures calmes ne peuvent pas commencer et finir à la même heure",
+	"Unknown time zone %s":                                                     "Fuseau horaire inconnu : %s",
+	"Failed to fetch mutes":                                                    "Impossible de récupérer les conversations en sourdine",
+	"duration_seconds must be between 0 and 31536000":                          "duration_seconds doit être compris entre 0 et 31536000",
+	"Failed to mute conversation":                                              "Impossible de mettre la conversation en sourdine",
+	"Failed to unmute conversation":                                            "Impossible de réactiver la conversation",
+	"Conversation is not muted":                                                "La conversation n'est pas en sourdine",
+	"Web Push is not configured":                                               "Web Push n'est pas configuré",
+	"Device unregistered successfully":                                         "Appareil désenregistré",
+	"Conversation unmuted successfully":                                        "Conversation réactivée",
+	"Failed to fetch disappearing messages setting":                            "Impossible de récupérer le réglage des messages éphémères",
+	"ttl_seconds must be between 0 and 2419200":                                "ttl_seconds doit être compris entre 0 et 2419200",
+	"Failed to update disappearing messages setting":                           "Impossible de mettre à jour le réglage des messages éphémères",
+	"Draft not found":                                                          "Brouillon introuvable",
+	"Failed to fetch draft":                                                    "Impossible de récupérer le brouillon",
+	"Draft exceeds the %d byte limit":                                          "Le brouillon dépasse la limite de %d octets",
+	"Failed to delete draft":                                                   "Impossible de supprimer le brouillon",
+	"Failed to save draft":                                                     "Impossible d'enregistrer le brouillon",
+	"Draft deleted":                                                            "Brouillon supprimé",
+	"Invalid or expired verification token":                                    "Jeton de vérification invalide ou expiré",
+	"Failed to verify email":                                                   "Impossible de vérifier l'adresse e-mail",
+	"Email verified successfully":                                              "Adresse e-mail vérifiée",
+	"If an unverified account with that email exists, a verification link has been sent": "Si un compte non vérifié utilise cette adresse, un lien de vérification a été envoyé",
+	"Invalid typing event":                                             "Événement de saisie invalide",
+	"Invalid read receipt":                                             "Accusé de lecture invalide",
+	"Failed to update message status":                                  "Impossible de mettre à jour l'état du message",
+	"Format must be json or csv":                                       "Le format doit être json ou csv",
+	"Invalid request body":                                             "Corps de la requête invalide",
+	"Failed to fetch conversations":                                    "Impossible de récupérer les conversations",
+	"Failed to fetch presence":                                         "Impossible de récupérer la présence",
+	"Failed to fetch status":                                           "Impossible de récupérer le statut",
+	"Invalid last, expected 1 to 100":                                  "last invalide, de 1 à 100 attendu",
+	"Invalid cursor":                                                   "Curseur invalide",
+	"Failed to fetch messages":                                         "Impossible de récupérer les messages",
+	"Internal server error":                                            "Erreur interne du serveur",
+	"Invalid username or password":                                     "Nom d'utilisateur ou mot de passe incorrect",
+	"Missing refresh token":                                            "Jeton de rafraîchissement manquant",
+	"Failed to log out":                                                "Impossible de se déconnecter",
+	"Too many messages, please slow down":                              "Trop de messages, ralentissez",
+	"Missing peer":                                                     "Interlocuteur manquant",
+	"Invalid limit":                                                    "limit invalide",
+	"Missing request":                                                  "Requête manquante",
+	"Hook not found":                                                   "Hook introuvable",
+	"Failed to fetch hook":                                             "Impossible de récupérer le hook",
+	"Invalid payload":                                                  "Contenu invalide",
+	"Missing text":                                                     "Texte manquant",
+	"Invalid name, expected 1 to 100 characters":                       "Nom invalide, de 1 à 100 caractères attendus",
+	"Unknown bot %s":                                                   "Bot inconnu : %s",
+	"Receiver not found":                                               "Destinataire introuvable",
+	"Failed to fetch receiver":                                         "Impossible de récupérer le destinataire",
+	"Failed to generate hook token":                                    "Impossible de générer le jeton du hook",
+	"Failed to create hook":                                            "Impossible de créer le hook",
+	"Failed to fetch hooks":                                            "Impossible de récupérer les hooks",
+	"Failed to delete hook":                                            "Impossible de supprimer le hook",
+	"Hook deleted successfully":                                        "Hook supprimé",
+	"Access is not allowed from your network or location":              "L'accès n'est pas autorisé depuis votre réseau ou votre emplacement",
+	"Failed to fetch locale":                                           "Impossible de récupérer la langue",
+	"Unsupported locale %q, expected one of %s":                        "Langue %q non prise en charge, l'une de %s attendue",
+	"Failed to save locale":                                            "Impossible d'enregistrer la langue",
+	"Failed to fetch lockout":                                          "Impossible de récupérer le verrouillage",
+	"Failed to unlock account":                                         "Impossible de déverrouiller le compte",
+	"Failed to unlock address":                                         "Impossible de déverrouiller l'adresse",
+	"Account unlocked successfully":                                    "Compte déverrouillé",
+	"Address unlocked successfully":                                    "Adresse déverrouillée",
+	"Invalid offset":                                                   "offset invalide",
+	"Failed to fetch mentions":                                         "Impossible de récupérer les mentions",
+	"Invalid delivered event":                                          "Événement de remise invalide",
+	"Unsupported event type %q":                                        "Type d'événement %q non pris en charge",
+	"Message was rejected by the content filter":                       "Le message a été refusé par le filtre de contenu",
+	"Missing content":                                                  "Contenu manquant",
+	"Content is longer than %d characters":                             "Le contenu dépasse %d caractères",
+	"format must be plain or markdown":                                 "format doit être plain ou markdown",
+	"send_at must be in the future":                                    "send_at doit être dans le futur",
+	"Daily message quota exceeded":                                     "Quota quotidien de messages dépassé",
+	"Storage quota exceeded":                                           "Quota de stockage dépassé",
+	"Invalid message":                                                  "Message invalide",
+	"Invalid message: %s must be a %s":                                 "Message invalide : %s doit être de type %s",
+	"Missing messages":                                                 "Messages manquants",
+	"A batch may have at most %d messages":                             "Un lot peut contenir %d messages au plus",
+	"Invalid since, expected an RFC3339 timestamp":                     "since invalide, horodatage RFC3339 attendu",
+	"Invalid after_seq":                                                "after_seq invalide",
+	"after_seq cannot be combined with since":                          "after_seq ne peut pas être combiné avec since",
+	"Archived message not found":                                       "Message archivé introuvable",
+	"Failed to fetch archived messages":                                "Impossible de récupérer les messages archivés",
+	"Failed to fetch filter settings":                                  "Impossible de récupérer les réglages du filtre",
+	"Strictness must be off, low, medium or high":                      "La sévérité doit être off, low, medium ou high",
+	"Failed to update filter settings":                                 "Impossible de mettre à jour les réglages du filtre",
+	"Failed to fetch flags":                                            "Impossible de récupérer les signalements",
+	"Failed to generate reset token":                                   "Impossible de générer le jeton de réinitialisation",
+	"Failed to store reset token":                                      "Impossible d'enregistrer le jeton de réinitialisation",
+	"Invalid or expired reset token":                                   "Jeton de réinitialisation invalide ou expiré",
+	"If an account with that email exists, a reset link has been sent": "Si un compte utilise cette adresse, un lien de réinitialisation a été envoyé",
+	"Password reset successfully":                                      "Mot de passe réinitialisé",
+	"Failed to fetch pinned messages":                                  "Impossible de récupérer les messages épinglés",
+	"A conversation can have at most %d pinned messages":               "Une conversation peut avoir %d messages épinglés au plus",
+	"Failed to pin message":                                            "Impossible d'épingler le message",
+	"Failed to unpin message":                                          "Impossible de désépingler le message",
+	"Message is not pinned":                                            "Le message n'est pas épinglé",
+	"Message unpinned":                                                 "Message désépinglé",
+	"Availability must be available, busy or dnd":                      "La disponibilité doit être available, busy ou dnd",
+	"Status text must be at most %d characters":                        "Le texte du statut doit faire %d caractères au plus",
+	"Status emoji must be at most %d characters":                       "L'emoji du statut doit faire %d caractères au plus",
+	"duration_seconds must be between 0 and 604800":                    "duration_seconds doit être compris entre 0 et 604800",
+	"Failed to update status":                                          "Impossible de mettre à jour le statut",
+	"Failed to clear status":                                           "Impossible d'effacer le statut",
+	"Invalid email address":                                            "Adresse e-mail invalide",
+	"Missing API key":                                                  "Clé d'API manquante",
+	"Invalid or revoked API key":                                       "Clé d'API invalide ou révoquée",
+	"Failed to check API key":                                          "Impossible de vérifier la clé d'API",
+	"Failed to check username":                                         "Impossible de vérifier le nom d'utilisateur",
+	"Missing userName":                                                 "userName manquant",
+	"Email already registered":                                         "Adresse e-mail déjà enregistrée",
+	"Failed to insert user":                                            "Impossible de créer l'utilisateur",
+	"Failed to deactivate user":                                        "Impossible de désactiver l'utilisateur",
+	"Failed to update email":                                           "Impossible de mettre à jour l'adresse e-mail",
+	"Failed to update user":                                            "Impossible de mettre à jour l'utilisateur",
+	"Failed to delete user":                                            "Impossible de supprimer l'utilisateur",
+	"Unsupported filter, expected userName eq \"<username>\"":          "Filtre non pris en charge, userName eq \"<username>\" attendu",
+	"Invalid startIndex":                                               "startIndex invalide",
+	"Invalid count, expected 0 to 1000":                                "count invalide, de 0 à 1000 attendu",
+	"At most %d operations are allowed":                                "%d opérations au plus sont autorisées",
+	"Invalid data":                                                     "Données invalides",
+	"Unsupported operation %s %s":                                      "Opération non prise en charge : %s %s",
+	"Failed to generate API key":                                       "Impossible de générer la clé d'API",
+	"Failed to create API key":                                         "Impossible de créer la clé d'API",
+	"Failed to fetch API keys":                                         "Impossible de récupérer les clés d'API",
+	"API key not found":                                                "Clé d'API introuvable",
+	"Failed to revoke API key":                                         "Impossible de révoquer la clé d'API",
+	"API key revoked successfully":                                     "Clé d'API révoquée",
+	"At most %d conversations may be synced at once":                   "%d conversations au plus peuvent être synchronisées à la fois",
+	"Missing conversation or last_read_id":                             "conversation ou last_read_id manquant",
+	"Message not found in this conversation":                           "Message introuvable dans cette conversation",
+	"Failed to fetch thread":                                           "Impossible de récupérer le fil",
+	"Failed to fetch scheduled messages":                               "Impossible de récupérer les messages programmés",
+	"Failed to cancel scheduled message":                               "Impossible d'annuler le message programmé",
+	"Scheduled message not found":                                      "Message programmé introuvable",
+	"Scheduled message cancelled":                                      "Message programmé annulé",
+	"Missing search query":                                             "Recherche manquante",
+	"Failed to search messages":                                        "Impossible de rechercher les messages",
+	"Route not found":                                                  "Route introuvable",
+	"Too many failed logins, try again in %d seconds":                  "Trop de connexions échouées, réessayez dans %d secondes",
+	"Verify your email address before logging in":                      "Vérifiez votre adresse e-mail avant de vous connecter",
+	"Invalid or expired refresh token":                                 "Jeton de rafraîchissement invalide ou expiré",
+	"Failed to fetch sessions":                                         "Impossible de récupérer les sessions",
+	"Session not found":                                                "Session introuvable",
+	"Failed to revoke session":                                         "Impossible de révoquer la session",
+	"Login successful":                                                 "Connexion réussie",
+	"Password changed successfully":                                    "Mot de passe modifié",
+	"Username changed successfully":                                    "Nom d'utilisateur modifié",
+	"Logged out successfully":                                          "Déconnexion effectuée",
+	"Session revoked successfully":                                     "Session révoquée",
+	"Failed to fetch shadow mutes":                                     "Impossible de récupérer les mises en sourdine invisibles",
+	"You cannot shadow-mute yourself":                                  "Vous ne pouvez pas vous mettre en sourdine vous-même",
+	"Failed to shadow-mute user":                                       "Impossible de mettre l'utilisateur en sourdine",
+	"Failed to lift shadow mute":                                       "Impossible de lever la mise en sourdine",
+	"User is not shadow-muted":                                         "L'utilisateur n'est pas en sourdine",
+	"User shadow-muted successfully":                                   "Utilisateur mis en sourdine",
+	"Shadow mute lifted successfully":                                  "Mise en sourdine levée",
+	"Invalid Last-Event-ID":                                            "Last-Event-ID invalide",
+	"Invalid ack":                                                      "ack invalide",
+	"Message marked as read":                                           "Message marqué comme lu",
+	"API keys with scope %s cannot call this route":                    "Les clés d'API de portée %s ne peuvent pas appeler cette route",
+	"Invalid scope, expected read or send":                             "scope invalide, read ou send attendu",
+	"At most %d API keys may exist at once, revoke one first":          "%d clés d'API au plus peuvent exister à la fois, révoquez-en une d'abord",
+	"Email address is required":                                        "L'adresse e-mail est obligatoire",
+	"Username must be between %d and %d characters":                    "Le nom d'utilisateur doit faire entre %d et %d caractères",
+	"User signed up successfully":                                      "Inscription effectuée",
+	"Direction must be up, down or none":                               "La direction doit être up, down ou none",
+	"A request with this idempotency key is in progress":               "Une requête avec cette clé d'idempotence est en cours",
+	"Idempotency key was used for a different request":                 "La clé d'idempotence a servi pour une autre requête",
+	"Failed to apply vote":                                             "Impossible d'appliquer le vote",
+	"Missing room":                                                     "room manquant",
+	"Limit must be between 1 and %d":                                   "limit doit être compris entre 1 et %d",
+	"Failed to fetch top messages":                                     "Impossible de récupérer les meilleurs messages",
+	"Vote toggled successfully":                                        "Vote mis à jour",
+	"Invalid url, expected an http or https URL":                       "url invalide, URL http ou https attendue",
+	"Missing events":                                                   "Événements manquants",
+	"Unknown event %q, expected one of %s":                             "Événement %q inconnu, l'un de %s attendu",
+	"Failed to generate secret":                                        "Impossible de générer le secret",
+	"Secret must be at least %d characters":                            "Le secret doit faire au moins %d caractères",
+	"Failed to create webhook":                                         "Impossible de créer le webhook",
+	"Failed to fetch webhooks":                                         "Impossible de récupérer les webhooks",
+	"Webhook not found":                                                "Webhook introuvable",
+	"Failed to delete webhook":                                         "Impossible de supprimer le webhook",
+	"Failed to fetch deliveries":                                       "Impossible de récupérer les livraisons",
+	"Webhook deleted successfully":                                     "Webhook supprimé",
+	"Invalid auth frame":                                               "Trame d'authentification invalide",
+	"Token belongs to another user":                                    "Le jeton appartient à un autre utilisateur",
+	"Too many requests, please try again later":                        "Trop de requêtes, réessayez plus tard",
+
+	// Errors worded by other packages, passed on as they are.
+	"Username contains characters that are not allowed":            "Le nom d'utilisateur contient des caractères non autorisés",
+	"Username is reserved":                                         "Ce nom d'utilisateur est réservé",
+	"Username contains a word that is not allowed":                 "Le nom d'utilisateur contient un mot non autorisé",
+	"Password must be between 8 to 20 characters.":                 "Le mot de passe doit faire entre 8 et 20 caractères.",
+	"reply_to_id must refer to a message in the same conversation": "reply_to_id doit désigner un message de la même conversation",
+	"malformed frame": "trame mal formée",
+
+	// System messages.
+	"%s is now known as %s":               "%s s'appelle désormais %s",
+	"%s pinned a message":                 "%s a épinglé un message",
+	"%s joined with an invite":            "%s a rejoint avec une invitation",
+	"%s turned off disappearing messages": "%s a désactivé les messages éphémères",
+	"%s set disappearing messages to %s":  "%s a réglé les messages éphémères sur %s",
+	"1 week":                              "1 semaine",
+	"%d weeks":                            "%d semaines",
+	"1 day":                               "1 jour",
+	"%d days":                             "%d jours",
+	"1 hour":                              "1 heure",
+	"%d hours":                            "%d heures",
+	"1 minute":                            "1 minute",
+	"%d minutes":                          "%d minutes",
+	"1 second":                            "1 seconde",
+	"%d seconds":                          "%d secondes",
+}
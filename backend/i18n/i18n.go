@@ -0,0 +1,79 @@
+// Package i18n translates the strings the server writes for people to read,
+// such as error messages and system messages, into the languages it
+// supports. Strings are looked up by their English text, or by their format
+// for strings built from values, so call sites read as they always did and
+// anything without a translation falls back to English.
+package i18n
+
+import (
+	"fmt"
+	"strings"
+
+	"golang.org/x/text/language"
+)
+
+// Supported lists the languages translations exist for. English, the
+// language of the source strings, comes first, so it is chosen when a
+// client accepts none of the others.
+var Supported = []language.Tag{language.English, language.Spanish, language.French}
+
+// catalogs holds the translations of each supported language other than
+// English, keyed by the English string or format.
+var catalogs = map[language.Tag]map[string]string{
+	language.Spanish: spanish,
+	language.French:  french,
+}
+
+var matcher = language.NewMatcher(Supported)
+
+// Match returns the supported language that best fits an Accept-Language
+// header, English if none does.
+func Match(acceptLanguage string) language.Tag {
+	tags, _, err := language.ParseAcceptLanguage(acceptLanguage)
+	if err != nil || len(tags) == 0 {
+		return language.English
+	}
+	_, i, confidence := matcher.Match(tags...)
+	if confidence == language.No {
+		return language.English
+	}
+	return Supported[i]
+}
+
+// Parse returns the supported language a locale such as "es" or "fr-CA"
+// names, or an error if it names none.
+func Parse(locale string) (language.Tag, error) {
+	tag, err := language.Parse(locale)
+	if err == nil {
+		base, _ := tag.Base()
+		for _, supported := range Supported {
+			if b, _ := supported.Base(); b == base {
+				return supported, nil
+			}
+		}
+	}
+	return language.Und, fmt.Errorf("unsupported locale %q, expected one of %s", locale, strings.Join(Names(), ", "))
+}
+
+// Names returns the codes of the supported languages, such as "en".
+func Names() []string {
+	names := make([]string, len(Supported))
+	for i, tag := range Supported {
+		names[i] = tag.String()
+	}
+	return names
+}
+
+// Translate returns the translation of an English string into lang, or the
+// string itself if it has none.
+func Translate(lang language.Tag, s string) string {
+	if t, ok := catalogs[lang][s]; ok {
+		return t
+	}
+	return s
+}
+
+// Sprintf formats args by the translation of an English format into lang.
+func Sprintf(lang language.Tag, format string, args ...interface{}) string {
+	return fmt.Sprintf(Translate(lang, format), args...)
+}
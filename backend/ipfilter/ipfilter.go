@@ -0,0 +1,165 @@
+// Package ipfilter decides which clients may reach the API by their IP
+// address and, optionally, the country a proxy in front of the server
+// located them in.
+package ipfilter
+
+import (
+	"fmt"
+	"net/netip"
+	"strings"
+)
+
+// Reasons a client is blocked.
+const (
+	ReasonIPDenied          = "ip_denied"
+	ReasonIPNotAllowed      = "ip_not_allowed"
+	ReasonCountryDenied     = "country_denied"
+	ReasonCountryNotAllowed = "country_not_allowed"
+)
+
+// Config lists the addresses and countries clients may or may not come
+// from. Empty lists impose nothing.
+type Config struct {
+	// Allow, if not empty, are the only addresses clients may come from,
+	// and Deny are addresses they may not, as IPs or CIDR ranges. Deny
+	// wins when both match.
+	Allow []string
+	Deny  []string
+	// CountryHeader is the request header a proxy or CDN sets to the
+	// ISO 3166 country code of the client, such as CF-IPCountry. The
+	// country lists are only checked if it is set.
+	CountryHeader string
+	// TrustedProxies are the addresses, as IPs or CIDR ranges, of the
+	// proxies the country header is taken from. It is ignored on requests
+	// from any other peer, which could set it themselves.
+	TrustedProxies []string
+	// AllowCountries, if not empty, are the only countries clients may
+	// come from; clients whose country is unknown are blocked then.
+	// DenyCountries are countries they may not come from.
+	AllowCountries []string
+	DenyCountries  []string
+}
+
+// Filter checks clients against a Config.
+type Filter struct {
+	allow, deny, trusted          []netip.Prefix
+	countryHeader                 string
+	allowCountries, denyCountries map[string]bool
+}
+
+// New returns a Filter checking clients against cfg, or an error naming the
+// first entry that is not an IP, CIDR range or two letter country code.
+func New(cfg Config) (*Filter, error) {
+	f := &Filter{countryHeader: cfg.CountryHeader}
+	var err error
+	if f.allow, err = parsePrefixes(cfg.Allow); err != nil {
+		return nil, err
+	}
+	if f.deny, err = parsePrefixes(cfg.Deny); err != nil {
+		return nil, err
+	}
+	if f.trusted, err = parsePrefixes(cfg.TrustedProxies); err != nil {
+		return nil, err
+	}
+	if f.allowCountries, err = parseCountries(cfg.AllowCountries); err != nil {
+		return nil, err
+	}
+	if f.denyCountries, err = parseCountries(cfg.DenyCountries); err != nil {
+		return nil, err
+	}
+	if f.countryHeader == "" && (len(f.allowCountries) > 0 || len(f.denyCountries) > 0) {
+		return nil, fmt.Errorf("country rules need a country header")
+	}
+	if f.countryHeader != "" && len(f.trusted) == 0 {
+		return nil, fmt.Errorf("a country header needs trusted proxies to set it")
+	}
+	return f, nil
+}
+
+// parsePrefixes parses IPs and CIDR ranges; an IP is a range of one.
+func parsePrefixes(entries []string) ([]netip.Prefix, error) {
+	var prefixes []netip.Prefix
+	for _, entry := range entries {
+		if strings.Contains(entry, "/") {
+			p, err := netip.ParsePrefix(entry)
+			if err != nil {
+				return nil, fmt.Errorf("invalid CIDR range %q", entry)
+			}
+			prefixes = append(prefixes, p.Masked())
+			continue
+		}
+		addr, err := netip.ParseAddr(entry)
+		if err != nil {
+			return nil, fmt.Errorf("invalid IP %q", entry)
+		}
+		addr = addr.Unmap().WithZone("")
+		prefixes = append(prefixes, netip.PrefixFrom(addr, addr.BitLen()))
+	}
+	return prefixes, nil
+}
+
+// parseCountries parses two letter country codes, in any case.
+func parseCountries(entries []string) (map[string]bool, error) {
+	countries := make(map[string]bool, len(entries))
+	for _, entry := range entries {
+		code := strings.ToUpper(entry)
+		if len(code) != 2 || code[0] < 'A' || code[0] > 'Z' || code[1] < 'A' || code[1] > 'Z' {
+			return nil, fmt.Errorf("invalid country code %q, expected two letters such as DE", entry)
+		}
+		countries[code] = true
+	}
+	return countries, nil
+}
+
+// Enabled reports whether the filter blocks anyone at all.
+func (f *Filter) Enabled() bool {
+	return f != nil && (len(f.allow) > 0 || len(f.deny) > 0 || len(f.allowCountries) > 0 || len(f.denyCountries) > 0)
+}
+
+// CountryHeader returns the header carrying the client's country, empty if
+// countries are not checked.
+func (f *Filter) CountryHeader() string {
+	return f.countryHeader
+}
+
+// TrustsProxy reports whether peer, the address a request came from
+// directly, is a trusted proxy whose country header may be believed.
+func (f *Filter) TrustsProxy(peer string) bool {
+	addr, err := netip.ParseAddr(peer)
+	return err == nil && contains(f.trusted, addr.Unmap().WithZone(""))
+}
+
+// Check returns why a client at ip in country, as read from the country
+// header, is blocked, or "" if it may pass. An address that does not parse
+// matches no range, so it only passes if there is no allow list.
+func (f *Filter) Check(ip, country string) string {
+	addr, err := netip.ParseAddr(ip)
+	valid := err == nil
+	addr = addr.Unmap().WithZone("")
+
+	if valid && contains(f.deny, addr) {
+		return ReasonIPDenied
+	}
+	if len(f.allow) > 0 && (!valid || !contains(f.allow, addr)) {
+		return ReasonIPNotAllowed
+	}
+
+	country = strings.ToUpper(strings.TrimSpace(country))
+	if f.denyCountries[country] {
+		return ReasonCountryDenied
+	}
+	if len(f.allowCountries) > 0 && !f.allowCountries[country] {
+		return ReasonCountryNotAllowed
+	}
+	return ""
+}
+
+// contains reports whether any of prefixes contains addr.
+func contains(prefixes []netip.Prefix, addr netip.Addr) bool {
+	for _, p := range prefixes {
+		if p.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,87 @@
+package ipfilter
+
+import "testing"
+
+func TestCheck(t *testing.T) {
+	f, err := New(Config{
+		Allow:          []string{"192.0.2.0/24", "2001:db8::/32"},
+		Deny:           []string{"192.0.2.66", "2001:db8::bad"},
+		CountryHeader:  "CF-IPCountry",
+		TrustedProxies: []string{"10.0.0.1"},
+		DenyCountries:  []string{"kp"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name        string
+		ip, country string
+		want        string
+	}{
+		{"allowed", "192.0.2.7", "DE", ""},
+		{"allowed IPv6", "2001:db8::1", "", ""},
+		{"IPv4-mapped IPv6", "::ffff:192.0.2.7", "", ""},
+		{"deny wins over allow", "192.0.2.66", "DE", ReasonIPDenied},
+		{"deny wins over allow, IPv4-mapped", "::ffff:192.0.2.66", "", ReasonIPDenied},
+		{"deny wins over allow, IPv6", "2001:db8::bad", "", ReasonIPDenied},
+		{"outside allow list", "198.51.100.7", "DE", ReasonIPNotAllowed},
+		{"unparsable address", "not-an-ip", "", ReasonIPNotAllowed},
+		{"denied country", "192.0.2.7", " kp ", ReasonCountryDenied},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := f.Check(tt.ip, tt.country); got != tt.want {
+				t.Errorf("Check(%q, %q) = %q, want %q", tt.ip, tt.country, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCheckAllowCountries(t *testing.T) {
+	f, err := New(Config{CountryHeader: "CF-IPCountry", TrustedProxies: []string{"10.0.0.1"}, AllowCountries: []string{"DE"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := f.Check("198.51.100.7", "de"); got != "" {
+		t.Errorf("Check(allowed country) = %q", got)
+	}
+	// A client whose country is unknown, such as one that did not come
+	// through a trusted proxy, is blocked.
+	if got := f.Check("198.51.100.7", ""); got != ReasonCountryNotAllowed {
+		t.Errorf("Check(no country) = %q, want %q", got, ReasonCountryNotAllowed)
+	}
+}
+
+func TestTrustsProxy(t *testing.T) {
+	f, err := New(Config{CountryHeader: "CF-IPCountry", TrustedProxies: []string{"10.0.0.0/30"}, AllowCountries: []string{"DE"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for peer, want := range map[string]bool{
+		"10.0.0.1":        true,
+		"::ffff:10.0.0.2": true,
+		"10.0.0.4":        false,
+		"192.0.2.7":       false,
+		"":                false,
+	} {
+		if got := f.TrustsProxy(peer); got != want {
+			t.Errorf("TrustsProxy(%q) = %v, want %v", peer, got, want)
+		}
+	}
+}
+
+func TestNewRejectsInvalidConfig(t *testing.T) {
+	tests := map[string]Config{
+		"bad IP":                 {Allow: []string{"192.0.2.300"}},
+		"bad range":              {Deny: []string{"192.0.2.0/33"}},
+		"bad country":            {CountryHeader: "CF-IPCountry", TrustedProxies: []string{"10.0.0.1"}, DenyCountries: []string{"DEU"}},
+		"country without header": {DenyCountries: []string{"KP"}},
+		"header without proxies": {CountryHeader: "CF-IPCountry", DenyCountries: []string{"KP"}},
+	}
+	for name, cfg := range tests {
+		if _, err := New(cfg); err == nil {
+			t.Errorf("%s: New succeeded", name)
+		}
+	}
+}
@@ -0,0 +1,50 @@
+// Package markup cleans up message content and renders Markdown messages to
+// HTML that is safe to insert into a page. Rendering escapes all of the
+// content and only then adds the few tags it allows, so nothing a sender
+// writes is ever interpreted as HTML.
+package markup
+
+import (
+	"strings"
+	"unicode"
+)
+
+// Formats a message's content can be written in.
+const (
+	// FormatPlain content is shown as written.
+	FormatPlain = "plain"
+	// FormatMarkdown content is rendered with the Markdown subset Render
+	// supports.
+	FormatMarkdown = "markdown"
+)
+
+// ValidFormat reports whether format is FormatPlain or FormatMarkdown.
+func ValidFormat(format string) bool {
+	return format == FormatPlain || format == FormatMarkdown
+}
+
+// Sanitize cleans up content before it is stored: invalid UTF-8 is replaced,
+// line endings become \n, and control characters other than newlines and
+// tabs are removed, as are bidirectional overrides and isolates that could
+// make text display differently from what it says.
+func Sanitize(content string) string {
+	content = strings.ToValidUTF8(content, "\uFFFD")
+	content = strings.ReplaceAll(content, "\r\n", "\n")
+	return strings.Map(func(r rune) rune {
+		switch {
+		case r == '\n' || r == '\t':
+			return r
+		case r == '\r':
+			return '\n'
+		case unicode.IsControl(r), isBidiControl(r), r == '\uFEFF':
+			return -1
+		}
+		return r
+	}, content)
+}
+
+// isBidiControl reports whether r is an explicit bidirectional embedding,
+// override or isolate.
+func isBidiControl(r rune) bool {
+	return (r >= '\u202A' && r <= '\u202E') || (r >= '\u2066' && r <= '\u2069')
+}
@@ -0,0 +1,263 @@
+package markup
+
+import (
+	"html"
+	"net/url"
+	"strings"
+)
+
+// Render returns the HTML of content written in format, or "" unless format
+// is FormatMarkdown. It supports paragraphs and line breaks, fenced code
+// blocks, block quotes, bulleted and numbered lists, **bold**, *italic* or
+// _italic_, ~~strikethrough~~, `code` and [links](https://example.com).
+// The output uses only the tags p, br, pre, code, blockquote, ul, ol, li,
+// strong, em, del and a, and no attributes but the href and rel of links,
+// which must use an http, https or mailto URL.
+func Render(format, content string) string {
+	if format != FormatMarkdown || content == "" {
+		return ""
+	}
+
+	var b strings.Builder
+	lines := strings.Split(content, "\n")
+	for i := 0; i < len(lines); {
+		line := lines[i]
+		switch {
+		case strings.TrimSpace(line) == "":
+			i++
+		case strings.HasPrefix(line, "```"):
+			i = renderCodeBlock(&b, lines, i)
+		case quoteLine(line):
+			i = renderQuote(&b, lines, i)
+		case listItem(line) != "":
+			i = renderList(&b, lines, i)
+		default:
+			i = renderParagraph(&b, lines, i)
+		}
+	}
+	return b.String()
+}
+
+// renderCodeBlock writes the fenced code block starting at lines[i] and
+// returns the index of the line after it. A block that is never closed runs
+// to the end of the content.
+func renderCodeBlock(b *strings.Builder, lines []string, i int) int {
+	b.WriteString("<pre><code>")
+	i++
+	for first := true; i < len(lines); i++ {
+		if strings.HasPrefix(lines[i], "```") {
+			i++
+			break
+		}
+		if !first {
+			b.WriteByte('\n')
+		}
+		b.WriteString(html.EscapeString(lines[i]))
+		first = false
+	}
+	b.WriteString("</code></pre>")
+	return i
+}
+
+func quoteLine(line string) bool {
+	return strings.HasPrefix(line, ">")
+}
+
+// renderQuote writes the block quote starting at lines[i], its lines
+// separated by line breaks.
+func renderQuote(b *strings.Builder, lines []string, i int) int {
+	b.WriteString("<blockquote>")
+	for first := true; i < len(lines) && quoteLine(lines[i]); i++ {
+		if !first {
+			b.WriteString("<br>")
+		}
+		b.WriteString(renderInline(strings.TrimPrefix(strings.TrimPrefix(lines[i], ">"), " "), true))
+		first = false
+	}
+	b.WriteString("</blockquote>")
+	return i
+}
+
+// List kinds, named after their HTML tags.
+const (
+	bulleted = "ul"
+	numbered = "ol"
+)
+
+// listItem returns the kind of list line is an item of, or "" if it is not
+// a list item.
+func listItem(line string) string {
+	if strings.HasPrefix(line, "- ") || strings.HasPrefix(line, "* ") {
+		return bulleted
+	}
+	digits := len(line) - len(strings.TrimLeft(line, "0123456789"))
+	if digits > 0 && digits <= 9 && strings.HasPrefix(line[digits:], ". ") {
+		return numbered
+	}
+	return ""
+}
+
+// itemText returns the text of a list item after its marker.
+func itemText(line string) string {
+	return strings.TrimSpace(line[strings.Index(line, " ")+1:])
+}
+
+// renderList writes the list whose first item is lines[i], which lasts while
+// lines are items of the same kind.
+func renderList(b *strings.Builder, lines []string, i int) int {
+	kind := listItem(lines[i])
+	b.WriteString("<" + kind + ">")
+	for ; i < len(lines) && listItem(lines[i]) == kind; i++ {
+		b.WriteString("<li>" + renderInline(itemText(lines[i]), true) + "</li>")
+	}
+	b.WriteString("</" + kind + ">")
+	return i
+}
+
+// renderParagraph writes the paragraph starting at lines[i], which lasts
+// until a blank line or another kind of block.
+func renderParagraph(b *strings.Builder, lines []string, i int) int {
+	b.WriteString("<p>")
+	for first := true; i < len(lines); i++ {
+		line := lines[i]
+		if strings.TrimSpace(line) == "" || strings.HasPrefix(line, "```") || quoteLine(line) || listItem(line) != "" {
+			break
+		}
+		if !first {
+			b.WriteString("<br>")
+		}
+		b.WriteString(renderInline(line, true))
+		first = false
+	}
+	b.WriteString("</p>")
+	return i
+}
+
+// Inline delimiters and the tags they render, longest first so ** is not
+// taken for *.
+var emphasis = []struct {
+	delim, tag string
+}{
+	{"**", "strong"},
+	{"~~", "del"},
+	{"*", "em"},
+	{"_", "em"},
+}
+
+// escapable are the characters a backslash makes literal.
+const escapable = "\\`*_~[]()>#-.!"
+
+// renderInline renders the spans of one line. Links are only rendered if
+// links is set, so link text cannot contain another link.
+func renderInline(s string, links bool) string {
+	var b strings.Builder
+	for i := 0; i < len(s); {
+		rest := s[i:]
+
+		if rest[0] == '\\' && len(rest) > 1 && strings.IndexByte(escapable, rest[1]) >= 0 {
+			b.WriteString(html.EscapeString(rest[1:2]))
+			i += 2
+			continue
+		}
+
+		if rest[0] == '`' {
+			if end := strings.IndexByte(rest[1:], '`'); end > 0 {
+				b.WriteString("<code>" + html.EscapeString(rest[1:1+end]) + "</code>")
+				i += end + 2
+				continue
+			}
+		}
+
+		if rest[0] == '[' && links {
+			if text, href, n, ok := parseLink(rest); ok {
+				b.WriteString(`<a href="` + html.EscapeString(href) + `" rel="nofollow noopener noreferrer">` + renderInline(text, false) + "</a>")
+				i += n
+				continue
+			}
+		}
+
+		if inner, tag, n, ok := parseEmphasis(s, i); ok {
+			b.WriteString("<" + tag + ">" + renderInline(inner, links) + "</" + tag + ">")
+			i += n
+			continue
+		}
+
+		b.WriteString(html.EscapeString(rest[:1]))
+		i++
+	}
+	return b.String()
+}
+
+// parseEmphasis parses an emphasized span starting at s[i], returning its
+// text, its tag and its length. Underscores only emphasize whole words, so
+// snake_case names are left alone.
+func parseEmphasis(s string, i int) (string, string, int, bool) {
+	rest := s[i:]
+	for _, e := range emphasis {
+		if !strings.HasPrefix(rest, e.delim) {
+			continue
+		}
+		if e.delim == "_" && i > 0 && isWordByte(s[i-1]) {
+			return "", "", 0, false
+		}
+
+		open := len(e.delim)
+		end := strings.Index(rest[open:], e.delim)
+		if end <= 0 {
+			continue
+		}
+		inner := rest[open : open+end]
+		if strings.TrimSpace(inner) != inner {
+			continue
+		}
+		n := open + end + len(e.delim)
+		if e.delim == "_" && n < len(rest) && isWordByte(rest[n]) {
+			continue
+		}
+		return inner, e.tag, n, true
+	}
+	return "", "", 0, false
+}
+
+func isWordByte(c byte) bool {
+	return c == '_' || ('0' <= c && c <= '9') || ('a' <= c && c <= 'z') || ('A' <= c && c <= 'Z') || c >= 0x80
+}
+
+// parseLink parses a [text](href) link at the start of s, returning its
+// text, its URL and its length. Links whose URL is not allowed are not
+// parsed, so they are shown as written.
+func parseLink(s string) (string, string, int, bool) {
+	closeText := strings.Index(s, "](")
+	if closeText <= 1 {
+		return "", "", 0, false
+	}
+	closeHref := strings.IndexByte(s[closeText+2:], ')')
+	if closeHref <= 0 {
+		return "", "", 0, false
+	}
+
+	text := s[1:closeText]
+	href := s[closeText+2 : closeText+2+closeHref]
+	if strings.ContainsAny(text, "[]") || !allowedURL(href) {
+		return "", "", 0, false
+	}
+	return text, href, closeText + 2 + closeHref + 1, true
+}
+
+// allowedURL reports whether href is an absolute http, https or mailto URL.
+func allowedURL(href string) bool {
+	if strings.ContainsAny(href, " \t\"'<>\\") {
+		return false
+	}
+	u, err := url.Parse(href)
+	if err != nil {
+		return false
+	}
+	switch strings.ToLower(u.Scheme) {
+	case "http", "https":
+		return u.Host != ""
+	case "mailto":
+		return u.Opaque != ""
+	}
+	return false
+}
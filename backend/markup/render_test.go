@@ -0,0 +1,54 @@
+package markup
+
+import "testing"
+
+func TestRender(t *testing.T) {
+	const rel = ` rel="nofollow noopener noreferrer"`
+	tests := []struct {
+		name    string
+		content string
+		want    string
+	}{
+		// Nothing the sender writes becomes a tag or an attribute.
+		{"script", "<script>alert(1)</script>", "<p>&lt;script&gt;alert(1)&lt;/script&gt;</p>"},
+		{"event handler", "<img src=x onerror=alert(1)>", "<p>&lt;img src=x onerror=alert(1)&gt;</p>"},
+		{"handler inside bold", "**<b onmouseover=alert(1)>hi</b>**", "<p><strong>&lt;b onmouseover=alert(1)&gt;hi&lt;/b&gt;</strong></p>"},
+		{"tag in code", "`code <b>`", "<p><code>code &lt;b&gt;</code></p>"},
+		{"tag in code block", "```\n<script>\n", "<pre><code>&lt;script&gt;\n</code></pre>"},
+		{"tags in quote and list", "> quote <i>\n- item <u>", "<blockquote>quote &lt;i&gt;</blockquote><ul><li>item &lt;u&gt;</li></ul>"},
+		{"quote breaking out of href", `[x](https://example.com" onclick="alert(1))`, "<p>[x](https://example.com&#34; onclick=&#34;alert(1))</p>"},
+
+		// Only http, https and mailto links are linked.
+		{"javascript link", "[click](javascript:alert(1))", "<p>[click](javascript:alert(1))</p>"},
+		{"javascript link in other case", "[click](JavaScript:alert(1))", "<p>[click](JavaScript:alert(1))</p>"},
+		{"javascript link after space", "[click]( javascript:alert(1))", "<p>[click]( javascript:alert(1))</p>"},
+		{"javascript link with tab", "[click](java\tscript:alert(1))", "<p>[click](java\tscript:alert(1))</p>"},
+		{"data link", "[data](data:text/html,<script>alert(1)</script>)", "<p>[data](data:text/html,&lt;script&gt;alert(1)&lt;/script&gt;)</p>"},
+		{"https link", "[ok](https://example.com/?a=1&b=2)", `<p><a href="https://example.com/?a=1&amp;b=2"` + rel + ">ok</a></p>"},
+		{"mailto link", "[mail](mailto:a@example.com)", `<p><a href="mailto:a@example.com"` + rel + ">mail</a></p>"},
+
+		// Allowed tags always come in matching pairs.
+		{"nested", "**bold *nested* bold**", "<p><strong>bold <em>nested</em> bold</strong></p>"},
+		{"overlapping", "*a **b* c**", "<p>*a <strong>b* c</strong></p>"},
+		{"unclosed bold", "**unclosed", "<p>**unclosed</p>"},
+		{"unclosed strikethrough", "~~strike", "<p>~~strike</p>"},
+
+		// Entities are text, escaped once.
+		{"escaped tag", "&lt;script&gt;", "<p>&amp;lt;script&amp;gt;</p>"},
+		{"entities", "&amp; & &#60;", "<p>&amp;amp; &amp; &amp;#60;</p>"},
+		{"entity in link", "[&quot;](https://example.com/?q=&quot;)", `<p><a href="https://example.com/?q=&amp;quot;"` + rel + ">&amp;quot;</a></p>"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Render(FormatMarkdown, tt.content); got != tt.want {
+				t.Errorf("Render(%q) = %q, want %q", tt.content, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRenderPlain(t *testing.T) {
+	if got := Render(FormatPlain, "<b>x</b>"); got != "" {
+		t.Errorf("Render(plain) = %q, want empty", got)
+	}
+}
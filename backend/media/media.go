@@ -0,0 +1,132 @@
+// Package media processes uploaded images: it reads their dimensions and
+// renders downscaled variants, such as thumbnails, so clients need not
+// download full-size images for previews.
+package media
+
+import (
+	"errors"
+	"image"
+	"image/color"
+	"image/gif"
+	"image/jpeg"
+	"image/png"
+	"io"
+)
+
+// ThumbnailSize is the longest side, in pixels, of a thumbnail.
+const ThumbnailSize = 320
+
+// MaxPixels is the largest image, in pixels, that is decoded. Larger images
+// are rejected before decoding so a small file cannot claim gigabytes of
+// memory.
+const MaxPixels = 50_000_000
+
+// jpegQuality is the quality thumbnails of JPEG images are encoded at.
+const jpegQuality = 80
+
+// ErrTooLarge is returned for images with more than MaxPixels pixels.
+var ErrTooLarge = errors.New("image has too many pixels")
+
+// encoders maps the content types this package can decode to the content
+// type their variants are encoded as. JPEG stays JPEG; other images become
+// PNG to keep transparency.
+var encoders = map[string]string{
+	"image/jpeg": "image/jpeg",
+	"image/png":  "image/png",
+	"image/gif":  "image/png",
+}
+
+// Supported reports whether images of contentType can be processed.
+func Supported(contentType string) bool {
+	_, ok := encoders[contentType]
+	return ok
+}
+
+// Variant is a rendered variant of an image.
+type Variant struct {
+	Image       image.Image
+	ContentType string
+}
+
+// Decode reads an image of contentType, rejecting images with more than
+// MaxPixels pixels. Animated GIFs yield their first frame.
+func Decode(r io.ReadSeeker, contentType string) (image.Image, error) {
+	cfg, _, err := image.DecodeConfig(r)
+	if err != nil {
+		return nil, err
+	}
+	if cfg.Width*cfg.Height > MaxPixels {
+		return nil, ErrTooLarge
+	}
+	if _, err := r.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
+
+	switch contentType {
+	case "image/jpeg":
+		return jpeg.Decode(r)
+	case "image/png":
+		return png.Decode(r)
+	case "image/gif":
+		return gif.Decode(r)
+	}
+	return nil, image.ErrFormat
+}
+
+// Thumbnail downscales img of contentType to fit in a ThumbnailSize square,
+// keeping its aspect ratio. Images that already fit are copied as they are.
+func Thumbnail(img image.Image, contentType string) Variant {
+	b := img.Bounds()
+	w, h := b.Dx(), b.Dy()
+	if w > ThumbnailSize || h > ThumbnailSize {
+		if w >= h {
+			w, h = ThumbnailSize, max(1, h*ThumbnailSize/w)
+		} else {
+			w, h = max(1, w*ThumbnailSize/h), ThumbnailSize
+		}
+	}
+	return Variant{Image: resize(img, w, h), ContentType: encoders[contentType]}
+}
+
+// Encode writes v in its content type.
+func Encode(w io.Writer, v Variant) error {
+	if v.ContentType == "image/jpeg" {
+		return jpeg.Encode(w, v.Image, &jpeg.Options{Quality: jpegQuality})
+	}
+	return png.Encode(w, v.Image)
+}
+
+// resize scales img to w by h pixels, averaging the source pixels each
+// destination pixel covers.
+func resize(img image.Image, w, h int) *image.NRGBA {
+	src := img.Bounds()
+	dst := image.NewNRGBA(image.Rect(0, 0, w, h))
+
+	for y := 0; y < h; y++ {
+		y0 := src.Min.Y + y*src.Dy()/h
+		y1 := max(y0+1, src.Min.Y+(y+1)*src.Dy()/h)
+		for x := 0; x < w; x++ {
+			x0 := src.Min.X + x*src.Dx()/w
+			x1 := max(x0+1, src.Min.X+(x+1)*src.Dx()/w)
+
+			var r, g, b, a, n uint64
+			for sy := y0; sy < y1; sy++ {
+				for sx := x0; sx < x1; sx++ {
+					c := color.NRGBA64Model.Convert(img.At(sx, sy)).(color.NRGBA64)
+					r += uint64(c.R)
+					g += uint64(c.G)
+					b += uint64(c.B)
+					a += uint64(c.A)
+					n++
+				}
+			}
+			dst.SetNRGBA(x, y, color.NRGBA{
+				R: uint8(r / n >> 8),
+				G: uint8(g / n >> 8),
+				B: uint8(b / n >> 8),
+				A: uint8(a / n >> 8),
+			})
+		}
+	}
+	return dst
+}
@@ -0,0 +1,222 @@
+// Package metrics defines the Prometheus metrics exported by the backend
+// and the instrumentation that records them.
+package metrics
+
+import (
+	"context"
+	"database/sql/driver"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-redis/redis/v8"
+	"github.com/lib/pq"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+var (
+	httpRequestDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "chat_http_request_duration_seconds",
+		Help:    "HTTP request latency by route, method and status.",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"method", "route", "status"})
+
+	// ActiveConnections is the number of WebSocket connections open on this instance.
+	ActiveConnections = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "chat_websocket_active_connections",
+		Help: "Number of WebSocket connections open on this instance.",
+	})
+
+	// MessagesSent counts sent messages by the path they were sent through.
+	MessagesSent = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "chat_messages_sent_total",
+		Help: "Messages sent, by the path they were sent through.",
+	}, []string{"source"})
+
+	// WebSocketRedeliveries counts events written again because the client
+	// did not acknowledge them in time.
+	WebSocketRedeliveries = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "chat_websocket_redeliveries_total",
+		Help: "WebSocket events redelivered for lack of an acknowledgement.",
+	})
+
+	// SlowClientEvents counts events that did not fit in a client's send
+	// buffer, by what happened: dropped, or the client disconnected.
+	SlowClientEvents = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "chat_websocket_slow_client_events_total",
+		Help: "Events that did not fit in a client's send buffer, by action: dropped or disconnected.",
+	}, []string{"action"})
+
+	// BroadcastFailures counts messages that could not be appended to the
+	// streams of their users and were only delivered locally.
+	BroadcastFailures = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "chat_broadcast_failures_total",
+		Help: "Messages not appended to their users' streams, delivered to local clients only.",
+	})
+
+	// EventsPublished counts domain events by outcome: published to the
+	// message queue, failed, or dropped because the queue was full.
+	EventsPublished = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "chat_events_published_total",
+		Help: "Domain events by outcome: published, failed or dropped.",
+	}, []string{"result"})
+
+	// AnalyticsEvents counts usage analytics events by outcome: sent to the
+	// sink, failed, dropped because the queue was full, or skipped because
+	// the user opted out.
+	AnalyticsEvents = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "chat_analytics_events_total",
+		Help: "Usage analytics events by outcome: sent, failed, dropped or opted_out.",
+	}, []string{"result"})
+
+	dbQueryDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "chat_db_query_duration_seconds",
+		Help:    "Postgres query latency by operation.",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"operation"})
+
+	redisErrors = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "chat_redis_errors_total",
+		Help: "Failed Redis commands by command name.",
+	}, []string{"command"})
+
+	// PushNotifications counts push notification attempts by platform and result.
+	PushNotifications = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "chat_push_notifications_total",
+		Help: "Push notification attempts by platform and result.",
+	}, []string{"platform", "result"})
+
+	// AccessBlocked counts requests refused by the IP and country filter,
+	// by reason.
+	AccessBlocked = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "chat_access_blocked_total",
+		Help: "Requests refused by the IP and country filter, by reason.",
+	}, []string{"reason"})
+)
+
+// RegisterClientQueueDepth exports the number of events queued on the
+// WebSocket and stream connections of this instance, as reported by depth.
+func RegisterClientQueueDepth(depth func() int) {
+	promauto.NewGaugeFunc(prometheus.GaugeOpts{
+		Name: "chat_websocket_send_queue_depth",
+		Help: "Events queued on the connections of this instance and not yet written.",
+	}, func() float64 { return float64(depth()) })
+}
+
+// Driver is the Postgres driver wrapped with query timing.
+var Driver driver.Driver = instrumentedDriver{&pq.Driver{}}
+
+// Handler serves the Prometheus metrics.
+var Handler = gin.WrapH(promhttp.Handler())
+
+// Middleware records the latency of every HTTP request.
+func Middleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		start := time.Now()
+		c.Next()
+
+		route := c.FullPath()
+		if route == "" {
+			route = "unmatched"
+		}
+		httpRequestDuration.
+			WithLabelValues(c.Request.Method, route, strconv.Itoa(c.Writer.Status())).
+			Observe(time.Since(start).Seconds())
+	}
+}
+
+// RedisHook counts failed Redis commands. A missing key (redis.Nil) is not
+// an error.
+type RedisHook struct{}
+
+func (RedisHook) BeforeProcess(ctx context.Context, cmd redis.Cmder) (context.Context, error) {
+	return ctx, nil
+}
+
+func (RedisHook) AfterProcess(ctx context.Context, cmd redis.Cmder) error {
+	if err := cmd.Err(); err != nil && err != redis.Nil {
+		redisErrors.WithLabelValues(cmd.Name()).Inc()
+	}
+	return nil
+}
+
+func (RedisHook) BeforeProcessPipeline(ctx context.Context, cmds []redis.Cmder) (context.Context, error) {
+	return ctx, nil
+}
+
+func (h RedisHook) AfterProcessPipeline(ctx context.Context, cmds []redis.Cmder) error {
+	for _, cmd := range cmds {
+		h.AfterProcess(ctx, cmd)
+	}
+	return nil
+}
+
+// instrumentedDriver wraps a database/sql driver and times every query.
+type instrumentedDriver struct {
+	driver.Driver
+}
+
+func (d instrumentedDriver) Open(name string) (driver.Conn, error) {
+	conn, err := d.Driver.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	return &instrumentedConn{conn}, nil
+}
+
+// instrumentedConn forwards to the wrapped connection, observing query
+// durations. The wrapped connection must support the context interfaces,
+// as lib/pq does.
+type instrumentedConn struct {
+	driver.Conn
+}
+
+func (c *instrumentedConn) BeginTx(ctx context.Context, opts driver.TxOptions) (driver.Tx, error) {
+	return c.Conn.(driver.ConnBeginTx).BeginTx(ctx, opts)
+}
+
+func (c *instrumentedConn) PrepareContext(ctx context.Context, query string) (driver.Stmt, error) {
+	stmt, err := c.Conn.(driver.ConnPrepareContext).PrepareContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	return &instrumentedStmt{stmt}, nil
+}
+
+func (c *instrumentedConn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	defer observeQuery("exec", time.Now())
+	return c.Conn.(driver.ExecerContext).ExecContext(ctx, query, args)
+}
+
+func (c *instrumentedConn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	defer observeQuery("query", time.Now())
+	return c.Conn.(driver.QueryerContext).QueryContext(ctx, query, args)
+}
+
+func (c *instrumentedConn) Ping(ctx context.Context) error {
+	return c.Conn.(driver.Pinger).Ping(ctx)
+}
+
+// instrumentedStmt forwards to the wrapped prepared statement, observing
+// the duration of each run. The statement cache prepares most queries, so
+// they are timed here rather than by instrumentedConn.
+type instrumentedStmt struct {
+	driver.Stmt
+}
+
+func (s *instrumentedStmt) ExecContext(ctx context.Context, args []driver.NamedValue) (driver.Result, error) {
+	defer observeQuery("exec", time.Now())
+	return s.Stmt.(driver.StmtExecContext).ExecContext(ctx, args)
+}
+
+func (s *instrumentedStmt) QueryContext(ctx context.Context, args []driver.NamedValue) (driver.Rows, error) {
+	defer observeQuery("query", time.Now())
+	return s.Stmt.(driver.StmtQueryContext).QueryContext(ctx, args)
+}
+
+// observeQuery records the duration of a DB operation that began at start.
+func observeQuery(operation string, start time.Time) {
+	dbQueryDuration.WithLabelValues(operation).Observe(time.Since(start).Seconds())
+}
@@ -0,0 +1,66 @@
+package moderation
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// apiTimeout bounds each request to an external moderation API.
+const apiTimeout = 5 * time.Second
+
+// API asks an external moderation service about content. The service is
+// sent {"content": "..."} and must answer {"flagged": bool, "categories": [...]}.
+type API struct {
+	url    string
+	client *http.Client
+}
+
+// NewAPI creates a filter backed by the moderation service at url.
+func NewAPI(url string) *API {
+	return &API{url: url, client: &http.Client{Timeout: apiTimeout}}
+}
+
+func (a *API) Check(ctx context.Context, content string) (Finding, error) {
+	body, err := json.Marshal(map[string]string{"content": content})
+	if err != nil {
+		return Finding{}, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, a.url, bytes.NewReader(body))
+	if err != nil {
+		return Finding{}, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := a.client.Do(req)
+	if err != nil {
+		return Finding{}, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return Finding{}, fmt.Errorf("moderation API returned %s", resp.Status)
+	}
+
+	var result struct {
+		Flagged    bool     `json:"flagged"`
+		Categories []string `json:"categories"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return Finding{}, fmt.Errorf("error decoding moderation API response: %v", err)
+	}
+	if !result.Flagged {
+		return Finding{}, nil
+	}
+
+	reason := "moderation_api"
+	if len(result.Categories) > 0 {
+		reason += ": " + strings.Join(result.Categories, ", ")
+	}
+	return Finding{Matched: true, Reason: reason}, nil
+}
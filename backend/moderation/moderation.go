@@ -0,0 +1,127 @@
+// Package moderation screens message content before it is delivered. A
+// Pipeline runs pluggable filters and turns what they find into an action
+// depending on how strict the conversation is.
+package moderation
+
+import (
+	"context"
+	"fmt"
+	"log"
+)
+
+// Strictness is how severely a conversation treats filtered content.
+type Strictness int
+
+const (
+	// Off delivers everything unchanged.
+	Off Strictness = iota
+	// Low delivers matching messages but flags them for review.
+	Low
+	// Medium masks matched terms, flagging findings that cannot be masked.
+	Medium
+	// High rejects matching messages.
+	High
+)
+
+var strictnessNames = []string{"off", "low", "medium", "high"}
+
+func (s Strictness) String() string {
+	return strictnessNames[s]
+}
+
+// ParseStrictness parses off, low, medium or high.
+func ParseStrictness(s string) (Strictness, error) {
+	for i, name := range strictnessNames {
+		if s == name {
+			return Strictness(i), nil
+		}
+	}
+	return Off, fmt.Errorf("invalid strictness %q, expected off, low, medium or high", s)
+}
+
+// Action is what happens to a message after filtering, from least to most severe.
+type Action int
+
+const (
+	Allow Action = iota
+	Flag
+	Mask
+	Reject
+)
+
+// Verdict is the outcome of filtering a message.
+type Verdict struct {
+	Action Action
+	// Content is the message content, with matched terms masked if Action is Mask.
+	Content string
+	// Reasons describe what the filters found.
+	Reasons []string
+	// Flagged reports whether a finding should be recorded for review, which
+	// may be the case even if the content was also masked.
+	Flagged bool
+}
+
+// Finding is what a filter found in some content.
+type Finding struct {
+	Matched bool
+	Reason  string
+}
+
+// Filter detects unwanted content.
+type Filter interface {
+	Check(ctx context.Context, content string) (Finding, error)
+}
+
+// Masker is implemented by filters that can hide the terms they match.
+type Masker interface {
+	Mask(content string) string
+}
+
+// Pipeline runs content through a chain of filters.
+type Pipeline struct {
+	filters []Filter
+}
+
+// NewPipeline creates a pipeline of the given filters, run in order.
+func NewPipeline(filters ...Filter) *Pipeline {
+	return &Pipeline{filters: filters}
+}
+
+// Apply filters content at the given strictness. A filter that fails is
+// skipped so an unavailable moderation service does not block chat.
+func (p *Pipeline) Apply(ctx context.Context, content string, strictness Strictness) Verdict {
+	v := Verdict{Action: Allow, Content: content}
+	if strictness == Off {
+		return v
+	}
+
+	for _, f := range p.filters {
+		finding, err := f.Check(ctx, v.Content)
+		if err != nil {
+			log.Printf("Content filter error: %v", err)
+			continue
+		}
+		if !finding.Matched {
+			continue
+		}
+		v.Reasons = append(v.Reasons, finding.Reason)
+
+		action := Flag
+		switch strictness {
+		case High:
+			action = Reject
+		case Medium:
+			if m, ok := f.(Masker); ok {
+				v.Content = m.Mask(v.Content)
+				action = Mask
+			}
+		}
+		if action == Flag {
+			v.Flagged = true
+		}
+		if action > v.Action {
+			v.Action = action
+		}
+	}
+	return v
+}
@@ -0,0 +1,76 @@
+package moderation
+
+import (
+	"bufio"
+	"context"
+	"os"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+)
+
+// Wordlist matches whole words from a list, ignoring case.
+type Wordlist struct {
+	pattern *regexp.Regexp
+}
+
+// NewWordlist creates a filter matching any of words.
+func NewWordlist(words []string) *Wordlist {
+	quoted := make([]string, 0, len(words))
+	for _, w := range words {
+		if w = strings.TrimSpace(w); w != "" {
+			quoted = append(quoted, regexp.QuoteMeta(w))
+		}
+	}
+	if len(quoted) == 0 {
+		return &Wordlist{}
+	}
+	return &Wordlist{pattern: regexp.MustCompile(`(?i)\b(` + strings.Join(quoted, "|") + `)\b`)}
+}
+
+// LoadWordlist reads a wordlist file in the format of ReadWords.
+func LoadWordlist(path string) (*Wordlist, error) {
+	words, err := ReadWords(path)
+	if err != nil {
+		return nil, err
+	}
+	return NewWordlist(words), nil
+}
+
+// ReadWords reads a file with one word per line. Blank lines and lines
+// starting with # are ignored.
+func ReadWords(path string) ([]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var words []string
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		words = append(words, line)
+	}
+	return words, scanner.Err()
+}
+
+func (w *Wordlist) Check(ctx context.Context, content string) (Finding, error) {
+	if w.pattern == nil || !w.pattern.MatchString(content) {
+		return Finding{}, nil
+	}
+	return Finding{Matched: true, Reason: "wordlist"}, nil
+}
+
+// Mask replaces every matched word with asterisks of the same length.
+func (w *Wordlist) Mask(content string) string {
+	if w.pattern == nil {
+		return content
+	}
+	return w.pattern.ReplaceAllStringFunc(content, func(m string) string {
+		return strings.Repeat("*", utf8.RuneCountInString(m))
+	})
+}
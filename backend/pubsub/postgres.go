@@ -0,0 +1,110 @@
+package pubsub
+
+import (
+	"context"
+	"database/sql"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// Postgres listener settings. Notification payloads must be shorter than
+// maxNotifyPayload bytes; larger ones are stored in the pubsub_payloads
+// table for payloadTTL, and notified as payloadRef followed by their ID.
+const (
+	minReconnectInterval = time.Second
+	maxReconnectInterval = time.Minute
+	maxNotifyPayload     = 8000
+	payloadRef           = "@"
+	payloadTTL           = 5 * time.Minute
+)
+
+// Postgres publishes with NOTIFY and subscribes with LISTEN, so instances
+// sharing a database need nothing else to reach each other.
+type Postgres struct {
+	db      *sql.DB
+	connStr string
+}
+
+// NewPostgres returns a Bus notifying through db. Subscriptions listen on
+// connections of their own to connStr.
+func NewPostgres(db *sql.DB, connStr string) *Postgres {
+	return &Postgres{db: db, connStr: connStr}
+}
+
+func (p *Postgres) Publish(ctx context.Context, channel string, payload []byte) error {
+	if len(payload) < maxNotifyPayload && !strings.HasPrefix(string(payload), payloadRef) {
+		_, err := p.db.ExecContext(ctx, "SELECT pg_notify($1, $2)", channel, string(payload))
+		return err
+	}
+
+	// Payloads too large to notify are fetched from the table by the
+	// listeners. Expired payloads are deleted as new ones are stored.
+	_, err := p.db.ExecContext(ctx, `
+		WITH expired AS (
+			DELETE FROM pubsub_payloads WHERE created_at < CURRENT_TIMESTAMP - make_interval(secs => $3)
+		), stored AS (
+			INSERT INTO pubsub_payloads (payload) VALUES ($2) RETURNING id
+		)
+		SELECT pg_notify($1, $4 || id) FROM stored`,
+		channel, string(payload), payloadTTL.Seconds(), payloadRef)
+	return err
+}
+
+func (p *Postgres) Subscribe(ctx context.Context, channels ...string) (Subscription, error) {
+	listener := pq.NewListener(p.connStr, minReconnectInterval, maxReconnectInterval, func(event pq.ListenerEventType, err error) {
+		switch event {
+		case pq.ListenerEventDisconnected, pq.ListenerEventConnectionAttemptFailed:
+			log.Printf("Postgres listener disconnected: %v", err)
+		case pq.ListenerEventReconnected:
+			log.Println("Postgres listener reconnected")
+		}
+	})
+	for _, channel := range channels {
+		if err := listener.Listen(channel); err != nil {
+			listener.Close()
+			return nil, err
+		}
+	}
+
+	sub := &postgresSubscription{listener: listener, messages: make(chan Message)}
+	go sub.receive(p.db)
+	return sub, nil
+}
+
+type postgresSubscription struct {
+	listener *pq.Listener
+	messages chan Message
+}
+
+// receive forwards notifications until the listener is closed, fetching
+// payloads that were stored instead of notified.
+func (s *postgresSubscription) receive(db *sql.DB) {
+	defer close(s.messages)
+	for n := range s.listener.Notify {
+		// A nil notification reports a reconnection.
+		if n == nil {
+			continue
+		}
+
+		payload := n.Extra
+		if id, ok := strings.CutPrefix(payload, payloadRef); ok {
+			err := db.QueryRowContext(context.Background(), "SELECT payload FROM pubsub_payloads WHERE id = $1", id).Scan(&payload)
+			if err != nil {
+				log.Printf("Error fetching payload %s published on %s: %v", id, n.Channel, err)
+				continue
+			}
+		}
+		s.messages <- Message{Channel: n.Channel, Payload: payload}
+	}
+}
+
+func (s *postgresSubscription) Messages() <-chan Message {
+	return s.messages
+}
+
+func (s *postgresSubscription) Close() error {
+	return s.listener.Close()
+}
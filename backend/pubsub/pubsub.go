@@ -0,0 +1,36 @@
+// Package pubsub carries messages and events between backend instances, so
+// each can deliver what any other published to the clients connected to it.
+// Delivery through a Bus is at most once: instances that are disconnected
+// when something is published miss it. Messages go through Streams instead,
+// which deliver them at least once to the instances hosting their users.
+package pubsub
+
+import "context"
+
+// Backends a Bus can publish through.
+const (
+	BackendRedis    = "redis"
+	BackendPostgres = "postgres"
+)
+
+// Message is a payload published on a channel.
+type Message struct {
+	Channel string
+	Payload string
+}
+
+// Bus publishes payloads to every instance subscribed to their channel.
+type Bus interface {
+	Publish(ctx context.Context, channel string, payload []byte) error
+	// Subscribe receives the messages published on channels until the
+	// subscription is closed.
+	Subscribe(ctx context.Context, channels ...string) (Subscription, error)
+}
+
+// Subscription receives published messages.
+type Subscription interface {
+	// Messages returns the channel messages are received on. It is closed
+	// once the subscription is.
+	Messages() <-chan Message
+	Close() error
+}
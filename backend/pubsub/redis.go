@@ -0,0 +1,46 @@
+package pubsub
+
+import (
+	"context"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// Redis publishes through Redis Pub/Sub.
+type Redis struct {
+	rdb *redis.Client
+}
+
+// NewRedis returns a Bus publishing through rdb.
+func NewRedis(rdb *redis.Client) *Redis {
+	return &Redis{rdb: rdb}
+}
+
+func (r *Redis) Publish(ctx context.Context, channel string, payload []byte) error {
+	return r.rdb.Publish(ctx, channel, payload).Err()
+}
+
+func (r *Redis) Subscribe(ctx context.Context, channels ...string) (Subscription, error) {
+	ps := r.rdb.Subscribe(ctx, channels...)
+	messages := make(chan Message)
+	go func() {
+		defer close(messages)
+		for m := range ps.Channel() {
+			messages <- Message{Channel: m.Channel, Payload: m.Payload}
+		}
+	}()
+	return &redisSubscription{ps: ps, messages: messages}, nil
+}
+
+type redisSubscription struct {
+	ps       *redis.PubSub
+	messages chan Message
+}
+
+func (s *redisSubscription) Messages() <-chan Message {
+	return s.messages
+}
+
+func (s *redisSubscription) Close() error {
+	return s.ps.Close()
+}
@@ -0,0 +1,151 @@
+package pubsub
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+const (
+	// StreamMaxLen caps the entries kept in each user's stream.
+	StreamMaxLen = 1000
+	// StreamTTL is how long a user's stream is kept after its last entry.
+	StreamTTL = 7 * 24 * time.Hour
+)
+
+// ErrNoGroup is returned by Streams.Read when a stream read has no consumer
+// group for this instance, because the user left or Redis lost its data.
+var ErrNoGroup = errors.New("consumer group missing")
+
+// Streams delivers payloads to users through a Redis stream per user. Each
+// instance reads the streams of the users connected to it in a consumer
+// group of its own, named after the instance, and acknowledges entries once
+// it has delivered them, so an entry is delivered at least once to every
+// instance hosting the user, including one that restarts under the same
+// name in between.
+type Streams struct {
+	rdb   *redis.Client
+	group string
+}
+
+// Entry is a payload read from a user's stream.
+type Entry struct {
+	Username string
+	ID       string
+	Payload  string
+}
+
+// NewStreams returns Streams reading in the consumer group of the instance
+// instanceID.
+func NewStreams(rdb *redis.Client, instanceID string) *Streams {
+	return &Streams{rdb: rdb, group: instanceID}
+}
+
+// streamKey returns the Redis key of username's stream.
+func streamKey(username string) string {
+	return fmt.Sprintf("stream:messages:%s", username)
+}
+
+// Append adds payload to the streams of the users, each once.
+func (s *Streams) Append(ctx context.Context, payload []byte, usernames ...string) error {
+	seen := make(map[string]bool)
+	_, err := s.rdb.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		for _, username := range usernames {
+			if seen[username] {
+				continue
+			}
+			seen[username] = true
+			key := streamKey(username)
+			pipe.XAdd(ctx, &redis.XAddArgs{
+				Stream: key,
+				MaxLen: StreamMaxLen,
+				Approx: true,
+				Values: map[string]interface{}{"payload": payload},
+			})
+			pipe.Expire(ctx, key, StreamTTL)
+		}
+		return nil
+	})
+	return err
+}
+
+// Join creates this instance's consumer group on username's stream, starting
+// after its latest entry. It reports true if the group already existed, as
+// it does when the instance restarted while the user was connected, in
+// which case entries appended in between are read as well.
+func (s *Streams) Join(ctx context.Context, username string) (bool, error) {
+	err := s.rdb.XGroupCreateMkStream(ctx, streamKey(username), s.group, "$").Err()
+	if err != nil && strings.HasPrefix(err.Error(), "BUSYGROUP") {
+		return true, nil
+	}
+	return false, err
+}
+
+// Leave removes this instance's consumer group from username's stream.
+func (s *Streams) Leave(ctx context.Context, username string) error {
+	return s.rdb.XGroupDestroy(ctx, streamKey(username), s.group).Err()
+}
+
+// Read returns up to count entries per user from the streams of the users.
+// With pending set it returns the entries read before but never
+// acknowledged; otherwise it returns new entries, waiting up to block for
+// one.
+func (s *Streams) Read(ctx context.Context, usernames []string, pending bool, count int64, block time.Duration) ([]Entry, error) {
+	if len(usernames) == 0 {
+		return nil, nil
+	}
+	start := ">"
+	if pending {
+		start = "0"
+		block = -1
+	}
+	args := make([]string, 0, 2*len(usernames))
+	for _, username := range usernames {
+		args = append(args, streamKey(username))
+	}
+	for range usernames {
+		args = append(args, start)
+	}
+
+	streams, err := s.rdb.XReadGroup(ctx, &redis.XReadGroupArgs{
+		Group:    s.group,
+		Consumer: s.group,
+		Streams:  args,
+		Count:    count,
+		Block:    block,
+	}).Result()
+	if err == redis.Nil {
+		return nil, nil
+	}
+	if err != nil {
+		if strings.HasPrefix(err.Error(), "NOGROUP") {
+			return nil, ErrNoGroup
+		}
+		return nil, err
+	}
+
+	var entries []Entry
+	for _, stream := range streams {
+		username := strings.TrimPrefix(stream.Stream, streamKey(""))
+		for _, m := range stream.Messages {
+			payload, _ := m.Values["payload"].(string)
+			entries = append(entries, Entry{Username: username, ID: m.ID, Payload: payload})
+		}
+	}
+	return entries, nil
+}
+
+// Ack acknowledges entries as delivered.
+func (s *Streams) Ack(ctx context.Context, entries []Entry) error {
+	_, err := s.rdb.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		for _, e := range entries {
+			pipe.XAck(ctx, streamKey(e.Username), s.group, e.ID)
+		}
+		return nil
+	})
+	return err
+}
@@ -0,0 +1,275 @@
+package push
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"net/url"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+	"golang.org/x/oauth2"
+	"golang.org/x/oauth2/google"
+)
+
+// pushRequestTimeout bounds a single request to a push service.
+const pushRequestTimeout = 10 * time.Second
+
+// errDeviceGone is returned by a provider when the device token is no longer
+// valid and should be deleted.
+var errDeviceGone = errors.New("device token is no longer registered")
+
+// Notification is the content of a push notification.
+type Notification struct {
+	Title     string `json:"title"`
+	Body      string `json:"body"`
+	MessageID string `json:"message_id,omitempty"`
+}
+
+// Provider delivers notifications to one platform's devices.
+type Provider interface {
+	Send(ctx context.Context, token string, n Notification) error
+}
+
+// checkPushResponse maps a push service response to an error.
+func checkPushResponse(resp *http.Response) error {
+	defer resp.Body.Close()
+	switch {
+	case resp.StatusCode >= 200 && resp.StatusCode < 300:
+		return nil
+	case resp.StatusCode == http.StatusNotFound || resp.StatusCode == http.StatusGone:
+		return errDeviceGone
+	default:
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("push service returned %s: %s", resp.Status, body)
+	}
+}
+
+// fcmProvider sends notifications through the Firebase Cloud Messaging v1 API.
+type fcmProvider struct {
+	client    *http.Client
+	projectID string
+}
+
+// newFCMProvider authenticates with a Firebase service account file.
+func newFCMProvider(credentialsFile string) (*fcmProvider, error) {
+	data, err := os.ReadFile(credentialsFile)
+	if err != nil {
+		return nil, err
+	}
+	creds, err := google.CredentialsFromJSON(context.Background(), data, "https://www.googleapis.com/auth/firebase.messaging")
+	if err != nil {
+		return nil, err
+	}
+	client := oauth2.NewClient(context.Background(), creds.TokenSource)
+	client.Timeout = pushRequestTimeout
+	return &fcmProvider{client: client, projectID: creds.ProjectID}, nil
+}
+
+func (p *fcmProvider) Send(ctx context.Context, token string, n Notification) error {
+	body, err := json.Marshal(map[string]interface{}{
+		"message": map[string]interface{}{
+			"token":        token,
+			"notification": map[string]string{"title": n.Title, "body": n.Body},
+			"data":         map[string]string{"message_id": n.MessageID},
+		},
+	})
+	if err != nil {
+		return err
+	}
+
+	endpoint := fmt.Sprintf("https://fcm.googleapis.com/v1/projects/%s/messages:send", p.projectID)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return err
+	}
+	return checkPushResponse(resp)
+}
+
+// apnsProvider sends notifications through Apple Push Notification service
+// using token based (.p8 key) authentication.
+type apnsProvider struct {
+	client *http.Client
+	host   string
+	topic  string
+	keyID  string
+	teamID string
+	key    *ecdsa.PrivateKey
+
+	mu       sync.Mutex
+	token    string
+	tokenExp time.Time
+}
+
+// newAPNsProvider loads the APNs signing key from a .p8 file.
+func newAPNsProvider(keyFile, keyID, teamID, topic string, production bool) (*apnsProvider, error) {
+	data, err := os.ReadFile(keyFile)
+	if err != nil {
+		return nil, err
+	}
+	key, err := jwt.ParseECPrivateKeyFromPEM(data)
+	if err != nil {
+		return nil, err
+	}
+
+	host := "https://api.sandbox.push.apple.com"
+	if production {
+		host = "https://api.push.apple.com"
+	}
+
+	return &apnsProvider{
+		client: &http.Client{Timeout: pushRequestTimeout},
+		host:   host,
+		topic:  topic,
+		keyID:  keyID,
+		teamID: teamID,
+		key:    key,
+	}, nil
+}
+
+// authToken returns the provider JWT, reusing it for 50 minutes as Apple
+// rejects tokens refreshed too often.
+func (p *apnsProvider) authToken() (string, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.token != "" && time.Now().Before(p.tokenExp) {
+		return p.token, nil
+	}
+
+	t := jwt.NewWithClaims(jwt.SigningMethodES256, jwt.RegisteredClaims{
+		Issuer:   p.teamID,
+		IssuedAt: jwt.NewNumericDate(time.Now()),
+	})
+	t.Header["kid"] = p.keyID
+
+	signed, err := t.SignedString(p.key)
+	if err != nil {
+		return "", err
+	}
+	p.token = signed
+	p.tokenExp = time.Now().Add(50 * time.Minute)
+	return signed, nil
+}
+
+func (p *apnsProvider) Send(ctx context.Context, token string, n Notification) error {
+	body, err := json.Marshal(map[string]interface{}{
+		"aps": map[string]interface{}{
+			"alert": map[string]string{"title": n.Title, "body": n.Body},
+			"sound": "default",
+		},
+		"message_id": n.MessageID,
+	})
+	if err != nil {
+		return err
+	}
+
+	auth, err := p.authToken()
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, p.host+"/3/device/"+url.PathEscape(token), bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "bearer "+auth)
+	req.Header.Set("apns-topic", p.topic)
+	req.Header.Set("apns-push-type", "alert")
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode == http.StatusBadRequest {
+		// APNs reports unknown tokens as 400 BadDeviceToken.
+		var reason struct {
+			Reason string `json:"reason"`
+		}
+		json.NewDecoder(resp.Body).Decode(&reason)
+		resp.Body.Close()
+		if reason.Reason == "BadDeviceToken" {
+			return errDeviceGone
+		}
+		return fmt.Errorf("APNs rejected notification: %s", reason.Reason)
+	}
+	return checkPushResponse(resp)
+}
+
+// webPushProvider sends payload-less Web Push messages authenticated with
+// VAPID. The device token is the browser's push subscription endpoint; the
+// service worker fetches unread messages when it is woken up.
+type webPushProvider struct {
+	client    *http.Client
+	key       *ecdsa.PrivateKey
+	publicKey string
+	subject   string
+}
+
+// newWebPushProvider builds a provider from a base64url encoded P-256
+// private key, as generated by common VAPID tooling.
+func newWebPushProvider(privateKey, subject string) (*webPushProvider, error) {
+	d, err := base64.RawURLEncoding.DecodeString(privateKey)
+	if err != nil || len(d) != 32 {
+		return nil, errors.New("VAPID private key must be 32 base64url encoded bytes")
+	}
+
+	curve := elliptic.P256()
+	key := &ecdsa.PrivateKey{D: new(big.Int).SetBytes(d)}
+	key.PublicKey.Curve = curve
+	key.PublicKey.X, key.PublicKey.Y = curve.ScalarBaseMult(d)
+
+	return &webPushProvider{
+		client:    &http.Client{Timeout: pushRequestTimeout},
+		key:       key,
+		publicKey: base64.RawURLEncoding.EncodeToString(elliptic.Marshal(curve, key.PublicKey.X, key.PublicKey.Y)),
+		subject:   subject,
+	}, nil
+}
+
+func (p *webPushProvider) Send(ctx context.Context, endpoint string, n Notification) error {
+	u, err := url.Parse(endpoint)
+	if err != nil || u.Scheme != "https" {
+		return errDeviceGone
+	}
+
+	t := jwt.NewWithClaims(jwt.SigningMethodES256, jwt.RegisteredClaims{
+		Audience:  jwt.ClaimStrings{u.Scheme + "://" + u.Host},
+		ExpiresAt: jwt.NewNumericDate(time.Now().Add(12 * time.Hour)),
+		Subject:   p.subject,
+	})
+	signed, err := t.SignedString(p.key)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", fmt.Sprintf("vapid t=%s, k=%s", signed, p.publicKey))
+	req.Header.Set("TTL", "86400")
+	req.Header.Set("Urgency", "high")
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return err
+	}
+	return checkPushResponse(resp)
+}
@@ -0,0 +1,210 @@
+// Package push sends push notifications to the devices of users who are
+// not connected, through FCM, APNs and Web Push.
+package push
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"slices"
+	"time"
+
+	"backend/metrics"
+	"backend/store"
+
+	"github.com/go-redis/redis/v8"
+)
+
+const (
+	// queueKey is the Redis list holding pending push notifications.
+	queueKey = "push:queue"
+	// maxAttempts is how many times a notification is tried before it is dropped.
+	maxAttempts = 5
+	// baseBackoff is the delay before the first retry; it doubles per attempt.
+	baseBackoff = 2 * time.Second
+	// previewLength is the number of characters of a message shown in a notification.
+	previewLength = 100
+)
+
+// Device platforms accepted for registration.
+const (
+	PlatformFCM     = "fcm"
+	PlatformAPNs    = "apns"
+	PlatformWebPush = "webpush"
+)
+
+// ValidPlatform reports whether devices of platform can be registered.
+func ValidPlatform(platform string) bool {
+	return platform == PlatformFCM || platform == PlatformAPNs || platform == PlatformWebPush
+}
+
+// Config holds the provider credentials; platforms left unconfigured are skipped.
+type Config struct {
+	FCMCredentialsFile string
+	APNSKeyFile        string
+	APNSKeyID          string
+	APNSTeamID         string
+	APNSTopic          string
+	APNSProduction     bool
+	VAPIDPrivateKey    string
+	VAPIDSubject       string
+}
+
+// job is a notification queued for a single device.
+type job struct {
+	DeviceID     string       `json:"device_id"`
+	Platform     string       `json:"platform"`
+	Token        string       `json:"token"`
+	Notification Notification `json:"notification"`
+	Attempt      int          `json:"attempt"`
+}
+
+// Dispatcher queues notifications in Redis, so any instance may send them,
+// and delivers them with retries.
+type Dispatcher struct {
+	devices   store.DeviceStore
+	rdb       *redis.Client
+	providers map[string]Provider
+
+	// VAPIDPublicKey is handed to browsers subscribing to Web Push; it is
+	// empty when Web Push is not configured.
+	VAPIDPublicKey string
+}
+
+// New sets up the providers whose credentials are configured.
+func New(cfg Config, devices store.DeviceStore, rdb *redis.Client) (*Dispatcher, error) {
+	d := &Dispatcher{devices: devices, rdb: rdb, providers: map[string]Provider{}}
+
+	if cfg.FCMCredentialsFile != "" {
+		p, err := newFCMProvider(cfg.FCMCredentialsFile)
+		if err != nil {
+			return nil, fmt.Errorf("FCM: %v", err)
+		}
+		d.providers[PlatformFCM] = p
+	}
+	if cfg.APNSKeyFile != "" {
+		p, err := newAPNsProvider(cfg.APNSKeyFile, cfg.APNSKeyID, cfg.APNSTeamID, cfg.APNSTopic, cfg.APNSProduction)
+		if err != nil {
+			return nil, fmt.Errorf("APNs: %v", err)
+		}
+		d.providers[PlatformAPNs] = p
+	}
+	if cfg.VAPIDPrivateKey != "" {
+		p, err := newWebPushProvider(cfg.VAPIDPrivateKey, cfg.VAPIDSubject)
+		if err != nil {
+			return nil, fmt.Errorf("Web Push: %v", err)
+		}
+		d.providers[PlatformWebPush] = p
+		d.VAPIDPublicKey = p.publicKey
+	}
+	return d, nil
+}
+
+// Notify queues a notification of msg to each of the receiver's devices,
+// subject to their notification preferences. Nothing is sent during the
+// receiver's quiet hours or if they muted the conversation. A message
+// mentioning the receiver says so in the title.
+func (d *Dispatcher) Notify(ctx context.Context, msg store.Message) {
+	prefs, err := d.devices.NotificationPreferences(ctx, msg.Receiver)
+	if err != nil {
+		log.Printf("Error fetching notification preferences of %s: %v", msg.Receiver, err)
+		return
+	}
+	if !prefs.PushEnabled || (prefs.QuietHours != nil && prefs.QuietHours.Contains(time.Now())) {
+		return
+	}
+	muted, err := d.devices.Muted(ctx, msg.Receiver, msg.Sender)
+	if err != nil {
+		log.Printf("Error checking mutes of %s: %v", msg.Receiver, err)
+		return
+	}
+	if muted {
+		return
+	}
+
+	n := Notification{Title: msg.Sender, Body: "New message", MessageID: msg.ID}
+	if slices.Contains(msg.Mentions, msg.Receiver) {
+		n.Title = msg.Sender + " mentioned you"
+	}
+	if prefs.ShowPreview {
+		n.Body = store.Truncate(msg.Content, previewLength)
+	}
+
+	devices, err := d.devices.Devices(ctx, msg.Receiver)
+	if err != nil {
+		log.Printf("Error fetching devices of %s: %v", msg.Receiver, err)
+		return
+	}
+	for _, device := range devices {
+		d.enqueue(job{DeviceID: device.ID, Platform: device.Platform, Token: device.Token, Notification: n})
+	}
+}
+
+// enqueue adds a job to the push queue shared by every instance.
+func (d *Dispatcher) enqueue(j job) {
+	payload, err := json.Marshal(j)
+	if err != nil {
+		log.Printf("Error encoding push job: %v", err)
+		return
+	}
+	if err := d.rdb.LPush(context.Background(), queueKey, payload).Err(); err != nil {
+		log.Printf("Error queueing push notification: %v", err)
+	}
+}
+
+// Run delivers queued push notifications until ctx is done.
+func (d *Dispatcher) Run(ctx context.Context) {
+	for ctx.Err() == nil {
+		result, err := d.rdb.BRPop(ctx, 5*time.Second, queueKey).Result()
+		if err == redis.Nil {
+			continue
+		}
+		if err != nil {
+			if ctx.Err() == nil {
+				log.Printf("Error reading push queue: %v", err)
+				time.Sleep(time.Second)
+			}
+			continue
+		}
+
+		var j job
+		if err := json.Unmarshal([]byte(result[1]), &j); err != nil {
+			log.Printf("Error decoding push job: %v", err)
+			continue
+		}
+		d.dispatch(ctx, j)
+	}
+}
+
+// dispatch sends one notification, retrying with exponential backoff on
+// failure and forgetting devices the push service no longer knows.
+func (d *Dispatcher) dispatch(ctx context.Context, j job) {
+	provider, ok := d.providers[j.Platform]
+	if !ok {
+		metrics.PushNotifications.WithLabelValues(j.Platform, "unconfigured").Inc()
+		return
+	}
+
+	sendCtx, cancel := context.WithTimeout(ctx, pushRequestTimeout)
+	err := provider.Send(sendCtx, j.Token, j.Notification)
+	cancel()
+
+	switch {
+	case err == nil:
+		metrics.PushNotifications.WithLabelValues(j.Platform, "sent").Inc()
+	case errors.Is(err, errDeviceGone):
+		metrics.PushNotifications.WithLabelValues(j.Platform, "invalid_token").Inc()
+		if err := d.devices.DeleteDevice(ctx, j.DeviceID); err != nil {
+			log.Printf("Error removing device %s: %v", j.DeviceID, err)
+		}
+	case j.Attempt+1 >= maxAttempts:
+		metrics.PushNotifications.WithLabelValues(j.Platform, "failed").Inc()
+		log.Printf("Giving up on push to device %s: %v", j.DeviceID, err)
+	default:
+		metrics.PushNotifications.WithLabelValues(j.Platform, "retried").Inc()
+		j.Attempt++
+		time.AfterFunc(baseBackoff<<(j.Attempt-1), func() { d.enqueue(j) })
+	}
+}
@@ -0,0 +1,103 @@
+package ratelimit
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// Backoff describes a lockout: after Threshold consecutive failures a
+// subject is locked out for BaseDelay, doubling with every further failure up
+// to MaxDelay. Failures are forgotten Window after the last one.
+type Backoff struct {
+	Name      string
+	Threshold int
+	BaseDelay time.Duration
+	MaxDelay  time.Duration
+	Window    time.Duration
+}
+
+// failureScript atomically counts a failure in the hash stored in KEYS[1]
+// and locks the subject out once the threshold is reached. It returns the
+// lockout in milliseconds, 0 if there is none.
+var failureScript = redis.NewScript(`
+local threshold = tonumber(ARGV[1])
+local base = tonumber(ARGV[2])
+local max = tonumber(ARGV[3])
+local window = tonumber(ARGV[4])
+local now = tonumber(ARGV[5])
+
+local failures = redis.call('HINCRBY', KEYS[1], 'failures', 1)
+local delay = 0
+if failures >= threshold then
+	delay = math.floor(math.min(max, base * 2 ^ (failures - threshold)))
+	redis.call('HSET', KEYS[1], 'until', now + delay)
+end
+
+redis.call('PEXPIRE', KEYS[1], math.max(window, delay))
+return delay
+`)
+
+// Lockout locks subjects out after repeated failures, such as failed logins,
+// keeping its counts in Redis so every instance shares them.
+type Lockout struct {
+	rdb *redis.Client
+}
+
+// NewLockout returns a Lockout storing its counts in rdb.
+func NewLockout(rdb *redis.Client) *Lockout {
+	return &Lockout{rdb: rdb}
+}
+
+func lockoutKey(b Backoff, subject string) string {
+	return fmt.Sprintf("lockout:%s:%s", b.Name, subject)
+}
+
+// Status returns how many consecutive failures subject has and how much
+// longer it is locked out, zero if it is not.
+func (l *Lockout) Status(ctx context.Context, b Backoff, subject string) (int, time.Duration, error) {
+	vals, err := l.rdb.HMGet(ctx, lockoutKey(b, subject), "failures", "until").Result()
+	if err != nil {
+		return 0, 0, err
+	}
+
+	var failures int
+	var until int64
+	if v, ok := vals[0].(string); ok {
+		failures, _ = strconv.Atoi(v)
+	}
+	if v, ok := vals[1].(string); ok {
+		until, _ = strconv.ParseInt(v, 10, 64)
+	}
+
+	remaining := time.Until(time.UnixMilli(until))
+	if remaining < 0 {
+		remaining = 0
+	}
+	return failures, remaining, nil
+}
+
+// Locked returns how much longer subject is locked out, zero if it is not.
+func (l *Lockout) Locked(ctx context.Context, b Backoff, subject string) (time.Duration, error) {
+	_, remaining, err := l.Status(ctx, b, subject)
+	return remaining, err
+}
+
+// Fail records a failure of subject and returns the lockout it caused, zero
+// if it is still below the threshold.
+func (l *Lockout) Fail(ctx context.Context, b Backoff, subject string) (time.Duration, error) {
+	delay, err := failureScript.Run(ctx, l.rdb, []string{lockoutKey(b, subject)},
+		b.Threshold, b.BaseDelay.Milliseconds(), b.MaxDelay.Milliseconds(), b.Window.Milliseconds(), time.Now().UnixMilli()).Int64()
+	if err != nil {
+		return 0, err
+	}
+	return time.Duration(delay) * time.Millisecond, nil
+}
+
+// Reset forgets the failures of subject, lifting any lockout.
+func (l *Lockout) Reset(ctx context.Context, b Backoff, subject string) error {
+	return l.rdb.Del(ctx, lockoutKey(b, subject)).Err()
+}
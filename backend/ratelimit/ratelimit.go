@@ -0,0 +1,97 @@
+// Package ratelimit implements Redis backed token bucket rate limits shared
+// by every backend instance.
+package ratelimit
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"math"
+	"strconv"
+	"time"
+
+	"backend/apperr"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-redis/redis/v8"
+)
+
+// Limit describes a token bucket: up to Burst requests at once, refilled at
+// PerSecond tokens per second.
+type Limit struct {
+	Name      string
+	Burst     int
+	PerSecond float64
+}
+
+// tokenBucketScript atomically refills and takes one token from the bucket
+// stored in KEYS[1]. It returns {allowed, retry_after_ms}.
+var tokenBucketScript = redis.NewScript(`
+local burst = tonumber(ARGV[1])
+local rate = tonumber(ARGV[2])
+local now = tonumber(ARGV[3])
+
+local state = redis.call('HMGET', KEYS[1], 'tokens', 'ts')
+local tokens = tonumber(state[1]) or burst
+local ts = tonumber(state[2]) or now
+
+tokens = math.min(burst, tokens + (now - ts) / 1000 * rate)
+
+local allowed = 0
+local retry = 0
+if tokens >= 1 then
+	tokens = tokens - 1
+	allowed = 1
+else
+	retry = math.ceil((1 - tokens) / rate * 1000)
+end
+
+redis.call('HSET', KEYS[1], 'tokens', tokens, 'ts', now)
+redis.call('PEXPIRE', KEYS[1], math.ceil(burst / rate * 1000))
+return {allowed, retry}
+`)
+
+// Limiter applies limits using buckets stored in Redis.
+type Limiter struct {
+	rdb *redis.Client
+}
+
+// New returns a Limiter storing its buckets in rdb.
+func New(rdb *redis.Client) *Limiter {
+	return &Limiter{rdb: rdb}
+}
+
+// Allow takes a token from the limit's bucket for subject, reporting whether
+// the request may proceed and, if not, how long to wait. If Redis fails the
+// request is allowed and the error returned.
+func (l *Limiter) Allow(ctx context.Context, limit Limit, subject string) (bool, time.Duration, error) {
+	key := fmt.Sprintf("ratelimit:%s:%s", limit.Name, subject)
+	res, err := tokenBucketScript.Run(ctx, l.rdb, []string{key}, limit.Burst, limit.PerSecond, time.Now().UnixMilli()).Int64Slice()
+	if err != nil {
+		return true, 0, err
+	}
+	return res[0] == 1, time.Duration(res[1]) * time.Millisecond, nil
+}
+
+// ByIP keys a rate limit by the client IP address.
+func ByIP(c *gin.Context) string {
+	return c.ClientIP()
+}
+
+// Middleware rejects requests over the limit with 429 and a Retry-After
+// header. If Redis is unavailable requests are let through.
+func (l *Limiter) Middleware(limit Limit, key func(*gin.Context) string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ok, retryAfter, err := l.Allow(c.Request.Context(), limit, key(c))
+		if err != nil {
+			log.Printf("Rate limiter error for %s: %v", limit.Name, err)
+		}
+		if !ok {
+			seconds := int(math.Ceil(retryAfter.Seconds()))
+			c.Header("Retry-After", strconv.Itoa(seconds))
+			apperr.Abort(c, apperr.New(apperr.RateLimited, "Too many requests, please try again later"))
+			return
+		}
+		c.Next()
+	}
+}
@@ -0,0 +1,40 @@
+package main
+
+import (
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+)
+
+// embeddedRedis runs a Redis server inside the process, for the memory
+// store, so a demo needs neither Postgres nor Redis. Rate limits, presence,
+// caches, locks and delivery all use it as they would a real one. Its keys
+// only expire as its clock is moved on, which is done every second until
+// stop is called.
+func embeddedRedis() (addr string, stop func(), err error) {
+	mr := miniredis.NewMiniRedis()
+	if err := mr.Start(); err != nil {
+		return "", nil, err
+	}
+
+	done := make(chan struct{})
+	go func() {
+		ticker := time.NewTicker(time.Second)
+		defer ticker.Stop()
+		last := time.Now()
+		for {
+			select {
+			case <-done:
+				return
+			case now := <-ticker.C:
+				mr.FastForward(now.Sub(last))
+				last = now
+			}
+		}
+	}()
+
+	return mr.Addr(), func() {
+		close(done)
+		mr.Close()
+	}, nil
+}
@@ -0,0 +1,41 @@
+package service
+
+import (
+	"context"
+	"errors"
+
+	"backend/store"
+)
+
+// ErrNotParticipant is returned when a user reaches for a conversation, or a
+// message of one, that they do not take part in.
+var ErrNotParticipant = errors.New("not a participant of this conversation")
+
+// Conversations are one-to-one: a user takes part in the conversation
+// between a and b if they are a or b, and in the conversation of a message
+// if they sent or received it. Every read and action on a conversation or a
+// message is checked with one of the functions below, or by store queries
+// scoped to the user, such as Conversation and AttachmentFile.
+
+// AuthorizeConversation returns ErrNotParticipant unless username takes part
+// in the conversation between a and b.
+func AuthorizeConversation(username, a, b string) error {
+	if username != a && username != b {
+		return ErrNotParticipant
+	}
+	return nil
+}
+
+// AuthorizeMessage returns the sender and receiver of a message username
+// takes part in. It returns store.ErrNotFound if there is no such message,
+// and ErrNotParticipant if username neither sent nor received it.
+func AuthorizeMessage(ctx context.Context, st store.Store, messageID, username string) (string, string, error) {
+	sender, receiver, err := st.Participants(ctx, messageID)
+	if err != nil {
+		return "", "", err
+	}
+	if err := AuthorizeConversation(username, sender, receiver); err != nil {
+		return "", "", err
+	}
+	return sender, receiver, nil
+}
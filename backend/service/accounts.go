@@ -0,0 +1,136 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"backend/blob"
+	"backend/store"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// Account eraser settings. Erasure runs in the background since it touches
+// every table holding the user's data.
+const (
+	eraserInterval = 10 * time.Second
+	eraserBatch    = 10
+	eraserLockKey  = "account_eraser:lock"
+	eraserLockTTL  = 5 * time.Minute
+)
+
+// AccountEraser erases the data of users who deleted their account.
+type AccountEraser struct {
+	store store.Store
+	blobs blob.Store
+	rdb   *redis.Client
+	lock  lock
+	// onErased runs after a user was erased with the users they had
+	// conversations with, e.g. to drop cached copies of their messages.
+	onErased func(ctx context.Context, username string, contacts []string)
+}
+
+// NewAccountEraser creates an eraser. token must be unique to this instance.
+func NewAccountEraser(st store.Store, blobs blob.Store, rdb *redis.Client, token string, onErased func(ctx context.Context, username string, contacts []string)) *AccountEraser {
+	return &AccountEraser{
+		store:    st,
+		blobs:    blobs,
+		rdb:      rdb,
+		lock:     lock{rdb: rdb, key: eraserLockKey, token: token, ttl: eraserLockTTL},
+		onErased: onErased,
+	}
+}
+
+// Run erases accounts as their deletion is requested until ctx is done.
+func (e *AccountEraser) Run(ctx context.Context) {
+	ticker := time.NewTicker(eraserInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			e.lock.do(ctx, func() { e.erasePending(ctx) })
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// erasePending erases every account whose deletion was requested.
+func (e *AccountEraser) erasePending(ctx context.Context) {
+	for {
+		usernames, err := e.store.PendingDeletions(ctx, eraserBatch)
+		if err != nil {
+			log.Printf("Error fetching pending account deletions: %v", err)
+			return
+		}
+
+		for _, username := range usernames {
+			if err := e.erase(ctx, username); err != nil {
+				log.Printf("Error erasing account %s: %v", username, err)
+				return
+			}
+		}
+		if len(usernames) < eraserBatch || ctx.Err() != nil {
+			return
+		}
+	}
+}
+
+// erase erases one account and the files and Redis keys belonging to it.
+func (e *AccountEraser) erase(ctx context.Context, username string) error {
+	contacts, err := e.store.Contacts(ctx, username)
+	if err != nil {
+		return err
+	}
+
+	tombstone, err := newTombstone()
+	if err != nil {
+		return err
+	}
+	keys, err := e.store.EraseUser(ctx, username, tombstone)
+	if errors.Is(err, store.ErrNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	for _, key := range keys {
+		if err := e.blobs.Delete(ctx, key); err != nil {
+			log.Printf("Error removing attachment of erased account %s: %v", username, err)
+		}
+	}
+	e.deleteKeys(ctx, fmt.Sprintf("draft:%s:*", username))
+	e.deleteKeys(ctx, fmt.Sprintf("idempotency:vote:%s:*", username))
+
+	e.onErased(ctx, username, contacts)
+	return nil
+}
+
+// deleteKeys deletes the Redis keys matching pattern.
+func (e *AccountEraser) deleteKeys(ctx context.Context, pattern string) {
+	iter := e.rdb.Scan(ctx, 0, pattern, 100).Iterator()
+	for iter.Next(ctx) {
+		if err := e.rdb.Del(ctx, iter.Val()).Err(); err != nil {
+			log.Printf("Error deleting %s: %v", iter.Val(), err)
+		}
+	}
+	if err := iter.Err(); err != nil {
+		log.Printf("Error scanning %s: %v", pattern, err)
+	}
+}
+
+// newTombstone returns a random name to replace an erased username with.
+func newTombstone() (string, error) {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return "deleted-" + hex.EncodeToString(b), nil
+}
@@ -0,0 +1,106 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"backend/markup"
+	"backend/moderation"
+	"backend/store"
+)
+
+// MaxBatchSize is the most messages SendBatch sends at once.
+const MaxBatchSize = 100
+
+var (
+	// ErrEmptyBatch is returned when a batch has no messages.
+	ErrEmptyBatch = errors.New("batch has no messages")
+	// ErrBatchTooLarge is returned when a batch has more than MaxBatchSize
+	// messages.
+	ErrBatchTooLarge = fmt.Errorf("batch has more than %d messages", MaxBatchSize)
+)
+
+// BatchError is returned when the message at Index of a batch cannot be
+// sent. It wraps the reason, as Send would have returned it.
+type BatchError struct {
+	Index int
+	Err   error
+}
+
+func (e *BatchError) Error() string {
+	return fmt.Sprintf("messages[%d]: %v", e.Index, e.Err)
+}
+
+func (e *BatchError) Unwrap() error {
+	return e.Err
+}
+
+// SendBatch sends msgs from sender, who must be their sender, the way Send
+// sends each one, but stores them all in one transaction with multi-row
+// inserts. Either every message is sent or none is: the first that fails
+// validation, or the content filter rejects, fails the batch with a
+// BatchError. Slash commands are not run, since batches come from bots. A
+// shadow-muted sender's messages are all stored shadowed.
+func (m *MessageService) SendBatch(ctx context.Context, sender string, msgs []*store.Message) error {
+	if len(msgs) == 0 {
+		return ErrEmptyBatch
+	}
+	if len(msgs) > MaxBatchSize {
+		return ErrBatchTooLarge
+	}
+
+	shadowed, err := m.store.ShadowMuted(ctx, sender, "")
+	if err != nil {
+		return err
+	}
+	verdicts := make([]moderation.Verdict, len(msgs))
+	for i, msg := range msgs {
+		msg.Sender, msg.Shadowed = sender, shadowed
+		verdict, err := m.prepareBatched(ctx, msg)
+		if err != nil {
+			return &BatchError{Index: i, Err: err}
+		}
+		verdicts[i] = verdict
+	}
+	if err := m.checkMessageQuota(ctx, sender, len(msgs)); err != nil {
+		return err
+	}
+
+	if err := m.store.CreateMessages(ctx, msgs); err != nil {
+		return err
+	}
+	for i, msg := range msgs {
+		msg.HTML = markup.Render(msg.Format, msg.Content)
+		m.recordFlag(ctx, *msg, verdicts[i])
+		m.recordMentions(ctx, msg)
+		m.publisher.Publish(ctx, *msg)
+	}
+	return nil
+}
+
+// prepareBatched validates and filters one message of a batch, returning
+// the content filter's verdict. Like Send, it makes msg a user message.
+func (m *MessageService) prepareBatched(ctx context.Context, msg *store.Message) (moderation.Verdict, error) {
+	msg.Kind, msg.System = store.KindUser, nil
+	msg.Content = markup.Sanitize(msg.Content)
+	if err := m.ValidateContent(msg.Content); err != nil {
+		return moderation.Verdict{}, err
+	}
+	if err := normalizeFormat(&msg.Format); err != nil {
+		return moderation.Verdict{}, err
+	}
+	msg.ReplyToID = normalizeReplyTo(msg.ReplyToID)
+	replyTo, err := m.validate(ctx, msg.Sender, &msg.Receiver, msg.ReplyToID)
+	if err != nil {
+		return moderation.Verdict{}, err
+	}
+	msg.ReplyTo = replyTo
+
+	verdict := m.filter.Apply(ctx, msg.Content, m.Strictness(ctx, msg.Sender, msg.Receiver))
+	if verdict.Action == moderation.Reject {
+		return verdict, &RejectedError{Reasons: verdict.Reasons}
+	}
+	msg.Content = verdict.Content
+	return verdict, nil
+}
@@ -0,0 +1,449 @@
+package service
+
+import (
+	"context"
+	"errors"
+
+	"backend/markup"
+	"backend/moderation"
+	"backend/store"
+)
+
+// ErrNotChannelSender is returned when a user who is not one of a channel's
+// designated senders posts to it.
+var ErrNotChannelSender = errors.New("only the channel's senders can post to it")
+
+// ErrInvalidParent is returned for a reply to a post that is not in the
+// channel or is a reply itself.
+var ErrInvalidParent = errors.New("replies must reply to a post of the channel")
+
+// PostToChannel validates post from its sender, filters its content at the
+// default strictness and stores it. Only the channel's senders post to it,
+// but every member can reply in the thread of a post: a post with ParentID
+// set. On success post has its ID and creation time set, and its content
+// sanitized and masked if the filter required it. A post from a user
+// shadow-muted globally or in the channel is stored shadowed. Delivering it
+// to subscribers is up to the caller.
+func (m *MessageService) PostToChannel(ctx context.Context, post *store.ChannelPost) error {
+	post.Kind, post.System = store.KindUser, nil
+	post.Content = markup.Sanitize(post.Content)
+	if err := m.ValidateContent(post.Content); err != nil {
+		return err
+	}
+
+	if post.ParentID != nil {
+		if err := m.checkReply(ctx, post); err != nil {
+			return err
+		}
+	} else {
+		sender, err := m.store.IsChannelSender(ctx, post.ChannelID, post.Sender)
+		if err != nil {
+			return err
+		}
+		if !sender {
+			return ErrNotChannelSender
+		}
+	}
+
+	// A channel has no participants to choose a strictness.
+	verdict := m.filter.Apply(ctx, post.Content, m.defaultStrictness)
+	if verdict.Action == moderation.Reject {
+		return &RejectedError{Reasons: verdict.Reasons}
+	}
+	post.Content = verdict.Content
+
+	var err error
+	if post.Shadowed, err = m.store.ShadowMuted(ctx, post.Sender, post.ChannelID); err != nil {
+		return err
+	}
+	return m.store.CreateChannelPost(ctx, post)
+}
+
+// checkReply checks that the sender of a reply is a member of its channel
+// and that it replies to a post of the channel that is no reply itself.
+func (m *MessageService) checkReply(ctx context.Context, reply *store.ChannelPost) error {
+	role, err := m.store.ChannelRole(ctx, reply.ChannelID, reply.Sender)
+	if err != nil {
+		return err
+	}
+	if role == "" {
+		return ErrNotChannelMember
+	}
+	parent, err := m.store.ChannelPost(ctx, reply.ChannelID, *reply.ParentID)
+	if errors.Is(err, store.ErrNotFound) {
+		return ErrInvalidParent
+	}
+	if err != nil {
+		return err
+	}
+	if parent.ParentID != nil || (parent.Shadowed && parent.Sender != reply.Sender) {
+		return ErrInvalidParent
+	}
+	return nil
+}
+
+// ChannelPermission is an action in a channel that only some roles may take.
+type ChannelPermission string
+
+// Channel permissions.
+const (
+	PermViewMembers    ChannelPermission = "view_members"
+	PermRemoveMembers  ChannelPermission = "remove_members"
+	PermDeletePosts    ChannelPermission = "delete_posts"
+	PermPinPosts       ChannelPermission = "pin_posts"
+	PermChangeSettings ChannelPermission = "change_settings"
+	PermInvite         ChannelPermission = "invite"
+	PermChangeRoles    ChannelPermission = "change_roles"
+)
+
+// channelPermissions is the least role that grants each permission.
+var channelPermissions = map[ChannelPermission]string{
+	PermViewMembers:    store.ChannelRoleMember,
+	PermRemoveMembers:  store.ChannelRoleAdmin,
+	PermDeletePosts:    store.ChannelRoleAdmin,
+	PermPinPosts:       store.ChannelRoleAdmin,
+	PermChangeSettings: store.ChannelRoleAdmin,
+	PermInvite:         store.ChannelRoleAdmin,
+	PermChangeRoles:    store.ChannelRoleOwner,
+}
+
+// channelRoleRanks orders the channel roles. Users who do not subscribe to
+// a channel rank 0.
+var channelRoleRanks = map[string]int{
+	store.ChannelRoleMember: 1,
+	store.ChannelRoleAdmin:  2,
+	store.ChannelRoleOwner:  3,
+}
+
+var (
+	// ErrChannelRoleRequired is returned when a user's role in a channel
+	// does not grant what they tried.
+	ErrChannelRoleRequired = errors.New("your role in the channel does not allow this")
+	// ErrNotChannelMember is returned when acting on a user who does not
+	// subscribe to the channel.
+	ErrNotChannelMember = errors.New("user is not a member of this channel")
+	// ErrInvalidChannelRole is returned for a role other than owner, admin
+	// or member.
+	ErrInvalidChannelRole = errors.New("role must be owner, admin or member")
+	// ErrLastChannelOwner is returned when the only owner of a channel
+	// leaves it or gives up ownership.
+	ErrLastChannelOwner = errors.New("a channel needs an owner")
+	// ErrInviteExpired is returned when joining with an invite that expired
+	// or was used up.
+	ErrInviteExpired = errors.New("the invite expired")
+)
+
+// ChannelService changes channels on behalf of their members. It is the one
+// place that decides what each channel role allows.
+type ChannelService struct {
+	store store.Store
+}
+
+// NewChannelService creates a ChannelService.
+func NewChannelService(st store.Store) *ChannelService {
+	return &ChannelService{store: st}
+}
+
+// Authorize returns the role of username in a channel if it grants perm,
+// and ErrChannelRoleRequired otherwise. It returns store.ErrNotFound if the
+// channel does not exist.
+func (c *ChannelService) Authorize(ctx context.Context, id, username string, perm ChannelPermission) (string, error) {
+	role, err := c.store.ChannelRole(ctx, id, username)
+	if err != nil {
+		return "", err
+	}
+	if channelRoleRanks[role] < channelRoleRanks[channelPermissions[perm]] {
+		return role, ErrChannelRoleRequired
+	}
+	return role, nil
+}
+
+// authorizeOver authorizes actor to take perm on target, which also needs
+// actor to outrank target unless actor owns the channel. It returns
+// target's role.
+func (c *ChannelService) authorizeOver(ctx context.Context, id, actor, target string, perm ChannelPermission) (string, error) {
+	role, err := c.Authorize(ctx, id, actor, perm)
+	if err != nil {
+		return "", err
+	}
+	targetRole, err := c.store.ChannelRole(ctx, id, target)
+	if err != nil {
+		return "", err
+	}
+	if targetRole == "" {
+		return "", ErrNotChannelMember
+	}
+	if role != store.ChannelRoleOwner && channelRoleRanks[role] <= channelRoleRanks[targetRole] {
+		return "", ErrChannelRoleRequired
+	}
+	return targetRole, nil
+}
+
+// View returns a channel as username sees it. A private channel is only
+// seen by its members; to others it does not exist and View returns
+// store.ErrNotFound.
+func (c *ChannelService) View(ctx context.Context, id, username string) (store.Channel, error) {
+	ch, err := c.store.Channel(ctx, id, username)
+	if err != nil {
+		return store.Channel{}, err
+	}
+	if ch.Visibility != store.ChannelPublic && !ch.Subscribed {
+		return store.Channel{}, store.ErrNotFound
+	}
+	return ch, nil
+}
+
+// Join subscribes username to a public channel as a member. Joining a
+// channel again does nothing.
+func (c *ChannelService) Join(ctx context.Context, id, username string) error {
+	if _, err := c.View(ctx, id, username); err != nil {
+		return err
+	}
+	return c.store.SubscribeChannel(ctx, id, username)
+}
+
+// Update changes the settings of a channel as username.
+func (c *ChannelService) Update(ctx context.Context, id, username string, update store.ChannelUpdate) error {
+	if _, err := c.Authorize(ctx, id, username, PermChangeSettings); err != nil {
+		return err
+	}
+	return c.store.UpdateChannel(ctx, id, update)
+}
+
+// Members returns the members of a channel, if username may see them.
+func (c *ChannelService) Members(ctx context.Context, id, username string) ([]store.ChannelMember, error) {
+	if _, err := c.Authorize(ctx, id, username, PermViewMembers); err != nil {
+		return nil, err
+	}
+	return c.store.ChannelMembers(ctx, id)
+}
+
+// SetRole gives target role in a channel as actor. An owner may pass
+// ownership on or share it, but the last owner cannot give it up.
+func (c *ChannelService) SetRole(ctx context.Context, id, actor, target, role string) error {
+	if channelRoleRanks[role] == 0 {
+		return ErrInvalidChannelRole
+	}
+	targetRole, err := c.authorizeOver(ctx, id, actor, target, PermChangeRoles)
+	if err != nil {
+		return err
+	}
+	if targetRole == store.ChannelRoleOwner && role != store.ChannelRoleOwner {
+		if err := c.keepOwner(ctx, id); err != nil {
+			return err
+		}
+	}
+	if _, err := c.store.SetChannelRole(ctx, id, target, role); err != nil {
+		return err
+	}
+	return nil
+}
+
+// RemoveMember unsubscribes target from a channel as actor, who must
+// outrank them.
+func (c *ChannelService) RemoveMember(ctx context.Context, id, actor, target string) error {
+	targetRole, err := c.authorizeOver(ctx, id, actor, target, PermRemoveMembers)
+	if err != nil {
+		return err
+	}
+	if targetRole == store.ChannelRoleOwner {
+		if err := c.keepOwner(ctx, id); err != nil {
+			return err
+		}
+	}
+	_, err = c.store.UnsubscribeChannel(ctx, id, target)
+	return err
+}
+
+// Leave unsubscribes username from a channel. The last owner cannot leave.
+func (c *ChannelService) Leave(ctx context.Context, id, username string) error {
+	role, err := c.store.ChannelRole(ctx, id, username)
+	if err != nil {
+		return err
+	}
+	if role == "" {
+		return ErrNotChannelMember
+	}
+	if role == store.ChannelRoleOwner {
+		if err := c.keepOwner(ctx, id); err != nil {
+			return err
+		}
+	}
+	_, err = c.store.UnsubscribeChannel(ctx, id, username)
+	return err
+}
+
+// keepOwner returns ErrLastChannelOwner unless a channel has more than one
+// owner, so that one of them can step down.
+func (c *ChannelService) keepOwner(ctx context.Context, id string) error {
+	members, err := c.store.ChannelMembers(ctx, id)
+	if err != nil {
+		return err
+	}
+	owners := 0
+	for _, m := range members {
+		if m.Role == store.ChannelRoleOwner {
+			owners++
+		}
+	}
+	if owners < 2 {
+		return ErrLastChannelOwner
+	}
+	return nil
+}
+
+// DeletePost deletes a post of a channel as username. Senders may delete
+// their own posts; deleting others' and system posts needs PermDeletePosts.
+func (c *ChannelService) DeletePost(ctx context.Context, id, username, postID string) error {
+	post, err := c.store.ChannelPost(ctx, id, postID)
+	if err != nil {
+		return err
+	}
+	if post.Sender != username || post.Kind == store.KindSystem {
+		if _, err := c.Authorize(ctx, id, username, PermDeletePosts); err != nil {
+			return err
+		}
+	}
+	if _, err := c.store.DeleteChannelPost(ctx, id, postID); err != nil {
+		return err
+	}
+	return nil
+}
+
+// Pin pins or unpins a post of a channel as username.
+func (c *ChannelService) Pin(ctx context.Context, id, username, postID string, pinned bool) error {
+	if _, err := c.Authorize(ctx, id, username, PermPinPosts); err != nil {
+		return err
+	}
+	found, err := c.store.PinChannelPost(ctx, id, postID, pinned)
+	if err != nil {
+		return err
+	}
+	if !found {
+		return store.ErrNotFound
+	}
+	return nil
+}
+
+// CreateInvite stores an invite to its channel made by username, with the
+// hash of its token.
+func (c *ChannelService) CreateInvite(ctx context.Context, username string, invite *store.ChannelInvite, tokenHash string) error {
+	if _, err := c.Authorize(ctx, invite.ChannelID, username, PermInvite); err != nil {
+		return err
+	}
+	invite.CreatedBy = username
+	return c.store.CreateChannelInvite(ctx, invite, tokenHash)
+}
+
+// Invites returns the invites of a channel as username.
+func (c *ChannelService) Invites(ctx context.Context, id, username string) ([]store.ChannelInvite, error) {
+	if _, err := c.Authorize(ctx, id, username, PermInvite); err != nil {
+		return nil, err
+	}
+	return c.store.ChannelInvites(ctx, id)
+}
+
+// RevokeInvite deletes an invite to a channel as username.
+func (c *ChannelService) RevokeInvite(ctx context.Context, id, username, inviteID string) error {
+	if _, err := c.Authorize(ctx, id, username, PermInvite); err != nil {
+		return err
+	}
+	found, err := c.store.DeleteChannelInvite(ctx, id, inviteID)
+	if err != nil {
+		return err
+	}
+	if !found {
+		return store.ErrNotFound
+	}
+	return nil
+}
+
+// AcceptInvite makes username a member of the channel of the invite with
+// tokenHash and returns the invite. It reports whether they joined: members
+// accepting an invite stay as they are and use none of it. It returns
+// store.ErrNotFound for an unknown token and ErrInviteExpired for an invite
+// that expired or was used up.
+func (c *ChannelService) AcceptInvite(ctx context.Context, tokenHash, username string) (store.ChannelInvite, bool, error) {
+	invite, err := c.store.ChannelInviteByToken(ctx, tokenHash)
+	if err != nil {
+		return store.ChannelInvite{}, false, err
+	}
+	role, err := c.store.ChannelRole(ctx, invite.ChannelID, username)
+	if err != nil {
+		return store.ChannelInvite{}, false, err
+	}
+	if role != "" {
+		return invite, false, nil
+	}
+
+	used, err := c.store.UseChannelInvite(ctx, invite.ID, username)
+	if err != nil {
+		return store.ChannelInvite{}, false, err
+	}
+	if !used {
+		return store.ChannelInvite{}, false, ErrInviteExpired
+	}
+	return invite, true, nil
+}
+
+// threadParent returns the post of a channel whose thread is named by
+// parentID as username sees it. It returns store.ErrNotFound if the channel
+// is hidden from username or the post is not there or is a reply.
+func (c *ChannelService) threadParent(ctx context.Context, id, username, parentID string) (store.ChannelPost, error) {
+	if _, err := c.View(ctx, id, username); err != nil {
+		return store.ChannelPost{}, err
+	}
+	parent, err := c.store.ChannelPost(ctx, id, parentID)
+	if err != nil {
+		return store.ChannelPost{}, err
+	}
+	if parent.ParentID != nil || (parent.Shadowed && parent.Sender != username) {
+		return store.ChannelPost{}, store.ErrNotFound
+	}
+	return parent, nil
+}
+
+// Threads returns up to limit threads of a channel as username sees them,
+// latest reply first.
+func (c *ChannelService) Threads(ctx context.Context, id, username string, limit int) ([]store.ChannelThread, error) {
+	if _, err := c.View(ctx, id, username); err != nil {
+		return nil, err
+	}
+	return c.store.ChannelThreads(ctx, id, username, limit)
+}
+
+// Replies returns up to limit replies in the thread of a post made before
+// the reply with ID before, oldest first.
+func (c *ChannelService) Replies(ctx context.Context, id, username, parentID, before string, limit int) ([]store.ChannelPost, error) {
+	if _, err := c.threadParent(ctx, id, username, parentID); err != nil {
+		return nil, err
+	}
+	return c.store.ChannelReplies(ctx, id, parentID, username, before, limit)
+}
+
+// SubscribeThread subscribes username to the thread of a post or
+// unsubscribes them. Only members follow threads.
+func (c *ChannelService) SubscribeThread(ctx context.Context, id, username, parentID string, subscribed bool) error {
+	if _, err := c.threadParent(ctx, id, username, parentID); err != nil {
+		return err
+	}
+	if subscribed {
+		role, err := c.store.ChannelRole(ctx, id, username)
+		if err != nil {
+			return err
+		}
+		if role == "" {
+			return ErrNotChannelMember
+		}
+	}
+	return c.store.SetThreadSubscription(ctx, parentID, username, subscribed)
+}
+
+// MarkThreadRead marks the replies in the thread of a post read by
+// username.
+func (c *ChannelService) MarkThreadRead(ctx context.Context, id, username, parentID string) error {
+	if _, err := c.threadParent(ctx, id, username, parentID); err != nil {
+		return err
+	}
+	return c.store.MarkThreadRead(ctx, parentID, username)
+}
@@ -0,0 +1,406 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"backend/moderation"
+	"backend/store"
+)
+
+// newTestChannel returns a ChannelService on a store with a channel owned
+// by olivia, where alan is an admin, mia and max are members and eve is
+// not, and the ID of the channel.
+func newTestChannel(t *testing.T) (*ChannelService, store.Store, string) {
+	t.Helper()
+	ctx := context.Background()
+	st := newTestStore(t, "olivia", "alan", "mia", "max", "eve")
+	ch := store.Channel{Name: "news", Topic: "Company news", Visibility: store.ChannelPublic, Senders: []string{"olivia", "mia"}, CreatedBy: "olivia"}
+	if err := st.CreateChannel(ctx, &ch); err != nil {
+		t.Fatal(err)
+	}
+	for _, u := range []string{"alan", "mia", "max"} {
+		if err := st.SubscribeChannel(ctx, ch.ID, u); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := st.SetChannelRole(ctx, ch.ID, "alan", store.ChannelRoleAdmin); err != nil {
+		t.Fatal(err)
+	}
+	return NewChannelService(st), st, ch.ID
+}
+
+func TestChannelAuthorize(t *testing.T) {
+	ctx := context.Background()
+	channels, _, id := newTestChannel(t)
+
+	tests := []struct {
+		username string
+		perm     ChannelPermission
+		allowed  bool
+	}{
+		{"max", PermViewMembers, true},
+		{"eve", PermViewMembers, false},
+		{"max", PermPinPosts, false},
+		{"alan", PermPinPosts, true},
+		{"alan", PermChangeSettings, true},
+		{"alan", PermChangeRoles, false},
+		{"olivia", PermChangeRoles, true},
+	}
+	for _, tt := range tests {
+		_, err := channels.Authorize(ctx, id, tt.username, tt.perm)
+		if tt.allowed && err != nil {
+			t.Errorf("%s %s: %v", tt.username, tt.perm, err)
+		}
+		if !tt.allowed && !errors.Is(err, ErrChannelRoleRequired) {
+			t.Errorf("%s %s: got %v, want ErrChannelRoleRequired", tt.username, tt.perm, err)
+		}
+	}
+
+	if _, err := channels.Authorize(ctx, "999", "olivia", PermViewMembers); !errors.Is(err, store.ErrNotFound) {
+		t.Errorf("unknown channel: got %v, want ErrNotFound", err)
+	}
+}
+
+func TestChannelRemoveMember(t *testing.T) {
+	ctx := context.Background()
+	channels, st, id := newTestChannel(t)
+
+	if err := channels.RemoveMember(ctx, id, "max", "mia"); !errors.Is(err, ErrChannelRoleRequired) {
+		t.Errorf("member removing a member: got %v", err)
+	}
+	if err := channels.RemoveMember(ctx, id, "alan", "olivia"); !errors.Is(err, ErrChannelRoleRequired) {
+		t.Errorf("admin removing the owner: got %v", err)
+	}
+	if err := channels.RemoveMember(ctx, id, "alan", "mia"); err != nil {
+		t.Errorf("admin removing a member: %v", err)
+	}
+	if err := channels.RemoveMember(ctx, id, "alan", "mia"); !errors.Is(err, ErrNotChannelMember) {
+		t.Errorf("removing a non-member: got %v", err)
+	}
+	if err := channels.RemoveMember(ctx, id, "olivia", "alan"); err != nil {
+		t.Errorf("owner removing an admin: %v", err)
+	}
+
+	members, err := st.ChannelMembers(ctx, id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(members) != 2 || members[0].Username != "max" || members[1].Username != "olivia" {
+		t.Errorf("members = %+v", members)
+	}
+}
+
+func TestChannelKeepsAnOwner(t *testing.T) {
+	ctx := context.Background()
+	channels, st, id := newTestChannel(t)
+
+	if err := channels.Leave(ctx, id, "olivia"); !errors.Is(err, ErrLastChannelOwner) {
+		t.Errorf("last owner leaving: got %v", err)
+	}
+	if err := channels.SetRole(ctx, id, "olivia", "olivia", store.ChannelRoleMember); !errors.Is(err, ErrLastChannelOwner) {
+		t.Errorf("last owner stepping down: got %v", err)
+	}
+	if err := channels.SetRole(ctx, id, "alan", "max", store.ChannelRoleAdmin); !errors.Is(err, ErrChannelRoleRequired) {
+		t.Errorf("admin changing a role: got %v", err)
+	}
+	if err := channels.SetRole(ctx, id, "olivia", "max", "moderator"); !errors.Is(err, ErrInvalidChannelRole) {
+		t.Errorf("unknown role: got %v", err)
+	}
+
+	if err := channels.SetRole(ctx, id, "olivia", "alan", store.ChannelRoleOwner); err != nil {
+		t.Fatal(err)
+	}
+	if err := channels.Leave(ctx, id, "olivia"); err != nil {
+		t.Errorf("owner leaving after handing over: %v", err)
+	}
+	if role, _ := st.ChannelRole(ctx, id, "alan"); role != store.ChannelRoleOwner {
+		t.Errorf("alan's role = %q", role)
+	}
+}
+
+func TestChannelPostModeration(t *testing.T) {
+	ctx := context.Background()
+	channels, st, id := newTestChannel(t)
+
+	var posts []store.ChannelPost
+	for _, sender := range []string{"mia", "olivia"} {
+		post := store.ChannelPost{ChannelID: id, Sender: sender, Content: "hi"}
+		if err := st.CreateChannelPost(ctx, &post); err != nil {
+			t.Fatal(err)
+		}
+		posts = append(posts, post)
+	}
+
+	if err := channels.Pin(ctx, id, "mia", posts[0].ID, true); !errors.Is(err, ErrChannelRoleRequired) {
+		t.Errorf("member pinning: got %v", err)
+	}
+	if err := channels.Pin(ctx, id, "alan", posts[0].ID, true); err != nil {
+		t.Errorf("admin pinning: %v", err)
+	}
+	if err := channels.Pin(ctx, id, "alan", "999", true); !errors.Is(err, store.ErrNotFound) {
+		t.Errorf("pinning an unknown post: got %v", err)
+	}
+	pinned, err := st.PinnedChannelPosts(ctx, id, "max")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pinned) != 1 || pinned[0].ID != posts[0].ID || !pinned[0].Pinned {
+		t.Errorf("pinned = %+v", pinned)
+	}
+
+	if err := channels.DeletePost(ctx, id, "mia", posts[1].ID); !errors.Is(err, ErrChannelRoleRequired) {
+		t.Errorf("member deleting another's post: got %v", err)
+	}
+	if err := channels.DeletePost(ctx, id, "mia", posts[0].ID); err != nil {
+		t.Errorf("sender deleting their post: %v", err)
+	}
+	if err := channels.DeletePost(ctx, id, "alan", posts[1].ID); err != nil {
+		t.Errorf("admin deleting a post: %v", err)
+	}
+	if _, err := st.ChannelPost(ctx, id, posts[1].ID); !errors.Is(err, store.ErrNotFound) {
+		t.Errorf("deleted post: got %v", err)
+	}
+
+	joined := store.ChannelPost{ChannelID: id, Sender: "max", Kind: store.KindSystem, System: &store.SystemEvent{Event: store.SystemMemberJoined}}
+	if err := st.CreateChannelPost(ctx, &joined); err != nil {
+		t.Fatal(err)
+	}
+	if err := channels.DeletePost(ctx, id, "max", joined.ID); !errors.Is(err, ErrChannelRoleRequired) {
+		t.Errorf("member deleting their system post: got %v", err)
+	}
+}
+
+func TestChannelVisibility(t *testing.T) {
+	ctx := context.Background()
+	channels, st, id := newTestChannel(t)
+	private := store.ChannelPrivate
+	if err := channels.Update(ctx, id, "alan", store.ChannelUpdate{Visibility: &private}); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := channels.View(ctx, id, "max"); err != nil {
+		t.Errorf("member viewing a private channel: %v", err)
+	}
+	if _, err := channels.View(ctx, id, "eve"); !errors.Is(err, store.ErrNotFound) {
+		t.Errorf("non-member viewing a private channel: got %v", err)
+	}
+	if err := channels.Join(ctx, id, "eve"); !errors.Is(err, store.ErrNotFound) {
+		t.Errorf("joining a private channel: got %v", err)
+	}
+	if listed, err := st.Channels(ctx, "eve", ""); err != nil || len(listed) != 0 {
+		t.Errorf("channels listed to a non-member: %+v, %v", listed, err)
+	}
+
+	public := store.ChannelPublic
+	if err := channels.Update(ctx, id, "alan", store.ChannelUpdate{Visibility: &public}); err != nil {
+		t.Fatal(err)
+	}
+	if err := channels.Join(ctx, id, "eve"); err != nil {
+		t.Errorf("joining a public channel: %v", err)
+	}
+	if role, _ := st.ChannelRole(ctx, id, "eve"); role != store.ChannelRoleMember {
+		t.Errorf("eve's role = %q", role)
+	}
+}
+
+func TestChannelSearch(t *testing.T) {
+	ctx := context.Background()
+	_, st, _ := newTestChannel(t)
+	other := store.Channel{Name: "sports", Description: "Match results", Visibility: store.ChannelPublic, CreatedBy: "olivia"}
+	if err := st.CreateChannel(ctx, &other); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		search string
+		want   []string
+	}{
+		{"", []string{"news", "sports"}},
+		{"NEWS", []string{"news"}},
+		{"results", []string{"sports"}},
+		{"weather", nil},
+	}
+	for _, tt := range tests {
+		listed, err := st.Channels(ctx, "max", tt.search)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var names []string
+		for _, ch := range listed {
+			names = append(names, ch.Name)
+		}
+		if strings.Join(names, ",") != strings.Join(tt.want, ",") {
+			t.Errorf("search %q: got %v, want %v", tt.search, names, tt.want)
+		}
+	}
+}
+
+func TestChannelInvites(t *testing.T) {
+	ctx := context.Background()
+	channels, st, id := newTestChannel(t)
+	if err := st.CreateUser(ctx, "zoe", store.Password{}, ""); err != nil {
+		t.Fatal(err)
+	}
+	private := store.ChannelPrivate
+	if err := channels.Update(ctx, id, "olivia", store.ChannelUpdate{Visibility: &private}); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := channels.CreateInvite(ctx, "mia", &store.ChannelInvite{ChannelID: id}, "member"); !errors.Is(err, ErrChannelRoleRequired) {
+		t.Errorf("member inviting: got %v", err)
+	}
+	once := store.ChannelInvite{ChannelID: id, MaxUses: 1}
+	if err := channels.CreateInvite(ctx, "alan", &once, "once"); err != nil {
+		t.Fatal(err)
+	}
+	if once.CreatedBy != "alan" {
+		t.Errorf("invite created by %q", once.CreatedBy)
+	}
+
+	if _, joined, err := channels.AcceptInvite(ctx, "once", "mia"); err != nil || joined {
+		t.Errorf("member accepting: joined %v, %v", joined, err)
+	}
+	if _, joined, err := channels.AcceptInvite(ctx, "once", "eve"); err != nil || !joined {
+		t.Errorf("accepting: joined %v, %v", joined, err)
+	}
+	if _, err := channels.View(ctx, id, "eve"); err != nil {
+		t.Errorf("viewing the private channel after joining: %v", err)
+	}
+	if _, _, err := channels.AcceptInvite(ctx, "once", "zoe"); !errors.Is(err, ErrInviteExpired) {
+		t.Errorf("accepting a used up invite: got %v", err)
+	}
+	if _, _, err := channels.AcceptInvite(ctx, "unknown", "zoe"); !errors.Is(err, store.ErrNotFound) {
+		t.Errorf("accepting an unknown invite: got %v", err)
+	}
+
+	past := time.Now().Add(-time.Minute)
+	expired := store.ChannelInvite{ChannelID: id, ExpiresAt: &past}
+	if err := channels.CreateInvite(ctx, "olivia", &expired, "expired"); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := channels.AcceptInvite(ctx, "expired", "zoe"); !errors.Is(err, ErrInviteExpired) {
+		t.Errorf("accepting an expired invite: got %v", err)
+	}
+
+	if err := channels.RevokeInvite(ctx, id, "alan", expired.ID); err != nil {
+		t.Errorf("revoking: %v", err)
+	}
+	invites, err := channels.Invites(ctx, id, "alan")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(invites) != 1 || invites[0].ID != once.ID || invites[0].Uses != 1 {
+		t.Errorf("invites = %+v", invites)
+	}
+}
+
+func TestChannelThreads(t *testing.T) {
+	ctx := context.Background()
+	channels, st, id := newTestChannel(t)
+	messages, _ := newTestMessages(t, st, moderation.Off, Quotas{})
+
+	post := store.ChannelPost{ChannelID: id, Sender: "mia", Content: "Offsite next week"}
+	if err := messages.PostToChannel(ctx, &post); err != nil {
+		t.Fatal(err)
+	}
+	reply := func(sender, parentID string) (store.ChannelPost, error) {
+		r := store.ChannelPost{ChannelID: id, ParentID: &parentID, Sender: sender, Content: "count me in"}
+		return r, messages.PostToChannel(ctx, &r)
+	}
+	subscribers := func() []string {
+		t.Helper()
+		got, err := st.ThreadSubscribersAmong(ctx, id, post.ID, []string{"olivia", "alan", "mia", "max", "eve"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		slices.Sort(got)
+		return got
+	}
+	thread := func(username string) store.ChannelThread {
+		t.Helper()
+		threads, err := channels.Threads(ctx, id, username, 10)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(threads) != 1 || threads[0].Parent.ID != post.ID {
+			t.Fatalf("threads of %s = %+v", username, threads)
+		}
+		return threads[0]
+	}
+
+	if _, err := reply("eve", post.ID); !errors.Is(err, ErrNotChannelMember) {
+		t.Errorf("non-member replying: got %v", err)
+	}
+	first, err := reply("max", post.ID)
+	if err != nil {
+		t.Fatalf("member replying: %v", err)
+	}
+	if _, err := reply("max", first.ID); !errors.Is(err, ErrInvalidParent) {
+		t.Errorf("replying to a reply: got %v", err)
+	}
+	if _, err := reply("max", "999"); !errors.Is(err, ErrInvalidParent) {
+		t.Errorf("replying to an unknown post: got %v", err)
+	}
+	if got := subscribers(); !slices.Equal(got, []string{"max", "mia"}) {
+		t.Errorf("subscribers after the first reply = %v", got)
+	}
+
+	posts, err := st.ChannelPosts(ctx, id, "max", "", 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(posts) != 1 || posts[0].ID != post.ID {
+		t.Errorf("timeline = %+v, want only the parent", posts)
+	}
+
+	if err := channels.SubscribeThread(ctx, id, "mia", post.ID, false); err != nil {
+		t.Fatal(err)
+	}
+	if err := channels.SubscribeThread(ctx, id, "alan", post.ID, true); err != nil {
+		t.Fatal(err)
+	}
+	if err := channels.SubscribeThread(ctx, id, "eve", post.ID, true); !errors.Is(err, ErrNotChannelMember) {
+		t.Errorf("non-member subscribing: got %v", err)
+	}
+	if err := channels.SubscribeThread(ctx, id, "alan", first.ID, true); !errors.Is(err, store.ErrNotFound) {
+		t.Errorf("subscribing to a reply: got %v", err)
+	}
+	if _, err := reply("max", post.ID); err != nil {
+		t.Fatal(err)
+	}
+	if got := subscribers(); !slices.Equal(got, []string{"alan", "max"}) {
+		t.Errorf("subscribers after mia unsubscribed = %v", got)
+	}
+
+	if got := thread("alan"); got.Replies != 2 || !got.Subscribed || got.Unread != 2 {
+		t.Errorf("alan's thread = %+v, want 2 unread replies", got)
+	}
+	if got := thread("mia"); got.Subscribed || got.Unread != 0 {
+		t.Errorf("mia's thread = %+v, want unsubscribed", got)
+	}
+	if err := channels.MarkThreadRead(ctx, id, "alan", post.ID); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := reply("max", post.ID); err != nil {
+		t.Fatal(err)
+	}
+	if got := thread("alan"); got.Replies != 3 || got.Unread != 1 {
+		t.Errorf("alan's thread after reading = %+v, want 1 unread reply", got)
+	}
+	if got := thread("max"); got.Unread != 0 {
+		t.Errorf("max's thread = %+v, want their own replies read", got)
+	}
+
+	replies, err := channels.Replies(ctx, id, "mia", post.ID, "", 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(replies) != 3 || replies[0].ID != first.ID || *replies[0].ParentID != post.ID {
+		t.Errorf("replies = %+v", replies)
+	}
+}
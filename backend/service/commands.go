@@ -0,0 +1,61 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"log"
+	"regexp"
+	"strings"
+	"unicode"
+
+	"backend/store"
+)
+
+// CommandName matches the names bots may register slash commands under.
+var CommandName = regexp.MustCompile(`^[a-z0-9_-]{1,32}$`)
+
+// routeCommand checks whether msg starts with a registered slash command
+// and, if so, addresses it to the bot that registered it instead of its
+// receiver. It returns the invocation to report once msg is stored, or nil
+// if msg is an ordinary message.
+func (m *MessageService) routeCommand(ctx context.Context, msg *store.Message) *CommandInvoked {
+	name, args, ok := parseCommand(msg.Content)
+	if !ok {
+		return nil
+	}
+
+	bot, err := m.store.CommandBot(ctx, name)
+	if err != nil {
+		if !errors.Is(err, store.ErrNotFound) {
+			log.Printf("Error looking up command /%s: %v", name, err)
+		}
+		return nil
+	}
+	if bot == msg.Sender {
+		return nil
+	}
+
+	invoked := &CommandInvoked{Command: name, Args: args, User: msg.Sender, Conversation: msg.Receiver}
+	msg.Receiver = bot
+	// A reply to a message of the original conversation would not belong to
+	// the bot's.
+	msg.ReplyToID = nil
+	return invoked
+}
+
+// parseCommand splits content of the form "/name args" into the command's
+// name and its arguments.
+func parseCommand(content string) (name, args string, ok bool) {
+	rest, ok := strings.CutPrefix(content, "/")
+	if !ok {
+		return "", "", false
+	}
+	name = rest
+	if i := strings.IndexFunc(rest, unicode.IsSpace); i >= 0 {
+		name, args = rest[:i], rest[i:]
+	}
+	if !CommandName.MatchString(name) {
+		return "", "", false
+	}
+	return name, strings.TrimSpace(args), true
+}
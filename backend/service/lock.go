@@ -0,0 +1,41 @@
+package service
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// releaseLock deletes a lock only if it is still held by the caller's token.
+var releaseLock = redis.NewScript(`
+if redis.call('GET', KEYS[1]) == ARGV[1] then
+	return redis.call('DEL', KEYS[1])
+end
+return 0
+`)
+
+// lock is a Redis lock letting one instance at a time run a background job.
+type lock struct {
+	rdb *redis.Client
+	key string
+	// token identifies this instance as the holder.
+	token string
+	ttl   time.Duration
+}
+
+// do runs fn if the lock is free, holding it meanwhile.
+func (l lock) do(ctx context.Context, fn func()) {
+	locked, err := l.rdb.SetNX(ctx, l.key, l.token, l.ttl).Result()
+	if err != nil {
+		log.Printf("Error acquiring %s: %v", l.key, err)
+		return
+	}
+	if !locked {
+		return
+	}
+	defer releaseLock.Run(context.Background(), l.rdb, []string{l.key}, l.token)
+
+	fn()
+}
@@ -0,0 +1,193 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"path"
+	"strings"
+	"sync"
+	"time"
+
+	"backend/blob"
+	"backend/media"
+	"backend/store"
+)
+
+// Media processing settings. Every instance runs a pool of workers, each
+// claiming one uploaded image at a time from the database, so an image is
+// processed once however many instances run, and again if its worker died
+// before finishing.
+const (
+	mediaInterval = 5 * time.Second
+	mediaLease    = 2 * time.Minute
+)
+
+// variantExtensions maps the content type of a variant to the extension of
+// its blob key.
+var variantExtensions = map[string]string{
+	"image/jpeg": ".jpg",
+	"image/png":  ".png",
+}
+
+// errUndecodable wraps errors decoding an image, which retrying cannot fix.
+var errUndecodable = errors.New("image cannot be decoded")
+
+// MediaProcessor reads the dimensions of uploaded images and renders their
+// thumbnails in the background.
+type MediaProcessor struct {
+	store   store.Store
+	blobs   blob.Store
+	workers int
+	// wake lets an upload start processing before the next poll.
+	wake chan struct{}
+	// onProcessed runs after an image was processed or failed, e.g. to send
+	// its message again with the thumbnail.
+	onProcessed func(ctx context.Context, messageID string)
+}
+
+// NewMediaProcessor creates a processor running workers workers.
+func NewMediaProcessor(st store.Store, blobs blob.Store, workers int, onProcessed func(ctx context.Context, messageID string)) *MediaProcessor {
+	return &MediaProcessor{
+		store:       st,
+		blobs:       blobs,
+		workers:     workers,
+		wake:        make(chan struct{}, max(workers, 1)),
+		onProcessed: onProcessed,
+	}
+}
+
+// Wake tells an idle worker that an image was uploaded.
+func (p *MediaProcessor) Wake() {
+	select {
+	case p.wake <- struct{}{}:
+	default:
+	}
+}
+
+// Run processes uploaded images until ctx is done, waiting for images being
+// processed to finish.
+func (p *MediaProcessor) Run(ctx context.Context) {
+	var wg sync.WaitGroup
+	for i := 0; i < p.workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			p.work(ctx)
+		}()
+	}
+	wg.Wait()
+}
+
+// work processes pending images whenever woken or polled.
+func (p *MediaProcessor) work(ctx context.Context) {
+	ticker := time.NewTicker(mediaInterval)
+	defer ticker.Stop()
+
+	for {
+		p.processPending(ctx)
+		select {
+		case <-p.wake:
+		case <-ticker.C:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// processPending processes images one at a time until none are pending.
+func (p *MediaProcessor) processPending(ctx context.Context) {
+	for ctx.Err() == nil {
+		pending, err := p.store.ClaimPendingMedia(ctx, mediaLease, 1)
+		if err != nil {
+			log.Printf("Error claiming images to process: %v", err)
+			return
+		}
+		if len(pending) == 0 {
+			return
+		}
+		p.process(ctx, pending[0])
+	}
+}
+
+// process renders a claimed image's variants and records them. An image that
+// cannot be decoded, or whose file is gone, is marked failed; other errors
+// are retried once the lease ends.
+func (p *MediaProcessor) process(ctx context.Context, pm store.PendingMedia) {
+	width, height, variants, err := p.render(ctx, pm)
+	if err != nil {
+		log.Printf("Error processing attachment %s: %v", pm.AttachmentID, err)
+		if !errors.Is(err, errUndecodable) && !errors.Is(err, blob.ErrNotFound) {
+			return
+		}
+		if err := p.store.FailMedia(ctx, pm.AttachmentID); err != nil {
+			log.Printf("Error marking attachment %s failed: %v", pm.AttachmentID, err)
+			return
+		}
+		p.onProcessed(ctx, pm.MessageID)
+		return
+	}
+
+	if err := p.store.CompleteMedia(ctx, pm.AttachmentID, width, height, variants); err != nil {
+		for _, v := range variants {
+			p.blobs.Delete(ctx, v.Key)
+		}
+		// A deleted attachment needs no variants; otherwise the image is
+		// claimed again once the lease ends.
+		if !errors.Is(err, store.ErrNotFound) {
+			log.Printf("Error saving variants of attachment %s: %v", pm.AttachmentID, err)
+		}
+		return
+	}
+	p.onProcessed(ctx, pm.MessageID)
+}
+
+// render decodes an image and stores its thumbnail next to it, returning
+// the image's dimensions and the variant.
+func (p *MediaProcessor) render(ctx context.Context, pm store.PendingMedia) (int, int, []store.AttachmentVariant, error) {
+	f, err := p.blobs.Get(ctx, pm.Key)
+	if err != nil {
+		return 0, 0, nil, err
+	}
+	defer f.Close()
+
+	// Decoding needs to seek; files from object stores are read into
+	// memory, which their upload limit bounds.
+	r, ok := f.(io.ReadSeeker)
+	if !ok {
+		data, err := io.ReadAll(f)
+		if err != nil {
+			return 0, 0, nil, err
+		}
+		r = bytes.NewReader(data)
+	}
+
+	img, err := media.Decode(r, pm.ContentType)
+	if err != nil {
+		return 0, 0, nil, fmt.Errorf("%w: %v", errUndecodable, err)
+	}
+	thumb := media.Thumbnail(img, pm.ContentType)
+
+	var buf bytes.Buffer
+	if err := media.Encode(&buf, thumb); err != nil {
+		return 0, 0, nil, err
+	}
+	key := strings.TrimSuffix(pm.Key, path.Ext(pm.Key)) + "_thumb" + variantExtensions[thumb.ContentType]
+	size := int64(buf.Len())
+	if err := p.blobs.Put(ctx, key, &buf, size, thumb.ContentType); err != nil {
+		return 0, 0, nil, err
+	}
+
+	bounds, thumbBounds := img.Bounds(), thumb.Image.Bounds()
+	return bounds.Dx(), bounds.Dy(), []store.AttachmentVariant{{
+		Name:        store.VariantThumbnail,
+		ContentType: thumb.ContentType,
+		Width:       thumbBounds.Dx(),
+		Height:      thumbBounds.Dy(),
+		Size:        size,
+		Key:         key,
+	}}, nil
+}
@@ -0,0 +1,48 @@
+package service
+
+import (
+	"context"
+	"log"
+	"regexp"
+	"strings"
+
+	"backend/store"
+)
+
+// mentionPattern matches @username. Trailing punctuation is trimmed from the
+// name so "@bob." mentions bob.
+var mentionPattern = regexp.MustCompile(`(?:^|[^\p{L}\p{N}_])@([\p{L}\p{N}_][\p{L}\p{N}_.-]*)`)
+
+// ParseMentions returns the distinct usernames mentioned in content, in the
+// order they first appear.
+func ParseMentions(content string) []string {
+	var names []string
+	seen := map[string]bool{}
+	for _, match := range mentionPattern.FindAllStringSubmatch(content, -1) {
+		name := strings.TrimRight(match[1], ".-")
+		if name != "" && !seen[name] {
+			seen[name] = true
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+// recordMentions stores the mentions in msg. Only the receiver can read the
+// message, so mentions of anyone else are ignored, and a shadowed message
+// mentions nobody.
+func (m *MessageService) recordMentions(ctx context.Context, msg *store.Message) {
+	if msg.Shadowed {
+		return
+	}
+	var mentioned []string
+	for _, name := range ParseMentions(msg.Content) {
+		if name == msg.Receiver {
+			mentioned = append(mentioned, name)
+		}
+	}
+
+	if err := m.store.CreateMentions(ctx, msg, mentioned); err != nil {
+		log.Printf("Error recording mentions in message %s: %v", msg.ID, err)
+	}
+}
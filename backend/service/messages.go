@@ -0,0 +1,311 @@
+// Package service implements the chat operations shared by every transport,
+// so REST and WebSocket requests are validated and stored the same way.
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	"backend/markup"
+	"backend/moderation"
+	"backend/store"
+)
+
+var (
+	// ErrMissingReceiver is returned when a message names no receiver.
+	ErrMissingReceiver = errors.New("missing receiver")
+	// ErrBlocked is returned when either participant has blocked the other.
+	ErrBlocked = errors.New("you cannot message this user")
+	// ErrUnknownReceiver is returned when a message names a receiver who
+	// does not exist.
+	ErrUnknownReceiver = errors.New("receiver not found")
+	// ErrSendAtInPast is returned when a message is scheduled for a time
+	// that has already passed.
+	ErrSendAtInPast = errors.New("send_at must be in the future")
+	// ErrEmptyContent is returned when a message has no content.
+	ErrEmptyContent = errors.New("message content is empty")
+	// ErrContentTooLong matches the ContentTooLongError returned when a
+	// message's content is longer than the limit.
+	ErrContentTooLong = errors.New("message content is too long")
+	// ErrInvalidFormat is returned when a message's format is neither plain
+	// nor markdown.
+	ErrInvalidFormat = errors.New("format must be plain or markdown")
+)
+
+// DefaultMaxContentLength is the most characters a message's content may
+// have unless configured otherwise.
+const DefaultMaxContentLength = 4000
+
+// ContentTooLongError is returned when a message's content has more than Max
+// characters.
+type ContentTooLongError struct {
+	Max int
+}
+
+func (e *ContentTooLongError) Error() string {
+	return fmt.Sprintf("message content is longer than %d characters", e.Max)
+}
+
+func (e *ContentTooLongError) Is(target error) bool {
+	return target == ErrContentTooLong
+}
+
+// RejectedError is returned when the content filter rejects a message.
+type RejectedError struct {
+	Reasons []string
+}
+
+func (e *RejectedError) Error() string {
+	return "message rejected by the content filter: " + strings.Join(e.Reasons, "; ")
+}
+
+// Publisher delivers stored messages to their participants. ctx carries the
+// trace of the send; delivery may outlive it.
+type Publisher interface {
+	Publish(ctx context.Context, msg store.Message)
+}
+
+// PublisherFunc adapts a function to a Publisher.
+type PublisherFunc func(ctx context.Context, msg store.Message)
+
+func (f PublisherFunc) Publish(ctx context.Context, msg store.Message) {
+	f(ctx, msg)
+}
+
+// MessageService sends messages.
+type MessageService struct {
+	store             store.Store
+	publisher         Publisher
+	filter            *moderation.Pipeline
+	defaultStrictness moderation.Strictness
+	webhooks          *Webhooks
+	quotas            Quotas
+	maxContentLength  int
+}
+
+// NewMessageService creates a MessageService that filters content at
+// defaultStrictness unless a conversation's participants chose otherwise,
+// reports flagged messages to webhooks and enforces quotas. Content may have
+// up to maxContentLength characters, DefaultMaxContentLength if it is zero.
+func NewMessageService(st store.Store, publisher Publisher, filter *moderation.Pipeline, defaultStrictness moderation.Strictness, webhooks *Webhooks, quotas Quotas, maxContentLength int) *MessageService {
+	if maxContentLength <= 0 {
+		maxContentLength = DefaultMaxContentLength
+	}
+	return &MessageService{
+		store:             st,
+		publisher:         publisher,
+		filter:            filter,
+		defaultStrictness: defaultStrictness,
+		webhooks:          webhooks,
+		quotas:            quotas,
+		maxContentLength:  maxContentLength,
+	}
+}
+
+// Send validates msg from its sender, checks their quota, filters its
+// content, stores it and publishes it. On success msg has its ID, status
+// and timestamps set, its content sanitized and masked if the filter
+// required it, and its HTML rendered. A message starting with a slash
+// command is sent to the bot that registered it instead of its receiver. A
+// message from a user who is shadow-muted globally is stored shadowed, and
+// its command, if any, is not run. Messages sent this way are always user
+// messages, whatever kind the caller set; only the server posts system
+// messages.
+func (m *MessageService) Send(ctx context.Context, msg *store.Message) error {
+	msg.Kind, msg.System = store.KindUser, nil
+	msg.Content = markup.Sanitize(msg.Content)
+	if err := m.ValidateContent(msg.Content); err != nil {
+		return err
+	}
+	if err := normalizeFormat(&msg.Format); err != nil {
+		return err
+	}
+	invoked := m.routeCommand(ctx, msg)
+	msg.ReplyToID = normalizeReplyTo(msg.ReplyToID)
+	replyTo, err := m.validate(ctx, msg.Sender, &msg.Receiver, msg.ReplyToID)
+	if err != nil {
+		return err
+	}
+	msg.ReplyTo = replyTo
+	if msg.Shadowed, err = m.store.ShadowMuted(ctx, msg.Sender, ""); err != nil {
+		return err
+	}
+	if err := m.CheckQuota(ctx, msg.Sender, 0); err != nil {
+		return err
+	}
+
+	verdict := m.filter.Apply(ctx, msg.Content, m.Strictness(ctx, msg.Sender, msg.Receiver))
+	if verdict.Action == moderation.Reject {
+		return &RejectedError{Reasons: verdict.Reasons}
+	}
+	msg.Content = verdict.Content
+
+	if err := m.store.CreateMessage(ctx, msg); err != nil {
+		return err
+	}
+	msg.HTML = markup.Render(msg.Format, msg.Content)
+	m.recordFlag(ctx, *msg, verdict)
+	m.recordMentions(ctx, msg)
+
+	m.publisher.Publish(ctx, *msg)
+	if invoked != nil && !msg.Shadowed {
+		invoked.MessageID = msg.ID
+		m.webhooks.EmitTo(ctx, EventCommandInvoked, msg.Receiver, invoked)
+	}
+	return nil
+}
+
+// Schedule validates sm and stores it to be sent at sm.SendAt. The content
+// filter runs again when it is sent, since strictness may change meanwhile.
+func (m *MessageService) Schedule(ctx context.Context, sm *store.ScheduledMessage) error {
+	if !sm.SendAt.After(time.Now()) {
+		return ErrSendAtInPast
+	}
+	sm.Content = markup.Sanitize(sm.Content)
+	if err := m.ValidateContent(sm.Content); err != nil {
+		return err
+	}
+	if err := normalizeFormat(&sm.Format); err != nil {
+		return err
+	}
+	sm.ReplyToID = normalizeReplyTo(sm.ReplyToID)
+	if _, err := m.validate(ctx, sm.Sender, &sm.Receiver, sm.ReplyToID); err != nil {
+		return err
+	}
+
+	verdict := m.filter.Apply(ctx, sm.Content, m.Strictness(ctx, sm.Sender, sm.Receiver))
+	if verdict.Action == moderation.Reject {
+		return &RejectedError{Reasons: verdict.Reasons}
+	}
+
+	return m.store.CreateScheduled(ctx, sm)
+}
+
+// ValidateContent checks that sanitized content is neither blank nor longer
+// than the limit. Content of nothing but white space and invisible
+// formatting characters, such as zero width spaces, is blank.
+func (m *MessageService) ValidateContent(content string) error {
+	if blank(content) {
+		return ErrEmptyContent
+	}
+	if utf8.RuneCountInString(content) > m.maxContentLength {
+		return &ContentTooLongError{Max: m.maxContentLength}
+	}
+	return nil
+}
+
+func blank(content string) bool {
+	for _, r := range content {
+		if !unicode.IsSpace(r) && !unicode.Is(unicode.Cf, r) {
+			return false
+		}
+	}
+	return true
+}
+
+// normalizeFormat defaults an unset format to plain and checks that it is
+// one the server renders.
+func normalizeFormat(format *string) error {
+	if *format == "" {
+		*format = markup.FormatPlain
+	}
+	if !markup.ValidFormat(*format) {
+		return ErrInvalidFormat
+	}
+	return nil
+}
+
+// validate checks that sender may message receiver, in reply to replyToID
+// if it is set, and returns the preview of the message replied to. The
+// receiver is replaced by the username they registered, so a message to
+// "BOB" is stored as one to "bob".
+func (m *MessageService) validate(ctx context.Context, sender string, receiver *string, replyToID *string) (*store.ReplyPreview, error) {
+	if *receiver == "" {
+		return nil, ErrMissingReceiver
+	}
+	canonical, err := m.store.CanonicalUsername(ctx, *receiver)
+	if errors.Is(err, store.ErrNotFound) {
+		return nil, ErrUnknownReceiver
+	}
+	if err != nil {
+		return nil, err
+	}
+	*receiver = canonical
+
+	blocked, err := m.store.IsBlocked(ctx, sender, *receiver)
+	if err != nil {
+		return nil, err
+	}
+	if blocked {
+		return nil, ErrBlocked
+	}
+
+	if replyToID == nil {
+		return nil, nil
+	}
+	return m.store.ReplyPreview(ctx, *replyToID, sender, *receiver)
+}
+
+// normalizeReplyTo treats an empty reply_to_id as no reply.
+func normalizeReplyTo(replyToID *string) *string {
+	if replyToID != nil && *replyToID == "" {
+		return nil
+	}
+	return replyToID
+}
+
+// Strictness returns the content filter strictness of the conversation
+// between two users: the stricter of the settings the two chose, or the
+// default if neither chose one. Lookup errors fall back to the default so a
+// database hiccup does not switch filtering off.
+func (m *MessageService) Strictness(ctx context.Context, a, b string) moderation.Strictness {
+	strictness := moderation.Off
+	chosen := false
+
+	for _, pair := range [][2]string{{a, b}, {b, a}} {
+		name, err := m.store.Strictness(ctx, pair[0], pair[1])
+		if err != nil {
+			log.Printf("Error fetching content filter strictness of %s: %v", pair[0], err)
+			return m.defaultStrictness
+		}
+		if name == "" {
+			continue
+		}
+		if st, err := moderation.ParseStrictness(name); err == nil && (!chosen || st > strictness) {
+			strictness = st
+			chosen = true
+		}
+	}
+
+	if !chosen {
+		return m.defaultStrictness
+	}
+	return strictness
+}
+
+// recordFlag stores msg for review if the content filter flagged it, and
+// reports it to webhooks.
+func (m *MessageService) recordFlag(ctx context.Context, msg store.Message, v moderation.Verdict) {
+	if !v.Flagged {
+		return
+	}
+
+	f := store.Flag{
+		MessageID: msg.ID,
+		Sender:    msg.Sender,
+		Receiver:  msg.Receiver,
+		Content:   msg.Content,
+		Reason:    strings.Join(v.Reasons, "; "),
+	}
+	if err := m.store.FlagMessage(ctx, f); err != nil {
+		log.Printf("Error flagging message from %s: %v", msg.Sender, err)
+		return
+	}
+	m.webhooks.Emit(ctx, EventMessageReported, f)
+}
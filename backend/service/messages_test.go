@@ -0,0 +1,226 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"backend/moderation"
+	"backend/store"
+)
+
+func TestSend(t *testing.T) {
+	ctx := context.Background()
+	st := newTestStore(t, "alice", "bob")
+	messages, published := newTestMessages(t, st, moderation.Off, Quotas{})
+
+	msg := store.Message{Sender: "alice", Receiver: "bob", Content: "hi <script>x</script>*bob*", Format: "markdown"}
+	if err := messages.Send(ctx, &msg); err != nil {
+		t.Fatal(err)
+	}
+	if msg.ID == "" || msg.Kind != store.KindUser || msg.Status != "sent" {
+		t.Errorf("sent %+v", msg)
+	}
+	if msg.HTML != "<p>hi &lt;script&gt;x&lt;/script&gt;<em>bob</em></p>" {
+		t.Errorf("HTML = %q", msg.HTML)
+	}
+	if len(published.messages) != 1 || published.messages[0].ID != msg.ID {
+		t.Errorf("published %+v", published.messages)
+	}
+
+	stored, err := st.RecentMessages(ctx, "bob", "alice", 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(stored) != 1 || stored[0].Content != msg.Content {
+		t.Errorf("stored %+v", stored)
+	}
+}
+
+func TestSendValidates(t *testing.T) {
+	ctx := context.Background()
+	st := newTestStore(t, "alice", "bob", "carol")
+	messages, published := newTestMessages(t, st, moderation.Off, Quotas{})
+
+	other := store.Message{Sender: "bob", Receiver: "carol", Content: "hi"}
+	if err := messages.Send(ctx, &other); err != nil {
+		t.Fatal(err)
+	}
+	published.messages = nil
+
+	tests := []struct {
+		name string
+		msg  store.Message
+		want error
+	}{
+		{"missing receiver", store.Message{Content: "hi"}, ErrMissingReceiver},
+		{"unknown receiver", store.Message{Receiver: "dave", Content: "hi"}, ErrUnknownReceiver},
+		{"empty content", store.Message{Receiver: "bob", Content: " ​\n"}, ErrEmptyContent},
+		{"content too long", store.Message{Receiver: "bob", Content: strings.Repeat("a", 41)}, ErrContentTooLong},
+		{"invalid format", store.Message{Receiver: "bob", Content: "hi", Format: "html"}, ErrInvalidFormat},
+		{"reply to another conversation", store.Message{Receiver: "bob", Content: "hi", ReplyToID: &other.ID}, store.ErrInvalidReplyTo},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.msg.Sender = "alice"
+			if err := messages.Send(ctx, &tt.msg); !errors.Is(err, tt.want) {
+				t.Errorf("got %v, want %v", err, tt.want)
+			}
+		})
+	}
+	if len(published.messages) != 0 {
+		t.Errorf("published %+v", published.messages)
+	}
+}
+
+func TestSendResolvesReceiver(t *testing.T) {
+	ctx := context.Background()
+	st := newTestStore(t, "alice", "bob")
+	messages, _ := newTestMessages(t, st, moderation.Off, Quotas{})
+
+	for _, receiver := range []string{"BOB", "Bob", "ｂｏｂ"} {
+		msg := store.Message{Sender: "alice", Receiver: receiver, Content: "hi"}
+		if err := messages.Send(ctx, &msg); err != nil {
+			t.Fatalf("send to %q: %v", receiver, err)
+		}
+		if msg.Receiver != "bob" {
+			t.Errorf("send to %q: receiver = %q, want bob", receiver, msg.Receiver)
+		}
+	}
+
+	sm := store.ScheduledMessage{Sender: "alice", Receiver: "dave", Content: "hi", SendAt: time.Now().Add(time.Hour)}
+	if err := messages.Schedule(ctx, &sm); !errors.Is(err, ErrUnknownReceiver) {
+		t.Errorf("schedule: got %v, want ErrUnknownReceiver", err)
+	}
+	err := messages.SendBatch(ctx, "alice", []*store.Message{{Receiver: "bob", Content: "one"}, {Receiver: "dave", Content: "two"}})
+	var batchErr *BatchError
+	if !errors.As(err, &batchErr) || batchErr.Index != 1 || !errors.Is(err, ErrUnknownReceiver) {
+		t.Errorf("batch: got %v, want BatchError at 1", err)
+	}
+}
+
+func TestSendKeepsSystemMessagesToTheServer(t *testing.T) {
+	st := newTestStore(t, "alice", "bob")
+	messages, _ := newTestMessages(t, st, moderation.Off, Quotas{})
+
+	msg := store.Message{Sender: "alice", Receiver: "bob", Content: "hi", Kind: store.KindSystem, System: &store.SystemEvent{Event: store.SystemMessagePinned}}
+	if err := messages.Send(context.Background(), &msg); err != nil {
+		t.Fatal(err)
+	}
+	if msg.Kind != store.KindUser || msg.System != nil {
+		t.Errorf("sent kind %q, system %+v", msg.Kind, msg.System)
+	}
+}
+
+func TestSendBlocked(t *testing.T) {
+	ctx := context.Background()
+	st := newTestStore(t, "alice", "bob")
+	messages, _ := newTestMessages(t, st, moderation.Off, Quotas{})
+	if err := st.Block(ctx, "bob", "alice"); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, msg := range []store.Message{
+		{Sender: "alice", Receiver: "bob", Content: "hi"},
+		{Sender: "bob", Receiver: "alice", Content: "hi"},
+	} {
+		if err := messages.Send(ctx, &msg); !errors.Is(err, ErrBlocked) {
+			t.Errorf("%s to %s: got %v, want ErrBlocked", msg.Sender, msg.Receiver, err)
+		}
+	}
+}
+
+func TestSendQuota(t *testing.T) {
+	ctx := context.Background()
+	st := newTestStore(t, "alice", "bob")
+	messages, _ := newTestMessages(t, st, moderation.Off, Quotas{MessagesPerDay: 2})
+
+	for i := 0; i < 2; i++ {
+		if err := messages.Send(ctx, &store.Message{Sender: "alice", Receiver: "bob", Content: "hi"}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := messages.Send(ctx, &store.Message{Sender: "alice", Receiver: "bob", Content: "hi"}); !errors.Is(err, ErrMessageQuota) {
+		t.Errorf("got %v, want ErrMessageQuota", err)
+	}
+	if err := messages.Send(ctx, &store.Message{Sender: "bob", Receiver: "alice", Content: "hi"}); err != nil {
+		t.Errorf("other sender: %v", err)
+	}
+}
+
+func TestSendContentFilter(t *testing.T) {
+	ctx := context.Background()
+	st := newTestStore(t, "alice", "bob")
+
+	tests := []struct {
+		strictness moderation.Strictness
+		content    string
+		rejected   bool
+	}{
+		{moderation.Off, "oh darn", false},
+		{moderation.Low, "oh darn", false},
+		{moderation.Medium, "oh ****", false},
+		{moderation.High, "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.strictness.String(), func(t *testing.T) {
+			messages, _ := newTestMessages(t, st, tt.strictness, Quotas{})
+			msg := store.Message{Sender: "alice", Receiver: "bob", Content: "oh darn"}
+			err := messages.Send(ctx, &msg)
+
+			var rejected *RejectedError
+			if tt.rejected {
+				if !errors.As(err, &rejected) {
+					t.Fatalf("got %v, want RejectedError", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if msg.Content != tt.content {
+				t.Errorf("content = %q, want %q", msg.Content, tt.content)
+			}
+		})
+	}
+}
+
+func TestSendBatch(t *testing.T) {
+	ctx := context.Background()
+	st := newTestStore(t, "bot", "alice", "bob")
+	messages, published := newTestMessages(t, st, moderation.Off, Quotas{})
+
+	err := messages.SendBatch(ctx, "bot", []*store.Message{
+		{Receiver: "alice", Content: "one"},
+		{Receiver: "bob", Content: " "},
+	})
+	var batchErr *BatchError
+	if !errors.As(err, &batchErr) || batchErr.Index != 1 || !errors.Is(err, ErrEmptyContent) {
+		t.Fatalf("got %v, want BatchError at 1", err)
+	}
+	if len(published.messages) != 0 {
+		t.Fatalf("a failed batch published %+v", published.messages)
+	}
+
+	batch := []*store.Message{
+		{Sender: "alice", Receiver: "bob", Content: "one", Kind: store.KindSystem},
+		{Receiver: "bob", Content: "two"},
+	}
+	if err := messages.SendBatch(ctx, "bot", batch); err != nil {
+		t.Fatal(err)
+	}
+	for _, msg := range batch {
+		if msg.ID == "" || msg.Sender != "bot" || msg.Kind != store.KindUser {
+			t.Errorf("sent %+v", msg)
+		}
+	}
+	if len(published.messages) != 2 {
+		t.Errorf("published %d messages", len(published.messages))
+	}
+
+	if err := messages.SendBatch(ctx, "bot", nil); !errors.Is(err, ErrEmptyBatch) {
+		t.Errorf("got %v, want ErrEmptyBatch", err)
+	}
+}
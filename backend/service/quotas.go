@@ -0,0 +1,77 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"backend/store"
+)
+
+// QuotaWindow is the period Quotas.MessagesPerDay counts messages over.
+const QuotaWindow = 24 * time.Hour
+
+var (
+	// ErrMessageQuota is returned when a user sent Quotas.MessagesPerDay
+	// messages in the last QuotaWindow.
+	ErrMessageQuota = errors.New("daily message quota exceeded")
+	// ErrStorageQuota is returned when an upload would take a user's
+	// attachments past Quotas.StorageBytes.
+	ErrStorageQuota = errors.New("storage quota exceeded")
+)
+
+// Quotas limit what each user may send and store. Zero means no limit.
+type Quotas struct {
+	// MessagesPerDay caps the messages a user sends in any QuotaWindow.
+	MessagesPerDay int
+	// StorageBytes caps the total size of the attachments a user uploaded.
+	StorageBytes int64
+}
+
+// Quotas returns the quotas the service enforces.
+func (m *MessageService) Quotas() Quotas {
+	return m.quotas
+}
+
+// Usage returns how much username sent in the last QuotaWindow and stores.
+func (m *MessageService) Usage(ctx context.Context, username string) (store.Usage, error) {
+	return m.store.Usage(ctx, username, QuotaWindow)
+}
+
+// CheckQuota returns ErrMessageQuota if sender may not send another message,
+// or ErrStorageQuota if uploading uploadBytes more would exceed their
+// storage quota. Concurrent sends may overshoot a quota slightly.
+func (m *MessageService) CheckQuota(ctx context.Context, sender string, uploadBytes int64) error {
+	if m.quotas.MessagesPerDay == 0 && (m.quotas.StorageBytes == 0 || uploadBytes == 0) {
+		return nil
+	}
+
+	usage, err := m.Usage(ctx, sender)
+	if err != nil {
+		return err
+	}
+	if m.quotas.MessagesPerDay > 0 && usage.Messages >= m.quotas.MessagesPerDay {
+		return ErrMessageQuota
+	}
+	if m.quotas.StorageBytes > 0 && usage.StorageBytes+uploadBytes > m.quotas.StorageBytes {
+		return ErrStorageQuota
+	}
+	return nil
+}
+
+// checkMessageQuota returns ErrMessageQuota if sending n more messages
+// would take sender past their daily quota.
+func (m *MessageService) checkMessageQuota(ctx context.Context, sender string, n int) error {
+	if m.quotas.MessagesPerDay == 0 {
+		return nil
+	}
+
+	usage, err := m.Usage(ctx, sender)
+	if err != nil {
+		return err
+	}
+	if usage.Messages+n > m.quotas.MessagesPerDay {
+		return ErrMessageQuota
+	}
+	return nil
+}
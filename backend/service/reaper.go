@@ -0,0 +1,105 @@
+package service
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"backend/blob"
+	"backend/store"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// Reaper settings. Like the scheduler, only the instance holding the lock
+// deletes expired messages.
+const (
+	reaperInterval = time.Second
+	reaperBatch    = 100
+	reaperLockKey  = "reaper:lock"
+	reaperLockTTL  = 30 * time.Second
+)
+
+// Reaper deletes disappearing messages once they expire, and files uploaded
+// straight to the blob store but never sent.
+type Reaper struct {
+	store store.Store
+	blobs blob.Store
+	lock  lock
+	// onExpired runs after messages were deleted, e.g. to tell their
+	// participants.
+	onExpired func(ctx context.Context, expired []store.ExpiredMessage)
+}
+
+// NewReaper creates a reaper. token must be unique to this instance.
+func NewReaper(st store.Store, blobs blob.Store, rdb *redis.Client, token string, onExpired func(ctx context.Context, expired []store.ExpiredMessage)) *Reaper {
+	return &Reaper{
+		store:     st,
+		blobs:     blobs,
+		lock:      lock{rdb: rdb, key: reaperLockKey, token: token, ttl: reaperLockTTL},
+		onExpired: onExpired,
+	}
+}
+
+// Run deletes expired messages and uploads until ctx is done.
+func (r *Reaper) Run(ctx context.Context) {
+	ticker := time.NewTicker(reaperInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			r.lock.do(ctx, func() {
+				r.deleteExpired(ctx)
+				r.deleteExpiredUploads(ctx)
+			})
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// deleteExpired deletes every expired message along with its attachment files.
+func (r *Reaper) deleteExpired(ctx context.Context) {
+	for {
+		expired, err := r.store.DeleteExpired(ctx, time.Now(), reaperBatch)
+		if err != nil {
+			log.Printf("Error deleting expired messages: %v", err)
+			return
+		}
+
+		for _, m := range expired {
+			for _, key := range m.AttachmentKeys {
+				if err := r.blobs.Delete(ctx, key); err != nil {
+					log.Printf("Error removing attachment of expired message %s: %v", m.ID, err)
+				}
+			}
+		}
+		if len(expired) > 0 {
+			r.onExpired(ctx, expired)
+		}
+		if len(expired) < reaperBatch || ctx.Err() != nil {
+			return
+		}
+	}
+}
+
+// deleteExpiredUploads deletes the files of uploads that expired unsent.
+func (r *Reaper) deleteExpiredUploads(ctx context.Context) {
+	for {
+		keys, err := r.store.DeleteExpiredUploads(ctx, reaperBatch)
+		if err != nil {
+			log.Printf("Error deleting expired uploads: %v", err)
+			return
+		}
+
+		for _, key := range keys {
+			if err := r.blobs.Delete(ctx, key); err != nil {
+				log.Printf("Error removing expired upload %s: %v", key, err)
+			}
+		}
+		if len(keys) < reaperBatch || ctx.Err() != nil {
+			return
+		}
+	}
+}
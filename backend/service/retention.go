@@ -0,0 +1,86 @@
+package service
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"backend/blob"
+	"backend/store"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// Retention settings. Like the reaper, only the instance holding the lock
+// manages partitions.
+const (
+	retentionInterval = time.Hour
+	retentionLockKey  = "retention:lock"
+	retentionLockTTL  = 30 * time.Minute
+	// partitionsAhead is how many months after the current one have their
+	// partition created in advance.
+	partitionsAhead = 2
+)
+
+// Retention keeps a partition of messages ready for the coming months and,
+// if a retention period is set, removes the months older than it.
+type Retention struct {
+	store store.Store
+	blobs blob.Store
+	lock  lock
+	// keep is how long messages are kept, zero for ever. Messages are
+	// removed a month at a time, once the newest of their month is older.
+	keep    time.Duration
+	archive bool
+}
+
+// NewRetention creates a retention job keeping messages for keep, or for
+// ever if it is zero, and archiving older months instead of dropping them
+// if archive is set. token must be unique to this instance.
+func NewRetention(st store.Store, blobs blob.Store, rdb *redis.Client, token string, keep time.Duration, archive bool) *Retention {
+	return &Retention{
+		store:   st,
+		blobs:   blobs,
+		lock:    lock{rdb: rdb, key: retentionLockKey, token: token, ttl: retentionLockTTL},
+		keep:    keep,
+		archive: archive,
+	}
+}
+
+// Run manages partitions at once and then every retentionInterval until ctx
+// is done.
+func (r *Retention) Run(ctx context.Context) {
+	ticker := time.NewTicker(retentionInterval)
+	defer ticker.Stop()
+
+	for {
+		r.lock.do(ctx, func() { r.run(ctx) })
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+func (r *Retention) run(ctx context.Context) {
+	now := time.Now()
+	if err := r.store.EnsureMessagePartitions(ctx, now, now.AddDate(0, partitionsAhead, 0)); err != nil {
+		log.Printf("Error creating message partitions: %v", err)
+	}
+	if r.keep == 0 {
+		return
+	}
+
+	// Keys of the attachments of months removed before a failure are still
+	// returned, since their rows are gone.
+	keys, err := r.store.ExpireMessagePartitions(ctx, now.Add(-r.keep), r.archive)
+	if err != nil {
+		log.Printf("Error removing old messages: %v", err)
+	}
+	for _, key := range keys {
+		if err := r.blobs.Delete(ctx, key); err != nil {
+			log.Printf("Error removing attachment %s of an old message: %v", key, err)
+		}
+	}
+}
@@ -0,0 +1,90 @@
+package service
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"backend/store"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// Scheduler settings. Every instance polls for due messages, but only the
+// one holding the Redis lock sends them, so each is sent once.
+const (
+	schedulerInterval = time.Second
+	schedulerBatch    = 100
+	schedulerLockKey  = "scheduler:lock"
+	schedulerLockTTL  = 30 * time.Second
+)
+
+// Scheduler sends scheduled messages when they fall due.
+type Scheduler struct {
+	store    store.Store
+	lock     lock
+	messages *MessageService
+	// onSent runs after a scheduled message was sent, e.g. to count it.
+	onSent func(msg store.Message)
+}
+
+// NewScheduler creates a scheduler sending messages through messages. token
+// must be unique to this instance.
+func NewScheduler(st store.Store, rdb *redis.Client, messages *MessageService, token string, onSent func(msg store.Message)) *Scheduler {
+	return &Scheduler{
+		store:    st,
+		lock:     lock{rdb: rdb, key: schedulerLockKey, token: token, ttl: schedulerLockTTL},
+		messages: messages,
+		onSent:   onSent,
+	}
+}
+
+// Run sends due messages until ctx is done.
+func (s *Scheduler) Run(ctx context.Context) {
+	ticker := time.NewTicker(schedulerInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			s.lock.do(ctx, func() { s.sendDue(ctx) })
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// sendDue sends every due message.
+func (s *Scheduler) sendDue(ctx context.Context) {
+	for {
+		due, err := s.store.ClaimDueScheduled(ctx, time.Now(), schedulerBatch)
+		if err != nil {
+			log.Printf("Error claiming scheduled messages: %v", err)
+			return
+		}
+
+		for _, sm := range due {
+			s.send(ctx, sm)
+		}
+		if len(due) < schedulerBatch || ctx.Err() != nil {
+			return
+		}
+	}
+}
+
+// send sends a claimed scheduled message. A message that can no longer be
+// sent, e.g. because a block was placed since, is dropped.
+func (s *Scheduler) send(ctx context.Context, sm store.ScheduledMessage) {
+	msg := store.Message{
+		Sender:    sm.Sender,
+		Receiver:  sm.Receiver,
+		Content:   sm.Content,
+		Format:    sm.Format,
+		ReplyToID: sm.ReplyToID,
+	}
+	if err := s.messages.Send(ctx, &msg); err != nil {
+		log.Printf("Error sending scheduled message %s from %s: %v", sm.ID, sm.Sender, err)
+		return
+	}
+	s.onSent(msg)
+}
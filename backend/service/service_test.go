@@ -0,0 +1,57 @@
+package service
+
+import (
+	"context"
+	"sync"
+	"testing"
+
+	"backend/moderation"
+	"backend/store"
+	"backend/store/memory"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/go-redis/redis/v8"
+)
+
+// newTestStore returns a memory store with users signed up.
+func newTestStore(t *testing.T, users ...string) store.Store {
+	t.Helper()
+	st := memory.New()
+	for _, u := range users {
+		if err := st.CreateUser(context.Background(), u, store.Password{}, ""); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return st
+}
+
+// newTestRedis returns a client of a Redis running in the test.
+func newTestRedis(t *testing.T) *redis.Client {
+	t.Helper()
+	rdb := redis.NewClient(&redis.Options{Addr: miniredis.RunT(t).Addr()})
+	t.Cleanup(func() { rdb.Close() })
+	return rdb
+}
+
+// published records the messages a MessageService publishes.
+type published struct {
+	mu       sync.Mutex
+	messages []store.Message
+}
+
+func (p *published) Publish(ctx context.Context, msg store.Message) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.messages = append(p.messages, msg)
+}
+
+// newTestMessages returns a MessageService on st filtering the words
+// "darn" and "heck" at strictness, allowing 40 characters, and what it
+// publishes.
+func newTestMessages(t *testing.T, st store.Store, strictness moderation.Strictness, quotas Quotas) (*MessageService, *published) {
+	t.Helper()
+	p := &published{}
+	filter := moderation.NewPipeline(moderation.NewWordlist([]string{"darn", "heck"}))
+	webhooks := NewWebhooks(st, newTestRedis(t), "test")
+	return NewMessageService(st, p, filter, strictness, webhooks, quotas, 40), p
+}
@@ -0,0 +1,140 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"backend/auth"
+	"backend/store"
+)
+
+var (
+	// ErrInvalidCredentials is returned when a username and password do not
+	// match.
+	ErrInvalidCredentials = errors.New("invalid username or password")
+	// ErrBanned is returned when a banned user tries to log in.
+	ErrBanned = errors.New("account is banned")
+	// ErrEmailNotVerified is returned when a user whose email is not
+	// verified tries to log in while verification is required.
+	ErrEmailNotVerified = errors.New("email is not verified")
+)
+
+// TokenPair is an access token and the refresh token of its session.
+type TokenPair struct {
+	Token        string `json:"token"`
+	RefreshToken string `json:"refresh_token"`
+}
+
+// SessionService logs users in and out and renews their access tokens.
+type SessionService struct {
+	store     store.Store
+	tokens    *auth.Tokens
+	passwords *auth.Hasher
+	// requireVerifiedEmail refuses logins of users with an unverified email.
+	requireVerifiedEmail bool
+}
+
+// NewSessionService creates a SessionService issuing access tokens with
+// tokens and checking passwords with passwords. If requireVerifiedEmail is
+// set, users who gave an email cannot log in until they verify it.
+func NewSessionService(st store.Store, tokens *auth.Tokens, passwords *auth.Hasher, requireVerifiedEmail bool) *SessionService {
+	return &SessionService{store: st, tokens: tokens, passwords: passwords, requireVerifiedEmail: requireVerifiedEmail}
+}
+
+// Login checks a user's password and starts a new session on client. A
+// password hashed with an outdated algorithm or parameters is rehashed,
+// since this is the only time the plain password is known.
+func (s *SessionService) Login(ctx context.Context, username, password string, client store.SessionClient) (TokenPair, error) {
+	storedPassword, err := s.store.PasswordHash(ctx, username)
+	if err != nil {
+		return TokenPair{}, ErrInvalidCredentials
+	}
+	ok, rehash := s.passwords.Check(storedPassword, password)
+	if !ok {
+		return TokenPair{}, ErrInvalidCredentials
+	}
+	if rehash {
+		s.rehash(ctx, username, password)
+	}
+
+	if _, banned, err := s.store.Role(ctx, username); err != nil || banned {
+		return TokenPair{}, ErrBanned
+	}
+
+	if s.requireVerifiedEmail {
+		email, verified, err := s.store.EmailStatus(ctx, username)
+		if err != nil {
+			return TokenPair{}, err
+		}
+		if email != "" && !verified {
+			return TokenPair{}, ErrEmailNotVerified
+		}
+	}
+
+	return s.Issue(ctx, username, client)
+}
+
+// rehash replaces a user's password hash with one made by the current
+// algorithm and parameters. Failing to is logged, not returned, as the old
+// hash still works.
+func (s *SessionService) rehash(ctx context.Context, username, password string) {
+	hashed, err := s.passwords.Hash(password)
+	if err == nil {
+		err = s.store.SetPasswordHash(ctx, username, hashed)
+	}
+	if err != nil {
+		log.Printf("Error rehashing password of %s: %v", username, err)
+	}
+}
+
+// Issue starts a new session on client for a user who is already
+// authenticated.
+func (s *SessionService) Issue(ctx context.Context, username string, client store.SessionClient) (TokenPair, error) {
+	token, err := s.tokens.Generate(username)
+	if err != nil {
+		return TokenPair{}, fmt.Errorf("error generating token: %v", err)
+	}
+
+	refreshToken, err := auth.NewOpaqueToken()
+	if err != nil {
+		return TokenPair{}, fmt.Errorf("error generating refresh token: %v", err)
+	}
+
+	err = s.store.CreateSession(ctx, username, auth.HashToken(refreshToken), client, time.Now().Add(auth.RefreshTokenTTL))
+	if err != nil {
+		return TokenPair{}, fmt.Errorf("error creating session: %v", err)
+	}
+
+	return TokenPair{Token: token, RefreshToken: refreshToken}, nil
+}
+
+// Refresh exchanges a refresh token for a new token pair, invalidating the
+// old refresh token and recording client as the one the session was last
+// used from. An unknown or expired refresh token returns
+// store.ErrInvalidSession.
+func (s *SessionService) Refresh(ctx context.Context, refreshToken string, client store.SessionClient) (TokenPair, error) {
+	next, err := auth.NewOpaqueToken()
+	if err != nil {
+		return TokenPair{}, fmt.Errorf("error generating refresh token: %v", err)
+	}
+
+	username, err := s.store.RotateSession(ctx, auth.HashToken(refreshToken), auth.HashToken(next), client, time.Now().Add(auth.RefreshTokenTTL))
+	if err != nil {
+		return TokenPair{}, err
+	}
+
+	token, err := s.tokens.Generate(username)
+	if err != nil {
+		return TokenPair{}, fmt.Errorf("error generating token: %v", err)
+	}
+
+	return TokenPair{Token: token, RefreshToken: next}, nil
+}
+
+// Logout revokes the session behind a refresh token.
+func (s *SessionService) Logout(ctx context.Context, refreshToken string) error {
+	return s.store.RevokeSession(ctx, auth.HashToken(refreshToken))
+}
@@ -0,0 +1,50 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"backend/auth"
+	"backend/store"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+func TestLoginUpgradesBcryptHash(t *testing.T) {
+	ctx := context.Background()
+	hash, err := bcrypt.GenerateFromPassword([]byte("password1"), bcrypt.MinCost)
+	if err != nil {
+		t.Fatal(err)
+	}
+	st := newTestStore(t)
+	if err := st.CreateUser(ctx, "alice", store.Password{Algo: store.PasswordBcrypt, Hash: string(hash)}, ""); err != nil {
+		t.Fatal(err)
+	}
+	passwords, err := auth.NewHasher(store.PasswordArgon2id, auth.Argon2Params{Memory: 64, Iterations: 1, Parallelism: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sessions := NewSessionService(st, auth.NewTokens("test-secret"), passwords, false)
+
+	if _, err := sessions.Login(ctx, "alice", "wrong", store.SessionClient{}); !errors.Is(err, ErrInvalidCredentials) {
+		t.Fatalf("wrong password: got %v, want ErrInvalidCredentials", err)
+	}
+	if stored, _ := st.PasswordHash(ctx, "alice"); stored.Algo != store.PasswordBcrypt {
+		t.Fatalf("a failed login rehashed the password to %s", stored.Algo)
+	}
+
+	if _, err := sessions.Login(ctx, "alice", "password1", store.SessionClient{}); err != nil {
+		t.Fatal(err)
+	}
+	stored, err := st.PasswordHash(ctx, "alice")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stored.Algo != store.PasswordArgon2id {
+		t.Fatalf("Algo = %q after login, want %q", stored.Algo, store.PasswordArgon2id)
+	}
+	if _, err := sessions.Login(ctx, "alice", "password1", store.SessionClient{}); err != nil {
+		t.Errorf("login with the upgraded hash: %v", err)
+	}
+}
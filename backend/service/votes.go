@@ -0,0 +1,176 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"backend/store"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// Vote directions accepted by VoteService.Vote.
+const (
+	DirectionUp   = "up"
+	DirectionDown = "down"
+	DirectionNone = "none"
+)
+
+// idempotencyTTL is how long the outcome of a request with an idempotency
+// key is remembered.
+const idempotencyTTL = 24 * time.Hour
+
+// idempotencyPending marks an idempotency key whose request is still running.
+const idempotencyPending = "pending"
+
+var (
+	// ErrInvalidDirection is returned for a direction other than up, down or none.
+	ErrInvalidDirection = errors.New("direction must be up, down or none")
+	// ErrRequestInProgress is returned when a request with the same
+	// idempotency key has not finished yet.
+	ErrRequestInProgress = errors.New("a request with this idempotency key is in progress")
+	// ErrIdempotencyKeyReused is returned when an idempotency key is sent
+	// again with a different request.
+	ErrIdempotencyKeyReused = errors.New("idempotency key was used for a different request")
+)
+
+// Tally is the vote totals of a message.
+type Tally struct {
+	MessageID string `json:"message_id"`
+	Upvotes   int    `json:"upvotes"`
+	Downvotes int    `json:"downvotes"`
+}
+
+// VoteRequest is a vote by Username on a message. A request carrying an
+// IdempotencyKey is applied once; retries with the same key return the
+// original tally.
+type VoteRequest struct {
+	MessageID      string
+	Username       string
+	IdempotencyKey string
+}
+
+// idempotentResult is what is remembered under an idempotency key.
+type idempotentResult struct {
+	Request string `json:"request"`
+	Tally   Tally  `json:"tally"`
+}
+
+// VoteService applies votes on messages.
+type VoteService struct {
+	store store.Store
+	rdb   *redis.Client
+	// onVote runs after every applied vote, e.g. to broadcast the totals.
+	onVote func(ctx context.Context, voter string, t Tally, cast string)
+}
+
+// NewVoteService creates a VoteService that calls onVote with the voter and
+// the new totals after each vote is applied, and the vote type the voter
+// cast if they had not cast it before, or "".
+func NewVoteService(st store.Store, rdb *redis.Client, onVote func(ctx context.Context, voter string, t Tally, cast string)) *VoteService {
+	return &VoteService{store: st, rdb: rdb, onVote: onVote}
+}
+
+// Vote sets the user's vote on a message of one of their conversations to
+// direction, replacing any vote they cast before.
+func (v *VoteService) Vote(ctx context.Context, req VoteRequest, direction string) (Tally, error) {
+	var voteType string
+	switch direction {
+	case DirectionUp:
+		voteType = store.Upvote
+	case DirectionDown:
+		voteType = store.Downvote
+	case DirectionNone:
+	default:
+		return Tally{}, ErrInvalidDirection
+	}
+
+	return v.idempotent(ctx, req, "vote:"+direction, voteType, func() (int, int, bool, error) {
+		return v.store.SetVote(ctx, req.MessageID, req.Username, voteType)
+	})
+}
+
+// Toggle casts an upvote or downvote, withdrawing it if the user already
+// cast it.
+func (v *VoteService) Toggle(ctx context.Context, req VoteRequest, voteType string) (Tally, error) {
+	return v.idempotent(ctx, req, "toggle:"+voteType, voteType, func() (int, int, bool, error) {
+		return v.store.ToggleVote(ctx, req.MessageID, req.Username, voteType)
+	})
+}
+
+// idempotent applies a vote once per idempotency key. op identifies the
+// operation so a key cannot be replayed against a different request.
+func (v *VoteService) idempotent(ctx context.Context, req VoteRequest, op, voteType string, apply func() (int, int, bool, error)) (Tally, error) {
+	request := req.MessageID + ":" + op
+	if req.IdempotencyKey == "" {
+		return v.apply(ctx, req, voteType, apply)
+	}
+
+	key := fmt.Sprintf("idempotency:vote:%s:%s", req.Username, req.IdempotencyKey)
+	claimed, err := v.rdb.SetNX(ctx, key, idempotencyPending, time.Minute).Result()
+	if err != nil {
+		return Tally{}, err
+	}
+	if !claimed {
+		return v.replay(ctx, key, request)
+	}
+
+	t, err := v.apply(ctx, req, voteType, apply)
+	if err != nil {
+		v.rdb.Del(ctx, key)
+		return Tally{}, err
+	}
+
+	payload, err := json.Marshal(idempotentResult{Request: request, Tally: t})
+	if err == nil {
+		err = v.rdb.Set(ctx, key, payload, idempotencyTTL).Err()
+	}
+	if err != nil {
+		v.rdb.Del(ctx, key)
+	}
+	return t, nil
+}
+
+// replay returns the remembered outcome of the request that claimed key.
+func (v *VoteService) replay(ctx context.Context, key, request string) (Tally, error) {
+	payload, err := v.rdb.Get(ctx, key).Result()
+	if err != nil {
+		return Tally{}, err
+	}
+	if payload == idempotencyPending {
+		return Tally{}, ErrRequestInProgress
+	}
+
+	var result idempotentResult
+	if err := json.Unmarshal([]byte(payload), &result); err != nil {
+		return Tally{}, err
+	}
+	if result.Request != request {
+		return Tally{}, ErrIdempotencyKeyReused
+	}
+	return result.Tally, nil
+}
+
+// apply runs a vote operation casting voteType, if any, and reports the new
+// totals. Only the participants of a message's conversation may vote on it;
+// others get ErrNotParticipant.
+func (v *VoteService) apply(ctx context.Context, req VoteRequest, voteType string, apply func() (int, int, bool, error)) (Tally, error) {
+	if _, _, err := AuthorizeMessage(ctx, v.store, req.MessageID, req.Username); err != nil {
+		return Tally{}, err
+	}
+
+	upvotes, downvotes, cast, err := apply()
+	if err != nil {
+		return Tally{}, err
+	}
+
+	t := Tally{MessageID: req.MessageID, Upvotes: upvotes, Downvotes: downvotes}
+	if !cast {
+		voteType = ""
+	}
+	v.onVote(ctx, req.Username, t, voteType)
+	return t, nil
+}
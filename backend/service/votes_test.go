@@ -0,0 +1,131 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"backend/moderation"
+	"backend/store"
+)
+
+// voted records the calls of a VoteService's onVote.
+type voted struct {
+	voter string
+	tally Tally
+	cast  string
+}
+
+// newTestVotes returns a VoteService on a store where alice sent bob a
+// message, the ID of that message, and the votes it reports.
+func newTestVotes(t *testing.T) (*VoteService, string, *[]voted) {
+	t.Helper()
+	st := newTestStore(t, "alice", "bob", "carol")
+	messages, _ := newTestMessages(t, st, moderation.Off, Quotas{})
+	msg := store.Message{Sender: "alice", Receiver: "bob", Content: "hi"}
+	if err := messages.Send(context.Background(), &msg); err != nil {
+		t.Fatal(err)
+	}
+
+	var calls []voted
+	votes := NewVoteService(st, newTestRedis(t), func(ctx context.Context, voter string, t Tally, cast string) {
+		calls = append(calls, voted{voter, t, cast})
+	})
+	return votes, msg.ID, &calls
+}
+
+func TestVote(t *testing.T) {
+	ctx := context.Background()
+	votes, id, calls := newTestVotes(t)
+	req := VoteRequest{MessageID: id, Username: "bob"}
+
+	steps := []struct {
+		direction     string
+		up, down      int
+		cast          string
+		wantCallCount int
+	}{
+		{DirectionUp, 1, 0, store.Upvote, 1},
+		{DirectionUp, 1, 0, "", 2},
+		{DirectionDown, 0, 1, store.Downvote, 3},
+		{DirectionNone, 0, 0, "", 4},
+	}
+	for _, step := range steps {
+		tally, err := votes.Vote(ctx, req, step.direction)
+		if err != nil {
+			t.Fatalf("%s: %v", step.direction, err)
+		}
+		if tally.Upvotes != step.up || tally.Downvotes != step.down {
+			t.Errorf("%s: got %+v", step.direction, tally)
+		}
+		if len(*calls) != step.wantCallCount || (*calls)[len(*calls)-1].cast != step.cast {
+			t.Errorf("%s: onVote calls %+v", step.direction, *calls)
+		}
+	}
+
+	if _, err := votes.Vote(ctx, req, "sideways"); !errors.Is(err, ErrInvalidDirection) {
+		t.Errorf("got %v, want ErrInvalidDirection", err)
+	}
+}
+
+func TestToggle(t *testing.T) {
+	ctx := context.Background()
+	votes, id, _ := newTestVotes(t)
+	req := VoteRequest{MessageID: id, Username: "bob"}
+
+	for _, want := range []int{1, 0, 1} {
+		tally, err := votes.Toggle(ctx, req, store.Upvote)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if tally.Upvotes != want {
+			t.Errorf("got %d upvotes, want %d", tally.Upvotes, want)
+		}
+	}
+
+	tally, err := votes.Toggle(ctx, req, store.Downvote)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tally.Upvotes != 0 || tally.Downvotes != 1 {
+		t.Errorf("a downvote replacing an upvote: got %+v", tally)
+	}
+}
+
+func TestVoteNeedsParticipant(t *testing.T) {
+	ctx := context.Background()
+	votes, id, calls := newTestVotes(t)
+
+	if _, err := votes.Vote(ctx, VoteRequest{MessageID: id, Username: "carol"}, DirectionUp); !errors.Is(err, ErrNotParticipant) {
+		t.Errorf("got %v, want ErrNotParticipant", err)
+	}
+	if _, err := votes.Vote(ctx, VoteRequest{MessageID: "999", Username: "bob"}, DirectionUp); !errors.Is(err, store.ErrNotFound) {
+		t.Errorf("got %v, want ErrNotFound", err)
+	}
+	if len(*calls) != 0 {
+		t.Errorf("onVote calls %+v", *calls)
+	}
+}
+
+func TestVoteIdempotency(t *testing.T) {
+	ctx := context.Background()
+	votes, id, calls := newTestVotes(t)
+	req := VoteRequest{MessageID: id, Username: "bob", IdempotencyKey: "key"}
+
+	for i := 0; i < 2; i++ {
+		tally, err := votes.Toggle(ctx, req, store.Upvote)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if tally.Upvotes != 1 {
+			t.Errorf("attempt %d: got %+v", i+1, tally)
+		}
+	}
+	if len(*calls) != 1 {
+		t.Errorf("a retried vote was applied again: %+v", *calls)
+	}
+
+	if _, err := votes.Toggle(ctx, req, store.Downvote); !errors.Is(err, ErrIdempotencyKeyReused) {
+		t.Errorf("got %v, want ErrIdempotencyKeyReused", err)
+	}
+}
@@ -0,0 +1,221 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"backend/store"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// Webhook event types.
+const (
+	EventMessageCreated  = "message.created"
+	EventUserSignedUp    = "user.signed_up"
+	EventMessageReported = "message.reported"
+	EventCommandInvoked  = "command.invoked"
+)
+
+// WebhookEvents are the event types webhooks may subscribe to.
+var WebhookEvents = []string{EventMessageCreated, EventUserSignedUp, EventMessageReported, EventCommandInvoked}
+
+// Webhook delivery settings. Every instance polls for due deliveries, but
+// only the one holding the Redis lock attempts them. A failed delivery is
+// retried after webhookRetryDelay, doubling with every attempt, until
+// webhookMaxAttempts were made.
+const (
+	webhookInterval    = time.Second
+	webhookBatch       = 20
+	webhookTimeout     = 10 * time.Second
+	webhookLockKey     = "webhooks:lock"
+	webhookLockTTL     = 30 * time.Second
+	webhookMaxAttempts = 8
+	webhookRetryDelay  = 30 * time.Second
+	// webhookLease keeps claimed deliveries from being claimed again while
+	// a batch is attempted.
+	webhookLease = webhookBatch*webhookTimeout + time.Minute
+)
+
+// WebhookPayload is the JSON body POSTed to webhooks.
+type WebhookPayload struct {
+	// ID identifies the event; retries of a delivery carry the same ID.
+	ID        string      `json:"id"`
+	Type      string      `json:"type"`
+	CreatedAt time.Time   `json:"created_at"`
+	Data      interface{} `json:"data"`
+}
+
+// SignedUp is the data of a user.signed_up event.
+type SignedUp struct {
+	Username string `json:"username"`
+}
+
+// SignWebhook returns the signature of a delivery: the hex HMAC-SHA256,
+// keyed with the webhook's secret, of its timestamp, a dot and its body.
+func SignWebhook(secret string, timestamp int64, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	fmt.Fprintf(mac, "%d.", timestamp)
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// Webhooks queues events for the webhooks subscribed to them and delivers
+// them with retries.
+type Webhooks struct {
+	store  store.Store
+	lock   lock
+	client *http.Client
+}
+
+// NewWebhooks creates a Webhooks delivering events queued in st. token must
+// be unique to this instance.
+func NewWebhooks(st store.Store, rdb *redis.Client, token string) *Webhooks {
+	return &Webhooks{
+		store: st,
+		lock:  lock{rdb: rdb, key: webhookLockKey, token: token, ttl: webhookLockTTL},
+		client: &http.Client{
+			Timeout: webhookTimeout,
+			// A redirect would turn the POST into a GET, so it counts as a
+			// failure instead.
+			CheckRedirect: func(*http.Request, []*http.Request) error {
+				return http.ErrUseLastResponse
+			},
+		},
+	}
+}
+
+// CommandInvoked is the data of a command.invoked event.
+type CommandInvoked struct {
+	Command string `json:"command"`
+	Args    string `json:"args"`
+	// MessageID is the message that invoked the command, sent by User to
+	// the bot. Conversation is the user it was written to.
+	MessageID    string `json:"message_id"`
+	User         string `json:"user"`
+	Conversation string `json:"conversation"`
+}
+
+// Emit queues an event for every webhook subscribed to eventType that does
+// not belong to a bot. Failures are logged; they never fail the action that
+// caused the event.
+func (w *Webhooks) Emit(ctx context.Context, eventType string, data interface{}) {
+	w.EmitTo(ctx, eventType, "", data)
+}
+
+// EmitTo is Emit, also queueing the event for the webhooks of the bot named
+// recipient, if it is one.
+func (w *Webhooks) EmitTo(ctx context.Context, eventType, recipient string, data interface{}) {
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		log.Printf("Error generating %s event ID: %v", eventType, err)
+		return
+	}
+
+	body, err := json.Marshal(WebhookPayload{ID: hex.EncodeToString(id), Type: eventType, CreatedAt: time.Now().UTC(), Data: data})
+	if err != nil {
+		log.Printf("Error encoding %s event: %v", eventType, err)
+		return
+	}
+	if err := w.store.CreateDeliveries(ctx, eventType, recipient, string(body)); err != nil {
+		log.Printf("Error queueing %s event: %v", eventType, err)
+	}
+}
+
+// Run delivers due events until ctx is done.
+func (w *Webhooks) Run(ctx context.Context) {
+	ticker := time.NewTicker(webhookInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			w.lock.do(ctx, func() { w.deliverDue(ctx) })
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// deliverDue attempts every due delivery.
+func (w *Webhooks) deliverDue(ctx context.Context) {
+	for {
+		due, err := w.store.ClaimDueDeliveries(ctx, time.Now(), webhookLease, webhookBatch)
+		if err != nil {
+			log.Printf("Error claiming webhook deliveries: %v", err)
+			return
+		}
+
+		for _, d := range due {
+			w.deliver(ctx, d)
+		}
+		if len(due) < webhookBatch || ctx.Err() != nil {
+			return
+		}
+	}
+}
+
+// deliver attempts a claimed delivery and records the outcome, scheduling a
+// retry if it failed and attempts remain.
+func (w *Webhooks) deliver(ctx context.Context, d store.WebhookDelivery) {
+	status, err := w.post(ctx, d)
+
+	attempt := store.DeliveryAttempt{Status: store.DeliverySucceeded}
+	if status != 0 {
+		attempt.ResponseStatus = &status
+	}
+	if err != nil {
+		attempt.Error = store.Truncate(err.Error(), 500)
+		attempt.Status = store.DeliveryFailed
+		if attempts := d.Attempts + 1; attempts < webhookMaxAttempts {
+			attempt.Status = store.DeliveryPending
+			attempt.NextAttemptAt = time.Now().Add(webhookRetryDelay << (attempts - 1))
+		}
+	}
+
+	// Record the outcome even if ctx was canceled meanwhile.
+	if err := w.store.RecordDeliveryAttempt(context.Background(), d.ID, attempt); err != nil {
+		log.Printf("Error recording webhook delivery %s: %v", d.ID, err)
+	}
+}
+
+// post POSTs a delivery's payload to its webhook, returning the response
+// status if there was a response. Statuses other than 2xx are errors.
+func (w *Webhooks) post(ctx context.Context, d store.WebhookDelivery) (int, error) {
+	body := []byte(d.Payload)
+	timestamp := time.Now().Unix()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, d.URL, bytes.NewReader(body))
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "chat-webhooks/1")
+	req.Header.Set("X-Webhook-Event", d.EventType)
+	req.Header.Set("X-Webhook-Delivery", d.ID)
+	req.Header.Set("X-Webhook-Timestamp", strconv.FormatInt(timestamp, 10))
+	req.Header.Set("X-Webhook-Signature", "sha256="+SignWebhook(d.Secret, timestamp, body))
+
+	resp, err := w.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return resp.StatusCode, fmt.Errorf("unexpected status %s", resp.Status)
+	}
+	return resp.StatusCode, nil
+}
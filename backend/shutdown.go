@@ -0,0 +1,75 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net"
+	"net/http"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"backend/api"
+
+	"google.golang.org/grpc"
+)
+
+// serveUntilSignal runs srv, and grpcSrv on grpcListener unless it is nil,
+// until SIGINT or SIGTERM, then drains them: new requests are refused,
+// WebSocket clients get a close frame and chat streams end.
+func serveUntilSignal(srv *http.Server, grpcSrv *grpc.Server, grpcListener net.Listener, server *api.Server, drainTimeout time.Duration) {
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	// Event streams only end once their clients are disconnected.
+	srv.RegisterOnShutdown(server.CloseStreams)
+
+	go func() {
+		if err := srv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Fatalf("HTTP server error: %v", err)
+		}
+	}()
+	if grpcSrv != nil {
+		go func() {
+			if err := grpcSrv.Serve(grpcListener); err != nil {
+				log.Fatalf("gRPC server error: %v", err)
+			}
+		}()
+	}
+
+	<-ctx.Done()
+	log.Printf("Shutting down, draining connections for up to %s", drainTimeout)
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), drainTimeout)
+	defer cancel()
+
+	if err := srv.Shutdown(shutdownCtx); err != nil {
+		log.Printf("Error shutting down HTTP server: %v", err)
+	}
+
+	if err := server.Drain(shutdownCtx); err != nil {
+		log.Printf("Timed out waiting for WebSocket clients to disconnect")
+	}
+
+	if grpcSrv != nil {
+		stopGRPC(shutdownCtx, grpcSrv)
+	}
+}
+
+// stopGRPC lets in-flight gRPC calls finish, cancelling whatever is left
+// when ctx is done.
+func stopGRPC(ctx context.Context, grpcSrv *grpc.Server) {
+	stopped := make(chan struct{})
+	go func() {
+		grpcSrv.GracefulStop()
+		close(stopped)
+	}()
+
+	select {
+	case <-stopped:
+	case <-ctx.Done():
+		log.Printf("Timed out waiting for gRPC calls to finish")
+		grpcSrv.Stop()
+	}
+}
@@ -0,0 +1,212 @@
+package memory
+
+import (
+	"context"
+	"slices"
+	"sort"
+	"time"
+
+	"backend/store"
+	"backend/usernames"
+)
+
+func (s *Store) RequestDeletion(ctx context.Context, username string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	u, ok := s.users[username]
+	if !ok || u.deleted() {
+		return store.ErrNotFound
+	}
+
+	// Clearing the password and email stops logins and password resets
+	// right away; the rest is erased by EraseUser.
+	t := now()
+	u.deletionRequestedAt = &t
+	u.password, u.email, u.emailVerifiedAt = store.Password{}, "", nil
+	s.revokeSessions(username)
+	return nil
+}
+
+func (s *Store) PendingDeletions(ctx context.Context, limit int) ([]string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var pending []*user
+	for _, u := range s.users {
+		if u.deleted() && u.erasedAt == nil {
+			pending = append(pending, u)
+		}
+	}
+	sort.Slice(pending, func(i, j int) bool { return pending[i].deletionRequestedAt.Before(*pending[j].deletionRequestedAt) })
+
+	usernames := []string{}
+	for _, u := range page(pending, 0, limit) {
+		usernames = append(usernames, u.username)
+	}
+	return usernames, nil
+}
+
+func (s *Store) EraseUser(ctx context.Context, username, tombstone string) ([]string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	u, ok := s.users[username]
+	if !ok || !u.deleted() || u.erasedAt != nil {
+		return nil, store.ErrNotFound
+	}
+
+	// Delete the user's attachments, with their variants, and the files
+	// they uploaded but did not send yet.
+	var keys []string
+	attachments := s.attachments[:0]
+	for _, a := range s.attachments {
+		if a.uploader != username {
+			attachments = append(attachments, a)
+			continue
+		}
+		keys = append(keys, a.keys()...)
+		if m := s.byID[a.messageID]; m != nil {
+			m.attachments = removeAttachment(m.attachments, a)
+		}
+	}
+	clear(s.attachments[len(attachments):])
+	s.attachments = attachments
+	for id, up := range s.uploads {
+		if up.Uploader == username {
+			keys = append(keys, id)
+			delete(s.uploads, id)
+		}
+	}
+
+	// Messages the user sent are erased for both participants, archived
+	// ones included, and the messages they voted on are recounted without
+	// their votes.
+	t := now()
+	for _, m := range slices.Concat(s.messages, s.archived) {
+		if m.sender == username {
+			m.content, m.system = "", nil
+			if m.deletedAt == nil {
+				m.deletedAt = &t
+			}
+			m.updatedAt = t
+		}
+		if _, ok := m.votes[username]; ok {
+			delete(m.votes, username)
+			s.recount(m)
+		}
+		delete(m.deletedFor, username)
+		delete(m.mentions, username)
+	}
+
+	s.eraseSettings(username)
+
+	// What remains, such as messages the user received, is kept for the
+	// other participants under a name that no longer identifies anyone.
+	s.renameAll(username, tombstone)
+	delete(s.users, username)
+	u.username, u.normalized, u.lastSeen, u.erasedAt = tombstone, usernames.Normalize(tombstone), nil, &t
+	s.users[tombstone] = u
+	return keys, nil
+}
+
+// removeAttachment returns attachments without a.
+func removeAttachment(attachments []*attachment, a *attachment) []*attachment {
+	kept := attachments[:0]
+	for _, other := range attachments {
+		if other != a {
+			kept = append(kept, other)
+		}
+	}
+	return kept
+}
+
+// eraseSettings deletes the user's own settings, credentials and the copies
+// of content they wrote, like erasedTables in store/postgres.
+func (s *Store) eraseSettings(username string) {
+	involves := func(p pair) bool { return p.a == username || p.b == username }
+
+	for hash, sess := range s.sessions {
+		if sess.username == username {
+			delete(s.sessions, hash)
+		}
+	}
+	s.deleteDevices(func(d *device) bool { return d.username == username })
+	userKeys := s.userKeys[:0]
+	for _, k := range s.userKeys {
+		if k.Username != username {
+			userKeys = append(userKeys, k)
+		}
+	}
+	s.userKeys = userKeys
+	s.deleteShadowMutes(func(m *store.ShadowMute) bool { return m.Username == username })
+	delete(s.prefs, username)
+	for p := range s.filters {
+		if involves(p) {
+			delete(s.filters, p)
+		}
+	}
+	for p := range s.mutes {
+		if involves(p) {
+			delete(s.mutes, p)
+		}
+	}
+	delete(s.statuses, username)
+	for p := range s.ttls {
+		if involves(p) {
+			delete(s.ttls, p)
+		}
+	}
+	for p := range s.blocks {
+		if involves(p) {
+			delete(s.blocks, p)
+		}
+	}
+	s.deleteScheduled(func(sm *store.ScheduledMessage) bool { return sm.Sender == username || sm.Receiver == username })
+	flags := s.flags[:0]
+	for _, f := range s.flags {
+		if f.Sender != username {
+			flags = append(flags, f)
+		}
+	}
+	s.flags = flags
+	delete(s.bots, username)
+	for name, cmd := range s.commands {
+		if cmd.Bot == username {
+			delete(s.commands, name)
+		}
+	}
+	s.deleteWebhooks(func(w *store.Webhook) bool { return w.Bot == username })
+	s.deleteIncomingHooks(func(h *incomingHook) bool { return h.Bot == username || h.Receiver == username })
+	for _, ch := range s.channels {
+		delete(ch.senders, username)
+		ch.unsubscribe(username)
+	}
+	s.deletePosts(func(p store.ChannelPost) bool { return p.Sender == username })
+	s.deleteInvites(func(inv *channelInvite) bool { return inv.CreatedBy == username })
+	for key := range s.threadSubs {
+		if key.a == username {
+			delete(s.threadSubs, key)
+		}
+	}
+}
+
+func (s *Store) Usage(ctx context.Context, username string, window time.Duration) (store.Usage, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var u store.Usage
+	since := time.Now().Add(-window.Truncate(time.Second))
+	for _, m := range s.messages {
+		if m.sender == username && m.kind == store.KindUser && m.createdAt.After(since) {
+			u.Messages++
+		}
+	}
+	for _, a := range s.attachments {
+		if a.uploader == username {
+			u.Attachments++
+			u.StorageBytes += a.size
+		}
+	}
+	return u, nil
+}
@@ -0,0 +1,67 @@
+package memory
+
+import (
+	"context"
+	"time"
+
+	"backend/store"
+)
+
+func (s *Store) Users(ctx context.Context) ([]store.User, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	users := []store.User{}
+	for _, username := range sortedKeys(s.users) {
+		u := s.users[username]
+		if u.deleted() {
+			continue
+		}
+		users = append(users, store.User{Username: u.username, Role: u.role, Banned: u.bannedAt != nil, LastSeen: u.lastSeen})
+	}
+	return users, nil
+}
+
+func (s *Store) SetBanned(ctx context.Context, username string, banned bool) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	u, ok := s.users[username]
+	if !ok {
+		return store.ErrNotFound
+	}
+	if !banned {
+		u.bannedAt = nil
+		return nil
+	}
+	if u.bannedAt == nil {
+		t := now()
+		u.bannedAt = &t
+	}
+	s.revokeSessions(username)
+	return nil
+}
+
+func (s *Store) Stats(ctx context.Context) (store.Stats, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var st store.Stats
+	for _, u := range s.users {
+		if u.deleted() {
+			continue
+		}
+		st.Users++
+		if u.bannedAt != nil {
+			st.BannedUsers++
+		}
+	}
+	dayAgo := time.Now().Add(-24 * time.Hour)
+	st.Messages = len(s.messages)
+	for _, m := range s.messages {
+		if m.createdAt.After(dayAgo) {
+			st.MessagesLastDay++
+		}
+	}
+	return st, nil
+}
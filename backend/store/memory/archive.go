@@ -0,0 +1,46 @@
+package memory
+
+import (
+	"context"
+	"strconv"
+
+	"backend/store"
+)
+
+func (s *Store) ArchivedMessages(ctx context.Context, viewer, other, before string, limit int) ([]store.Message, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	cursor := -1
+	if before != "" {
+		id, err := strconv.Atoi(before)
+		if err != nil {
+			return nil, store.ErrNotFound
+		}
+		for _, m := range s.archived {
+			if m.id == id {
+				cursor = id
+				break
+			}
+		}
+		if cursor < 0 {
+			return nil, store.ErrNotFound
+		}
+	}
+
+	// Messages are archived a month at a time, oldest first, so archived is
+	// in the order they were sent.
+	var ms []*message
+	for _, m := range s.archived {
+		if cursor >= 0 && m.id >= cursor {
+			break
+		}
+		if m.between(viewer, other) && !m.deletedFor[viewer] {
+			ms = append(ms, m)
+		}
+	}
+	if len(ms) > limit {
+		ms = ms[len(ms)-limit:]
+	}
+	return s.views(ms, true), nil
+}
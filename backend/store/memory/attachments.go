@@ -0,0 +1,242 @@
+package memory
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+	"time"
+
+	"backend/store"
+)
+
+// attachment is a file attached to a message and the variants rendered
+// from it.
+type attachment struct {
+	id           string
+	messageID    int
+	uploader     string
+	filename     string
+	contentType  string
+	size         int64
+	key          string
+	mediaStatus  string
+	width        int
+	height       int
+	claimedUntil time.Time
+	variants     []store.AttachmentVariant
+}
+
+// attachmentURL is where clients download an attachment.
+func attachmentURL(id string) string {
+	return fmt.Sprintf("/attachments/%s", id)
+}
+
+// public returns a as the API sees it.
+func (a *attachment) public() store.Attachment {
+	pub := store.Attachment{
+		ID:          a.id,
+		Filename:    a.filename,
+		ContentType: a.contentType,
+		Size:        a.size,
+		URL:         attachmentURL(a.id),
+		MediaStatus: a.mediaStatus,
+		Width:       a.width,
+		Height:      a.height,
+	}
+	if a.variant(store.VariantThumbnail) != nil {
+		pub.ThumbnailURL = pub.URL + "/thumbnail"
+	}
+	return pub
+}
+
+// variant returns the variant of a named name, or nil if it has none.
+func (a *attachment) variant(name string) *store.AttachmentVariant {
+	for i := range a.variants {
+		if a.variants[i].Name == name {
+			return &a.variants[i]
+		}
+	}
+	return nil
+}
+
+// keys returns the blob keys of a's file and of its variants.
+func (a *attachment) keys() []string {
+	keys := []string{a.key}
+	for _, v := range a.variants {
+		keys = append(keys, v.Key)
+	}
+	return keys
+}
+
+// findAttachment returns the attachment with id, or nil if there is none.
+func (s *Store) findAttachment(id string) *attachment {
+	for _, a := range s.attachments {
+		if a.id == id {
+			return a
+		}
+	}
+	return nil
+}
+
+// visibleAttachment returns the attachment with id if its message was not
+// deleted and viewer sent or received it, or nil.
+func (s *Store) visibleAttachment(id, viewer string) *attachment {
+	a := s.findAttachment(id)
+	if a == nil {
+		return nil
+	}
+	m := s.byID[a.messageID]
+	if m == nil || m.deletedAt != nil || !m.involves(viewer) {
+		return nil
+	}
+	return a
+}
+
+func (s *Store) CreateAttachmentMessage(ctx context.Context, msg *store.Message, a store.Attachment, storageKey string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if !s.validReply(msg) {
+		return store.ErrInvalidReplyTo
+	}
+	m := s.insert(msg)
+
+	stored := &attachment{
+		id:          s.nextID("attachments"),
+		messageID:   m.id,
+		uploader:    msg.Sender,
+		filename:    a.Filename,
+		contentType: a.ContentType,
+		size:        a.Size,
+		key:         storageKey,
+		mediaStatus: a.MediaStatus,
+	}
+	s.attachments = append(s.attachments, stored)
+	m.attachments = append(m.attachments, stored)
+
+	a.ID = stored.id
+	a.URL = attachmentURL(a.ID)
+	msg.Attachments = []store.Attachment{a}
+	return nil
+}
+
+func (s *Store) AttachmentFile(ctx context.Context, id, viewer string) (store.Attachment, string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	a := s.visibleAttachment(id, viewer)
+	if a == nil {
+		return store.Attachment{ID: id, URL: attachmentURL(id)}, "", store.ErrNotFound
+	}
+	return store.Attachment{ID: id, URL: attachmentURL(id), Filename: a.filename, ContentType: a.contentType, Size: a.size}, a.key, nil
+}
+
+func (s *Store) AttachmentVariant(ctx context.Context, id, name, viewer string) (store.AttachmentVariant, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	a := s.visibleAttachment(id, viewer)
+	if a == nil {
+		return store.AttachmentVariant{Name: name}, store.ErrNotFound
+	}
+	v := a.variant(name)
+	if v == nil {
+		return store.AttachmentVariant{Name: name}, store.ErrNotFound
+	}
+	return *v, nil
+}
+
+func (s *Store) ClaimPendingMedia(ctx context.Context, lease time.Duration, limit int) ([]store.PendingMedia, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	t := time.Now()
+	var pending []store.PendingMedia
+	for _, a := range s.attachments {
+		if len(pending) == limit {
+			break
+		}
+		if a.mediaStatus != store.MediaPending || a.claimedUntil.After(t) {
+			continue
+		}
+		a.claimedUntil = t.Add(lease)
+		pending = append(pending, store.PendingMedia{
+			AttachmentID: a.id,
+			MessageID:    strconv.Itoa(a.messageID),
+			ContentType:  a.contentType,
+			Key:          a.key,
+		})
+	}
+	return pending, nil
+}
+
+func (s *Store) CompleteMedia(ctx context.Context, attachmentID string, width, height int, variants []store.AttachmentVariant) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	a := s.findAttachment(attachmentID)
+	if a == nil {
+		return store.ErrNotFound
+	}
+	a.mediaStatus = store.MediaReady
+	a.width, a.height = width, height
+	a.claimedUntil = time.Time{}
+	a.variants = append(a.variants, variants...)
+	return nil
+}
+
+func (s *Store) FailMedia(ctx context.Context, attachmentID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if a := s.findAttachment(attachmentID); a != nil {
+		a.mediaStatus = store.MediaFailed
+		a.claimedUntil = time.Time{}
+	}
+	return nil
+}
+
+func (s *Store) CreateUpload(ctx context.Context, u store.Upload) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.uploads[u.ID]; ok {
+		return fmt.Errorf("upload %s already exists", u.ID)
+	}
+	s.uploads[u.ID] = u
+	return nil
+}
+
+func (s *Store) TakeUpload(ctx context.Context, id, uploader string) (store.Upload, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	u, ok := s.uploads[id]
+	if !ok || u.Uploader != uploader || !u.ExpiresAt.After(time.Now()) {
+		return store.Upload{ID: id, Uploader: uploader}, store.ErrNotFound
+	}
+	delete(s.uploads, id)
+	return u, nil
+}
+
+func (s *Store) DeleteExpiredUploads(ctx context.Context, limit int) ([]string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	t := time.Now()
+	var expired []store.Upload
+	for _, u := range s.uploads {
+		if !u.ExpiresAt.After(t) {
+			expired = append(expired, u)
+		}
+	}
+	sort.Slice(expired, func(i, j int) bool { return expired[i].ExpiresAt.Before(expired[j].ExpiresAt) })
+
+	var keys []string
+	for _, u := range page(expired, 0, limit) {
+		delete(s.uploads, u.ID)
+		keys = append(keys, u.ID)
+	}
+	return keys, nil
+}
@@ -0,0 +1,48 @@
+package memory
+
+import (
+	"context"
+	"maps"
+	"strconv"
+
+	"backend/store"
+)
+
+func (s *Store) RecordAudit(ctx context.Context, e *store.AuditEntry) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	e.ID = s.nextID("audit_log")
+	e.CreatedAt = now()
+	stored := *e
+	stored.Details = maps.Clone(e.Details)
+	if len(stored.Details) == 0 {
+		stored.Details = nil
+	}
+	s.audit = append(s.audit, stored)
+	return nil
+}
+
+func (s *Store) AuditLog(ctx context.Context, f store.AuditFilter) ([]store.AuditEntry, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// Empty filters match every entry.
+	entries := []store.AuditEntry{}
+	for i := len(s.audit) - 1; i >= 0 && len(entries) < f.Limit; i-- {
+		e := s.audit[i]
+		id, _ := strconv.ParseInt(e.ID, 10, 64)
+		switch {
+		case f.Actor != "" && e.Actor != f.Actor,
+			f.Action != "" && e.Action != f.Action,
+			f.Target != "" && e.Target != f.Target,
+			!f.Since.IsZero() && e.CreatedAt.Before(f.Since),
+			!f.Until.IsZero() && !e.CreatedAt.Before(f.Until),
+			f.BeforeID != 0 && id >= f.BeforeID:
+			continue
+		}
+		e.Details = maps.Clone(e.Details)
+		entries = append(entries, e)
+	}
+	return entries, nil
+}
@@ -0,0 +1,35 @@
+package memory
+
+import "context"
+
+// blocked reports whether either user has blocked the other.
+func (s *Store) blocked(a, b string) bool {
+	return s.blocks[pair{a, b}] || s.blocks[pair{b, a}]
+}
+
+func (s *Store) IsBlocked(ctx context.Context, a, b string) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.blocked(a, b), nil
+}
+
+func (s *Store) Block(ctx context.Context, blocker, blocked string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.blocks[pair{blocker, blocked}] = true
+	return nil
+}
+
+func (s *Store) Unblock(ctx context.Context, blocker, blocked string) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	p := pair{blocker, blocked}
+	if !s.blocks[p] {
+		return false, nil
+	}
+	delete(s.blocks, p)
+	return true, nil
+}
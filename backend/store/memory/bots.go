@@ -0,0 +1,194 @@
+package memory
+
+import (
+	"context"
+
+	"backend/store"
+	"backend/usernames"
+)
+
+// bot is a bot account and the hash of its token.
+type bot struct {
+	store.Bot
+	tokenHash string
+}
+
+// incomingHook is an incoming hook and the hash of its token.
+type incomingHook struct {
+	store.IncomingHook
+	tokenHash string
+}
+
+// public returns h as the API sees it.
+func (h *incomingHook) public() store.IncomingHook {
+	pub := h.IncomingHook
+	if h.LastUsedAt != nil {
+		t := *h.LastUsedAt
+		pub.LastUsedAt = &t
+	}
+	return pub
+}
+
+func (s *Store) CreateBot(ctx context.Context, b *store.Bot, password store.Password, tokenHash string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.usernameTaken(b.Username, "") {
+		return store.ErrUsernameTaken
+	}
+	s.users[b.Username] = &user{username: b.Username, normalized: usernames.Normalize(b.Username), password: password, role: store.RoleBot}
+	b.CreatedAt = now()
+	s.bots[b.Username] = &bot{Bot: *b, tokenHash: tokenHash}
+	return nil
+}
+
+func (s *Store) Bots(ctx context.Context) ([]store.Bot, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	bots := []store.Bot{}
+	for _, username := range sortedKeys(s.bots) {
+		if u, ok := s.users[username]; ok && !u.deleted() {
+			bots = append(bots, s.bots[username].Bot)
+		}
+	}
+	return bots, nil
+}
+
+func (s *Store) SetBotToken(ctx context.Context, username, tokenHash string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	b, ok := s.bots[username]
+	if !ok {
+		return store.ErrNotFound
+	}
+	b.tokenHash = tokenHash
+	return nil
+}
+
+func (s *Store) BotByToken(ctx context.Context, tokenHash string) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, b := range s.bots {
+		if b.tokenHash == tokenHash {
+			return b.Username, nil
+		}
+	}
+	return "", store.ErrNotFound
+}
+
+func (s *Store) RegisterCommand(ctx context.Context, cmd *store.Command) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	existing, ok := s.commands[cmd.Name]
+	switch {
+	case !ok:
+		cmd.CreatedAt = now()
+		stored := *cmd
+		s.commands[cmd.Name] = &stored
+	case existing.Bot != cmd.Bot:
+		return store.ErrCommandTaken
+	default:
+		existing.Description = cmd.Description
+		cmd.CreatedAt = existing.CreatedAt
+	}
+	return nil
+}
+
+func (s *Store) Commands(ctx context.Context) ([]store.Command, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	commands := []store.Command{}
+	for _, name := range sortedKeys(s.commands) {
+		commands = append(commands, *s.commands[name])
+	}
+	return commands, nil
+}
+
+func (s *Store) DeleteCommand(ctx context.Context, bot, name string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	cmd, ok := s.commands[name]
+	if !ok || cmd.Bot != bot {
+		return store.ErrNotFound
+	}
+	delete(s.commands, name)
+	return nil
+}
+
+func (s *Store) CommandBot(ctx context.Context, name string) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	cmd, ok := s.commands[name]
+	if !ok {
+		return "", store.ErrNotFound
+	}
+	return cmd.Bot, nil
+}
+
+func (s *Store) CreateIncomingHook(ctx context.Context, hook *store.IncomingHook, tokenHash string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	hook.ID = s.nextID("incoming_hooks")
+	hook.CreatedAt = now()
+	hook.LastUsedAt = nil
+	s.hooks = append(s.hooks, &incomingHook{IncomingHook: *hook, tokenHash: tokenHash})
+	return nil
+}
+
+func (s *Store) IncomingHooks(ctx context.Context) ([]store.IncomingHook, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	hooks := []store.IncomingHook{}
+	for _, h := range s.hooks {
+		hooks = append(hooks, h.public())
+	}
+	return hooks, nil
+}
+
+func (s *Store) DeleteIncomingHook(ctx context.Context, id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if !s.deleteIncomingHooks(func(h *incomingHook) bool { return h.ID == id }) {
+		return store.ErrNotFound
+	}
+	return nil
+}
+
+// deleteIncomingHooks deletes the hooks matching match, reporting whether
+// there were any.
+func (s *Store) deleteIncomingHooks(match func(*incomingHook) bool) bool {
+	kept := s.hooks[:0]
+	for _, h := range s.hooks {
+		if !match(h) {
+			kept = append(kept, h)
+		}
+	}
+	deleted := len(kept) < len(s.hooks)
+	clear(s.hooks[len(kept):])
+	s.hooks = kept
+	return deleted
+}
+
+func (s *Store) UseIncomingHook(ctx context.Context, tokenHash string) (store.IncomingHook, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, h := range s.hooks {
+		if h.tokenHash == tokenHash {
+			t := now()
+			h.LastUsedAt = &t
+			return h.public(), nil
+		}
+	}
+	return store.IncomingHook{}, store.ErrNotFound
+}
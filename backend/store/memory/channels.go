@@ -0,0 +1,611 @@
+package memory
+
+import (
+	"context"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"backend/store"
+)
+
+// channel is a broadcast channel with its senders and subscribers. Of the
+// embedded Channel, only the fields stored in channels are set.
+type channel struct {
+	store.Channel
+	senders map[string]bool
+	// subscribers maps the subscribers to their roles.
+	subscribers map[string]string
+	// subscribedAt maps the subscribers to when they subscribed.
+	subscribedAt map[string]time.Time
+}
+
+// public returns ch as viewer sees it.
+func (ch *channel) public(viewer string) store.Channel {
+	pub := ch.Channel
+	pub.Senders = sortedKeys(ch.senders)
+	pub.Subscribers = len(ch.subscribers)
+	pub.Role = ch.subscribers[viewer]
+	pub.Subscribed = pub.Role != ""
+	return pub
+}
+
+// subscribe subscribes username with role, keeping the role of a
+// subscriber.
+func (ch *channel) subscribe(username, role string) {
+	if ch.subscribers[username] == "" {
+		ch.subscribers[username] = role
+		ch.subscribedAt[username] = now()
+	}
+}
+
+// unsubscribe reports whether username was subscribed.
+func (ch *channel) unsubscribe(username string) bool {
+	if ch.subscribers[username] == "" {
+		return false
+	}
+	delete(ch.subscribers, username)
+	delete(ch.subscribedAt, username)
+	return true
+}
+
+// findChannel returns the channel with id, or nil if there is none.
+func (s *Store) findChannel(id string) *channel {
+	for _, ch := range s.channels {
+		if ch.ID == id {
+			return ch
+		}
+	}
+	return nil
+}
+
+func (s *Store) CreateChannel(ctx context.Context, ch *store.Channel) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, existing := range s.channels {
+		if existing.Name == ch.Name {
+			return store.ErrChannelTaken
+		}
+	}
+
+	ch.ID = s.nextID("channels")
+	ch.CreatedAt = now()
+	stored := &channel{
+		Channel: store.Channel{ID: ch.ID, Name: ch.Name, Description: ch.Description, Topic: ch.Topic,
+			Visibility: ch.Visibility, CreatedBy: ch.CreatedBy, CreatedAt: ch.CreatedAt},
+		senders:      map[string]bool{},
+		subscribers:  map[string]string{},
+		subscribedAt: map[string]time.Time{},
+	}
+	for _, username := range ch.Senders {
+		stored.senders[username] = true
+	}
+	stored.subscribe(ch.CreatedBy, store.ChannelRoleOwner)
+	s.channels = append(s.channels, stored)
+	return nil
+}
+
+func (s *Store) Channels(ctx context.Context, viewer, search string) ([]store.Channel, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	search = strings.ToLower(search)
+	channels := []store.Channel{}
+	for _, ch := range s.channels {
+		if ch.Visibility != store.ChannelPublic && ch.subscribers[viewer] == "" {
+			continue
+		}
+		if !strings.Contains(strings.ToLower(ch.Name+" "+ch.Topic+" "+ch.Description), search) {
+			continue
+		}
+		channels = append(channels, ch.public(viewer))
+	}
+	sort.Slice(channels, func(i, j int) bool { return channels[i].Name < channels[j].Name })
+	return channels, nil
+}
+
+func (s *Store) Channel(ctx context.Context, id, viewer string) (store.Channel, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	ch := s.findChannel(id)
+	if ch == nil {
+		return store.Channel{}, store.ErrNotFound
+	}
+	return ch.public(viewer), nil
+}
+
+func (s *Store) UpdateChannel(ctx context.Context, id string, update store.ChannelUpdate) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	ch := s.findChannel(id)
+	if ch == nil {
+		return store.ErrNotFound
+	}
+	if update.Name != nil {
+		for _, other := range s.channels {
+			if other != ch && other.Name == *update.Name {
+				return store.ErrChannelTaken
+			}
+		}
+		ch.Name = *update.Name
+	}
+	if update.Description != nil {
+		ch.Description = *update.Description
+	}
+	if update.Topic != nil {
+		ch.Topic = *update.Topic
+	}
+	if update.Visibility != nil {
+		ch.Visibility = *update.Visibility
+	}
+	return nil
+}
+
+func (s *Store) DeleteChannel(ctx context.Context, id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	ch := s.findChannel(id)
+	if ch == nil {
+		return store.ErrNotFound
+	}
+
+	kept := s.channels[:0]
+	for _, other := range s.channels {
+		if other != ch {
+			kept = append(kept, other)
+		}
+	}
+	clear(s.channels[len(kept):])
+	s.channels = kept
+
+	s.deletePosts(func(p store.ChannelPost) bool { return p.ChannelID == id })
+	s.deleteInvites(func(inv *channelInvite) bool { return inv.ChannelID == id })
+	s.deleteShadowMutes(func(m *store.ShadowMute) bool { return m.ChannelID == id })
+	return nil
+}
+
+// deletePosts deletes the channel posts matching match, with their replies
+// and the subscriptions to their threads.
+func (s *Store) deletePosts(match func(store.ChannelPost) bool) {
+	deleted := map[string]bool{}
+	kept := s.posts[:0]
+	for _, p := range s.posts {
+		// Replies come after their parents.
+		if match(p) || deleted[parentOf(p)] {
+			deleted[p.ID] = true
+			continue
+		}
+		kept = append(kept, p)
+	}
+	s.posts = kept
+
+	for key := range s.threadSubs {
+		if deleted[key.b] {
+			delete(s.threadSubs, key)
+		}
+	}
+}
+
+func (s *Store) AddChannelSender(ctx context.Context, id, username string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	ch := s.findChannel(id)
+	if ch == nil {
+		return store.ErrNotFound
+	}
+	ch.senders[username] = true
+	return nil
+}
+
+func (s *Store) RemoveChannelSender(ctx context.Context, id, username string) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	ch := s.findChannel(id)
+	if ch == nil || !ch.senders[username] {
+		return false, nil
+	}
+	delete(ch.senders, username)
+	return true, nil
+}
+
+func (s *Store) IsChannelSender(ctx context.Context, id, username string) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	ch := s.findChannel(id)
+	return ch != nil && ch.senders[username], nil
+}
+
+func (s *Store) SubscribeChannel(ctx context.Context, id, username string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	ch := s.findChannel(id)
+	if ch == nil {
+		return store.ErrNotFound
+	}
+	ch.subscribe(username, store.ChannelRoleMember)
+	return nil
+}
+
+func (s *Store) UnsubscribeChannel(ctx context.Context, id, username string) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	ch := s.findChannel(id)
+	if ch == nil {
+		return false, nil
+	}
+	return ch.unsubscribe(username), nil
+}
+
+func (s *Store) ChannelRole(ctx context.Context, id, username string) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	ch := s.findChannel(id)
+	if ch == nil {
+		return "", store.ErrNotFound
+	}
+	return ch.subscribers[username], nil
+}
+
+func (s *Store) SetChannelRole(ctx context.Context, id, username, role string) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	ch := s.findChannel(id)
+	if ch == nil || ch.subscribers[username] == "" {
+		return false, nil
+	}
+	ch.subscribers[username] = role
+	return true, nil
+}
+
+func (s *Store) ChannelMembers(ctx context.Context, id string) ([]store.ChannelMember, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	members := []store.ChannelMember{}
+	if ch := s.findChannel(id); ch != nil {
+		for _, username := range sortedKeys(ch.subscribers) {
+			members = append(members, store.ChannelMember{Username: username, Role: ch.subscribers[username], SubscribedAt: ch.subscribedAt[username]})
+		}
+	}
+	return members, nil
+}
+
+func (s *Store) ChannelSubscribersAmong(ctx context.Context, id string, usernames []string) ([]string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	ch := s.findChannel(id)
+	if ch == nil {
+		return nil, nil
+	}
+	var subscribers []string
+	for _, username := range usernames {
+		if ch.subscribers[username] != "" {
+			subscribers = append(subscribers, username)
+		}
+	}
+	return subscribers, nil
+}
+
+func (s *Store) CreateChannelPost(ctx context.Context, post *store.ChannelPost) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.findChannel(post.ChannelID) == nil {
+		return store.ErrNotFound
+	}
+	post.ID = s.nextID("channel_posts")
+	post.CreatedAt = now()
+	s.posts = append(s.posts, *post)
+
+	if post.ParentID != nil {
+		// The replier follows the thread again even if they left it; the
+		// sender of the parent only if they never did.
+		s.subscribeThread(*post.ParentID, post.Sender, true)
+		if i := s.findPost(post.ChannelID, *post.ParentID); i >= 0 {
+			if _, ok := s.threadSubs[pair{s.posts[i].Sender, *post.ParentID}]; !ok {
+				s.subscribeThread(*post.ParentID, s.posts[i].Sender, true)
+			}
+		}
+	}
+	return nil
+}
+
+// threadSubscription is a user's subscription to the thread of a post.
+// Users who left a thread keep one with subscribed false.
+type threadSubscription struct {
+	subscribed bool
+	// lastRead is the ID of the last reply read, "" if none was.
+	lastRead string
+}
+
+// subscribeThread subscribes username to the thread of a post or
+// unsubscribes them.
+func (s *Store) subscribeThread(parentID, username string, subscribed bool) {
+	key := pair{username, parentID}
+	if sub, ok := s.threadSubs[key]; ok {
+		sub.subscribed = subscribed
+		return
+	}
+	s.threadSubs[key] = &threadSubscription{subscribed: subscribed}
+}
+
+func (s *Store) ChannelPosts(ctx context.Context, id, viewer, before string, limit int) ([]store.ChannelPost, error) {
+	return s.channelPosts(id, "", viewer, before, limit)
+}
+
+func (s *Store) ChannelReplies(ctx context.Context, id, parentID, viewer, before string, limit int) ([]store.ChannelPost, error) {
+	return s.channelPosts(id, parentID, viewer, before, limit)
+}
+
+// channelPosts returns the posts of a channel replying to parentID, ""
+// for the posts that are not replies. See ChannelPosts.
+func (s *Store) channelPosts(id, parentID, viewer, before string, limit int) ([]store.ChannelPost, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	cursor := 0
+	if before != "" {
+		var err error
+		if cursor, err = strconv.Atoi(before); err != nil {
+			return nil, err
+		}
+	}
+
+	// Posts are in order of ID, so the latest before the cursor are the
+	// last that match.
+	var posts []store.ChannelPost
+	for _, p := range s.posts {
+		if p.ChannelID == id && parentOf(p) == parentID && (cursor == 0 || idLess(p.ID, before)) && (!p.Shadowed || p.Sender == viewer) {
+			posts = append(posts, p)
+		}
+	}
+	if len(posts) > limit {
+		posts = posts[len(posts)-limit:]
+	}
+	return append([]store.ChannelPost{}, posts...), nil
+}
+
+// parentOf returns the ID of the post p replies to, "" if it is no reply.
+func parentOf(p store.ChannelPost) string {
+	if p.ParentID == nil {
+		return ""
+	}
+	return *p.ParentID
+}
+
+func (s *Store) ChannelThreads(ctx context.Context, id, viewer string, limit int) ([]store.ChannelThread, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	threads := map[string]*store.ChannelThread{}
+	var order []string
+	// Replies come after their parents, so the last reply seen is the
+	// latest.
+	for _, p := range s.posts {
+		parentID := parentOf(p)
+		if p.ChannelID != id || parentID == "" || (p.Shadowed && p.Sender != viewer) {
+			continue
+		}
+		t := threads[parentID]
+		if t == nil {
+			i := s.findPost(id, parentID)
+			if i < 0 || (s.posts[i].Shadowed && s.posts[i].Sender != viewer) {
+				continue
+			}
+			t = &store.ChannelThread{Parent: s.posts[i]}
+			if sub := s.threadSubs[pair{viewer, parentID}]; sub != nil && sub.subscribed {
+				t.Subscribed = true
+			}
+			threads[parentID] = t
+		}
+		t.Replies++
+		t.LastReplyAt = p.CreatedAt
+		if t.Subscribed && p.Sender != viewer && !p.Shadowed && idLess(s.threadSubs[pair{viewer, parentID}].lastRead, p.ID) {
+			t.Unread++
+		}
+		order = slices.DeleteFunc(order, func(other string) bool { return other == parentID })
+		order = append(order, parentID)
+	}
+
+	result := []store.ChannelThread{}
+	for i := len(order) - 1; i >= 0 && len(result) < limit; i-- {
+		result = append(result, *threads[order[i]])
+	}
+	return result, nil
+}
+
+func (s *Store) SetThreadSubscription(ctx context.Context, parentID, username string, subscribed bool) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.subscribeThread(parentID, username, subscribed)
+	return nil
+}
+
+func (s *Store) MarkThreadRead(ctx context.Context, parentID, username string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	sub := s.threadSubs[pair{username, parentID}]
+	if sub == nil || !sub.subscribed {
+		return nil
+	}
+	for _, p := range s.posts {
+		if parentOf(p) == parentID {
+			sub.lastRead = p.ID
+		}
+	}
+	return nil
+}
+
+func (s *Store) ThreadSubscribersAmong(ctx context.Context, id, parentID string, usernames []string) ([]string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	ch := s.findChannel(id)
+	if ch == nil {
+		return nil, nil
+	}
+	var subscribers []string
+	for _, username := range usernames {
+		if sub := s.threadSubs[pair{username, parentID}]; sub != nil && sub.subscribed && ch.subscribers[username] != "" {
+			subscribers = append(subscribers, username)
+		}
+	}
+	return subscribers, nil
+}
+
+// findPost returns the index of a post of a channel in s.posts, or -1 if
+// the channel has no such post.
+func (s *Store) findPost(id, postID string) int {
+	for i, p := range s.posts {
+		if p.ChannelID == id && p.ID == postID {
+			return i
+		}
+	}
+	return -1
+}
+
+func (s *Store) ChannelPost(ctx context.Context, id, postID string) (store.ChannelPost, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	i := s.findPost(id, postID)
+	if i < 0 {
+		return store.ChannelPost{}, store.ErrNotFound
+	}
+	return s.posts[i], nil
+}
+
+func (s *Store) DeleteChannelPost(ctx context.Context, id, postID string) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.findPost(id, postID) < 0 {
+		return false, nil
+	}
+	s.deletePosts(func(p store.ChannelPost) bool { return p.ChannelID == id && p.ID == postID })
+	return true, nil
+}
+
+func (s *Store) PinChannelPost(ctx context.Context, id, postID string, pinned bool) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	i := s.findPost(id, postID)
+	if i < 0 {
+		return false, nil
+	}
+	s.posts[i].Pinned = pinned
+	return true, nil
+}
+
+func (s *Store) PinnedChannelPosts(ctx context.Context, id, viewer string) ([]store.ChannelPost, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	posts := []store.ChannelPost{}
+	for _, p := range s.posts {
+		if p.ChannelID == id && p.Pinned && (!p.Shadowed || p.Sender == viewer) {
+			posts = append(posts, p)
+		}
+	}
+	return posts, nil
+}
+
+// channelInvite is a channel invite with the hash of its token.
+type channelInvite struct {
+	store.ChannelInvite
+	tokenHash string
+}
+
+func (s *Store) CreateChannelInvite(ctx context.Context, invite *store.ChannelInvite, tokenHash string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.findChannel(invite.ChannelID) == nil {
+		return store.ErrNotFound
+	}
+	invite.ID = s.nextID("channel_invites")
+	invite.CreatedAt = now()
+	s.invites = append(s.invites, &channelInvite{ChannelInvite: *invite, tokenHash: tokenHash})
+	return nil
+}
+
+func (s *Store) ChannelInvites(ctx context.Context, id string) ([]store.ChannelInvite, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	invites := []store.ChannelInvite{}
+	for _, inv := range s.invites {
+		if inv.ChannelID == id {
+			invites = append(invites, inv.ChannelInvite)
+		}
+	}
+	return invites, nil
+}
+
+// deleteInvites deletes the channel invites matching match.
+func (s *Store) deleteInvites(match func(*channelInvite) bool) {
+	kept := s.invites[:0]
+	for _, inv := range s.invites {
+		if !match(inv) {
+			kept = append(kept, inv)
+		}
+	}
+	clear(s.invites[len(kept):])
+	s.invites = kept
+}
+
+func (s *Store) DeleteChannelInvite(ctx context.Context, id, inviteID string) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	n := len(s.invites)
+	s.deleteInvites(func(inv *channelInvite) bool { return inv.ChannelID == id && inv.ID == inviteID })
+	return len(s.invites) < n, nil
+}
+
+func (s *Store) ChannelInviteByToken(ctx context.Context, tokenHash string) (store.ChannelInvite, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, inv := range s.invites {
+		if inv.tokenHash == tokenHash {
+			return inv.ChannelInvite, nil
+		}
+	}
+	return store.ChannelInvite{}, store.ErrNotFound
+}
+
+func (s *Store) UseChannelInvite(ctx context.Context, inviteID, username string) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, inv := range s.invites {
+		if inv.ID != inviteID {
+			continue
+		}
+		if (inv.ExpiresAt != nil && !inv.ExpiresAt.After(now())) || (inv.MaxUses > 0 && inv.Uses >= inv.MaxUses) {
+			return false, nil
+		}
+		inv.Uses++
+		s.findChannel(inv.ChannelID).subscribe(username, store.ChannelRoleMember)
+		return true, nil
+	}
+	return false, nil
+}
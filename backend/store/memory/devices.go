@@ -0,0 +1,178 @@
+package memory
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	"backend/store"
+)
+
+// device is a push notification target of a user.
+type device struct {
+	store.Device
+	username string
+}
+
+func (s *Store) RegisterDevice(ctx context.Context, username string, d *store.Device) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, existing := range s.devices {
+		if existing.Platform == d.Platform && existing.Token == d.Token {
+			existing.username = username
+			d.ID = existing.ID
+			return nil
+		}
+	}
+	d.ID = s.nextID("device_tokens")
+	s.devices = append(s.devices, &device{Device: *d, username: username})
+	return nil
+}
+
+func (s *Store) UnregisterDevice(ctx context.Context, id, username string) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.deleteDevices(func(d *device) bool { return d.ID == id && d.username == username }), nil
+}
+
+func (s *Store) Devices(ctx context.Context, username string) ([]store.Device, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.userDevices(username), nil
+}
+
+// userDevices returns the devices of username, or nil if they have none.
+func (s *Store) userDevices(username string) []store.Device {
+	var devices []store.Device
+	for _, d := range s.devices {
+		if d.username == username {
+			devices = append(devices, d.Device)
+		}
+	}
+	return devices
+}
+
+func (s *Store) DeleteDevice(ctx context.Context, id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.deleteDevices(func(d *device) bool { return d.ID == id })
+	return nil
+}
+
+// deleteDevices deletes the devices matching match, reporting whether there
+// were any.
+func (s *Store) deleteDevices(match func(*device) bool) bool {
+	kept := s.devices[:0]
+	for _, d := range s.devices {
+		if !match(d) {
+			kept = append(kept, d)
+		}
+	}
+	deleted := len(kept) < len(s.devices)
+	clear(s.devices[len(kept):])
+	s.devices = kept
+	return deleted
+}
+
+func (s *Store) NotificationPreferences(ctx context.Context, username string) (store.NotificationPreferences, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.notificationPreferences(username), nil
+}
+
+// notificationPreferences returns the preferences of username, or the
+// defaults.
+func (s *Store) notificationPreferences(username string) store.NotificationPreferences {
+	prefs, ok := s.prefs[username]
+	if !ok {
+		return store.DefaultNotificationPreferences
+	}
+	if prefs.QuietHours != nil {
+		q := *prefs.QuietHours
+		prefs.QuietHours = &q
+	}
+	return prefs
+}
+
+func (s *Store) SetNotificationPreferences(ctx context.Context, username string, prefs store.NotificationPreferences) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if prefs.QuietHours != nil {
+		q := *prefs.QuietHours
+		prefs.QuietHours = &q
+	}
+	s.prefs[username] = prefs
+	return nil
+}
+
+func (s *Store) MuteConversation(ctx context.Context, username, peer string, d time.Duration) (store.Mute, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	m := store.Mute{Username: peer}
+	var until *time.Time
+	if d > 0 {
+		t := now().Add(d.Truncate(time.Second))
+		until = &t
+		m.Until = &t
+	}
+	s.mutes[pair{username, peer}] = until
+	return m, nil
+}
+
+// activeMute reports whether username muted peer and the mute has not run
+// out.
+func (s *Store) activeMute(username, peer string) bool {
+	until, ok := s.mutes[pair{username, peer}]
+	return ok && (until == nil || until.After(time.Now()))
+}
+
+func (s *Store) UnmuteConversation(ctx context.Context, username, peer string) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if !s.activeMute(username, peer) {
+		return false, nil
+	}
+	delete(s.mutes, pair{username, peer})
+	return true, nil
+}
+
+func (s *Store) Mutes(ctx context.Context, username string) ([]store.Mute, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.userMutes(username), nil
+}
+
+// userMutes returns the mutes of username that have not run out, ordered by
+// peer.
+func (s *Store) userMutes(username string) []store.Mute {
+	mutes := []store.Mute{}
+	for p, until := range s.mutes {
+		if p.a != username || !s.activeMute(p.a, p.b) {
+			continue
+		}
+		m := store.Mute{Username: p.b}
+		if until != nil {
+			t := *until
+			m.Until = &t
+		}
+		mutes = append(mutes, m)
+	}
+	sort.Slice(mutes, func(i, j int) bool { return mutes[i].Username < mutes[j].Username })
+	return mutes
+}
+
+func (s *Store) Muted(ctx context.Context, username, peer string) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.activeMute(username, peer), nil
+}
@@ -0,0 +1,62 @@
+package memory
+
+import (
+	"context"
+	"sort"
+	"strconv"
+	"time"
+
+	"backend/store"
+)
+
+func (s *Store) MessageTTL(ctx context.Context, username, peer string) (time.Duration, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.ttls[pair{username, peer}], nil
+}
+
+func (s *Store) SetMessageTTL(ctx context.Context, a, b string, ttl time.Duration) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if ttl == 0 {
+		delete(s.ttls, pair{a, b})
+		delete(s.ttls, pair{b, a})
+		return nil
+	}
+	// Like store/postgres, whole seconds are kept.
+	ttl = ttl.Truncate(time.Second)
+	s.ttls[pair{a, b}] = ttl
+	s.ttls[pair{b, a}] = ttl
+	return nil
+}
+
+func (s *Store) DeleteExpired(ctx context.Context, now time.Time, limit int) ([]store.ExpiredMessage, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var due []*message
+	for _, m := range s.messages {
+		if m.expiresAt != nil && !m.expiresAt.After(now) {
+			due = append(due, m)
+		}
+	}
+	sort.SliceStable(due, func(i, j int) bool { return due[i].expiresAt.Before(*due[j].expiresAt) })
+	due = page(due, 0, limit)
+
+	expired := []store.ExpiredMessage{}
+	gone := map[int]bool{}
+	for _, m := range due {
+		e := store.ExpiredMessage{ID: strconv.Itoa(m.id), Sender: m.sender, Receiver: m.receiver}
+		for _, a := range m.attachments {
+			e.AttachmentKeys = append(e.AttachmentKeys, a.keys()...)
+		}
+		expired = append(expired, e)
+		gone[m.id] = true
+	}
+	if len(gone) > 0 {
+		s.remove(gone, false)
+	}
+	return expired, nil
+}
@@ -0,0 +1,99 @@
+package memory
+
+import (
+	"context"
+	"sort"
+	"strconv"
+
+	"backend/store"
+)
+
+func (s *Store) EachMessage(ctx context.Context, viewer, other string, fn func(store.Message) error) error {
+	s.mu.Lock()
+	messages := s.views(s.conversation(viewer, other), false)
+	s.mu.Unlock()
+
+	return each(messages, fn)
+}
+
+func (s *Store) EachMessageOf(ctx context.Context, username string, fn func(store.Message) error) error {
+	s.mu.Lock()
+	var ms []*message
+	for _, m := range s.messages {
+		if m.involves(username) {
+			ms = append(ms, m)
+		}
+	}
+	messages := s.views(ms, false)
+	s.mu.Unlock()
+
+	return each(messages, fn)
+}
+
+// each calls fn with every message until it returns an error. The messages
+// are copied out beforehand so fn, which may write to a slow client, runs
+// without holding the lock.
+func each(messages []store.Message, fn func(store.Message) error) error {
+	for _, msg := range messages {
+		if err := fn(msg); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *Store) PersonalData(ctx context.Context, username string) (store.PersonalData, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	d := store.PersonalData{Username: username}
+	u, ok := s.users[username]
+	if !ok {
+		return d, store.ErrNotFound
+	}
+	d.Email, d.Role, d.LastSeen = u.email, u.role, u.lastSeen
+
+	d.Votes = []store.Vote{}
+	for _, m := range s.messages {
+		if voteType, ok := m.votes[username]; ok {
+			d.Votes = append(d.Votes, store.Vote{MessageID: strconv.Itoa(m.id), Type: voteType})
+		}
+	}
+	// Postgres orders them by message ID as text.
+	sort.Slice(d.Votes, func(i, j int) bool { return d.Votes[i].MessageID < d.Votes[j].MessageID })
+
+	d.Blocked = []string{}
+	for p := range s.blocks {
+		if p.a == username {
+			d.Blocked = append(d.Blocked, p.b)
+		}
+	}
+	sort.Strings(d.Blocked)
+
+	d.Channels = []string{}
+	for _, ch := range s.channels {
+		if ch.subscribers[username] != "" {
+			d.Channels = append(d.Channels, ch.Name)
+		}
+	}
+	sort.Strings(d.Channels)
+
+	d.Attachments = []store.UploadedAttachment{}
+	for _, a := range s.attachments {
+		if a.uploader != username {
+			continue
+		}
+		d.Attachments = append(d.Attachments, store.UploadedAttachment{
+			Attachment: store.Attachment{ID: a.id, Filename: a.filename, ContentType: a.contentType, Size: a.size, URL: attachmentURL(a.id)},
+			MessageID:  strconv.Itoa(a.messageID),
+			Key:        a.key,
+		})
+	}
+
+	d.Devices = s.userDevices(username)
+	d.NotificationPreferences = s.notificationPreferences(username)
+	d.Mutes = s.userMutes(username)
+	d.Status = s.userStatus(username)
+	d.ScheduledMessages = s.scheduledBy(username)
+	return d, nil
+}
@@ -0,0 +1,153 @@
+// Package memory implements the store interfaces in memory, for demos and
+// tests that should not need a database. Everything is lost when the
+// process exits, and a single lock serializes every call, so it suits one
+// instance with little traffic.
+package memory
+
+import (
+	"context"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"backend/store"
+)
+
+// Store implements store.Store in memory. Its tables mirror those of
+// store/postgres closely enough for the API to behave the same on either.
+type Store struct {
+	mu sync.Mutex
+
+	// seqs holds the last ID handed out per table, like Postgres serials.
+	seqs map[string]int
+	// lastSeqs holds the last seq handed out per conversation, keyed by
+	// sortedPair.
+	lastSeqs map[pair]int64
+
+	users    map[string]*user
+	sessions map[string]*session
+
+	// messages is ordered by ID, which is also the order they were sent in;
+	// byID indexes it. Archived messages were removed by retention.
+	messages    []*message
+	byID        map[int]*message
+	archived    []*message
+	attachments []*attachment
+	uploads     map[string]store.Upload
+	ttls        map[pair]time.Duration
+
+	blocks    map[pair]bool
+	devices   []*device
+	prefs     map[string]store.NotificationPreferences
+	mutes     map[pair]*time.Time
+	statuses  map[string]store.UserStatus
+	filters   map[pair]string
+	flags     []store.Flag
+	scheduled []*store.ScheduledMessage
+	// shadowMutes is ordered by username, then channel, global mutes first.
+	shadowMutes []*store.ShadowMute
+
+	apiKeys    []*apiKey
+	userKeys   []*userKey
+	webhooks   []*store.Webhook
+	deliveries []*store.WebhookDelivery
+	bots       map[string]*bot
+	commands   map[string]*store.Command
+	hooks      []*incomingHook
+	channels   []*channel
+	posts      []store.ChannelPost
+	invites    []*channelInvite
+	// threadSubs maps a username and the ID of a post to their
+	// subscription to its thread.
+	threadSubs map[pair]*threadSubscription
+	audit      []store.AuditEntry
+}
+
+var _ store.Store = (*Store)(nil)
+
+// pair keys what belongs to one user about another, such as a block or a
+// mute.
+type pair struct{ a, b string }
+
+// sortedPair keys the conversation between a and b, whichever sent a
+// message.
+func sortedPair(a, b string) pair {
+	if b < a {
+		a, b = b, a
+	}
+	return pair{a, b}
+}
+
+// New returns an empty Store.
+func New() *Store {
+	return &Store{
+		seqs:     map[string]int{},
+		lastSeqs: map[pair]int64{},
+		users:    map[string]*user{},
+		sessions: map[string]*session{},
+		byID:     map[int]*message{},
+		uploads:  map[string]store.Upload{},
+		ttls:     map[pair]time.Duration{},
+		blocks:   map[pair]bool{},
+		prefs:    map[string]store.NotificationPreferences{},
+		mutes:    map[pair]*time.Time{},
+		statuses: map[string]store.UserStatus{},
+		filters:  map[pair]string{},
+		bots:     map[string]*bot{},
+		commands: map[string]*store.Command{},
+
+		threadSubs: map[pair]*threadSubscription{},
+	}
+}
+
+// Ping always succeeds: there is nothing to reach.
+func (s *Store) Ping(ctx context.Context) error {
+	return nil
+}
+
+// next returns the next ID of table.
+func (s *Store) next(table string) int {
+	s.seqs[table]++
+	return s.seqs[table]
+}
+
+// nextID returns the next ID of table as text, like the IDs Postgres
+// returns.
+func (s *Store) nextID(table string) string {
+	return strconv.Itoa(s.next(table))
+}
+
+// now returns the current time in UTC, as Postgres stores timestamps.
+func now() time.Time {
+	return time.Now().UTC()
+}
+
+// idLess orders IDs handed out by nextID numerically.
+func idLess(a, b string) bool {
+	x, _ := strconv.Atoi(a)
+	y, _ := strconv.Atoi(b)
+	return x < y
+}
+
+// page returns the items of s after skipping offset, at most limit of them.
+func page[T any](s []T, offset, limit int) []T {
+	if offset >= len(s) {
+		return s[:0]
+	}
+	s = s[offset:]
+	if limit < len(s) {
+		s = s[:limit]
+	}
+	return s
+}
+
+// sortedKeys returns the keys of m in order.
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
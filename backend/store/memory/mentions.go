@@ -0,0 +1,51 @@
+package memory
+
+import (
+	"context"
+	"sort"
+
+	"backend/store"
+)
+
+func (s *Store) CreateMentions(ctx context.Context, msg *store.Message, usernames []string) error {
+	if len(usernames) == 0 {
+		return nil
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	m := s.lookup(msg.ID)
+	if m == nil {
+		return store.ErrNotFound
+	}
+	t := now()
+	for _, username := range usernames {
+		if _, ok := m.mentions[username]; !ok {
+			m.mentions[username] = t
+		}
+	}
+	msg.Mentions = usernames
+	return nil
+}
+
+func (s *Store) Mentions(ctx context.Context, username string, limit, offset int) ([]store.Mention, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	mentions := []store.Mention{}
+	for _, m := range s.messages {
+		mentionedAt, ok := m.mentions[username]
+		if !ok || m.deletedAt != nil || m.deletedFor[username] {
+			continue
+		}
+		mentions = append(mentions, store.Mention{Message: s.view(m, false), MentionedAt: mentionedAt})
+	}
+	// Newest first: messages are in order of ID, so reverse them before the
+	// stable sort to break ties by descending ID.
+	for i, j := 0, len(mentions)-1; i < j; i, j = i+1, j-1 {
+		mentions[i], mentions[j] = mentions[j], mentions[i]
+	}
+	sort.SliceStable(mentions, func(i, j int) bool { return mentions[i].MentionedAt.After(mentions[j].MentionedAt) })
+	return page(mentions, offset, limit), nil
+}
@@ -0,0 +1,581 @@
+package memory
+
+import (
+	"context"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"backend/markup"
+	"backend/store"
+)
+
+// message is a row of messages along with what Postgres keeps in tables of
+// its own: its status, who deleted it for themselves, votes, mentions, pin
+// and attachments.
+type message struct {
+	id                   int
+	sender, receiver     string
+	seq                  int64
+	content, format      string
+	kind                 string
+	system               *store.SystemEvent
+	upvotes, downvotes   int
+	status               string
+	createdAt, updatedAt time.Time
+	deletedAt, expiresAt *time.Time
+	// replyTo is the ID of the message this one replies to, zero if none.
+	replyTo  int
+	shadowed bool
+
+	deletedFor  map[string]bool
+	votes       map[string]string
+	mentions    map[string]time.Time
+	pin         *store.Pin
+	attachments []*attachment
+}
+
+// between reports whether m was sent between a and b, either way.
+func (m *message) between(a, b string) bool {
+	return (m.sender == a && m.receiver == b) || (m.sender == b && m.receiver == a)
+}
+
+// involves reports whether username sent or received m.
+func (m *message) involves(username string) bool {
+	return m.sender == username || m.receiver == username
+}
+
+// lookup returns the message with id, or nil if there is none.
+func (s *Store) lookup(id string) *message {
+	n, err := strconv.Atoi(id)
+	if err != nil {
+		return nil
+	}
+	return s.byID[n]
+}
+
+// view returns m as the API sees it, with its attachments if attachments is
+// set. The content of messages deleted for everyone is blanked out and their
+// attachments stay hidden.
+func (s *Store) view(m *message, attachments bool) store.Message {
+	msg := store.Message{
+		ID:        strconv.Itoa(m.id),
+		Sender:    m.sender,
+		Receiver:  m.receiver,
+		Seq:       m.seq,
+		Format:    m.format,
+		Upvotes:   m.upvotes,
+		Downvotes: m.downvotes,
+		Status:    m.status,
+		Deleted:   m.deletedAt != nil,
+		Kind:      m.kind,
+		CreatedAt: m.createdAt,
+		UpdatedAt: m.updatedAt,
+		Shadowed:  m.shadowed,
+	}
+	if !msg.Deleted {
+		msg.Content = m.content
+		if m.system != nil {
+			system := *m.system
+			msg.System = &system
+		}
+	}
+	msg.HTML = markup.Render(msg.Format, msg.Content)
+	if m.expiresAt != nil {
+		expiresAt := *m.expiresAt
+		msg.ExpiresAt = &expiresAt
+	}
+	if len(m.mentions) > 0 {
+		msg.Mentions = sortedKeys(m.mentions)
+	}
+	if p := s.byID[m.replyTo]; p != nil {
+		id := strconv.Itoa(p.id)
+		content := p.content
+		if p.deletedAt != nil {
+			content = ""
+		}
+		msg.ReplyToID = &id
+		msg.ReplyTo = store.NewReplyPreview(id, p.sender, content, p.deletedAt != nil)
+	}
+	if attachments && !msg.Deleted {
+		for _, a := range m.attachments {
+			msg.Attachments = append(msg.Attachments, a.public())
+		}
+	}
+	return msg
+}
+
+// views returns the API view of every message in ms.
+func (s *Store) views(ms []*message, attachments bool) []store.Message {
+	messages := make([]store.Message, len(ms))
+	for i, m := range ms {
+		messages[i] = s.view(m, attachments)
+	}
+	return messages
+}
+
+// conversation returns the messages between viewer and other that viewer
+// did not delete for themselves, oldest first.
+func (s *Store) conversation(viewer, other string) []*message {
+	var ms []*message
+	for _, m := range s.messages {
+		if m.between(viewer, other) && !m.deletedFor[viewer] {
+			ms = append(ms, m)
+		}
+	}
+	return ms
+}
+
+// insert stores msg as sent and fills in its ID, seq, status, timestamps
+// and kind, and returns it. A user message expires if disappearing messages are
+// on for its conversation; system messages stay. A shadowed message is
+// deleted for its receiver from the start.
+func (s *Store) insert(msg *store.Message) *message {
+	if msg.Kind == "" {
+		msg.Kind = store.KindUser
+	}
+	if msg.Format == "" {
+		msg.Format = markup.FormatPlain
+	}
+
+	t := now()
+	conv := sortedPair(msg.Sender, msg.Receiver)
+	s.lastSeqs[conv]++
+	m := &message{
+		id:         s.next("messages"),
+		sender:     msg.Sender,
+		receiver:   msg.Receiver,
+		seq:        s.lastSeqs[conv],
+		content:    msg.Content,
+		format:     msg.Format,
+		kind:       msg.Kind,
+		status:     store.StatusSent,
+		createdAt:  t,
+		updatedAt:  t,
+		shadowed:   msg.Shadowed,
+		deletedFor: map[string]bool{},
+		votes:      map[string]string{},
+		mentions:   map[string]time.Time{},
+	}
+	if msg.System != nil {
+		system := *msg.System
+		m.system = &system
+	}
+	if msg.ReplyToID != nil {
+		m.replyTo, _ = strconv.Atoi(*msg.ReplyToID)
+	}
+	if msg.Shadowed {
+		m.deletedFor[msg.Receiver] = true
+	}
+	if ttl, ok := s.ttls[pair{msg.Sender, msg.Receiver}]; ok && m.kind == store.KindUser {
+		expiresAt := t.Add(ttl)
+		m.expiresAt = &expiresAt
+	}
+	s.messages = append(s.messages, m)
+	s.byID[m.id] = m
+
+	msg.ID = strconv.Itoa(m.id)
+	msg.Seq = m.seq
+	msg.Status = store.StatusSent
+	msg.CreatedAt, msg.UpdatedAt = m.createdAt, m.updatedAt
+	msg.ExpiresAt = nil
+	if m.expiresAt != nil {
+		expiresAt := *m.expiresAt
+		msg.ExpiresAt = &expiresAt
+	}
+	return m
+}
+
+// validReply reports whether msg replies to nothing or to a message that
+// exists, as the foreign key on reply_to_id requires.
+func (s *Store) validReply(msg *store.Message) bool {
+	return msg.ReplyToID == nil || s.lookup(*msg.ReplyToID) != nil
+}
+
+// remove deletes the messages in gone with their statuses, pins, mentions,
+// votes and flags, and clears replies to them, like the delete trigger on
+// messages. Their attachments are deleted too unless archive is set, in
+// which case the messages are kept in archived.
+func (s *Store) remove(gone map[int]bool, archive bool) {
+	kept := s.messages[:0]
+	for _, m := range s.messages {
+		if !gone[m.id] {
+			if gone[m.replyTo] {
+				m.replyTo = 0
+			}
+			kept = append(kept, m)
+			continue
+		}
+		delete(s.byID, m.id)
+		if archive {
+			m.votes, m.mentions, m.pin = map[string]string{}, map[string]time.Time{}, nil
+			s.archived = append(s.archived, m)
+		}
+	}
+	clear(s.messages[len(kept):])
+	s.messages = kept
+
+	if !archive {
+		attachments := s.attachments[:0]
+		for _, a := range s.attachments {
+			if !gone[a.messageID] {
+				attachments = append(attachments, a)
+			}
+		}
+		clear(s.attachments[len(attachments):])
+		s.attachments = attachments
+	}
+
+	flags := s.flags[:0]
+	for _, f := range s.flags {
+		if id, err := strconv.Atoi(f.MessageID); err != nil || !gone[id] {
+			flags = append(flags, f)
+		}
+	}
+	s.flags = flags
+
+	for _, sm := range s.scheduled {
+		if sm.ReplyToID == nil {
+			continue
+		}
+		if id, err := strconv.Atoi(*sm.ReplyToID); err == nil && gone[id] {
+			sm.ReplyToID = nil
+		}
+	}
+}
+
+func (s *Store) CreateMessage(ctx context.Context, msg *store.Message) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if !s.validReply(msg) {
+		return store.ErrInvalidReplyTo
+	}
+	s.insert(msg)
+	return nil
+}
+
+func (s *Store) CreateMessages(ctx context.Context, msgs []*store.Message) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// Check every message first so a batch is stored whole or not at all.
+	for _, msg := range msgs {
+		if !s.validReply(msg) {
+			return store.ErrInvalidReplyTo
+		}
+	}
+	for _, msg := range msgs {
+		s.insert(msg)
+	}
+	return nil
+}
+
+func (s *Store) Message(ctx context.Context, id string) (store.Message, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	m := s.lookup(id)
+	if m == nil {
+		return store.Message{}, store.ErrNotFound
+	}
+	return s.view(m, true), nil
+}
+
+func (s *Store) Conversation(ctx context.Context, viewer, other string, since time.Time) ([]store.Message, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	messages := []store.Message{}
+	for _, m := range s.conversation(viewer, other) {
+		if since.IsZero() || m.updatedAt.After(since) {
+			messages = append(messages, s.view(m, true))
+		}
+	}
+	return messages, nil
+}
+
+func (s *Store) RecentMessages(ctx context.Context, viewer, other string, limit int) ([]store.Message, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	ms := s.conversation(viewer, other)
+	if len(ms) > limit {
+		ms = ms[len(ms)-limit:]
+	}
+	return s.views(ms, true), nil
+}
+
+func (s *Store) MessagesBefore(ctx context.Context, viewer, other, before string, limit int) ([]store.Message, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	ms := s.conversation(viewer, other)
+	if before != "" {
+		cursor, err := strconv.Atoi(before)
+		if err != nil {
+			return nil, err
+		}
+		i := sort.Search(len(ms), func(i int) bool { return ms[i].id >= cursor })
+		ms = ms[:i]
+	}
+	if len(ms) > limit {
+		ms = ms[len(ms)-limit:]
+	}
+	return s.views(ms, true), nil
+}
+
+func (s *Store) MessagesAfter(ctx context.Context, username string, afterID, limit int) ([]store.Message, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	messages := []store.Message{}
+	for _, m := range s.messages {
+		if len(messages) == limit {
+			break
+		}
+		if m.id > afterID && m.involves(username) && !m.deletedFor[username] {
+			messages = append(messages, s.view(m, true))
+		}
+	}
+	return messages, nil
+}
+
+func (s *Store) MessagesAfterSeq(ctx context.Context, viewer, other string, afterSeq int64, limit int) ([]store.Message, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	messages := []store.Message{}
+	for _, m := range s.conversation(viewer, other) {
+		if len(messages) == limit {
+			break
+		}
+		if m.seq > afterSeq {
+			messages = append(messages, s.view(m, true))
+		}
+	}
+	return messages, nil
+}
+
+func (s *Store) MessagesByID(ctx context.Context, viewer string, ids []string) ([]store.Message, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	messages := []store.Message{}
+	for _, id := range ids {
+		if m := s.lookup(id); m != nil && m.involves(viewer) && !m.deletedFor[viewer] {
+			messages = append(messages, s.view(m, true))
+		}
+	}
+	return messages, nil
+}
+
+func (s *Store) Undelivered(ctx context.Context, receiver string, afterID, limit int) ([]store.Message, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	messages := []store.Message{}
+	for _, m := range s.messages {
+		if len(messages) == limit {
+			break
+		}
+		if m.receiver == receiver && m.status == store.StatusSent && m.deletedAt == nil && m.id > afterID && !m.deletedFor[receiver] {
+			messages = append(messages, s.view(m, true))
+		}
+	}
+	return messages, nil
+}
+
+func (s *Store) Thread(ctx context.Context, messageID, viewer string) (string, []store.Message, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	root := s.lookup(messageID)
+	if root == nil || !root.involves(viewer) {
+		return "", nil, store.ErrNotFound
+	}
+	for root.replyTo != 0 {
+		root = s.byID[root.replyTo]
+	}
+
+	// A reply always comes after the message it replies to, so one pass in
+	// order of ID finds the whole thread.
+	thread := map[int]bool{root.id: true}
+	messages := []store.Message{}
+	for _, m := range s.messages {
+		if m.id != root.id && !thread[m.replyTo] {
+			continue
+		}
+		thread[m.id] = true
+		if !m.deletedFor[viewer] {
+			messages = append(messages, s.view(m, true))
+		}
+	}
+	return strconv.Itoa(root.id), messages, nil
+}
+
+// Search matches messages containing every word of query, ignoring case,
+// newest first. It has none of the stemming or ranking of full text search
+// in Postgres.
+func (s *Store) Search(ctx context.Context, viewer, query string, limit, offset int) ([]store.SearchResult, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	terms := strings.Fields(strings.ToLower(strings.NewReplacer(`"`, " ", "-", " ").Replace(query)))
+	results := []store.SearchResult{}
+	if len(terms) == 0 {
+		return results, nil
+	}
+	for i := len(s.messages) - 1; i >= 0; i-- {
+		m := s.messages[i]
+		if !m.involves(viewer) || m.deletedAt != nil || m.deletedFor[viewer] || !containsAll(m.content, terms) {
+			continue
+		}
+		results = append(results, store.SearchResult{Message: s.view(m, false), Highlight: highlight(m.content, terms)})
+	}
+	return page(results, offset, limit), nil
+}
+
+// containsAll reports whether content contains every one of the lower case
+// terms, ignoring case.
+func containsAll(content string, terms []string) bool {
+	content = strings.ToLower(content)
+	for _, term := range terms {
+		if !strings.Contains(content, term) {
+			return false
+		}
+	}
+	return true
+}
+
+// highlight wraps the occurrences of the lower case terms in content in
+// <mark> tags.
+func highlight(content string, terms []string) string {
+	lower := strings.ToLower(content)
+	if len(lower) != len(content) {
+		// Offsets into lower would not match content.
+		return content
+	}
+
+	var b strings.Builder
+	for i := 0; i < len(content); {
+		matched := ""
+		for _, term := range terms {
+			if strings.HasPrefix(lower[i:], term) && len(term) > len(matched) {
+				matched = term
+			}
+		}
+		if matched == "" {
+			b.WriteByte(content[i])
+			i++
+			continue
+		}
+		b.WriteString("<mark>" + content[i:i+len(matched)] + "</mark>")
+		i += len(matched)
+	}
+	return b.String()
+}
+
+func (s *Store) ReplyPreview(ctx context.Context, replyToID, sender, receiver string) (*store.ReplyPreview, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	p := s.lookup(replyToID)
+	if p == nil || p.kind != store.KindUser || !p.between(sender, receiver) {
+		return nil, store.ErrInvalidReplyTo
+	}
+	content := p.content
+	if p.deletedAt != nil {
+		content = ""
+	}
+	return store.NewReplyPreview(replyToID, p.sender, content, p.deletedAt != nil), nil
+}
+
+func (s *Store) Participants(ctx context.Context, id string) (string, string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	m := s.lookup(id)
+	if m == nil {
+		return "", "", store.ErrNotFound
+	}
+	return m.sender, m.receiver, nil
+}
+
+func (s *Store) DeleteForUser(ctx context.Context, id, username string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if m := s.lookup(id); m != nil {
+		m.deletedFor[username] = true
+	}
+	return nil
+}
+
+func (s *Store) DeleteForEveryone(ctx context.Context, id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if m := s.lookup(id); m != nil && m.deletedAt == nil {
+		t := now()
+		m.deletedAt, m.updatedAt = &t, t
+	}
+	return nil
+}
+
+func (s *Store) MarkDelivered(ctx context.Context, id, receiver string) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	m := s.lookup(id)
+	if m == nil || m.receiver != receiver || m.status != store.StatusSent {
+		return false, nil
+	}
+	m.status = store.StatusDelivered
+	return true, nil
+}
+
+func (s *Store) MarkReadUpTo(ctx context.Context, id, receiver string) ([]string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	last := s.lookup(id)
+	if last == nil || last.receiver != receiver {
+		return nil, store.ErrNotFound
+	}
+
+	var ids []string
+	for _, m := range s.messages {
+		if m.id > last.id {
+			break
+		}
+		if m.sender == last.sender && m.receiver == receiver && m.status != store.StatusRead {
+			m.status = store.StatusRead
+			ids = append(ids, strconv.Itoa(m.id))
+		}
+	}
+	return ids, nil
+}
+
+func (s *Store) MarkConversationReadUpTo(ctx context.Context, reader, peer, id string) ([]string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	last := s.lookup(id)
+	if last == nil || !(last.sender == reader && last.receiver == peer || last.sender == peer && last.receiver == reader) {
+		return nil, store.ErrNotFound
+	}
+
+	var ids []string
+	for _, m := range s.messages {
+		if m.id > last.id {
+			break
+		}
+		if m.sender == peer && m.receiver == reader && m.status != store.StatusRead {
+			m.status = store.StatusRead
+			ids = append(ids, strconv.Itoa(m.id))
+		}
+	}
+	return ids, nil
+}
@@ -0,0 +1,43 @@
+package memory
+
+import (
+	"context"
+
+	"backend/store"
+)
+
+func (s *Store) Strictness(ctx context.Context, username, peer string) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.filters[pair{username, peer}], nil
+}
+
+func (s *Store) SetStrictness(ctx context.Context, username, peer, strictness string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.filters[pair{username, peer}] = strictness
+	return nil
+}
+
+func (s *Store) FlagMessage(ctx context.Context, f store.Flag) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	f.ID = s.nextID("message_flags")
+	f.CreatedAt = now()
+	s.flags = append(s.flags, f)
+	return nil
+}
+
+func (s *Store) Flags(ctx context.Context, limit int) ([]store.Flag, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	flags := []store.Flag{}
+	for i := len(s.flags) - 1; i >= 0 && len(flags) < limit; i-- {
+		flags = append(flags, s.flags[i])
+	}
+	return flags, nil
+}
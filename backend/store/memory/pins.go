@@ -0,0 +1,60 @@
+package memory
+
+import (
+	"context"
+	"sort"
+
+	"backend/store"
+)
+
+func (s *Store) PinMessage(ctx context.Context, id, username, peer string, limit int) (store.Pin, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	m := s.lookup(id)
+	if m == nil || m.deletedAt != nil || m.kind != store.KindUser || !m.between(username, peer) {
+		return store.Pin{}, false, store.ErrNotFound
+	}
+	if m.pin != nil {
+		return *m.pin, false, nil
+	}
+
+	count := 0
+	for _, other := range s.messages {
+		if other.pin != nil && other.between(username, peer) {
+			count++
+		}
+	}
+	if count >= limit {
+		return store.Pin{}, false, store.ErrPinLimit
+	}
+
+	m.pin = &store.Pin{MessageID: id, PinnedBy: username, PinnedAt: now()}
+	return *m.pin, true, nil
+}
+
+func (s *Store) UnpinMessage(ctx context.Context, id, username, peer string) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	m := s.lookup(id)
+	if m == nil || m.pin == nil || !m.between(username, peer) {
+		return false, nil
+	}
+	m.pin = nil
+	return true, nil
+}
+
+func (s *Store) PinnedMessages(ctx context.Context, viewer, peer string) ([]store.PinnedMessage, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	pinned := []store.PinnedMessage{}
+	for _, m := range s.conversation(viewer, peer) {
+		if m.pin != nil && m.deletedAt == nil {
+			pinned = append(pinned, store.PinnedMessage{Message: s.view(m, true), PinnedBy: m.pin.PinnedBy, PinnedAt: m.pin.PinnedAt})
+		}
+	}
+	sort.SliceStable(pinned, func(i, j int) bool { return pinned[i].PinnedAt.After(pinned[j].PinnedAt) })
+	return pinned, nil
+}
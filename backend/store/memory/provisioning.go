@@ -0,0 +1,120 @@
+package memory
+
+import (
+	"context"
+
+	"backend/store"
+)
+
+// apiKey is an API key and the hash of its secret.
+type apiKey struct {
+	store.APIKey
+	hash    string
+	revoked bool
+}
+
+// public returns k as the API sees it.
+func (k *apiKey) public() store.APIKey {
+	pub := k.APIKey
+	if k.LastUsedAt != nil {
+		t := *k.LastUsedAt
+		pub.LastUsedAt = &t
+	}
+	return pub
+}
+
+func (s *Store) CreateAPIKey(ctx context.Context, key *store.APIKey, keyHash string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	key.ID = s.nextID("api_keys")
+	key.CreatedAt = now()
+	s.apiKeys = append(s.apiKeys, &apiKey{APIKey: store.APIKey{ID: key.ID, Name: key.Name, CreatedBy: key.CreatedBy, CreatedAt: key.CreatedAt}, hash: keyHash})
+	return nil
+}
+
+func (s *Store) APIKeys(ctx context.Context) ([]store.APIKey, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	keys := []store.APIKey{}
+	for _, k := range s.apiKeys {
+		if !k.revoked {
+			keys = append(keys, k.public())
+		}
+	}
+	return keys, nil
+}
+
+func (s *Store) RevokeAPIKey(ctx context.Context, id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, k := range s.apiKeys {
+		if k.ID == id && !k.revoked {
+			k.revoked = true
+			return nil
+		}
+	}
+	return store.ErrNotFound
+}
+
+func (s *Store) UseAPIKey(ctx context.Context, keyHash string) (store.APIKey, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, k := range s.apiKeys {
+		if k.hash == keyHash && !k.revoked {
+			t := now()
+			k.LastUsedAt = &t
+			return k.public(), nil
+		}
+	}
+	return store.APIKey{}, store.ErrNotFound
+}
+
+// provisioned returns u as the provisioning API sees it.
+func provisioned(u *user) store.ProvisionedUser {
+	return store.ProvisionedUser{Username: u.username, Email: u.email, Role: u.role, Banned: u.bannedAt != nil}
+}
+
+func (s *Store) ProvisionedUser(ctx context.Context, username string) (store.ProvisionedUser, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	u, ok := s.users[username]
+	if !ok || u.deleted() {
+		return store.ProvisionedUser{}, store.ErrNotFound
+	}
+	return provisioned(u), nil
+}
+
+func (s *Store) ProvisionedUsers(ctx context.Context, offset, limit int) ([]store.ProvisionedUser, int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	users := []store.ProvisionedUser{}
+	for _, username := range sortedKeys(s.users) {
+		if u := s.users[username]; !u.deleted() {
+			users = append(users, provisioned(u))
+		}
+	}
+	return page(users, offset, limit), len(users), nil
+}
+
+func (s *Store) SetEmail(ctx context.Context, username, email string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	u, ok := s.users[username]
+	if !ok || u.deleted() {
+		return store.ErrNotFound
+	}
+	if s.emailTaken(email, username) {
+		return store.ErrEmailTaken
+	}
+	if u.email != email {
+		u.email, u.emailVerifiedAt = email, nil
+	}
+	return nil
+}
@@ -0,0 +1,41 @@
+package memory
+
+import (
+	"context"
+	"time"
+)
+
+// EnsureMessagePartitions does nothing: messages are not partitioned in
+// memory.
+func (s *Store) EnsureMessagePartitions(ctx context.Context, from, through time.Time) error {
+	return nil
+}
+
+// ExpireMessagePartitions removes the messages of every month that ended by
+// before, as if each month were a partition of its own.
+func (s *Store) ExpireMessagePartitions(ctx context.Context, before time.Time, archive bool) ([]string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	gone := map[int]bool{}
+	var keys []string
+	for _, m := range s.messages {
+		t := m.createdAt
+		monthEnd := time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, time.UTC).AddDate(0, 1, 0)
+		if monthEnd.After(before) {
+			// Messages are in the order they were sent, so later ones are
+			// no older.
+			break
+		}
+		gone[m.id] = true
+		if !archive {
+			for _, a := range m.attachments {
+				keys = append(keys, a.keys()...)
+			}
+		}
+	}
+	if len(gone) > 0 {
+		s.remove(gone, archive)
+	}
+	return keys, nil
+}
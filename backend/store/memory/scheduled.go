@@ -0,0 +1,103 @@
+package memory
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	"backend/store"
+)
+
+// copyScheduled returns a copy of sm that does not share its reply ID.
+func copyScheduled(sm *store.ScheduledMessage) store.ScheduledMessage {
+	c := *sm
+	if sm.ReplyToID != nil {
+		id := *sm.ReplyToID
+		c.ReplyToID = &id
+	}
+	return c
+}
+
+func (s *Store) CreateScheduled(ctx context.Context, sm *store.ScheduledMessage) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	sm.ID = s.nextID("scheduled_messages")
+	sm.CreatedAt = now()
+	sm.SendAt = sm.SendAt.UTC()
+	stored := copyScheduled(sm)
+	s.scheduled = append(s.scheduled, &stored)
+	return nil
+}
+
+func (s *Store) ScheduledMessages(ctx context.Context, sender string) ([]store.ScheduledMessage, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.scheduledBy(sender), nil
+}
+
+// scheduledBy returns the scheduled messages of sender, soonest first.
+func (s *Store) scheduledBy(sender string) []store.ScheduledMessage {
+	scheduled := []store.ScheduledMessage{}
+	for _, sm := range s.scheduled {
+		if sm.Sender == sender {
+			scheduled = append(scheduled, copyScheduled(sm))
+		}
+	}
+	sortScheduled(scheduled)
+	return scheduled
+}
+
+// sortScheduled orders scheduled messages by when they are sent, then by ID.
+func sortScheduled(scheduled []store.ScheduledMessage) {
+	sort.SliceStable(scheduled, func(i, j int) bool {
+		if !scheduled[i].SendAt.Equal(scheduled[j].SendAt) {
+			return scheduled[i].SendAt.Before(scheduled[j].SendAt)
+		}
+		return idLess(scheduled[i].ID, scheduled[j].ID)
+	})
+}
+
+func (s *Store) CancelScheduled(ctx context.Context, id, sender string) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.deleteScheduled(func(sm *store.ScheduledMessage) bool { return sm.ID == id && sm.Sender == sender }), nil
+}
+
+// deleteScheduled deletes the scheduled messages matching match, reporting
+// whether there were any.
+func (s *Store) deleteScheduled(match func(*store.ScheduledMessage) bool) bool {
+	kept := s.scheduled[:0]
+	for _, sm := range s.scheduled {
+		if !match(sm) {
+			kept = append(kept, sm)
+		}
+	}
+	deleted := len(kept) < len(s.scheduled)
+	clear(s.scheduled[len(kept):])
+	s.scheduled = kept
+	return deleted
+}
+
+func (s *Store) ClaimDueScheduled(ctx context.Context, now time.Time, limit int) ([]store.ScheduledMessage, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	due := []store.ScheduledMessage{}
+	for _, sm := range s.scheduled {
+		if !sm.SendAt.After(now) {
+			due = append(due, copyScheduled(sm))
+		}
+	}
+	sortScheduled(due)
+	due = page(due, 0, limit)
+
+	claimed := map[string]bool{}
+	for _, sm := range due {
+		claimed[sm.ID] = true
+	}
+	s.deleteScheduled(func(sm *store.ScheduledMessage) bool { return claimed[sm.ID] })
+	return due, nil
+}
@@ -0,0 +1,114 @@
+package memory
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	"backend/store"
+)
+
+// session is a refresh token session, keyed by token hash in Store.sessions.
+type session struct {
+	store.Session
+	username string
+	revoked  bool
+}
+
+func (s *Store) CreateSession(ctx context.Context, username, tokenHash string, client store.SessionClient, expiresAt time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	t := now()
+	s.sessions[tokenHash] = &session{
+		Session: store.Session{
+			ID:           s.nextID("sessions"),
+			Device:       client.Device,
+			IP:           client.IP,
+			CreatedAt:    t,
+			LastActiveAt: t,
+			ExpiresAt:    expiresAt.UTC(),
+		},
+		username: username,
+	}
+	return nil
+}
+
+func (s *Store) RotateSession(ctx context.Context, oldHash, newHash string, client store.SessionClient, expiresAt time.Time) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	sess, ok := s.sessions[oldHash]
+	if !ok || !sess.active() {
+		return "", store.ErrInvalidSession
+	}
+	delete(s.sessions, oldHash)
+	sess.Device, sess.IP = client.Device, client.IP
+	sess.LastActiveAt, sess.ExpiresAt = now(), expiresAt.UTC()
+	s.sessions[newHash] = sess
+	return sess.username, nil
+}
+
+func (s *Store) RevokeSession(ctx context.Context, tokenHash string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if sess, ok := s.sessions[tokenHash]; ok {
+		sess.revoked = true
+	}
+	return nil
+}
+
+func (s *Store) RevokeUserSessions(ctx context.Context, username string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.revokeSessions(username)
+	return nil
+}
+
+func (s *Store) Sessions(ctx context.Context, username string) ([]store.Session, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	sessions := []store.Session{}
+	for _, sess := range s.sessions {
+		if sess.username == username && sess.active() {
+			sessions = append(sessions, sess.Session)
+		}
+	}
+	sort.Slice(sessions, func(i, j int) bool {
+		if !sessions[i].LastActiveAt.Equal(sessions[j].LastActiveAt) {
+			return sessions[i].LastActiveAt.After(sessions[j].LastActiveAt)
+		}
+		return idLess(sessions[j].ID, sessions[i].ID)
+	})
+	return sessions, nil
+}
+
+func (s *Store) RevokeUserSession(ctx context.Context, username, id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, sess := range s.sessions {
+		if sess.ID == id && sess.username == username && sess.active() {
+			sess.revoked = true
+			return nil
+		}
+	}
+	return store.ErrNotFound
+}
+
+// active reports whether the session can still be used.
+func (sess *session) active() bool {
+	return !sess.revoked && sess.ExpiresAt.After(time.Now())
+}
+
+// revokeSessions revokes every session of username.
+func (s *Store) revokeSessions(username string) {
+	for _, sess := range s.sessions {
+		if sess.username == username {
+			sess.revoked = true
+		}
+	}
+}
@@ -0,0 +1,91 @@
+package memory
+
+import (
+	"context"
+	"sort"
+
+	"backend/store"
+)
+
+func (s *Store) ShadowMute(ctx context.Context, m store.ShadowMute) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if m.ChannelID != "" && s.findChannel(m.ChannelID) == nil {
+		return store.ErrNotFound
+	}
+	m.CreatedAt = now()
+	if existing := s.findShadowMute(m.Username, m.ChannelID); existing != nil {
+		*existing = m
+		return nil
+	}
+	s.shadowMutes = append(s.shadowMutes, &m)
+	sortShadowMutes(s.shadowMutes)
+	return nil
+}
+
+func (s *Store) ShadowUnmute(ctx context.Context, username, channelID string) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.findShadowMute(username, channelID) == nil {
+		return false, nil
+	}
+	s.deleteShadowMutes(func(m *store.ShadowMute) bool { return m.Username == username && m.ChannelID == channelID })
+	return true, nil
+}
+
+func (s *Store) ShadowMuted(ctx context.Context, username, channelID string) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.findShadowMute(username, "") != nil {
+		return true, nil
+	}
+	return channelID != "" && s.findShadowMute(username, channelID) != nil, nil
+}
+
+func (s *Store) ShadowMutes(ctx context.Context) ([]store.ShadowMute, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	mutes := []store.ShadowMute{}
+	for _, m := range s.shadowMutes {
+		mutes = append(mutes, *m)
+	}
+	return mutes, nil
+}
+
+// findShadowMute returns the mute of username in a channel, or their global
+// mute if channelID is empty, or nil if there is none.
+func (s *Store) findShadowMute(username, channelID string) *store.ShadowMute {
+	for _, m := range s.shadowMutes {
+		if m.Username == username && m.ChannelID == channelID {
+			return m
+		}
+	}
+	return nil
+}
+
+// deleteShadowMutes deletes the mutes matching match.
+func (s *Store) deleteShadowMutes(match func(*store.ShadowMute) bool) {
+	kept := s.shadowMutes[:0]
+	for _, m := range s.shadowMutes {
+		if !match(m) {
+			kept = append(kept, m)
+		}
+	}
+	clear(s.shadowMutes[len(kept):])
+	s.shadowMutes = kept
+}
+
+// sortShadowMutes orders mutes by username, then channel, global mutes
+// first.
+func sortShadowMutes(mutes []*store.ShadowMute) {
+	sort.Slice(mutes, func(i, j int) bool {
+		if mutes[i].Username != mutes[j].Username {
+			return mutes[i].Username < mutes[j].Username
+		}
+		return idLess(mutes[i].ChannelID, mutes[j].ChannelID)
+	})
+}
@@ -0,0 +1,55 @@
+package memory
+
+import (
+	"context"
+	"time"
+
+	"backend/store"
+)
+
+func (s *Store) UserStatus(ctx context.Context, username string) (store.UserStatus, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.userStatus(username), nil
+}
+
+// userStatus returns the status of username, or the default if they set
+// none or it expired.
+func (s *Store) userStatus(username string) store.UserStatus {
+	status, ok := s.statuses[username]
+	if !ok || (status.ExpiresAt != nil && !status.ExpiresAt.After(time.Now())) {
+		return store.DefaultUserStatus
+	}
+	if status.ExpiresAt != nil {
+		t := *status.ExpiresAt
+		status.ExpiresAt = &t
+	}
+	return status
+}
+
+func (s *Store) SetUserStatus(ctx context.Context, username string, status *store.UserStatus, d time.Duration) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	status.ExpiresAt = nil
+	if d > 0 {
+		t := now().Add(d.Truncate(time.Second))
+		status.ExpiresAt = &t
+	}
+	stored := *status
+	if stored.ExpiresAt != nil {
+		t := *stored.ExpiresAt
+		stored.ExpiresAt = &t
+	}
+	s.statuses[username] = stored
+	return nil
+}
+
+func (s *Store) ClearUserStatus(ctx context.Context, username string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.statuses, username)
+	return nil
+}
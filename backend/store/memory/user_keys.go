@@ -0,0 +1,76 @@
+package memory
+
+import (
+	"context"
+
+	"backend/store"
+)
+
+// userKey is a user API key and the hash of its secret.
+type userKey struct {
+	store.UserAPIKey
+	hash    string
+	revoked bool
+}
+
+// public returns k as the API sees it.
+func (k *userKey) public() store.UserAPIKey {
+	pub := k.UserAPIKey
+	if k.LastUsedAt != nil {
+		t := *k.LastUsedAt
+		pub.LastUsedAt = &t
+	}
+	return pub
+}
+
+func (s *Store) CreateUserAPIKey(ctx context.Context, key *store.UserAPIKey, keyHash string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	key.ID = s.nextID("user_api_keys")
+	key.CreatedAt = now()
+	k := *key
+	k.LastUsedAt = nil
+	s.userKeys = append(s.userKeys, &userKey{UserAPIKey: k, hash: keyHash})
+	return nil
+}
+
+func (s *Store) UserAPIKeys(ctx context.Context, username string) ([]store.UserAPIKey, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	keys := []store.UserAPIKey{}
+	for _, k := range s.userKeys {
+		if k.Username == username && !k.revoked {
+			keys = append(keys, k.public())
+		}
+	}
+	return keys, nil
+}
+
+func (s *Store) RevokeUserAPIKey(ctx context.Context, username, id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, k := range s.userKeys {
+		if k.ID == id && k.Username == username && !k.revoked {
+			k.revoked = true
+			return nil
+		}
+	}
+	return store.ErrNotFound
+}
+
+func (s *Store) UseUserAPIKey(ctx context.Context, keyHash string) (store.UserAPIKey, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, k := range s.userKeys {
+		if k.hash == keyHash && !k.revoked {
+			t := now()
+			k.LastUsedAt = &t
+			return k.public(), nil
+		}
+	}
+	return store.UserAPIKey{}, store.ErrNotFound
+}
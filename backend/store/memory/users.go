@@ -0,0 +1,438 @@
+package memory
+
+import (
+	"context"
+	"maps"
+	"slices"
+	"sort"
+	"time"
+
+	"backend/store"
+	"backend/usernames"
+)
+
+type user struct {
+	username string
+	// normalized is the username in the form usernames.Normalize returns.
+	normalized string
+	password   store.Password
+	// email is empty if the user has none.
+	email string
+	// emailVerifiedAt is when the email was verified, nil if it was not.
+	emailVerifiedAt     *time.Time
+	role                string
+	bannedAt            *time.Time
+	lastSeen            *time.Time
+	deletionRequestedAt *time.Time
+	erasedAt            *time.Time
+	analyticsOptOut     bool
+	// locale is the locale the user chose, empty if none.
+	locale string
+}
+
+// deleted reports whether the user asked to delete their account.
+func (u *user) deleted() bool {
+	return u.deletionRequestedAt != nil
+}
+
+// usernameTaken reports whether a user other than except has username, or
+// a name that only differs from it in case.
+func (s *Store) usernameTaken(username, except string) bool {
+	if _, ok := s.users[username]; ok && username != except {
+		return true
+	}
+	normalized := usernames.Normalize(username)
+	for _, u := range s.users {
+		if u.normalized == normalized && u.username != except {
+			return true
+		}
+	}
+	return false
+}
+
+// emailTaken reports whether a user other than username has email.
+func (s *Store) emailTaken(email, username string) bool {
+	if email == "" {
+		return false
+	}
+	for _, u := range s.users {
+		if u.email == email && u.username != username {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *Store) CreateUser(ctx context.Context, username string, password store.Password, email string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.usernameTaken(username, "") {
+		return store.ErrUsernameTaken
+	}
+	if s.emailTaken(email, username) {
+		return store.ErrEmailTaken
+	}
+	s.users[username] = &user{username: username, normalized: usernames.Normalize(username), password: password, email: email, role: store.RoleUser}
+	return nil
+}
+
+func (s *Store) PasswordHash(ctx context.Context, username string) (store.Password, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	u, ok := s.users[username]
+	if !ok {
+		return store.Password{}, store.ErrNotFound
+	}
+	return u.password, nil
+}
+
+func (s *Store) SetPasswordHash(ctx context.Context, username string, password store.Password) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if u, ok := s.users[username]; ok {
+		u.password = password
+	}
+	return nil
+}
+
+func (s *Store) UsernameByEmail(ctx context.Context, email string) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, u := range s.users {
+		if email != "" && u.email == email {
+			return u.username, nil
+		}
+	}
+	return "", store.ErrNotFound
+}
+
+func (s *Store) EmailStatus(ctx context.Context, username string) (string, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	u, ok := s.users[username]
+	if !ok {
+		return "", false, store.ErrNotFound
+	}
+	return u.email, u.emailVerifiedAt != nil, nil
+}
+
+func (s *Store) VerifyEmail(ctx context.Context, email string) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, u := range s.users {
+		if email != "" && u.email == email {
+			if u.emailVerifiedAt == nil {
+				t := now()
+				u.emailVerifiedAt = &t
+			}
+			return u.username, nil
+		}
+	}
+	return "", store.ErrNotFound
+}
+
+func (s *Store) RenameUser(ctx context.Context, oldUsername, newUsername string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// Users may change the case of their own name.
+	if s.usernameTaken(newUsername, oldUsername) {
+		return store.ErrUsernameTaken
+	}
+	u, ok := s.users[oldUsername]
+	if !ok {
+		return nil
+	}
+	delete(s.users, oldUsername)
+	u.username, u.normalized = newUsername, usernames.Normalize(newUsername)
+	s.users[newUsername] = u
+	s.renameAll(oldUsername, newUsername)
+
+	// Tokens carry the username, so every session of the old name ends.
+	s.revokeSessions(newUsername)
+	return nil
+}
+
+// renameAll replaces oldUsername with newUsername everywhere but in users
+// and the audit log, archived messages included, like usernameColumns and
+// renameArchived in store/postgres.
+func (s *Store) renameAll(oldUsername, newUsername string) {
+	rename := func(p *string) {
+		if *p == oldUsername {
+			*p = newUsername
+		}
+	}
+
+	for _, m := range slices.Concat(s.messages, s.archived) {
+		rename(&m.sender)
+		rename(&m.receiver)
+		renameKey(m.deletedFor, oldUsername, newUsername)
+		renameKey(m.votes, oldUsername, newUsername)
+		renameKey(m.mentions, oldUsername, newUsername)
+		if m.pin != nil {
+			rename(&m.pin.PinnedBy)
+		}
+	}
+	for _, a := range s.attachments {
+		rename(&a.uploader)
+	}
+	for hash, u := range s.uploads {
+		rename(&u.Uploader)
+		s.uploads[hash] = u
+	}
+	for _, sess := range s.sessions {
+		rename(&sess.username)
+	}
+	renamePairs(s.blocks, oldUsername, newUsername)
+	for _, d := range s.devices {
+		rename(&d.username)
+	}
+	renameKey(s.prefs, oldUsername, newUsername)
+	renamePairs(s.filters, oldUsername, newUsername)
+	renamePairs(s.mutes, oldUsername, newUsername)
+	renameKey(s.statuses, oldUsername, newUsername)
+	for i := range s.flags {
+		rename(&s.flags[i].Sender)
+		rename(&s.flags[i].Receiver)
+	}
+	for _, sm := range s.scheduled {
+		rename(&sm.Sender)
+		rename(&sm.Receiver)
+	}
+	renamePairs(s.ttls, oldUsername, newUsername)
+	// Conversations are keyed by their participants in order, which the new
+	// name may change.
+	renamed := map[pair]int64{}
+	for p, seq := range s.lastSeqs {
+		if p.a == oldUsername || p.b == oldUsername {
+			delete(s.lastSeqs, p)
+			rename(&p.a)
+			rename(&p.b)
+			renamed[sortedPair(p.a, p.b)] = seq
+		}
+	}
+	maps.Copy(s.lastSeqs, renamed)
+	for _, k := range s.apiKeys {
+		rename(&k.CreatedBy)
+	}
+	for _, k := range s.userKeys {
+		rename(&k.Username)
+	}
+	for _, w := range s.webhooks {
+		rename(&w.CreatedBy)
+		rename(&w.Bot)
+	}
+	renameKey(s.bots, oldUsername, newUsername)
+	for _, b := range s.bots {
+		rename(&b.Username)
+		rename(&b.CreatedBy)
+	}
+	for _, cmd := range s.commands {
+		rename(&cmd.Bot)
+	}
+	for _, h := range s.hooks {
+		rename(&h.Bot)
+		rename(&h.Receiver)
+		rename(&h.CreatedBy)
+	}
+	for _, ch := range s.channels {
+		rename(&ch.CreatedBy)
+		renameKey(ch.senders, oldUsername, newUsername)
+		renameKey(ch.subscribers, oldUsername, newUsername)
+		renameKey(ch.subscribedAt, oldUsername, newUsername)
+	}
+	for i := range s.posts {
+		rename(&s.posts[i].Sender)
+	}
+	for _, inv := range s.invites {
+		rename(&inv.CreatedBy)
+	}
+	// Keys of thread subscriptions pair a username with a post ID, which
+	// could look like a username.
+	for key, sub := range s.threadSubs {
+		if key.a == oldUsername {
+			delete(s.threadSubs, key)
+			s.threadSubs[pair{newUsername, key.b}] = sub
+		}
+	}
+	for _, m := range s.shadowMutes {
+		rename(&m.Username)
+		rename(&m.MutedBy)
+	}
+	sortShadowMutes(s.shadowMutes)
+}
+
+// renameKey moves the value of oldKey in m to newKey.
+func renameKey[V any](m map[string]V, oldKey, newKey string) {
+	if v, ok := m[oldKey]; ok {
+		delete(m, oldKey)
+		m[newKey] = v
+	}
+}
+
+// renamePairs replaces oldUsername with newUsername on either side of the
+// keys of m.
+func renamePairs[V any](m map[pair]V, oldUsername, newUsername string) {
+	for p, v := range m {
+		if p.a != oldUsername && p.b != oldUsername {
+			continue
+		}
+		delete(m, p)
+		if p.a == oldUsername {
+			p.a = newUsername
+		}
+		if p.b == oldUsername {
+			p.b = newUsername
+		}
+		m[p] = v
+	}
+}
+
+func (s *Store) UserExists(ctx context.Context, username string) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	_, ok := s.users[username]
+	return ok, nil
+}
+
+func (s *Store) CanonicalUsername(ctx context.Context, username string) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if u, ok := s.users[username]; ok && !u.deleted() {
+		return u.username, nil
+	}
+	normalized := usernames.Normalize(username)
+	for _, u := range s.users {
+		if u.normalized == normalized && !u.deleted() {
+			return u.username, nil
+		}
+	}
+	return "", store.ErrNotFound
+}
+
+func (s *Store) Role(ctx context.Context, username string) (string, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	u, ok := s.users[username]
+	if !ok || u.deleted() {
+		return "", false, store.ErrNotFound
+	}
+	return u.role, u.bannedAt != nil, nil
+}
+
+func (s *Store) ListUsers(ctx context.Context, viewer string) ([]string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var usernames []string
+	for _, username := range sortedKeys(s.users) {
+		u := s.users[username]
+		if username == viewer || u.bannedAt != nil || u.deleted() || s.blocked(viewer, username) {
+			continue
+		}
+		usernames = append(usernames, username)
+	}
+	return usernames, nil
+}
+
+func (s *Store) LastSeen(ctx context.Context, username string) (*time.Time, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	u, ok := s.users[username]
+	if !ok {
+		return nil, store.ErrNotFound
+	}
+	return u.lastSeen, nil
+}
+
+func (s *Store) SetLastSeen(ctx context.Context, username string, t time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if u, ok := s.users[username]; ok {
+		t := t.UTC()
+		u.lastSeen = &t
+	}
+	return nil
+}
+
+func (s *Store) AnalyticsOptOut(ctx context.Context, username string) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	u, ok := s.users[username]
+	if !ok {
+		return false, store.ErrNotFound
+	}
+	return u.analyticsOptOut, nil
+}
+
+func (s *Store) SetAnalyticsOptOut(ctx context.Context, username string, optOut bool) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	u, ok := s.users[username]
+	if !ok {
+		return store.ErrNotFound
+	}
+	u.analyticsOptOut = optOut
+	return nil
+}
+
+func (s *Store) Locale(ctx context.Context, username string) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	u, ok := s.users[username]
+	if !ok {
+		return "", store.ErrNotFound
+	}
+	return u.locale, nil
+}
+
+func (s *Store) SetLocale(ctx context.Context, username, locale string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	u, ok := s.users[username]
+	if !ok {
+		return store.ErrNotFound
+	}
+	u.locale = locale
+	return nil
+}
+
+func (s *Store) Contacts(ctx context.Context, username string) ([]string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	seen := map[string]bool{}
+	var contacts []string
+	for _, m := range s.messages {
+		var peer string
+		switch username {
+		case m.sender:
+			peer = m.receiver
+		case m.receiver:
+			peer = m.sender
+		default:
+			continue
+		}
+		if !seen[peer] {
+			seen[peer] = true
+			contacts = append(contacts, peer)
+		}
+	}
+	sort.Strings(contacts)
+	return contacts, nil
+}
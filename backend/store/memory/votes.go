@@ -0,0 +1,73 @@
+package memory
+
+import (
+	"context"
+	"strconv"
+
+	"backend/store"
+)
+
+func (s *Store) ToggleVote(ctx context.Context, id, username, voteType string) (int, int, bool, error) {
+	return s.applyVote(id, username, func(existing string) string {
+		if existing == voteType {
+			return ""
+		}
+		return voteType
+	})
+}
+
+func (s *Store) SetVote(ctx context.Context, id, username, voteType string) (int, int, bool, error) {
+	return s.applyVote(id, username, func(string) string {
+		return voteType
+	})
+}
+
+// applyVote replaces username's vote on a message with next(existing vote),
+// where "" means no vote, and returns the new totals and whether username
+// cast a vote they had not before.
+func (s *Store) applyVote(id, username string, next func(existing string) string) (int, int, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	m := s.lookup(id)
+	if m == nil || m.kind != store.KindUser {
+		return 0, 0, false, store.ErrNotFound
+	}
+
+	existingVote := m.votes[username]
+	voteType := next(existingVote)
+	if voteType == "" {
+		delete(m.votes, username)
+	} else {
+		m.votes[username] = voteType
+	}
+	s.recount(m)
+	return m.upvotes, m.downvotes, voteType != "" && voteType != existingVote, nil
+}
+
+// recount sets the totals of m from the votes cast on it.
+func (s *Store) recount(m *message) {
+	m.upvotes, m.downvotes = 0, 0
+	for _, voteType := range m.votes {
+		switch voteType {
+		case store.Upvote:
+			m.upvotes++
+		case store.Downvote:
+			m.downvotes++
+		}
+	}
+	m.updatedAt = now()
+}
+
+func (s *Store) VoteScores(ctx context.Context, a, b string) (map[string]int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	scores := make(map[string]int)
+	for _, m := range s.messages {
+		if m.between(a, b) && (m.upvotes > 0 || m.downvotes > 0) && m.deletedAt == nil {
+			scores[strconv.Itoa(m.id)] = m.upvotes - m.downvotes
+		}
+	}
+	return scores, nil
+}
@@ -0,0 +1,196 @@
+package memory
+
+import (
+	"context"
+	"slices"
+	"sort"
+	"time"
+
+	"backend/store"
+)
+
+// copyDelivery returns a copy of d that shares none of its pointers.
+func copyDelivery(d *store.WebhookDelivery) store.WebhookDelivery {
+	c := *d
+	if d.ResponseStatus != nil {
+		status := *d.ResponseStatus
+		c.ResponseStatus = &status
+	}
+	if d.NextAttemptAt != nil {
+		t := *d.NextAttemptAt
+		c.NextAttemptAt = &t
+	}
+	if d.DeliveredAt != nil {
+		t := *d.DeliveredAt
+		c.DeliveredAt = &t
+	}
+	return c
+}
+
+// findWebhook returns the webhook with id, or nil if there is none.
+func (s *Store) findWebhook(id string) *store.Webhook {
+	for _, w := range s.webhooks {
+		if w.ID == id {
+			return w
+		}
+	}
+	return nil
+}
+
+func (s *Store) CreateWebhook(ctx context.Context, w *store.Webhook) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	w.ID = s.nextID("webhooks")
+	w.CreatedAt = now()
+	stored := *w
+	stored.Events = slices.Clone(w.Events)
+	s.webhooks = append(s.webhooks, &stored)
+	return nil
+}
+
+func (s *Store) Webhooks(ctx context.Context) ([]store.Webhook, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	webhooks := []store.Webhook{}
+	for _, w := range s.webhooks {
+		pub := *w
+		pub.Events = slices.Clone(w.Events)
+		pub.Secret = ""
+		webhooks = append(webhooks, pub)
+	}
+	return webhooks, nil
+}
+
+func (s *Store) DeleteWebhook(ctx context.Context, id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.findWebhook(id) == nil {
+		return store.ErrNotFound
+	}
+	s.deleteWebhooks(func(w *store.Webhook) bool { return w.ID == id })
+	return nil
+}
+
+// deleteWebhooks deletes the webhooks matching match and their deliveries.
+func (s *Store) deleteWebhooks(match func(*store.Webhook) bool) {
+	deleted := map[string]bool{}
+	kept := s.webhooks[:0]
+	for _, w := range s.webhooks {
+		if match(w) {
+			deleted[w.ID] = true
+			continue
+		}
+		kept = append(kept, w)
+	}
+	clear(s.webhooks[len(kept):])
+	s.webhooks = kept
+
+	deliveries := s.deliveries[:0]
+	for _, d := range s.deliveries {
+		if !deleted[d.WebhookID] {
+			deliveries = append(deliveries, d)
+		}
+	}
+	clear(s.deliveries[len(deliveries):])
+	s.deliveries = deliveries
+}
+
+func (s *Store) CreateDeliveries(ctx context.Context, eventType, recipient, payload string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	t := now()
+	for _, w := range s.webhooks {
+		if !slices.Contains(w.Events, eventType) || (w.Bot != "" && w.Bot != recipient) {
+			continue
+		}
+		next := t
+		s.deliveries = append(s.deliveries, &store.WebhookDelivery{
+			ID:            s.nextID("webhook_deliveries"),
+			WebhookID:     w.ID,
+			EventType:     eventType,
+			Payload:       payload,
+			Status:        store.DeliveryPending,
+			CreatedAt:     t,
+			NextAttemptAt: &next,
+		})
+	}
+	return nil
+}
+
+func (s *Store) ClaimDueDeliveries(ctx context.Context, now time.Time, lease time.Duration, limit int) ([]store.WebhookDelivery, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var due []*store.WebhookDelivery
+	for _, d := range s.deliveries {
+		if d.Status == store.DeliveryPending && d.NextAttemptAt != nil && !d.NextAttemptAt.After(now) {
+			due = append(due, d)
+		}
+	}
+	sort.SliceStable(due, func(i, j int) bool { return due[i].NextAttemptAt.Before(*due[j].NextAttemptAt) })
+	due = page(due, 0, limit)
+
+	claimed := []store.WebhookDelivery{}
+	next := now.Add(lease).UTC()
+	for _, d := range due {
+		t := next
+		d.NextAttemptAt = &t
+		c := copyDelivery(d)
+		if w := s.findWebhook(d.WebhookID); w != nil {
+			c.URL, c.Secret = w.URL, w.Secret
+		}
+		claimed = append(claimed, c)
+	}
+	sort.SliceStable(claimed, func(i, j int) bool { return claimed[i].CreatedAt.Before(claimed[j].CreatedAt) })
+	return claimed, nil
+}
+
+func (s *Store) RecordDeliveryAttempt(ctx context.Context, id string, attempt store.DeliveryAttempt) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, d := range s.deliveries {
+		if d.ID != id {
+			continue
+		}
+		d.Attempts++
+		d.Status = attempt.Status
+		d.ResponseStatus = nil
+		if attempt.ResponseStatus != nil {
+			status := *attempt.ResponseStatus
+			d.ResponseStatus = &status
+		}
+		d.Error = attempt.Error
+		d.NextAttemptAt = nil
+		if attempt.Status == store.DeliveryPending {
+			t := attempt.NextAttemptAt.UTC()
+			d.NextAttemptAt = &t
+		}
+		d.DeliveredAt = nil
+		if attempt.Status == store.DeliverySucceeded {
+			t := now()
+			d.DeliveredAt = &t
+		}
+	}
+	return nil
+}
+
+func (s *Store) WebhookDeliveries(ctx context.Context, webhookID string, limit int) ([]store.WebhookDelivery, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.findWebhook(webhookID) == nil {
+		return nil, store.ErrNotFound
+	}
+	deliveries := []store.WebhookDelivery{}
+	for i := len(s.deliveries) - 1; i >= 0 && len(deliveries) < limit; i-- {
+		if d := s.deliveries[i]; d.WebhookID == webhookID {
+			deliveries = append(deliveries, copyDelivery(d))
+		}
+	}
+	return deliveries, nil
+}
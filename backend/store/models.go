@@ -0,0 +1,667 @@
+package store
+
+import "time"
+
+// Message delivery states, in the order a message moves through them.
+const (
+	StatusSent      = "sent"
+	StatusDelivered = "delivered"
+	StatusRead      = "read"
+)
+
+// User roles. Admins may use the admin API; bots authenticate with a bot
+// token instead of a password.
+const (
+	RoleUser  = "user"
+	RoleAdmin = "admin"
+	RoleBot   = "bot"
+)
+
+// Channel roles, from most to least privileged. Every subscriber of a
+// channel is a member; the admin who creates it is its owner.
+const (
+	ChannelRoleOwner  = "owner"
+	ChannelRoleAdmin  = "admin"
+	ChannelRoleMember = "member"
+)
+
+// Channel visibilities. Anyone can find and join a public channel; a
+// private one is only seen by its members.
+const (
+	ChannelPublic  = "public"
+	ChannelPrivate = "private"
+)
+
+// Vote types accepted by ToggleVote.
+const (
+	Upvote   = "upvote"
+	Downvote = "downvote"
+)
+
+// Password hashing algorithms, stored with each hash.
+const (
+	PasswordBcrypt   = "bcrypt"
+	PasswordArgon2id = "argon2id"
+)
+
+// Password is a password hash and the algorithm that made it.
+type Password struct {
+	Algo string
+	Hash string
+}
+
+// ReplyPreviewLength caps the quoted content included with a reply.
+const ReplyPreviewLength = 100
+
+// User is an account as seen by admins.
+type User struct {
+	Username string     `json:"username"`
+	Role     string     `json:"role"`
+	Banned   bool       `json:"banned"`
+	LastSeen *time.Time `json:"last_seen,omitempty"`
+}
+
+// ProvisionedUser is a user as the provisioning API manages them.
+type ProvisionedUser struct {
+	Username string
+	// Email is empty if the user has none.
+	Email  string
+	Role   string
+	Banned bool
+}
+
+// APIKey authenticates an integration calling the provisioning API. Only a
+// hash of the key itself is stored.
+type APIKey struct {
+	ID         string     `json:"id"`
+	Name       string     `json:"name"`
+	CreatedBy  string     `json:"created_by"`
+	CreatedAt  time.Time  `json:"created_at"`
+	LastUsedAt *time.Time `json:"last_used_at,omitempty"`
+}
+
+// Scopes of a user API key: what requests made with it may do.
+const (
+	// ScopeRead allows reading, such as fetching conversations.
+	ScopeRead = "read"
+	// ScopeSend allows sending messages and nothing else.
+	ScopeSend = "send"
+)
+
+// UserAPIKey lets scripts and integrations act as the user who created it,
+// within its scope. Only a hash of the key itself is stored.
+type UserAPIKey struct {
+	ID         string     `json:"id"`
+	Username   string     `json:"-"`
+	Name       string     `json:"name"`
+	Scope      string     `json:"scope"`
+	CreatedAt  time.Time  `json:"created_at"`
+	LastUsedAt *time.Time `json:"last_used_at,omitempty"`
+}
+
+// Session is a device a user is logged in on. Its refresh token is
+// replaced on every use, but the session keeps its ID.
+type Session struct {
+	ID string `json:"id"`
+	// Device is the User-Agent of the client that last used the session.
+	Device       string    `json:"device"`
+	IP           string    `json:"ip"`
+	CreatedAt    time.Time `json:"created_at"`
+	LastActiveAt time.Time `json:"last_active_at"`
+	ExpiresAt    time.Time `json:"expires_at"`
+}
+
+// SessionClient is the client a session is started or refreshed from.
+type SessionClient struct {
+	Device string
+	IP     string
+}
+
+// Bot is a bot account. Only a hash of its token is stored.
+type Bot struct {
+	Username  string    `json:"username"`
+	CreatedBy string    `json:"created_by"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// Command is a slash command a bot registered. Messages starting with
+// /<name> are sent to the bot.
+type Command struct {
+	Name        string    `json:"name"`
+	Bot         string    `json:"bot"`
+	Description string    `json:"description"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+// IncomingHook lets an integration post messages as a bot to one user by
+// calling a secret URL. Only a hash of the URL's token is stored.
+type IncomingHook struct {
+	ID         string     `json:"id"`
+	Name       string     `json:"name"`
+	Bot        string     `json:"bot"`
+	Receiver   string     `json:"receiver"`
+	CreatedBy  string     `json:"created_by"`
+	CreatedAt  time.Time  `json:"created_at"`
+	LastUsedAt *time.Time `json:"last_used_at,omitempty"`
+}
+
+// Channel is a broadcast channel. Its designated senders post to it and
+// every subscriber receives the posts.
+type Channel struct {
+	ID          string   `json:"id"`
+	Name        string   `json:"name"`
+	Description string   `json:"description"`
+	Topic       string   `json:"topic"`
+	Visibility  string   `json:"visibility"`
+	Senders     []string `json:"senders"`
+	Subscribers int      `json:"subscribers"`
+	// Subscribed reports whether the user who fetched the channel
+	// subscribes to it, and Role is their role in it if they do.
+	Subscribed bool      `json:"subscribed"`
+	Role       string    `json:"role,omitempty"`
+	CreatedBy  string    `json:"created_by"`
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+// ChannelUpdate changes the settings of a channel. Nil fields are left
+// unchanged.
+type ChannelUpdate struct {
+	Name        *string `json:"name"`
+	Description *string `json:"description"`
+	Topic       *string `json:"topic"`
+	Visibility  *string `json:"visibility"`
+}
+
+// ChannelMember is a subscriber of a channel and their role in it.
+type ChannelMember struct {
+	Username     string    `json:"username"`
+	Role         string    `json:"role"`
+	SubscribedAt time.Time `json:"subscribed_at"`
+}
+
+// ChannelPost is a message posted to a broadcast channel.
+type ChannelPost struct {
+	ID        string    `json:"id"`
+	ChannelID string    `json:"channel_id"`
+	Sender    string    `json:"sender"`
+	Content   string    `json:"content"`
+	Pinned    bool      `json:"pinned"`
+	CreatedAt time.Time `json:"created_at"`
+	// ParentID is the post a reply is in the thread of, nil for posts to
+	// the channel itself.
+	ParentID *string `json:"parent_id,omitempty"`
+	// Kind is KindUser for posts senders made and KindSystem for notices
+	// the server adds to a channel, such as a member joining. System
+	// carries what a system post reports.
+	Kind   string       `json:"kind"`
+	System *SystemEvent `json:"system,omitempty"`
+	// Shadowed is set on posts sent while their sender was shadow-muted,
+	// which only the sender sees.
+	Shadowed bool `json:"-"`
+}
+
+// ChannelThread is a post of a channel with replies, as a viewer sees it.
+type ChannelThread struct {
+	Parent      ChannelPost `json:"parent"`
+	Replies     int         `json:"replies"`
+	LastReplyAt time.Time   `json:"last_reply_at"`
+	// Subscribed reports whether the viewer follows the thread, and Unread
+	// how many replies others made since they last read it.
+	Subscribed bool `json:"subscribed"`
+	Unread     int  `json:"unread"`
+}
+
+// ChannelInvite lets whoever has its token join a channel, even a private
+// one. Only the hash of the token is stored.
+type ChannelInvite struct {
+	ID        string    `json:"id"`
+	ChannelID string    `json:"channel_id"`
+	CreatedBy string    `json:"created_by"`
+	CreatedAt time.Time `json:"created_at"`
+	// ExpiresAt is when the invite stops working, nil if it never does.
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+	// MaxUses is how many users can join with the invite, 0 for any
+	// number. Uses is how many did.
+	MaxUses int `json:"max_uses"`
+	Uses    int `json:"uses"`
+}
+
+// AuditEntry records a security relevant action: who took it, from where,
+// and what it applied to.
+type AuditEntry struct {
+	ID     string `json:"id"`
+	Action string `json:"action"`
+	// Actor is the username that acted, the attempted username of a failed
+	// login, or api_key:<name> for the provisioning API.
+	Actor     string            `json:"actor"`
+	Target    string            `json:"target,omitempty"`
+	IP        string            `json:"ip,omitempty"`
+	UserAgent string            `json:"user_agent,omitempty"`
+	Details   map[string]string `json:"details,omitempty"`
+	CreatedAt time.Time         `json:"created_at"`
+}
+
+// AuditFilter selects audit log entries. Empty fields match every entry.
+type AuditFilter struct {
+	Actor  string
+	Action string
+	Target string
+	Since  time.Time
+	Until  time.Time
+	// BeforeID pages back through the log from the entry with that ID.
+	BeforeID int64
+	Limit    int
+}
+
+// Webhook delivers the events it subscribes to to an integrator's URL.
+type Webhook struct {
+	ID     string   `json:"id"`
+	URL    string   `json:"url"`
+	Events []string `json:"events"`
+	// Bot is set on webhooks a bot receives its own events with; other
+	// webhooks receive every event they subscribe to.
+	Bot string `json:"bot,omitempty"`
+	// Secret signs deliveries; it is only shown when the webhook is created.
+	Secret    string    `json:"-"`
+	CreatedBy string    `json:"created_by"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// Webhook delivery statuses.
+const (
+	DeliveryPending   = "pending"
+	DeliverySucceeded = "succeeded"
+	DeliveryFailed    = "failed"
+)
+
+// WebhookDelivery is an event delivered, or to be delivered, to a webhook.
+type WebhookDelivery struct {
+	ID        string `json:"id"`
+	WebhookID string `json:"webhook_id"`
+	EventType string `json:"event_type"`
+	// Payload is the JSON body POSTed to the webhook.
+	Payload  string `json:"payload"`
+	Status   string `json:"status"`
+	Attempts int    `json:"attempts"`
+	// ResponseStatus and Error describe the latest attempt.
+	ResponseStatus *int       `json:"response_status,omitempty"`
+	Error          string     `json:"error,omitempty"`
+	CreatedAt      time.Time  `json:"created_at"`
+	NextAttemptAt  *time.Time `json:"next_attempt_at,omitempty"`
+	DeliveredAt    *time.Time `json:"delivered_at,omitempty"`
+
+	// URL and Secret are the webhook's, set on claimed deliveries.
+	URL    string `json:"-"`
+	Secret string `json:"-"`
+}
+
+// DeliveryAttempt is the outcome of an attempt to deliver to a webhook.
+type DeliveryAttempt struct {
+	// Status is the delivery's status after the attempt.
+	Status         string
+	ResponseStatus *int
+	Error          string
+	// NextAttemptAt is when a pending delivery is retried.
+	NextAttemptAt time.Time
+}
+
+// Stats are aggregate counts shown to admins.
+type Stats struct {
+	Users           int `json:"users"`
+	BannedUsers     int `json:"banned_users"`
+	Messages        int `json:"messages"`
+	MessagesLastDay int `json:"messages_last_day"`
+}
+
+// Flag records a message the content filter let through for review.
+type Flag struct {
+	ID        string    `json:"id"`
+	MessageID string    `json:"message_id"`
+	Sender    string    `json:"sender"`
+	Receiver  string    `json:"receiver"`
+	Content   string    `json:"content"`
+	Reason    string    `json:"reason"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// ShadowMute hides a user's messages from everyone but the user. A mute
+// without a ChannelID is global: it covers direct messages and every
+// channel.
+type ShadowMute struct {
+	Username  string    `json:"username"`
+	ChannelID string    `json:"channel_id,omitempty"`
+	MutedBy   string    `json:"muted_by"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// Message represents a chat message.
+type Message struct {
+	ID       string `json:"id"`
+	Sender   string `json:"sender"`
+	Receiver string `json:"receiver"`
+	// Seq numbers the messages of a conversation from 1 in the order they
+	// were sent, without reuse, so a client that sees a seq jump knows it
+	// missed messages. Messages deleted or expired leave gaps for good.
+	Seq       int64  `json:"seq"`
+	Content   string `json:"content"`
+	Upvotes   int    `json:"upvotes"`
+	Downvotes int    `json:"downvotes"`
+	Status    string `json:"status"`
+	Deleted   bool   `json:"deleted"`
+
+	// Format is the markup Content is written in, plain or markdown. HTML
+	// is filled in by the server for markdown messages: Content rendered
+	// with only safe tags, which clients may display as is.
+	Format string `json:"format"`
+	HTML   string `json:"html,omitempty"`
+
+	// Kind is KindUser for messages users sent and KindSystem for notices
+	// the server adds to a conversation, such as a pinned message. System
+	// carries what a system message reports; its content is the notice in
+	// words for clients that do not render it themselves.
+	Kind   string       `json:"kind"`
+	System *SystemEvent `json:"system,omitempty"`
+
+	// CreatedAt is when the message was sent; UpdatedAt changes whenever its
+	// votes or deletion state do. Both are encoded in RFC3339.
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+	// ExpiresAt is when a disappearing message is deleted for both
+	// participants, nil for messages that never expire.
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+
+	Attachments []Attachment `json:"attachments,omitempty"`
+	// Mentions are the users mentioned with @username.
+	Mentions []string `json:"mentions,omitempty"`
+
+	// ReplyToID is the message this one replies to, set by the sender.
+	// ReplyTo is filled in by the server so clients can render a quote.
+	ReplyToID *string       `json:"reply_to_id,omitempty"`
+	ReplyTo   *ReplyPreview `json:"reply_to,omitempty"`
+
+	// Shadowed is set on messages sent while their sender was
+	// shadow-muted. They are stored deleted for their receiver, and only
+	// ever delivered to their sender, who cannot tell.
+	Shadowed bool `json:"-"`
+}
+
+// Message kinds.
+const (
+	KindUser   = "user"
+	KindSystem = "system"
+)
+
+// Events reported by system messages and system channel posts. The sender of
+// a system message is the user who caused the event.
+const (
+	SystemUsernameChanged     = "username_changed"
+	SystemMessagePinned       = "message_pinned"
+	SystemDisappearingChanged = "disappearing_changed"
+	SystemMemberJoined        = "member_joined"
+)
+
+// SystemEvent is what a system message reports.
+type SystemEvent struct {
+	Event string `json:"event"`
+	// MessageID is the message a message_pinned event is about.
+	MessageID string `json:"message_id,omitempty"`
+	// OldUsername is the sender's username before a username_changed event.
+	OldUsername string `json:"old_username,omitempty"`
+	// TTLSeconds is the disappearing messages timer set by a
+	// disappearing_changed event, 0 when it was turned off.
+	TTLSeconds *int `json:"ttl_seconds,omitempty"`
+}
+
+// ScheduledMessage is a message waiting to be sent at SendAt.
+type ScheduledMessage struct {
+	ID        string    `json:"id"`
+	Sender    string    `json:"sender"`
+	Receiver  string    `json:"receiver"`
+	Content   string    `json:"content"`
+	Format    string    `json:"format"`
+	ReplyToID *string   `json:"reply_to_id,omitempty"`
+	SendAt    time.Time `json:"send_at"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// ExpiredMessage is a disappearing message that was deleted once it expired.
+type ExpiredMessage struct {
+	ID       string
+	Sender   string
+	Receiver string
+	// AttachmentKeys are the blob keys of its attachments' files, no longer
+	// referenced.
+	AttachmentKeys []string
+}
+
+// Usage is how much a user has sent and stored, as measured by quotas.
+type Usage struct {
+	// Messages is how many messages the user sent in the quota window.
+	Messages int `json:"messages"`
+	// Attachments and StorageBytes count the files the user uploaded.
+	Attachments  int   `json:"attachments"`
+	StorageBytes int64 `json:"storage_bytes"`
+}
+
+// PersonalData is what is stored about a user besides their messages,
+// gathered for a data export.
+type PersonalData struct {
+	Username                string                  `json:"username"`
+	Email                   string                  `json:"email,omitempty"`
+	Role                    string                  `json:"role"`
+	LastSeen                *time.Time              `json:"last_seen,omitempty"`
+	Votes                   []Vote                  `json:"votes"`
+	Blocked                 []string                `json:"blocked"`
+	Devices                 []Device                `json:"devices"`
+	NotificationPreferences NotificationPreferences `json:"notification_preferences"`
+	Mutes                   []Mute                  `json:"mutes"`
+	Status                  UserStatus              `json:"status"`
+	Channels                []string                `json:"channels"`
+	ScheduledMessages       []ScheduledMessage      `json:"scheduled_messages"`
+	Attachments             []UploadedAttachment    `json:"attachments"`
+}
+
+// Vote is a user's vote on a message.
+type Vote struct {
+	MessageID string `json:"message_id"`
+	Type      string `json:"type"`
+}
+
+// UploadedAttachment is an attachment a user uploaded and the blob key of
+// its file.
+type UploadedAttachment struct {
+	Attachment
+	MessageID string `json:"message_id"`
+	Key       string `json:"-"`
+}
+
+// Attachment is a file attached to a message.
+type Attachment struct {
+	ID          string `json:"id"`
+	Filename    string `json:"filename"`
+	ContentType string `json:"content_type"`
+	Size        int64  `json:"size"`
+	URL         string `json:"url"`
+
+	// Images are processed after upload. MediaStatus is MediaPending until
+	// their dimensions and thumbnail are known, then MediaReady or
+	// MediaFailed. It is empty for other files.
+	MediaStatus  string `json:"media_status,omitempty"`
+	Width        int    `json:"width,omitempty"`
+	Height       int    `json:"height,omitempty"`
+	ThumbnailURL string `json:"thumbnail_url,omitempty"`
+}
+
+// Media processing states of an attachment.
+const (
+	MediaPending = "pending"
+	MediaReady   = "ready"
+	MediaFailed  = "failed"
+)
+
+// VariantThumbnail names the thumbnail variant of an image.
+const VariantThumbnail = "thumbnail"
+
+// PendingMedia is an uploaded image waiting to be processed.
+type PendingMedia struct {
+	AttachmentID string
+	MessageID    string
+	ContentType  string
+	Key          string
+}
+
+// AttachmentVariant is a rendered variant of an image attachment, such as
+// its thumbnail, and the blob key of its file.
+type AttachmentVariant struct {
+	Name        string `json:"name"`
+	ContentType string `json:"content_type"`
+	Width       int    `json:"width"`
+	Height      int    `json:"height"`
+	Size        int64  `json:"size"`
+	Key         string `json:"-"`
+}
+
+// Upload is a file a client uploads straight to the blob store, before it
+// is sent as an attachment.
+type Upload struct {
+	// ID is the blob key the file is uploaded to.
+	ID          string    `json:"id"`
+	Uploader    string    `json:"-"`
+	Filename    string    `json:"filename"`
+	ContentType string    `json:"content_type"`
+	Size        int64     `json:"size"`
+	ExpiresAt   time.Time `json:"expires_at"`
+}
+
+// ReplyPreview is the quoted parent of a reply.
+type ReplyPreview struct {
+	ID      string `json:"id"`
+	Sender  string `json:"sender"`
+	Content string `json:"content"`
+	Deleted bool   `json:"deleted"`
+}
+
+// NewReplyPreview builds the quote of a parent message, truncating its content.
+func NewReplyPreview(id, sender, content string, deleted bool) *ReplyPreview {
+	return &ReplyPreview{ID: id, Sender: sender, Content: Truncate(content, ReplyPreviewLength), Deleted: deleted}
+}
+
+// SearchResult is a message matching a search query along with a snippet of
+// its content with the matched terms wrapped in <mark> tags.
+type SearchResult struct {
+	Message
+	Highlight string `json:"highlight"`
+}
+
+// Mention is a message mentioning a user.
+type Mention struct {
+	Message
+	MentionedAt time.Time `json:"mentioned_at"`
+}
+
+// Pin records who pinned a message to its conversation and when.
+type Pin struct {
+	MessageID string    `json:"message_id"`
+	PinnedBy  string    `json:"pinned_by"`
+	PinnedAt  time.Time `json:"pinned_at"`
+}
+
+// PinnedMessage is a message pinned to its conversation.
+type PinnedMessage struct {
+	Message
+	PinnedBy string    `json:"pinned_by"`
+	PinnedAt time.Time `json:"pinned_at"`
+}
+
+// Device is a registered push notification target.
+type Device struct {
+	ID       string `json:"id"`
+	Platform string `json:"platform"`
+	Token    string `json:"token"`
+}
+
+// NotificationPreferences controls how a user is notified while offline.
+type NotificationPreferences struct {
+	PushEnabled bool `json:"push_enabled"`
+	ShowPreview bool `json:"show_preview"`
+	// QuietHours, if set, is when the user is not notified at all.
+	QuietHours *QuietHours `json:"quiet_hours"`
+}
+
+// QuietHoursLayout is the format of the start and end of quiet hours.
+const QuietHoursLayout = "15:04"
+
+// QuietHours is a daily period without notifications, in a time zone. It
+// spans midnight when End is before Start.
+type QuietHours struct {
+	Start    string `json:"start"`
+	End      string `json:"end"`
+	TimeZone string `json:"time_zone"`
+}
+
+// Contains reports whether t falls within the quiet hours.
+func (q QuietHours) Contains(t time.Time) bool {
+	start, err := time.Parse(QuietHoursLayout, q.Start)
+	if err != nil {
+		return false
+	}
+	end, err := time.Parse(QuietHoursLayout, q.End)
+	if err != nil {
+		return false
+	}
+	loc, err := time.LoadLocation(q.TimeZone)
+	if err != nil {
+		loc = time.UTC
+	}
+
+	t = t.In(loc)
+	now := t.Hour()*60 + t.Minute()
+	from, to := start.Hour()*60+start.Minute(), end.Hour()*60+end.Minute()
+	if from <= to {
+		return from <= now && now < to
+	}
+	return now >= from || now < to
+}
+
+// Availabilities a user can set in their status.
+const (
+	AvailabilityAvailable = "available"
+	AvailabilityBusy      = "busy"
+	// AvailabilityDND is Do Not Disturb: the user gets no push
+	// notifications while it lasts.
+	AvailabilityDND = "dnd"
+)
+
+// UserStatus is the availability and custom status a user shows their
+// contacts.
+type UserStatus struct {
+	Availability string `json:"availability"`
+	Text         string `json:"text,omitempty"`
+	Emoji        string `json:"emoji,omitempty"`
+	// ExpiresAt is when the status reverts to available, unset if it lasts
+	// until changed.
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+}
+
+// DefaultUserStatus is the status of users who set none, or whose status
+// expired.
+var DefaultUserStatus = UserStatus{Availability: AvailabilityAvailable}
+
+// Mute silences notifications of a user's conversation with another user.
+type Mute struct {
+	// Username is the other participant of the conversation.
+	Username string `json:"username"`
+	// Until is when the mute runs out, unset if it lasts until lifted.
+	Until *time.Time `json:"until,omitempty"`
+}
+
+// DefaultNotificationPreferences apply to users who never changed theirs.
+var DefaultNotificationPreferences = NotificationPreferences{PushEnabled: true, ShowPreview: true}
+
+// Truncate shortens s to at most n characters, marking the cut with an ellipsis.
+func Truncate(s string, n int) string {
+	if r := []rune(s); len(r) > n {
+		return string(r[:n]) + "…"
+	}
+	return s
+}
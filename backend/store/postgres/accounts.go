@@ -0,0 +1,216 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"backend/store"
+	"backend/usernames"
+
+	"github.com/lib/pq"
+)
+
+// erasedTables lists the rows deleted outright when a user is erased: their
+// own settings, credentials and the copies of content they wrote.
+var erasedTables = []struct{ table, where string }{
+	{"sessions", "username = $1"},
+	{"device_tokens", "username = $1"},
+	{"user_api_keys", "username = $1"},
+	{"notification_preferences", "username = $1"},
+	{"conversation_filters", "username = $1 OR peer = $1"},
+	{"conversation_mutes", "username = $1 OR peer = $1"},
+	{"user_statuses", "username = $1"},
+	{"disappearing_messages", "username = $1 OR peer = $1"},
+	{"blocks", "blocker = $1 OR blocked = $1"},
+	{"scheduled_messages", "sender = $1 OR receiver = $1"},
+	{"message_flags", "sender = $1"},
+	{"message_deletions", "username = $1"},
+	{"mentions", "username = $1"},
+	{"bots", "username = $1"},
+	{"bot_commands", "bot = $1"},
+	{"webhooks", "bot = $1"},
+	{"incoming_hooks", "bot = $1 OR receiver = $1"},
+	{"channel_senders", "username = $1"},
+	{"channel_subscriptions", "username = $1"},
+	{"channel_posts", "sender = $1"},
+	{"channel_invites", "created_by = $1"},
+	{"channel_thread_subscriptions", "username = $1"},
+	{"shadow_mutes", "username = $1"},
+	{"channel_shadow_mutes", "username = $1"},
+}
+
+func (s *Store) RequestDeletion(ctx context.Context, username string) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	// Clearing the password and email stops logins and password resets
+	// right away; the rest is erased by EraseUser.
+	res, err := tx.ExecContext(ctx, `
+		UPDATE users SET deletion_requested_at = CURRENT_TIMESTAMP, password = '', email = NULL, email_verified_at = NULL
+		WHERE username = $1 AND deletion_requested_at IS NULL`, username)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return store.ErrNotFound
+	}
+
+	if _, err := tx.ExecContext(ctx, "UPDATE sessions SET revoked_at = CURRENT_TIMESTAMP WHERE username = $1 AND revoked_at IS NULL", username); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (s *Store) PendingDeletions(ctx context.Context, limit int) ([]string, error) {
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT username FROM users
+		WHERE deletion_requested_at IS NOT NULL AND erased_at IS NULL
+		ORDER BY deletion_requested_at
+		LIMIT $1`, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	usernames := []string{}
+	for rows.Next() {
+		var username string
+		if err := rows.Scan(&username); err != nil {
+			return nil, err
+		}
+		usernames = append(usernames, username)
+	}
+	return usernames, rows.Err()
+}
+
+func (s *Store) EraseUser(ctx context.Context, username, tombstone string) ([]string, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	// Lock the user so concurrent erasers wait and then find nothing to do.
+	var pending bool
+	err = tx.QueryRowContext(ctx, "SELECT deletion_requested_at IS NOT NULL AND erased_at IS NULL FROM users WHERE username = $1 FOR UPDATE", username).Scan(&pending)
+	if err == sql.ErrNoRows || (err == nil && !pending) {
+		return nil, store.ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	// Variants are deleted with their attachment, so their files are
+	// collected in the same statement, along with files uploaded but not
+	// sent yet.
+	rows, err := tx.QueryContext(ctx, `
+		WITH variants AS (
+			SELECT v.storage_key FROM attachment_variants v
+			JOIN attachments a ON a.id = v.attachment_id
+			WHERE a.uploader = $1
+		), deleted AS (
+			DELETE FROM attachments WHERE uploader = $1 RETURNING storage_key
+		), uploads AS (
+			DELETE FROM pending_uploads WHERE uploader = $1 RETURNING storage_key
+		)
+		SELECT storage_key FROM deleted
+		UNION ALL
+		SELECT storage_key FROM variants
+		UNION ALL
+		SELECT storage_key FROM uploads`, username)
+	if err != nil {
+		return nil, err
+	}
+	var keys []string
+	for rows.Next() {
+		var key string
+		if err := rows.Scan(&key); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		keys = append(keys, key)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	// Messages the user sent are erased for both participants.
+	_, err = tx.ExecContext(ctx, `
+		UPDATE messages SET content = '', system_event = NULL, deleted_at = COALESCE(deleted_at, CURRENT_TIMESTAMP), updated_at = CURRENT_TIMESTAMP
+		WHERE sender = $1`, username)
+	if err != nil {
+		return nil, err
+	}
+	if err := eraseArchived(ctx, tx, username); err != nil {
+		return nil, err
+	}
+
+	// Withdraw the user's votes and recount the messages they voted on.
+	rows, err = tx.QueryContext(ctx, "DELETE FROM user_votes WHERE user_id = $1 RETURNING message_id", username)
+	if err != nil {
+		return nil, err
+	}
+	var voted []string
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		voted = append(voted, id)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	_, err = tx.ExecContext(ctx, `
+		UPDATE messages m SET
+			upvotes = (SELECT COUNT(*) FROM user_votes v WHERE v.message_id = m.id::text AND v.vote_type = $2),
+			downvotes = (SELECT COUNT(*) FROM user_votes v WHERE v.message_id = m.id::text AND v.vote_type = $3),
+			updated_at = CURRENT_TIMESTAMP
+		WHERE m.id::text = ANY($1)`, pq.Array(voted), store.Upvote, store.Downvote)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, t := range erasedTables {
+		if _, err := tx.ExecContext(ctx, "DELETE FROM "+t.table+" WHERE "+t.where, username); err != nil {
+			return nil, err
+		}
+	}
+
+	// What remains, such as messages the user received, is kept for the
+	// other participants under a name that no longer identifies anyone.
+	for _, col := range usernameColumns {
+		query := "UPDATE " + col.table + " SET " + col.column + " = $1 WHERE " + col.column + " = $2"
+		if _, err := tx.ExecContext(ctx, query, tombstone, username); err != nil {
+			return nil, err
+		}
+	}
+	if err := renameArchived(ctx, tx, username, tombstone); err != nil {
+		return nil, err
+	}
+	if _, err := tx.ExecContext(ctx, "UPDATE users SET username = $1, username_normalized = $2, last_seen = NULL, erased_at = CURRENT_TIMESTAMP WHERE username = $3", tombstone, usernames.Normalize(tombstone), username); err != nil {
+		return nil, err
+	}
+
+	return keys, tx.Commit()
+}
+
+func (s *Store) Usage(ctx context.Context, username string, window time.Duration) (store.Usage, error) {
+	var u store.Usage
+	err := s.db.QueryRowContext(ctx, `
+		SELECT
+			(SELECT COUNT(*) FROM messages
+			WHERE sender = $1 AND kind = 'user' AND timestamp > CURRENT_TIMESTAMP - make_interval(secs => $2::int)),
+			(SELECT COUNT(*) FROM attachments WHERE uploader = $1),
+			(SELECT COALESCE(SUM(size), 0) FROM attachments WHERE uploader = $1)`,
+		username, int(window/time.Second)).Scan(&u.Messages, &u.Attachments, &u.StorageBytes)
+	return u, err
+}
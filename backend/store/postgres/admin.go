@@ -0,0 +1,68 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+
+	"backend/store"
+)
+
+func (s *Store) Users(ctx context.Context) ([]store.User, error) {
+	rows, err := s.reader().QueryContext(ctx, "SELECT username, role, banned_at IS NOT NULL, last_seen FROM users WHERE deletion_requested_at IS NULL ORDER BY username")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	users := []store.User{}
+	for rows.Next() {
+		var u store.User
+		var lastSeen sql.NullTime
+		if err := rows.Scan(&u.Username, &u.Role, &u.Banned, &lastSeen); err != nil {
+			return nil, err
+		}
+		if lastSeen.Valid {
+			u.LastSeen = &lastSeen.Time
+		}
+		users = append(users, u)
+	}
+	return users, rows.Err()
+}
+
+func (s *Store) SetBanned(ctx context.Context, username string, banned bool) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	res, err := tx.ExecContext(ctx, `
+		UPDATE users SET banned_at = CASE WHEN $1 THEN COALESCE(banned_at, CURRENT_TIMESTAMP) END
+		WHERE username = $2`, banned, username)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return store.ErrNotFound
+	}
+
+	if banned {
+		if _, err := tx.ExecContext(ctx, "UPDATE sessions SET revoked_at = CURRENT_TIMESTAMP WHERE username = $1 AND revoked_at IS NULL", username); err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+func (s *Store) Stats(ctx context.Context) (store.Stats, error) {
+	var st store.Stats
+	err := s.reader().QueryRowContext(ctx, `
+		SELECT
+			(SELECT COUNT(*) FROM users WHERE deletion_requested_at IS NULL),
+			(SELECT COUNT(*) FROM users WHERE banned_at IS NOT NULL AND deletion_requested_at IS NULL),
+			(SELECT COUNT(*) FROM messages),
+			(SELECT COUNT(*) FROM messages WHERE timestamp > CURRENT_TIMESTAMP - INTERVAL '1 day')`).
+		Scan(&st.Users, &st.BannedUsers, &st.Messages, &st.MessagesLastDay)
+	return st, err
+}
@@ -0,0 +1,132 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"strings"
+	"time"
+
+	"backend/store"
+
+	"github.com/lib/pq"
+)
+
+// archivedColumns selects a Message from an archived partition m, like
+// messageColumns. Archived messages lost their statuses, mentions and
+// quotes when they were archived.
+const archivedColumns = `m.id, m.sender, m.receiver, m.seq,
+	CASE WHEN m.deleted_at IS NULL THEN m.content ELSE '' END, m.format,
+	m.upvotes, m.downvotes, 'sent', m.deleted_at IS NOT NULL,
+	m.kind, CASE WHEN m.deleted_at IS NULL THEN m.system_event END,
+	m.timestamp, m.updated_at, m.expires_at, m.shadowed,
+	ARRAY[]::text[], NULL::text, NULL::text, NULL::text, NULL::boolean`
+
+// querier runs queries on a database or in a transaction.
+type querier interface {
+	QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+}
+
+// archivedPartitions returns the names of the archived partitions, newest
+// first.
+func archivedPartitions(ctx context.Context, q querier) ([]string, error) {
+	rows, err := q.QueryContext(ctx, `
+		SELECT relname FROM pg_class
+		WHERE relkind = 'r' AND relname LIKE $1 AND pg_table_is_visible(oid)
+		ORDER BY relname DESC`, strings.ReplaceAll(archivedPartitionPrefix, "_", `\_`)+"%")
+	if err != nil {
+		return nil, err
+	}
+	return scanStrings(rows)
+}
+
+func (s *Store) ArchivedMessages(ctx context.Context, viewer, other, before string, limit int) ([]store.Message, error) {
+	partitions, err := archivedPartitions(ctx, s.reader())
+	if err != nil {
+		return nil, err
+	}
+
+	// Messages are ordered by (timestamp, id), and the cursor is looked up
+	// in whichever partition holds it.
+	var cursorTime, cursorID interface{}
+	if before != "" {
+		for _, partition := range partitions {
+			var t time.Time
+			var id int64
+			err := s.reader().QueryRowContext(ctx, "SELECT timestamp, id FROM "+pq.QuoteIdentifier(partition)+" WHERE id = $1", before).Scan(&t, &id)
+			if err == sql.ErrNoRows {
+				continue
+			}
+			if err != nil {
+				return nil, err
+			}
+			cursorTime, cursorID = t, id
+			break
+		}
+		if cursorID == nil {
+			return nil, store.ErrNotFound
+		}
+	}
+
+	// Each partition holds a month, so searching them newest first finds
+	// the latest messages before the cursor without reading every one.
+	messages := []store.Message{}
+	for _, partition := range partitions {
+		if len(messages) == limit {
+			break
+		}
+		older, err := s.readMessages(ctx, `
+			SELECT `+archivedColumns+`
+			FROM `+pq.QuoteIdentifier(partition)+` m
+			WHERE ((m.sender = $1 AND m.receiver = $2) OR (m.sender = $2 AND m.receiver = $1))
+			AND `+notDeletedFor+`
+			AND ($3::timestamp IS NULL OR (m.timestamp, m.id) < ($3::timestamp, $4::int))
+			ORDER BY m.timestamp DESC, m.id DESC
+			LIMIT $5`, viewer, other, cursorTime, cursorID, limit-len(messages))
+		if err != nil {
+			return nil, err
+		}
+		messages = append(messages, older...)
+	}
+
+	for i, j := 0, len(messages)-1; i < j; i, j = i+1, j-1 {
+		messages[i], messages[j] = messages[j], messages[i]
+	}
+	return messages, nil
+}
+
+// renameArchived replaces oldUsername with newUsername in every archived
+// partition. They are no longer part of messages, so usernameColumns does
+// not reach them.
+func renameArchived(ctx context.Context, tx *sql.Tx, oldUsername, newUsername string) error {
+	partitions, err := archivedPartitions(ctx, tx)
+	if err != nil {
+		return err
+	}
+	for _, partition := range partitions {
+		for _, column := range []string{"sender", "receiver"} {
+			query := "UPDATE " + pq.QuoteIdentifier(partition) + " SET " + column + " = $1 WHERE " + column + " = $2"
+			if _, err := tx.ExecContext(ctx, query, newUsername, oldUsername); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// eraseArchived erases the archived messages username sent, like EraseUser
+// does the messages still in messages.
+func eraseArchived(ctx context.Context, tx *sql.Tx, username string) error {
+	partitions, err := archivedPartitions(ctx, tx)
+	if err != nil {
+		return err
+	}
+	for _, partition := range partitions {
+		_, err := tx.ExecContext(ctx, `
+			UPDATE `+pq.QuoteIdentifier(partition)+` SET content = '', system_event = NULL, deleted_at = COALESCE(deleted_at, CURRENT_TIMESTAMP), updated_at = CURRENT_TIMESTAMP
+			WHERE sender = $1`, username)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,65 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+
+	"backend/store"
+)
+
+func (s *Store) RecordAudit(ctx context.Context, e *store.AuditEntry) error {
+	var details sql.NullString
+	if len(e.Details) > 0 {
+		b, err := json.Marshal(e.Details)
+		if err != nil {
+			return err
+		}
+		details = sql.NullString{String: string(b), Valid: true}
+	}
+
+	return s.db.QueryRowContext(ctx, `
+		INSERT INTO audit_log (action, actor, target, ip, user_agent, details) VALUES ($1, $2, $3, $4, $5, $6)
+		RETURNING id, created_at`, e.Action, e.Actor, e.Target, e.IP, e.UserAgent, details).Scan(&e.ID, &e.CreatedAt)
+}
+
+func (s *Store) AuditLog(ctx context.Context, f store.AuditFilter) ([]store.AuditEntry, error) {
+	var since, until sql.NullTime
+	if !f.Since.IsZero() {
+		since = sql.NullTime{Time: f.Since.UTC(), Valid: true}
+	}
+	if !f.Until.IsZero() {
+		until = sql.NullTime{Time: f.Until.UTC(), Valid: true}
+	}
+
+	// Empty filters match every entry.
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT id, action, actor, target, ip, user_agent, details, created_at FROM audit_log
+		WHERE ($1 = '' OR actor = $1)
+		AND ($2 = '' OR action = $2)
+		AND ($3 = '' OR target = $3)
+		AND ($4::timestamp IS NULL OR created_at >= $4)
+		AND ($5::timestamp IS NULL OR created_at < $5)
+		AND ($6::bigint = 0 OR id < $6)
+		ORDER BY id DESC LIMIT $7`, f.Actor, f.Action, f.Target, since, until, f.BeforeID, f.Limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	entries := []store.AuditEntry{}
+	for rows.Next() {
+		var e store.AuditEntry
+		var details []byte
+		if err := rows.Scan(&e.ID, &e.Action, &e.Actor, &e.Target, &e.IP, &e.UserAgent, &details, &e.CreatedAt); err != nil {
+			return nil, err
+		}
+		if details != nil {
+			if err := json.Unmarshal(details, &e.Details); err != nil {
+				return nil, err
+			}
+		}
+		entries = append(entries, e)
+	}
+	return entries, rows.Err()
+}
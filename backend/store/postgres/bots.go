@@ -0,0 +1,180 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"backend/store"
+	"backend/usernames"
+)
+
+func (s *Store) CreateBot(ctx context.Context, bot *store.Bot, password store.Password, tokenHash string) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	normalized := usernames.Normalize(bot.Username)
+	var exists bool
+	if err := tx.QueryRowContext(ctx, "SELECT EXISTS (SELECT 1 FROM users WHERE username = $1 OR username_normalized = $2)", bot.Username, normalized).Scan(&exists); err != nil {
+		return err
+	}
+	if exists {
+		return store.ErrUsernameTaken
+	}
+
+	_, err = tx.ExecContext(ctx, "INSERT INTO users (username, username_normalized, password, password_algo, role) VALUES ($1, $2, $3, $4, $5)", bot.Username, normalized, password.Hash, password.Algo, store.RoleBot)
+	if err != nil {
+		return uniqueViolation(err)
+	}
+	err = tx.QueryRowContext(ctx, `
+		INSERT INTO bots (username, token_hash, created_by) VALUES ($1, $2, $3)
+		RETURNING created_at`, bot.Username, tokenHash, bot.CreatedBy).Scan(&bot.CreatedAt)
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func (s *Store) Bots(ctx context.Context) ([]store.Bot, error) {
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT b.username, b.created_by, b.created_at FROM bots b
+		JOIN users u ON u.username = b.username
+		WHERE u.deletion_requested_at IS NULL
+		ORDER BY b.username`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	bots := []store.Bot{}
+	for rows.Next() {
+		var b store.Bot
+		if err := rows.Scan(&b.Username, &b.CreatedBy, &b.CreatedAt); err != nil {
+			return nil, err
+		}
+		bots = append(bots, b)
+	}
+	return bots, rows.Err()
+}
+
+func (s *Store) SetBotToken(ctx context.Context, username, tokenHash string) error {
+	res, err := s.db.ExecContext(ctx, "UPDATE bots SET token_hash = $1 WHERE username = $2", tokenHash, username)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return store.ErrNotFound
+	}
+	return nil
+}
+
+func (s *Store) BotByToken(ctx context.Context, tokenHash string) (string, error) {
+	var username string
+	err := s.db.QueryRowContext(ctx, "SELECT username FROM bots WHERE token_hash = $1", tokenHash).Scan(&username)
+	return username, notFound(err)
+}
+
+func (s *Store) RegisterCommand(ctx context.Context, cmd *store.Command) error {
+	// The update only applies to the bot's own command, so a name another
+	// bot holds returns no row.
+	err := s.db.QueryRowContext(ctx, `
+		INSERT INTO bot_commands (name, bot, description) VALUES ($1, $2, $3)
+		ON CONFLICT (name) DO UPDATE SET description = EXCLUDED.description
+		WHERE bot_commands.bot = EXCLUDED.bot
+		RETURNING created_at`, cmd.Name, cmd.Bot, cmd.Description).Scan(&cmd.CreatedAt)
+	if err == sql.ErrNoRows {
+		return store.ErrCommandTaken
+	}
+	return err
+}
+
+func (s *Store) Commands(ctx context.Context) ([]store.Command, error) {
+	rows, err := s.db.QueryContext(ctx, "SELECT name, bot, description, created_at FROM bot_commands ORDER BY name")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	commands := []store.Command{}
+	for rows.Next() {
+		var cmd store.Command
+		if err := rows.Scan(&cmd.Name, &cmd.Bot, &cmd.Description, &cmd.CreatedAt); err != nil {
+			return nil, err
+		}
+		commands = append(commands, cmd)
+	}
+	return commands, rows.Err()
+}
+
+func (s *Store) DeleteCommand(ctx context.Context, bot, name string) error {
+	res, err := s.db.ExecContext(ctx, "DELETE FROM bot_commands WHERE name = $1 AND bot = $2", name, bot)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return store.ErrNotFound
+	}
+	return nil
+}
+
+func (s *Store) CommandBot(ctx context.Context, name string) (string, error) {
+	var bot string
+	err := s.db.QueryRowContext(ctx, "SELECT bot FROM bot_commands WHERE name = $1", name).Scan(&bot)
+	return bot, notFound(err)
+}
+
+func (s *Store) CreateIncomingHook(ctx context.Context, hook *store.IncomingHook, tokenHash string) error {
+	return s.db.QueryRowContext(ctx, `
+		INSERT INTO incoming_hooks (name, token_hash, bot, receiver, created_by) VALUES ($1, $2, $3, $4, $5)
+		RETURNING id, created_at`, hook.Name, tokenHash, hook.Bot, hook.Receiver, hook.CreatedBy).Scan(&hook.ID, &hook.CreatedAt)
+}
+
+func (s *Store) IncomingHooks(ctx context.Context) ([]store.IncomingHook, error) {
+	rows, err := s.db.QueryContext(ctx, "SELECT id, name, bot, receiver, created_by, created_at, last_used_at FROM incoming_hooks ORDER BY id")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	hooks := []store.IncomingHook{}
+	for rows.Next() {
+		var h store.IncomingHook
+		var lastUsed sql.NullTime
+		if err := rows.Scan(&h.ID, &h.Name, &h.Bot, &h.Receiver, &h.CreatedBy, &h.CreatedAt, &lastUsed); err != nil {
+			return nil, err
+		}
+		if lastUsed.Valid {
+			h.LastUsedAt = &lastUsed.Time
+		}
+		hooks = append(hooks, h)
+	}
+	return hooks, rows.Err()
+}
+
+func (s *Store) DeleteIncomingHook(ctx context.Context, id string) error {
+	res, err := s.db.ExecContext(ctx, "DELETE FROM incoming_hooks WHERE id = $1", id)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return store.ErrNotFound
+	}
+	return nil
+}
+
+func (s *Store) UseIncomingHook(ctx context.Context, tokenHash string) (store.IncomingHook, error) {
+	var h store.IncomingHook
+	var lastUsed time.Time
+	err := s.db.QueryRowContext(ctx, `
+		UPDATE incoming_hooks SET last_used_at = CURRENT_TIMESTAMP WHERE token_hash = $1
+		RETURNING id, name, bot, receiver, created_by, created_at, last_used_at`, tokenHash).
+		Scan(&h.ID, &h.Name, &h.Bot, &h.Receiver, &h.CreatedBy, &h.CreatedAt, &lastUsed)
+	if err != nil {
+		return store.IncomingHook{}, notFound(err)
+	}
+	h.LastUsedAt = &lastUsed
+	return h, nil
+}
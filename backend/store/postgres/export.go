@@ -0,0 +1,155 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+
+	"backend/store"
+)
+
+func (s *Store) EachMessage(ctx context.Context, viewer, other string, fn func(store.Message) error) error {
+	return s.eachMessage(ctx, fn, `
+		SELECT `+messageColumns+`
+		`+messageFrom+`
+		WHERE ((m.sender = $1 AND m.receiver = $2) OR (m.sender = $2 AND m.receiver = $1))
+		AND `+notDeletedFor+`
+		ORDER BY m.timestamp, m.id`, viewer, other)
+}
+
+func (s *Store) EachMessageOf(ctx context.Context, username string, fn func(store.Message) error) error {
+	return s.eachMessage(ctx, fn, `
+		SELECT `+messageColumns+`
+		`+messageFrom+`
+		WHERE (m.sender = $1 OR m.receiver = $1)
+		ORDER BY m.timestamp, m.id`, username)
+}
+
+// eachMessage runs a query selecting messageColumns and calls fn with each
+// message as it is read. Rows are read as fast as fn consumes them, such as
+// when streaming a large export to a slow client, so the query is not
+// subject to the query timeout. Exports are read from a replica if there is
+// one.
+func (s *Store) eachMessage(ctx context.Context, fn func(store.Message) error, query string, args ...interface{}) error {
+	rows, err := s.reader().QueryContext(withoutQueryTimeout(ctx), query, args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		msg, err := scanMessage(rows)
+		if err != nil {
+			return err
+		}
+		if err := fn(msg); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
+
+func (s *Store) PersonalData(ctx context.Context, username string) (store.PersonalData, error) {
+	d := store.PersonalData{Username: username}
+	var email sql.NullString
+	var lastSeen sql.NullTime
+	err := s.db.QueryRowContext(ctx, "SELECT email, role, last_seen FROM users WHERE username = $1", username).Scan(&email, &d.Role, &lastSeen)
+	if err != nil {
+		return d, notFound(err)
+	}
+	d.Email = email.String
+	if lastSeen.Valid {
+		d.LastSeen = &lastSeen.Time
+	}
+
+	d.Votes = []store.Vote{}
+	rows, err := s.db.QueryContext(ctx, "SELECT message_id, vote_type FROM user_votes WHERE user_id = $1 ORDER BY message_id", username)
+	if err != nil {
+		return d, err
+	}
+	for rows.Next() {
+		var v store.Vote
+		if err := rows.Scan(&v.MessageID, &v.Type); err != nil {
+			rows.Close()
+			return d, err
+		}
+		d.Votes = append(d.Votes, v)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return d, err
+	}
+
+	d.Blocked = []string{}
+	rows, err = s.db.QueryContext(ctx, "SELECT blocked FROM blocks WHERE blocker = $1 ORDER BY blocked", username)
+	if err != nil {
+		return d, err
+	}
+	for rows.Next() {
+		var blocked string
+		if err := rows.Scan(&blocked); err != nil {
+			rows.Close()
+			return d, err
+		}
+		d.Blocked = append(d.Blocked, blocked)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return d, err
+	}
+
+	d.Channels = []string{}
+	rows, err = s.db.QueryContext(ctx, `
+		SELECT c.name FROM channel_subscriptions cs JOIN channels c ON c.id = cs.channel_id
+		WHERE cs.username = $1 ORDER BY c.name`, username)
+	if err != nil {
+		return d, err
+	}
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			rows.Close()
+			return d, err
+		}
+		d.Channels = append(d.Channels, name)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return d, err
+	}
+
+	d.Attachments = []store.UploadedAttachment{}
+	rows, err = s.db.QueryContext(ctx, `
+		SELECT id, message_id, filename, content_type, size, storage_key
+		FROM attachments WHERE uploader = $1 ORDER BY id`, username)
+	if err != nil {
+		return d, err
+	}
+	for rows.Next() {
+		var a store.UploadedAttachment
+		if err := rows.Scan(&a.ID, &a.MessageID, &a.Filename, &a.ContentType, &a.Size, &a.Key); err != nil {
+			rows.Close()
+			return d, err
+		}
+		a.URL = attachmentURL(a.ID)
+		d.Attachments = append(d.Attachments, a)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return d, err
+	}
+
+	if d.Devices, err = s.Devices(ctx, username); err != nil {
+		return d, err
+	}
+	if d.NotificationPreferences, err = s.NotificationPreferences(ctx, username); err != nil {
+		return d, err
+	}
+	if d.Mutes, err = s.Mutes(ctx, username); err != nil {
+		return d, err
+	}
+	if d.Status, err = s.UserStatus(ctx, username); err != nil {
+		return d, err
+	}
+	d.ScheduledMessages, err = s.ScheduledMessages(ctx, username)
+	return d, err
+}
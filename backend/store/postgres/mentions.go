@@ -0,0 +1,53 @@
+package postgres
+
+import (
+	"context"
+
+	"backend/store"
+
+	"github.com/lib/pq"
+)
+
+func (s *Store) CreateMentions(ctx context.Context, msg *store.Message, usernames []string) error {
+	if len(usernames) == 0 {
+		return nil
+	}
+
+	_, err := s.db.ExecContext(ctx, `
+		INSERT INTO mentions (message_id, username)
+		SELECT $1, u FROM unnest($2::text[]) u
+		ON CONFLICT DO NOTHING`, msg.ID, pq.Array(usernames))
+	if err != nil {
+		return err
+	}
+	msg.Mentions = usernames
+	return nil
+}
+
+func (s *Store) Mentions(ctx context.Context, username string, limit, offset int) ([]store.Mention, error) {
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT `+messageColumns+`, mn.created_at
+		`+messageFrom+`
+		JOIN mentions mn ON mn.message_id = m.id
+		WHERE mn.username = $1
+		AND m.deleted_at IS NULL
+		AND `+notDeletedFor+`
+		ORDER BY mn.created_at DESC, m.id DESC
+		LIMIT $2 OFFSET $3`, username, limit, offset)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	mentions := []store.Mention{}
+	for rows.Next() {
+		var mn store.Mention
+		var err error
+		mn.Message, err = scanMessage(rows, &mn.MentionedAt)
+		if err != nil {
+			return nil, err
+		}
+		mentions = append(mentions, mn)
+	}
+	return mentions, rows.Err()
+}
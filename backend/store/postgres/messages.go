@@ -0,0 +1,660 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"time"
+
+	"backend/markup"
+	"backend/store"
+
+	"github.com/lib/pq"
+)
+
+// messageColumns selects a Message from messages m joined with message_status
+// ms. The content of messages deleted for everyone is blanked out.
+const messageColumns = `m.id, m.sender, m.receiver, m.seq,
+	CASE WHEN m.deleted_at IS NULL THEN m.content ELSE '' END, m.format,
+	m.upvotes, m.downvotes, COALESCE(ms.status, 'sent'), m.deleted_at IS NOT NULL,
+	m.kind, CASE WHEN m.deleted_at IS NULL THEN m.system_event END,
+	m.timestamp, m.updated_at, m.expires_at, m.shadowed,
+	ARRAY(SELECT mn.username FROM mentions mn WHERE mn.message_id = m.id ORDER BY mn.username),
+	m.reply_to_id, p.sender, CASE WHEN p.deleted_at IS NULL THEN p.content ELSE '' END, p.deleted_at IS NOT NULL`
+
+// messageFrom is the FROM clause matching messageColumns.
+const messageFrom = `FROM messages m
+	LEFT JOIN message_status ms ON ms.message_id = m.id
+	LEFT JOIN messages p ON p.id = m.reply_to_id`
+
+// notDeletedFor excludes messages the user bound to $1 deleted for themselves.
+const notDeletedFor = `NOT EXISTS (SELECT 1 FROM message_deletions md WHERE md.message_id = m.id AND md.username = $1)`
+
+// rowScanner is implemented by *sql.Row and *sql.Rows.
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+// scanMessage scans a row selected with messageColumns into a Message.
+// Any extra columns selected after messageColumns are scanned into extra.
+func scanMessage(row rowScanner, extra ...interface{}) (store.Message, error) {
+	var msg store.Message
+	var replyToID, replySender, replyContent sql.NullString
+	var replyDeleted sql.NullBool
+	var expiresAt sql.NullTime
+	var system sql.NullString
+
+	dest := []interface{}{&msg.ID, &msg.Sender, &msg.Receiver, &msg.Seq, &msg.Content, &msg.Format, &msg.Upvotes, &msg.Downvotes, &msg.Status, &msg.Deleted,
+		&msg.Kind, &system,
+		&msg.CreatedAt, &msg.UpdatedAt, &expiresAt, &msg.Shadowed,
+		pq.Array(&msg.Mentions),
+		&replyToID, &replySender, &replyContent, &replyDeleted}
+	if err := row.Scan(append(dest, extra...)...); err != nil {
+		return msg, err
+	}
+
+	msg.HTML = markup.Render(msg.Format, msg.Content)
+	if expiresAt.Valid {
+		msg.ExpiresAt = &expiresAt.Time
+	}
+	if system.Valid {
+		if err := json.Unmarshal([]byte(system.String), &msg.System); err != nil {
+			return msg, err
+		}
+	}
+	if replyToID.Valid {
+		msg.ReplyToID = &replyToID.String
+		msg.ReplyTo = store.NewReplyPreview(replyToID.String, replySender.String, replyContent.String, replyDeleted.Bool)
+	}
+	return msg, nil
+}
+
+// queryMessages runs a query selecting messageColumns and returns the
+// messages with their attachments.
+func (s *Store) queryMessages(ctx context.Context, query string, args ...interface{}) ([]store.Message, error) {
+	return s.queryMessagesOn(ctx, s.db, query, args...)
+}
+
+// readMessages is queryMessages on a read replica, for history that may lag
+// slightly behind.
+func (s *Store) readMessages(ctx context.Context, query string, args ...interface{}) ([]store.Message, error) {
+	return s.queryMessagesOn(ctx, s.reader(), query, args...)
+}
+
+func (s *Store) queryMessagesOn(ctx context.Context, db *sql.DB, query string, args ...interface{}) ([]store.Message, error) {
+	rows, err := db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	messages := []store.Message{}
+	for rows.Next() {
+		msg, err := scanMessage(rows)
+		if err != nil {
+			return nil, err
+		}
+		messages = append(messages, msg)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return messages, s.loadAttachments(ctx, messages)
+}
+
+func (s *Store) CreateMessage(ctx context.Context, msg *store.Message) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	id, err := insertMessage(ctx, tx, msg)
+	if err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+
+	msg.ID = fmt.Sprintf("%d", id)
+	msg.Status = store.StatusSent
+	return nil
+}
+
+// insertMessage inserts a message and its sent status, returning its ID and
+// filling in its timestamps, kind and seq. A user message expires if
+// disappearing messages are on for its conversation; system messages stay.
+// A shadowed message is deleted for its receiver from the start.
+// Bumping the conversation's last seq locks its row until the transaction
+// ends, so the messages of a conversation are numbered in commit order.
+func insertMessage(ctx context.Context, tx *sql.Tx, msg *store.Message) (int, error) {
+	if msg.Kind == "" {
+		msg.Kind = store.KindUser
+	}
+	if msg.Format == "" {
+		msg.Format = markup.FormatPlain
+	}
+	var system sql.NullString
+	if msg.System != nil {
+		encoded, err := json.Marshal(msg.System)
+		if err != nil {
+			return 0, err
+		}
+		system = sql.NullString{String: string(encoded), Valid: true}
+	}
+
+	var id int
+	var expiresAt sql.NullTime
+	conv := conversationOf(msg.Sender, msg.Receiver)
+	err := tx.QueryRowContext(ctx, `
+		WITH seq AS (
+			INSERT INTO conversation_seqs (user_a, user_b, last_seq) VALUES ($8, $9, 1)
+			ON CONFLICT (user_a, user_b) DO UPDATE SET last_seq = conversation_seqs.last_seq + 1
+			RETURNING last_seq
+		)
+		INSERT INTO messages (sender, receiver, content, format, upvotes, downvotes, reply_to_id, kind, system_event, expires_at, seq, shadowed)
+		VALUES ($1, $2, $3, $7, 0, 0, $4, $5, $6, CASE WHEN $5 = 'user' THEN
+			CURRENT_TIMESTAMP + (SELECT make_interval(secs => ttl_seconds) FROM disappearing_messages WHERE username = $1 AND peer = $2) END,
+			(SELECT last_seq FROM seq), $10)
+		RETURNING id, timestamp, updated_at, expires_at, seq`,
+		msg.Sender, msg.Receiver, msg.Content, msg.ReplyToID, msg.Kind, system, msg.Format, conv.a, conv.b, msg.Shadowed,
+	).Scan(&id, &msg.CreatedAt, &msg.UpdatedAt, &expiresAt, &msg.Seq)
+	if err != nil {
+		return 0, err
+	}
+	if expiresAt.Valid {
+		msg.ExpiresAt = &expiresAt.Time
+	}
+
+	if _, err := tx.ExecContext(ctx, "INSERT INTO message_status (message_id, status) VALUES ($1, $2)", id, store.StatusSent); err != nil {
+		return 0, err
+	}
+	if msg.Shadowed {
+		if _, err := tx.ExecContext(ctx, "INSERT INTO message_deletions (username, message_id) VALUES ($1, $2)", msg.Receiver, id); err != nil {
+			return 0, err
+		}
+	}
+	return id, nil
+}
+
+// CreateMessages inserts every message with one statement and their statuses
+// with another, after reserving their seqs with a third, so a batch costs
+// three round trips however long it is, plus one to delete shadowed messages
+// for their receivers if there are any. Each column is passed as an array
+// and unnested back into rows, which keeps the statements the same for
+// every batch size.
+func (s *Store) CreateMessages(ctx context.Context, msgs []*store.Message) error {
+	if len(msgs) == 0 {
+		return nil
+	}
+
+	n := len(msgs)
+	senders := make([]string, n)
+	receivers := make([]string, n)
+	contents := make([]string, n)
+	formats := make([]string, n)
+	kinds := make([]string, n)
+	replies := make([]sql.NullString, n)
+	systems := make([]sql.NullString, n)
+	shadowed := make([]bool, n)
+	anyShadowed := false
+	for i, msg := range msgs {
+		if msg.Kind == "" {
+			msg.Kind = store.KindUser
+		}
+		if msg.Format == "" {
+			msg.Format = markup.FormatPlain
+		}
+		if msg.System != nil {
+			encoded, err := json.Marshal(msg.System)
+			if err != nil {
+				return err
+			}
+			systems[i] = sql.NullString{String: string(encoded), Valid: true}
+		}
+		if msg.ReplyToID != nil {
+			replies[i] = sql.NullString{String: *msg.ReplyToID, Valid: true}
+		}
+		senders[i], receivers[i], contents[i] = msg.Sender, msg.Receiver, msg.Content
+		formats[i], kinds[i], shadowed[i] = msg.Format, msg.Kind, msg.Shadowed
+		anyShadowed = anyShadowed || msg.Shadowed
+	}
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	seqs, err := reserveSeqs(ctx, tx, msgs)
+	if err != nil {
+		return err
+	}
+
+	// IDs are drawn in the order the rows are inserted, so sorting the
+	// returned rows by ID puts them back in the order of msgs.
+	rows, err := tx.QueryContext(ctx, `
+		INSERT INTO messages (sender, receiver, content, format, upvotes, downvotes, reply_to_id, kind, system_event, expires_at, seq, shadowed)
+		SELECT r.sender, r.receiver, r.content, r.format, 0, 0, r.reply_to_id, r.kind, r.system_event,
+			CASE WHEN r.kind = 'user' THEN CURRENT_TIMESTAMP + (SELECT make_interval(secs => d.ttl_seconds)
+				FROM disappearing_messages d WHERE d.username = r.sender AND d.peer = r.receiver) END,
+			r.seq, r.shadowed
+		FROM unnest($1::text[], $2::text[], $3::text[], $4::text[], $5::int[], $6::text[], $7::jsonb[], $8::bigint[], $9::boolean[])
+			WITH ORDINALITY AS r(sender, receiver, content, format, reply_to_id, kind, system_event, seq, shadowed, ord)
+		ORDER BY r.ord
+		RETURNING id, timestamp, updated_at, expires_at`,
+		pq.Array(senders), pq.Array(receivers), pq.Array(contents), pq.Array(formats),
+		pq.Array(replies), pq.Array(kinds), pq.Array(systems), pq.Array(seqs), pq.Array(shadowed))
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	type inserted struct {
+		id                   int
+		createdAt, updatedAt time.Time
+		expiresAt            sql.NullTime
+	}
+	var results []inserted
+	for rows.Next() {
+		var r inserted
+		if err := rows.Scan(&r.id, &r.createdAt, &r.updatedAt, &r.expiresAt); err != nil {
+			return err
+		}
+		results = append(results, r)
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	if len(results) != n {
+		return fmt.Errorf("inserted %d of %d messages", len(results), n)
+	}
+	sort.Slice(results, func(i, j int) bool { return results[i].id < results[j].id })
+
+	ids := make([]int, n)
+	for i, r := range results {
+		ids[i] = r.id
+	}
+	if _, err := tx.ExecContext(ctx, `
+		INSERT INTO message_status (message_id, status) SELECT unnest($1::int[]), $2`,
+		pq.Array(ids), store.StatusSent); err != nil {
+		return err
+	}
+	if anyShadowed {
+		if _, err := tx.ExecContext(ctx, `
+			INSERT INTO message_deletions (username, message_id)
+			SELECT r.receiver, r.id FROM unnest($1::text[], $2::int[], $3::boolean[]) AS r(receiver, id, shadowed)
+			WHERE r.shadowed`,
+			pq.Array(receivers), pq.Array(ids), pq.Array(shadowed)); err != nil {
+			return err
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+
+	for i, r := range results {
+		msg := msgs[i]
+		msg.ID = fmt.Sprintf("%d", r.id)
+		msg.Status = store.StatusSent
+		msg.Seq = seqs[i]
+		msg.CreatedAt, msg.UpdatedAt = r.createdAt, r.updatedAt
+		if r.expiresAt.Valid {
+			expiresAt := r.expiresAt.Time
+			msg.ExpiresAt = &expiresAt
+		}
+	}
+	return nil
+}
+
+// conversationKey identifies the conversation between two users the way
+// conversation_seqs does: a sorts before b, byte by byte rather than by
+// the database's collation.
+type conversationKey struct{ a, b string }
+
+// conversationOf returns the key of the conversation between x and y.
+func conversationOf(x, y string) conversationKey {
+	if y < x {
+		x, y = y, x
+	}
+	return conversationKey{a: x, b: y}
+}
+
+// reserveSeqs bumps the last seq of every conversation msgs belong to by
+// how many of them it has, and returns the seq of each message, numbered in
+// the order of msgs. Conversations are bumped in sorted order so concurrent
+// batches lock them in the same order and cannot deadlock.
+func reserveSeqs(ctx context.Context, tx *sql.Tx, msgs []*store.Message) ([]int64, error) {
+	counts := make(map[conversationKey]int64)
+	for _, msg := range msgs {
+		counts[conversationOf(msg.Sender, msg.Receiver)]++
+	}
+	keys := make([]conversationKey, 0, len(counts))
+	for k := range counts {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].a != keys[j].a {
+			return keys[i].a < keys[j].a
+		}
+		return keys[i].b < keys[j].b
+	})
+
+	usersA := make([]string, len(keys))
+	usersB := make([]string, len(keys))
+	added := make([]int64, len(keys))
+	for i, k := range keys {
+		usersA[i], usersB[i], added[i] = k.a, k.b, counts[k]
+	}
+	rows, err := tx.QueryContext(ctx, `
+		INSERT INTO conversation_seqs (user_a, user_b, last_seq)
+		SELECT r.user_a, r.user_b, r.added FROM unnest($1::text[], $2::text[], $3::bigint[]) WITH ORDINALITY AS r(user_a, user_b, added, ord)
+		ORDER BY r.ord
+		ON CONFLICT (user_a, user_b) DO UPDATE SET last_seq = conversation_seqs.last_seq + EXCLUDED.last_seq
+		RETURNING user_a, user_b, last_seq`,
+		pq.Array(usersA), pq.Array(usersB), pq.Array(added))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	// next holds the seq of the next message of each conversation: the
+	// first of the numbers just reserved.
+	next := make(map[conversationKey]int64, len(keys))
+	for rows.Next() {
+		var k conversationKey
+		var last int64
+		if err := rows.Scan(&k.a, &k.b, &last); err != nil {
+			return nil, err
+		}
+		next[k] = last - counts[k] + 1
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	seqs := make([]int64, len(msgs))
+	for i, msg := range msgs {
+		k := conversationOf(msg.Sender, msg.Receiver)
+		seqs[i] = next[k]
+		next[k]++
+	}
+	return seqs, nil
+}
+
+func (s *Store) Message(ctx context.Context, id string) (store.Message, error) {
+	msg, err := scanMessage(s.db.QueryRowContext(ctx, `SELECT `+messageColumns+` `+messageFrom+` WHERE m.id = $1`, id))
+	if err != nil {
+		return msg, notFound(err)
+	}
+
+	messages := []store.Message{msg}
+	err = s.loadAttachments(ctx, messages)
+	return messages[0], err
+}
+
+func (s *Store) Conversation(ctx context.Context, viewer, other string, since time.Time) ([]store.Message, error) {
+	// Timestamps are stored in UTC without a time zone. Clients sync with
+	// since, so those reads go to the primary: a lagging replica could make
+	// them skip updates for good.
+	var after interface{}
+	query := s.readMessages
+	if !since.IsZero() {
+		after = since.UTC()
+		query = s.queryMessages
+	}
+
+	return query(ctx, `
+		SELECT `+messageColumns+`
+		`+messageFrom+`
+		WHERE ((m.sender = $1 AND m.receiver = $2) OR (m.sender = $2 AND m.receiver = $1))
+		AND ($3::timestamp IS NULL OR m.updated_at > $3::timestamp)
+		AND `+notDeletedFor+`
+		ORDER BY m.timestamp`, viewer, other, after)
+}
+
+func (s *Store) RecentMessages(ctx context.Context, viewer, other string, limit int) ([]store.Message, error) {
+	messages, err := s.readMessages(ctx, `
+		SELECT `+messageColumns+`
+		`+messageFrom+`
+		WHERE ((m.sender = $1 AND m.receiver = $2) OR (m.sender = $2 AND m.receiver = $1))
+		AND `+notDeletedFor+`
+		ORDER BY m.timestamp DESC, m.id DESC
+		LIMIT $3`, viewer, other, limit)
+	if err != nil {
+		return nil, err
+	}
+
+	for i, j := 0, len(messages)-1; i < j; i, j = i+1, j-1 {
+		messages[i], messages[j] = messages[j], messages[i]
+	}
+	return messages, nil
+}
+
+func (s *Store) MessagesBefore(ctx context.Context, viewer, other, before string, limit int) ([]store.Message, error) {
+	var cursor interface{}
+	if before != "" {
+		cursor = before
+	}
+
+	// Messages are ordered by (timestamp, id) so messages sent in the same
+	// instant page consistently.
+	messages, err := s.readMessages(ctx, `
+		SELECT `+messageColumns+`
+		`+messageFrom+`
+		WHERE ((m.sender = $1 AND m.receiver = $2) OR (m.sender = $2 AND m.receiver = $1))
+		AND `+notDeletedFor+`
+		AND ($3::int IS NULL OR (m.timestamp, m.id) < (SELECT c.timestamp, c.id FROM messages c WHERE c.id = $3::int))
+		ORDER BY m.timestamp DESC, m.id DESC
+		LIMIT $4`, viewer, other, cursor, limit)
+	if err != nil {
+		return nil, err
+	}
+
+	for i, j := 0, len(messages)-1; i < j; i, j = i+1, j-1 {
+		messages[i], messages[j] = messages[j], messages[i]
+	}
+	return messages, nil
+}
+
+func (s *Store) MessagesAfter(ctx context.Context, username string, afterID, limit int) ([]store.Message, error) {
+	return s.queryMessages(ctx, `
+		SELECT `+messageColumns+`
+		`+messageFrom+`
+		WHERE (m.sender = $1 OR m.receiver = $1)
+		AND m.id > $2
+		AND `+notDeletedFor+`
+		ORDER BY m.id
+		LIMIT $3`, username, afterID, limit)
+}
+
+func (s *Store) MessagesAfterSeq(ctx context.Context, viewer, other string, afterSeq int64, limit int) ([]store.Message, error) {
+	// Catching up must not miss what a replica has yet to receive, so it
+	// reads from the primary.
+	return s.queryMessages(ctx, `
+		SELECT `+messageColumns+`
+		`+messageFrom+`
+		WHERE ((m.sender = $1 AND m.receiver = $2) OR (m.sender = $2 AND m.receiver = $1))
+		AND m.seq > $3
+		AND `+notDeletedFor+`
+		ORDER BY m.seq
+		LIMIT $4`, viewer, other, afterSeq, limit)
+}
+
+func (s *Store) MessagesByID(ctx context.Context, viewer string, ids []string) ([]store.Message, error) {
+	return s.queryMessages(ctx, `
+		SELECT `+messageColumns+`
+		`+messageFrom+`
+		WHERE m.id = ANY($2::int[]) AND (m.sender = $1 OR m.receiver = $1)
+		AND `+notDeletedFor, viewer, pq.Array(ids))
+}
+
+func (s *Store) Undelivered(ctx context.Context, receiver string, afterID, limit int) ([]store.Message, error) {
+	return s.queryMessages(ctx, `
+		SELECT `+messageColumns+`
+		`+messageFrom+`
+		WHERE m.receiver = $1 AND ms.status = 'sent' AND m.deleted_at IS NULL AND m.id > $2
+		AND `+notDeletedFor+`
+		ORDER BY m.id
+		LIMIT $3`, receiver, afterID, limit)
+}
+
+func (s *Store) Thread(ctx context.Context, messageID, viewer string) (string, []store.Message, error) {
+	var rootID string
+	err := s.db.QueryRowContext(ctx, `
+		WITH RECURSIVE ancestors AS (
+			SELECT id, reply_to_id FROM messages
+			WHERE id = $1 AND (sender = $2 OR receiver = $2)
+			UNION ALL
+			SELECT m.id, m.reply_to_id FROM messages m
+			JOIN ancestors a ON m.id = a.reply_to_id
+		)
+		SELECT id FROM ancestors WHERE reply_to_id IS NULL`, messageID, viewer).Scan(&rootID)
+	if err != nil {
+		return "", nil, notFound(err)
+	}
+
+	messages, err := s.queryMessages(ctx, `
+		WITH RECURSIVE thread AS (
+			SELECT id FROM messages WHERE id = $2
+			UNION ALL
+			SELECT m.id FROM messages m
+			JOIN thread t ON m.reply_to_id = t.id
+		)
+		SELECT `+messageColumns+`
+		`+messageFrom+`
+		JOIN thread t ON t.id = m.id
+		WHERE `+notDeletedFor+`
+		ORDER BY m.timestamp`, viewer, rootID)
+	return rootID, messages, err
+}
+
+func (s *Store) Search(ctx context.Context, viewer, query string, limit, offset int) ([]store.SearchResult, error) {
+	rows, err := s.reader().QueryContext(ctx, `
+		SELECT `+messageColumns+`,
+			ts_headline('english', m.content, q, 'StartSel=<mark>, StopSel=</mark>, MaxFragments=2')
+		`+messageFrom+`, websearch_to_tsquery('english', $2) q
+		WHERE (m.sender = $1 OR m.receiver = $1)
+		AND m.deleted_at IS NULL
+		AND m.content_tsv @@ q
+		AND `+notDeletedFor+`
+		ORDER BY ts_rank(m.content_tsv, q) DESC, m.timestamp DESC
+		LIMIT $3 OFFSET $4`, viewer, query, limit, offset)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	results := []store.SearchResult{}
+	for rows.Next() {
+		var r store.SearchResult
+		var err error
+		r.Message, err = scanMessage(rows, &r.Highlight)
+		if err != nil {
+			return nil, err
+		}
+		results = append(results, r)
+	}
+	return results, rows.Err()
+}
+
+func (s *Store) ReplyPreview(ctx context.Context, replyToID, sender, receiver string) (*store.ReplyPreview, error) {
+	var parentSender, content string
+	var deleted bool
+	err := s.db.QueryRowContext(ctx, `
+		SELECT sender, CASE WHEN deleted_at IS NULL THEN content ELSE '' END, deleted_at IS NOT NULL
+		FROM messages
+		WHERE id = $1 AND kind = 'user' AND ((sender = $2 AND receiver = $3) OR (sender = $3 AND receiver = $2))`,
+		replyToID, sender, receiver).Scan(&parentSender, &content, &deleted)
+	if err == sql.ErrNoRows {
+		return nil, store.ErrInvalidReplyTo
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return store.NewReplyPreview(replyToID, parentSender, content, deleted), nil
+}
+
+func (s *Store) Participants(ctx context.Context, id string) (string, string, error) {
+	var sender, receiver string
+	err := s.db.QueryRowContext(ctx, "SELECT sender, receiver FROM messages WHERE id = $1", id).Scan(&sender, &receiver)
+	return sender, receiver, notFound(err)
+}
+
+func (s *Store) DeleteForUser(ctx context.Context, id, username string) error {
+	_, err := s.db.ExecContext(ctx,
+		"INSERT INTO message_deletions (username, message_id) VALUES ($1, $2) ON CONFLICT DO NOTHING",
+		username, id,
+	)
+	return err
+}
+
+func (s *Store) DeleteForEveryone(ctx context.Context, id string) error {
+	_, err := s.db.ExecContext(ctx, "UPDATE messages SET deleted_at = CURRENT_TIMESTAMP, updated_at = CURRENT_TIMESTAMP WHERE id = $1 AND deleted_at IS NULL", id)
+	return err
+}
+
+func (s *Store) MarkDelivered(ctx context.Context, id, receiver string) (bool, error) {
+	res, err := s.db.ExecContext(ctx, `
+		UPDATE message_status ms
+		SET status = 'delivered', delivered_at = CURRENT_TIMESTAMP
+		FROM messages m
+		WHERE ms.message_id = m.id AND m.id = $1 AND m.receiver = $2 AND ms.status = 'sent'`,
+		id, receiver)
+	if err != nil {
+		return false, err
+	}
+
+	n, _ := res.RowsAffected()
+	return n > 0, nil
+}
+
+func (s *Store) MarkReadUpTo(ctx context.Context, id, receiver string) ([]string, error) {
+	var sender string
+	err := s.db.QueryRowContext(ctx, "SELECT sender FROM messages WHERE id = $1 AND receiver = $2", id, receiver).Scan(&sender)
+	if err != nil {
+		return nil, notFound(err)
+	}
+
+	rows, err := s.db.QueryContext(ctx, `
+		UPDATE message_status ms
+		SET status = 'read',
+			delivered_at = COALESCE(ms.delivered_at, CURRENT_TIMESTAMP),
+			read_at = CURRENT_TIMESTAMP
+		FROM messages m
+		WHERE ms.message_id = m.id AND m.sender = $1 AND m.receiver = $2 AND m.id <= $3 AND ms.status != 'read'
+		RETURNING m.id`, sender, receiver, id)
+	if err != nil {
+		return nil, err
+	}
+	return scanStrings(rows)
+}
+
+func (s *Store) MarkConversationReadUpTo(ctx context.Context, reader, peer, id string) ([]string, error) {
+	var found int
+	err := s.db.QueryRowContext(ctx, `
+		SELECT 1 FROM messages
+		WHERE id = $1 AND ((sender = $2 AND receiver = $3) OR (sender = $3 AND receiver = $2))`,
+		id, reader, peer).Scan(&found)
+	if err != nil {
+		return nil, notFound(err)
+	}
+
+	rows, err := s.db.QueryContext(ctx, `
+		UPDATE message_status ms
+		SET status = 'read',
+			delivered_at = COALESCE(ms.delivered_at, CURRENT_TIMESTAMP),
+			read_at = CURRENT_TIMESTAMP
+		FROM messages m
+		WHERE ms.message_id = m.id AND m.sender = $1 AND m.receiver = $2 AND m.id <= $3 AND ms.status != 'read'
+		RETURNING m.id`, peer, reader, id)
+	if err != nil {
+		return nil, err
+	}
+	return scanStrings(rows)
+}
@@ -1,4 +1,4 @@
-CREATE TABLE messages (
+CREATE TABLE IF NOT EXISTS messages (
     id SERIAL PRIMARY KEY,
     sender VARCHAR(255) NOT NULL,
     receiver VARCHAR(255) NOT NULL,
@@ -6,4 +6,4 @@ CREATE TABLE messages (
     timestamp TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
     upvotes INTEGER DEFAULT 0,
     downvotes INTEGER DEFAULT 0
-);
\ No newline at end of file
+);
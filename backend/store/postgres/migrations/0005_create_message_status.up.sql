@@ -0,0 +1,6 @@
+CREATE TABLE IF NOT EXISTS message_status (
+    message_id INTEGER PRIMARY KEY REFERENCES messages(id) ON DELETE CASCADE,
+    status VARCHAR(20) NOT NULL DEFAULT 'sent', -- 'sent', 'delivered' or 'read'
+    delivered_at TIMESTAMP,
+    read_at TIMESTAMP
+);
@@ -0,0 +1,6 @@
+CREATE TABLE IF NOT EXISTS message_deletions (
+    username VARCHAR(50) NOT NULL,
+    message_id INTEGER NOT NULL REFERENCES messages(id) ON DELETE CASCADE,
+    deleted_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (username, message_id)
+);
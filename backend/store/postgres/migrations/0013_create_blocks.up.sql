@@ -0,0 +1,6 @@
+CREATE TABLE IF NOT EXISTS blocks (
+    blocker VARCHAR(50) NOT NULL,
+    blocked VARCHAR(50) NOT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (blocker, blocked)
+);
@@ -0,0 +1,8 @@
+CREATE TABLE IF NOT EXISTS device_tokens (
+    id SERIAL PRIMARY KEY,
+    username VARCHAR(50) NOT NULL,
+    platform VARCHAR(10) NOT NULL,
+    token TEXT NOT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE (platform, token)
+);
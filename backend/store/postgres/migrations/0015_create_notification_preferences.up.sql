@@ -0,0 +1,5 @@
+CREATE TABLE IF NOT EXISTS notification_preferences (
+    username VARCHAR(50) PRIMARY KEY,
+    push_enabled BOOLEAN NOT NULL DEFAULT TRUE,
+    show_preview BOOLEAN NOT NULL DEFAULT TRUE
+);
@@ -0,0 +1,5 @@
+ALTER TABLE messages ADD COLUMN IF NOT EXISTS updated_at TIMESTAMP;
+UPDATE messages SET updated_at = COALESCE(timestamp, CURRENT_TIMESTAMP) WHERE updated_at IS NULL;
+UPDATE messages SET timestamp = updated_at WHERE timestamp IS NULL;
+ALTER TABLE messages ALTER COLUMN updated_at SET DEFAULT CURRENT_TIMESTAMP;
+ALTER TABLE messages ALTER COLUMN updated_at SET NOT NULL;
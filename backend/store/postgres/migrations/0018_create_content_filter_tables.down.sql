@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS message_flags;
+DROP TABLE IF EXISTS conversation_filters;
@@ -0,0 +1,16 @@
+CREATE TABLE IF NOT EXISTS conversation_filters (
+    username VARCHAR(255) NOT NULL,
+    peer VARCHAR(255) NOT NULL,
+    strictness VARCHAR(10) NOT NULL,
+    PRIMARY KEY (username, peer)
+);
+
+CREATE TABLE IF NOT EXISTS message_flags (
+    id SERIAL PRIMARY KEY,
+    message_id INTEGER REFERENCES messages(id) ON DELETE CASCADE,
+    sender VARCHAR(255) NOT NULL,
+    receiver VARCHAR(255) NOT NULL,
+    content TEXT NOT NULL,
+    reason TEXT NOT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
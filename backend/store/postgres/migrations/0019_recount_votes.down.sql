@@ -0,0 +1,2 @@
+-- Recounted totals are correct; there is nothing to undo.
+SELECT 1;
@@ -0,0 +1,3 @@
+UPDATE messages m SET
+    upvotes = (SELECT COUNT(*) FROM user_votes v WHERE v.message_id = m.id::text AND v.vote_type = 'upvote'),
+    downvotes = (SELECT COUNT(*) FROM user_votes v WHERE v.message_id = m.id::text AND v.vote_type = 'downvote');
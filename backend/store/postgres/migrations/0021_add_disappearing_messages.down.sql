@@ -0,0 +1,3 @@
+DROP TABLE IF EXISTS disappearing_messages;
+DROP INDEX IF EXISTS idx_messages_expires_at;
+ALTER TABLE messages DROP COLUMN IF EXISTS expires_at;
@@ -0,0 +1,9 @@
+ALTER TABLE messages ADD COLUMN IF NOT EXISTS expires_at TIMESTAMP;
+CREATE INDEX IF NOT EXISTS idx_messages_expires_at ON messages (expires_at) WHERE expires_at IS NOT NULL;
+
+CREATE TABLE IF NOT EXISTS disappearing_messages (
+    username VARCHAR(255) NOT NULL,
+    peer VARCHAR(255) NOT NULL,
+    ttl_seconds INTEGER NOT NULL,
+    PRIMARY KEY (username, peer)
+);
@@ -0,0 +1,8 @@
+CREATE TABLE IF NOT EXISTS mentions (
+    message_id INTEGER NOT NULL REFERENCES messages(id) ON DELETE CASCADE,
+    username VARCHAR(255) NOT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (message_id, username)
+);
+
+CREATE INDEX IF NOT EXISTS idx_mentions_username ON mentions (username, created_at DESC);
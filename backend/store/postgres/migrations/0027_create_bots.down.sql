@@ -0,0 +1,3 @@
+ALTER TABLE webhooks DROP COLUMN IF EXISTS bot;
+DROP TABLE IF EXISTS bot_commands;
+DROP TABLE IF EXISTS bots;
@@ -0,0 +1,17 @@
+CREATE TABLE IF NOT EXISTS bots (
+    username VARCHAR(50) PRIMARY KEY,
+    token_hash VARCHAR(64) UNIQUE NOT NULL,
+    created_by VARCHAR(50) NOT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE IF NOT EXISTS bot_commands (
+    name VARCHAR(32) PRIMARY KEY,
+    bot VARCHAR(50) NOT NULL,
+    description VARCHAR(200) NOT NULL DEFAULT '',
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_bot_commands_bot ON bot_commands (bot);
+
+ALTER TABLE webhooks ADD COLUMN IF NOT EXISTS bot VARCHAR(50);
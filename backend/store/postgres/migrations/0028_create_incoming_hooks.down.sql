@@ -0,0 +1 @@
+DROP TABLE IF EXISTS incoming_hooks;
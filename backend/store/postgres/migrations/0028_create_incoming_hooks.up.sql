@@ -0,0 +1,10 @@
+CREATE TABLE IF NOT EXISTS incoming_hooks (
+    id SERIAL PRIMARY KEY,
+    name VARCHAR(100) NOT NULL,
+    token_hash VARCHAR(64) UNIQUE NOT NULL,
+    bot VARCHAR(50) NOT NULL,
+    receiver VARCHAR(50) NOT NULL,
+    created_by VARCHAR(50) NOT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    last_used_at TIMESTAMP
+);
@@ -0,0 +1,6 @@
+DROP TABLE IF EXISTS conversation_mutes;
+
+ALTER TABLE notification_preferences
+    DROP COLUMN IF EXISTS quiet_hours_start,
+    DROP COLUMN IF EXISTS quiet_hours_end,
+    DROP COLUMN IF EXISTS quiet_hours_time_zone;
@@ -0,0 +1,11 @@
+ALTER TABLE notification_preferences
+    ADD COLUMN IF NOT EXISTS quiet_hours_start VARCHAR(5),
+    ADD COLUMN IF NOT EXISTS quiet_hours_end VARCHAR(5),
+    ADD COLUMN IF NOT EXISTS quiet_hours_time_zone VARCHAR(64);
+
+CREATE TABLE IF NOT EXISTS conversation_mutes (
+    username VARCHAR(255) NOT NULL,
+    peer VARCHAR(255) NOT NULL,
+    muted_until TIMESTAMP,
+    PRIMARY KEY (username, peer)
+);
@@ -0,0 +1,8 @@
+CREATE TABLE IF NOT EXISTS user_statuses (
+    username VARCHAR(255) PRIMARY KEY,
+    availability VARCHAR(16) NOT NULL DEFAULT 'available',
+    text VARCHAR(100) NOT NULL DEFAULT '',
+    emoji VARCHAR(32) NOT NULL DEFAULT '',
+    expires_at TIMESTAMP,
+    updated_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
@@ -0,0 +1,2 @@
+ALTER TABLE messages ADD COLUMN IF NOT EXISTS kind VARCHAR(16) NOT NULL DEFAULT 'user';
+ALTER TABLE messages ADD COLUMN IF NOT EXISTS system_event JSONB;
@@ -0,0 +1,4 @@
+DROP TABLE IF EXISTS channel_posts;
+DROP TABLE IF EXISTS channel_subscriptions;
+DROP TABLE IF EXISTS channel_senders;
+DROP TABLE IF EXISTS channels;
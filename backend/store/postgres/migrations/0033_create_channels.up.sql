@@ -0,0 +1,33 @@
+CREATE TABLE IF NOT EXISTS channels (
+    id SERIAL PRIMARY KEY,
+    name VARCHAR(64) UNIQUE NOT NULL,
+    description VARCHAR(500) NOT NULL DEFAULT '',
+    created_by VARCHAR(50) NOT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE IF NOT EXISTS channel_senders (
+    channel_id INTEGER NOT NULL REFERENCES channels(id) ON DELETE CASCADE,
+    username VARCHAR(50) NOT NULL,
+    PRIMARY KEY (channel_id, username)
+);
+
+CREATE TABLE IF NOT EXISTS channel_subscriptions (
+    channel_id INTEGER NOT NULL REFERENCES channels(id) ON DELETE CASCADE,
+    username VARCHAR(50) NOT NULL,
+    subscribed_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (channel_id, username)
+);
+
+CREATE INDEX IF NOT EXISTS idx_channel_subscriptions_username ON channel_subscriptions (username);
+
+-- A post is stored once, however many subscribers its channel has.
+CREATE TABLE IF NOT EXISTS channel_posts (
+    id BIGSERIAL PRIMARY KEY,
+    channel_id INTEGER NOT NULL REFERENCES channels(id) ON DELETE CASCADE,
+    sender VARCHAR(50) NOT NULL,
+    content TEXT NOT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_channel_posts_channel ON channel_posts (channel_id, id);
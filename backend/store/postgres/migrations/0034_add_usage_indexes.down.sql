@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS idx_attachments_uploader;
+DROP INDEX IF EXISTS idx_messages_sender_timestamp;
@@ -0,0 +1,4 @@
+-- Quotas count the messages a user sent recently and the attachments they
+-- uploaded on every send.
+CREATE INDEX IF NOT EXISTS idx_messages_sender_timestamp ON messages (sender, timestamp);
+CREATE INDEX IF NOT EXISTS idx_attachments_uploader ON attachments (uploader);
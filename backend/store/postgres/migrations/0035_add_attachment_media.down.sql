@@ -0,0 +1,6 @@
+DROP TABLE IF EXISTS attachment_variants;
+DROP INDEX IF EXISTS idx_attachments_media_pending;
+ALTER TABLE attachments DROP COLUMN IF EXISTS media_claimed_until;
+ALTER TABLE attachments DROP COLUMN IF EXISTS height;
+ALTER TABLE attachments DROP COLUMN IF EXISTS width;
+ALTER TABLE attachments DROP COLUMN IF EXISTS media_status;
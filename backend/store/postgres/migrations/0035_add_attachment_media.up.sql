@@ -0,0 +1,23 @@
+-- Images are processed after upload. media_status is NULL for files that
+-- are not processed, and pending, ready or failed for images.
+ALTER TABLE attachments ADD COLUMN IF NOT EXISTS media_status VARCHAR(16);
+ALTER TABLE attachments ADD COLUMN IF NOT EXISTS width INTEGER;
+ALTER TABLE attachments ADD COLUMN IF NOT EXISTS height INTEGER;
+ALTER TABLE attachments ADD COLUMN IF NOT EXISTS media_claimed_until TIMESTAMP;
+
+-- Images uploaded before processing existed are queued too.
+UPDATE attachments SET media_status = 'pending'
+WHERE media_status IS NULL AND content_type IN ('image/jpeg', 'image/png', 'image/gif');
+
+CREATE INDEX IF NOT EXISTS idx_attachments_media_pending ON attachments (id) WHERE media_status = 'pending';
+
+CREATE TABLE IF NOT EXISTS attachment_variants (
+    attachment_id INTEGER NOT NULL REFERENCES attachments(id) ON DELETE CASCADE,
+    variant VARCHAR(32) NOT NULL,
+    content_type VARCHAR(100) NOT NULL,
+    width INTEGER NOT NULL,
+    height INTEGER NOT NULL,
+    size BIGINT NOT NULL,
+    storage_path VARCHAR(255) NOT NULL,
+    PRIMARY KEY (attachment_id, variant)
+);
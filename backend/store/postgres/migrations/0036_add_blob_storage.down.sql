@@ -0,0 +1,7 @@
+DROP TABLE IF EXISTS pending_uploads;
+
+-- Paths are restored relative to the default upload directory.
+UPDATE attachment_variants SET storage_key = 'uploads/' || storage_key;
+ALTER TABLE attachment_variants RENAME COLUMN storage_key TO storage_path;
+UPDATE attachments SET storage_key = 'uploads/' || storage_key;
+ALTER TABLE attachments RENAME COLUMN storage_key TO storage_path;
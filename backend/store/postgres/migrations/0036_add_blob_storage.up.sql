@@ -0,0 +1,21 @@
+-- Files are stored under keys in a blob store, a directory or an S3 bucket,
+-- instead of at paths on local disk. Files uploaded so far are in the upload
+-- directory, so their key is their file name.
+ALTER TABLE attachments RENAME COLUMN storage_path TO storage_key;
+UPDATE attachments SET storage_key = regexp_replace(storage_key, '^.*/', '');
+ALTER TABLE attachment_variants RENAME COLUMN storage_path TO storage_key;
+UPDATE attachment_variants SET storage_key = regexp_replace(storage_key, '^.*/', '');
+
+-- Files clients upload straight to the blob store wait here until they are
+-- sent, or are deleted once they expire.
+CREATE TABLE IF NOT EXISTS pending_uploads (
+    storage_key VARCHAR(255) PRIMARY KEY,
+    uploader VARCHAR(50) NOT NULL,
+    filename VARCHAR(255) NOT NULL,
+    content_type VARCHAR(100) NOT NULL,
+    size BIGINT NOT NULL,
+    expires_at TIMESTAMP NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_pending_uploads_expires_at ON pending_uploads (expires_at);
+CREATE INDEX IF NOT EXISTS idx_pending_uploads_uploader ON pending_uploads (uploader);
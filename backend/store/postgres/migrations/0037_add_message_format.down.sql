@@ -0,0 +1,2 @@
+ALTER TABLE scheduled_messages DROP COLUMN IF EXISTS format;
+ALTER TABLE messages DROP COLUMN IF EXISTS format;
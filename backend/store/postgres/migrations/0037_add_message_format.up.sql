@@ -0,0 +1,3 @@
+-- format is the markup content is written in, plain or markdown.
+ALTER TABLE messages ADD COLUMN IF NOT EXISTS format VARCHAR(16) NOT NULL DEFAULT 'plain';
+ALTER TABLE scheduled_messages ADD COLUMN IF NOT EXISTS format VARCHAR(16) NOT NULL DEFAULT 'plain';
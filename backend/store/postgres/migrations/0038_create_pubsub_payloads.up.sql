@@ -0,0 +1,9 @@
+-- Payloads published through Postgres that are too large for NOTIFY. They
+-- are kept briefly, for the listeners to fetch.
+CREATE TABLE IF NOT EXISTS pubsub_payloads (
+    id BIGSERIAL PRIMARY KEY,
+    payload TEXT NOT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_pubsub_payloads_created_at ON pubsub_payloads (created_at);
@@ -0,0 +1,58 @@
+-- Back to one table, copying the messages of every partition, archived
+-- ones excepted, and restoring the foreign keys. Rows left behind by
+-- messages already gone are removed first.
+DROP TRIGGER IF EXISTS messages_delete_dependents ON messages;
+DROP FUNCTION IF EXISTS messages_delete_dependents();
+
+CREATE TABLE messages_unpartitioned (
+    id INTEGER PRIMARY KEY DEFAULT nextval('messages_id_seq'),
+    sender VARCHAR(255) NOT NULL,
+    receiver VARCHAR(255) NOT NULL,
+    content TEXT NOT NULL,
+    timestamp TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    upvotes INTEGER DEFAULT 0,
+    downvotes INTEGER DEFAULT 0,
+    deleted_at TIMESTAMP,
+    content_tsv tsvector GENERATED ALWAYS AS (to_tsvector('english', content)) STORED,
+    reply_to_id INTEGER,
+    updated_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    expires_at TIMESTAMP,
+    kind VARCHAR(16) NOT NULL DEFAULT 'user',
+    system_event JSONB,
+    format VARCHAR(16) NOT NULL DEFAULT 'plain'
+);
+
+INSERT INTO messages_unpartitioned (id, sender, receiver, content, timestamp, upvotes, downvotes, deleted_at,
+    reply_to_id, updated_at, expires_at, kind, system_event, format)
+SELECT id, sender, receiver, content, timestamp, upvotes, downvotes, deleted_at,
+    reply_to_id, updated_at, expires_at, kind, system_event, format
+FROM messages;
+
+ALTER SEQUENCE messages_id_seq OWNED BY NONE;
+DROP TABLE messages;
+ALTER TABLE messages_unpartitioned RENAME TO messages;
+ALTER INDEX messages_unpartitioned_pkey RENAME TO messages_pkey;
+ALTER SEQUENCE messages_id_seq OWNED BY messages.id;
+
+CREATE INDEX IF NOT EXISTS idx_messages_content_tsv ON messages USING GIN (content_tsv);
+CREATE INDEX IF NOT EXISTS idx_messages_reply_to_id ON messages (reply_to_id);
+CREATE INDEX IF NOT EXISTS idx_messages_expires_at ON messages (expires_at) WHERE expires_at IS NOT NULL;
+CREATE INDEX IF NOT EXISTS idx_messages_sender_timestamp ON messages (sender, timestamp);
+
+UPDATE messages SET reply_to_id = NULL WHERE reply_to_id NOT IN (SELECT id FROM messages);
+UPDATE scheduled_messages SET reply_to_id = NULL WHERE reply_to_id NOT IN (SELECT id FROM messages);
+DELETE FROM message_status WHERE message_id NOT IN (SELECT id FROM messages);
+DELETE FROM message_deletions WHERE message_id NOT IN (SELECT id FROM messages);
+DELETE FROM attachments WHERE message_id NOT IN (SELECT id FROM messages);
+DELETE FROM message_flags WHERE message_id NOT IN (SELECT id FROM messages);
+DELETE FROM pinned_messages WHERE message_id NOT IN (SELECT id FROM messages);
+DELETE FROM mentions WHERE message_id NOT IN (SELECT id FROM messages);
+
+ALTER TABLE messages ADD CONSTRAINT messages_reply_to_id_fkey FOREIGN KEY (reply_to_id) REFERENCES messages(id) ON DELETE SET NULL;
+ALTER TABLE message_status ADD CONSTRAINT message_status_message_id_fkey FOREIGN KEY (message_id) REFERENCES messages(id) ON DELETE CASCADE;
+ALTER TABLE message_deletions ADD CONSTRAINT message_deletions_message_id_fkey FOREIGN KEY (message_id) REFERENCES messages(id) ON DELETE CASCADE;
+ALTER TABLE attachments ADD CONSTRAINT attachments_message_id_fkey FOREIGN KEY (message_id) REFERENCES messages(id) ON DELETE CASCADE;
+ALTER TABLE message_flags ADD CONSTRAINT message_flags_message_id_fkey FOREIGN KEY (message_id) REFERENCES messages(id) ON DELETE CASCADE;
+ALTER TABLE scheduled_messages ADD CONSTRAINT scheduled_messages_reply_to_id_fkey FOREIGN KEY (reply_to_id) REFERENCES messages(id) ON DELETE SET NULL;
+ALTER TABLE pinned_messages ADD CONSTRAINT pinned_messages_message_id_fkey FOREIGN KEY (message_id) REFERENCES messages(id) ON DELETE CASCADE;
+ALTER TABLE mentions ADD CONSTRAINT mentions_message_id_fkey FOREIGN KEY (message_id) REFERENCES messages(id) ON DELETE CASCADE;
@@ -0,0 +1,87 @@
+-- messages becomes a table partitioned by month of timestamp, so history
+-- queries only touch the months they need and old months can be dropped
+-- whole. Partitions are named messages_pYYYYMM; rows outside every month
+-- land in messages_default. The retention job creates the coming months.
+--
+-- A partitioned table's primary key must include the partition key, so
+-- other tables can no longer reference messages(id) with a foreign key. The
+-- trigger at the end does what their ON DELETE actions did.
+ALTER TABLE message_status DROP CONSTRAINT IF EXISTS message_status_message_id_fkey;
+ALTER TABLE message_deletions DROP CONSTRAINT IF EXISTS message_deletions_message_id_fkey;
+ALTER TABLE attachments DROP CONSTRAINT IF EXISTS attachments_message_id_fkey;
+ALTER TABLE message_flags DROP CONSTRAINT IF EXISTS message_flags_message_id_fkey;
+ALTER TABLE scheduled_messages DROP CONSTRAINT IF EXISTS scheduled_messages_reply_to_id_fkey;
+ALTER TABLE pinned_messages DROP CONSTRAINT IF EXISTS pinned_messages_message_id_fkey;
+ALTER TABLE mentions DROP CONSTRAINT IF EXISTS mentions_message_id_fkey;
+
+CREATE TABLE messages_partitioned (
+    id INTEGER NOT NULL DEFAULT nextval('messages_id_seq'),
+    sender VARCHAR(255) NOT NULL,
+    receiver VARCHAR(255) NOT NULL,
+    content TEXT NOT NULL,
+    timestamp TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    upvotes INTEGER DEFAULT 0,
+    downvotes INTEGER DEFAULT 0,
+    deleted_at TIMESTAMP,
+    content_tsv tsvector GENERATED ALWAYS AS (to_tsvector('english', content)) STORED,
+    reply_to_id INTEGER,
+    updated_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    expires_at TIMESTAMP,
+    kind VARCHAR(16) NOT NULL DEFAULT 'user',
+    system_event JSONB,
+    format VARCHAR(16) NOT NULL DEFAULT 'plain',
+    PRIMARY KEY (id, timestamp)
+) PARTITION BY RANGE (timestamp);
+
+CREATE TABLE messages_default PARTITION OF messages_partitioned DEFAULT;
+
+-- One partition for every month that has messages, through next month.
+DO $$
+DECLARE
+    month TIMESTAMP;
+BEGIN
+    SELECT date_trunc('month', COALESCE(MIN(timestamp), CURRENT_TIMESTAMP::timestamp)) INTO month FROM messages;
+    WHILE month <= date_trunc('month', CURRENT_TIMESTAMP::timestamp) + INTERVAL '1 month' LOOP
+        EXECUTE format('CREATE TABLE %I PARTITION OF messages_partitioned FOR VALUES FROM (%L) TO (%L)',
+            'messages_p' || to_char(month, 'YYYYMM'), month, month + INTERVAL '1 month');
+        month := month + INTERVAL '1 month';
+    END LOOP;
+END;
+$$;
+
+INSERT INTO messages_partitioned (id, sender, receiver, content, timestamp, upvotes, downvotes, deleted_at,
+    reply_to_id, updated_at, expires_at, kind, system_event, format)
+SELECT id, sender, receiver, content, COALESCE(timestamp, updated_at), upvotes, downvotes, deleted_at,
+    reply_to_id, updated_at, expires_at, kind, system_event, format
+FROM messages;
+
+ALTER SEQUENCE messages_id_seq OWNED BY NONE;
+DROP TABLE messages;
+ALTER TABLE messages_partitioned RENAME TO messages;
+ALTER INDEX messages_partitioned_pkey RENAME TO messages_pkey;
+ALTER SEQUENCE messages_id_seq OWNED BY messages.id;
+
+CREATE INDEX IF NOT EXISTS idx_messages_content_tsv ON messages USING GIN (content_tsv);
+CREATE INDEX IF NOT EXISTS idx_messages_reply_to_id ON messages (reply_to_id);
+CREATE INDEX IF NOT EXISTS idx_messages_expires_at ON messages (expires_at) WHERE expires_at IS NOT NULL;
+CREATE INDEX IF NOT EXISTS idx_messages_sender_timestamp ON messages (sender, timestamp);
+
+-- Deleting a message deletes what belongs to it and clears replies to it,
+-- as the foreign keys did. Dropping a partition does not run it; the
+-- retention job cleans up first.
+CREATE OR REPLACE FUNCTION messages_delete_dependents() RETURNS trigger AS $$
+BEGIN
+    DELETE FROM message_status WHERE message_id = OLD.id;
+    DELETE FROM message_deletions WHERE message_id = OLD.id;
+    DELETE FROM attachments WHERE message_id = OLD.id;
+    DELETE FROM message_flags WHERE message_id = OLD.id;
+    DELETE FROM pinned_messages WHERE message_id = OLD.id;
+    DELETE FROM mentions WHERE message_id = OLD.id;
+    UPDATE messages SET reply_to_id = NULL WHERE reply_to_id = OLD.id;
+    UPDATE scheduled_messages SET reply_to_id = NULL WHERE reply_to_id = OLD.id;
+    RETURN OLD;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER messages_delete_dependents AFTER DELETE ON messages
+    FOR EACH ROW EXECUTE FUNCTION messages_delete_dependents();
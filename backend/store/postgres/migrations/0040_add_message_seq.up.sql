@@ -0,0 +1,31 @@
+-- seq numbers the messages of each conversation from 1 in the order they
+-- were sent, so clients can spot the ones they missed. conversation_seqs
+-- holds the last number handed out per conversation, keyed by its two
+-- participants sorted byte by byte, and outlives the messages themselves
+-- so numbers are never reused after retention removes old ones.
+CREATE TABLE IF NOT EXISTS conversation_seqs (
+    user_a VARCHAR(255) NOT NULL,
+    user_b VARCHAR(255) NOT NULL,
+    last_seq BIGINT NOT NULL,
+    PRIMARY KEY (user_a, user_b)
+);
+
+ALTER TABLE messages ADD COLUMN IF NOT EXISTS seq BIGINT;
+
+UPDATE messages m SET seq = n.seq
+FROM (
+    SELECT id, timestamp, row_number() OVER (
+        PARTITION BY LEAST(sender COLLATE "C", receiver COLLATE "C"), GREATEST(sender COLLATE "C", receiver COLLATE "C")
+        ORDER BY id) AS seq
+    FROM messages
+) n
+WHERE m.id = n.id AND m.timestamp = n.timestamp;
+
+INSERT INTO conversation_seqs (user_a, user_b, last_seq)
+SELECT LEAST(sender COLLATE "C", receiver COLLATE "C"), GREATEST(sender COLLATE "C", receiver COLLATE "C"), MAX(seq)
+FROM messages
+GROUP BY 1, 2;
+
+ALTER TABLE messages ALTER COLUMN seq SET NOT NULL;
+
+CREATE INDEX IF NOT EXISTS idx_messages_conversation_seq ON messages (sender, receiver, seq);
@@ -0,0 +1,4 @@
+ALTER TABLE channel_posts DROP COLUMN IF EXISTS shadowed;
+ALTER TABLE messages DROP COLUMN IF EXISTS shadowed;
+DROP TABLE IF EXISTS channel_shadow_mutes;
+DROP TABLE IF EXISTS shadow_mutes;
@@ -0,0 +1,22 @@
+-- A shadow-muted user's messages are stored and shown to them, but hidden
+-- from everyone else. shadow_mutes holds global mutes, which cover direct
+-- messages and every channel; channel_shadow_mutes those of one channel.
+CREATE TABLE IF NOT EXISTS shadow_mutes (
+    username VARCHAR(50) PRIMARY KEY,
+    muted_by VARCHAR(50) NOT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE IF NOT EXISTS channel_shadow_mutes (
+    channel_id INTEGER NOT NULL REFERENCES channels(id) ON DELETE CASCADE,
+    username VARCHAR(50) NOT NULL,
+    muted_by VARCHAR(50) NOT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (channel_id, username)
+);
+
+CREATE INDEX IF NOT EXISTS idx_channel_shadow_mutes_username ON channel_shadow_mutes (username);
+
+-- Messages and posts sent while muted stay shadowed after the mute is lifted.
+ALTER TABLE messages ADD COLUMN IF NOT EXISTS shadowed BOOLEAN NOT NULL DEFAULT FALSE;
+ALTER TABLE channel_posts ADD COLUMN IF NOT EXISTS shadowed BOOLEAN NOT NULL DEFAULT FALSE;
@@ -0,0 +1,10 @@
+-- Usernames are unique ignoring case and Unicode presentation. The server
+-- fills in the normalized form; LOWER is its equivalent for the names that
+-- already exist. Where several differ only in case, the oldest account
+-- keeps the normalized form and the others go without one.
+ALTER TABLE users ADD COLUMN IF NOT EXISTS username_normalized TEXT;
+
+UPDATE users u SET username_normalized = LOWER(u.username)
+WHERE NOT EXISTS (SELECT 1 FROM users o WHERE LOWER(o.username) = LOWER(u.username) AND o.id < u.id);
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_users_username_normalized ON users (username_normalized);
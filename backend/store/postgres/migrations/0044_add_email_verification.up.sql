@@ -0,0 +1,3 @@
+-- An email is unverified until its owner follows the link sent to it,
+-- including emails given before verification existed.
+ALTER TABLE users ADD COLUMN IF NOT EXISTS email_verified_at TIMESTAMP;
@@ -0,0 +1,5 @@
+-- Passwords hashed before the algorithm was recorded are bcrypt hashes.
+-- Argon2id hashes in PHC string format are longer than bcrypt's 60
+-- characters.
+ALTER TABLE users ADD COLUMN IF NOT EXISTS password_algo VARCHAR(20) NOT NULL DEFAULT 'bcrypt';
+ALTER TABLE users ALTER COLUMN password TYPE VARCHAR(255);
@@ -0,0 +1,4 @@
+DROP INDEX IF EXISTS idx_sessions_username;
+ALTER TABLE sessions DROP COLUMN IF EXISTS last_active_at;
+ALTER TABLE sessions DROP COLUMN IF EXISTS ip;
+ALTER TABLE sessions DROP COLUMN IF EXISTS device;
@@ -0,0 +1,7 @@
+-- Sessions record the client they were last used from. Sessions started
+-- before were last active, as far as is known, when they started.
+ALTER TABLE sessions ADD COLUMN IF NOT EXISTS device VARCHAR(255) NOT NULL DEFAULT '';
+ALTER TABLE sessions ADD COLUMN IF NOT EXISTS ip VARCHAR(45) NOT NULL DEFAULT '';
+ALTER TABLE sessions ADD COLUMN IF NOT EXISTS last_active_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP;
+UPDATE sessions SET last_active_at = created_at;
+CREATE INDEX IF NOT EXISTS idx_sessions_username ON sessions (username);
@@ -0,0 +1,2 @@
+-- An empty locale answers users in the language their client asks for.
+ALTER TABLE users ADD COLUMN IF NOT EXISTS locale VARCHAR(35) NOT NULL DEFAULT '';
@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS idx_channel_posts_pinned;
+ALTER TABLE channel_posts DROP COLUMN IF EXISTS pinned;
+ALTER TABLE channel_subscriptions DROP COLUMN IF EXISTS role;
@@ -0,0 +1,11 @@
+-- Every subscriber is a member; owners and admins manage the channel.
+ALTER TABLE channel_subscriptions ADD COLUMN IF NOT EXISTS role VARCHAR(10) NOT NULL DEFAULT 'member';
+
+-- The creators of existing channels own them.
+INSERT INTO channel_subscriptions (channel_id, username, role)
+SELECT id, created_by, 'owner' FROM channels
+ON CONFLICT (channel_id, username) DO UPDATE SET role = 'owner';
+
+ALTER TABLE channel_posts ADD COLUMN IF NOT EXISTS pinned BOOLEAN NOT NULL DEFAULT FALSE;
+
+CREATE INDEX IF NOT EXISTS idx_channel_posts_pinned ON channel_posts (channel_id, id) WHERE pinned;
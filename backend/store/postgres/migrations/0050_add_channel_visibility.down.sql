@@ -0,0 +1,2 @@
+ALTER TABLE channels DROP COLUMN IF EXISTS visibility;
+ALTER TABLE channels DROP COLUMN IF EXISTS topic;
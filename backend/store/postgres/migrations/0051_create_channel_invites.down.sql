@@ -0,0 +1,3 @@
+ALTER TABLE channel_posts DROP COLUMN IF EXISTS system_event;
+ALTER TABLE channel_posts DROP COLUMN IF EXISTS kind;
+DROP TABLE IF EXISTS channel_invites;
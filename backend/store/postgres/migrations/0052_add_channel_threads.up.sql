@@ -0,0 +1,17 @@
+-- Replies form a thread under their parent and go when it does.
+ALTER TABLE channel_posts ADD COLUMN IF NOT EXISTS parent_id BIGINT REFERENCES channel_posts(id) ON DELETE CASCADE;
+
+CREATE INDEX IF NOT EXISTS idx_channel_posts_parent ON channel_posts (parent_id, id) WHERE parent_id IS NOT NULL;
+
+-- A row with subscribed false remembers that a user left a thread, so
+-- replies do not subscribe them again.
+CREATE TABLE IF NOT EXISTS channel_thread_subscriptions (
+    post_id BIGINT NOT NULL REFERENCES channel_posts(id) ON DELETE CASCADE,
+    username VARCHAR(50) NOT NULL,
+    subscribed BOOLEAN NOT NULL DEFAULT TRUE,
+    -- Replies up to this ID are read.
+    last_read_id BIGINT NOT NULL DEFAULT 0,
+    PRIMARY KEY (post_id, username)
+);
+
+CREATE INDEX IF NOT EXISTS idx_channel_thread_subscriptions_username ON channel_thread_subscriptions (username);
@@ -0,0 +1,118 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+
+	"backend/store"
+)
+
+func (s *Store) PinMessage(ctx context.Context, id, username, peer string, limit int) (store.Pin, bool, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return store.Pin{}, false, err
+	}
+	defer tx.Rollback()
+
+	// Serialize pins per conversation so concurrent pins cannot exceed limit.
+	_, err = tx.ExecContext(ctx, "SELECT pg_advisory_xact_lock(hashtext('pins:' || LEAST($1::text, $2::text) || ':' || GREATEST($1::text, $2::text)))", username, peer)
+	if err != nil {
+		return store.Pin{}, false, err
+	}
+
+	var exists bool
+	err = tx.QueryRowContext(ctx, `
+		SELECT EXISTS (SELECT 1 FROM messages
+		WHERE id = $1 AND deleted_at IS NULL AND kind = 'user'
+		AND ((sender = $2 AND receiver = $3) OR (sender = $3 AND receiver = $2)))`,
+		id, username, peer).Scan(&exists)
+	if err != nil {
+		return store.Pin{}, false, err
+	}
+	if !exists {
+		return store.Pin{}, false, store.ErrNotFound
+	}
+
+	pin := store.Pin{MessageID: id}
+	err = tx.QueryRowContext(ctx, "SELECT pinned_by, pinned_at FROM pinned_messages WHERE message_id = $1", id).Scan(&pin.PinnedBy, &pin.PinnedAt)
+	if err == nil {
+		return pin, false, nil
+	}
+	if err != sql.ErrNoRows {
+		return store.Pin{}, false, err
+	}
+
+	var count int
+	err = tx.QueryRowContext(ctx, `
+		SELECT COUNT(*) FROM pinned_messages pm JOIN messages m ON m.id = pm.message_id
+		WHERE (m.sender = $1 AND m.receiver = $2) OR (m.sender = $2 AND m.receiver = $1)`,
+		username, peer).Scan(&count)
+	if err != nil {
+		return store.Pin{}, false, err
+	}
+	if count >= limit {
+		return store.Pin{}, false, store.ErrPinLimit
+	}
+
+	err = tx.QueryRowContext(ctx,
+		"INSERT INTO pinned_messages (message_id, pinned_by) VALUES ($1, $2) RETURNING pinned_by, pinned_at",
+		id, username).Scan(&pin.PinnedBy, &pin.PinnedAt)
+	if err != nil {
+		return store.Pin{}, false, err
+	}
+	return pin, true, tx.Commit()
+}
+
+func (s *Store) UnpinMessage(ctx context.Context, id, username, peer string) (bool, error) {
+	res, err := s.db.ExecContext(ctx, `
+		DELETE FROM pinned_messages pm USING messages m
+		WHERE pm.message_id = m.id AND m.id = $1
+		AND ((m.sender = $2 AND m.receiver = $3) OR (m.sender = $3 AND m.receiver = $2))`,
+		id, username, peer)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return n > 0, err
+}
+
+func (s *Store) PinnedMessages(ctx context.Context, viewer, peer string) ([]store.PinnedMessage, error) {
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT `+messageColumns+`, pm.pinned_by, pm.pinned_at
+		`+messageFrom+`
+		JOIN pinned_messages pm ON pm.message_id = m.id
+		WHERE ((m.sender = $1 AND m.receiver = $2) OR (m.sender = $2 AND m.receiver = $1))
+		AND m.deleted_at IS NULL
+		AND `+notDeletedFor+`
+		ORDER BY pm.pinned_at DESC`, viewer, peer)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	pinned := []store.PinnedMessage{}
+	for rows.Next() {
+		var p store.PinnedMessage
+		var err error
+		p.Message, err = scanMessage(rows, &p.PinnedBy, &p.PinnedAt)
+		if err != nil {
+			return nil, err
+		}
+		pinned = append(pinned, p)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	messages := make([]store.Message, len(pinned))
+	for i, p := range pinned {
+		messages[i] = p.Message
+	}
+	if err := s.loadAttachments(ctx, messages); err != nil {
+		return nil, err
+	}
+	for i := range pinned {
+		pinned[i].Message = messages[i]
+	}
+	return pinned, nil
+}
@@ -0,0 +1,180 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// PoolConfig sizes the connection pool and bounds how long queries may run.
+type PoolConfig struct {
+	// MaxOpenConns caps the connections open at once, zero for no limit.
+	MaxOpenConns int
+	// MaxIdleConns caps the connections kept open while idle.
+	MaxIdleConns int
+	// ConnMaxLifetime is how long a connection is reused before it is
+	// closed, zero for no limit.
+	ConnMaxLifetime time.Duration
+	// QueryTimeout cancels statements that run longer, zero for no limit.
+	// Reading the rows of a query counts towards it.
+	QueryTimeout time.Duration
+	// StatementCacheSize is how many prepared statements each connection
+	// keeps, zero to prepare none.
+	StatementCacheSize int
+}
+
+// Open returns a pool of connections to the database at connStr opened with
+// drv, configured as cfg says. It does not connect until it is used.
+func Open(drv driver.Driver, connStr string, cfg PoolConfig) *sql.DB {
+	db := sql.OpenDB(&connector{drv: drv, connStr: connStr, cfg: cfg})
+	db.SetMaxOpenConns(cfg.MaxOpenConns)
+	db.SetMaxIdleConns(cfg.MaxIdleConns)
+	db.SetConnMaxLifetime(cfg.ConnMaxLifetime)
+	return db
+}
+
+// noTimeoutKey marks contexts whose statements are not subject to the query
+// timeout.
+type noTimeoutKey struct{}
+
+// withoutQueryTimeout lets the statements run with ctx take as long as they
+// need, for work that is expected to be slow, such as migrations and
+// exports streamed to the client. They are still cancelled with ctx.
+func withoutQueryTimeout(ctx context.Context) context.Context {
+	return context.WithValue(ctx, noTimeoutKey{}, true)
+}
+
+// connector opens connections whose statements time out and are prepared
+// once per connection.
+type connector struct {
+	drv     driver.Driver
+	connStr string
+	cfg     PoolConfig
+}
+
+func (c *connector) Connect(ctx context.Context) (driver.Conn, error) {
+	conn, err := c.drv.Open(c.connStr)
+	if err != nil {
+		return nil, err
+	}
+	return &poolConn{Conn: conn, timeout: c.cfg.QueryTimeout, stmts: newStmtCache(c.cfg.StatementCacheSize)}, nil
+}
+
+func (c *connector) Driver() driver.Driver {
+	return c.drv
+}
+
+// poolConn forwards to the wrapped connection, cancelling statements that
+// run longer than timeout and running statements with arguments as prepared
+// statements cached in stmts. The wrapped connection must support the
+// context interfaces, as lib/pq does.
+type poolConn struct {
+	driver.Conn
+	timeout time.Duration
+	stmts   *stmtCache
+}
+
+// withTimeout returns ctx with the query deadline applied, unless there is
+// none or ctx opted out of it.
+func (c *poolConn) withTimeout(ctx context.Context) (context.Context, context.CancelFunc) {
+	if c.timeout <= 0 || ctx.Value(noTimeoutKey{}) != nil {
+		return ctx, func() {}
+	}
+	return context.WithTimeout(ctx, c.timeout)
+}
+
+// BeginTx is not bounded itself: database/sql rolls the transaction back
+// once its context is done, and each of its statements has its own timeout.
+func (c *poolConn) BeginTx(ctx context.Context, opts driver.TxOptions) (driver.Tx, error) {
+	return c.Conn.(driver.ConnBeginTx).BeginTx(ctx, opts)
+}
+
+func (c *poolConn) PrepareContext(ctx context.Context, query string) (driver.Stmt, error) {
+	return c.Conn.(driver.ConnPrepareContext).PrepareContext(ctx, query)
+}
+
+func (c *poolConn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	ctx, cancel := c.withTimeout(ctx)
+	defer cancel()
+
+	stmt, err := c.prepared(ctx, query, args)
+	if err != nil {
+		return nil, err
+	}
+	if stmt == nil {
+		return c.Conn.(driver.ExecerContext).ExecContext(ctx, query, args)
+	}
+	res, err := stmt.(driver.StmtExecContext).ExecContext(ctx, args)
+	if staleStatement(err) {
+		c.stmts.remove(query)
+	}
+	return res, err
+}
+
+// QueryContext keeps the deadline until the rows are closed, so a query
+// whose rows are read slowly is cancelled too.
+func (c *poolConn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	ctx, cancel := c.withTimeout(ctx)
+
+	stmt, err := c.prepared(ctx, query, args)
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+	var rows driver.Rows
+	if stmt == nil {
+		rows, err = c.Conn.(driver.QueryerContext).QueryContext(ctx, query, args)
+	} else if rows, err = stmt.(driver.StmtQueryContext).QueryContext(ctx, args); staleStatement(err) {
+		c.stmts.remove(query)
+	}
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+	return &timeoutRows{Rows: rows, cancel: cancel}, nil
+}
+
+// prepared returns the cached prepared statement of query, preparing it if
+// needed, or nil if query should run unprepared: when caching is off, or
+// when it has no arguments and runs faster as a simple query.
+func (c *poolConn) prepared(ctx context.Context, query string, args []driver.NamedValue) (driver.Stmt, error) {
+	if c.stmts == nil || len(args) == 0 {
+		return nil, nil
+	}
+	if stmt := c.stmts.get(query); stmt != nil {
+		return stmt, nil
+	}
+	stmt, err := c.PrepareContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	c.stmts.add(query, stmt)
+	return stmt, nil
+}
+
+// staleStatement reports whether err means a prepared statement can no
+// longer be used: a schema change altered the columns it returns, or the
+// server forgot it.
+func staleStatement(err error) bool {
+	var pqErr *pq.Error
+	return errors.As(err, &pqErr) && (pqErr.Code == "0A000" || pqErr.Code == "26000")
+}
+
+func (c *poolConn) Ping(ctx context.Context) error {
+	return c.Conn.(driver.Pinger).Ping(ctx)
+}
+
+// timeoutRows releases the deadline of its query once closed.
+type timeoutRows struct {
+	driver.Rows
+	cancel context.CancelFunc
+}
+
+func (r *timeoutRows) Close() error {
+	defer r.cancel()
+	return r.Rows.Close()
+}
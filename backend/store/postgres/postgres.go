@@ -0,0 +1,92 @@
+// Package postgres implements the store interfaces on PostgreSQL.
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"sync/atomic"
+
+	"backend/store"
+
+	"github.com/lib/pq"
+)
+
+// Store implements store.Store on a PostgreSQL database.
+type Store struct {
+	db *sql.DB
+
+	replicas    []*replica
+	nextReplica atomic.Uint32
+}
+
+var _ store.Store = (*Store)(nil)
+
+// New returns a Store using db, and the read replicas of db for queries
+// that can be served from them, such as message history and search.
+func New(db *sql.DB, replicas ...*sql.DB) *Store {
+	s := &Store{db: db}
+	for _, r := range replicas {
+		s.replicas = append(s.replicas, &replica{db: r})
+	}
+	return s
+}
+
+// Ping checks that the database is reachable.
+func (s *Store) Ping(ctx context.Context) error {
+	return s.db.PingContext(ctx)
+}
+
+// EnsureDatabase creates the database dbName on the server at connStr if it
+// doesn't exist.
+func EnsureDatabase(connStr, dbName string) error {
+	db, err := sql.Open("postgres", connStr)
+	if err != nil {
+		return fmt.Errorf("error connecting to PostgreSQL: %v", err)
+	}
+	defer db.Close()
+
+	var dbExists bool
+	err = db.QueryRow("SELECT EXISTS (SELECT 1 FROM pg_database WHERE datname = $1)", dbName).Scan(&dbExists)
+	if err != nil {
+		return fmt.Errorf("error checking if database exists: %v", err)
+	}
+
+	if !dbExists {
+		_, err = db.Exec(fmt.Sprintf("CREATE DATABASE %s", pq.QuoteIdentifier(dbName)))
+		if err != nil {
+			return fmt.Errorf("error creating database: %v", err)
+		}
+		fmt.Printf("Database '%s' created\n", dbName)
+	}
+
+	return nil
+}
+
+// isUniqueViolation reports whether err is the violation of a unique index.
+func isUniqueViolation(err error) bool {
+	var pqErr *pq.Error
+	return errors.As(err, &pqErr) && pqErr.Code == "23505"
+}
+
+// uniqueViolation maps the violation of a unique index on users to
+// ErrUsernameTaken or ErrEmailTaken.
+func uniqueViolation(err error) error {
+	var pqErr *pq.Error
+	if !errors.As(err, &pqErr) || pqErr.Code != "23505" {
+		return err
+	}
+	if pqErr.Constraint == "idx_users_email" {
+		return store.ErrEmailTaken
+	}
+	return store.ErrUsernameTaken
+}
+
+// notFound maps sql.ErrNoRows to store.ErrNotFound.
+func notFound(err error) error {
+	if err == sql.ErrNoRows {
+		return store.ErrNotFound
+	}
+	return err
+}
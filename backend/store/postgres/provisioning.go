@@ -0,0 +1,119 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"backend/store"
+)
+
+func (s *Store) CreateAPIKey(ctx context.Context, key *store.APIKey, keyHash string) error {
+	return s.db.QueryRowContext(ctx, `
+		INSERT INTO api_keys (name, key_hash, created_by) VALUES ($1, $2, $3)
+		RETURNING id, created_at`, key.Name, keyHash, key.CreatedBy).Scan(&key.ID, &key.CreatedAt)
+}
+
+func (s *Store) APIKeys(ctx context.Context) ([]store.APIKey, error) {
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT id, name, created_by, created_at, last_used_at FROM api_keys
+		WHERE revoked_at IS NULL ORDER BY id`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	keys := []store.APIKey{}
+	for rows.Next() {
+		var k store.APIKey
+		var lastUsed sql.NullTime
+		if err := rows.Scan(&k.ID, &k.Name, &k.CreatedBy, &k.CreatedAt, &lastUsed); err != nil {
+			return nil, err
+		}
+		if lastUsed.Valid {
+			k.LastUsedAt = &lastUsed.Time
+		}
+		keys = append(keys, k)
+	}
+	return keys, rows.Err()
+}
+
+func (s *Store) RevokeAPIKey(ctx context.Context, id string) error {
+	res, err := s.db.ExecContext(ctx, "UPDATE api_keys SET revoked_at = CURRENT_TIMESTAMP WHERE id = $1 AND revoked_at IS NULL", id)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return store.ErrNotFound
+	}
+	return nil
+}
+
+func (s *Store) UseAPIKey(ctx context.Context, keyHash string) (store.APIKey, error) {
+	var k store.APIKey
+	var lastUsed time.Time
+	err := s.db.QueryRowContext(ctx, `
+		UPDATE api_keys SET last_used_at = CURRENT_TIMESTAMP
+		WHERE key_hash = $1 AND revoked_at IS NULL
+		RETURNING id, name, created_by, created_at, last_used_at`, keyHash).
+		Scan(&k.ID, &k.Name, &k.CreatedBy, &k.CreatedAt, &lastUsed)
+	if err != nil {
+		return store.APIKey{}, notFound(err)
+	}
+	k.LastUsedAt = &lastUsed
+	return k, nil
+}
+
+func (s *Store) ProvisionedUser(ctx context.Context, username string) (store.ProvisionedUser, error) {
+	var u store.ProvisionedUser
+	err := s.db.QueryRowContext(ctx, `
+		SELECT username, COALESCE(email, ''), role, banned_at IS NOT NULL FROM users
+		WHERE username = $1 AND deletion_requested_at IS NULL`, username).
+		Scan(&u.Username, &u.Email, &u.Role, &u.Banned)
+	return u, notFound(err)
+}
+
+func (s *Store) ProvisionedUsers(ctx context.Context, offset, limit int) ([]store.ProvisionedUser, int, error) {
+	var total int
+	err := s.db.QueryRowContext(ctx, "SELECT COUNT(*) FROM users WHERE deletion_requested_at IS NULL").Scan(&total)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT username, COALESCE(email, ''), role, banned_at IS NOT NULL FROM users
+		WHERE deletion_requested_at IS NULL
+		ORDER BY username OFFSET $1 LIMIT $2`, offset, limit)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	users := []store.ProvisionedUser{}
+	for rows.Next() {
+		var u store.ProvisionedUser
+		if err := rows.Scan(&u.Username, &u.Email, &u.Role, &u.Banned); err != nil {
+			return nil, 0, err
+		}
+		users = append(users, u)
+	}
+	return users, total, rows.Err()
+}
+
+func (s *Store) SetEmail(ctx context.Context, username, email string) error {
+	var nullEmail sql.NullString
+	if email != "" {
+		nullEmail = sql.NullString{String: email, Valid: true}
+	}
+
+	res, err := s.db.ExecContext(ctx, `
+		UPDATE users SET email = $1, email_verified_at = CASE WHEN email = $1 THEN email_verified_at END
+		WHERE username = $2 AND deletion_requested_at IS NULL`, nullEmail, username)
+	if err != nil {
+		return uniqueViolation(err)
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return store.ErrNotFound
+	}
+	return nil
+}
@@ -0,0 +1,93 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"log"
+	"sync/atomic"
+	"time"
+)
+
+// replicaCheckInterval is how often MonitorReplicas measures replica lag.
+const replicaCheckInterval = 5 * time.Second
+
+// replica is a read-only copy of the database. Reads go to it only while it
+// is healthy: reachable and no further than the allowed lag behind the
+// primary.
+type replica struct {
+	db      *sql.DB
+	healthy atomic.Bool
+}
+
+// reader returns the database reads that tolerate a little staleness should
+// use: the next healthy replica in turn, or the primary if none is healthy.
+// Replicas start unhealthy, so reads go to the primary until MonitorReplicas
+// has checked them.
+func (s *Store) reader() *sql.DB {
+	n := len(s.replicas)
+	if n == 0 {
+		return s.db
+	}
+	start := int(s.nextReplica.Add(1))
+	for i := 0; i < n; i++ {
+		if r := s.replicas[(start+i)%n]; r.healthy.Load() {
+			return r.db
+		}
+	}
+	return s.db
+}
+
+// MonitorReplicas measures the lag of every replica until ctx is done,
+// sending reads only to those at most maxLag behind the primary and to the
+// primary when none is. It returns at once if there are no replicas.
+func (s *Store) MonitorReplicas(ctx context.Context, maxLag time.Duration) {
+	if len(s.replicas) == 0 {
+		return
+	}
+
+	ticker := time.NewTicker(replicaCheckInterval)
+	defer ticker.Stop()
+	for {
+		for i, r := range s.replicas {
+			s.checkReplica(ctx, i, r, maxLag)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// checkReplica updates whether r is healthy, logging when that changes.
+func (s *Store) checkReplica(ctx context.Context, i int, r *replica, maxLag time.Duration) {
+	lag, err := replicationLag(ctx, r.db)
+	healthy := err == nil && lag <= maxLag
+	if r.healthy.Swap(healthy) == healthy {
+		return
+	}
+	switch {
+	case err != nil:
+		log.Printf("Replica %d unavailable, reading from the primary: %v", i, err)
+	case !healthy:
+		log.Printf("Replica %d is %v behind, reading from the primary", i, lag.Round(time.Millisecond))
+	default:
+		log.Printf("Replica %d caught up, reading from it", i)
+	}
+}
+
+// replicationLag returns how far db is behind its primary: zero when it has
+// replayed everything it received, or else the time since the last
+// transaction it replayed. A database that is not a standby has no lag.
+func replicationLag(ctx context.Context, db *sql.DB) (time.Duration, error) {
+	var seconds float64
+	err := db.QueryRowContext(ctx, `
+		SELECT CASE
+			WHEN NOT pg_is_in_recovery() OR pg_last_wal_receive_lsn() = pg_last_wal_replay_lsn() THEN 0
+			ELSE COALESCE(EXTRACT(EPOCH FROM now() - pg_last_xact_replay_timestamp()), 0)
+		END`).Scan(&seconds)
+	if err != nil {
+		return 0, err
+	}
+	return time.Duration(seconds * float64(time.Second)), nil
+}
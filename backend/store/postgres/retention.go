@@ -0,0 +1,153 @@
+package postgres
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// Monthly partitions of messages are named messages_p followed by the year
+// and month of the messages they hold; archived ones are renamed to
+// messages_archive_p followed by the same.
+const (
+	partitionPrefix         = "messages_p"
+	archivedPartitionPrefix = "messages_archive_p"
+	partitionMonthLayout    = "200601"
+)
+
+// monthStart returns the first instant of the month of t, in UTC like the
+// timestamps of messages.
+func monthStart(t time.Time) time.Time {
+	t = t.UTC()
+	return time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, time.UTC)
+}
+
+func (s *Store) EnsureMessagePartitions(ctx context.Context, from, through time.Time) error {
+	for month := monthStart(from); !month.After(through); month = month.AddDate(0, 1, 0) {
+		_, err := s.db.ExecContext(ctx, fmt.Sprintf(
+			"CREATE TABLE IF NOT EXISTS %s PARTITION OF messages FOR VALUES FROM (%s) TO (%s)",
+			pq.QuoteIdentifier(partitionPrefix+month.Format(partitionMonthLayout)),
+			pq.QuoteLiteral(month.Format(time.DateTime)),
+			pq.QuoteLiteral(month.AddDate(0, 1, 0).Format(time.DateTime))))
+		if err != nil {
+			return fmt.Errorf("creating partition for %s: %w", month.Format("2006-01"), err)
+		}
+	}
+	return nil
+}
+
+// messagePartitions returns the months that have a partition, oldest
+// first.
+func (s *Store) messagePartitions(ctx context.Context) ([]time.Time, error) {
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT c.relname FROM pg_inherits i
+		JOIN pg_class c ON c.oid = i.inhrelid
+		WHERE i.inhparent = 'messages'::regclass
+		ORDER BY c.relname`)
+	if err != nil {
+		return nil, err
+	}
+	names, err := scanStrings(rows)
+	if err != nil {
+		return nil, err
+	}
+
+	var months []time.Time
+	for _, name := range names {
+		suffix, ok := strings.CutPrefix(name, partitionPrefix)
+		if !ok {
+			continue
+		}
+		if month, err := time.Parse(partitionMonthLayout, suffix); err == nil {
+			months = append(months, month)
+		}
+	}
+	return months, nil
+}
+
+func (s *Store) ExpireMessagePartitions(ctx context.Context, before time.Time, archive bool) ([]string, error) {
+	months, err := s.messagePartitions(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	// Removing a month can take a while, so it is not subject to the query
+	// timeout.
+	ctx = withoutQueryTimeout(ctx)
+	var keys []string
+	for _, month := range months {
+		if month.AddDate(0, 1, 0).After(before) {
+			break
+		}
+		monthKeys, err := s.expirePartition(ctx, month, archive)
+		if err != nil {
+			return keys, fmt.Errorf("expiring messages of %s: %w", month.Format("2006-01"), err)
+		}
+		keys = append(keys, monthKeys...)
+	}
+	return keys, nil
+}
+
+// expirePartition removes the partition of month from messages in one
+// transaction, and returns the blob keys of the attachments deleted with
+// it. Dropping a partition does not run the delete trigger, so what belongs
+// to its messages is deleted first. An archived partition keeps its
+// attachments and who deleted which message.
+func (s *Store) expirePartition(ctx context.Context, month time.Time, archive bool) ([]string, error) {
+	suffix := month.Format(partitionMonthLayout)
+	partition := pq.QuoteIdentifier(partitionPrefix + suffix)
+	ids := "SELECT id FROM " + partition
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	var keys []string
+	if !archive {
+		rows, err := tx.QueryContext(ctx, `
+			SELECT storage_key FROM attachments WHERE message_id IN (`+ids+`)
+			UNION ALL
+			SELECT v.storage_key FROM attachment_variants v
+			JOIN attachments a ON a.id = v.attachment_id
+			WHERE a.message_id IN (`+ids+`)`)
+		if err != nil {
+			return nil, err
+		}
+		if keys, err = scanStrings(rows); err != nil {
+			return nil, err
+		}
+	}
+
+	statements := []string{
+		"UPDATE messages SET reply_to_id = NULL WHERE reply_to_id IN (" + ids + ")",
+		"UPDATE scheduled_messages SET reply_to_id = NULL WHERE reply_to_id IN (" + ids + ")",
+		"DELETE FROM message_status WHERE message_id IN (" + ids + ")",
+		"DELETE FROM message_flags WHERE message_id IN (" + ids + ")",
+		"DELETE FROM pinned_messages WHERE message_id IN (" + ids + ")",
+		"DELETE FROM mentions WHERE message_id IN (" + ids + ")",
+		// user_votes refers to messages by text ID without a foreign key.
+		"DELETE FROM user_votes WHERE message_id IN (SELECT id::text FROM " + partition + ")",
+	}
+	if archive {
+		statements = append(statements,
+			"ALTER TABLE messages DETACH PARTITION "+partition,
+			"ALTER TABLE "+partition+" RENAME TO "+pq.QuoteIdentifier(archivedPartitionPrefix+suffix))
+	} else {
+		statements = append(statements,
+			"DELETE FROM message_deletions WHERE message_id IN ("+ids+")",
+			"DELETE FROM attachments WHERE message_id IN ("+ids+")",
+			"ALTER TABLE messages DETACH PARTITION "+partition,
+			"DROP TABLE "+partition)
+	}
+	for _, stmt := range statements {
+		if _, err := tx.ExecContext(ctx, stmt); err != nil {
+			return nil, err
+		}
+	}
+	return keys, tx.Commit()
+}
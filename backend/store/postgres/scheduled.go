@@ -0,0 +1,82 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"sort"
+	"time"
+
+	"backend/store"
+)
+
+// scheduledColumns selects a ScheduledMessage.
+const scheduledColumns = `id, sender, receiver, content, format, reply_to_id, send_at, created_at`
+
+func (s *Store) CreateScheduled(ctx context.Context, sm *store.ScheduledMessage) error {
+	return s.db.QueryRowContext(ctx,
+		"INSERT INTO scheduled_messages (sender, receiver, content, format, reply_to_id, send_at) VALUES ($1, $2, $3, $4, $5, $6) RETURNING id, created_at",
+		sm.Sender, sm.Receiver, sm.Content, sm.Format, sm.ReplyToID, sm.SendAt.UTC(),
+	).Scan(&sm.ID, &sm.CreatedAt)
+}
+
+func (s *Store) ScheduledMessages(ctx context.Context, sender string) ([]store.ScheduledMessage, error) {
+	rows, err := s.db.QueryContext(ctx, `SELECT `+scheduledColumns+` FROM scheduled_messages WHERE sender = $1 ORDER BY send_at, id`, sender)
+	if err != nil {
+		return nil, err
+	}
+	return scanScheduled(rows)
+}
+
+func (s *Store) CancelScheduled(ctx context.Context, id, sender string) (bool, error) {
+	res, err := s.db.ExecContext(ctx, "DELETE FROM scheduled_messages WHERE id = $1 AND sender = $2", id, sender)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return n > 0, err
+}
+
+func (s *Store) ClaimDueScheduled(ctx context.Context, now time.Time, limit int) ([]store.ScheduledMessage, error) {
+	rows, err := s.db.QueryContext(ctx, `
+		DELETE FROM scheduled_messages
+		WHERE id IN (
+			SELECT id FROM scheduled_messages
+			WHERE send_at <= $1
+			ORDER BY send_at, id
+			LIMIT $2
+			FOR UPDATE SKIP LOCKED
+		)
+		RETURNING `+scheduledColumns, now.UTC(), limit)
+	if err != nil {
+		return nil, err
+	}
+
+	due, err := scanScheduled(rows)
+	if err != nil {
+		return nil, err
+	}
+	// DELETE ... RETURNING does not preserve the subquery's order.
+	sort.Slice(due, func(i, j int) bool {
+		return due[i].SendAt.Before(due[j].SendAt)
+	})
+	return due, nil
+}
+
+// scanScheduled reads scheduled messages and closes rows.
+func scanScheduled(rows *sql.Rows) ([]store.ScheduledMessage, error) {
+	defer rows.Close()
+
+	scheduled := []store.ScheduledMessage{}
+	for rows.Next() {
+		var sm store.ScheduledMessage
+		var replyToID sql.NullString
+		if err := rows.Scan(&sm.ID, &sm.Sender, &sm.Receiver, &sm.Content, &sm.Format, &replyToID, &sm.SendAt, &sm.CreatedAt); err != nil {
+			return nil, err
+		}
+		if replyToID.Valid {
+			sm.ReplyToID = &replyToID.String
+		}
+		scheduled = append(scheduled, sm)
+	}
+	return scheduled, rows.Err()
+}
@@ -0,0 +1,79 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"backend/store"
+)
+
+func (s *Store) CreateSession(ctx context.Context, username, tokenHash string, client store.SessionClient, expiresAt time.Time) error {
+	_, err := s.db.ExecContext(ctx,
+		"INSERT INTO sessions (username, token_hash, device, ip, expires_at) VALUES ($1, $2, $3, $4, $5)",
+		username, tokenHash, client.Device, client.IP, expiresAt,
+	)
+	return err
+}
+
+func (s *Store) RotateSession(ctx context.Context, oldHash, newHash string, client store.SessionClient, expiresAt time.Time) (string, error) {
+	var username string
+	err := s.db.QueryRowContext(ctx, `
+		UPDATE sessions SET token_hash = $2, device = $3, ip = $4, last_active_at = CURRENT_TIMESTAMP, expires_at = $5
+		WHERE token_hash = $1 AND revoked_at IS NULL AND expires_at > CURRENT_TIMESTAMP
+		RETURNING username`, oldHash, newHash, client.Device, client.IP, expiresAt).Scan(&username)
+	if err == sql.ErrNoRows {
+		return "", store.ErrInvalidSession
+	}
+	return username, err
+}
+
+func (s *Store) RevokeSession(ctx context.Context, tokenHash string) error {
+	_, err := s.db.ExecContext(ctx,
+		"UPDATE sessions SET revoked_at = CURRENT_TIMESTAMP WHERE token_hash = $1 AND revoked_at IS NULL",
+		tokenHash,
+	)
+	return err
+}
+
+func (s *Store) RevokeUserSessions(ctx context.Context, username string) error {
+	_, err := s.db.ExecContext(ctx,
+		"UPDATE sessions SET revoked_at = CURRENT_TIMESTAMP WHERE username = $1 AND revoked_at IS NULL",
+		username,
+	)
+	return err
+}
+
+func (s *Store) Sessions(ctx context.Context, username string) ([]store.Session, error) {
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT id, device, ip, created_at, last_active_at, expires_at FROM sessions
+		WHERE username = $1 AND revoked_at IS NULL AND expires_at > CURRENT_TIMESTAMP
+		ORDER BY last_active_at DESC, id DESC`, username)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	sessions := []store.Session{}
+	for rows.Next() {
+		var sess store.Session
+		if err := rows.Scan(&sess.ID, &sess.Device, &sess.IP, &sess.CreatedAt, &sess.LastActiveAt, &sess.ExpiresAt); err != nil {
+			return nil, err
+		}
+		sessions = append(sessions, sess)
+	}
+	return sessions, rows.Err()
+}
+
+func (s *Store) RevokeUserSession(ctx context.Context, username, id string) error {
+	res, err := s.db.ExecContext(ctx, `
+		UPDATE sessions SET revoked_at = CURRENT_TIMESTAMP
+		WHERE id = $1 AND username = $2 AND revoked_at IS NULL AND expires_at > CURRENT_TIMESTAMP`, id, username)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return store.ErrNotFound
+	}
+	return nil
+}
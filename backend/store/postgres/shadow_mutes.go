@@ -0,0 +1,79 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+
+	"backend/store"
+)
+
+func (s *Store) ShadowMute(ctx context.Context, m store.ShadowMute) error {
+	if m.ChannelID == "" {
+		_, err := s.db.ExecContext(ctx, `
+			INSERT INTO shadow_mutes (username, muted_by) VALUES ($1, $2)
+			ON CONFLICT (username) DO UPDATE SET muted_by = EXCLUDED.muted_by, created_at = CURRENT_TIMESTAMP`,
+			m.Username, m.MutedBy)
+		return err
+	}
+
+	res, err := s.db.ExecContext(ctx, `
+		INSERT INTO channel_shadow_mutes (channel_id, username, muted_by)
+		SELECT id, $2, $3 FROM channels WHERE id = $1
+		ON CONFLICT (channel_id, username) DO UPDATE SET muted_by = EXCLUDED.muted_by, created_at = CURRENT_TIMESTAMP`,
+		m.ChannelID, m.Username, m.MutedBy)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return store.ErrNotFound
+	}
+	return nil
+}
+
+func (s *Store) ShadowUnmute(ctx context.Context, username, channelID string) (bool, error) {
+	var res sql.Result
+	var err error
+	if channelID == "" {
+		res, err = s.db.ExecContext(ctx, "DELETE FROM shadow_mutes WHERE username = $1", username)
+	} else {
+		res, err = s.db.ExecContext(ctx, "DELETE FROM channel_shadow_mutes WHERE channel_id::text = $1 AND username = $2", channelID, username)
+	}
+	if err != nil {
+		return false, err
+	}
+	n, _ := res.RowsAffected()
+	return n > 0, nil
+}
+
+func (s *Store) ShadowMuted(ctx context.Context, username, channelID string) (bool, error) {
+	var muted bool
+	err := s.db.QueryRowContext(ctx, `
+		SELECT EXISTS (SELECT 1 FROM shadow_mutes WHERE username = $1)
+			OR EXISTS (SELECT 1 FROM channel_shadow_mutes WHERE channel_id::text = $2 AND username = $1)`,
+		username, channelID).Scan(&muted)
+	return muted, err
+}
+
+func (s *Store) ShadowMutes(ctx context.Context) ([]store.ShadowMute, error) {
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT username, NULL::integer AS channel_id, muted_by, created_at FROM shadow_mutes
+		UNION ALL
+		SELECT username, channel_id, muted_by, created_at FROM channel_shadow_mutes
+		ORDER BY username, channel_id NULLS FIRST`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	mutes := []store.ShadowMute{}
+	for rows.Next() {
+		var m store.ShadowMute
+		var channelID sql.NullString
+		if err := rows.Scan(&m.Username, &channelID, &m.MutedBy, &m.CreatedAt); err != nil {
+			return nil, err
+		}
+		m.ChannelID = channelID.String
+		mutes = append(mutes, m)
+	}
+	return mutes, rows.Err()
+}
@@ -0,0 +1,45 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"backend/store"
+)
+
+func (s *Store) UserStatus(ctx context.Context, username string) (store.UserStatus, error) {
+	var status store.UserStatus
+	var expiresAt sql.NullTime
+	err := s.db.QueryRowContext(ctx, `
+		SELECT availability, text, emoji, expires_at FROM user_statuses
+		WHERE username = $1 AND (expires_at IS NULL OR expires_at > CURRENT_TIMESTAMP)`, username).
+		Scan(&status.Availability, &status.Text, &status.Emoji, &expiresAt)
+	if err == sql.ErrNoRows {
+		return store.DefaultUserStatus, nil
+	}
+	if expiresAt.Valid {
+		status.ExpiresAt = &expiresAt.Time
+	}
+	return status, err
+}
+
+func (s *Store) SetUserStatus(ctx context.Context, username string, status *store.UserStatus, d time.Duration) error {
+	var expiresAt sql.NullTime
+	err := s.db.QueryRowContext(ctx, `
+		INSERT INTO user_statuses (username, availability, text, emoji, expires_at)
+		VALUES ($1, $2, $3, $4, CASE WHEN $5::int > 0 THEN CURRENT_TIMESTAMP + make_interval(secs => $5) END)
+		ON CONFLICT (username) DO UPDATE SET availability = EXCLUDED.availability, text = EXCLUDED.text,
+			emoji = EXCLUDED.emoji, expires_at = EXCLUDED.expires_at, updated_at = CURRENT_TIMESTAMP
+		RETURNING expires_at`, username, status.Availability, status.Text, status.Emoji, int(d/time.Second)).Scan(&expiresAt)
+	status.ExpiresAt = nil
+	if expiresAt.Valid {
+		status.ExpiresAt = &expiresAt.Time
+	}
+	return err
+}
+
+func (s *Store) ClearUserStatus(ctx context.Context, username string) error {
+	_, err := s.db.ExecContext(ctx, "DELETE FROM user_statuses WHERE username = $1", username)
+	return err
+}
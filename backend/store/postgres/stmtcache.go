@@ -0,0 +1,58 @@
+package postgres
+
+import (
+	"container/list"
+	"database/sql/driver"
+)
+
+// stmtCache keeps the prepared statements of one connection, keyed by query,
+// closing the least recently used once it is full. Queries with arguments
+// then skip parsing and planning, and take one round trip instead of two.
+// Like its connection, it is used by one goroutine at a time.
+type stmtCache struct {
+	size  int
+	order *list.List // of *cachedStmt, most recently used first
+	byKey map[string]*list.Element
+}
+
+type cachedStmt struct {
+	query string
+	stmt  driver.Stmt
+}
+
+// newStmtCache returns a cache of size statements, or nil if size is zero.
+func newStmtCache(size int) *stmtCache {
+	if size <= 0 {
+		return nil
+	}
+	return &stmtCache{size: size, order: list.New(), byKey: make(map[string]*list.Element)}
+}
+
+func (c *stmtCache) get(query string) driver.Stmt {
+	e, ok := c.byKey[query]
+	if !ok {
+		return nil
+	}
+	c.order.MoveToFront(e)
+	return e.Value.(*cachedStmt).stmt
+}
+
+func (c *stmtCache) add(query string, stmt driver.Stmt) {
+	c.byKey[query] = c.order.PushFront(&cachedStmt{query: query, stmt: stmt})
+	if c.order.Len() > c.size {
+		c.removeElement(c.order.Back())
+	}
+}
+
+// remove closes and forgets the statement of query.
+func (c *stmtCache) remove(query string) {
+	if e, ok := c.byKey[query]; ok {
+		c.removeElement(e)
+	}
+}
+
+func (c *stmtCache) removeElement(e *list.Element) {
+	cached := c.order.Remove(e).(*cachedStmt)
+	delete(c.byKey, cached.query)
+	cached.stmt.Close()
+}
@@ -0,0 +1,67 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"backend/store"
+)
+
+func (s *Store) CreateUserAPIKey(ctx context.Context, key *store.UserAPIKey, keyHash string) error {
+	return s.db.QueryRowContext(ctx, `
+		INSERT INTO user_api_keys (username, name, scope, key_hash) VALUES ($1, $2, $3, $4)
+		RETURNING id, created_at`, key.Username, key.Name, key.Scope, keyHash).Scan(&key.ID, &key.CreatedAt)
+}
+
+func (s *Store) UserAPIKeys(ctx context.Context, username string) ([]store.UserAPIKey, error) {
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT id, username, name, scope, created_at, last_used_at FROM user_api_keys
+		WHERE username = $1 AND revoked_at IS NULL ORDER BY id`, username)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	keys := []store.UserAPIKey{}
+	for rows.Next() {
+		var k store.UserAPIKey
+		var lastUsed sql.NullTime
+		if err := rows.Scan(&k.ID, &k.Username, &k.Name, &k.Scope, &k.CreatedAt, &lastUsed); err != nil {
+			return nil, err
+		}
+		if lastUsed.Valid {
+			k.LastUsedAt = &lastUsed.Time
+		}
+		keys = append(keys, k)
+	}
+	return keys, rows.Err()
+}
+
+func (s *Store) RevokeUserAPIKey(ctx context.Context, username, id string) error {
+	res, err := s.db.ExecContext(ctx, `
+		UPDATE user_api_keys SET revoked_at = CURRENT_TIMESTAMP
+		WHERE id = $1 AND username = $2 AND revoked_at IS NULL`, id, username)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return store.ErrNotFound
+	}
+	return nil
+}
+
+func (s *Store) UseUserAPIKey(ctx context.Context, keyHash string) (store.UserAPIKey, error) {
+	var k store.UserAPIKey
+	var lastUsed time.Time
+	err := s.db.QueryRowContext(ctx, `
+		UPDATE user_api_keys SET last_used_at = CURRENT_TIMESTAMP
+		WHERE key_hash = $1 AND revoked_at IS NULL
+		RETURNING id, username, name, scope, created_at, last_used_at`, keyHash).
+		Scan(&k.ID, &k.Username, &k.Name, &k.Scope, &k.CreatedAt, &lastUsed)
+	if err != nil {
+		return store.UserAPIKey{}, notFound(err)
+	}
+	k.LastUsedAt = &lastUsed
+	return k, nil
+}
@@ -0,0 +1,175 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"sort"
+	"time"
+
+	"backend/store"
+
+	"github.com/lib/pq"
+)
+
+const deliveryColumns = "d.id, d.webhook_id, d.event_type, d.payload, d.status, d.attempts, d.response_status, COALESCE(d.error, ''), d.created_at, d.next_attempt_at, d.delivered_at"
+
+func (s *Store) CreateWebhook(ctx context.Context, w *store.Webhook) error {
+	var bot sql.NullString
+	if w.Bot != "" {
+		bot = sql.NullString{String: w.Bot, Valid: true}
+	}
+	return s.db.QueryRowContext(ctx, `
+		INSERT INTO webhooks (url, secret, events, bot, created_by) VALUES ($1, $2, $3, $4, $5)
+		RETURNING id, created_at`, w.URL, w.Secret, pq.Array(w.Events), bot, w.CreatedBy).Scan(&w.ID, &w.CreatedAt)
+}
+
+func (s *Store) Webhooks(ctx context.Context) ([]store.Webhook, error) {
+	rows, err := s.db.QueryContext(ctx, "SELECT id, url, events, COALESCE(bot, ''), created_by, created_at FROM webhooks ORDER BY id")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	webhooks := []store.Webhook{}
+	for rows.Next() {
+		var w store.Webhook
+		if err := rows.Scan(&w.ID, &w.URL, pq.Array(&w.Events), &w.Bot, &w.CreatedBy, &w.CreatedAt); err != nil {
+			return nil, err
+		}
+		webhooks = append(webhooks, w)
+	}
+	return webhooks, rows.Err()
+}
+
+func (s *Store) DeleteWebhook(ctx context.Context, id string) error {
+	res, err := s.db.ExecContext(ctx, "DELETE FROM webhooks WHERE id = $1", id)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return store.ErrNotFound
+	}
+	return nil
+}
+
+func (s *Store) CreateDeliveries(ctx context.Context, eventType, recipient, payload string) error {
+	_, err := s.db.ExecContext(ctx, `
+		INSERT INTO webhook_deliveries (webhook_id, event_type, payload, next_attempt_at)
+		SELECT id, $1, $2, $3 FROM webhooks
+		WHERE $1 = ANY(events) AND (bot IS NULL OR bot = $4)`, eventType, payload, time.Now().UTC(), recipient)
+	return err
+}
+
+func (s *Store) ClaimDueDeliveries(ctx context.Context, now time.Time, lease time.Duration, limit int) ([]store.WebhookDelivery, error) {
+	rows, err := s.db.QueryContext(ctx, `
+		UPDATE webhook_deliveries d SET next_attempt_at = $2
+		FROM webhooks w
+		WHERE w.id = d.webhook_id AND d.id IN (
+			SELECT id FROM webhook_deliveries
+			WHERE status = 'pending' AND next_attempt_at <= $1
+			ORDER BY next_attempt_at, id
+			LIMIT $3
+			FOR UPDATE SKIP LOCKED
+		)
+		RETURNING `+deliveryColumns+`, w.url, w.secret`, now.UTC(), now.Add(lease).UTC(), limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var due []store.WebhookDelivery
+	for rows.Next() {
+		d, err := scanDelivery(rows, true)
+		if err != nil {
+			return nil, err
+		}
+		due = append(due, d)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	// UPDATE ... RETURNING does not preserve the subquery's order.
+	sort.Slice(due, func(i, j int) bool {
+		return due[i].CreatedAt.Before(due[j].CreatedAt)
+	})
+	return due, nil
+}
+
+func (s *Store) RecordDeliveryAttempt(ctx context.Context, id string, attempt store.DeliveryAttempt) error {
+	var nextAttempt sql.NullTime
+	if attempt.Status == store.DeliveryPending {
+		nextAttempt = sql.NullTime{Time: attempt.NextAttemptAt.UTC(), Valid: true}
+	}
+	var errMsg sql.NullString
+	if attempt.Error != "" {
+		errMsg = sql.NullString{String: attempt.Error, Valid: true}
+	}
+
+	_, err := s.db.ExecContext(ctx, `
+		UPDATE webhook_deliveries SET
+			attempts = attempts + 1,
+			status = $2,
+			response_status = $3,
+			error = $4,
+			next_attempt_at = $5,
+			delivered_at = CASE WHEN $2 = 'succeeded' THEN CURRENT_TIMESTAMP END
+		WHERE id = $1`, id, attempt.Status, attempt.ResponseStatus, errMsg, nextAttempt)
+	return err
+}
+
+func (s *Store) WebhookDeliveries(ctx context.Context, webhookID string, limit int) ([]store.WebhookDelivery, error) {
+	var exists bool
+	err := s.db.QueryRowContext(ctx, "SELECT EXISTS (SELECT 1 FROM webhooks WHERE id = $1)", webhookID).Scan(&exists)
+	if err != nil {
+		return nil, err
+	}
+	if !exists {
+		return nil, store.ErrNotFound
+	}
+
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT `+deliveryColumns+` FROM webhook_deliveries d
+		WHERE d.webhook_id = $1 ORDER BY d.id DESC LIMIT $2`, webhookID, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	deliveries := []store.WebhookDelivery{}
+	for rows.Next() {
+		d, err := scanDelivery(rows, false)
+		if err != nil {
+			return nil, err
+		}
+		deliveries = append(deliveries, d)
+	}
+	return deliveries, rows.Err()
+}
+
+// scanDelivery reads a row of deliveryColumns, followed by the webhook's URL
+// and secret if withWebhook is set.
+func scanDelivery(rows *sql.Rows, withWebhook bool) (store.WebhookDelivery, error) {
+	var d store.WebhookDelivery
+	var responseStatus sql.NullInt64
+	var nextAttempt, delivered sql.NullTime
+	dest := []interface{}{&d.ID, &d.WebhookID, &d.EventType, &d.Payload, &d.Status, &d.Attempts,
+		&responseStatus, &d.Error, &d.CreatedAt, &nextAttempt, &delivered}
+	if withWebhook {
+		dest = append(dest, &d.URL, &d.Secret)
+	}
+	if err := rows.Scan(dest...); err != nil {
+		return d, err
+	}
+
+	if responseStatus.Valid {
+		status := int(responseStatus.Int64)
+		d.ResponseStatus = &status
+	}
+	if nextAttempt.Valid {
+		d.NextAttemptAt = &nextAttempt.Time
+	}
+	if delivered.Valid {
+		d.DeliveredAt = &delivered.Time
+	}
+	return d, nil
+}
@@ -0,0 +1,54 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+
+	"backend/store"
+)
+
+// archivedColumns selects a Message from messages_archive m, quoting the
+// archived message p it replies to, like messageColumns. Archived messages
+// lost their statuses and mentions when they were archived.
+const archivedColumns = `m.id, m.sender, m.receiver, m.seq,
+	CASE WHEN m.deleted_at IS NULL THEN m.content ELSE '' END, m.format,
+	m.upvotes, m.downvotes, 'sent', m.deleted_at IS NOT NULL,
+	m.kind, CASE WHEN m.deleted_at IS NULL THEN m.system_event END,
+	m.timestamp, m.updated_at, m.expires_at, m.shadowed,
+	'[]',
+	m.reply_to_id, p.sender, CASE WHEN p.deleted_at IS NULL THEN p.content ELSE '' END, p.deleted_at IS NOT NULL`
+
+func (s *Store) ArchivedMessages(ctx context.Context, viewer, other, before string, limit int) ([]store.Message, error) {
+	var cursor interface{}
+	if before != "" {
+		var id int64
+		err := s.db.QueryRowContext(ctx, "SELECT id FROM messages_archive WHERE id = ?1", before).Scan(&id)
+		if err == sql.ErrNoRows {
+			return nil, store.ErrNotFound
+		}
+		if err != nil {
+			return nil, err
+		}
+		cursor = id
+	}
+
+	// Messages are ordered by (timestamp, id) so messages sent in the same
+	// instant page consistently.
+	messages, err := s.queryMessages(ctx, `
+		SELECT `+archivedColumns+`
+		FROM messages_archive m
+		LEFT JOIN messages_archive p ON p.id = m.reply_to_id
+		WHERE ((m.sender = ?1 AND m.receiver = ?2) OR (m.sender = ?2 AND m.receiver = ?1))
+		AND `+notDeletedFor+`
+		AND (?3 IS NULL OR (m.timestamp, m.id) < (SELECT c.timestamp, c.id FROM messages_archive c WHERE c.id = ?3))
+		ORDER BY m.timestamp DESC, m.id DESC
+		LIMIT ?4`, viewer, other, cursor, limit)
+	if err != nil {
+		return nil, err
+	}
+
+	for i, j := 0, len(messages)-1; i < j; i, j = i+1, j-1 {
+		messages[i], messages[j] = messages[j], messages[i]
+	}
+	return messages, nil
+}
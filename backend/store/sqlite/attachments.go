@@ -0,0 +1,230 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"backend/store"
+)
+
+// attachmentURL is where clients download an attachment.
+func attachmentURL(id string) string {
+	return fmt.Sprintf("/attachments/%s", id)
+}
+
+// thumbnailURL is where clients download the thumbnail of an image.
+func thumbnailURL(id string) string {
+	return attachmentURL(id) + "/thumbnail"
+}
+
+// loadAttachments fills in the attachments of the given messages. Messages
+// deleted for everyone keep their attachments hidden.
+func (s *Store) loadAttachments(ctx context.Context, messages []store.Message) error {
+	ids := make([]string, 0, len(messages))
+	index := make(map[string]int, len(messages))
+	for i, msg := range messages {
+		if msg.Deleted {
+			continue
+		}
+		ids = append(ids, msg.ID)
+		index[msg.ID] = i
+	}
+	if len(ids) == 0 {
+		return nil
+	}
+
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT a.id, a.message_id, a.filename, a.content_type, a.size,
+			COALESCE(a.media_status, ''), COALESCE(a.width, 0), COALESCE(a.height, 0),
+			EXISTS (SELECT 1 FROM attachment_variants v WHERE v.attachment_id = a.id AND v.variant = ?2)
+		FROM attachments a
+		WHERE a.message_id IN (SELECT CAST(value AS INTEGER) FROM json_each(?1))
+		ORDER BY a.id`, jsonArray(ids), store.VariantThumbnail)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var a store.Attachment
+		var messageID string
+		var thumbnail bool
+		err := rows.Scan(&a.ID, &messageID, &a.Filename, &a.ContentType, &a.Size,
+			&a.MediaStatus, &a.Width, &a.Height, &thumbnail)
+		if err != nil {
+			return err
+		}
+		a.URL = attachmentURL(a.ID)
+		if thumbnail {
+			a.ThumbnailURL = thumbnailURL(a.ID)
+		}
+		i := index[messageID]
+		messages[i].Attachments = append(messages[i].Attachments, a)
+	}
+	return rows.Err()
+}
+
+func (s *Store) CreateAttachmentMessage(ctx context.Context, msg *store.Message, a store.Attachment, storageKey string) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	id, err := insertMessage(ctx, tx, msg)
+	if err != nil {
+		return err
+	}
+
+	var mediaStatus sql.NullString
+	if a.MediaStatus != "" {
+		mediaStatus = sql.NullString{String: a.MediaStatus, Valid: true}
+	}
+	res, err := tx.ExecContext(ctx, `
+		INSERT INTO attachments (message_id, uploader, filename, content_type, size, storage_key, media_status, created_at)
+		VALUES (?1, ?2, ?3, ?4, ?5, ?6, ?7, ?8)`,
+		id, msg.Sender, a.Filename, a.ContentType, a.Size, storageKey, mediaStatus, msg.CreatedAt,
+	)
+	if err != nil {
+		return err
+	}
+	attachmentID, err := res.LastInsertId()
+	if err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+
+	a.ID = fmt.Sprintf("%d", attachmentID)
+	a.URL = attachmentURL(a.ID)
+	msg.ID = fmt.Sprintf("%d", id)
+	msg.Status = store.StatusSent
+	msg.Attachments = []store.Attachment{a}
+	return nil
+}
+
+func (s *Store) AttachmentFile(ctx context.Context, id, viewer string) (store.Attachment, string, error) {
+	a := store.Attachment{ID: id, URL: attachmentURL(id)}
+	var key string
+	err := s.db.QueryRowContext(ctx, `
+		SELECT a.filename, a.content_type, a.size, a.storage_key
+		FROM attachments a
+		JOIN messages m ON m.id = a.message_id
+		WHERE a.id = ?1 AND m.deleted_at IS NULL AND (m.sender = ?2 OR m.receiver = ?2)`,
+		id, viewer).Scan(&a.Filename, &a.ContentType, &a.Size, &key)
+	return a, key, notFound(err)
+}
+
+func (s *Store) AttachmentVariant(ctx context.Context, id, name, viewer string) (store.AttachmentVariant, error) {
+	v := store.AttachmentVariant{Name: name}
+	err := s.db.QueryRowContext(ctx, `
+		SELECT v.content_type, v.width, v.height, v.size, v.storage_key
+		FROM attachment_variants v
+		JOIN attachments a ON a.id = v.attachment_id
+		JOIN messages m ON m.id = a.message_id
+		WHERE v.attachment_id = ?1 AND v.variant = ?2 AND m.deleted_at IS NULL AND (m.sender = ?3 OR m.receiver = ?3)`,
+		id, name, viewer).Scan(&v.ContentType, &v.Width, &v.Height, &v.Size, &v.Key)
+	return v, notFound(err)
+}
+
+// ClaimPendingMedia needs no row locks: the update takes the database lock,
+// so no other worker sees the images until their claim is recorded.
+func (s *Store) ClaimPendingMedia(ctx context.Context, lease time.Duration, limit int) ([]store.PendingMedia, error) {
+	t := now()
+	rows, err := s.db.QueryContext(ctx, `
+		UPDATE attachments SET media_claimed_until = ?2
+		WHERE id IN (
+			SELECT id FROM attachments
+			WHERE media_status = 'pending' AND (media_claimed_until IS NULL OR media_claimed_until < ?1)
+			ORDER BY id
+			LIMIT ?3
+		)
+		RETURNING id, message_id, content_type, storage_key`, t, t.Add(lease.Truncate(time.Second)), limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var pending []store.PendingMedia
+	for rows.Next() {
+		var p store.PendingMedia
+		if err := rows.Scan(&p.AttachmentID, &p.MessageID, &p.ContentType, &p.Key); err != nil {
+			return nil, err
+		}
+		pending = append(pending, p)
+	}
+	return pending, rows.Err()
+}
+
+func (s *Store) CompleteMedia(ctx context.Context, attachmentID string, width, height int, variants []store.AttachmentVariant) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	res, err := tx.ExecContext(ctx, `
+		UPDATE attachments SET media_status = 'ready', width = ?2, height = ?3, media_claimed_until = NULL
+		WHERE id = ?1`, attachmentID, width, height)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return store.ErrNotFound
+	}
+
+	for _, v := range variants {
+		_, err := tx.ExecContext(ctx, `
+			INSERT INTO attachment_variants (attachment_id, variant, content_type, width, height, size, storage_key)
+			VALUES (?1, ?2, ?3, ?4, ?5, ?6, ?7)`,
+			attachmentID, v.Name, v.ContentType, v.Width, v.Height, v.Size, v.Key)
+		if err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+func (s *Store) FailMedia(ctx context.Context, attachmentID string) error {
+	_, err := s.db.ExecContext(ctx,
+		"UPDATE attachments SET media_status = 'failed', media_claimed_until = NULL WHERE id = ?1", attachmentID)
+	return err
+}
+
+func (s *Store) CreateUpload(ctx context.Context, u store.Upload) error {
+	_, err := s.db.ExecContext(ctx, `
+		INSERT INTO pending_uploads (storage_key, uploader, filename, content_type, size, expires_at)
+		VALUES (?1, ?2, ?3, ?4, ?5, ?6)`,
+		u.ID, u.Uploader, u.Filename, u.ContentType, u.Size, u.ExpiresAt.UTC())
+	return err
+}
+
+func (s *Store) TakeUpload(ctx context.Context, id, uploader string) (store.Upload, error) {
+	u := store.Upload{ID: id, Uploader: uploader}
+	err := s.db.QueryRowContext(ctx, `
+		DELETE FROM pending_uploads
+		WHERE storage_key = ?1 AND uploader = ?2 AND expires_at > ?3
+		RETURNING filename, content_type, size, expires_at`,
+		id, uploader, now()).Scan(&u.Filename, &u.ContentType, &u.Size, &u.ExpiresAt)
+	return u, notFound(err)
+}
+
+func (s *Store) DeleteExpiredUploads(ctx context.Context, limit int) ([]string, error) {
+	rows, err := s.db.QueryContext(ctx, `
+		DELETE FROM pending_uploads
+		WHERE storage_key IN (
+			SELECT storage_key FROM pending_uploads
+			WHERE expires_at <= ?1
+			ORDER BY expires_at
+			LIMIT ?2
+		)
+		RETURNING storage_key`, now(), limit)
+	if err != nil {
+		return nil, err
+	}
+	return scanStrings(rows)
+}
@@ -0,0 +1,27 @@
+package sqlite
+
+import "context"
+
+func (s *Store) IsBlocked(ctx context.Context, a, b string) (bool, error) {
+	var blocked bool
+	err := s.db.QueryRowContext(ctx, `
+		SELECT EXISTS (
+			SELECT 1 FROM blocks
+			WHERE (blocker = ?1 AND blocked = ?2) OR (blocker = ?2 AND blocked = ?1)
+		)`, a, b).Scan(&blocked)
+	return blocked, err
+}
+
+func (s *Store) Block(ctx context.Context, blocker, blocked string) error {
+	_, err := s.db.ExecContext(ctx, "INSERT INTO blocks (blocker, blocked, created_at) VALUES (?1, ?2, ?3) ON CONFLICT DO NOTHING", blocker, blocked, now())
+	return err
+}
+
+func (s *Store) Unblock(ctx context.Context, blocker, blocked string) (bool, error) {
+	res, err := s.db.ExecContext(ctx, "DELETE FROM blocks WHERE blocker = ?1 AND blocked = ?2", blocker, blocked)
+	if err != nil {
+		return false, err
+	}
+	n, _ := res.RowsAffected()
+	return n > 0, nil
+}
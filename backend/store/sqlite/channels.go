@@ -0,0 +1,556 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+
+	"backend/store"
+)
+
+const channelColumns = `c.id, c.name, c.description, c.topic, c.visibility, c.created_by, c.created_at,
+	(SELECT json_group_array(username) FROM (SELECT username FROM channel_senders WHERE channel_id = c.id ORDER BY username)),
+	(SELECT COUNT(*) FROM channel_subscriptions WHERE channel_id = c.id),
+	COALESCE((SELECT role FROM channel_subscriptions WHERE channel_id = c.id AND username = ?1), '')`
+
+// scanChannel reads a row of channelColumns.
+func scanChannel(row interface{ Scan(...interface{}) error }) (store.Channel, error) {
+	var ch store.Channel
+	var senders string
+	err := row.Scan(&ch.ID, &ch.Name, &ch.Description, &ch.Topic, &ch.Visibility, &ch.CreatedBy, &ch.CreatedAt,
+		&senders, &ch.Subscribers, &ch.Role)
+	if err != nil {
+		return ch, err
+	}
+	ch.Subscribed = ch.Role != ""
+	return ch, json.Unmarshal([]byte(senders), &ch.Senders)
+}
+
+const channelPostColumns = "p.id, p.channel_id, p.sender, p.content, p.pinned, p.created_at, p.parent_id, p.kind, p.system_event, p.shadowed"
+
+// scanChannelPost reads a row of channelPostColumns.
+func scanChannelPost(row interface{ Scan(...interface{}) error }) (store.ChannelPost, error) {
+	var p store.ChannelPost
+	var parentID, system sql.NullString
+	err := row.Scan(&p.ID, &p.ChannelID, &p.Sender, &p.Content, &p.Pinned, &p.CreatedAt, &parentID, &p.Kind, &system, &p.Shadowed)
+	if parentID.Valid {
+		p.ParentID = &parentID.String
+	}
+	if err != nil || !system.Valid {
+		return p, err
+	}
+	return p, json.Unmarshal([]byte(system.String), &p.System)
+}
+
+func (s *Store) CreateChannel(ctx context.Context, ch *store.Channel) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	err = tx.QueryRowContext(ctx, `
+		INSERT INTO channels (name, description, topic, visibility, created_by, created_at) VALUES (?1, ?2, ?3, ?4, ?5, ?6)
+		ON CONFLICT (name) DO NOTHING
+		RETURNING id, created_at`, ch.Name, ch.Description, ch.Topic, ch.Visibility, ch.CreatedBy, now()).Scan(&ch.ID, &ch.CreatedAt)
+	if err == sql.ErrNoRows {
+		return store.ErrChannelTaken
+	}
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.ExecContext(ctx, `
+		INSERT INTO channel_senders (channel_id, username)
+		SELECT ?1, value FROM json_each(?2) WHERE true ON CONFLICT DO NOTHING`, ch.ID, jsonArray(ch.Senders))
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.ExecContext(ctx, `
+		INSERT INTO channel_subscriptions (channel_id, username, role, subscribed_at) VALUES (?1, ?2, ?3, ?4)`,
+		ch.ID, ch.CreatedBy, store.ChannelRoleOwner, ch.CreatedAt)
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func (s *Store) Channels(ctx context.Context, viewer, search string) ([]store.Channel, error) {
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT `+channelColumns+` FROM channels c
+		WHERE (c.visibility = 'public' OR EXISTS (SELECT 1 FROM channel_subscriptions WHERE channel_id = c.id AND username = ?1))
+		AND (?2 = '' OR instr(lower(c.name || ' ' || c.topic || ' ' || c.description), lower(?2)) > 0)
+		ORDER BY c.name`, viewer, search)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	channels := []store.Channel{}
+	for rows.Next() {
+		ch, err := scanChannel(rows)
+		if err != nil {
+			return nil, err
+		}
+		channels = append(channels, ch)
+	}
+	return channels, rows.Err()
+}
+
+func (s *Store) Channel(ctx context.Context, id, viewer string) (store.Channel, error) {
+	ch, err := scanChannel(s.db.QueryRowContext(ctx, "SELECT "+channelColumns+" FROM channels c WHERE c.id = ?2", viewer, id))
+	return ch, notFound(err)
+}
+
+func (s *Store) UpdateChannel(ctx context.Context, id string, update store.ChannelUpdate) error {
+	res, err := s.db.ExecContext(ctx, `
+		UPDATE channels SET name = COALESCE(?2, name), description = COALESCE(?3, description),
+			topic = COALESCE(?4, topic), visibility = COALESCE(?5, visibility)
+		WHERE id = ?1`, id, update.Name, update.Description, update.Topic, update.Visibility)
+	if isUniqueViolation(err) {
+		return store.ErrChannelTaken
+	}
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return store.ErrNotFound
+	}
+	return nil
+}
+
+func (s *Store) DeleteChannel(ctx context.Context, id string) error {
+	res, err := s.db.ExecContext(ctx, "DELETE FROM channels WHERE id = ?1", id)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return store.ErrNotFound
+	}
+	return nil
+}
+
+func (s *Store) AddChannelSender(ctx context.Context, id, username string) error {
+	res, err := s.db.ExecContext(ctx, `
+		INSERT INTO channel_senders (channel_id, username)
+		SELECT id, ?2 FROM channels WHERE id = ?1
+		ON CONFLICT DO NOTHING`, id, username)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n > 0 {
+		return nil
+	}
+	// Nothing was inserted: either username already is a sender or the
+	// channel does not exist.
+	return s.channelExists(ctx, id)
+}
+
+// channelExists returns ErrNotFound if the channel does not exist.
+func (s *Store) channelExists(ctx context.Context, id string) error {
+	var exists bool
+	if err := s.db.QueryRowContext(ctx, "SELECT EXISTS (SELECT 1 FROM channels WHERE id = ?1)", id).Scan(&exists); err != nil {
+		return err
+	}
+	if !exists {
+		return store.ErrNotFound
+	}
+	return nil
+}
+
+func (s *Store) RemoveChannelSender(ctx context.Context, id, username string) (bool, error) {
+	res, err := s.db.ExecContext(ctx, "DELETE FROM channel_senders WHERE channel_id = ?1 AND username = ?2", id, username)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return n > 0, err
+}
+
+func (s *Store) IsChannelSender(ctx context.Context, id, username string) (bool, error) {
+	var sender bool
+	err := s.db.QueryRowContext(ctx,
+		"SELECT EXISTS (SELECT 1 FROM channel_senders WHERE channel_id = ?1 AND username = ?2)",
+		id, username).Scan(&sender)
+	return sender, err
+}
+
+func (s *Store) SubscribeChannel(ctx context.Context, id, username string) error {
+	res, err := s.db.ExecContext(ctx, `
+		INSERT INTO channel_subscriptions (channel_id, username, subscribed_at)
+		SELECT id, ?2, ?3 FROM channels WHERE id = ?1
+		ON CONFLICT DO NOTHING`, id, username, now())
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n > 0 {
+		return nil
+	}
+	return s.channelExists(ctx, id)
+}
+
+func (s *Store) UnsubscribeChannel(ctx context.Context, id, username string) (bool, error) {
+	res, err := s.db.ExecContext(ctx, "DELETE FROM channel_subscriptions WHERE channel_id = ?1 AND username = ?2", id, username)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return n > 0, err
+}
+
+func (s *Store) ChannelRole(ctx context.Context, id, username string) (string, error) {
+	var role string
+	err := s.db.QueryRowContext(ctx, `
+		SELECT COALESCE((SELECT role FROM channel_subscriptions WHERE channel_id = c.id AND username = ?2), '')
+		FROM channels c WHERE c.id = ?1`, id, username).Scan(&role)
+	return role, notFound(err)
+}
+
+func (s *Store) SetChannelRole(ctx context.Context, id, username, role string) (bool, error) {
+	res, err := s.db.ExecContext(ctx,
+		"UPDATE channel_subscriptions SET role = ?3 WHERE channel_id = ?1 AND username = ?2",
+		id, username, role)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return n > 0, err
+}
+
+func (s *Store) ChannelMembers(ctx context.Context, id string) ([]store.ChannelMember, error) {
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT username, role, subscribed_at FROM channel_subscriptions
+		WHERE channel_id = ?1 ORDER BY username`, id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	members := []store.ChannelMember{}
+	for rows.Next() {
+		var m store.ChannelMember
+		if err := rows.Scan(&m.Username, &m.Role, &m.SubscribedAt); err != nil {
+			return nil, err
+		}
+		members = append(members, m)
+	}
+	return members, rows.Err()
+}
+
+func (s *Store) ChannelSubscribersAmong(ctx context.Context, id string, usernames []string) ([]string, error) {
+	rows, err := s.db.QueryContext(ctx,
+		"SELECT username FROM channel_subscriptions WHERE channel_id = ?1 AND username IN (SELECT value FROM json_each(?2))",
+		id, jsonArray(usernames))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var subscribers []string
+	for rows.Next() {
+		var username string
+		if err := rows.Scan(&username); err != nil {
+			return nil, err
+		}
+		subscribers = append(subscribers, username)
+	}
+	return subscribers, rows.Err()
+}
+
+func (s *Store) CreateChannelPost(ctx context.Context, post *store.ChannelPost) error {
+	var system sql.NullString
+	if post.System != nil {
+		encoded, err := json.Marshal(post.System)
+		if err != nil {
+			return err
+		}
+		system = sql.NullString{String: string(encoded), Valid: true}
+	}
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	err = tx.QueryRowContext(ctx, `
+		INSERT INTO channel_posts (channel_id, sender, content, created_at, parent_id, kind, system_event, shadowed) VALUES (?1, ?2, ?3, ?4, ?5, ?6, ?7, ?8)
+		RETURNING id, created_at`, post.ChannelID, post.Sender, post.Content, now(), post.ParentID, post.Kind, system, post.Shadowed).Scan(&post.ID, &post.CreatedAt)
+	if err != nil {
+		return err
+	}
+	if post.ParentID == nil {
+		return tx.Commit()
+	}
+
+	// The replier follows the thread again even if they left it; the
+	// sender of the parent only if they never did.
+	_, err = tx.ExecContext(ctx, `
+		INSERT INTO channel_thread_subscriptions (post_id, username) VALUES (?1, ?2)
+		ON CONFLICT (post_id, username) DO UPDATE SET subscribed = TRUE`, *post.ParentID, post.Sender)
+	if err != nil {
+		return err
+	}
+	_, err = tx.ExecContext(ctx, `
+		INSERT INTO channel_thread_subscriptions (post_id, username)
+		SELECT id, sender FROM channel_posts WHERE id = ?1
+		ON CONFLICT DO NOTHING`, *post.ParentID)
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func (s *Store) ChannelPosts(ctx context.Context, id, viewer, before string, limit int) ([]store.ChannelPost, error) {
+	return s.channelPosts(ctx, id, nil, viewer, before, limit)
+}
+
+func (s *Store) ChannelReplies(ctx context.Context, id, parentID, viewer, before string, limit int) ([]store.ChannelPost, error) {
+	return s.channelPosts(ctx, id, parentID, viewer, before, limit)
+}
+
+// channelPosts returns the posts of a channel with parentID, nil for the
+// posts that are not replies. See ChannelPosts.
+func (s *Store) channelPosts(ctx context.Context, id string, parentID interface{}, viewer, before string, limit int) ([]store.ChannelPost, error) {
+	var cursor interface{}
+	if before != "" {
+		cursor = before
+	}
+
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT `+channelPostColumns+` FROM channel_posts p
+		WHERE p.channel_id = ?1 AND p.parent_id IS ?5 AND (?2 IS NULL OR p.id < CAST(?2 AS INTEGER))
+		AND (NOT p.shadowed OR p.sender = ?4)
+		ORDER BY p.id DESC
+		LIMIT ?3`, id, cursor, limit, viewer, parentID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	posts, err := scanChannelPosts(rows)
+	if err != nil {
+		return nil, err
+	}
+
+	for i, j := 0, len(posts)-1; i < j; i, j = i+1, j-1 {
+		posts[i], posts[j] = posts[j], posts[i]
+	}
+	return posts, nil
+}
+
+// scanChannelPosts reads every row of channelPostColumns.
+func scanChannelPosts(rows *sql.Rows) ([]store.ChannelPost, error) {
+	posts := []store.ChannelPost{}
+	for rows.Next() {
+		p, err := scanChannelPost(rows)
+		if err != nil {
+			return nil, err
+		}
+		posts = append(posts, p)
+	}
+	return posts, rows.Err()
+}
+
+func (s *Store) ChannelPost(ctx context.Context, id, postID string) (store.ChannelPost, error) {
+	p, err := scanChannelPost(s.db.QueryRowContext(ctx,
+		"SELECT "+channelPostColumns+" FROM channel_posts p WHERE p.channel_id = ?1 AND p.id = ?2", id, postID))
+	return p, notFound(err)
+}
+
+func (s *Store) DeleteChannelPost(ctx context.Context, id, postID string) (bool, error) {
+	res, err := s.db.ExecContext(ctx, "DELETE FROM channel_posts WHERE channel_id = ?1 AND id = ?2", id, postID)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return n > 0, err
+}
+
+func (s *Store) PinChannelPost(ctx context.Context, id, postID string, pinned bool) (bool, error) {
+	res, err := s.db.ExecContext(ctx,
+		"UPDATE channel_posts SET pinned = ?3 WHERE channel_id = ?1 AND id = ?2", id, postID, pinned)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return n > 0, err
+}
+
+func (s *Store) PinnedChannelPosts(ctx context.Context, id, viewer string) ([]store.ChannelPost, error) {
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT `+channelPostColumns+` FROM channel_posts p
+		WHERE p.channel_id = ?1 AND p.pinned AND (NOT p.shadowed OR p.sender = ?2)
+		ORDER BY p.id`, id, viewer)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	return scanChannelPosts(rows)
+}
+
+func (s *Store) ChannelThreads(ctx context.Context, id, viewer string, limit int) ([]store.ChannelThread, error) {
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT `+channelPostColumns+`, t.replies, l.created_at, COALESCE(ts.subscribed, FALSE),
+			CASE WHEN ts.subscribed THEN (
+				SELECT COUNT(*) FROM channel_posts r
+				WHERE r.parent_id = p.id AND r.id > ts.last_read_id AND r.sender <> ?2 AND NOT r.shadowed
+			) ELSE 0 END
+		FROM (
+			SELECT parent_id, COUNT(*) AS replies, MAX(id) AS last_id FROM channel_posts
+			WHERE channel_id = ?1 AND parent_id IS NOT NULL AND (NOT shadowed OR sender = ?2)
+			GROUP BY parent_id
+		) t
+		JOIN channel_posts p ON p.id = t.parent_id
+		JOIN channel_posts l ON l.id = t.last_id
+		LEFT JOIN channel_thread_subscriptions ts ON ts.post_id = p.id AND ts.username = ?2
+		WHERE NOT p.shadowed OR p.sender = ?2
+		ORDER BY t.last_id DESC
+		LIMIT ?3`, id, viewer, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	threads := []store.ChannelThread{}
+	for rows.Next() {
+		var t store.ChannelThread
+		var parentID, system sql.NullString
+		p := &t.Parent
+		err := rows.Scan(&p.ID, &p.ChannelID, &p.Sender, &p.Content, &p.Pinned, &p.CreatedAt, &parentID, &p.Kind, &system, &p.Shadowed,
+			&t.Replies, &t.LastReplyAt, &t.Subscribed, &t.Unread)
+		if err != nil {
+			return nil, err
+		}
+		if system.Valid {
+			if err := json.Unmarshal([]byte(system.String), &p.System); err != nil {
+				return nil, err
+			}
+		}
+		threads = append(threads, t)
+	}
+	return threads, rows.Err()
+}
+
+func (s *Store) SetThreadSubscription(ctx context.Context, parentID, username string, subscribed bool) error {
+	_, err := s.db.ExecContext(ctx, `
+		INSERT INTO channel_thread_subscriptions (post_id, username, subscribed) VALUES (?1, ?2, ?3)
+		ON CONFLICT (post_id, username) DO UPDATE SET subscribed = excluded.subscribed`, parentID, username, subscribed)
+	return err
+}
+
+func (s *Store) MarkThreadRead(ctx context.Context, parentID, username string) error {
+	_, err := s.db.ExecContext(ctx, `
+		UPDATE channel_thread_subscriptions
+		SET last_read_id = COALESCE((SELECT MAX(id) FROM channel_posts WHERE parent_id = ?1), 0)
+		WHERE post_id = ?1 AND username = ?2 AND subscribed`, parentID, username)
+	return err
+}
+
+func (s *Store) ThreadSubscribersAmong(ctx context.Context, id, parentID string, usernames []string) ([]string, error) {
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT ts.username FROM channel_thread_subscriptions ts
+		JOIN channel_subscriptions cs ON cs.channel_id = ?1 AND cs.username = ts.username
+		WHERE ts.post_id = ?2 AND ts.subscribed AND ts.username IN (SELECT value FROM json_each(?3))`, id, parentID, jsonArray(usernames))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var subscribers []string
+	for rows.Next() {
+		var username string
+		if err := rows.Scan(&username); err != nil {
+			return nil, err
+		}
+		subscribers = append(subscribers, username)
+	}
+	return subscribers, rows.Err()
+}
+
+const channelInviteColumns = "id, channel_id, created_by, created_at, expires_at, max_uses, uses"
+
+// scanChannelInvite reads a row of channelInviteColumns.
+func scanChannelInvite(row interface{ Scan(...interface{}) error }) (store.ChannelInvite, error) {
+	var inv store.ChannelInvite
+	var expiresAt sql.NullTime
+	err := row.Scan(&inv.ID, &inv.ChannelID, &inv.CreatedBy, &inv.CreatedAt, &expiresAt, &inv.MaxUses, &inv.Uses)
+	if expiresAt.Valid {
+		inv.ExpiresAt = &expiresAt.Time
+	}
+	return inv, err
+}
+
+func (s *Store) CreateChannelInvite(ctx context.Context, invite *store.ChannelInvite, tokenHash string) error {
+	err := s.db.QueryRowContext(ctx, `
+		INSERT INTO channel_invites (channel_id, token_hash, created_by, expires_at, max_uses, created_at)
+		SELECT id, ?2, ?3, ?4, ?5, ?6 FROM channels WHERE id = ?1
+		RETURNING id, created_at`, invite.ChannelID, tokenHash, invite.CreatedBy, invite.ExpiresAt, invite.MaxUses, now()).
+		Scan(&invite.ID, &invite.CreatedAt)
+	return notFound(err)
+}
+
+func (s *Store) ChannelInvites(ctx context.Context, id string) ([]store.ChannelInvite, error) {
+	rows, err := s.db.QueryContext(ctx,
+		"SELECT "+channelInviteColumns+" FROM channel_invites WHERE channel_id = ?1 ORDER BY id", id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	invites := []store.ChannelInvite{}
+	for rows.Next() {
+		inv, err := scanChannelInvite(rows)
+		if err != nil {
+			return nil, err
+		}
+		invites = append(invites, inv)
+	}
+	return invites, rows.Err()
+}
+
+func (s *Store) DeleteChannelInvite(ctx context.Context, id, inviteID string) (bool, error) {
+	res, err := s.db.ExecContext(ctx, "DELETE FROM channel_invites WHERE channel_id = ?1 AND id = ?2", id, inviteID)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return n > 0, err
+}
+
+func (s *Store) ChannelInviteByToken(ctx context.Context, tokenHash string) (store.ChannelInvite, error) {
+	inv, err := scanChannelInvite(s.db.QueryRowContext(ctx,
+		"SELECT "+channelInviteColumns+" FROM channel_invites WHERE token_hash = ?1", tokenHash))
+	return inv, notFound(err)
+}
+
+func (s *Store) UseChannelInvite(ctx context.Context, inviteID, username string) (bool, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+
+	// Counting the use in the same statement that checks the limit keeps
+	// concurrent joins from going over it.
+	var channelID string
+	err = tx.QueryRowContext(ctx, `
+		UPDATE channel_invites SET uses = uses + 1
+		WHERE id = ?1 AND (expires_at IS NULL OR expires_at > ?2) AND (max_uses = 0 OR uses < max_uses)
+		RETURNING channel_id`, inviteID, now()).Scan(&channelID)
+	if err == sql.ErrNoRows {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	_, err = tx.ExecContext(ctx, `
+		INSERT INTO channel_subscriptions (channel_id, username, subscribed_at) VALUES (?1, ?2, ?3)
+		ON CONFLICT DO NOTHING`, channelID, username, now())
+	if err != nil {
+		return false, err
+	}
+	return true, tx.Commit()
+}
@@ -0,0 +1,141 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"backend/store"
+)
+
+func (s *Store) RegisterDevice(ctx context.Context, username string, d *store.Device) error {
+	return s.db.QueryRowContext(ctx, `
+		INSERT INTO device_tokens (username, platform, token, created_at) VALUES (?1, ?2, ?3, ?4)
+		ON CONFLICT (platform, token) DO UPDATE SET username = excluded.username
+		RETURNING id`, username, d.Platform, d.Token, now()).Scan(&d.ID)
+}
+
+func (s *Store) UnregisterDevice(ctx context.Context, id, username string) (bool, error) {
+	res, err := s.db.ExecContext(ctx, "DELETE FROM device_tokens WHERE id = ?1 AND username = ?2", id, username)
+	if err != nil {
+		return false, err
+	}
+	n, _ := res.RowsAffected()
+	return n > 0, nil
+}
+
+func (s *Store) Devices(ctx context.Context, username string) ([]store.Device, error) {
+	rows, err := s.db.QueryContext(ctx, "SELECT id, platform, token FROM device_tokens WHERE username = ?1", username)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var devices []store.Device
+	for rows.Next() {
+		var d store.Device
+		if err := rows.Scan(&d.ID, &d.Platform, &d.Token); err != nil {
+			return nil, err
+		}
+		devices = append(devices, d)
+	}
+	return devices, rows.Err()
+}
+
+func (s *Store) DeleteDevice(ctx context.Context, id string) error {
+	_, err := s.db.ExecContext(ctx, "DELETE FROM device_tokens WHERE id = ?1", id)
+	return err
+}
+
+func (s *Store) NotificationPreferences(ctx context.Context, username string) (store.NotificationPreferences, error) {
+	prefs := store.DefaultNotificationPreferences
+	var start, end, timeZone sql.NullString
+	err := s.db.QueryRowContext(ctx, `
+		SELECT push_enabled, show_preview, quiet_hours_start, quiet_hours_end, quiet_hours_time_zone
+		FROM notification_preferences WHERE username = ?1`, username).
+		Scan(&prefs.PushEnabled, &prefs.ShowPreview, &start, &end, &timeZone)
+	if err == sql.ErrNoRows {
+		return prefs, nil
+	}
+	if start.Valid && end.Valid {
+		prefs.QuietHours = &store.QuietHours{Start: start.String, End: end.String, TimeZone: timeZone.String}
+	}
+	return prefs, err
+}
+
+func (s *Store) SetNotificationPreferences(ctx context.Context, username string, prefs store.NotificationPreferences) error {
+	var start, end, timeZone sql.NullString
+	if q := prefs.QuietHours; q != nil {
+		start = sql.NullString{String: q.Start, Valid: true}
+		end = sql.NullString{String: q.End, Valid: true}
+		timeZone = sql.NullString{String: q.TimeZone, Valid: true}
+	}
+
+	_, err := s.db.ExecContext(ctx, `
+		INSERT INTO notification_preferences (username, push_enabled, show_preview, quiet_hours_start, quiet_hours_end, quiet_hours_time_zone)
+		VALUES (?1, ?2, ?3, ?4, ?5, ?6)
+		ON CONFLICT (username) DO UPDATE SET push_enabled = excluded.push_enabled, show_preview = excluded.show_preview,
+			quiet_hours_start = excluded.quiet_hours_start, quiet_hours_end = excluded.quiet_hours_end,
+			quiet_hours_time_zone = excluded.quiet_hours_time_zone`,
+		username, prefs.PushEnabled, prefs.ShowPreview, start, end, timeZone)
+	return err
+}
+
+func (s *Store) MuteConversation(ctx context.Context, username, peer string, d time.Duration) (store.Mute, error) {
+	m := store.Mute{Username: peer}
+	if d > 0 {
+		until := now().Add(d.Truncate(time.Second))
+		m.Until = &until
+	}
+	_, err := s.db.ExecContext(ctx, `
+		INSERT INTO conversation_mutes (username, peer, muted_until) VALUES (?1, ?2, ?3)
+		ON CONFLICT (username, peer) DO UPDATE SET muted_until = excluded.muted_until`,
+		username, peer, m.Until)
+	return m, err
+}
+
+func (s *Store) UnmuteConversation(ctx context.Context, username, peer string) (bool, error) {
+	res, err := s.db.ExecContext(ctx, `
+		DELETE FROM conversation_mutes
+		WHERE username = ?1 AND peer = ?2 AND (muted_until IS NULL OR muted_until > ?3)`, username, peer, now())
+	if err != nil {
+		return false, err
+	}
+	n, _ := res.RowsAffected()
+	return n > 0, nil
+}
+
+func (s *Store) Mutes(ctx context.Context, username string) ([]store.Mute, error) {
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT peer, muted_until FROM conversation_mutes
+		WHERE username = ?1 AND (muted_until IS NULL OR muted_until > ?2)
+		ORDER BY peer`, username, now())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	mutes := []store.Mute{}
+	for rows.Next() {
+		var m store.Mute
+		var until sql.NullTime
+		if err := rows.Scan(&m.Username, &until); err != nil {
+			return nil, err
+		}
+		if until.Valid {
+			m.Until = &until.Time
+		}
+		mutes = append(mutes, m)
+	}
+	return mutes, rows.Err()
+}
+
+func (s *Store) Muted(ctx context.Context, username, peer string) (bool, error) {
+	var muted bool
+	err := s.db.QueryRowContext(ctx, `
+		SELECT EXISTS (
+			SELECT 1 FROM conversation_mutes
+			WHERE username = ?1 AND peer = ?2 AND (muted_until IS NULL OR muted_until > ?3)
+		)`, username, peer, now()).Scan(&muted)
+	return muted, err
+}
@@ -0,0 +1,109 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"backend/store"
+)
+
+func (s *Store) MessageTTL(ctx context.Context, username, peer string) (time.Duration, error) {
+	var seconds int
+	err := s.db.QueryRowContext(ctx, "SELECT ttl_seconds FROM disappearing_messages WHERE username = ?1 AND peer = ?2", username, peer).Scan(&seconds)
+	if err == sql.ErrNoRows {
+		return 0, nil
+	}
+	return time.Duration(seconds) * time.Second, err
+}
+
+func (s *Store) SetMessageTTL(ctx context.Context, a, b string, ttl time.Duration) error {
+	if ttl == 0 {
+		_, err := s.db.ExecContext(ctx, `
+			DELETE FROM disappearing_messages
+			WHERE (username = ?1 AND peer = ?2) OR (username = ?2 AND peer = ?1)`, a, b)
+		return err
+	}
+
+	// The setting is stored for each side so renames carry it along.
+	_, err := s.db.ExecContext(ctx, `
+		INSERT INTO disappearing_messages (username, peer, ttl_seconds) VALUES (?1, ?2, ?3), (?2, ?1, ?3)
+		ON CONFLICT (username, peer) DO UPDATE SET ttl_seconds = excluded.ttl_seconds`,
+		a, b, int(ttl/time.Second))
+	return err
+}
+
+// DeleteExpired selects and deletes in one transaction, which holds the
+// database lock throughout, so concurrent callers never delete the same
+// message.
+func (s *Store) DeleteExpired(ctx context.Context, now time.Time, limit int) ([]store.ExpiredMessage, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	rows, err := tx.QueryContext(ctx, `
+		SELECT id, sender, receiver FROM messages
+		WHERE expires_at <= ?1
+		ORDER BY expires_at, id
+		LIMIT ?2`, now.UTC(), limit)
+	if err != nil {
+		return nil, err
+	}
+
+	expired := []store.ExpiredMessage{}
+	index := map[string]int{}
+	var ids []string
+	for rows.Next() {
+		var m store.ExpiredMessage
+		if err := rows.Scan(&m.ID, &m.Sender, &m.Receiver); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		index[m.ID] = len(expired)
+		expired = append(expired, m)
+		ids = append(ids, m.ID)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	if len(expired) == 0 {
+		return expired, nil
+	}
+
+	// Attachments go with their message, so collect their files first.
+	rows, err = tx.QueryContext(ctx, `
+		SELECT message_id, storage_key FROM attachments WHERE message_id IN (SELECT CAST(value AS INTEGER) FROM json_each(?1))
+		UNION ALL
+		SELECT a.message_id, v.storage_key FROM attachment_variants v
+		JOIN attachments a ON a.id = v.attachment_id
+		WHERE a.message_id IN (SELECT CAST(value AS INTEGER) FROM json_each(?1))`, jsonArray(ids))
+	if err != nil {
+		return nil, err
+	}
+	for rows.Next() {
+		var messageID, key string
+		if err := rows.Scan(&messageID, &key); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		i := index[messageID]
+		expired[i].AttachmentKeys = append(expired[i].AttachmentKeys, key)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	// user_votes refers to messages by text ID without a foreign key.
+	if _, err := tx.ExecContext(ctx, "DELETE FROM user_votes WHERE message_id IN (SELECT value FROM json_each(?1))", jsonArray(ids)); err != nil {
+		return nil, err
+	}
+	if _, err := tx.ExecContext(ctx, "DELETE FROM messages WHERE id IN (SELECT CAST(value AS INTEGER) FROM json_each(?1))", jsonArray(ids)); err != nil {
+		return nil, err
+	}
+
+	return expired, tx.Commit()
+}
@@ -0,0 +1,51 @@
+package sqlite
+
+import (
+	"context"
+
+	"backend/store"
+)
+
+func (s *Store) CreateMentions(ctx context.Context, msg *store.Message, usernames []string) error {
+	if len(usernames) == 0 {
+		return nil
+	}
+
+	_, err := s.db.ExecContext(ctx, `
+		INSERT INTO mentions (message_id, username, created_at)
+		SELECT ?1, value, ?3 FROM json_each(?2) WHERE true
+		ON CONFLICT DO NOTHING`, msg.ID, jsonArray(usernames), now())
+	if err != nil {
+		return err
+	}
+	msg.Mentions = usernames
+	return nil
+}
+
+func (s *Store) Mentions(ctx context.Context, username string, limit, offset int) ([]store.Mention, error) {
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT `+messageColumns+`, mn.created_at
+		`+messageFrom+`
+		JOIN mentions mn ON mn.message_id = m.id
+		WHERE mn.username = ?1
+		AND m.deleted_at IS NULL
+		AND `+notDeletedFor+`
+		ORDER BY mn.created_at DESC, m.id DESC
+		LIMIT ?2 OFFSET ?3`, username, limit, offset)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	mentions := []store.Mention{}
+	for rows.Next() {
+		var mn store.Mention
+		var err error
+		mn.Message, err = scanMessage(rows, &mn.MentionedAt)
+		if err != nil {
+			return nil, err
+		}
+		mentions = append(mentions, mn)
+	}
+	return mentions, rows.Err()
+}
@@ -0,0 +1,550 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"backend/markup"
+	"backend/store"
+)
+
+// messageColumns selects a Message from messages m joined with message_status
+// ms. The content of messages deleted for everyone is blanked out.
+const messageColumns = `m.id, m.sender, m.receiver, m.seq,
+	CASE WHEN m.deleted_at IS NULL THEN m.content ELSE '' END, m.format,
+	m.upvotes, m.downvotes, COALESCE(ms.status, 'sent'), m.deleted_at IS NOT NULL,
+	m.kind, CASE WHEN m.deleted_at IS NULL THEN m.system_event END,
+	m.timestamp, m.updated_at, m.expires_at, m.shadowed,
+	(SELECT json_group_array(username) FROM (SELECT mn.username FROM mentions mn WHERE mn.message_id = m.id ORDER BY mn.username)),
+	m.reply_to_id, p.sender, CASE WHEN p.deleted_at IS NULL THEN p.content ELSE '' END, p.deleted_at IS NOT NULL`
+
+// messageFrom is the FROM clause matching messageColumns.
+const messageFrom = `FROM messages m
+	LEFT JOIN message_status ms ON ms.message_id = m.id
+	LEFT JOIN messages p ON p.id = m.reply_to_id`
+
+// notDeletedFor excludes messages the user bound to ?1 deleted for themselves.
+const notDeletedFor = `NOT EXISTS (SELECT 1 FROM message_deletions md WHERE md.message_id = m.id AND md.username = ?1)`
+
+// rowScanner is implemented by *sql.Row and *sql.Rows.
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+// scanMessage scans a row selected with messageColumns into a Message.
+// Any extra columns selected after messageColumns are scanned into extra.
+func scanMessage(row rowScanner, extra ...interface{}) (store.Message, error) {
+	var msg store.Message
+	var replyToID, replySender, replyContent sql.NullString
+	var replyDeleted sql.NullBool
+	var expiresAt sql.NullTime
+	var system sql.NullString
+	var mentions string
+
+	dest := []interface{}{&msg.ID, &msg.Sender, &msg.Receiver, &msg.Seq, &msg.Content, &msg.Format, &msg.Upvotes, &msg.Downvotes, &msg.Status, &msg.Deleted,
+		&msg.Kind, &system,
+		&msg.CreatedAt, &msg.UpdatedAt, &expiresAt, &msg.Shadowed,
+		&mentions,
+		&replyToID, &replySender, &replyContent, &replyDeleted}
+	if err := row.Scan(append(dest, extra...)...); err != nil {
+		return msg, err
+	}
+
+	msg.HTML = markup.Render(msg.Format, msg.Content)
+	if expiresAt.Valid {
+		msg.ExpiresAt = &expiresAt.Time
+	}
+	if system.Valid {
+		if err := json.Unmarshal([]byte(system.String), &msg.System); err != nil {
+			return msg, err
+		}
+	}
+	if err := json.Unmarshal([]byte(mentions), &msg.Mentions); err != nil {
+		return msg, err
+	}
+	if replyToID.Valid {
+		msg.ReplyToID = &replyToID.String
+		msg.ReplyTo = store.NewReplyPreview(replyToID.String, replySender.String, replyContent.String, replyDeleted.Bool)
+	}
+	return msg, nil
+}
+
+// queryMessages runs a query selecting messageColumns and returns the
+// messages with their attachments.
+func (s *Store) queryMessages(ctx context.Context, query string, args ...interface{}) ([]store.Message, error) {
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	messages := []store.Message{}
+	for rows.Next() {
+		msg, err := scanMessage(rows)
+		if err != nil {
+			return nil, err
+		}
+		messages = append(messages, msg)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return messages, s.loadAttachments(ctx, messages)
+}
+
+func (s *Store) CreateMessage(ctx context.Context, msg *store.Message) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	id, err := insertMessage(ctx, tx, msg)
+	if err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+
+	msg.ID = fmt.Sprintf("%d", id)
+	msg.Status = store.StatusSent
+	return nil
+}
+
+// insertMessage inserts a message and its sent status, returning its ID and
+// filling in its timestamps, kind and seq. A user message expires if
+// disappearing messages are on for its conversation; system messages stay.
+// A shadowed message is deleted for its receiver from the start.
+// Write transactions run one at a time, so the messages of a conversation
+// are numbered in commit order.
+func insertMessage(ctx context.Context, tx *sql.Tx, msg *store.Message) (int64, error) {
+	if msg.Kind == "" {
+		msg.Kind = store.KindUser
+	}
+	if msg.Format == "" {
+		msg.Format = markup.FormatPlain
+	}
+	var system sql.NullString
+	if msg.System != nil {
+		encoded, err := json.Marshal(msg.System)
+		if err != nil {
+			return 0, err
+		}
+		system = sql.NullString{String: string(encoded), Valid: true}
+	}
+
+	t := now()
+	msg.CreatedAt, msg.UpdatedAt, msg.ExpiresAt = t, t, nil
+	if msg.Kind == store.KindUser {
+		var seconds int
+		err := tx.QueryRowContext(ctx, "SELECT ttl_seconds FROM disappearing_messages WHERE username = ?1 AND peer = ?2",
+			msg.Sender, msg.Receiver).Scan(&seconds)
+		switch {
+		case err == nil:
+			expiresAt := t.Add(time.Duration(seconds) * time.Second)
+			msg.ExpiresAt = &expiresAt
+		case err != sql.ErrNoRows:
+			return 0, err
+		}
+	}
+
+	err := tx.QueryRowContext(ctx, `
+		INSERT INTO conversation_seqs (user_a, user_b, last_seq) VALUES (min(?1, ?2), max(?1, ?2), 1)
+		ON CONFLICT (user_a, user_b) DO UPDATE SET last_seq = last_seq + 1
+		RETURNING last_seq`, msg.Sender, msg.Receiver).Scan(&msg.Seq)
+	if err != nil {
+		return 0, err
+	}
+
+	res, err := tx.ExecContext(ctx, `
+		INSERT INTO messages (sender, receiver, content, format, upvotes, downvotes, reply_to_id, kind, system_event, timestamp, updated_at, expires_at, seq, shadowed)
+		VALUES (?1, ?2, ?3, ?4, 0, 0, ?5, ?6, ?7, ?8, ?8, ?9, ?10, ?11)`,
+		msg.Sender, msg.Receiver, msg.Content, msg.Format, msg.ReplyToID, msg.Kind, system, t, msg.ExpiresAt, msg.Seq, msg.Shadowed)
+	if err != nil {
+		return 0, err
+	}
+	id, err := res.LastInsertId()
+	if err != nil {
+		return 0, err
+	}
+
+	if _, err := tx.ExecContext(ctx, "INSERT INTO message_status (message_id, status) VALUES (?1, ?2)", id, store.StatusSent); err != nil {
+		return 0, err
+	}
+	if msg.Shadowed {
+		if _, err := tx.ExecContext(ctx, "INSERT INTO message_deletions (username, message_id) VALUES (?1, ?2)", msg.Receiver, id); err != nil {
+			return 0, err
+		}
+	}
+	return id, nil
+}
+
+// CreateMessages inserts every message in one transaction. Statements run
+// in process rather than over a connection, so inserting them one by one
+// costs little; committing once is what keeps a batch cheap.
+func (s *Store) CreateMessages(ctx context.Context, msgs []*store.Message) error {
+	if len(msgs) == 0 {
+		return nil
+	}
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	ids := make([]int64, len(msgs))
+	for i, msg := range msgs {
+		if ids[i], err = insertMessage(ctx, tx, msg); err != nil {
+			return err
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+
+	for i, msg := range msgs {
+		msg.ID = fmt.Sprintf("%d", ids[i])
+		msg.Status = store.StatusSent
+	}
+	return nil
+}
+
+func (s *Store) Message(ctx context.Context, id string) (store.Message, error) {
+	msg, err := scanMessage(s.db.QueryRowContext(ctx, `SELECT `+messageColumns+` `+messageFrom+` WHERE m.id = ?1`, id))
+	if err != nil {
+		return msg, notFound(err)
+	}
+
+	messages := []store.Message{msg}
+	err = s.loadAttachments(ctx, messages)
+	return messages[0], err
+}
+
+func (s *Store) Conversation(ctx context.Context, viewer, other string, since time.Time) ([]store.Message, error) {
+	// Timestamps are stored as text in UTC, so since must be too.
+	var after interface{}
+	if !since.IsZero() {
+		after = since.UTC()
+	}
+
+	return s.queryMessages(ctx, `
+		SELECT `+messageColumns+`
+		`+messageFrom+`
+		WHERE ((m.sender = ?1 AND m.receiver = ?2) OR (m.sender = ?2 AND m.receiver = ?1))
+		AND (?3 IS NULL OR m.updated_at > ?3)
+		AND `+notDeletedFor+`
+		ORDER BY m.timestamp`, viewer, other, after)
+}
+
+func (s *Store) RecentMessages(ctx context.Context, viewer, other string, limit int) ([]store.Message, error) {
+	messages, err := s.queryMessages(ctx, `
+		SELECT `+messageColumns+`
+		`+messageFrom+`
+		WHERE ((m.sender = ?1 AND m.receiver = ?2) OR (m.sender = ?2 AND m.receiver = ?1))
+		AND `+notDeletedFor+`
+		ORDER BY m.timestamp DESC, m.id DESC
+		LIMIT ?3`, viewer, other, limit)
+	if err != nil {
+		return nil, err
+	}
+
+	for i, j := 0, len(messages)-1; i < j; i, j = i+1, j-1 {
+		messages[i], messages[j] = messages[j], messages[i]
+	}
+	return messages, nil
+}
+
+func (s *Store) MessagesBefore(ctx context.Context, viewer, other, before string, limit int) ([]store.Message, error) {
+	var cursor interface{}
+	if before != "" {
+		cursor = before
+	}
+
+	// Messages are ordered by (timestamp, id) so messages sent in the same
+	// instant page consistently.
+	messages, err := s.queryMessages(ctx, `
+		SELECT `+messageColumns+`
+		`+messageFrom+`
+		WHERE ((m.sender = ?1 AND m.receiver = ?2) OR (m.sender = ?2 AND m.receiver = ?1))
+		AND `+notDeletedFor+`
+		AND (?3 IS NULL OR (m.timestamp, m.id) < (SELECT c.timestamp, c.id FROM messages c WHERE c.id = ?3))
+		ORDER BY m.timestamp DESC, m.id DESC
+		LIMIT ?4`, viewer, other, cursor, limit)
+	if err != nil {
+		return nil, err
+	}
+
+	for i, j := 0, len(messages)-1; i < j; i, j = i+1, j-1 {
+		messages[i], messages[j] = messages[j], messages[i]
+	}
+	return messages, nil
+}
+
+func (s *Store) MessagesAfter(ctx context.Context, username string, afterID, limit int) ([]store.Message, error) {
+	return s.queryMessages(ctx, `
+		SELECT `+messageColumns+`
+		`+messageFrom+`
+		WHERE (m.sender = ?1 OR m.receiver = ?1)
+		AND m.id > ?2
+		AND `+notDeletedFor+`
+		ORDER BY m.id
+		LIMIT ?3`, username, afterID, limit)
+}
+
+func (s *Store) MessagesAfterSeq(ctx context.Context, viewer, other string, afterSeq int64, limit int) ([]store.Message, error) {
+	return s.queryMessages(ctx, `
+		SELECT `+messageColumns+`
+		`+messageFrom+`
+		WHERE ((m.sender = ?1 AND m.receiver = ?2) OR (m.sender = ?2 AND m.receiver = ?1))
+		AND m.seq > ?3
+		AND `+notDeletedFor+`
+		ORDER BY m.seq
+		LIMIT ?4`, viewer, other, afterSeq, limit)
+}
+
+func (s *Store) MessagesByID(ctx context.Context, viewer string, ids []string) ([]store.Message, error) {
+	return s.queryMessages(ctx, `
+		SELECT `+messageColumns+`
+		`+messageFrom+`
+		WHERE m.id IN (SELECT CAST(value AS INTEGER) FROM json_each(?2)) AND (m.sender = ?1 OR m.receiver = ?1)
+		AND `+notDeletedFor, viewer, jsonArray(ids))
+}
+
+func (s *Store) Undelivered(ctx context.Context, receiver string, afterID, limit int) ([]store.Message, error) {
+	return s.queryMessages(ctx, `
+		SELECT `+messageColumns+`
+		`+messageFrom+`
+		WHERE m.receiver = ?1 AND ms.status = 'sent' AND m.deleted_at IS NULL AND m.id > ?2
+		AND `+notDeletedFor+`
+		ORDER BY m.id
+		LIMIT ?3`, receiver, afterID, limit)
+}
+
+func (s *Store) Thread(ctx context.Context, messageID, viewer string) (string, []store.Message, error) {
+	var rootID string
+	err := s.db.QueryRowContext(ctx, `
+		WITH RECURSIVE ancestors AS (
+			SELECT id, reply_to_id FROM messages
+			WHERE id = ?1 AND (sender = ?2 OR receiver = ?2)
+			UNION ALL
+			SELECT m.id, m.reply_to_id FROM messages m
+			JOIN ancestors a ON m.id = a.reply_to_id
+		)
+		SELECT id FROM ancestors WHERE reply_to_id IS NULL`, messageID, viewer).Scan(&rootID)
+	if err != nil {
+		return "", nil, notFound(err)
+	}
+
+	messages, err := s.queryMessages(ctx, `
+		WITH RECURSIVE thread AS (
+			SELECT id FROM messages WHERE id = ?2
+			UNION ALL
+			SELECT m.id FROM messages m
+			JOIN thread t ON m.reply_to_id = t.id
+		)
+		SELECT `+messageColumns+`
+		`+messageFrom+`
+		JOIN thread t ON t.id = m.id
+		WHERE `+notDeletedFor+`
+		ORDER BY m.timestamp`, viewer, rootID)
+	return rootID, messages, err
+}
+
+// Search matches messages_fts, which stems words like the english
+// configuration of Postgres. FTS4 has no ranking function, so the latest
+// matches come first.
+func (s *Store) Search(ctx context.Context, viewer, query string, limit, offset int) ([]store.SearchResult, error) {
+	results := []store.SearchResult{}
+	match := ftsQuery(query)
+	if match == "" {
+		return results, nil
+	}
+
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT `+messageColumns+`,
+			snippet(messages_fts, '<mark>', '</mark>', ' ... ', -1, 35)
+		`+messageFrom+`
+		JOIN messages_fts ON messages_fts.docid = m.id
+		WHERE (m.sender = ?1 OR m.receiver = ?1)
+		AND m.deleted_at IS NULL
+		AND messages_fts MATCH ?2
+		AND `+notDeletedFor+`
+		ORDER BY m.timestamp DESC
+		LIMIT ?3 OFFSET ?4`, viewer, match, limit, offset)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var r store.SearchResult
+		var err error
+		r.Message, err = scanMessage(rows, &r.Highlight)
+		if err != nil {
+			return nil, err
+		}
+		results = append(results, r)
+	}
+	return results, rows.Err()
+}
+
+// ftsQuery turns a web search style query, as websearch_to_tsquery reads
+// it, into an FTS4 query: words and "quoted phrases" must all match, unless
+// joined by or, and -word must not. Every term is quoted, so nothing the
+// user types is taken for FTS syntax. It returns "" if nothing could match.
+func ftsQuery(query string) string {
+	var terms []string
+	negated := false
+	for len(query) > 0 {
+		query = strings.TrimLeft(query, " \t\r\n")
+		if query == "" {
+			break
+		}
+
+		var term string
+		if query[0] == '"' {
+			phrase, rest, _ := strings.Cut(query[1:], `"`)
+			term, query = phrase, rest
+		} else {
+			end := strings.IndexAny(query, " \t\r\n")
+			if end < 0 {
+				end = len(query)
+			}
+			term, query = query[:end], query[end:]
+			if strings.EqualFold(term, "or") {
+				if len(terms) > 0 && terms[len(terms)-1] != "OR" {
+					terms = append(terms, "OR")
+				}
+				continue
+			}
+			if strings.HasPrefix(term, "-") {
+				term = term[1:]
+				negated = true
+			}
+		}
+
+		term = strings.TrimSpace(strings.ReplaceAll(term, `"`, ""))
+		if term == "" {
+			negated = false
+			continue
+		}
+		quoted := `"` + term + `"`
+		switch {
+		case negated && len(terms) > 0 && terms[len(terms)-1] != "OR":
+			// NOT needs a term before it to exclude from.
+			terms = append(terms, "NOT", quoted)
+		case !negated:
+			terms = append(terms, quoted)
+		}
+		negated = false
+	}
+
+	if len(terms) > 0 && terms[len(terms)-1] == "OR" {
+		terms = terms[:len(terms)-1]
+	}
+	return strings.Join(terms, " ")
+}
+
+func (s *Store) ReplyPreview(ctx context.Context, replyToID, sender, receiver string) (*store.ReplyPreview, error) {
+	var parentSender, content string
+	var deleted bool
+	err := s.db.QueryRowContext(ctx, `
+		SELECT sender, CASE WHEN deleted_at IS NULL THEN content ELSE '' END, deleted_at IS NOT NULL
+		FROM messages
+		WHERE id = ?1 AND kind = 'user' AND ((sender = ?2 AND receiver = ?3) OR (sender = ?3 AND receiver = ?2))`,
+		replyToID, sender, receiver).Scan(&parentSender, &content, &deleted)
+	if err == sql.ErrNoRows {
+		return nil, store.ErrInvalidReplyTo
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return store.NewReplyPreview(replyToID, parentSender, content, deleted), nil
+}
+
+func (s *Store) Participants(ctx context.Context, id string) (string, string, error) {
+	var sender, receiver string
+	err := s.db.QueryRowContext(ctx, "SELECT sender, receiver FROM messages WHERE id = ?1", id).Scan(&sender, &receiver)
+	return sender, receiver, notFound(err)
+}
+
+func (s *Store) DeleteForUser(ctx context.Context, id, username string) error {
+	_, err := s.db.ExecContext(ctx,
+		"INSERT INTO message_deletions (username, message_id, deleted_at) VALUES (?1, ?2, ?3) ON CONFLICT DO NOTHING",
+		username, id, now(),
+	)
+	return err
+}
+
+func (s *Store) DeleteForEveryone(ctx context.Context, id string) error {
+	_, err := s.db.ExecContext(ctx, "UPDATE messages SET deleted_at = ?2, updated_at = ?2 WHERE id = ?1 AND deleted_at IS NULL", id, now())
+	return err
+}
+
+func (s *Store) MarkDelivered(ctx context.Context, id, receiver string) (bool, error) {
+	res, err := s.db.ExecContext(ctx, `
+		UPDATE message_status
+		SET status = 'delivered', delivered_at = ?3
+		WHERE message_id = ?1 AND status = 'sent'
+		AND EXISTS (SELECT 1 FROM messages m WHERE m.id = ?1 AND m.receiver = ?2)`,
+		id, receiver, now())
+	if err != nil {
+		return false, err
+	}
+
+	n, _ := res.RowsAffected()
+	return n > 0, nil
+}
+
+func (s *Store) MarkReadUpTo(ctx context.Context, id, receiver string) ([]string, error) {
+	var sender string
+	err := s.db.QueryRowContext(ctx, "SELECT sender FROM messages WHERE id = ?1 AND receiver = ?2", id, receiver).Scan(&sender)
+	if err != nil {
+		return nil, notFound(err)
+	}
+
+	rows, err := s.db.QueryContext(ctx, `
+		UPDATE message_status
+		SET status = 'read',
+			delivered_at = COALESCE(delivered_at, ?4),
+			read_at = ?4
+		WHERE status != 'read'
+		AND message_id IN (SELECT id FROM messages WHERE sender = ?1 AND receiver = ?2 AND id <= ?3)
+		RETURNING message_id`, sender, receiver, id, now())
+	if err != nil {
+		return nil, err
+	}
+	return scanStrings(rows)
+}
+
+func (s *Store) MarkConversationReadUpTo(ctx context.Context, reader, peer, id string) ([]string, error) {
+	var found int
+	err := s.db.QueryRowContext(ctx, `
+		SELECT 1 FROM messages
+		WHERE id = ?1 AND ((sender = ?2 AND receiver = ?3) OR (sender = ?3 AND receiver = ?2))`,
+		id, reader, peer).Scan(&found)
+	if err != nil {
+		return nil, notFound(err)
+	}
+
+	rows, err := s.db.QueryContext(ctx, `
+		UPDATE message_status
+		SET status = 'read',
+			delivered_at = COALESCE(delivered_at, ?4),
+			read_at = ?4
+		WHERE status != 'read'
+		AND message_id IN (SELECT id FROM messages WHERE sender = ?1 AND receiver = ?2 AND id <= ?3)
+		RETURNING message_id`, peer, reader, id, now())
+	if err != nil {
+		return nil, err
+	}
+	return scanStrings(rows)
+}
@@ -0,0 +1,34 @@
+DROP TABLE IF EXISTS channel_posts;
+DROP TABLE IF EXISTS channel_subscriptions;
+DROP TABLE IF EXISTS channel_senders;
+DROP TABLE IF EXISTS channels;
+DROP TABLE IF EXISTS audit_log;
+DROP TABLE IF EXISTS incoming_hooks;
+DROP TABLE IF EXISTS bot_commands;
+DROP TABLE IF EXISTS bots;
+DROP TABLE IF EXISTS webhook_deliveries;
+DROP TABLE IF EXISTS webhooks;
+DROP TABLE IF EXISTS api_keys;
+DROP TRIGGER IF EXISTS messages_delete_dependents;
+DROP TABLE IF EXISTS mentions;
+DROP TABLE IF EXISTS pinned_messages;
+DROP TABLE IF EXISTS disappearing_messages;
+DROP TABLE IF EXISTS scheduled_messages;
+DROP TABLE IF EXISTS message_flags;
+DROP TABLE IF EXISTS conversation_filters;
+DROP TABLE IF EXISTS user_statuses;
+DROP TABLE IF EXISTS conversation_mutes;
+DROP TABLE IF EXISTS notification_preferences;
+DROP TABLE IF EXISTS device_tokens;
+DROP TABLE IF EXISTS blocks;
+DROP TABLE IF EXISTS sessions;
+DROP TABLE IF EXISTS user_votes;
+DROP TABLE IF EXISTS pending_uploads;
+DROP TABLE IF EXISTS attachment_variants;
+DROP TABLE IF EXISTS attachments;
+DROP TABLE IF EXISTS message_deletions;
+DROP TABLE IF EXISTS message_status;
+DROP TABLE IF EXISTS messages_fts;
+DROP TABLE IF EXISTS messages_archive;
+DROP TABLE IF EXISTS messages;
+DROP TABLE IF EXISTS users;
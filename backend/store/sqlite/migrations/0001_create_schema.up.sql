@@ -0,0 +1,394 @@
+-- The schema store/postgres reaches with its migrations through 0039, in
+-- SQLite terms: serials are INTEGER PRIMARY KEY, arrays and JSONB are JSON
+-- text, and timestamps are text in UTC. Messages are not partitioned;
+-- retention moves old ones to messages_archive instead.
+CREATE TABLE users (
+    id INTEGER PRIMARY KEY,
+    username VARCHAR(50) UNIQUE NOT NULL,
+    password VARCHAR(100) NOT NULL,
+    last_seen TIMESTAMP,
+    email VARCHAR(255),
+    role VARCHAR(20) NOT NULL DEFAULT 'user',
+    banned_at TIMESTAMP,
+    deletion_requested_at TIMESTAMP,
+    erased_at TIMESTAMP
+);
+
+CREATE UNIQUE INDEX idx_users_email ON users (email);
+
+-- AUTOINCREMENT keeps the IDs of deleted messages from being reused, since
+-- votes, archived rows and clients may still refer to them.
+CREATE TABLE messages (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    sender VARCHAR(255) NOT NULL,
+    receiver VARCHAR(255) NOT NULL,
+    content TEXT NOT NULL,
+    timestamp TIMESTAMP NOT NULL,
+    upvotes INTEGER DEFAULT 0,
+    downvotes INTEGER DEFAULT 0,
+    deleted_at TIMESTAMP,
+    reply_to_id INTEGER,
+    updated_at TIMESTAMP NOT NULL,
+    expires_at TIMESTAMP,
+    kind VARCHAR(16) NOT NULL DEFAULT 'user',
+    system_event TEXT,
+    format VARCHAR(16) NOT NULL DEFAULT 'plain'
+);
+
+CREATE INDEX idx_messages_sender_timestamp ON messages (sender, timestamp);
+CREATE INDEX idx_messages_receiver_timestamp ON messages (receiver, timestamp);
+CREATE INDEX idx_messages_reply_to_id ON messages (reply_to_id);
+CREATE INDEX idx_messages_expires_at ON messages (expires_at) WHERE expires_at IS NOT NULL;
+
+-- Messages moved out of messages by the retention job, with the same
+-- columns in the same order.
+CREATE TABLE messages_archive (
+    id INTEGER PRIMARY KEY,
+    sender VARCHAR(255) NOT NULL,
+    receiver VARCHAR(255) NOT NULL,
+    content TEXT NOT NULL,
+    timestamp TIMESTAMP NOT NULL,
+    upvotes INTEGER DEFAULT 0,
+    downvotes INTEGER DEFAULT 0,
+    deleted_at TIMESTAMP,
+    reply_to_id INTEGER,
+    updated_at TIMESTAMP NOT NULL,
+    expires_at TIMESTAMP,
+    kind VARCHAR(16) NOT NULL DEFAULT 'user',
+    system_event TEXT,
+    format VARCHAR(16) NOT NULL DEFAULT 'plain'
+);
+
+-- Full-text search over content, kept in step with messages by the
+-- triggers below. The porter tokenizer stems English words, like the
+-- english configuration of Postgres.
+CREATE VIRTUAL TABLE messages_fts USING fts4(content="messages", content, tokenize=porter);
+
+CREATE TRIGGER messages_fts_insert AFTER INSERT ON messages BEGIN
+    INSERT INTO messages_fts (docid, content) VALUES (NEW.id, NEW.content);
+END;
+
+CREATE TRIGGER messages_fts_before_update BEFORE UPDATE OF content ON messages BEGIN
+    DELETE FROM messages_fts WHERE docid = OLD.id;
+END;
+
+CREATE TRIGGER messages_fts_after_update AFTER UPDATE OF content ON messages BEGIN
+    INSERT INTO messages_fts (docid, content) VALUES (NEW.id, NEW.content);
+END;
+
+CREATE TRIGGER messages_fts_delete BEFORE DELETE ON messages BEGIN
+    DELETE FROM messages_fts WHERE docid = OLD.id;
+END;
+
+CREATE TABLE message_status (
+    message_id INTEGER PRIMARY KEY,
+    status VARCHAR(20) NOT NULL DEFAULT 'sent', -- 'sent', 'delivered' or 'read'
+    delivered_at TIMESTAMP,
+    read_at TIMESTAMP
+);
+
+CREATE TABLE message_deletions (
+    username VARCHAR(50) NOT NULL,
+    message_id INTEGER NOT NULL,
+    deleted_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (username, message_id)
+);
+
+CREATE INDEX idx_message_deletions_message_id ON message_deletions (message_id);
+
+-- Images are processed after upload. media_status is NULL for files that
+-- are not processed, and pending, ready or failed for images.
+CREATE TABLE attachments (
+    id INTEGER PRIMARY KEY,
+    message_id INTEGER NOT NULL,
+    uploader VARCHAR(50) NOT NULL,
+    filename VARCHAR(255) NOT NULL,
+    content_type VARCHAR(100) NOT NULL,
+    size BIGINT NOT NULL,
+    storage_key VARCHAR(255) NOT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    media_status VARCHAR(16),
+    width INTEGER,
+    height INTEGER,
+    media_claimed_until TIMESTAMP
+);
+
+CREATE INDEX idx_attachments_message_id ON attachments (message_id);
+CREATE INDEX idx_attachments_uploader ON attachments (uploader);
+CREATE INDEX idx_attachments_media_pending ON attachments (id) WHERE media_status = 'pending';
+
+CREATE TABLE attachment_variants (
+    attachment_id INTEGER NOT NULL REFERENCES attachments(id) ON DELETE CASCADE,
+    variant VARCHAR(32) NOT NULL,
+    content_type VARCHAR(100) NOT NULL,
+    width INTEGER NOT NULL,
+    height INTEGER NOT NULL,
+    size BIGINT NOT NULL,
+    storage_key VARCHAR(255) NOT NULL,
+    PRIMARY KEY (attachment_id, variant)
+);
+
+-- Files clients upload straight to the blob store wait here until they are
+-- sent, or are deleted once they expire.
+CREATE TABLE pending_uploads (
+    storage_key VARCHAR(255) PRIMARY KEY,
+    uploader VARCHAR(50) NOT NULL,
+    filename VARCHAR(255) NOT NULL,
+    content_type VARCHAR(100) NOT NULL,
+    size BIGINT NOT NULL,
+    expires_at TIMESTAMP NOT NULL
+);
+
+CREATE INDEX idx_pending_uploads_expires_at ON pending_uploads (expires_at);
+CREATE INDEX idx_pending_uploads_uploader ON pending_uploads (uploader);
+
+CREATE TABLE user_votes (
+    user_id VARCHAR(255),
+    message_id VARCHAR(255),
+    vote_type VARCHAR(20), -- 'upvote' or 'downvote'
+    PRIMARY KEY (user_id, message_id)
+);
+
+CREATE INDEX idx_user_votes_message_id ON user_votes (message_id);
+
+CREATE TABLE sessions (
+    id INTEGER PRIMARY KEY,
+    username VARCHAR(50) NOT NULL,
+    token_hash VARCHAR(64) UNIQUE NOT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    expires_at TIMESTAMP NOT NULL,
+    revoked_at TIMESTAMP
+);
+
+CREATE TABLE blocks (
+    blocker VARCHAR(50) NOT NULL,
+    blocked VARCHAR(50) NOT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (blocker, blocked)
+);
+
+CREATE TABLE device_tokens (
+    id INTEGER PRIMARY KEY,
+    username VARCHAR(50) NOT NULL,
+    platform VARCHAR(10) NOT NULL,
+    token TEXT NOT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE (platform, token)
+);
+
+CREATE TABLE notification_preferences (
+    username VARCHAR(50) PRIMARY KEY,
+    push_enabled BOOLEAN NOT NULL DEFAULT TRUE,
+    show_preview BOOLEAN NOT NULL DEFAULT TRUE,
+    quiet_hours_start VARCHAR(5),
+    quiet_hours_end VARCHAR(5),
+    quiet_hours_time_zone VARCHAR(64)
+);
+
+CREATE TABLE conversation_mutes (
+    username VARCHAR(255) NOT NULL,
+    peer VARCHAR(255) NOT NULL,
+    muted_until TIMESTAMP,
+    PRIMARY KEY (username, peer)
+);
+
+CREATE TABLE user_statuses (
+    username VARCHAR(255) PRIMARY KEY,
+    availability VARCHAR(16) NOT NULL DEFAULT 'available',
+    text VARCHAR(100) NOT NULL DEFAULT '',
+    emoji VARCHAR(32) NOT NULL DEFAULT '',
+    expires_at TIMESTAMP,
+    updated_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE conversation_filters (
+    username VARCHAR(255) NOT NULL,
+    peer VARCHAR(255) NOT NULL,
+    strictness VARCHAR(10) NOT NULL,
+    PRIMARY KEY (username, peer)
+);
+
+CREATE TABLE message_flags (
+    id INTEGER PRIMARY KEY,
+    message_id INTEGER,
+    sender VARCHAR(255) NOT NULL,
+    receiver VARCHAR(255) NOT NULL,
+    content TEXT NOT NULL,
+    reason TEXT NOT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE scheduled_messages (
+    id INTEGER PRIMARY KEY,
+    sender VARCHAR(255) NOT NULL,
+    receiver VARCHAR(255) NOT NULL,
+    content TEXT NOT NULL,
+    reply_to_id INTEGER,
+    send_at TIMESTAMP NOT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    format VARCHAR(16) NOT NULL DEFAULT 'plain'
+);
+
+CREATE INDEX idx_scheduled_messages_send_at ON scheduled_messages (send_at);
+CREATE INDEX idx_scheduled_messages_sender ON scheduled_messages (sender);
+
+CREATE TABLE disappearing_messages (
+    username VARCHAR(255) NOT NULL,
+    peer VARCHAR(255) NOT NULL,
+    ttl_seconds INTEGER NOT NULL,
+    PRIMARY KEY (username, peer)
+);
+
+CREATE TABLE pinned_messages (
+    message_id INTEGER PRIMARY KEY,
+    pinned_by VARCHAR(255) NOT NULL,
+    pinned_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE mentions (
+    message_id INTEGER NOT NULL,
+    username VARCHAR(255) NOT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (message_id, username)
+);
+
+CREATE INDEX idx_mentions_username ON mentions (username, created_at DESC);
+
+-- Deleting a message deletes what belongs to it and clears replies to it,
+-- as the trigger of the same name does in Postgres. Messages retention
+-- archived keep their attachments and who deleted them.
+CREATE TRIGGER messages_delete_dependents AFTER DELETE ON messages BEGIN
+    DELETE FROM message_status WHERE message_id = OLD.id;
+    DELETE FROM message_flags WHERE message_id = OLD.id;
+    DELETE FROM pinned_messages WHERE message_id = OLD.id;
+    DELETE FROM mentions WHERE message_id = OLD.id;
+    DELETE FROM message_deletions WHERE message_id = OLD.id
+        AND NOT EXISTS (SELECT 1 FROM messages_archive WHERE id = OLD.id);
+    DELETE FROM attachments WHERE message_id = OLD.id
+        AND NOT EXISTS (SELECT 1 FROM messages_archive WHERE id = OLD.id);
+    UPDATE messages SET reply_to_id = NULL WHERE reply_to_id = OLD.id;
+    UPDATE scheduled_messages SET reply_to_id = NULL WHERE reply_to_id = OLD.id;
+END;
+
+CREATE TABLE api_keys (
+    id INTEGER PRIMARY KEY,
+    name VARCHAR(100) NOT NULL,
+    key_hash VARCHAR(64) UNIQUE NOT NULL,
+    created_by VARCHAR(50) NOT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    last_used_at TIMESTAMP,
+    revoked_at TIMESTAMP
+);
+
+CREATE TABLE webhooks (
+    id INTEGER PRIMARY KEY,
+    url TEXT NOT NULL,
+    secret VARCHAR(255) NOT NULL,
+    events TEXT NOT NULL, -- JSON array of event types
+    created_by VARCHAR(50) NOT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    bot VARCHAR(50)
+);
+
+CREATE TABLE webhook_deliveries (
+    id INTEGER PRIMARY KEY,
+    webhook_id INTEGER NOT NULL REFERENCES webhooks(id) ON DELETE CASCADE,
+    event_type VARCHAR(50) NOT NULL,
+    payload TEXT NOT NULL,
+    status VARCHAR(10) NOT NULL DEFAULT 'pending',
+    attempts INTEGER NOT NULL DEFAULT 0,
+    response_status INTEGER,
+    error TEXT,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    next_attempt_at TIMESTAMP,
+    delivered_at TIMESTAMP
+);
+
+CREATE INDEX idx_webhook_deliveries_due ON webhook_deliveries (next_attempt_at) WHERE status = 'pending';
+CREATE INDEX idx_webhook_deliveries_webhook ON webhook_deliveries (webhook_id, id);
+
+CREATE TABLE bots (
+    username VARCHAR(50) PRIMARY KEY,
+    token_hash VARCHAR(64) UNIQUE NOT NULL,
+    created_by VARCHAR(50) NOT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE bot_commands (
+    name VARCHAR(32) PRIMARY KEY,
+    bot VARCHAR(50) NOT NULL,
+    description VARCHAR(200) NOT NULL DEFAULT '',
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX idx_bot_commands_bot ON bot_commands (bot);
+
+CREATE TABLE incoming_hooks (
+    id INTEGER PRIMARY KEY,
+    name VARCHAR(100) NOT NULL,
+    token_hash VARCHAR(64) UNIQUE NOT NULL,
+    bot VARCHAR(50) NOT NULL,
+    receiver VARCHAR(50) NOT NULL,
+    created_by VARCHAR(50) NOT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    last_used_at TIMESTAMP
+);
+
+CREATE TABLE audit_log (
+    id INTEGER PRIMARY KEY,
+    action VARCHAR(50) NOT NULL,
+    actor VARCHAR(255) NOT NULL DEFAULT '',
+    target VARCHAR(255) NOT NULL DEFAULT '',
+    ip VARCHAR(64) NOT NULL DEFAULT '',
+    user_agent TEXT NOT NULL DEFAULT '',
+    details TEXT,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX idx_audit_log_actor ON audit_log (actor, id);
+CREATE INDEX idx_audit_log_action ON audit_log (action, id);
+CREATE INDEX idx_audit_log_target ON audit_log (target, id);
+
+-- The audit log is append-only: rows can be inserted but never changed or
+-- removed, not even when the user they name is renamed or erased.
+CREATE TRIGGER audit_log_no_update BEFORE UPDATE ON audit_log BEGIN
+    SELECT RAISE(ABORT, 'audit_log is append-only');
+END;
+
+CREATE TRIGGER audit_log_no_delete BEFORE DELETE ON audit_log BEGIN
+    SELECT RAISE(ABORT, 'audit_log is append-only');
+END;
+
+CREATE TABLE channels (
+    id INTEGER PRIMARY KEY,
+    name VARCHAR(64) UNIQUE NOT NULL,
+    description VARCHAR(500) NOT NULL DEFAULT '',
+    created_by VARCHAR(50) NOT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE channel_senders (
+    channel_id INTEGER NOT NULL REFERENCES channels(id) ON DELETE CASCADE,
+    username VARCHAR(50) NOT NULL,
+    PRIMARY KEY (channel_id, username)
+);
+
+CREATE TABLE channel_subscriptions (
+    channel_id INTEGER NOT NULL REFERENCES channels(id) ON DELETE CASCADE,
+    username VARCHAR(50) NOT NULL,
+    subscribed_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (channel_id, username)
+);
+
+CREATE INDEX idx_channel_subscriptions_username ON channel_subscriptions (username);
+
+-- A post is stored once, however many subscribers its channel has.
+CREATE TABLE channel_posts (
+    id INTEGER PRIMARY KEY,
+    channel_id INTEGER NOT NULL REFERENCES channels(id) ON DELETE CASCADE,
+    sender VARCHAR(50) NOT NULL,
+    content TEXT NOT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX idx_channel_posts_channel ON channel_posts (channel_id, id);
@@ -0,0 +1,4 @@
+DROP INDEX IF EXISTS idx_messages_conversation_seq;
+ALTER TABLE messages_archive DROP COLUMN seq;
+ALTER TABLE messages DROP COLUMN seq;
+DROP TABLE IF EXISTS conversation_seqs;
@@ -0,0 +1,27 @@
+-- seq numbers the messages of each conversation from 1 in the order they
+-- were sent, as in store/postgres. conversation_seqs holds the last number
+-- handed out per conversation, keyed by its two participants in order, and
+-- outlives the messages so numbers are never reused.
+CREATE TABLE conversation_seqs (
+    user_a VARCHAR(255) NOT NULL,
+    user_b VARCHAR(255) NOT NULL,
+    last_seq INTEGER NOT NULL,
+    PRIMARY KEY (user_a, user_b)
+);
+
+ALTER TABLE messages ADD COLUMN seq INTEGER NOT NULL DEFAULT 0;
+-- messages_archive keeps the columns of messages in the same order.
+ALTER TABLE messages_archive ADD COLUMN seq INTEGER NOT NULL DEFAULT 0;
+
+UPDATE messages SET seq = n.seq
+FROM (
+    SELECT id, row_number() OVER (PARTITION BY min(sender, receiver), max(sender, receiver) ORDER BY id) AS seq
+    FROM messages
+) n
+WHERE messages.id = n.id;
+
+INSERT INTO conversation_seqs (user_a, user_b, last_seq)
+SELECT min(sender, receiver), max(sender, receiver), max(seq) FROM messages
+GROUP BY 1, 2;
+
+CREATE INDEX idx_messages_conversation_seq ON messages (sender, receiver, seq);
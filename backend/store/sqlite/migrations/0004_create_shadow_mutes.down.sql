@@ -0,0 +1,5 @@
+ALTER TABLE channel_posts DROP COLUMN shadowed;
+ALTER TABLE messages_archive DROP COLUMN shadowed;
+ALTER TABLE messages DROP COLUMN shadowed;
+DROP TABLE IF EXISTS channel_shadow_mutes;
+DROP TABLE IF EXISTS shadow_mutes;
@@ -0,0 +1,22 @@
+-- Shadow mutes, as in store/postgres: shadow_mutes holds global mutes and
+-- channel_shadow_mutes those of one channel.
+CREATE TABLE shadow_mutes (
+    username VARCHAR(50) PRIMARY KEY,
+    muted_by VARCHAR(50) NOT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE channel_shadow_mutes (
+    channel_id INTEGER NOT NULL REFERENCES channels(id) ON DELETE CASCADE,
+    username VARCHAR(50) NOT NULL,
+    muted_by VARCHAR(50) NOT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (channel_id, username)
+);
+
+CREATE INDEX idx_channel_shadow_mutes_username ON channel_shadow_mutes (username);
+
+ALTER TABLE messages ADD COLUMN shadowed BOOLEAN NOT NULL DEFAULT FALSE;
+-- messages_archive keeps the columns of messages in the same order.
+ALTER TABLE messages_archive ADD COLUMN shadowed BOOLEAN NOT NULL DEFAULT FALSE;
+ALTER TABLE channel_posts ADD COLUMN shadowed BOOLEAN NOT NULL DEFAULT FALSE;
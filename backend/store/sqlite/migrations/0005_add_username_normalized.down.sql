@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS idx_users_username_normalized;
+ALTER TABLE users DROP COLUMN username_normalized;
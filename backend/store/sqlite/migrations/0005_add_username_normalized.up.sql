@@ -0,0 +1,10 @@
+-- Usernames are unique ignoring case and Unicode presentation. The server
+-- fills in the normalized form; lower is its equivalent for the names that
+-- already exist. Where several differ only in case, the oldest account
+-- keeps the normalized form and the others go without one.
+ALTER TABLE users ADD COLUMN username_normalized TEXT;
+
+UPDATE users SET username_normalized = lower(username)
+WHERE NOT EXISTS (SELECT 1 FROM users o WHERE lower(o.username) = lower(users.username) AND o.id < users.id);
+
+CREATE UNIQUE INDEX idx_users_username_normalized ON users (username_normalized);
@@ -0,0 +1,2 @@
+-- Passwords hashed before the algorithm was recorded are bcrypt hashes.
+ALTER TABLE users ADD COLUMN password_algo TEXT NOT NULL DEFAULT 'bcrypt';
@@ -0,0 +1,4 @@
+DROP INDEX idx_sessions_username;
+ALTER TABLE sessions DROP COLUMN last_active_at;
+ALTER TABLE sessions DROP COLUMN ip;
+ALTER TABLE sessions DROP COLUMN device;
@@ -0,0 +1,7 @@
+-- Sessions record the client they were last used from. Sessions started
+-- before were last active, as far as is known, when they started.
+ALTER TABLE sessions ADD COLUMN device TEXT NOT NULL DEFAULT '';
+ALTER TABLE sessions ADD COLUMN ip TEXT NOT NULL DEFAULT '';
+ALTER TABLE sessions ADD COLUMN last_active_at TIMESTAMP;
+UPDATE sessions SET last_active_at = created_at;
+CREATE INDEX idx_sessions_username ON sessions (username);
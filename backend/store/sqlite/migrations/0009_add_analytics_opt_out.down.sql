@@ -0,0 +1 @@
+ALTER TABLE users DROP COLUMN analytics_opt_out;
@@ -0,0 +1,2 @@
+-- An empty locale answers users in the language their client asks for.
+ALTER TABLE users ADD COLUMN locale TEXT NOT NULL DEFAULT '';
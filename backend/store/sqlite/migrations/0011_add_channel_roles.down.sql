@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS idx_channel_posts_pinned;
+ALTER TABLE channel_posts DROP COLUMN pinned;
+ALTER TABLE channel_subscriptions DROP COLUMN role;
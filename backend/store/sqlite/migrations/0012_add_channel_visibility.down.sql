@@ -0,0 +1,2 @@
+ALTER TABLE channels DROP COLUMN visibility;
+ALTER TABLE channels DROP COLUMN topic;
@@ -0,0 +1,3 @@
+-- Existing channels stay public.
+ALTER TABLE channels ADD COLUMN topic VARCHAR(250) NOT NULL DEFAULT '';
+ALTER TABLE channels ADD COLUMN visibility VARCHAR(10) NOT NULL DEFAULT 'public';
@@ -0,0 +1,3 @@
+ALTER TABLE channel_posts DROP COLUMN system_event;
+ALTER TABLE channel_posts DROP COLUMN kind;
+DROP TABLE IF EXISTS channel_invites;
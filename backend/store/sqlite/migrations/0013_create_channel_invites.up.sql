@@ -0,0 +1,17 @@
+CREATE TABLE channel_invites (
+    id INTEGER PRIMARY KEY,
+    channel_id INTEGER NOT NULL REFERENCES channels(id) ON DELETE CASCADE,
+    token_hash VARCHAR(64) UNIQUE NOT NULL,
+    created_by VARCHAR(50) NOT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    expires_at TIMESTAMP,
+    -- 0 lets any number of users join.
+    max_uses INTEGER NOT NULL DEFAULT 0,
+    uses INTEGER NOT NULL DEFAULT 0
+);
+
+CREATE INDEX idx_channel_invites_channel ON channel_invites (channel_id, id);
+
+-- Channels get system posts, such as a member joining with an invite.
+ALTER TABLE channel_posts ADD COLUMN kind VARCHAR(16) NOT NULL DEFAULT 'user';
+ALTER TABLE channel_posts ADD COLUMN system_event TEXT;
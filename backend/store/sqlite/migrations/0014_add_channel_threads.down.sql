@@ -0,0 +1,4 @@
+DROP TABLE IF EXISTS channel_thread_subscriptions;
+DELETE FROM channel_posts WHERE parent_id IS NOT NULL;
+DROP INDEX IF EXISTS idx_channel_posts_parent;
+ALTER TABLE channel_posts DROP COLUMN parent_id;
@@ -0,0 +1,17 @@
+-- Replies form a thread under their parent and go when it does.
+ALTER TABLE channel_posts ADD COLUMN parent_id INTEGER REFERENCES channel_posts(id) ON DELETE CASCADE;
+
+CREATE INDEX idx_channel_posts_parent ON channel_posts (parent_id, id) WHERE parent_id IS NOT NULL;
+
+-- A row with subscribed false remembers that a user left a thread, so
+-- replies do not subscribe them again.
+CREATE TABLE channel_thread_subscriptions (
+    post_id INTEGER NOT NULL REFERENCES channel_posts(id) ON DELETE CASCADE,
+    username VARCHAR(50) NOT NULL,
+    subscribed BOOLEAN NOT NULL DEFAULT TRUE,
+    -- Replies up to this ID are read.
+    last_read_id INTEGER NOT NULL DEFAULT 0,
+    PRIMARY KEY (post_id, username)
+);
+
+CREATE INDEX idx_channel_thread_subscriptions_username ON channel_thread_subscriptions (username);
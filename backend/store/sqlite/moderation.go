@@ -0,0 +1,59 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+
+	"backend/store"
+)
+
+func (s *Store) Strictness(ctx context.Context, username, peer string) (string, error) {
+	var strictness string
+	err := s.db.QueryRowContext(ctx, "SELECT strictness FROM conversation_filters WHERE username = ?1 AND peer = ?2", username, peer).Scan(&strictness)
+	if err == sql.ErrNoRows {
+		return "", nil
+	}
+	return strictness, err
+}
+
+func (s *Store) SetStrictness(ctx context.Context, username, peer, strictness string) error {
+	_, err := s.db.ExecContext(ctx, `
+		INSERT INTO conversation_filters (username, peer, strictness) VALUES (?1, ?2, ?3)
+		ON CONFLICT (username, peer) DO UPDATE SET strictness = excluded.strictness`,
+		username, peer, strictness)
+	return err
+}
+
+func (s *Store) FlagMessage(ctx context.Context, f store.Flag) error {
+	var messageID sql.NullString
+	if f.MessageID != "" {
+		messageID = sql.NullString{String: f.MessageID, Valid: true}
+	}
+
+	_, err := s.db.ExecContext(ctx,
+		"INSERT INTO message_flags (message_id, sender, receiver, content, reason, created_at) VALUES (?1, ?2, ?3, ?4, ?5, ?6)",
+		messageID, f.Sender, f.Receiver, f.Content, f.Reason, now())
+	return err
+}
+
+func (s *Store) Flags(ctx context.Context, limit int) ([]store.Flag, error) {
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT id, COALESCE(CAST(message_id AS TEXT), ''), sender, receiver, content, reason, created_at
+		FROM message_flags
+		ORDER BY id DESC
+		LIMIT ?1`, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	flags := []store.Flag{}
+	for rows.Next() {
+		var f store.Flag
+		if err := rows.Scan(&f.ID, &f.MessageID, &f.Sender, &f.Receiver, &f.Content, &f.Reason, &f.CreatedAt); err != nil {
+			return nil, err
+		}
+		flags = append(flags, f)
+	}
+	return flags, rows.Err()
+}
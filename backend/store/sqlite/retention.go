@@ -0,0 +1,95 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+// monthStart returns the first instant of the month of t, in UTC like the
+// timestamps of messages.
+func monthStart(t time.Time) time.Time {
+	t = t.UTC()
+	return time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, time.UTC)
+}
+
+// EnsureMessagePartitions does nothing: SQLite has no partitions, and
+// messages are expired a month at a time instead.
+func (s *Store) EnsureMessagePartitions(ctx context.Context, from, through time.Time) error {
+	return nil
+}
+
+// ExpireMessagePartitions removes the messages of every month that ended by
+// before, as if each month were a partition of its own, oldest first.
+func (s *Store) ExpireMessagePartitions(ctx context.Context, before time.Time, archive bool) ([]string, error) {
+	var keys []string
+	for {
+		var oldest time.Time
+		err := s.db.QueryRowContext(ctx, "SELECT timestamp FROM messages ORDER BY timestamp LIMIT 1").Scan(&oldest)
+		if err == sql.ErrNoRows {
+			return keys, nil
+		}
+		if err != nil {
+			return keys, err
+		}
+
+		month := monthStart(oldest)
+		if month.AddDate(0, 1, 0).After(before) {
+			return keys, nil
+		}
+		monthKeys, err := s.expireMonth(ctx, month, archive)
+		if err != nil {
+			return keys, fmt.Errorf("expiring messages of %s: %w", month.Format("2006-01"), err)
+		}
+		keys = append(keys, monthKeys...)
+	}
+}
+
+// expireMonth removes the messages of month in one transaction, and returns
+// the blob keys of the attachments deleted with them. The delete trigger
+// removes what belongs to the messages, except the attachments and
+// deletions of archived ones, which are moved to messages_archive first.
+func (s *Store) expireMonth(ctx context.Context, month time.Time, archive bool) ([]string, error) {
+	const inMonth = "timestamp >= ?1 AND timestamp < ?2"
+	ids := "SELECT id FROM messages WHERE " + inMonth
+	from, to := month, month.AddDate(0, 1, 0)
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	var keys []string
+	if archive {
+		if _, err := tx.ExecContext(ctx, "INSERT INTO messages_archive SELECT * FROM messages WHERE "+inMonth, from, to); err != nil {
+			return nil, err
+		}
+	} else {
+		rows, err := tx.QueryContext(ctx, `
+			SELECT storage_key FROM attachments WHERE message_id IN (`+ids+`)
+			UNION ALL
+			SELECT v.storage_key FROM attachment_variants v
+			JOIN attachments a ON a.id = v.attachment_id
+			WHERE a.message_id IN (`+ids+`)`, from, to)
+		if err != nil {
+			return nil, err
+		}
+		if keys, err = scanStrings(rows); err != nil {
+			return nil, err
+		}
+	}
+
+	statements := []string{
+		// user_votes refers to messages by text ID without a foreign key.
+		"DELETE FROM user_votes WHERE message_id IN (SELECT CAST(id AS TEXT) FROM messages WHERE " + inMonth + ")",
+		"DELETE FROM messages WHERE " + inMonth,
+	}
+	for _, stmt := range statements {
+		if _, err := tx.ExecContext(ctx, stmt, from, to); err != nil {
+			return nil, err
+		}
+	}
+	return keys, tx.Commit()
+}
@@ -0,0 +1,99 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"backend/store"
+)
+
+// scheduledColumns selects a ScheduledMessage.
+const scheduledColumns = `id, sender, receiver, content, format, reply_to_id, send_at, created_at`
+
+func (s *Store) CreateScheduled(ctx context.Context, sm *store.ScheduledMessage) error {
+	createdAt := now()
+	res, err := s.db.ExecContext(ctx,
+		"INSERT INTO scheduled_messages (sender, receiver, content, format, reply_to_id, send_at, created_at) VALUES (?1, ?2, ?3, ?4, ?5, ?6, ?7)",
+		sm.Sender, sm.Receiver, sm.Content, sm.Format, sm.ReplyToID, sm.SendAt.UTC(), createdAt,
+	)
+	if err != nil {
+		return err
+	}
+	id, err := res.LastInsertId()
+	if err != nil {
+		return err
+	}
+	sm.ID, sm.CreatedAt = fmt.Sprintf("%d", id), createdAt
+	return nil
+}
+
+func (s *Store) ScheduledMessages(ctx context.Context, sender string) ([]store.ScheduledMessage, error) {
+	rows, err := s.db.QueryContext(ctx, `SELECT `+scheduledColumns+` FROM scheduled_messages WHERE sender = ?1 ORDER BY send_at, id`, sender)
+	if err != nil {
+		return nil, err
+	}
+	return scanScheduled(rows)
+}
+
+func (s *Store) CancelScheduled(ctx context.Context, id, sender string) (bool, error) {
+	res, err := s.db.ExecContext(ctx, "DELETE FROM scheduled_messages WHERE id = ?1 AND sender = ?2", id, sender)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return n > 0, err
+}
+
+// ClaimDueScheduled selects and deletes in one transaction, which holds the
+// database lock throughout, so concurrent callers never claim the same
+// message.
+func (s *Store) ClaimDueScheduled(ctx context.Context, now time.Time, limit int) ([]store.ScheduledMessage, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	rows, err := tx.QueryContext(ctx, `
+		SELECT `+scheduledColumns+` FROM scheduled_messages
+		WHERE send_at <= ?1
+		ORDER BY send_at, id
+		LIMIT ?2`, now.UTC(), limit)
+	if err != nil {
+		return nil, err
+	}
+	due, err := scanScheduled(rows)
+	if err != nil || len(due) == 0 {
+		return due, err
+	}
+
+	ids := make([]string, len(due))
+	for i, sm := range due {
+		ids[i] = sm.ID
+	}
+	if _, err := tx.ExecContext(ctx, "DELETE FROM scheduled_messages WHERE id IN (SELECT CAST(value AS INTEGER) FROM json_each(?1))", jsonArray(ids)); err != nil {
+		return nil, err
+	}
+	return due, tx.Commit()
+}
+
+// scanScheduled reads scheduled messages and closes rows.
+func scanScheduled(rows *sql.Rows) ([]store.ScheduledMessage, error) {
+	defer rows.Close()
+
+	scheduled := []store.ScheduledMessage{}
+	for rows.Next() {
+		var sm store.ScheduledMessage
+		var replyToID sql.NullString
+		if err := rows.Scan(&sm.ID, &sm.Sender, &sm.Receiver, &sm.Content, &sm.Format, &replyToID, &sm.SendAt, &sm.CreatedAt); err != nil {
+			return nil, err
+		}
+		if replyToID.Valid {
+			sm.ReplyToID = &replyToID.String
+		}
+		scheduled = append(scheduled, sm)
+	}
+	return scheduled, rows.Err()
+}
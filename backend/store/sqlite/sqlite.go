@@ -0,0 +1,116 @@
+// Package sqlite implements the store interfaces on an embedded SQLite
+// database, for single-node deployments that should not need a database
+// server. Write transactions take the database lock when they begin, so
+// they run one at a time, while reads run alongside them.
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"backend/store"
+
+	"github.com/mattn/go-sqlite3"
+)
+
+// busyTimeout is how long a statement waits for the lock another
+// connection holds before it fails.
+const busyTimeout = 5 * time.Second
+
+// Store implements store.Store on a SQLite database.
+type Store struct {
+	db *sql.DB
+}
+
+var _ store.Store = (*Store)(nil)
+
+// New returns a Store using db, opened with Open.
+func New(db *sql.DB) *Store {
+	return &Store{db: db}
+}
+
+// Driver is the SQLite driver, for Open.
+var Driver driver.Driver = &sqlite3.SQLiteDriver{}
+
+// Open returns a pool of connections opened with drv to the database file at
+// path, creating it if it does not exist. Connections write ahead to a log,
+// so readers do not wait for writers, and enforce foreign keys. It does not
+// open the file until it is used.
+func Open(drv driver.Driver, path string) *sql.DB {
+	params := url.Values{}
+	params.Set("_journal_mode", "WAL")
+	params.Set("_foreign_keys", "on")
+	params.Set("_busy_timeout", fmt.Sprint(busyTimeout.Milliseconds()))
+	params.Set("_txlock", "immediate")
+	return sql.OpenDB(&connector{drv: drv, dsn: "file:" + path + "?" + params.Encode()})
+}
+
+// connector opens connections to dsn with drv.
+type connector struct {
+	drv driver.Driver
+	dsn string
+}
+
+func (c *connector) Connect(ctx context.Context) (driver.Conn, error) {
+	return c.drv.Open(c.dsn)
+}
+
+func (c *connector) Driver() driver.Driver {
+	return c.drv
+}
+
+// Ping checks that the database is reachable.
+func (s *Store) Ping(ctx context.Context) error {
+	return s.db.PingContext(ctx)
+}
+
+// now returns the current time in UTC. Timestamps are stored as text, so
+// they must all be in the same zone to compare correctly.
+func now() time.Time {
+	return time.Now().UTC()
+}
+
+// jsonArray encodes values as a JSON array, which queries expand into rows
+// with json_each where Postgres would take an array.
+func jsonArray[T any](values []T) string {
+	if values == nil {
+		return "[]"
+	}
+	encoded, _ := json.Marshal(values)
+	return string(encoded)
+}
+
+// uniqueViolation maps the violation of a unique index on users to
+// ErrUsernameTaken or ErrEmailTaken.
+func uniqueViolation(err error) error {
+	var sqliteErr sqlite3.Error
+	if !errors.As(err, &sqliteErr) || sqliteErr.ExtendedCode != sqlite3.ErrConstraintUnique {
+		return err
+	}
+	if strings.Contains(sqliteErr.Error(), "users.email") {
+		return store.ErrEmailTaken
+	}
+	return store.ErrUsernameTaken
+}
+
+// isUniqueViolation reports whether err is the violation of a unique index.
+func isUniqueViolation(err error) bool {
+	var sqliteErr sqlite3.Error
+	return errors.As(err, &sqliteErr) && (sqliteErr.ExtendedCode == sqlite3.ErrConstraintUnique ||
+		sqliteErr.ExtendedCode == sqlite3.ErrConstraintPrimaryKey)
+}
+
+// notFound maps sql.ErrNoRows to store.ErrNotFound.
+func notFound(err error) error {
+	if err == sql.ErrNoRows {
+		return store.ErrNotFound
+	}
+	return err
+}
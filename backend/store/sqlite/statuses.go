@@ -0,0 +1,46 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"backend/store"
+)
+
+func (s *Store) UserStatus(ctx context.Context, username string) (store.UserStatus, error) {
+	var status store.UserStatus
+	var expiresAt sql.NullTime
+	err := s.db.QueryRowContext(ctx, `
+		SELECT availability, text, emoji, expires_at FROM user_statuses
+		WHERE username = ?1 AND (expires_at IS NULL OR expires_at > ?2)`, username, now()).
+		Scan(&status.Availability, &status.Text, &status.Emoji, &expiresAt)
+	if err == sql.ErrNoRows {
+		return store.DefaultUserStatus, nil
+	}
+	if expiresAt.Valid {
+		status.ExpiresAt = &expiresAt.Time
+	}
+	return status, err
+}
+
+func (s *Store) SetUserStatus(ctx context.Context, username string, status *store.UserStatus, d time.Duration) error {
+	t := now()
+	status.ExpiresAt = nil
+	if d > 0 {
+		expiresAt := t.Add(d.Truncate(time.Second))
+		status.ExpiresAt = &expiresAt
+	}
+	_, err := s.db.ExecContext(ctx, `
+		INSERT INTO user_statuses (username, availability, text, emoji, expires_at, updated_at)
+		VALUES (?1, ?2, ?3, ?4, ?5, ?6)
+		ON CONFLICT (username) DO UPDATE SET availability = excluded.availability, text = excluded.text,
+			emoji = excluded.emoji, expires_at = excluded.expires_at, updated_at = excluded.updated_at`,
+		username, status.Availability, status.Text, status.Emoji, status.ExpiresAt, t)
+	return err
+}
+
+func (s *Store) ClearUserStatus(ctx context.Context, username string) error {
+	_, err := s.db.ExecContext(ctx, "DELETE FROM user_statuses WHERE username = ?1", username)
+	return err
+}
@@ -0,0 +1,270 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"backend/store"
+	"backend/usernames"
+)
+
+// usernameColumns lists every column holding a username, updated together
+// when a user is renamed so their history follows them.
+var usernameColumns = []struct{ table, column string }{
+	{"messages", "sender"},
+	{"messages", "receiver"},
+	{"messages_archive", "sender"},
+	{"messages_archive", "receiver"},
+	{"user_votes", "user_id"},
+	{"message_deletions", "username"},
+	{"attachments", "uploader"},
+	{"sessions", "username"},
+	{"blocks", "blocker"},
+	{"blocks", "blocked"},
+	{"device_tokens", "username"},
+	{"notification_preferences", "username"},
+	{"conversation_filters", "username"},
+	{"conversation_filters", "peer"},
+	{"conversation_mutes", "username"},
+	{"conversation_mutes", "peer"},
+	{"user_statuses", "username"},
+	{"message_flags", "sender"},
+	{"message_flags", "receiver"},
+	{"scheduled_messages", "sender"},
+	{"scheduled_messages", "receiver"},
+	{"disappearing_messages", "username"},
+	{"disappearing_messages", "peer"},
+	{"pinned_messages", "pinned_by"},
+	{"mentions", "username"},
+	{"api_keys", "created_by"},
+	{"user_api_keys", "username"},
+	{"webhooks", "created_by"},
+	{"webhooks", "bot"},
+	{"bots", "username"},
+	{"bots", "created_by"},
+	{"bot_commands", "bot"},
+	{"incoming_hooks", "bot"},
+	{"incoming_hooks", "receiver"},
+	{"incoming_hooks", "created_by"},
+	{"channels", "created_by"},
+	{"channel_senders", "username"},
+	{"channel_subscriptions", "username"},
+	{"channel_posts", "sender"},
+	{"channel_invites", "created_by"},
+	{"channel_thread_subscriptions", "username"},
+	{"shadow_mutes", "username"},
+	{"shadow_mutes", "muted_by"},
+	{"channel_shadow_mutes", "username"},
+	{"channel_shadow_mutes", "muted_by"},
+	{"pending_uploads", "uploader"},
+}
+
+func (s *Store) CreateUser(ctx context.Context, username string, password store.Password, email string) error {
+	// The email is optional and only used for password resets.
+	var nullEmail sql.NullString
+	if email != "" {
+		nullEmail = sql.NullString{String: email, Valid: true}
+	}
+
+	_, err := s.db.ExecContext(ctx, "INSERT INTO users (username, username_normalized, password, password_algo, email) VALUES (?1, ?2, ?3, ?4, ?5)", username, usernames.Normalize(username), password.Hash, password.Algo, nullEmail)
+	return uniqueViolation(err)
+}
+
+func (s *Store) PasswordHash(ctx context.Context, username string) (store.Password, error) {
+	var p store.Password
+	err := s.db.QueryRowContext(ctx, "SELECT password_algo, password FROM users WHERE username = ?1", username).Scan(&p.Algo, &p.Hash)
+	return p, notFound(err)
+}
+
+func (s *Store) SetPasswordHash(ctx context.Context, username string, password store.Password) error {
+	_, err := s.db.ExecContext(ctx, "UPDATE users SET password = ?1, password_algo = ?2 WHERE username = ?3", password.Hash, password.Algo, username)
+	return err
+}
+
+func (s *Store) UsernameByEmail(ctx context.Context, email string) (string, error) {
+	var username string
+	err := s.db.QueryRowContext(ctx, "SELECT username FROM users WHERE email = ?1", email).Scan(&username)
+	return username, notFound(err)
+}
+
+func (s *Store) EmailStatus(ctx context.Context, username string) (string, bool, error) {
+	var email sql.NullString
+	var verified bool
+	err := s.db.QueryRowContext(ctx, "SELECT email, email_verified_at IS NOT NULL FROM users WHERE username = ?1", username).Scan(&email, &verified)
+	return email.String, verified, notFound(err)
+}
+
+func (s *Store) VerifyEmail(ctx context.Context, email string) (string, error) {
+	var username string
+	err := s.db.QueryRowContext(ctx, `
+		UPDATE users SET email_verified_at = COALESCE(email_verified_at, ?2)
+		WHERE email = ?1 RETURNING username`, email, now()).Scan(&username)
+	return username, notFound(err)
+}
+
+func (s *Store) RenameUser(ctx context.Context, oldUsername, newUsername string) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	// Users may change the case of their own name.
+	normalized := usernames.Normalize(newUsername)
+	var taken bool
+	err = tx.QueryRowContext(ctx, `
+		SELECT EXISTS (SELECT 1 FROM users WHERE username = ?1 OR (username_normalized = ?2 AND username != ?3))`,
+		newUsername, normalized, oldUsername).Scan(&taken)
+	if err != nil {
+		return err
+	}
+	if taken {
+		return store.ErrUsernameTaken
+	}
+
+	if _, err := tx.ExecContext(ctx, "UPDATE users SET username = ?1, username_normalized = ?2 WHERE username = ?3", newUsername, normalized, oldUsername); err != nil {
+		return uniqueViolation(err)
+	}
+
+	for _, col := range usernameColumns {
+		query := "UPDATE " + col.table + " SET " + col.column + " = ?1 WHERE " + col.column + " = ?2"
+		if _, err := tx.ExecContext(ctx, query, newUsername, oldUsername); err != nil {
+			return err
+		}
+	}
+
+	// Conversations are keyed by their participants in order, which the new
+	// name may change.
+	_, err = tx.ExecContext(ctx, `
+		UPDATE conversation_seqs SET
+			user_a = min(CASE WHEN user_a = ?2 THEN ?1 ELSE user_a END, CASE WHEN user_b = ?2 THEN ?1 ELSE user_b END),
+			user_b = max(CASE WHEN user_a = ?2 THEN ?1 ELSE user_a END, CASE WHEN user_b = ?2 THEN ?1 ELSE user_b END)
+		WHERE user_a = ?2 OR user_b = ?2`, newUsername, oldUsername)
+	if err != nil {
+		return err
+	}
+
+	// Tokens carry the username, so every session of the old name ends.
+	if _, err := tx.ExecContext(ctx, "UPDATE sessions SET revoked_at = ?2 WHERE username = ?1 AND revoked_at IS NULL", newUsername, now()); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (s *Store) UserExists(ctx context.Context, username string) (bool, error) {
+	var exists bool
+	err := s.db.QueryRowContext(ctx, "SELECT EXISTS (SELECT 1 FROM users WHERE username = ?1)", username).Scan(&exists)
+	return exists, err
+}
+
+func (s *Store) CanonicalUsername(ctx context.Context, username string) (string, error) {
+	var canonical string
+	err := s.db.QueryRowContext(ctx, `
+		SELECT username FROM users
+		WHERE (username = ?1 OR username_normalized = ?2) AND deletion_requested_at IS NULL
+		ORDER BY username = ?1 DESC LIMIT 1`,
+		username, usernames.Normalize(username)).Scan(&canonical)
+	return canonical, notFound(err)
+}
+
+func (s *Store) Role(ctx context.Context, username string) (string, bool, error) {
+	var role string
+	var banned bool
+	err := s.db.QueryRowContext(ctx, "SELECT role, banned_at IS NOT NULL FROM users WHERE username = ?1 AND deletion_requested_at IS NULL", username).Scan(&role, &banned)
+	return role, banned, notFound(err)
+}
+
+func (s *Store) ListUsers(ctx context.Context, viewer string) ([]string, error) {
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT username FROM users u
+		WHERE username != ?1
+		AND banned_at IS NULL
+		AND deletion_requested_at IS NULL
+		AND NOT EXISTS (
+			SELECT 1 FROM blocks b
+			WHERE (b.blocker = ?1 AND b.blocked = u.username) OR (b.blocker = u.username AND b.blocked = ?1)
+		)`, viewer)
+	if err != nil {
+		return nil, err
+	}
+	return scanStrings(rows)
+}
+
+func (s *Store) LastSeen(ctx context.Context, username string) (*time.Time, error) {
+	var lastSeen sql.NullTime
+	err := s.db.QueryRowContext(ctx, "SELECT last_seen FROM users WHERE username = ?1", username).Scan(&lastSeen)
+	if err != nil {
+		return nil, notFound(err)
+	}
+	if !lastSeen.Valid {
+		return nil, nil
+	}
+	return &lastSeen.Time, nil
+}
+
+func (s *Store) SetLastSeen(ctx context.Context, username string, t time.Time) error {
+	_, err := s.db.ExecContext(ctx, "UPDATE users SET last_seen = ?1 WHERE username = ?2", t.UTC(), username)
+	return err
+}
+
+func (s *Store) AnalyticsOptOut(ctx context.Context, username string) (bool, error) {
+	var optOut bool
+	err := s.db.QueryRowContext(ctx, "SELECT analytics_opt_out FROM users WHERE username = ?1", username).Scan(&optOut)
+	return optOut, notFound(err)
+}
+
+func (s *Store) SetAnalyticsOptOut(ctx context.Context, username string, optOut bool) error {
+	res, err := s.db.ExecContext(ctx, "UPDATE users SET analytics_opt_out = ?1 WHERE username = ?2", optOut, username)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return store.ErrNotFound
+	}
+	return nil
+}
+
+func (s *Store) Locale(ctx context.Context, username string) (string, error) {
+	var locale string
+	err := s.db.QueryRowContext(ctx, "SELECT locale FROM users WHERE username = ?1", username).Scan(&locale)
+	return locale, notFound(err)
+}
+
+func (s *Store) SetLocale(ctx context.Context, username, locale string) error {
+	res, err := s.db.ExecContext(ctx, "UPDATE users SET locale = ?1 WHERE username = ?2", locale, username)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return store.ErrNotFound
+	}
+	return nil
+}
+
+func (s *Store) Contacts(ctx context.Context, username string) ([]string, error) {
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT DISTINCT CASE WHEN sender = ?1 THEN receiver ELSE sender END
+		FROM messages
+		WHERE sender = ?1 OR receiver = ?1`, username)
+	if err != nil {
+		return nil, err
+	}
+	return scanStrings(rows)
+}
+
+// scanStrings reads a single string column from every row and closes rows.
+func scanStrings(rows *sql.Rows) ([]string, error) {
+	defer rows.Close()
+
+	var values []string
+	for rows.Next() {
+		var v string
+		if err := rows.Scan(&v); err != nil {
+			return nil, err
+		}
+		values = append(values, v)
+	}
+	return values, rows.Err()
+}
@@ -0,0 +1,100 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+
+	"backend/store"
+)
+
+func (s *Store) ToggleVote(ctx context.Context, id, username, voteType string) (int, int, bool, error) {
+	return s.applyVote(ctx, id, username, func(existing string) string {
+		if existing == voteType {
+			return ""
+		}
+		return voteType
+	})
+}
+
+func (s *Store) SetVote(ctx context.Context, id, username, voteType string) (int, int, bool, error) {
+	return s.applyVote(ctx, id, username, func(string) string {
+		return voteType
+	})
+}
+
+// applyVote replaces username's vote on a message with next(existing vote),
+// where "" means no vote, and returns the new totals and whether username
+// cast a vote they had not before. The transaction holds
+// the database lock, so concurrent votes are applied one at a time.
+func (s *Store) applyVote(ctx context.Context, id, username string, next func(existing string) string) (int, int, bool, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, 0, false, err
+	}
+	defer tx.Rollback()
+
+	var messageID string
+	if err := tx.QueryRowContext(ctx, `SELECT id FROM messages WHERE id = ?1 AND kind = 'user'`, id).Scan(&messageID); err != nil {
+		return 0, 0, false, notFound(err)
+	}
+
+	var existingVote string
+	err = tx.QueryRowContext(ctx, `SELECT vote_type FROM user_votes WHERE user_id = ?1 AND message_id = ?2`, username, messageID).Scan(&existingVote)
+	if err != nil && err != sql.ErrNoRows {
+		return 0, 0, false, err
+	}
+
+	voteType := next(existingVote)
+	switch {
+	case voteType == existingVote:
+		// The vote is unchanged.
+	case voteType == "":
+		_, err = tx.ExecContext(ctx, `DELETE FROM user_votes WHERE user_id = ?1 AND message_id = ?2`, username, messageID)
+	case existingVote == "":
+		_, err = tx.ExecContext(ctx, `INSERT INTO user_votes (user_id, message_id, vote_type) VALUES (?1, ?2, ?3)`, username, messageID, voteType)
+	default:
+		_, err = tx.ExecContext(ctx, `UPDATE user_votes SET vote_type = ?3 WHERE user_id = ?1 AND message_id = ?2`, username, messageID, voteType)
+	}
+	if err != nil {
+		return 0, 0, false, err
+	}
+
+	// Recount from user_votes rather than adjusting the stored totals, so
+	// they cannot drift from the votes actually cast.
+	var upvotes, downvotes int
+	err = tx.QueryRowContext(ctx, `
+		UPDATE messages SET
+			upvotes = (SELECT COUNT(*) FROM user_votes WHERE message_id = ?2 AND vote_type = ?3),
+			downvotes = (SELECT COUNT(*) FROM user_votes WHERE message_id = ?2 AND vote_type = ?4),
+			updated_at = ?5
+		WHERE id = ?1
+		RETURNING upvotes, downvotes`, id, messageID, store.Upvote, store.Downvote, now()).Scan(&upvotes, &downvotes)
+	if err != nil {
+		return 0, 0, false, err
+	}
+
+	return upvotes, downvotes, voteType != "" && voteType != existingVote, tx.Commit()
+}
+
+func (s *Store) VoteScores(ctx context.Context, a, b string) (map[string]int, error) {
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT id, upvotes - downvotes
+		FROM messages
+		WHERE ((sender = ?1 AND receiver = ?2) OR (sender = ?2 AND receiver = ?1))
+		AND (upvotes > 0 OR downvotes > 0) AND deleted_at IS NULL`, a, b)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	scores := make(map[string]int)
+	for rows.Next() {
+		var id string
+		var score int
+		if err := rows.Scan(&id, &score); err != nil {
+			return nil, err
+		}
+		scores[id] = score
+	}
+	return scores, rows.Err()
+}
@@ -0,0 +1,192 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"time"
+
+	"backend/store"
+)
+
+const deliveryColumns = "d.id, d.webhook_id, d.event_type, d.payload, d.status, d.attempts, d.response_status, COALESCE(d.error, ''), d.created_at, d.next_attempt_at, d.delivered_at"
+
+func (s *Store) CreateWebhook(ctx context.Context, w *store.Webhook) error {
+	var bot sql.NullString
+	if w.Bot != "" {
+		bot = sql.NullString{String: w.Bot, Valid: true}
+	}
+	return s.db.QueryRowContext(ctx, `
+		INSERT INTO webhooks (url, secret, events, bot, created_by) VALUES (?1, ?2, ?3, ?4, ?5)
+		RETURNING id, created_at`, w.URL, w.Secret, jsonArray(w.Events), bot, w.CreatedBy).Scan(&w.ID, &w.CreatedAt)
+}
+
+func (s *Store) Webhooks(ctx context.Context) ([]store.Webhook, error) {
+	rows, err := s.db.QueryContext(ctx, "SELECT id, url, events, COALESCE(bot, ''), created_by, created_at FROM webhooks ORDER BY id")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	webhooks := []store.Webhook{}
+	for rows.Next() {
+		var w store.Webhook
+		var events string
+		if err := rows.Scan(&w.ID, &w.URL, &events, &w.Bot, &w.CreatedBy, &w.CreatedAt); err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal([]byte(events), &w.Events); err != nil {
+			return nil, err
+		}
+		webhooks = append(webhooks, w)
+	}
+	return webhooks, rows.Err()
+}
+
+func (s *Store) DeleteWebhook(ctx context.Context, id string) error {
+	res, err := s.db.ExecContext(ctx, "DELETE FROM webhooks WHERE id = ?1", id)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return store.ErrNotFound
+	}
+	return nil
+}
+
+func (s *Store) CreateDeliveries(ctx context.Context, eventType, recipient, payload string) error {
+	t := now()
+	_, err := s.db.ExecContext(ctx, `
+		INSERT INTO webhook_deliveries (webhook_id, event_type, payload, created_at, next_attempt_at)
+		SELECT id, ?1, ?2, ?3, ?3 FROM webhooks
+		WHERE EXISTS (SELECT 1 FROM json_each(webhooks.events) WHERE value = ?1) AND (bot IS NULL OR bot = ?4)`,
+		eventType, payload, t, recipient)
+	return err
+}
+
+// ClaimDueDeliveries selects and leases in one transaction, which holds the
+// database lock throughout, so concurrent callers never claim the same
+// delivery.
+func (s *Store) ClaimDueDeliveries(ctx context.Context, now time.Time, lease time.Duration, limit int) ([]store.WebhookDelivery, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	rows, err := tx.QueryContext(ctx, `
+		SELECT `+deliveryColumns+`, w.url, w.secret FROM webhook_deliveries d
+		JOIN webhooks w ON w.id = d.webhook_id
+		WHERE d.status = 'pending' AND d.next_attempt_at <= ?1
+		ORDER BY d.next_attempt_at, d.id
+		LIMIT ?2`, now.UTC(), limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var due []store.WebhookDelivery
+	var ids []string
+	for rows.Next() {
+		d, err := scanDelivery(rows, true)
+		if err != nil {
+			return nil, err
+		}
+		due = append(due, d)
+		ids = append(ids, d.ID)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	rows.Close()
+	if len(due) == 0 {
+		return nil, nil
+	}
+
+	_, err = tx.ExecContext(ctx, `
+		UPDATE webhook_deliveries SET next_attempt_at = ?2
+		WHERE id IN (SELECT CAST(value AS INTEGER) FROM json_each(?1))`, jsonArray(ids), now.Add(lease).UTC())
+	if err != nil {
+		return nil, err
+	}
+	return due, tx.Commit()
+}
+
+func (s *Store) RecordDeliveryAttempt(ctx context.Context, id string, attempt store.DeliveryAttempt) error {
+	var nextAttempt sql.NullTime
+	if attempt.Status == store.DeliveryPending {
+		nextAttempt = sql.NullTime{Time: attempt.NextAttemptAt.UTC(), Valid: true}
+	}
+	var errMsg sql.NullString
+	if attempt.Error != "" {
+		errMsg = sql.NullString{String: attempt.Error, Valid: true}
+	}
+
+	_, err := s.db.ExecContext(ctx, `
+		UPDATE webhook_deliveries SET
+			attempts = attempts + 1,
+			status = ?2,
+			response_status = ?3,
+			error = ?4,
+			next_attempt_at = ?5,
+			delivered_at = CASE WHEN ?2 = 'succeeded' THEN ?6 END
+		WHERE id = ?1`, id, attempt.Status, attempt.ResponseStatus, errMsg, nextAttempt, now())
+	return err
+}
+
+func (s *Store) WebhookDeliveries(ctx context.Context, webhookID string, limit int) ([]store.WebhookDelivery, error) {
+	var exists bool
+	err := s.db.QueryRowContext(ctx, "SELECT EXISTS (SELECT 1 FROM webhooks WHERE id = ?1)", webhookID).Scan(&exists)
+	if err != nil {
+		return nil, err
+	}
+	if !exists {
+		return nil, store.ErrNotFound
+	}
+
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT `+deliveryColumns+` FROM webhook_deliveries d
+		WHERE d.webhook_id = ?1 ORDER BY d.id DESC LIMIT ?2`, webhookID, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	deliveries := []store.WebhookDelivery{}
+	for rows.Next() {
+		d, err := scanDelivery(rows, false)
+		if err != nil {
+			return nil, err
+		}
+		deliveries = append(deliveries, d)
+	}
+	return deliveries, rows.Err()
+}
+
+// scanDelivery reads a row of deliveryColumns, followed by the webhook's URL
+// and secret if withWebhook is set.
+func scanDelivery(rows *sql.Rows, withWebhook bool) (store.WebhookDelivery, error) {
+	var d store.WebhookDelivery
+	var responseStatus sql.NullInt64
+	var nextAttempt, delivered sql.NullTime
+	dest := []interface{}{&d.ID, &d.WebhookID, &d.EventType, &d.Payload, &d.Status, &d.Attempts,
+		&responseStatus, &d.Error, &d.CreatedAt, &nextAttempt, &delivered}
+	if withWebhook {
+		dest = append(dest, &d.URL, &d.Secret)
+	}
+	if err := rows.Scan(dest...); err != nil {
+		return d, err
+	}
+
+	if responseStatus.Valid {
+		status := int(responseStatus.Int64)
+		d.ResponseStatus = &status
+	}
+	if nextAttempt.Valid {
+		d.NextAttemptAt = &nextAttempt.Time
+	}
+	if delivered.Valid {
+		d.DeliveredAt = &delivered.Time
+	}
+	return d, nil
+}
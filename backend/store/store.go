@@ -0,0 +1,616 @@
+// Package store defines the persistent data of the chat server and the
+// repository interfaces the API depends on. Implementations live in
+// subpackages such as store/postgres.
+package store
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+// Errors returned by repositories.
+var (
+	// ErrNotFound is returned when the requested row does not exist or is
+	// not visible to the requesting user.
+	ErrNotFound = errors.New("not found")
+	// ErrUsernameTaken is returned when creating or renaming a user to a
+	// username that is already in use.
+	ErrUsernameTaken = errors.New("username already taken")
+	// ErrEmailTaken is returned when setting a user's email to one another
+	// user has.
+	ErrEmailTaken = errors.New("email already taken")
+	// ErrInvalidSession is returned when a refresh token is unknown, expired
+	// or revoked.
+	ErrInvalidSession = errors.New("invalid or expired session")
+	// ErrInvalidReplyTo is returned when a reply targets a message outside
+	// the conversation it is sent in.
+	ErrInvalidReplyTo = errors.New("reply_to_id must refer to a message in the same conversation")
+	// ErrCommandTaken is returned when registering a slash command another
+	// bot registered.
+	ErrCommandTaken = errors.New("command already registered")
+	// ErrPinLimit is returned when pinning a message to a conversation that
+	// has as many pins as allowed.
+	ErrPinLimit = errors.New("too many pinned messages")
+	// ErrChannelTaken is returned when creating a channel with the name of
+	// another.
+	ErrChannelTaken = errors.New("channel name already taken")
+)
+
+// UserStore manages user accounts.
+type UserStore interface {
+	// CreateUser adds a user with an already hashed password. Email may be empty.
+	CreateUser(ctx context.Context, username string, password Password, email string) error
+	// PasswordHash returns the stored password hash of a user.
+	PasswordHash(ctx context.Context, username string) (Password, error)
+	SetPasswordHash(ctx context.Context, username string, password Password) error
+	// UsernameByEmail returns the user registered with email.
+	UsernameByEmail(ctx context.Context, email string) (string, error)
+	// EmailStatus returns a user's email, empty if they have none, and
+	// whether it was verified.
+	EmailStatus(ctx context.Context, username string) (string, bool, error)
+	// VerifyEmail marks email verified and returns the username of the user
+	// who has it, or ErrNotFound if nobody does.
+	VerifyEmail(ctx context.Context, email string) (string, error)
+	// RenameUser renames a user everywhere their username is stored and
+	// revokes their sessions, in a single transaction.
+	RenameUser(ctx context.Context, oldUsername, newUsername string) error
+	UserExists(ctx context.Context, username string) (bool, error)
+	// CanonicalUsername returns the username registered under username or a
+	// name differing from it only in case or Unicode presentation, or
+	// ErrNotFound if there is none or its user asked to delete their
+	// account.
+	CanonicalUsername(ctx context.Context, username string) (string, error)
+	// Role returns the user's role and whether they are banned. Users who
+	// asked to delete their account are not found.
+	Role(ctx context.Context, username string) (string, bool, error)
+	// ListUsers returns every other user that is not banned or deleted and
+	// that viewer has not blocked and is not blocked by.
+	ListUsers(ctx context.Context, viewer string) ([]string, error)
+	// LastSeen returns when the user last disconnected, or nil if never.
+	LastSeen(ctx context.Context, username string) (*time.Time, error)
+	SetLastSeen(ctx context.Context, username string, t time.Time) error
+	// AnalyticsOptOut reports whether a user opted out of usage analytics.
+	AnalyticsOptOut(ctx context.Context, username string) (bool, error)
+	// SetAnalyticsOptOut records whether a user opted out of usage
+	// analytics. It returns ErrNotFound if the user does not exist.
+	SetAnalyticsOptOut(ctx context.Context, username string, optOut bool) error
+	// Locale returns the locale a user chose to be answered in, empty if
+	// they chose none.
+	Locale(ctx context.Context, username string) (string, error)
+	// SetLocale records the locale a user chose, or clears it if locale is
+	// empty. It returns ErrNotFound if the user does not exist.
+	SetLocale(ctx context.Context, username, locale string) error
+	// Contacts returns every user who has exchanged messages with username.
+	Contacts(ctx context.Context, username string) ([]string, error)
+}
+
+// SessionStore manages refresh token sessions, identified by token hash.
+type SessionStore interface {
+	CreateSession(ctx context.Context, username, tokenHash string, client SessionClient, expiresAt time.Time) error
+	// RotateSession replaces the token of the session with oldHash by
+	// newHash, recording client and the time as its last activity, and
+	// returns its username.
+	RotateSession(ctx context.Context, oldHash, newHash string, client SessionClient, expiresAt time.Time) (string, error)
+	RevokeSession(ctx context.Context, tokenHash string) error
+	RevokeUserSessions(ctx context.Context, username string) error
+	// Sessions returns username's sessions that are neither revoked nor
+	// expired, most recently active first.
+	Sessions(ctx context.Context, username string) ([]Session, error)
+	// RevokeUserSession revokes one of username's sessions. It returns
+	// ErrNotFound if username has no active session with id.
+	RevokeUserSession(ctx context.Context, username, id string) error
+}
+
+// MessageStore manages messages, their delivery state, votes and attachments.
+type MessageStore interface {
+	// CreateMessage stores msg as sent, filling in its ID and status. A
+	// shadowed message is stored deleted for its receiver.
+	CreateMessage(ctx context.Context, msg *Message) error
+	// CreateMessages stores msgs as sent in one transaction, like
+	// CreateMessage, with a statement for all of them rather than one each.
+	CreateMessages(ctx context.Context, msgs []*Message) error
+	// CreateAttachmentMessage stores msg and its attachment, whose file is
+	// stored under storageKey, in one transaction. An attachment with
+	// MediaStatus MediaPending is queued for processing.
+	CreateAttachmentMessage(ctx context.Context, msg *Message, a Attachment, storageKey string) error
+	// Message returns a message with its status and attachments.
+	Message(ctx context.Context, id string) (Message, error)
+	// Conversation returns the messages between viewer and other, oldest
+	// first, without those viewer deleted for themselves. Unless since is
+	// zero, only messages created or updated after since are returned.
+	Conversation(ctx context.Context, viewer, other string, since time.Time) ([]Message, error)
+	// EachMessage calls fn with every message between viewer and other,
+	// oldest first, without attachments, reading them as fn consumes them.
+	// It stops at the first error fn returns.
+	EachMessage(ctx context.Context, viewer, other string, fn func(Message) error) error
+	// EachMessageOf calls fn with every message username sent or received,
+	// oldest first, like EachMessage.
+	EachMessageOf(ctx context.Context, username string, fn func(Message) error) error
+	// RecentMessages returns the latest limit messages of the conversation
+	// between viewer and other, oldest first, like Conversation.
+	RecentMessages(ctx context.Context, viewer, other string, limit int) ([]Message, error)
+	// MessagesBefore returns up to limit messages of the conversation sent
+	// before the message with ID before, oldest first, like RecentMessages.
+	// An empty before returns the latest messages.
+	MessagesBefore(ctx context.Context, viewer, other, before string, limit int) ([]Message, error)
+	// MessagesAfter returns up to limit messages username sent or received
+	// after the message with ID afterID, oldest first, without those they
+	// deleted for themselves.
+	MessagesAfter(ctx context.Context, username string, afterID, limit int) ([]Message, error)
+	// MessagesAfterSeq returns up to limit messages of the conversation
+	// between viewer and other with a seq above afterSeq, in seq order,
+	// without those viewer deleted for themselves.
+	MessagesAfterSeq(ctx context.Context, viewer, other string, afterSeq int64, limit int) ([]Message, error)
+	// MessagesByID returns the messages with the given IDs that viewer
+	// took part in and did not delete for themselves, in no particular order.
+	MessagesByID(ctx context.Context, viewer string, ids []string) ([]Message, error)
+	// VoteScores returns upvotes minus downvotes of every voted message
+	// between a and b that was not deleted, keyed by message ID.
+	VoteScores(ctx context.Context, a, b string) (map[string]int, error)
+	// Undelivered returns up to limit messages to receiver still marked as
+	// sent, oldest first, starting after message afterID.
+	Undelivered(ctx context.Context, receiver string, afterID, limit int) ([]Message, error)
+	// Thread returns the root of the reply thread containing messageID and
+	// every message in it, oldest first.
+	Thread(ctx context.Context, messageID, viewer string) (string, []Message, error)
+	// Search returns up to limit messages visible to viewer matching query.
+	Search(ctx context.Context, viewer, query string, limit, offset int) ([]SearchResult, error)
+	// ReplyPreview validates that replyToID belongs to the conversation
+	// between sender and receiver and returns its quote.
+	ReplyPreview(ctx context.Context, replyToID, sender, receiver string) (*ReplyPreview, error)
+	// Participants returns the sender and receiver of a message.
+	Participants(ctx context.Context, id string) (string, string, error)
+	DeleteForUser(ctx context.Context, id, username string) error
+	DeleteForEveryone(ctx context.Context, id string) error
+	// MarkDelivered marks a sent message delivered, reporting whether it changed.
+	MarkDelivered(ctx context.Context, id, receiver string) (bool, error)
+	// MarkReadUpTo marks the message and every earlier unread message of the
+	// same conversation to receiver as read, returning the updated IDs.
+	MarkReadUpTo(ctx context.Context, id, receiver string) ([]string, error)
+	// MarkConversationReadUpTo marks every unread message from peer to
+	// reader up to the message, which may have been sent by either, as read,
+	// returning the updated IDs. It returns ErrNotFound if the message is not
+	// in their conversation.
+	MarkConversationReadUpTo(ctx context.Context, reader, peer, id string) ([]string, error)
+	// ToggleVote applies an upvote or downvote by username, removing it if
+	// it was already cast, and returns the new totals and whether username
+	// cast a vote they had not before.
+	ToggleVote(ctx context.Context, id, username, voteType string) (int, int, bool, error)
+	// SetVote replaces username's vote with voteType, or withdraws it if
+	// voteType is empty, and returns the new totals and whether username
+	// cast a vote they had not before.
+	SetVote(ctx context.Context, id, username, voteType string) (int, int, bool, error)
+	// AttachmentFile returns an attachment visible to viewer and the blob
+	// key of its file.
+	AttachmentFile(ctx context.Context, id, viewer string) (Attachment, string, error)
+	// AttachmentVariant returns a variant of an attachment visible to
+	// viewer.
+	AttachmentVariant(ctx context.Context, id, name, viewer string) (AttachmentVariant, error)
+	// ClaimPendingMedia claims up to limit images waiting to be processed
+	// for lease, so no other worker claims them meanwhile.
+	ClaimPendingMedia(ctx context.Context, lease time.Duration, limit int) ([]PendingMedia, error)
+	// CompleteMedia records an image's dimensions and variants and marks it
+	// ready. It returns ErrNotFound if the attachment was deleted meanwhile.
+	CompleteMedia(ctx context.Context, attachmentID string, width, height int, variants []AttachmentVariant) error
+	// FailMedia marks an image that could not be processed.
+	FailMedia(ctx context.Context, attachmentID string) error
+	// CreateUpload records a file a client is about to upload straight to
+	// the blob store.
+	CreateUpload(ctx context.Context, u Upload) error
+	// TakeUpload removes and returns an unexpired upload of uploader, so it
+	// is sent at most once.
+	TakeUpload(ctx context.Context, id, uploader string) (Upload, error)
+	// DeleteExpiredUploads deletes up to limit uploads that expired without
+	// being sent and returns their blob keys.
+	DeleteExpiredUploads(ctx context.Context, limit int) ([]string, error)
+	// MessageTTL returns how long messages between username and peer last
+	// before they disappear, or zero if they do not.
+	MessageTTL(ctx context.Context, username, peer string) (time.Duration, error)
+	// SetMessageTTL turns disappearing messages on for the conversation
+	// between a and b, for both of them, or off if ttl is zero. Messages
+	// already sent keep their expiry.
+	SetMessageTTL(ctx context.Context, a, b string, ttl time.Duration) error
+	// DeleteExpired deletes up to limit messages that expired at or before
+	// now and returns them. Concurrent callers never delete the same message.
+	DeleteExpired(ctx context.Context, now time.Time, limit int) ([]ExpiredMessage, error)
+}
+
+// BlockStore manages blocks between users.
+type BlockStore interface {
+	// IsBlocked reports whether either user has blocked the other.
+	IsBlocked(ctx context.Context, a, b string) (bool, error)
+	Block(ctx context.Context, blocker, blocked string) error
+	// Unblock removes a block, reporting whether there was one.
+	Unblock(ctx context.Context, blocker, blocked string) (bool, error)
+}
+
+// DeviceStore manages push notification devices and preferences.
+type DeviceStore interface {
+	// RegisterDevice adds a device for username, moving it from any other
+	// user, and fills in its ID.
+	RegisterDevice(ctx context.Context, username string, d *Device) error
+	// UnregisterDevice removes one of the user's devices, reporting whether it existed.
+	UnregisterDevice(ctx context.Context, id, username string) (bool, error)
+	Devices(ctx context.Context, username string) ([]Device, error)
+	DeleteDevice(ctx context.Context, id string) error
+	// NotificationPreferences returns the user's preferences, or the
+	// defaults if they never changed them.
+	NotificationPreferences(ctx context.Context, username string) (NotificationPreferences, error)
+	SetNotificationPreferences(ctx context.Context, username string, prefs NotificationPreferences) error
+	// MuteConversation mutes username's conversation with peer for d, or
+	// until it is unmuted if d is 0, replacing any earlier mute.
+	MuteConversation(ctx context.Context, username, peer string, d time.Duration) (Mute, error)
+	// UnmuteConversation lifts a mute, reporting whether there was one.
+	UnmuteConversation(ctx context.Context, username, peer string) (bool, error)
+	// Mutes returns the user's mutes that have not run out.
+	Mutes(ctx context.Context, username string) ([]Mute, error)
+	// Muted reports whether username muted their conversation with peer.
+	Muted(ctx context.Context, username, peer string) (bool, error)
+}
+
+// StatusStore manages the statuses users set.
+type StatusStore interface {
+	// UserStatus returns the user's status, or DefaultUserStatus if they
+	// set none or it expired.
+	UserStatus(ctx context.Context, username string) (UserStatus, error)
+	// SetUserStatus sets the user's status for d, or until changed if d is
+	// 0, and fills in when it expires.
+	SetUserStatus(ctx context.Context, username string, status *UserStatus, d time.Duration) error
+	// ClearUserStatus reverts the user's status to DefaultUserStatus.
+	ClearUserStatus(ctx context.Context, username string) error
+}
+
+// AdminStore backs the admin API.
+type AdminStore interface {
+	// Users returns every user, banned or not, who has not deleted their account.
+	Users(ctx context.Context) ([]User, error)
+	// SetBanned bans or unbans a user, revoking their sessions on a ban. It
+	// returns ErrNotFound if the user does not exist.
+	SetBanned(ctx context.Context, username string, banned bool) error
+	Stats(ctx context.Context) (Stats, error)
+}
+
+// ModerationStore manages content filter settings and flagged messages.
+type ModerationStore interface {
+	// Strictness returns the filter strictness username chose for their
+	// conversation with peer, or "" if they never chose one.
+	Strictness(ctx context.Context, username, peer string) (string, error)
+	SetStrictness(ctx context.Context, username, peer, strictness string) error
+	FlagMessage(ctx context.Context, f Flag) error
+	// Flags returns up to limit flags, newest first.
+	Flags(ctx context.Context, limit int) ([]Flag, error)
+	// ShadowMute stores m, replacing any mute of the same user and channel.
+	// It returns ErrNotFound if m names a channel that does not exist.
+	ShadowMute(ctx context.Context, m ShadowMute) error
+	// ShadowUnmute lifts the mute of username in a channel, or their global
+	// mute if channelID is empty, reporting whether there was one.
+	ShadowUnmute(ctx context.Context, username, channelID string) (bool, error)
+	// ShadowMuted reports whether username is muted globally or, if
+	// channelID is not empty, in that channel.
+	ShadowMuted(ctx context.Context, username, channelID string) (bool, error)
+	// ShadowMutes returns every mute, by username then channel, global
+	// mutes first.
+	ShadowMutes(ctx context.Context) ([]ShadowMute, error)
+}
+
+// ScheduleStore manages messages scheduled to be sent later.
+type ScheduleStore interface {
+	// CreateScheduled stores a scheduled message, filling in its ID and CreatedAt.
+	CreateScheduled(ctx context.Context, sm *ScheduledMessage) error
+	// ScheduledMessages returns the sender's pending scheduled messages,
+	// soonest first.
+	ScheduledMessages(ctx context.Context, sender string) ([]ScheduledMessage, error)
+	// CancelScheduled deletes one of the sender's scheduled messages,
+	// reporting whether it was still pending.
+	CancelScheduled(ctx context.Context, id, sender string) (bool, error)
+	// ClaimDueScheduled deletes and returns up to limit scheduled messages
+	// due at or before now, soonest first. Concurrent callers never claim
+	// the same message.
+	ClaimDueScheduled(ctx context.Context, now time.Time, limit int) ([]ScheduledMessage, error)
+}
+
+// MentionStore manages @username mentions.
+type MentionStore interface {
+	// CreateMentions records that a message mentions usernames and sets
+	// msg.Mentions.
+	CreateMentions(ctx context.Context, msg *Message, usernames []string) error
+	// Mentions returns up to limit messages mentioning username, newest
+	// first, without deleted ones, skipping those before offset.
+	Mentions(ctx context.Context, username string, limit, offset int) ([]Mention, error)
+}
+
+// PinStore manages messages pinned to conversations. Either participant may
+// pin or unpin any message of their conversation.
+type PinStore interface {
+	// PinMessage pins a message of the conversation between username and
+	// peer, unless it is pinned already, and returns its pin and whether it
+	// was newly pinned. It returns ErrNotFound if the message is not a user
+	// message of the conversation or was deleted, and ErrPinLimit if the
+	// conversation already has limit pins.
+	PinMessage(ctx context.Context, id, username, peer string, limit int) (Pin, bool, error)
+	// UnpinMessage unpins a message of the conversation between username and
+	// peer, reporting whether it was pinned.
+	UnpinMessage(ctx context.Context, id, username, peer string) (bool, error)
+	// PinnedMessages returns the pinned messages between viewer and peer,
+	// most recently pinned first, without those viewer deleted for themselves.
+	PinnedMessages(ctx context.Context, viewer, peer string) ([]PinnedMessage, error)
+}
+
+// AccountStore manages the deletion and export of a user's data.
+type AccountStore interface {
+	// RequestDeletion marks a user for erasure, stopping their logins and
+	// revoking their sessions at once. It returns ErrNotFound if the user
+	// does not exist or already asked.
+	RequestDeletion(ctx context.Context, username string) error
+	// PendingDeletions returns up to limit users marked for erasure, oldest
+	// request first.
+	PendingDeletions(ctx context.Context, limit int) ([]string, error)
+	// EraseUser erases a user marked for erasure in one transaction: their
+	// settings, votes, sessions and attachments are deleted, messages they
+	// sent are blanked for everyone and remaining references are renamed to
+	// tombstone. It returns the blob keys of the deleted attachments and
+	// uploads.
+	EraseUser(ctx context.Context, username, tombstone string) ([]string, error)
+	// PersonalData gathers what is stored about a user besides messages.
+	PersonalData(ctx context.Context, username string) (PersonalData, error)
+	// Usage counts the messages username sent in the last window and the
+	// attachments they uploaded.
+	Usage(ctx context.Context, username string, window time.Duration) (Usage, error)
+}
+
+// ProvisioningStore backs the provisioning API, which integrations call
+// with API keys to manage users in bulk.
+type ProvisioningStore interface {
+	// CreateAPIKey stores key with the hash of its secret, filling in its ID
+	// and CreatedAt.
+	CreateAPIKey(ctx context.Context, key *APIKey, keyHash string) error
+	// APIKeys returns every API key that was not revoked, oldest first.
+	APIKeys(ctx context.Context) ([]APIKey, error)
+	// RevokeAPIKey revokes an API key. It returns ErrNotFound if the key
+	// does not exist or was revoked already.
+	RevokeAPIKey(ctx context.Context, id string) error
+	// UseAPIKey returns the unrevoked API key with keyHash and records that
+	// it was used. It returns ErrNotFound if there is none.
+	UseAPIKey(ctx context.Context, keyHash string) (APIKey, error)
+	// ProvisionedUser returns a user who has not deleted their account.
+	ProvisionedUser(ctx context.Context, username string) (ProvisionedUser, error)
+	// ProvisionedUsers returns up to limit users who have not deleted their
+	// account, ordered by username after skipping offset, and how many
+	// there are in total.
+	ProvisionedUsers(ctx context.Context, offset, limit int) ([]ProvisionedUser, int, error)
+	// SetEmail changes a user's email, removing it if email is empty. A
+	// new email is unverified. It returns ErrNotFound if the user does not exist and ErrEmailTaken if
+	// another user has the email.
+	SetEmail(ctx context.Context, username, email string) error
+}
+
+// WebhookStore manages webhooks and the log of their deliveries.
+type WebhookStore interface {
+	// CreateWebhook stores w, filling in its ID and CreatedAt.
+	CreateWebhook(ctx context.Context, w *Webhook) error
+	// Webhooks returns every webhook, oldest first.
+	Webhooks(ctx context.Context) ([]Webhook, error)
+	// DeleteWebhook deletes a webhook and its deliveries. It returns
+	// ErrNotFound if the webhook does not exist.
+	DeleteWebhook(ctx context.Context, id string) error
+	// CreateDeliveries queues a delivery of payload to every webhook
+	// subscribed to eventType that belongs to no bot or to the bot named
+	// recipient, due at once.
+	CreateDeliveries(ctx context.Context, eventType, recipient, payload string) error
+	// ClaimDueDeliveries returns up to limit pending deliveries due by now,
+	// oldest first, with their webhook's URL and secret, and postpones them
+	// by lease so they are not claimed again while being attempted.
+	ClaimDueDeliveries(ctx context.Context, now time.Time, lease time.Duration, limit int) ([]WebhookDelivery, error)
+	// RecordDeliveryAttempt counts an attempt of a delivery and records its
+	// outcome.
+	RecordDeliveryAttempt(ctx context.Context, id string, attempt DeliveryAttempt) error
+	// WebhookDeliveries returns up to limit deliveries of a webhook, newest
+	// first. It returns ErrNotFound if the webhook does not exist.
+	WebhookDeliveries(ctx context.Context, webhookID string, limit int) ([]WebhookDelivery, error)
+}
+
+// ChannelStore manages broadcast channels, their senders, subscribers and
+// posts. Posts are stored once per channel, not per subscriber.
+type ChannelStore interface {
+	// CreateChannel stores ch and its senders, filling in its ID and
+	// CreatedAt, and subscribes its creator as the owner. It returns
+	// ErrChannelTaken if the name is in use.
+	CreateChannel(ctx context.Context, ch *Channel) error
+	// Channels returns the public channels and the private ones viewer
+	// subscribes to, ordered by name, with Subscribed and Role set for
+	// viewer. A search that is not empty only returns channels whose name,
+	// topic or description contain it, ignoring case.
+	Channels(ctx context.Context, viewer, search string) ([]Channel, error)
+	// Channel returns a channel with Subscribed and Role set for viewer.
+	Channel(ctx context.Context, id, viewer string) (Channel, error)
+	// UpdateChannel changes the settings of a channel. It returns
+	// ErrNotFound if the channel does not exist and ErrChannelTaken if the
+	// new name is in use.
+	UpdateChannel(ctx context.Context, id string, update ChannelUpdate) error
+	// DeleteChannel deletes a channel with its subscriptions and posts. It
+	// returns ErrNotFound if the channel does not exist.
+	DeleteChannel(ctx context.Context, id string) error
+	// AddChannelSender lets username post to a channel. It returns
+	// ErrNotFound if the channel does not exist.
+	AddChannelSender(ctx context.Context, id, username string) error
+	// RemoveChannelSender reports whether username was a sender.
+	RemoveChannelSender(ctx context.Context, id, username string) (bool, error)
+	IsChannelSender(ctx context.Context, id, username string) (bool, error)
+	// SubscribeChannel subscribes username to a channel. Subscribing again
+	// does nothing. It returns ErrNotFound if the channel does not exist.
+	SubscribeChannel(ctx context.Context, id, username string) error
+	// UnsubscribeChannel reports whether username was subscribed.
+	UnsubscribeChannel(ctx context.Context, id, username string) (bool, error)
+	// ChannelRole returns the role of username in a channel, "" if they do
+	// not subscribe to it. It returns ErrNotFound if the channel does not
+	// exist.
+	ChannelRole(ctx context.Context, id, username string) (string, error)
+	// SetChannelRole changes the role of a subscriber, reporting whether
+	// username subscribes to the channel.
+	SetChannelRole(ctx context.Context, id, username, role string) (bool, error)
+	// ChannelMembers returns the subscribers of a channel by username.
+	ChannelMembers(ctx context.Context, id string) ([]ChannelMember, error)
+	// ChannelSubscribersAmong returns which of usernames subscribe to a
+	// channel.
+	ChannelSubscribersAmong(ctx context.Context, id string, usernames []string) ([]string, error)
+	// CreateChannelPost stores post, filling in its ID and CreatedAt. A
+	// reply also subscribes its sender to the thread, and the sender of the
+	// parent unless they unsubscribed from it.
+	CreateChannelPost(ctx context.Context, post *ChannelPost) error
+	// ChannelPost returns a post of a channel. It returns ErrNotFound if
+	// the channel has no such post.
+	ChannelPost(ctx context.Context, id, postID string) (ChannelPost, error)
+	// DeleteChannelPost reports whether the channel had the post.
+	DeleteChannelPost(ctx context.Context, id, postID string) (bool, error)
+	// PinChannelPost pins or unpins a post, reporting whether the channel
+	// has the post.
+	PinChannelPost(ctx context.Context, id, postID string, pinned bool) (bool, error)
+	// PinnedChannelPosts returns the pinned posts of a channel, oldest
+	// first, leaving out shadowed posts viewer did not send.
+	PinnedChannelPosts(ctx context.Context, id, viewer string) ([]ChannelPost, error)
+	// ChannelPosts returns up to limit posts of a channel made before the
+	// post with ID before, oldest first, leaving out replies and shadowed
+	// posts viewer did not send. An empty before returns the latest posts.
+	ChannelPosts(ctx context.Context, id, viewer, before string, limit int) ([]ChannelPost, error)
+	// ChannelReplies is ChannelPosts for the replies to a post.
+	ChannelReplies(ctx context.Context, id, parentID, viewer, before string, limit int) ([]ChannelPost, error)
+	// ChannelThreads returns up to limit posts of a channel with replies,
+	// latest reply first, counting the replies viewer sees.
+	ChannelThreads(ctx context.Context, id, viewer string, limit int) ([]ChannelThread, error)
+	// SetThreadSubscription subscribes username to the thread of a post or
+	// unsubscribes them.
+	SetThreadSubscription(ctx context.Context, parentID, username string, subscribed bool) error
+	// MarkThreadRead marks the replies to a post read by username, if they
+	// subscribe to its thread.
+	MarkThreadRead(ctx context.Context, parentID, username string) error
+	// ThreadSubscribersAmong returns which of usernames subscribe to the
+	// thread of a post and still to its channel.
+	ThreadSubscribersAmong(ctx context.Context, id, parentID string, usernames []string) ([]string, error)
+	// CreateChannelInvite stores invite with the hash of its token, filling
+	// in its ID and CreatedAt. It returns ErrNotFound if the channel does
+	// not exist.
+	CreateChannelInvite(ctx context.Context, invite *ChannelInvite, tokenHash string) error
+	// ChannelInvites returns the invites of a channel, oldest first.
+	ChannelInvites(ctx context.Context, id string) ([]ChannelInvite, error)
+	// DeleteChannelInvite reports whether the channel had the invite.
+	DeleteChannelInvite(ctx context.Context, id, inviteID string) (bool, error)
+	// ChannelInviteByToken returns the invite with tokenHash. It returns
+	// ErrNotFound if there is none.
+	ChannelInviteByToken(ctx context.Context, tokenHash string) (ChannelInvite, error)
+	// UseChannelInvite counts a use of an invite and subscribes username to
+	// its channel as a member, unless the invite expired or was used up.
+	// It reports whether it did.
+	UseChannelInvite(ctx context.Context, inviteID, username string) (bool, error)
+}
+
+// BotStore manages bot accounts, their tokens, their slash commands and the
+// incoming hooks that post as them.
+type BotStore interface {
+	// CreateBot adds a user with the bot role and a password nobody knows,
+	// and stores the hash of its token. It returns ErrUsernameTaken if the
+	// username is in use.
+	CreateBot(ctx context.Context, bot *Bot, password Password, tokenHash string) error
+	// Bots returns every bot that was not deleted, ordered by username.
+	Bots(ctx context.Context) ([]Bot, error)
+	// SetBotToken replaces a bot's token. It returns ErrNotFound if username
+	// is not a bot.
+	SetBotToken(ctx context.Context, username, tokenHash string) error
+	// BotByToken returns the username of the bot with tokenHash. It returns
+	// ErrNotFound if there is none.
+	BotByToken(ctx context.Context, tokenHash string) (string, error)
+	// RegisterCommand stores cmd, filling in its CreatedAt, or updates the
+	// description if the bot registered it already. It returns
+	// ErrCommandTaken if another bot registered the name.
+	RegisterCommand(ctx context.Context, cmd *Command) error
+	// Commands returns every registered command, ordered by name.
+	Commands(ctx context.Context) ([]Command, error)
+	// DeleteCommand deletes a bot's command. It returns ErrNotFound unless
+	// bot registered name.
+	DeleteCommand(ctx context.Context, bot, name string) error
+	// CommandBot returns the bot that registered name. It returns
+	// ErrNotFound if no bot did.
+	CommandBot(ctx context.Context, name string) (string, error)
+	// CreateIncomingHook stores hook with the hash of its token, filling in
+	// its ID and CreatedAt.
+	CreateIncomingHook(ctx context.Context, hook *IncomingHook, tokenHash string) error
+	// IncomingHooks returns every incoming hook, oldest first.
+	IncomingHooks(ctx context.Context) ([]IncomingHook, error)
+	// DeleteIncomingHook deletes an incoming hook. It returns ErrNotFound if
+	// the hook does not exist.
+	DeleteIncomingHook(ctx context.Context, id string) error
+	// UseIncomingHook returns the incoming hook with tokenHash and records
+	// that it was used. It returns ErrNotFound if there is none.
+	UseIncomingHook(ctx context.Context, tokenHash string) (IncomingHook, error)
+}
+
+// AuditStore keeps the append-only audit log.
+type AuditStore interface {
+	// RecordAudit appends e to the audit log, filling in its ID and
+	// CreatedAt.
+	RecordAudit(ctx context.Context, e *AuditEntry) error
+	// AuditLog returns up to f.Limit entries matching f, newest first.
+	AuditLog(ctx context.Context, f AuditFilter) ([]AuditEntry, error)
+}
+
+// RetentionStore manages the monthly partitions messages are stored in.
+type RetentionStore interface {
+	// EnsureMessagePartitions creates the partitions for the months from
+	// from through through that have none yet.
+	EnsureMessagePartitions(ctx context.Context, from, through time.Time) error
+	// ExpireMessagePartitions removes the partitions whose messages were
+	// all sent before before, oldest first, with their statuses, pins,
+	// mentions, flags and votes. Unless archive is set they are dropped
+	// along with their attachments, whose blob keys are returned; archived
+	// ones are kept as tables of their own.
+	ExpireMessagePartitions(ctx context.Context, before time.Time, archive bool) ([]string, error)
+	// ArchivedMessages returns up to limit archived messages of the
+	// conversation between viewer and other sent before the archived
+	// message with ID before, oldest first, without those viewer deleted
+	// for themselves. An empty before returns the latest archived messages;
+	// one that is not archived returns ErrNotFound.
+	ArchivedMessages(ctx context.Context, viewer, other, before string, limit int) ([]Message, error)
+}
+
+// UserKeyStore manages the API keys users create for their own scripts and
+// integrations.
+type UserKeyStore interface {
+	// CreateUserAPIKey stores key with the hash of its secret, filling in
+	// its ID and CreatedAt.
+	CreateUserAPIKey(ctx context.Context, key *UserAPIKey, keyHash string) error
+	// UserAPIKeys returns username's API keys that were not revoked, oldest
+	// first.
+	UserAPIKeys(ctx context.Context, username string) ([]UserAPIKey, error)
+	// RevokeUserAPIKey revokes one of username's API keys. It returns
+	// ErrNotFound if username has no such key or it was revoked already.
+	RevokeUserAPIKey(ctx context.Context, username, id string) error
+	// UseUserAPIKey returns the unrevoked user API key with keyHash and
+	// records that it was used. It returns ErrNotFound if there is none.
+	UseUserAPIKey(ctx context.Context, keyHash string) (UserAPIKey, error)
+}
+
+// Store is the complete persistence layer used by the server.
+type Store interface {
+	UserStore
+	SessionStore
+	MessageStore
+	BlockStore
+	DeviceStore
+	StatusStore
+	AdminStore
+	ModerationStore
+	ScheduleStore
+	PinStore
+	MentionStore
+	AccountStore
+	ProvisioningStore
+	UserKeyStore
+	WebhookStore
+	BotStore
+	ChannelStore
+	AuditStore
+	RetentionStore
+
+	// Ping checks that the backing database is reachable.
+	Ping(ctx context.Context) error
+}
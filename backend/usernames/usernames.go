@@ -0,0 +1,139 @@
+// Package usernames decides which usernames may be registered and the
+// normalized form two usernames are compared by, so that names differing
+// only in case or Unicode presentation cannot both be taken.
+package usernames
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"golang.org/x/text/cases"
+	"golang.org/x/text/unicode/norm"
+)
+
+// MaxLength is the longest username the users table holds.
+const MaxLength = 50
+
+// DefaultPattern allows letters, digits, underscores, dots and hyphens,
+// starting and ending with a letter, digit or underscore, so that every
+// username can be mentioned as @username.
+const DefaultPattern = `[\p{L}\p{N}_]([\p{L}\p{N}_.-]*[\p{L}\p{N}_])?`
+
+// DefaultReserved are the names nobody may register by default, because
+// they could pass for staff or clash with mentions such as @everyone.
+var DefaultReserved = []string{
+	"admin", "administrator", "root", "system", "support", "moderator",
+	"staff", "official", "help", "security", "api", "bot", "everyone",
+	"here", "channel", "me", "null", "undefined",
+}
+
+// Config is a username policy. Reserved names and blocked words are
+// compared in normalized form.
+type Config struct {
+	// MinLength and MaxLength bound the number of characters.
+	MinLength int
+	MaxLength int
+	// Pattern is a regular expression usernames must match in full.
+	Pattern string
+	// Reserved are names nobody may register.
+	Reserved []string
+	// Blocklist are words no username may contain, even split up by
+	// dots, hyphens or underscores.
+	Blocklist []string
+}
+
+// Policy checks usernames against a Config.
+type Policy struct {
+	minLength, maxLength int
+	pattern              *regexp.Regexp
+	reserved             map[string]bool
+	blocklist            []string
+}
+
+// Default returns the policy of usernames of 3 to 50 characters matching
+// DefaultPattern, other than DefaultReserved.
+func Default() *Policy {
+	p, err := New(Config{MinLength: 3, MaxLength: MaxLength, Pattern: DefaultPattern, Reserved: DefaultReserved})
+	if err != nil {
+		panic(err)
+	}
+	return p
+}
+
+// New returns the policy of cfg, or an error if its lengths or pattern are
+// invalid.
+func New(cfg Config) (*Policy, error) {
+	if cfg.MinLength < 1 || cfg.MaxLength < cfg.MinLength || cfg.MaxLength > MaxLength {
+		return nil, fmt.Errorf("username lengths must be between 1 and %d, got %d to %d", MaxLength, cfg.MinLength, cfg.MaxLength)
+	}
+	pattern, err := regexp.Compile(`^(?:` + cfg.Pattern + `)$`)
+	if err != nil {
+		return nil, fmt.Errorf("invalid username pattern: %v", err)
+	}
+
+	p := &Policy{minLength: cfg.MinLength, maxLength: cfg.MaxLength, pattern: pattern, reserved: map[string]bool{}}
+	for _, name := range cfg.Reserved {
+		if name = strings.TrimSpace(name); name != "" {
+			p.reserved[Normalize(name)] = true
+		}
+	}
+	for _, word := range cfg.Blocklist {
+		if word = compact(Normalize(word)); word != "" {
+			p.blocklist = append(p.blocklist, word)
+		}
+	}
+	return p, nil
+}
+
+// LengthError reports a username shorter or longer than the policy allows.
+type LengthError struct {
+	Min, Max int
+}
+
+func (e *LengthError) Error() string {
+	return fmt.Sprintf("Username must be between %d and %d characters", e.Min, e.Max)
+}
+
+// Check returns an error, worded for the user, if username breaks the
+// policy.
+func (p *Policy) Check(username string) error {
+	if n := utf8.RuneCountInString(username); n < p.minLength || n > p.maxLength {
+		return &LengthError{Min: p.minLength, Max: p.maxLength}
+	}
+	if !p.pattern.MatchString(username) {
+		return errors.New("Username contains characters that are not allowed")
+	}
+
+	normalized := Normalize(username)
+	if p.reserved[normalized] {
+		return errors.New("Username is reserved")
+	}
+	compacted := compact(normalized)
+	for _, word := range p.blocklist {
+		if strings.Contains(compacted, word) {
+			return errors.New("Username contains a word that is not allowed")
+		}
+	}
+	return nil
+}
+
+// Normalize returns the form usernames are compared by: compatibility
+// composed and case folded, so "Bob", "BOB" and "ｂｏｂ" are the same name.
+func Normalize(username string) string {
+	return cases.Fold().String(norm.NFKC.String(username))
+}
+
+// compact drops everything but letters and digits, so blocked words are
+// found however they are punctuated.
+func compact(s string) string {
+	return strings.Map(func(r rune) rune {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			return r
+		}
+		return -1
+	}, s)
+}
@@ -0,0 +1,86 @@
+package ws
+
+import (
+	"log"
+	"time"
+
+	"backend/metrics"
+)
+
+// Delivery settings for events that version 2 clients must acknowledge. An
+// event left unacknowledged for ackTimeout is sent again with the same seq,
+// and a client that misses maxDeliveryAttempts is disconnected; whatever it
+// did not acknowledge stays undelivered in the store and is sent again when
+// it reconnects.
+const (
+	ackTimeout          = 5 * time.Second
+	ackCheckInterval    = time.Second
+	maxDeliveryAttempts = 3
+)
+
+// ackTypes are the event types version 2 clients must acknowledge.
+var ackTypes = map[string]bool{
+	TypeMessage: true,
+	TypePending: true,
+}
+
+// inflight is an event written to a client and not yet acknowledged.
+type inflight struct {
+	event    Event
+	sentAt   time.Time
+	attempts int
+}
+
+// track remembers an event written with seq until the client acknowledges it.
+func (c *Client) track(seq uint64, event Event) {
+	if c.Version < ProtocolV2 || !ackTypes[event.Type] {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.unacked[seq] = &inflight{event: event, sentAt: time.Now(), attempts: 1}
+}
+
+// Ack marks the event written with seq as received by the client and returns
+// it, or false if no such event is waiting for acknowledgement.
+func (c *Client) Ack(seq uint64) (Event, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	f, ok := c.unacked[seq]
+	if !ok {
+		return Event{}, false
+	}
+	delete(c.unacked, seq)
+	return f.event, true
+}
+
+// retryUnacked writes again every event whose acknowledgement is overdue. It
+// returns false once the client has missed maxDeliveryAttempts.
+func (c *Client) retryUnacked() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := time.Now()
+	for seq, f := range c.unacked {
+		if now.Sub(f.sentAt) < ackTimeout {
+			continue
+		}
+		if f.attempts >= maxDeliveryAttempts {
+			log.Printf("Client %s did not acknowledge %s event %d, disconnecting", c.UserID, f.event.Type, seq)
+			return false
+		}
+
+		c.Conn.SetWriteDeadline(now.Add(writeWait))
+		frame := outboundEnvelope{Type: f.event.Type, Payload: f.event.Payload, Seq: seq}
+		if err := c.Conn.WriteJSON(frame); err != nil {
+			log.Printf("WebSocket error: %v", err)
+			return false
+		}
+		f.sentAt = now
+		f.attempts++
+		metrics.WebSocketRedeliveries.Inc()
+	}
+	return true
+}
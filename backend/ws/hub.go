@@ -0,0 +1,391 @@
+// Package ws manages the WebSocket connections of this instance.
+package ws
+
+import (
+	"context"
+	"errors"
+	"log"
+	"sync"
+	"time"
+
+	"backend/metrics"
+
+	"github.com/gorilla/websocket"
+)
+
+// Policies for a client whose send buffer is full: PolicyDisconnect
+// disconnects it, so it reconnects and catches up from the store, while
+// PolicyDrop drops the event and keeps the connection.
+const (
+	PolicyDisconnect = "disconnect"
+	PolicyDrop       = "drop"
+)
+
+// Delivery settings, overridable from the config. clientSendBuffer is how
+// many outbound events may queue for a client before it is considered too
+// slow, and slowClientPolicy what happens to it then.
+var (
+	clientSendBuffer = 256
+	slowClientPolicy = PolicyDisconnect
+)
+
+// writeWait is the time allowed to write a single frame to a client.
+const writeWait = 10 * time.Second
+
+// Heartbeat settings, overridable from the config. A client that does not
+// answer a ping within pongWait is considered dead and disconnected.
+var (
+	pongWait   = 60 * time.Second
+	pingPeriod = 54 * time.Second
+)
+
+// ConfigureHeartbeat applies heartbeat intervals from the config, given in
+// seconds. Zero values keep the defaults.
+func ConfigureHeartbeat(pingIntervalSeconds, pongWaitSeconds int) error {
+	if pongWaitSeconds > 0 {
+		pongWait = time.Duration(pongWaitSeconds) * time.Second
+		pingPeriod = pongWait * 9 / 10
+	}
+	if pingIntervalSeconds > 0 {
+		pingPeriod = time.Duration(pingIntervalSeconds) * time.Second
+	}
+	if pingPeriod >= pongWait {
+		return errors.New("WS_PING_INTERVAL must be shorter than WS_PONG_WAIT")
+	}
+	return nil
+}
+
+// ConfigureDelivery applies the send buffer size and slow client policy from
+// the config. A zero size or empty policy keeps the default.
+func ConfigureDelivery(sendBuffer int, policy string) {
+	if sendBuffer > 0 {
+		clientSendBuffer = sendBuffer
+	}
+	if policy != "" {
+		slowClientPolicy = policy
+	}
+}
+
+// Client represents a connected WebSocket client, or a stream client reading
+// its events from Events.
+type Client struct {
+	UserID string
+	// Conn is nil for stream clients.
+	Conn *websocket.Conn
+	// Version is the protocol version negotiated with the client.
+	Version int
+	send    chan Event
+
+	// seq numbers the envelopes written to the client; only WritePump uses it.
+	seq uint64
+
+	// mu guards unacked, the written events awaiting acknowledgement by seq.
+	mu      sync.Mutex
+	unacked map[uint64]*inflight
+
+	// journal records the frames written, nil if nothing does.
+	journal Journal
+}
+
+// NewClient wraps a WebSocket connection for the given user, speaking the
+// given protocol version. Frames larger than MaxFrameSize close the
+// connection.
+func NewClient(userID string, conn *websocket.Conn, version int) *Client {
+	conn.SetReadLimit(MaxFrameSize)
+	return &Client{
+		UserID:  userID,
+		Conn:    conn,
+		Version: version,
+		send:    make(chan Event, clientSendBuffer),
+		unacked: make(map[uint64]*inflight),
+	}
+}
+
+// NewStreamClient creates a client for a connection other than a WebSocket,
+// such as a gRPC stream, which reads its events from Events. It receives
+// every event type and does not acknowledge events.
+func NewStreamClient(userID string) *Client {
+	return &Client{
+		UserID:  userID,
+		Version: ProtocolV2,
+		send:    make(chan Event, clientSendBuffer),
+		unacked: make(map[uint64]*inflight),
+	}
+}
+
+// Events returns the events queued for a stream client. The channel is
+// closed once the client is unregistered or disconnected.
+func (c *Client) Events() <-chan Event {
+	return c.send
+}
+
+// WritePump writes queued events, periodic pings and redeliveries of
+// unacknowledged events to the connection. It is the only goroutine that
+// writes to the connection, and it exits once the send channel is closed, a
+// write fails or the client stops acknowledging events.
+func (c *Client) WritePump() {
+	ticker := time.NewTicker(pingPeriod)
+	retry := time.NewTicker(ackCheckInterval)
+	defer func() {
+		ticker.Stop()
+		retry.Stop()
+		c.Conn.Close()
+	}()
+
+	for {
+		select {
+		case event, ok := <-c.send:
+			c.Conn.SetWriteDeadline(time.Now().Add(writeWait))
+			if !ok {
+				c.Conn.WriteMessage(websocket.CloseMessage, []byte{})
+				return
+			}
+			frame, ok := c.encode(event)
+			if !ok {
+				continue
+			}
+			if err := c.write(frame); err != nil {
+				log.Printf("WebSocket error: %v", err)
+				return
+			}
+		case <-ticker.C:
+			c.Conn.SetWriteDeadline(time.Now().Add(writeWait))
+			if err := c.Conn.WriteMessage(websocket.PingMessage, nil); err != nil {
+				log.Printf("WebSocket ping error for %s: %v", c.UserID, err)
+				return
+			}
+		case <-retry.C:
+			if !c.retryUnacked() {
+				return
+			}
+		}
+	}
+}
+
+// StartReadDeadline makes reads fail if no pong arrives within pongWait,
+// which reaps connections whose peer vanished without closing.
+func (c *Client) StartReadDeadline() {
+	c.Conn.SetReadDeadline(time.Now().Add(pongWait))
+	c.Conn.SetPongHandler(func(string) error {
+		return c.Conn.SetReadDeadline(time.Now().Add(pongWait))
+	})
+}
+
+// Hub tracks the WebSocket clients connected to this instance and is safe
+// for concurrent use. A user may hold several connections at once, e.g. one
+// per browser tab, and every event is delivered to all of them.
+type Hub struct {
+	mu      sync.RWMutex
+	clients map[string]map[*Client]struct{}
+
+	// active counts running connection goroutines so shutdown can wait for them.
+	active sync.WaitGroup
+}
+
+// NewHub creates an empty Hub.
+func NewHub() *Hub {
+	return &Hub{clients: make(map[string]map[*Client]struct{})}
+}
+
+// Register adds a client alongside any other connections of the same user.
+func (h *Hub) Register(c *Client) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	conns, ok := h.clients[c.UserID]
+	if !ok {
+		conns = make(map[*Client]struct{})
+		h.clients[c.UserID] = conns
+	}
+	conns[c] = struct{}{}
+	metrics.ActiveConnections.Inc()
+}
+
+// Track runs fn as part of a connection's lifetime, so that Wait does not
+// return before it finishes.
+func (h *Hub) Track(fn func()) {
+	h.active.Add(1)
+	defer h.active.Done()
+	fn()
+}
+
+// CloseAll disconnects every client with a close frame. It returns the
+// users who were connected, as Unregister no longer reports them going
+// offline.
+func (h *Hub) CloseAll() []string {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	users := make([]string, 0, len(h.clients))
+	for userID, conns := range h.clients {
+		for c := range conns {
+			close(c.send)
+			metrics.ActiveConnections.Dec()
+		}
+		delete(h.clients, userID)
+		users = append(users, userID)
+	}
+	return users
+}
+
+// Wait blocks until every tracked connection goroutine has finished or ctx
+// is done.
+func (h *Hub) Wait(ctx context.Context) error {
+	done := make(chan struct{})
+	go func() {
+		h.active.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Unregister removes a client and reports whether it was the user's last
+// connection to this instance.
+func (h *Hub) Unregister(c *Client) bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	conns, ok := h.clients[c.UserID]
+	if !ok {
+		return false
+	}
+	if _, ok := conns[c]; ok {
+		delete(conns, c)
+		close(c.send)
+		metrics.ActiveConnections.Dec()
+	}
+	if len(conns) == 0 {
+		delete(h.clients, c.UserID)
+		return true
+	}
+	return false
+}
+
+// SendToUser queues an event on every connection the user has to this
+// instance. A client whose buffer is full never blocks delivery to everyone
+// else: depending on the slow client policy the event is dropped or the
+// client disconnected.
+func (h *Hub) SendToUser(userID string, event Event) {
+	var slow []*Client
+
+	h.mu.RLock()
+	for client := range h.clients[userID] {
+		select {
+		case client.send <- event:
+		default:
+			slow = append(slow, client)
+		}
+	}
+	h.mu.RUnlock()
+
+	for _, client := range slow {
+		if slowClientPolicy == PolicyDrop {
+			log.Printf("Client %s is too slow, dropping %s event", userID, event.Type)
+			metrics.SlowClientEvents.WithLabelValues("dropped").Inc()
+			continue
+		}
+		log.Printf("Client %s is too slow, disconnecting", userID)
+		metrics.SlowClientEvents.WithLabelValues("disconnected").Inc()
+		h.Unregister(client)
+	}
+}
+
+// SendToClient queues an event on a single connection. It reports false if
+// the client has already disconnected or its buffer is full.
+func (h *Hub) SendToClient(c *Client, event Event) bool {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	if _, ok := h.clients[c.UserID][c]; !ok {
+		return false
+	}
+	select {
+	case c.send <- event:
+		return true
+	default:
+		return false
+	}
+}
+
+// SendToAll queues an event on every connection to this instance.
+func (h *Hub) SendToAll(event Event) {
+	for _, userID := range h.Users() {
+		h.SendToUser(userID, event)
+	}
+}
+
+// Disconnect closes every connection the user has to this instance with the
+// given close code and reason. WebSocket connections then unregister as
+// usual; stream clients are unregistered right away.
+func (h *Hub) Disconnect(userID string, code int, reason string) {
+	h.mu.RLock()
+	clients := make([]*Client, 0, len(h.clients[userID]))
+	for c := range h.clients[userID] {
+		clients = append(clients, c)
+	}
+	h.mu.RUnlock()
+
+	// Writing the close frame can block on a slow peer, so it is done
+	// without holding the lock.
+	msg := websocket.FormatCloseMessage(code, reason)
+	for _, c := range clients {
+		if c.Conn == nil {
+			h.Unregister(c)
+			continue
+		}
+		c.Conn.WriteControl(websocket.CloseMessage, msg, time.Now().Add(writeWait))
+		c.Conn.Close()
+	}
+}
+
+// Connected reports whether the user has any connection to this instance.
+func (h *Hub) Connected(userID string) bool {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	return len(h.clients[userID]) > 0
+}
+
+// Users returns every user with a connection to this instance.
+func (h *Hub) Users() []string {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	userIDs := make([]string, 0, len(h.clients))
+	for userID := range h.clients {
+		userIDs = append(userIDs, userID)
+	}
+	return userIDs
+}
+
+// QueueDepth returns the number of events queued on every connection to
+// this instance and not yet written.
+func (h *Hub) QueueDepth() int {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	n := 0
+	for _, conns := range h.clients {
+		for c := range conns {
+			n += len(c.send)
+		}
+	}
+	return n
+}
+
+// Count returns the number of connections to this instance.
+func (h *Hub) Count() int {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	n := 0
+	for _, conns := range h.clients {
+		n += len(conns)
+	}
+	return n
+}
@@ -0,0 +1,78 @@
+package ws
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/websocket"
+)
+
+// dialClient returns a client of hub for a WebSocket connection made in
+// the test, and the connection at the other end.
+func dialClient(t *testing.T, hub *Hub, userID string) (*Client, *websocket.Conn) {
+	t.Helper()
+	conns := make(chan *websocket.Conn, 1)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := (&websocket.Upgrader{}).Upgrade(w, r, nil)
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		conns <- conn
+	}))
+	t.Cleanup(srv.Close)
+
+	peer, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(srv.URL, "http"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { peer.Close() })
+	c := NewClient(userID, <-conns, ProtocolV2)
+	hub.Register(c)
+	return c, peer
+}
+
+func TestDisconnect(t *testing.T) {
+	hub := NewHub()
+	_, peer := dialClient(t, hub, "alice")
+	stream := NewStreamClient("alice")
+	hub.Register(stream)
+	other := NewStreamClient("bob")
+	hub.Register(other)
+
+	hub.Disconnect("alice", websocket.ClosePolicyViolation, "Banned")
+
+	_, _, err := peer.ReadMessage()
+	if !websocket.IsCloseError(err, websocket.ClosePolicyViolation) {
+		t.Errorf("peer read %v, want a policy violation close", err)
+	}
+	if _, open := <-stream.Events(); open {
+		t.Error("stream client still open")
+	}
+	if !hub.Connected("bob") {
+		t.Error("bob was disconnected too")
+	}
+}
+
+func TestCloseAll(t *testing.T) {
+	hub := NewHub()
+	alice := NewStreamClient("alice")
+	hub.Register(alice)
+	hub.Register(NewStreamClient("alice"))
+	hub.Register(NewStreamClient("bob"))
+
+	users := hub.CloseAll()
+	slices.Sort(users)
+	if !slices.Equal(users, []string{"alice", "bob"}) {
+		t.Errorf("CloseAll returned %v", users)
+	}
+	if hub.Count() != 0 {
+		t.Errorf("%d clients left", hub.Count())
+	}
+	if hub.Unregister(alice) {
+		t.Error("Unregister after CloseAll reported alice going offline again")
+	}
+}
@@ -0,0 +1,69 @@
+package ws
+
+import (
+	"encoding/json"
+	"log"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// Journal keeps the frames written to a version 2 client, so that if the
+// connection drops the client can resume on a new one and receive again
+// what it missed. Record must not block for long: it runs on the write path.
+type Journal interface {
+	Record(seq uint64, frame []byte)
+}
+
+// Frame is a frame recorded by a Journal, to be written again as is.
+type Frame struct {
+	Seq  uint64
+	Data []byte
+}
+
+// SetJournal records every frame written to the client from now on in j.
+// It must be called before WritePump starts.
+func (c *Client) SetJournal(j Journal) {
+	c.journal = j
+}
+
+// Replay writes frames recorded for an earlier connection of the same
+// session, with their original seqs, and continues numbering after the last
+// of them or lastSeq, whichever is higher. It must be called before
+// WritePump starts, and the replayed frames are not recorded again.
+func (c *Client) Replay(lastSeq uint64, frames []Frame) error {
+	c.seq = lastSeq
+	for _, f := range frames {
+		c.Conn.SetWriteDeadline(time.Now().Add(writeWait))
+		if err := c.Conn.WriteMessage(websocket.TextMessage, f.Data); err != nil {
+			return err
+		}
+		c.seq = max(c.seq, f.Seq)
+	}
+	return nil
+}
+
+// WriteEvent writes an event straight to the connection rather than
+// queueing it. It must be called before WritePump starts.
+func (c *Client) WriteEvent(event Event) error {
+	frame, ok := c.encode(event)
+	if !ok {
+		return nil
+	}
+	return c.write(frame)
+}
+
+// write encodes frame, records it in the journal if it is an envelope and
+// the client has one, and writes it to the connection.
+func (c *Client) write(frame interface{}) error {
+	data, err := json.Marshal(frame)
+	if err != nil {
+		log.Printf("Error encoding WebSocket frame: %v", err)
+		return nil
+	}
+	if env, ok := frame.(outboundEnvelope); ok && c.journal != nil {
+		c.journal.Record(env.Seq, data)
+	}
+	c.Conn.SetWriteDeadline(time.Now().Add(writeWait))
+	return c.Conn.WriteMessage(websocket.TextMessage, data)
+}
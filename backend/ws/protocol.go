@@ -0,0 +1,146 @@
+package ws
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"unicode/utf8"
+
+	"github.com/gorilla/websocket"
+)
+
+// Protocol versions. Version 1 clients exchange bare JSON objects: messages
+// as-is and other events carrying their own "type" field. Version 2 clients
+// exchange Envelopes, and may receive event types version 1 never had.
+const (
+	ProtocolV1 = 1
+	ProtocolV2 = 2
+
+	// ProtocolV2Name is the WebSocket subprotocol selecting version 2.
+	ProtocolV2Name = "chat.v2"
+)
+
+// MaxFrameSize is the largest frame, in bytes, a client may send. Larger
+// frames close the connection with code 1009 (message too big).
+const MaxFrameSize = 64 << 10
+
+// ErrMalformedFrame is returned by ReadEnvelope for a frame that is not a
+// JSON object of the client's protocol version. The connection remains
+// usable.
+var ErrMalformedFrame = errors.New("malformed frame")
+
+// Event types.
+const (
+	TypeMessage      = "message"
+	TypeReaction     = "reaction"
+	TypeTyping       = "typing"
+	TypePresence     = "presence"
+	TypeReadReceipt  = "read_receipt"
+	TypeError        = "error"
+	TypeAnnouncement = "announcement"
+	TypePending      = "pending"
+	TypeDelivered    = "delivered"
+	TypeAck          = "ack"
+	TypeDeleted      = "deleted"
+	TypeDraft        = "draft"
+	TypePin          = "pin"
+	TypeMention      = "mention"
+	TypeAuth         = "auth"
+	TypeChannelPost  = "channel_post"
+	TypeSession      = "session"
+)
+
+// v1Types are the event types version 1 clients understand. Other events are
+// not sent to them.
+var v1Types = map[string]bool{
+	TypeMessage:      true,
+	TypePresence:     true,
+	TypeError:        true,
+	TypeAnnouncement: true,
+	TypePending:      true,
+}
+
+// Event is something sent to a client, independent of protocol version.
+type Event struct {
+	Type    string      `json:"type"`
+	Payload interface{} `json:"payload"`
+}
+
+// Envelope is the version 2 frame format in both directions. Seq numbers the
+// frames a connection sends, starting at 1; clients may set it on their own
+// frames to correlate errors.
+type Envelope struct {
+	Type    string          `json:"type"`
+	Payload json.RawMessage `json:"payload,omitempty"`
+	Seq     uint64          `json:"seq,omitempty"`
+}
+
+// outboundEnvelope is an Envelope whose payload has not been encoded yet.
+type outboundEnvelope struct {
+	Type    string      `json:"type"`
+	Payload interface{} `json:"payload"`
+	Seq     uint64      `json:"seq"`
+}
+
+// NegotiatedVersion returns the protocol version of an upgraded connection:
+// version 2 if the client asked for the chat.v2 subprotocol or passed ?v=2,
+// version 1 otherwise.
+func NegotiatedVersion(r *http.Request, conn *websocket.Conn) int {
+	if conn.Subprotocol() == ProtocolV2Name || r.URL.Query().Get("v") == "2" {
+		return ProtocolV2
+	}
+	return ProtocolV1
+}
+
+// encode returns the frame to write for event, or false if the client's
+// protocol version has no such event.
+func (c *Client) encode(event Event) (interface{}, bool) {
+	if c.Version < ProtocolV2 {
+		return event.Payload, v1Types[event.Type]
+	}
+	c.seq++
+	c.track(c.seq, event)
+	return outboundEnvelope{Type: event.Type, Payload: event.Payload, Seq: c.seq}, true
+}
+
+// ReadEnvelope reads the next frame from the client. Version 1 frames are
+// translated: a frame without a type is a message, and the whole frame
+// becomes the payload. Binary frames, invalid UTF-8 and frames that do not
+// decode return an error wrapping ErrMalformedFrame.
+func (c *Client) ReadEnvelope() (Envelope, error) {
+	messageType, data, err := c.Conn.ReadMessage()
+	if err != nil {
+		return Envelope{}, err
+	}
+	if messageType != websocket.TextMessage {
+		return Envelope{}, fmt.Errorf("%w: expected a text frame", ErrMalformedFrame)
+	}
+	if !utf8.Valid(data) {
+		return Envelope{}, fmt.Errorf("%w: invalid UTF-8", ErrMalformedFrame)
+	}
+
+	var env Envelope
+	if c.Version >= ProtocolV2 {
+		if err := json.Unmarshal(data, &env); err != nil {
+			return Envelope{}, fmt.Errorf("%w: expected an envelope", ErrMalformedFrame)
+		}
+		if env.Type == "" {
+			return Envelope{}, fmt.Errorf("%w: missing type", ErrMalformedFrame)
+		}
+		return env, nil
+	}
+
+	var frame struct {
+		Type string `json:"type"`
+	}
+	if err := json.Unmarshal(data, &frame); err != nil {
+		return Envelope{}, fmt.Errorf("%w: expected a JSON object", ErrMalformedFrame)
+	}
+	env.Type = frame.Type
+	if env.Type == "" {
+		env.Type = TypeMessage
+	}
+	env.Payload = data
+	return env, nil
+}
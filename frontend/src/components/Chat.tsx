@@ -11,6 +11,10 @@ interface Message {
   content: string;
   upvotes: number;
   downvotes: number;
+  status?: string;
+  kind?: string;
+  created_at?: string;
+  updated_at?: string;
 }
 
 /**
@@ -46,7 +50,7 @@ const Chat: React.FC = () => {
     const fetchMessages = async () => {
       try {
         const response = await axios.get(
-          `http://127.0.0.1:8080/messages?sender=${currentUser}&receiver=${username}`
+          `http://127.0.0.1:8080/api/v1/messages?sender=${currentUser}&receiver=${username}`
         );
         console.log("API Response:", response.data);
         setMessages(response.data.messages || []);
@@ -60,14 +64,27 @@ const Chat: React.FC = () => {
 
   // Sets up WebSocket connection for real-time message updates
   useEffect(() => {
-    const socket = new WebSocket(
-      "ws://127.0.0.1:8080/ws?user_id=" + currentUser
-    );
+    const socket = new WebSocket("ws://127.0.0.1:8080/api/v1/ws");
     setWs(socket);
 
-    // Listens for incoming messages and updates state accordingly
-    socket.onmessage = (event) => {
-      const updatedMessage: Message = JSON.parse(event.data);
+    // Authenticates with the first frame, keeping the token out of the URL
+    socket.onopen = () => {
+      socket.send(
+        JSON.stringify({ type: "auth", token: localStorage.getItem("token") })
+      );
+    };
+
+    // Acknowledges messages addressed to the current user so the server
+    // stops queueing them for delivery
+    const acknowledge = (msg: Message) => {
+      if (msg.receiver === currentUser && msg.status === "sent") {
+        socket.send(JSON.stringify({ type: "delivered", id: msg.id }));
+      }
+    };
+
+    // Updates state with an incoming message
+    const receive = (updatedMessage: Message) => {
+      acknowledge(updatedMessage);
       if (
         (updatedMessage.sender === currentUser &&
           updatedMessage.receiver === username) ||
@@ -90,6 +107,17 @@ const Chat: React.FC = () => {
       }
     };
 
+    // Listens for incoming messages and updates state accordingly
+    socket.onmessage = (event) => {
+      const data = JSON.parse(event.data);
+      if (data.type === "pending") {
+        // Messages that arrived while this user was offline
+        data.messages.forEach(receive);
+      } else {
+        receive(data);
+      }
+    };
+
     // Cleans up WebSocket connection when component unmounts
     return () => {
       socket.close();
@@ -106,7 +134,7 @@ const Chat: React.FC = () => {
     if (message.trim() === "") return;
 
     try {
-      const response = await axios.post("http://127.0.0.1:8080/messages", {
+      const response = await axios.post("http://127.0.0.1:8080/api/v1/messages", {
         sender: currentUser,
         receiver: username,
         content: message,
@@ -134,11 +162,8 @@ const Chat: React.FC = () => {
     try {
       console.log("handleUpvote: " + messageId);
       await axios.post(
-        `http://127.0.0.1:8080/messages/${messageId}/upvote`,
-        null,
-        {
-          params: { user_id: currentUser },
-        }
+        `http://127.0.0.1:8080/api/v1/messages/${messageId}/upvote`,
+        null
       );
     } catch (error) {
       console.error("Error upvoting message:", error);
@@ -150,11 +175,8 @@ const Chat: React.FC = () => {
     console.log("handleDownvote: " + messageId);
     try {
       await axios.post(
-        `http://127.0.0.1:8080/messages/${messageId}/downvote`,
-        null,
-        {
-          params: { user_id: currentUser },
-        }
+        `http://127.0.0.1:8080/api/v1/messages/${messageId}/downvote`,
+        null
       );
     } catch (error) {
       console.error("Error downvoting message:", error);
@@ -164,6 +186,12 @@ const Chat: React.FC = () => {
   // Logs out the current user by removing username from localStorage
   const handleLogout = () => {
     localStorage.removeItem("username");
+    const refreshToken = localStorage.getItem("refresh_token");
+    if (refreshToken) {
+      axios.post("http://127.0.0.1:8080/api/v1/logout", { refresh_token: refreshToken });
+    }
+    localStorage.removeItem("token");
+    localStorage.removeItem("refresh_token");
   };
 
   // Renders the chat interface with messages, input box, and buttons
@@ -190,36 +218,42 @@ const Chat: React.FC = () => {
       </div>
       <h2 className="mt-4 mb-3">Chat with {username}</h2>
       <div className="chat-messages">
-        {messages.map((msg) => (
-          <div
-            key={msg.id}
-            className={`messageContainer ${
-              msg.sender === currentUser
-                ? "currentUserMessage"
-                : "otherUserMessage"
-            }`}
-          >
-            <div className="message-content">
-              <strong>{msg.sender}:</strong> {msg.content}
+        {messages.map((msg) =>
+          msg.kind === "system" ? (
+            <div key={msg.id} className="systemMessage">
+              {msg.content}
             </div>
-            <div className="vote-buttons">
-              <button
-                className="voteButton"
-                onClick={() => handleUpvote(msg.id)}
-              >
-                <FaArrowUp className="voteIcon upvote" />{" "}
-                <span className="upvote-count">{msg.upvotes}</span>
-              </button>
-              <button
-                className="voteButton"
-                onClick={() => handleDownvote(msg.id)}
-              >
-                <FaArrowDown className="voteIcon downvote" />{" "}
-                <span className="downvote-count">{msg.downvotes}</span>
-              </button>
+          ) : (
+            <div
+              key={msg.id}
+              className={`messageContainer ${
+                msg.sender === currentUser
+                  ? "currentUserMessage"
+                  : "otherUserMessage"
+              }`}
+            >
+              <div className="message-content">
+                <strong>{msg.sender}:</strong> {msg.content}
+              </div>
+              <div className="vote-buttons">
+                <button
+                  className="voteButton"
+                  onClick={() => handleUpvote(msg.id)}
+                >
+                  <FaArrowUp className="voteIcon upvote" />{" "}
+                  <span className="upvote-count">{msg.upvotes}</span>
+                </button>
+                <button
+                  className="voteButton"
+                  onClick={() => handleDownvote(msg.id)}
+                >
+                  <FaArrowDown className="voteIcon downvote" />{" "}
+                  <span className="downvote-count">{msg.downvotes}</span>
+                </button>
+              </div>
             </div>
-          </div>
-        ))}
+          )
+        )}
         <div ref={messagesEndRef}></div>
       </div>
       <div className="message-input-container">
@@ -25,7 +25,7 @@ const LoginForm: React.FC = () => {
   const handleLogin = async () => {
     try {
       // Send login request to the server
-      const response = await axios.post("http://127.0.0.1:8080/login", {
+      const response = await axios.post("http://127.0.0.1:8080/api/v1/login", {
         username,
         password,
       });
@@ -34,6 +34,10 @@ const LoginForm: React.FC = () => {
       console.log(response.data);
       setErrorMessage(null);
 
+      // Store the access token used to authenticate subsequent requests
+      localStorage.setItem("token", response.data.token);
+      localStorage.setItem("refresh_token", response.data.refresh_token);
+
       // Navigate to the user list page with username query parameter
       navigate(`/users?username=${username}`);
     } catch (error) {
@@ -29,7 +29,7 @@ const SignupForm: React.FC = () => {
     try {
       // Sends signup request to the server
       const response = await axios.post<{ message?: string; error?: string }>(
-        "http://127.0.0.1:8080/signup",
+        "http://127.0.0.1:8080/api/v1/signup",
         { username, password }
       );
 
@@ -22,7 +22,7 @@ const UserList: React.FC = () => {
     const fetchUsers = async () => {
       try {
         const response = await axios.get(
-          `http://127.0.0.1:8080/users?username=${username}`
+          `http://127.0.0.1:8080/api/v1/users?username=${username}`
         );
         // Sets the users state with the fetched user list
         setUsers(response.data.users || []);
@@ -52,6 +52,12 @@ const UserList: React.FC = () => {
   // Handles logout event by removing username from local storage and redirecting to homepage
   const handleLogout = () => {
     localStorage.removeItem("username");
+    const refreshToken = localStorage.getItem("refresh_token");
+    if (refreshToken) {
+      axios.post("http://127.0.0.1:8080/api/v1/logout", { refresh_token: refreshToken });
+    }
+    localStorage.removeItem("token");
+    localStorage.removeItem("refresh_token");
     window.location.href = "/";
   };
 
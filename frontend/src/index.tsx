@@ -3,6 +3,32 @@ import ReactDOM from 'react-dom/client';
 import './index.css';
 import App from './App';
 import reportWebVitals from './reportWebVitals';
+import axios from 'axios';
+
+// Attach the stored access token to every API request
+axios.interceptors.request.use((config) => {
+  const token = localStorage.getItem('token');
+  if (token) {
+    config.headers.Authorization = `Bearer ${token}`;
+  }
+  return config;
+});
+
+// Renew an expired access token once using the stored refresh token
+axios.interceptors.response.use(undefined, async (error) => {
+  const original = error.config;
+  const refreshToken = localStorage.getItem('refresh_token');
+  if (error.response?.status === 401 && refreshToken && !original._retry) {
+    original._retry = true;
+    const response = await axios.post('http://127.0.0.1:8080/api/v1/token/refresh', {
+      refresh_token: refreshToken,
+    });
+    localStorage.setItem('token', response.data.token);
+    localStorage.setItem('refresh_token', response.data.refresh_token);
+    return axios(original);
+  }
+  return Promise.reject(error);
+});
 
 const root = ReactDOM.createRoot(
   document.getElementById('root') as HTMLElement